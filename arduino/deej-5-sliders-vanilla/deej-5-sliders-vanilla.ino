@@ -51,11 +51,32 @@ const unsigned long displayUpdateInterval = 50;  // Update display every 50ms
 unsigned long lastDeejCommand = 0;
 const unsigned long deejTimeoutMs = 10000;  // 10 seconds
 
+// Info pages pushed by deej (weather, calendar): shown over the mixer view for a few seconds
+char pageTitle[11] = "";
+char pageText[22] = "";
+unsigned long pageUntil = 0;
+const unsigned long pageDurationMs = 5000;
+
+// This board's ID, so deej finds it whichever COM port it ends up on (set device_id in deej's config to match).
+// Give each of your boards its own
+const char* DEVICE_ID = "deej-4";
+
+// Reported in the handshake, so deej can tell which firmware it's talking to
+const char* FIRMWARE_VERSION = "1.1.0";
+const int PROTOCOL_VERSION = 1;
+
+// Sleep mode: deej blanks the display and LEDs while the computer is locked or idle (#Z:1), and wakes them (#Z:0).
+// Commands keep being applied while asleep, so everything is current on waking
+bool sleeping = false;
+bool displayOff = false;
+
 // Quiet mode for firmware uploads (stops serial output to allow 1200 baud reset)
 unsigned long quietUntil = 0;
 
-// Forward declaration
+// Forward declarations
 void showMessage(const char* line1, const char* line2);
+void sendDeviceID();
+void sendHello();
 
 void setup() {
   for (int i = 0; i < NUM_SLIDERS; i++) {
@@ -82,6 +103,30 @@ void setup() {
   while (Serial.available() > 0) {
     Serial.read();
   }
+
+  // Tell deej what our display can show (the default font is ASCII-only, labels are 4 chars)
+  Serial.println("#CAPS:charset=ascii,label=4,title=10,text=21");
+  sendDeviceID();
+  sendHello();
+}
+
+// Handshake: tells deej what this board is and has (plain LEDs, no RGB, a display)
+void sendHello() {
+  Serial.print("#HELLO:proto=");
+  Serial.print(PROTOCOL_VERSION);
+  Serial.print(",fw=");
+  Serial.print(FIRMWARE_VERSION);
+  Serial.print(",sliders=");
+  Serial.print(NUM_SLIDERS);
+  Serial.print(",buttons=");
+  Serial.print(NUM_BUTTONS);
+  Serial.print(",leds=1,rgb=0,display=1,id=");
+  Serial.println(DEVICE_ID);
+}
+
+void sendDeviceID() {
+  Serial.print("#ID:");
+  Serial.println(DEVICE_ID);
 }
 
 void loop() {
@@ -113,11 +158,11 @@ void checkButtons() {
     if ((millis() - lastDebounceTimes[i]) > debounceDelay) {
       if (reading != buttonStates[i]) {
         buttonStates[i] = reading;
-        // Button pressed (LOW because of pull-up)
-        if (buttonStates[i] == LOW) {
-          Serial.print("#B");
-          Serial.println(i);  // Send button ID: 0=Play/Pause, 1=Prev, 2=Next
-        }
+        // Report both presses and releases (pressed = LOW because of pull-up)
+        // Format: #B<id>:1 on press, #B<id>:0 on release - actions are mapped in deej's config
+        Serial.print("#B");
+        Serial.print(i);
+        Serial.println(buttonStates[i] == LOW ? ":1" : ":0");
       }
     }
 
@@ -156,6 +201,10 @@ void sendSliderValues() {
   Serial.println(builtString);
 }
 
+bool deejTimedOut() {
+  return lastDeejCommand == 0 || millis() - lastDeejCommand > deejTimeoutMs;
+}
+
 void updateDisplay() {
   // Throttle display updates to avoid flickering
   if (millis() - lastDisplayUpdate < displayUpdateInterval) {
@@ -163,13 +212,29 @@ void updateDisplay() {
   }
   lastDisplayUpdate = millis();
 
+  // Stay blank while asleep - unless deej went away, which is worth showing
+  bool blank = sleeping && !deejTimedOut();
+  if (blank != displayOff) {
+    display.ssd1306_command(blank ? SSD1306_DISPLAYOFF : SSD1306_DISPLAYON);
+    displayOff = blank;
+  }
+  if (blank) {
+    return;
+  }
+
   // Show message if deej never connected, or timed out after connecting
-  if (lastDeejCommand == 0 || millis() - lastDeejCommand > deejTimeoutMs) {
+  if (deejTimedOut()) {
     showMessage(lastDeejCommand == 0 ? "DEEJ" : "NO DEEJ",
                 lastDeejCommand == 0 ? "Waiting..." : "Check connection");
     return;
   }
 
+  // Show the latest info page while it's fresh
+  if (millis() < pageUntil) {
+    showMessage(pageTitle, pageText);
+    return;
+  }
+
   display.clearDisplay();
 
   // Calculate bar dimensions - 4 bars, no border, 4px margin
@@ -321,6 +386,49 @@ void processCommand(char* cmd) {
     return;
   }
 
+  // Handshake: #HELLO:proto=1,app=... - deej introduces itself, and we answer in kind
+  if (strncmp(cmd, "#HELLO:", 7) == 0) {
+    sendHello();
+    return;
+  }
+
+  // Heartbeat: #K:<seq> - deej checks the link is alive, answered with the same line
+  if (cmd[1] == 'K' && cmd[2] == ':') {
+    Serial.println(cmd);
+    return;
+  }
+
+  // ID request: #ID? - deej asks when looking for this board by its ID
+  if (cmd[1] == 'I' && cmd[2] == 'D' && cmd[3] == '?') {
+    sendDeviceID();
+    return;
+  }
+
+  // Sleep command: #Z:1 blanks the display and LEDs, #Z:0 wakes them
+  if (cmd[1] == 'Z' && cmd[2] == ':') {
+    sleeping = (cmd[3] == '1');
+    return;
+  }
+
+  // Display page command: #D:<title>|<text>
+  if (cmd[1] == 'D' && cmd[2] == ':') {
+    char* text = strchr(cmd + 3, '|');
+    if (text != NULL) {
+      *text = '\0';
+      text++;
+    } else {
+      text = cmd + strlen(cmd);
+    }
+
+    strncpy(pageTitle, cmd + 3, sizeof(pageTitle) - 1);
+    pageTitle[sizeof(pageTitle) - 1] = '\0';
+    strncpy(pageText, text, sizeof(pageText) - 1);
+    pageText[sizeof(pageText) - 1] = '\0';
+
+    pageUntil = millis() + pageDurationMs;
+    return;
+  }
+
   // Audio peak command with names: #AP:50:chr,75:fir,30:dis,0:
   if (cmd[1] == 'A' && cmd[2] == 'P' && cmd[3] == ':') {
     char* ptr = cmd + 4;
@@ -391,6 +499,11 @@ void processCommand(char* cmd) {
     return;
   }
 
+  // LED color command: #LC:ff0000,00ff00,... - this board's LEDs are plain on/off ones, so there's nothing to do
+  if (cmd[2] == 'C') {
+    return;
+  }
+
   // Single LED command: #L<id>:<state>
   // Example: #L0:1 (LED 0 on), #L1:0 (LED 1 off)
   char* colonPos = strchr(cmd, ':');
@@ -406,7 +519,9 @@ void processCommand(char* cmd) {
 }
 
 void updateLEDs() {
+  bool blank = sleeping && !deejTimedOut();
+
   for (int i = 0; i < NUM_SLIDERS; i++) {
-    digitalWrite(ledPins[i], ledStates[i] ? HIGH : LOW);
+    digitalWrite(ledPins[i], ledStates[i] && !blank ? HIGH : LOW);
   }
 }
@@ -1,5 +1,7 @@
 module github.com/omriharel/deej
 
+// deej's own code sticks to go 1.14, but go.bug.st/serial and golang.org/x/sys (v0.19.0, which serial requires)
+// use newer language features, so building it takes a go 1.18 toolchain or above
 go 1.14
 
 require (
@@ -17,6 +19,7 @@ require (
 	github.com/moutend/go-wca v0.1.2-0.20190422112502-0fa027b3d89a
 	github.com/spf13/viper v1.7.1
 	github.com/thoas/go-funk v0.7.0
-	go.bug.st/serial v1.6.4 // indirect
+	go.bug.st/serial v1.6.4
 	go.uber.org/zap v1.15.0
+	golang.org/x/sys v0.19.0
 )
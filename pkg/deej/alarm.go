@@ -0,0 +1,139 @@
+package deej
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	automationActionAlarmSound = "alarm.sound" // play the sound file given by the "file" key
+	automationActionAlarmRamp  = "alarm.ramp"  // gradually raise the "target" key's volume, optionally starting playback
+
+	buttonActionAlarmCancel = "alarm.cancel" // stop any alarm sound and ramp that's currently going
+
+	defaultAlarmRampMinutes = 10
+	defaultAlarmRampVolume  = 50
+)
+
+// alarmController plays alarm sounds and ramps, and cancels them on request
+type alarmController struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	rampTargets []string
+	stopSound   func()
+}
+
+func newAlarmController(deej *Deej, logger *zap.SugaredLogger) *alarmController {
+	logger = logger.Named("alarms")
+
+	ac := &alarmController{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created alarm controller instance")
+
+	return ac
+}
+
+// PlaySound plays the sound file given by the "file" param
+func (ac *alarmController) PlaySound(params map[string]string) {
+	file := params["file"]
+	if file == "" {
+		ac.logger.Warn("Alarm sound has no file set, ignoring")
+		return
+	}
+
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	if ac.stopSound != nil {
+		ac.stopSound()
+		ac.stopSound = nil
+	}
+
+	stop, err := playSoundFile(file)
+	if err != nil {
+		ac.logger.Warnw("Failed to play alarm sound", "file", file, "error", err)
+		return
+	}
+
+	ac.stopSound = stop
+	ac.logger.Infow("Playing alarm sound", "file", file)
+}
+
+// Ramp sets the "target" param's volume to "from" percent, then fades it up to "volume" percent over "minutes".
+// with "media_play" set, a play/pause key is pressed first - meant for a player that's been left paused
+func (ac *alarmController) Ramp(params map[string]string) {
+	target := strings.ToLower(params["target"])
+	if target == "" {
+		ac.logger.Warn("Alarm ramp has no target set, ignoring")
+		return
+	}
+
+	from := math.Min(100, alarmParamFloat(params, "from", 0))
+	to := math.Min(100, alarmParamFloat(params, "volume", defaultAlarmRampVolume))
+	minutes := alarmParamFloat(params, "minutes", defaultAlarmRampMinutes)
+
+	if mediaPlay, _ := strconv.ParseBool(params["media_play"]); mediaPlay {
+		ac.deej.mediaController.PlayPause()
+	}
+
+	if !ac.deej.sessions.setTargetVolume(target, float32(from/100)) {
+		ac.logger.Warnw("Alarm ramp target isn't running, ignoring", "target", target)
+		return
+	}
+
+	easing := strings.ToLower(params["easing"])
+	if !validFadeEasing(easing) {
+		easing = fadeEasingLinear
+	}
+
+	ac.deej.fader.fadeTarget(target, float32(to/100), time.Duration(minutes*float64(time.Minute)), easing)
+
+	ac.lock.Lock()
+	ac.rampTargets = append(ac.rampTargets, target)
+	ac.lock.Unlock()
+
+	ac.logger.Infow("Started alarm ramp", "target", target, "from", from, "to", to, "minutes", minutes)
+}
+
+// Cancel stops the alarm sound and any ramps, leaving ramped targets at whatever volume they'd reached
+func (ac *alarmController) Cancel() {
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	if ac.stopSound == nil && len(ac.rampTargets) == 0 {
+		return
+	}
+
+	if ac.stopSound != nil {
+		ac.stopSound()
+		ac.stopSound = nil
+	}
+
+	for _, target := range ac.rampTargets {
+		ac.deej.fader.cancel(target)
+	}
+
+	ac.rampTargets = nil
+
+	ac.logger.Info("Alarm cancelled")
+}
+
+func alarmParamFloat(params map[string]string, key string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(params[key], 64)
+	if err != nil || value < 0 {
+		return defaultValue
+	}
+
+	return value
+}
@@ -0,0 +1,226 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+const (
+
+	// "deej" on a phone keypad
+	defaultAPIPort = 3335
+
+	// only this machine, unless api.address says otherwise (0.0.0.0 for every network)
+	defaultAPIAddress = "127.0.0.1"
+
+	apiPathEvents     = "/events"
+	apiPathNowPlaying = "/now-playing"
+)
+
+// apiConfig holds the user's local API settings
+type apiConfig struct {
+	Enabled bool
+	Address string
+	Port    int
+
+	// serve link health for Prometheus and the like at /metrics
+	Metrics bool
+}
+
+// apiServer serves deej's local HTTP API. it listens on localhost unless told otherwise, as it's mostly meant for
+// tools running on the same machine (like deej events). integrations can be handed a guest token that only lets
+// them do so much, and anything from another machine needs one (see api_tokens.go)
+type apiServer struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	server  *http.Server
+	address string
+	port    int
+}
+
+func newAPIServer(deej *Deej, logger *zap.SugaredLogger) *apiServer {
+	logger = logger.Named("api")
+
+	as := &apiServer{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created API server instance")
+
+	return as
+}
+
+func (as *apiServer) initialize() {
+	as.setupOnConfigReload()
+}
+
+// Start begins serving the API, if enabled in the config
+func (as *apiServer) Start() {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+
+	config := as.deej.config.API
+
+	if as.server != nil || !config.Enabled {
+		return
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(config.Address, strconv.Itoa(config.Port)))
+	if err != nil {
+		as.logger.Warnw("Failed to listen for API requests", "address", config.Address, "port", config.Port, "error", err)
+		return
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(apiPathEvents, as.scoped(apiScopeRead, as.handleEvents))
+	mux.HandleFunc(apiPathNowPlaying, as.scoped(apiScopeRead, as.handleNowPlaying))
+	mux.HandleFunc(apiPathSliders, as.scoped(apiScopeControl, as.handleSliders))
+	mux.HandleFunc(apiPathSessions, as.scoped(apiScopeRead, as.handleSessions))
+	mux.HandleFunc(apiPathMeter, as.scoped(apiScopeRead, as.handleMeter))
+	mux.HandleFunc(apiPathProfiles, as.scoped(apiScopeControl, as.handleProfiles))
+	mux.HandleFunc(apiPathButtons, as.scoped(apiScopeControl, as.handleButtons))
+	mux.HandleFunc(apiPathRoute, as.scoped(apiScopeControl, as.handleRoute))
+	mux.HandleFunc(apiPathUsage, as.scoped(apiScopeRead, as.handleUsage))
+	mux.HandleFunc(apiPathHearing, as.scoped(apiScopeRead, as.handleHearing))
+	mux.HandleFunc(apiPathHearingSnooze, as.scoped(apiScopeControl, as.handleHearingSnooze))
+	mux.HandleFunc(apiPathSerial, as.scoped(apiScopeAdmin, as.handleSerial))
+	mux.HandleFunc(apiPathConsole, as.scoped(apiScopeAdmin, as.handleConsole))
+	mux.HandleFunc(apiPathDashboard, as.scoped(apiScopeRead, as.handleDashboard))
+	mux.HandleFunc(apiPathConfigMappings, as.scoped(apiScopeControl, as.handleConfigMappings))
+	mux.HandleFunc(apiPathDeviceHold, as.scoped(apiScopeAdmin, as.handleDeviceHold))
+	mux.HandleFunc(apiPathDeviceResume, as.scoped(apiScopeAdmin, as.handleDeviceResume))
+	mux.HandleFunc(apiPathDeviceRelease, as.scoped(apiScopeAdmin, as.handleDeviceRelease))
+	mux.HandleFunc(apiPathDevicePair, as.scoped(apiScopeAdmin, as.handleDevicePair))
+	mux.HandleFunc(apiPathDevicePairFinish, as.scoped(apiScopeAdmin, as.handleDevicePairFinish))
+	mux.HandleFunc(apiPathDeviceUnpair, as.scoped(apiScopeAdmin, as.handleDeviceUnpair))
+	mux.HandleFunc(apiPathMetrics, as.scoped(apiScopeRead, as.handleMetrics))
+	mux.HandleFunc(apiPathProtocol, as.scoped(apiScopeRead, as.handleProtocol))
+	mux.HandleFunc(apiPathTokens, as.scoped(apiScopeAdmin, as.handleTokens))
+	mux.HandleFunc(apiPathTokensRevoke, as.scoped(apiScopeAdmin, as.handleTokensRevoke))
+
+	as.server = &http.Server{Handler: mux}
+	as.address = config.Address
+	as.port = config.Port
+
+	go func(server *http.Server) {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			as.logger.Warnw("API server stopped unexpectedly", "error", err)
+		}
+	}(as.server)
+
+	as.logger.Infow("Serving API", "address", listener.Addr())
+}
+
+// Stop stops serving the API
+func (as *apiServer) Stop() {
+	as.lock.Lock()
+	defer as.lock.Unlock()
+
+	if as.server == nil {
+		return
+	}
+
+	if err := as.server.Close(); err != nil {
+		as.logger.Warnw("Failed to stop API server", "error", err)
+	}
+
+	as.server = nil
+}
+
+// handleEvents returns the event log as JSON, optionally only what came after ?since=<seq>, limited to ?limit=<n>.
+// ?schema=1 returns them in the versioned shape webhooks get (see event_schema.go) rather than the event log's own
+func (as *apiServer) handleEvents(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var since uint64
+	if value := request.URL.Query().Get("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(writer, "since must be an event sequence number", http.StatusBadRequest)
+			return
+		}
+
+		since = parsed
+	}
+
+	limit := 0
+	if value := request.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(writer, "limit must be a number of events", http.StatusBadRequest)
+			return
+		}
+
+		limit = parsed
+	}
+
+	var response interface{}
+
+	switch schema := request.URL.Query().Get("schema"); schema {
+	case "":
+		response = as.deej.events.since(since, limit)
+
+	case strconv.Itoa(eventSchemaVersion):
+		events := []deejEvent{}
+		for _, entry := range as.deej.events.since(since, limit) {
+			events = append(events, entry.normalized())
+		}
+
+		response = events
+
+	default:
+		http.Error(writer, fmt.Sprintf("unknown schema version %s (this deej has %d)", schema, eventSchemaVersion),
+			http.StatusBadRequest)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write events response", "error", err)
+	}
+}
+
+// handleNowPlaying returns what the OS's media session is playing as JSON, with empty fields when nothing is
+func (as *apiServer) handleNowPlaying(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(as.deej.nowPlaying.current()); err != nil {
+		as.logger.Debugw("Failed to write now playing response", "error", err)
+	}
+}
+
+// restart when the API is turned on or off, or moves to another address or port
+func (as *apiServer) setupOnConfigReload() {
+	as.deej.onConfigReload(func() {
+		config := as.deej.config.API
+
+		as.lock.Lock()
+		moved := as.address != config.Address || as.port != config.Port
+		changed := (as.server != nil) != config.Enabled || (config.Enabled && moved)
+		as.lock.Unlock()
+
+		if changed {
+			as.Stop()
+			as.Start()
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	apiPathSessions = "/sessions"
+	apiPathProfiles = "/profiles"
+	apiPathButtons  = "/buttons"
+)
+
+// apiSession is what the API shows of an audio session
+type apiSession struct {
+	Key    string `json:"key"`
+	Volume int    `json:"volume"`
+	Muted  bool   `json:"muted"`
+
+	// the slider the session's mapped to, if any
+	Slider *int `json:"slider,omitempty"`
+
+	ProcessID uint32 `json:"pid,omitempty"`
+}
+
+// handleSessions returns every audio session deej currently knows of as JSON, sorted by key. with ?sliders=,
+// only the ones mapped to those sliders (see api_filter.go)
+func (as *apiServer) handleSessions(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseAPIFilter(request.URL.Query())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	m := as.deej.sessions
+
+	// copied out first, as working out which slider each one's mapped to takes the mapping's lock
+	sessions := []Session{}
+
+	m.lock.Lock()
+	for _, keySessions := range m.m {
+		sessions = append(sessions, keySessions...)
+	}
+	m.lock.Unlock()
+
+	infos := make([]apiSession, 0, len(sessions))
+
+	for _, session := range sessions {
+		info := apiSession{
+			Key:    session.Key(),
+			Volume: int(math.Round(float64(session.GetVolume()) * 100)),
+			Muted:  session.GetMute(),
+		}
+
+		sliderID, mapped := m.sliderMappedTo(session)
+		if filter.sliders != nil && (!mapped || !filter.wantsSlider(sliderID)) {
+			continue
+		}
+
+		if mapped {
+			info.Slider = &sliderID
+		}
+
+		if process, ok := session.(processSession); ok {
+			info.ProcessID = process.ProcessID()
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	response := make([]interface{}, len(infos))
+	for idx, info := range infos {
+		response[idx] = filter.pick(info)
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write sessions response", "error", err)
+	}
+}
+
+// setSlider moves a slider to ?volume=<0-100> as if it had moved on the device, so its targets (and anything else
+// following sliders, like the display) go along with it. the device's own slider takes over again once it moves
+func (as *apiServer) setSlider(writer http.ResponseWriter, request *http.Request) {
+	query := request.URL.Query()
+
+	sliderID, err := strconv.Atoi(query.Get("id"))
+	if err != nil || sliderID < 0 {
+		http.Error(writer, "id must be a slider ID", http.StatusBadRequest)
+		return
+	}
+
+	volume, err := strconv.Atoi(query.Get("volume"))
+	if err != nil || volume < 0 || volume > 100 {
+		http.Error(writer, "volume must be a percentage", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := as.deej.config.SliderMapping.get(sliderID); !ok {
+		http.Error(writer, "no targets mapped to that slider", http.StatusNotFound)
+		return
+	}
+
+	as.logger.Infow("Moving slider from the API", "sliderID", sliderID, "volume", volume)
+
+	value := float32(volume) / 100
+	as.deej.serial.deliverSliderMoves([]SliderMoveEvent{{SliderID: sliderID, PercentValue: value, Position: value}})
+}
+
+// handleProfiles returns the configured profiles and the active one (GET), or switches to ?name=<profile> (POST)
+func (as *apiServer) handleProfiles(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		response := apiProfiles{
+			Active:   as.deej.config.ActiveProfile,
+			Profiles: as.deej.config.ProfileNames(),
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			as.logger.Debugw("Failed to write profiles response", "error", err)
+		}
+
+	case http.MethodPost:
+		if err := as.deej.config.SwitchProfile(request.URL.Query().Get("name")); err != nil {
+			http.Error(writer, err.Error(), http.StatusNotFound)
+		}
+
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// apiProfiles is what the API shows of the profiles
+type apiProfiles struct {
+	Active   string   `json:"active"`
+	Profiles []string `json:"profiles"`
+}
+
+// ListProfiles prints the running deej's profiles, marking the active one
+func ListProfiles(logger *zap.SugaredLogger, out io.Writer) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	profiles := apiProfiles{}
+	if err := getLocalAPI(apiAddress+apiPathProfiles, &profiles); err != nil {
+		return err
+	}
+
+	for _, name := range profiles.Profiles {
+		marker := " "
+		if name == profiles.Active {
+			marker = "*"
+		}
+
+		fmt.Fprintf(out, "%s %s\n", marker, name)
+	}
+
+	return nil
+}
+
+// SwitchRunningProfile has the running deej switch to the named profile, like its tray menu would
+func SwitchRunningProfile(logger *zap.SugaredLogger, out io.Writer, name string) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	if err := postLocalAPI(apiAddress+apiPathProfiles+"?name="+url.QueryEscape(name), nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Switched to profile %s\n", name)
+
+	return nil
+}
+
+// handleButtons presses the button with the given ?id=, running whatever it's mapped to. ?state=down or up
+// only presses or releases it, for actions that care how long it's held (like push-to-talk)
+func (as *apiServer) handleButtons(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+
+	buttonID, err := strconv.Atoi(query.Get("id"))
+	if err != nil || buttonID < 0 {
+		http.Error(writer, "id must be a button ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := as.deej.config.ButtonMapping.get(buttonID); !ok {
+		http.Error(writer, "no action mapped to that button", http.StatusNotFound)
+		return
+	}
+
+	var buttonEvents []ButtonEvent
+
+	switch strings.ToLower(query.Get("state")) {
+	case "", "press":
+		buttonEvents = []ButtonEvent{{ButtonID: buttonID, Pressed: true}, {ButtonID: buttonID, Pressed: false}}
+	case "down":
+		buttonEvents = []ButtonEvent{{ButtonID: buttonID, Pressed: true}}
+	case "up":
+		buttonEvents = []ButtonEvent{{ButtonID: buttonID, Pressed: false}}
+	default:
+		http.Error(writer, "state must be press, down or up", http.StatusBadRequest)
+		return
+	}
+
+	as.logger.Infow("Pressing button from the API", "buttonID", buttonID, "state", query.Get("state"))
+
+	as.deej.serial.deliverButtonEvents(buttonEvents)
+}
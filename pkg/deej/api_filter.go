@@ -0,0 +1,106 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// apiFilter is what an API client asked to see, so overlays and the like only get (and deej only works out)
+// what they need. ?fields=peak,app keeps only those fields of every entry, and ?sliders=0-2,5 only those sliders
+type apiFilter struct {
+
+	// nil for every field or slider
+	fields  map[string]bool
+	sliders map[int]bool
+}
+
+func parseAPIFilter(query url.Values) (apiFilter, error) {
+	filter := apiFilter{}
+
+	if value := query.Get("fields"); value != "" {
+		filter.fields = map[string]bool{}
+
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				filter.fields[field] = true
+			}
+		}
+	}
+
+	if value := query.Get("sliders"); value != "" {
+		filter.sliders = map[int]bool{}
+
+		for _, part := range strings.Split(value, ",") {
+			first, last, err := parseSliderRange(strings.TrimSpace(part))
+			if err != nil {
+				return apiFilter{}, err
+			}
+
+			for sliderID := first; sliderID <= last; sliderID++ {
+				filter.sliders[sliderID] = true
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// parseSliderRange reads a slider ID ("3") or an inclusive range of them ("0-2")
+func parseSliderRange(value string) (int, int, error) {
+	bounds := strings.SplitN(value, "-", 2)
+
+	first, err := strconv.Atoi(bounds[0])
+	if err != nil || first < 0 {
+		return 0, 0, fmt.Errorf("invalid slider %q", value)
+	}
+
+	if len(bounds) == 1 {
+		return first, first, nil
+	}
+
+	last, err := strconv.Atoi(bounds[1])
+	if err != nil || last < first {
+		return 0, 0, fmt.Errorf("invalid slider range %q", value)
+	}
+
+	return first, last, nil
+}
+
+// wantsSlider returns whether the client asked for the given slider
+func (filter apiFilter) wantsSlider(sliderID int) bool {
+	return filter.sliders == nil || filter.sliders[sliderID]
+}
+
+// wantsField returns whether the client asked for the given field
+func (filter apiFilter) wantsField(field string) bool {
+	return filter.fields == nil || filter.fields[field]
+}
+
+// pick returns an entry with only the fields the client asked for, going by its JSON names. entries go through
+// as they are without a fields filter
+func (filter apiFilter) pick(entry interface{}) interface{} {
+	if filter.fields == nil {
+		return entry
+	}
+
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return entry
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return entry
+	}
+
+	for field := range fields {
+		if !filter.fields[field] {
+			delete(fields, field)
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,165 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	apiPathMeter = "/meter"
+
+	// the fastest a meter stream goes, as that's how often the levels are read in the first place
+	maxMeterStreamRate = float64(time.Second / audioMeterCheckInterval)
+)
+
+// meterEntry is one slider's reading
+type meterEntry struct {
+	Peak   int    `json:"peak"`
+	App    string `json:"app"`
+	Volume int    `json:"volume"`
+	Muted  bool   `json:"muted"`
+}
+
+// handleMeter returns every mapped slider's audio peak (0-100) and loudest app, along with its volume and mute,
+// as JSON by slider ID. it takes the filters in api_filter.go, and only looks volumes up when they're asked for.
+// with ?rate=<Hz> it streams readings as server-sent events instead, at most that often and only as they change.
+// each one carries the highest peak since the last, so short sounds still show up at low rates
+func (as *apiServer) handleMeter(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+
+	filter, err := parseAPIFilter(query)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !as.deej.processMonitor.audioMode {
+		http.Error(writer, "there's no audio meter (it needs led_mode: audio, on Windows)", http.StatusServiceUnavailable)
+		return
+	}
+
+	if query.Get("rate") == "" {
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(as.meterReading(filter, nil)); err != nil {
+			as.logger.Debugw("Failed to write meter response", "error", err)
+		}
+
+		return
+	}
+
+	rate, err := strconv.ParseFloat(query.Get("rate"), 64)
+	if err != nil || rate <= 0 {
+		http.Error(writer, "rate must be a number of readings per second", http.StatusBadRequest)
+		return
+	}
+
+	if rate > maxMeterStreamRate {
+		rate = maxMeterStreamRate
+	}
+
+	as.streamMeter(writer, request, filter, time.Duration(float64(time.Second)/rate))
+}
+
+func (as *apiServer) streamMeter(writer http.ResponseWriter, request *http.Request, filter apiFilter,
+	interval time.Duration) {
+
+	flusher, ok := writer.(http.Flusher)
+	if !ok {
+		http.Error(writer, "streaming isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	flusher.Flush()
+
+	if as.deej.Verbose() {
+		as.logger.Debugw("Streaming meter", "interval", interval, "fields", filter.fields, "sliders", filter.sliders)
+	}
+
+	sampleTicker := time.NewTicker(audioMeterCheckInterval)
+	defer sampleTicker.Stop()
+
+	sendTicker := time.NewTicker(interval)
+	defer sendTicker.Stop()
+
+	// the highest peaks since the last reading went out
+	highest := map[int]int{}
+	lastSent := ""
+
+	for {
+		select {
+		case <-request.Context().Done():
+			return
+
+		case <-sampleTicker.C:
+			as.deej.config.SliderMapping.iterate(func(sliderID int, _ []string) {
+				if !filter.wantsSlider(sliderID) {
+					return
+				}
+
+				if peak, _, _ := as.deej.processMonitor.sliderActivity(sliderID); peak > highest[sliderID] {
+					highest[sliderID] = peak
+				}
+			})
+
+		case <-sendTicker.C:
+			encoded, err := json.Marshal(as.meterReading(filter, highest))
+			highest = map[int]int{}
+
+			if err != nil || string(encoded) == lastSent {
+				continue
+			}
+
+			lastSent = string(encoded)
+
+			if _, err := fmt.Fprintf(writer, "data: %s\n\n", encoded); err != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
+
+// meterReading reads the wanted sliders, using the given peaks instead of the latest where there are any
+func (as *apiServer) meterReading(filter apiFilter, peaks map[int]int) map[string]interface{} {
+	reading := map[string]interface{}{}
+
+	var states map[int]protocol.SliderState
+	if filter.wantsField("volume") || filter.wantsField("muted") {
+		states = as.deej.sessions.filteredSliderStates(filter.wantsSlider)
+	}
+
+	as.deej.config.SliderMapping.iterate(func(sliderID int, _ []string) {
+		if !filter.wantsSlider(sliderID) {
+			return
+		}
+
+		entry := meterEntry{}
+		entry.Peak, entry.App, _ = as.deej.processMonitor.sliderActivity(sliderID)
+
+		if peak, ok := peaks[sliderID]; ok && peak > entry.Peak {
+			entry.Peak = peak
+		}
+
+		if state, ok := states[sliderID]; ok {
+			entry.Volume, entry.Muted = state.Volume, state.Muted
+		}
+
+		reading[strconv.Itoa(sliderID)] = filter.pick(entry)
+	})
+
+	return reading
+}
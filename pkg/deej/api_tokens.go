@@ -0,0 +1,435 @@
+package deej
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	apiPathTokens       = "/tokens"
+	apiPathTokensRevoke = "/tokens/revoke"
+
+	// what a token lets its holder do. each scope includes the ones before it
+	apiScopeRead    = "read"    // read state (sliders, events, metering and so on)
+	apiScopeControl = "control" // also change things (volumes, snoozing and so on)
+	apiScopeAdmin   = "admin"   // also the device itself (pairing, the serial console) and tokens
+
+	defaultAPITokenLifetime = 24 * time.Hour
+
+	apiTokenIDBytes     = 4
+	apiTokenSecretBytes = 24
+)
+
+var apiScopeLevels = map[string]int{
+	apiScopeRead:    1,
+	apiScopeControl: 2,
+	apiScopeAdmin:   3,
+}
+
+// apiToken is a guest token for the API, as kept in the persisted state. only a hash of its secret is kept,
+// so the token itself is only ever seen when it's created
+type apiToken struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Hash    string    `json:"hash"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+}
+
+// apiTokenInfo is what the API shows of a token
+type apiTokenInfo struct {
+	ID      string    `json:"id"`
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	Created time.Time `json:"created"`
+	Expires time.Time `json:"expires"`
+
+	// only set when the token's created
+	Token string `json:"token,omitempty"`
+}
+
+func (token apiToken) info() apiTokenInfo {
+	return apiTokenInfo{
+		ID:      token.ID,
+		Name:    token.Name,
+		Scope:   token.Scope,
+		Created: token.Created,
+		Expires: token.Expires,
+	}
+}
+
+// scoped wraps an API handler so that requests carrying a guest token need the given scope. reading (GET) a
+// control endpoint only takes the read scope. requests from this machine without a token are the user's own,
+// and can do anything - unless a web page sent them (see foreignWebRequest). ones from elsewhere (with
+// api.address set) need a token
+func (as *apiServer) scoped(scope string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		required := scope
+		if scope == apiScopeControl && request.Method == http.MethodGet {
+			required = apiScopeRead
+		}
+
+		secret := requestAPIToken(request)
+		if secret == "" {
+			if !isLocalRequest(request) {
+				http.Error(writer, "a token is needed from other machines", http.StatusUnauthorized)
+				return
+			}
+
+			if reason := foreignWebRequest(request); reason != "" {
+				as.logger.Warnw("Refused tokenless request from a web page",
+					"path", request.URL.Path,
+					"host", request.Host,
+					"origin", request.Header.Get("Origin"),
+					"reason", reason)
+
+				http.Error(writer, reason, http.StatusForbidden)
+				return
+			}
+
+			handler(writer, request)
+			return
+		}
+
+		token, ok := as.lookupToken(secret, time.Now())
+		if !ok {
+			http.Error(writer, "invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		if apiScopeLevels[token.Scope] < apiScopeLevels[required] {
+			http.Error(writer, fmt.Sprintf("token needs the %s scope", required), http.StatusForbidden)
+			return
+		}
+
+		if as.deej.Verbose() {
+			as.logger.Debugw("Authorized token request", "token", token.Name, "path", request.URL.Path)
+		}
+
+		handler(writer, request)
+	}
+}
+
+// requestAPIToken takes the token from an "Authorization: Bearer" header, or a ?token= for clients that can't set
+// headers (like an OBS browser source)
+func requestAPIToken(request *http.Request) string {
+	if header := request.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	return request.URL.Query().Get("token")
+}
+
+// isLocalRequest returns whether a request came from this machine: over loopback, or to an address of ours
+// from that same address
+func isLocalRequest(request *http.Request) bool {
+	remoteHost, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return false
+	}
+
+	remoteIP := net.ParseIP(remoteHost)
+	if remoteIP == nil {
+		return false
+	}
+
+	if remoteIP.IsLoopback() {
+		return true
+	}
+
+	localAddress, ok := request.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		return false
+	}
+
+	localHost, _, err := net.SplitHostPort(localAddress.String())
+
+	return err == nil && remoteIP.Equal(net.ParseIP(localHost))
+}
+
+// foreignWebRequest returns why a request from this machine was really sent by some website, or "" if it wasn't.
+// any page open in a browser can send requests to localhost (a plain form, or a no-cors fetch), and one whose
+// domain was pointed at 127.0.0.1 (DNS rebinding) can read the responses too. neither can hide the page's origin,
+// nor make the Host header anything but the page's domain. the dashboard and serial console are on deej's origin
+func foreignWebRequest(request *http.Request) string {
+	host := request.Host
+	if hostname, _, err := net.SplitHostPort(host); err == nil {
+		host = hostname
+	}
+
+	host = strings.Trim(host, "[]")
+	if !strings.EqualFold(host, "localhost") && net.ParseIP(host) == nil {
+		return "requests without a token have to be made to localhost or an IP address"
+	}
+
+	if origin := request.Header.Get("Origin"); origin != "" {
+		parsed, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(parsed.Host, request.Host) {
+			return "requests without a token can't come from other websites"
+		}
+	}
+
+	// the same, for browsers that leave the origin out of some requests
+	if site := request.Header.Get("Sec-Fetch-Site"); site == "cross-site" || site == "same-site" {
+		return "requests without a token can't come from other websites"
+	}
+
+	return ""
+}
+
+// lookupToken returns the unexpired token the given secret belongs to. tokens look like <id>.<secret>
+func (as *apiServer) lookupToken(secret string, now time.Time) (apiToken, bool) {
+	parts := strings.SplitN(secret, ".", 2)
+	if len(parts) != 2 {
+		return apiToken{}, false
+	}
+
+	var token apiToken
+	found := false
+
+	as.deej.state.view(func(state *persistedState) {
+		token, found = state.APITokens[parts[0]]
+	})
+
+	if !found || !now.Before(token.Expires) {
+		return apiToken{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIToken(parts[1])), []byte(token.Hash)) != 1 {
+		return apiToken{}, false
+	}
+
+	return token, true
+}
+
+// createToken makes a new token with the given scope that lasts for the given time
+func (as *apiServer) createToken(name string, scope string, lifetime time.Duration) (apiTokenInfo, error) {
+	id, err := randomHex(apiTokenIDBytes)
+	if err != nil {
+		return apiTokenInfo{}, fmt.Errorf("generate token ID: %w", err)
+	}
+
+	secret, err := randomHex(apiTokenSecretBytes)
+	if err != nil {
+		return apiTokenInfo{}, fmt.Errorf("generate token secret: %w", err)
+	}
+
+	now := time.Now()
+	token := apiToken{
+		ID:      id,
+		Name:    name,
+		Scope:   scope,
+		Hash:    hashAPIToken(secret),
+		Created: now,
+		Expires: now.Add(lifetime),
+	}
+
+	as.deej.state.update(func(state *persistedState) {
+		pruneAPITokens(state, now)
+		state.APITokens[id] = token
+	})
+
+	as.logger.Infow("Created API token", "id", id, "name", name, "scope", scope, "expires", token.Expires)
+
+	info := token.info()
+	info.Token = id + "." + secret
+
+	return info, nil
+}
+
+func pruneAPITokens(state *persistedState, now time.Time) {
+	for id, token := range state.APITokens {
+		if !now.Before(token.Expires) {
+			delete(state.APITokens, id)
+		}
+	}
+}
+
+func hashAPIToken(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
+
+func randomHex(size int) (string, error) {
+	buffer := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, buffer); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buffer), nil
+}
+
+// handleTokens lists the unexpired tokens (GET), or creates one (POST) with ?name=, ?scope= (read by default)
+// and ?expires= (a duration like 4h, 24h by default)
+func (as *apiServer) handleTokens(writer http.ResponseWriter, request *http.Request) {
+	var response interface{}
+
+	switch request.Method {
+	case http.MethodGet:
+		tokens := []apiTokenInfo{}
+		now := time.Now()
+
+		as.deej.state.view(func(state *persistedState) {
+			for _, token := range state.APITokens {
+				if now.Before(token.Expires) {
+					tokens = append(tokens, token.info())
+				}
+			}
+		})
+
+		sort.Slice(tokens, func(i, j int) bool { return tokens[i].Created.Before(tokens[j].Created) })
+		response = tokens
+
+	case http.MethodPost:
+		query := request.URL.Query()
+
+		name := strings.TrimSpace(query.Get("name"))
+		if name == "" {
+			http.Error(writer, "name the token after what it's for", http.StatusBadRequest)
+			return
+		}
+
+		scope := strings.ToLower(query.Get("scope"))
+		if scope == "" {
+			scope = apiScopeRead
+		}
+
+		if _, ok := apiScopeLevels[scope]; !ok {
+			http.Error(writer, "scope must be read, control or admin", http.StatusBadRequest)
+			return
+		}
+
+		lifetime := defaultAPITokenLifetime
+		if value := query.Get("expires"); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil || parsed <= 0 {
+				http.Error(writer, "expires must be a duration, like 4h", http.StatusBadRequest)
+				return
+			}
+
+			lifetime = parsed
+		}
+
+		created, err := as.createToken(name, scope, lifetime)
+		if err != nil {
+			as.logger.Warnw("Failed to create API token", "error", err)
+			http.Error(writer, "failed to create token", http.StatusInternalServerError)
+			return
+		}
+
+		response = created
+
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write tokens response", "error", err)
+	}
+}
+
+// handleTokensRevoke deletes the token with the given ID
+func (as *apiServer) handleTokensRevoke(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.ToLower(request.URL.Query().Get("id"))
+	found := false
+
+	as.deej.state.update(func(state *persistedState) {
+		_, found = state.APITokens[id]
+		delete(state.APITokens, id)
+	})
+
+	if !found {
+		http.Error(writer, "no token with that ID", http.StatusNotFound)
+		return
+	}
+
+	as.logger.Infow("Revoked API token", "id", id)
+}
+
+// CreateAPIToken has the running deej make a guest token for its API, and prints it. it's the only time the
+// token's shown
+func CreateAPIToken(logger *zap.SugaredLogger, out io.Writer, name string, scope string, expires time.Duration) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("name", name)
+	query.Set("scope", scope)
+	query.Set("expires", expires.String())
+
+	created := apiTokenInfo{}
+	if err := postLocalAPI(apiAddress+apiPathTokens+"?"+query.Encode(), &created); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Created %s token %s for %s, expiring %s:\n\n%s\n\n",
+		created.Scope, created.ID, created.Name, created.Expires.Local().Format("Mon Jan 2 15:04"), created.Token)
+	fmt.Fprintln(out, "Send it as \"Authorization: Bearer <token>\", or add ?token=<token> to the URL. It won't be shown again")
+
+	return nil
+}
+
+// ListAPITokens prints the running deej's unexpired guest tokens
+func ListAPITokens(logger *zap.SugaredLogger, out io.Writer) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	tokens := []apiTokenInfo{}
+	if err := getLocalAPI(apiAddress+apiPathTokens, &tokens); err != nil {
+		return err
+	}
+
+	if len(tokens) == 0 {
+		fmt.Fprintln(out, "No tokens")
+		return nil
+	}
+
+	for _, token := range tokens {
+		fmt.Fprintf(out, "%s  %-8s  expires %s  %s\n",
+			token.ID, token.Scope, token.Expires.Local().Format("Mon Jan 2 15:04"), token.Name)
+	}
+
+	return nil
+}
+
+// RevokeAPIToken has the running deej delete a guest token, which stops working right away
+func RevokeAPIToken(logger *zap.SugaredLogger, out io.Writer, id string) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	if err := postLocalAPI(apiAddress+apiPathTokensRevoke+"?id="+url.QueryEscape(id), nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Revoked token %s\n", id)
+
+	return nil
+}
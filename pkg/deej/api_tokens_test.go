@@ -0,0 +1,41 @@
+package deej
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestForeignWebRequest(t *testing.T) {
+	cases := []struct {
+		name    string
+		host    string
+		origin  string
+		site    string
+		foreign bool
+	}{
+		{"command line tool", "127.0.0.1:3335", "", "", false},
+		{"dashboard", "localhost:3335", "http://localhost:3335", "same-origin", false},
+		{"ipv6 loopback", "[::1]:3335", "", "", false},
+		{"rebound domain", "attacker.example:3335", "", "", true},
+		{"other website", "127.0.0.1:3335", "https://attacker.example", "cross-site", true},
+		{"sandboxed page", "127.0.0.1:3335", "null", "", true},
+		{"other website without origin", "127.0.0.1:3335", "", "cross-site", true},
+	}
+
+	for _, c := range cases {
+		request := httptest.NewRequest("POST", "/sliders?id=0&volume=100", nil)
+		request.Host = c.host
+
+		if c.origin != "" {
+			request.Header.Set("Origin", c.origin)
+		}
+
+		if c.site != "" {
+			request.Header.Set("Sec-Fetch-Site", c.site)
+		}
+
+		if reason := foreignWebRequest(request); (reason != "") != c.foreign {
+			t.Errorf("%s: expected foreign %t, got %q", c.name, c.foreign, reason)
+		}
+	}
+}
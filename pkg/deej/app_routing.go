@@ -0,0 +1,253 @@
+package deej
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// send the app given by the "app" key (a target, like game.exe) to the output device given by the "device" key.
+	// several comma-separated devices flip the app between them with every press
+	buttonActionAppRoute = "app.route"
+
+	// stands in for a device name, to send an app back to whatever the default output device is
+	appRouteDefaultDevice = "default"
+
+	apiPathRoute = "/route"
+)
+
+// errAppNotPlaying is returned when routing an app that has no audio sessions, as there's nothing to route yet
+var errAppNotPlaying = errors.New("app isn't playing audio")
+
+// CycleAppRoute sends the given app to the next of the given output devices (names, patterns or "default"),
+// starting over after the last one
+func (d *Deej) CycleAppRoute(app string, deviceNames []string) error {
+	device, err := d.routeApp(app, deviceNames)
+	if err != nil {
+		return err
+	}
+
+	d.notifier.Notify(fmt.Sprintf("Output device for %s", app), device.Name)
+
+	return nil
+}
+
+// RouteAppTo sends the given app to the given output device (a name, pattern or "default"), quietly - for scenes,
+// schedules and the API, which set up several apps at once or aren't pressed by hand
+func (d *Deej) RouteAppTo(app string, deviceName string) error {
+	_, err := d.routeApp(app, []string{deviceName})
+	return err
+}
+
+// routeApp sends the app to the device following the one it's on out of the given ones, returning where it went
+func (d *Deej) routeApp(app string, deviceNames []string) (outputDevice, error) {
+	logger := d.logger.Named("routing")
+
+	if !appRoutingSupported {
+		logger.Warnw("Routing apps to output devices isn't supported on this platform", "error", util.ErrNotSupported)
+		return outputDevice{}, util.ErrNotSupported
+	}
+
+	pids := processIDs(d.sessions.targetSessions(app))
+	if len(pids) == 0 {
+		logger.Infow("Can't route app that isn't playing audio", "app", app)
+		return outputDevice{}, fmt.Errorf("%s: %w", app, errAppNotPlaying)
+	}
+
+	devices, err := resolveRouteDevices(deviceNames)
+	if err != nil {
+		logger.Warnw("Failed to find output devices to route app to", "app", app, "devices", deviceNames, "error", err)
+		return outputDevice{}, err
+	}
+
+	// move on from wherever the app is now, or start from the first device if it's somewhere else
+	currentID, err := getAppOutputDevice(pids[0])
+	if err != nil {
+		logger.Warnw("Failed to get app's output device", "app", app, "error", err)
+	}
+
+	next := devices[0]
+	for idx, device := range devices {
+		if device.ID == currentID {
+			next = devices[(idx+1)%len(devices)]
+			break
+		}
+	}
+
+	if err := routeProcesses(pids, next); err != nil {
+		logger.Warnw("Failed to route app", "app", app, "device", next.Name, "error", err)
+		return outputDevice{}, err
+	}
+
+	logger.Infow("Routed app to output device", "app", app, "device", next.Name)
+
+	// the app's sessions move over to the new device, so the ones we hold on to are stale now
+	d.sessions.refreshSessions(true)
+
+	return next, nil
+}
+
+// handleRoute sends ?app=<app> to ?device=<output device> (a name, pattern or "default")
+func (as *apiServer) handleRoute(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+
+	app, deviceName := query.Get("app"), query.Get("device")
+	if app == "" || deviceName == "" {
+		http.Error(writer, "app and device are needed", http.StatusBadRequest)
+		return
+	}
+
+	err := as.deej.RouteAppTo(app, deviceName)
+
+	switch {
+	case err == nil:
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(map[string]string{"app": app, "device": deviceName}); err != nil {
+			as.logger.Debugw("Failed to write route response", "error", err)
+		}
+
+	case errors.Is(err, util.ErrNotSupported):
+		http.Error(writer, err.Error(), http.StatusNotImplemented)
+
+	case errors.Is(err, errAppNotPlaying):
+		http.Error(writer, err.Error(), http.StatusNotFound)
+
+	default:
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+	}
+}
+
+// RouteApp sends every running session of the given app (a name like game.exe, or a pattern) to the given output
+// device, or back to the default one for "default". it's meant for the command line, and doesn't need deej running
+func RouteApp(logger *zap.SugaredLogger, out io.Writer, app string, deviceName string) error {
+	if !appRoutingSupported {
+		return util.ErrNotSupported
+	}
+
+	// list sessions quietly, only the outcome is interesting here
+	sessionFinder, err := newSessionFinder(zap.NewNop().Sugar(), "")
+	if err != nil {
+		return fmt.Errorf("create session finder: %w", err)
+	}
+	defer sessionFinder.Release()
+
+	sessions, err := sessionFinder.GetAllSessions()
+	if err != nil {
+		return fmt.Errorf("get sessions: %w", err)
+	}
+
+	matching := []Session{}
+	for _, session := range sessions {
+		if targetMatchesName(app, session.Key()) {
+			matching = append(matching, session)
+		}
+	}
+
+	pids := processIDs(matching)
+
+	for _, session := range sessions {
+		session.Release()
+	}
+
+	if len(pids) == 0 {
+		return fmt.Errorf("%s: %w", app, errAppNotPlaying)
+	}
+
+	devices, err := resolveRouteDevices([]string{deviceName})
+	if err != nil {
+		return err
+	}
+
+	if err := routeProcesses(pids, devices[0]); err != nil {
+		return err
+	}
+
+	logger.Debugw("Routed app from the command line", "app", app, "device", devices[0].Name, "pids", pids)
+	fmt.Fprintf(out, "Routed %s to %s\n", app, devices[0].Name)
+
+	return nil
+}
+
+// resolveRouteDevices finds the output device each of the given names (or patterns) refers to, in order.
+// "default" resolves to a device without an ID, which sends apps back to the default device
+func resolveRouteDevices(names []string) ([]outputDevice, error) {
+	available, err := listOutputDevices()
+	if err != nil {
+		return nil, fmt.Errorf("list output devices: %w", err)
+	}
+
+	devices := []outputDevice{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		if strings.EqualFold(name, appRouteDefaultDevice) {
+			devices = append(devices, outputDevice{Name: "the default output device"})
+			continue
+		}
+
+		found := false
+		for _, device := range available {
+			if deviceNameMatches(name, device.Name) {
+				devices = append(devices, device)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown output device: %s", name)
+		}
+	}
+
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("no output device given")
+	}
+
+	return devices, nil
+}
+
+func routeProcesses(pids []uint32, device outputDevice) error {
+	for _, pid := range pids {
+		if err := setAppOutputDevice(pid, device.ID); err != nil {
+			return fmt.Errorf("route pid %d: %w", pid, err)
+		}
+	}
+
+	return nil
+}
+
+// processIDs returns the distinct processes the given sessions belong to. system sounds don't belong to any
+func processIDs(sessions []Session) []uint32 {
+	pids := []uint32{}
+	seen := map[uint32]bool{}
+
+	for _, session := range sessions {
+		process, ok := session.(processSession)
+		if !ok || process.ProcessID() == 0 || seen[process.ProcessID()] {
+			continue
+		}
+
+		seen[process.ProcessID()] = true
+		pids = append(pids, process.ProcessID())
+	}
+
+	return pids
+}
@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// deej only knows how to route individual apps to an output device on Windows, so the app.route
+// button action and deej route do nothing here
+const appRoutingSupported = false
+
+func getAppOutputDevice(pid uint32) (string, error) {
+	return "", util.ErrNotSupported
+}
+
+func setAppOutputDevice(pid uint32, deviceID string) error {
+	return util.ErrNotSupported
+}
@@ -0,0 +1,222 @@
+//go:build windows
+// +build windows
+
+package deej
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	wca "github.com/moutend/go-wca"
+)
+
+// per-app routing goes through IAudioPolicyConfigFactory, the undocumented interface behind the "App volume and
+// device preferences" settings page. the route is persisted by windows, so it outlives both deej and the app
+const appRoutingSupported = true
+
+const (
+	audioPolicyConfigClass = "Windows.Media.Internal.AudioPolicyConfig"
+
+	// the per-app device IDs are full device interface paths around the endpoint ID
+	appRouteDevicePrefix = `\\?\SWD#MMDEVAPI#`
+	appRouteDeviceSuffix = "#{e6327cad-dcec-4949-ae8a-991e976a79d2}"
+)
+
+var (
+	combase                       = syscall.NewLazyDLL("combase.dll")
+	procRoGetActivationFactory    = combase.NewProc("RoGetActivationFactory")
+	procWindowsCreateString       = combase.NewProc("WindowsCreateString")
+	procWindowsDeleteString       = combase.NewProc("WindowsDeleteString")
+	procWindowsGetStringRawBuffer = combase.NewProc("WindowsGetStringRawBuffer")
+)
+
+// the interface's IID changed in windows 10 21H2, so try the current one before the older one
+var (
+	IID_IAudioPolicyConfigFactory          = ole.NewGUID("{AB3D4648-E242-459F-B02F-541C70306324}")
+	IID_IAudioPolicyConfigFactoryDownlevel = ole.NewGUID("{2A59116D-6C4F-45E0-A74F-707E3FEF9258}")
+)
+
+// IAudioPolicyConfigFactory gets and sets the output device individual processes play to
+type IAudioPolicyConfigFactory struct {
+	ole.IUnknown
+}
+
+// only the last three methods are of any use here, the rest just keep their place in the vtable
+type IAudioPolicyConfigFactoryVtbl struct {
+	ole.IUnknownVtbl
+	GetIids                                      uintptr
+	GetRuntimeClassName                          uintptr
+	GetTrustLevel                                uintptr
+	_                                            [19]uintptr
+	SetPersistedDefaultAudioEndpoint             uintptr
+	GetPersistedDefaultAudioEndpoint             uintptr
+	ClearAllPersistedApplicationDefaultEndpoints uintptr
+}
+
+func (v *IAudioPolicyConfigFactory) VTable() *IAudioPolicyConfigFactoryVtbl {
+	return (*IAudioPolicyConfigFactoryVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// SetPersistedDefaultAudioEndpoint routes the given process' audio for the given role to the given device
+// (a full device interface path), or back to the default device if it's empty
+func (v *IAudioPolicyConfigFactory) SetPersistedDefaultAudioEndpoint(pid uint32, flow uint32, role uint32, deviceID string) error {
+	var hstring uintptr
+
+	if deviceID != "" {
+		var err error
+		if hstring, err = createHString(deviceID); err != nil {
+			return err
+		}
+		defer procWindowsDeleteString.Call(hstring)
+	}
+
+	hr, _, _ := syscall.Syscall6(
+		v.VTable().SetPersistedDefaultAudioEndpoint,
+		5,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(pid),
+		uintptr(flow),
+		uintptr(role),
+		hstring,
+		0)
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
+
+// GetPersistedDefaultAudioEndpoint returns the device the given process' audio for the given role is routed to,
+// or an empty string if it plays to the default device
+func (v *IAudioPolicyConfigFactory) GetPersistedDefaultAudioEndpoint(pid uint32, flow uint32, role uint32) (string, error) {
+	var hstring uintptr
+
+	hr, _, _ := syscall.Syscall6(
+		v.VTable().GetPersistedDefaultAudioEndpoint,
+		5,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(pid),
+		uintptr(flow),
+		uintptr(role),
+		uintptr(unsafe.Pointer(&hstring)),
+		0)
+
+	if hr != 0 {
+		return "", ole.NewError(hr)
+	}
+
+	return takeHString(hstring), nil
+}
+
+func createHString(value string) (uintptr, error) {
+	utf16, err := syscall.UTF16FromString(value)
+	if err != nil {
+		return 0, err
+	}
+
+	var hstring uintptr
+
+	// the length excludes the terminating null
+	hr, _, _ := procWindowsCreateString.Call(
+		uintptr(unsafe.Pointer(&utf16[0])),
+		uintptr(len(utf16)-1),
+		uintptr(unsafe.Pointer(&hstring)))
+
+	if hr != 0 {
+		return 0, ole.NewError(hr)
+	}
+
+	return hstring, nil
+}
+
+// takeHString returns the given string's contents and deletes it. a null string is an empty one
+func takeHString(hstring uintptr) string {
+	if hstring == 0 {
+		return ""
+	}
+	defer procWindowsDeleteString.Call(hstring)
+
+	var length uint32
+	buffer, _, _ := procWindowsGetStringRawBuffer.Call(hstring, uintptr(unsafe.Pointer(&length)))
+	if buffer == 0 || length == 0 {
+		return ""
+	}
+
+	// the buffer belongs to the string, so copy it out before the string is deleted
+	chars := (*[1 << 16]uint16)(*(*unsafe.Pointer)(unsafe.Pointer(&buffer)))[:length:length]
+
+	return syscall.UTF16ToString(chars)
+}
+
+// withAudioPolicyConfig runs f with COM initialized and the audio policy config factory ready
+func withAudioPolicyConfig(f func(factory *IAudioPolicyConfigFactory) error) error {
+	return withCOM(func() error {
+		className, err := createHString(audioPolicyConfigClass)
+		if err != nil {
+			return fmt.Errorf("create class name string: %w", err)
+		}
+		defer procWindowsDeleteString.Call(className)
+
+		var factory *IAudioPolicyConfigFactory
+		var hr uintptr
+
+		for _, iid := range []*ole.GUID{IID_IAudioPolicyConfigFactory, IID_IAudioPolicyConfigFactoryDownlevel} {
+			hr, _, _ = procRoGetActivationFactory.Call(
+				className,
+				uintptr(unsafe.Pointer(iid)),
+				uintptr(unsafe.Pointer(&factory)))
+
+			if hr == 0 {
+				break
+			}
+		}
+
+		if hr != 0 {
+			return fmt.Errorf("get audio policy config factory: %w", ole.NewError(hr))
+		}
+		defer factory.Release()
+
+		return f(factory)
+	})
+}
+
+// getAppOutputDevice returns the ID of the output device the given process is routed to,
+// or an empty string if it plays to the default device
+func getAppOutputDevice(pid uint32) (string, error) {
+	deviceID := ""
+
+	err := withAudioPolicyConfig(func(factory *IAudioPolicyConfigFactory) error {
+		path, err := factory.GetPersistedDefaultAudioEndpoint(pid, wca.ERender, wca.EMultimedia)
+		if err != nil {
+			return fmt.Errorf("get app output device: %w", err)
+		}
+
+		deviceID = strings.TrimSuffix(strings.TrimPrefix(path, appRouteDevicePrefix), appRouteDeviceSuffix)
+		return nil
+	})
+
+	return deviceID, err
+}
+
+// setAppOutputDevice routes the given process to the output device with the given ID,
+// or back to the default device if it's empty
+func setAppOutputDevice(pid uint32, deviceID string) error {
+	path := ""
+	if deviceID != "" {
+		path = appRouteDevicePrefix + deviceID + appRouteDeviceSuffix
+	}
+
+	return withAudioPolicyConfig(func(factory *IAudioPolicyConfigFactory) error {
+		for _, role := range []uint32{wca.EConsole, wca.EMultimedia} {
+			if err := factory.SetPersistedDefaultAudioEndpoint(pid, wca.ERender, role, path); err != nil {
+				return fmt.Errorf("set app output device (role %d): %w", role, err)
+			}
+		}
+
+		return nil
+	})
+}
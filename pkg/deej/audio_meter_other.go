@@ -0,0 +1,32 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// peak levels are only read from windows' core audio API for now. elsewhere there's no meter at all,
+// so the audio LED mode tracks running processes instead and ducking stays off
+const audioMeterSupported = false
+
+// AudioMeterService detects which applications are currently outputting audio
+type AudioMeterService struct{}
+
+// NewAudioMeterService returns nil, as there's nothing to meter with on this platform
+func NewAudioMeterService(logger *zap.SugaredLogger) *AudioMeterService {
+	return nil
+}
+
+// GetActiveAudioProcesses returns the processes currently outputting audio
+func (ams *AudioMeterService) GetActiveAudioProcesses() (map[string]bool, error) {
+	return nil, util.ErrNotSupported
+}
+
+// GetAudioPeakLevels returns the current peak level of every process outputting audio
+func (ams *AudioMeterService) GetAudioPeakLevels() (map[string]float32, error) {
+	return nil, util.ErrNotSupported
+}
@@ -5,7 +5,13 @@ package deej
 
 import (
 	"errors"
+	"fmt"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"unsafe"
 
 	ole "github.com/go-ole/go-ole"
@@ -17,8 +23,12 @@ import (
 // AudioMeterService queries Windows Core Audio API to detect which applications
 // are currently outputting audio. This is used to drive LED indicators based on
 // actual audio activity rather than just process presence.
+//
+// Every AudioMeterService shares a single meter goroutine, which keeps COM initialized
+// on its own thread and holds on to each session's meter between reads. Devices and
+// sessions are only enumerated again once Windows says they changed.
 type AudioMeterService struct {
-	logger *zap.SugaredLogger
+	meter *audioMeter
 }
 
 // ProcessAudioLevel represents the audio level for a process.
@@ -29,21 +39,42 @@ type ProcessAudioLevel struct {
 }
 
 const (
+	// see audio_meter_other.go
+	audioMeterSupported = true
+
 	// audioActiveThreshold is the minimum peak level to consider audio "active".
 	// Values below this are treated as silence (handles noise floor).
 	audioActiveThreshold = 0.001
+
+	// audioMeterRefreshInterval is how often sessions are enumerated again regardless,
+	// in case a notification went missing
+	audioMeterRefreshInterval = 30 * time.Second
+
+	// audioMeterReadingMaxAge is how long a reading is handed out again rather than
+	// taking a new one. the LEDs, ducking, the TUI and friends all poll around the same
+	// rate, so they mostly end up sharing one
+	audioMeterReadingMaxAge = 20 * time.Millisecond
+)
+
+var (
+	sharedAudioMeter     *audioMeter
+	sharedAudioMeterOnce sync.Once
+
+	// takes a snapshot of every running process (see processNameCache)
+	listProcesses = ps.Processes
 )
 
 // NewAudioMeterService creates a new AudioMeterService instance.
 func NewAudioMeterService(logger *zap.SugaredLogger) *AudioMeterService {
-	return &AudioMeterService{
-		logger: logger.Named("audio-meter"),
-	}
+	sharedAudioMeterOnce.Do(func() {
+		sharedAudioMeter = newAudioMeter(logger.Named("audio-meter"))
+	})
+
+	return &AudioMeterService{meter: sharedAudioMeter}
 }
 
 // GetActiveAudioProcesses returns a map of process names (lowercase) that are
-// currently outputting audio above the threshold. It enumerates all audio
-// endpoints and their sessions, querying the peak meter for each.
+// currently outputting audio above the threshold.
 func (ams *AudioMeterService) GetActiveAudioProcesses() (map[string]bool, error) {
 	levels, err := ams.GetAudioPeakLevels()
 	if err != nil {
@@ -60,163 +91,338 @@ func (ams *AudioMeterService) GetActiveAudioProcesses() (map[string]bool, error)
 }
 
 // GetAudioPeakLevels returns a map of process names (lowercase) to their current
-// peak audio levels (0.0-1.0). It enumerates all audio endpoints and their sessions.
+// peak audio levels (0.0-1.0), across the sessions of every output device.
 func (ams *AudioMeterService) GetAudioPeakLevels() (map[string]float32, error) {
-	peakLevels := make(map[string]float32)
+	reading := ams.meter.read()
+	if reading.err != nil {
+		return nil, reading.err
+	}
+
+	// the reading may be shared with other callers, so everyone gets their own copy
+	peakLevels := make(map[string]float32, len(reading.levels))
+	for name, peak := range reading.levels {
+		peakLevels[name] = peak
+	}
+
+	return peakLevels, nil
+}
+
+// audioMeterReading is one pass over every session's peak meter
+type audioMeterReading struct {
+	levels map[string]float32
+	err    error
+	at     time.Time
+}
+
+// meteredSession is a session's peak meter, along with the process it belongs to. its control is kept to hear
+// about the session ending
+type meteredSession struct {
+	pid        uint32
+	executable string
+	meter      *IAudioMeterInformation
+	control    *wca.IAudioSessionControl2
+}
+
+// processNameCache remembers the executable behind every pid with an audio session, as finding out means going
+// through every running process (which is also what ps.FindProcess does, one pid at a time)
+type processNameCache struct {
+	executables map[uint32]string
+}
+
+// lookup returns the executables of the given pids, only listing running processes if there's one it hasn't seen.
+// pids it isn't asked about no longer have a session, and are forgotten - should one come back, it may well be
+// another process by then
+func (pc *processNameCache) lookup(pids []uint32) (map[uint32]string, error) {
+	executables := make(map[uint32]string, len(pids))
+	missing := false
+
+	for _, pid := range pids {
+		if executable, ok := pc.executables[pid]; ok {
+			executables[pid] = executable
+		} else {
+			missing = true
+		}
+	}
+
+	if missing {
+		processes, err := listProcesses()
+		if err != nil {
+			return nil, fmt.Errorf("list processes: %w", err)
+		}
+
+		wanted := make(map[uint32]bool, len(pids))
+		for _, pid := range pids {
+			wanted[pid] = true
+		}
+
+		for _, process := range processes {
+			if pid := uint32(process.Pid()); wanted[pid] {
+				executables[pid] = strings.ToLower(process.Executable())
+			}
+		}
+	}
+
+	pc.executables = executables
+
+	return executables, nil
+}
+
+// audioMeter owns the COM objects behind every AudioMeterService. they're only ever touched from its goroutine,
+// which is locked to its thread - reads are handed to it over a channel
+type audioMeter struct {
+	logger   *zap.SugaredLogger
+	requests chan chan audioMeterReading
+
+	// set from COM's notification threads when devices or sessions change, and cleared once they've been
+	// enumerated again
+	stale int32
+
+	enumerator           *wca.IMMDeviceEnumerator
+	deviceNotifications  *wca.IMMNotificationClient
+	sessionNotifications *audioSessionNotification
+	sessionEvents        *audioSessionEvents
+
+	managers     []*wca.IAudioSessionManager2
+	sessions     []meteredSession
+	processNames processNameCache
+	refreshedAt  time.Time
+
+	lastReading audioMeterReading
+}
+
+func newAudioMeter(logger *zap.SugaredLogger) *audioMeter {
+	am := &audioMeter{
+		logger:   logger,
+		requests: make(chan chan audioMeterReading),
+	}
+
+	// these stay registered for as long as deej runs, so they're only made once
+	am.deviceNotifications = &wca.IMMNotificationClient{}
+	am.deviceNotifications.VTable = &wca.IMMNotificationClientVtbl{}
+
+	am.deviceNotifications.VTable.QueryInterface = syscall.NewCallback(am.noopCallback)
+	am.deviceNotifications.VTable.AddRef = syscall.NewCallback(am.noopCallback)
+	am.deviceNotifications.VTable.Release = syscall.NewCallback(am.noopCallback)
+	am.deviceNotifications.VTable.OnPropertyValueChanged = syscall.NewCallback(am.noopCallback)
+
+	am.deviceNotifications.VTable.OnDeviceStateChanged = syscall.NewCallback(am.deviceStateChangedCallback)
+	am.deviceNotifications.VTable.OnDeviceAdded = syscall.NewCallback(am.deviceAddedOrRemovedCallback)
+	am.deviceNotifications.VTable.OnDeviceRemoved = syscall.NewCallback(am.deviceAddedOrRemovedCallback)
+	am.deviceNotifications.VTable.OnDefaultDeviceChanged = syscall.NewCallback(am.defaultDeviceChangedCallback)
+
+	am.sessionNotifications = &audioSessionNotification{VTable: &audioSessionNotificationVtbl{}}
+
+	am.sessionNotifications.VTable.QueryInterface = syscall.NewCallback(am.noopCallback)
+	am.sessionNotifications.VTable.AddRef = syscall.NewCallback(am.noopCallback)
+	am.sessionNotifications.VTable.Release = syscall.NewCallback(am.noopCallback)
+	am.sessionNotifications.VTable.OnSessionCreated = syscall.NewCallback(am.sessionCreatedCallback)
+
+	// one set of session events is registered with every metered session, as they all just mark it stale
+	am.sessionEvents = &audioSessionEvents{VTable: &audioSessionEventsVtbl{}}
+
+	am.sessionEvents.VTable.QueryInterface = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.AddRef = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.Release = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnDisplayNameChanged = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnIconPathChanged = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnSimpleVolumeChanged = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnChannelVolumeChanged = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnGroupingParamChanged = syscall.NewCallback(am.noopCallback)
+	am.sessionEvents.VTable.OnStateChanged = syscall.NewCallback(am.sessionStateChangedCallback)
+	am.sessionEvents.VTable.OnSessionDisconnected = syscall.NewCallback(am.sessionDisconnectedCallback)
 
-	// Initialize COM for this goroutine
-	if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
+	go am.run()
+
+	return am
+}
+
+// read takes a reading on the meter's goroutine and waits for it
+func (am *audioMeter) read() audioMeterReading {
+	reply := make(chan audioMeterReading, 1)
+	am.requests <- reply
+
+	return <-reply
+}
+
+func (am *audioMeter) run() {
+
+	// COM objects belong to the thread that made them, so this goroutine keeps to one thread for good
+	runtime.LockOSThread()
+
+	// session notifications only arrive in the multithreaded apartment
+	initErr := ole.CoInitializeEx(0, ole.COINIT_MULTITHREADED)
+	if initErr != nil {
 		oleError := &ole.OleError{}
+
 		// Code 1 = S_FALSE (already initialized) - this is fine
-		if errors.As(err, &oleError) && oleError.Code() != 1 {
-			ams.logger.Warnw("COM init failed", "error", err)
-			return nil, err
+		if errors.As(initErr, &oleError) && oleError.Code() == 1 {
+			initErr = nil
+		} else {
+			am.logger.Warnw("COM init failed, audio peak levels won't be available", "error", initErr)
 		}
 	}
-	defer ole.CoUninitialize()
 
-	// Get the device enumerator
-	var mmDeviceEnumerator *wca.IMMDeviceEnumerator
-	if err := wca.CoCreateInstance(
-		wca.CLSID_MMDeviceEnumerator,
-		0,
-		wca.CLSCTX_ALL,
-		wca.IID_IMMDeviceEnumerator,
-		&mmDeviceEnumerator,
-	); err != nil {
-		ams.logger.Warnw("Failed to create device enumerator", "error", err)
-		return nil, err
+	for reply := range am.requests {
+		if initErr != nil {
+			reply <- audioMeterReading{err: initErr}
+			continue
+		}
+
+		reply <- am.takeReading()
 	}
-	defer mmDeviceEnumerator.Release()
+}
 
-	// Enumerate active render (output) devices
-	var deviceCollection *wca.IMMDeviceCollection
-	if err := mmDeviceEnumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
-		ams.logger.Warnw("Failed to enumerate audio endpoints", "error", err)
-		return nil, err
+func (am *audioMeter) takeReading() audioMeterReading {
+	now := time.Now()
+
+	if am.lastReading.err == nil && now.Sub(am.lastReading.at) < audioMeterReadingMaxAge {
+		return am.lastReading
 	}
-	defer deviceCollection.Release()
 
-	var deviceCount uint32
-	if err := deviceCollection.GetCount(&deviceCount); err != nil {
-		ams.logger.Warnw("Failed to get device count", "error", err)
-		return nil, err
+	stale := atomic.SwapInt32(&am.stale, 0) == 1
+	if stale || am.enumerator == nil || now.Sub(am.refreshedAt) > audioMeterRefreshInterval {
+		if stale {
+			am.logger.Debug("Audio devices or sessions changed, enumerating them again")
+		}
+
+		if err := am.refresh(); err != nil {
+			am.releaseSessions()
+			atomic.StoreInt32(&am.stale, 1)
+			am.lastReading = audioMeterReading{err: err}
+
+			return am.lastReading
+		}
 	}
 
-	ams.logger.Debugw("Scanning audio devices", "count", deviceCount)
+	peakLevels := make(map[string]float32)
 
-	// Query each device's audio sessions for peak levels
-	for deviceIdx := uint32(0); deviceIdx < deviceCount; deviceIdx++ {
-		var endpoint *wca.IMMDevice
-		if err := deviceCollection.Item(deviceIdx, &endpoint); err != nil {
+	for _, session := range am.sessions {
+		peak, err := session.meter.GetPeakValue()
+		if err != nil {
+
+			// most likely the session's device went away. whatever replaced it gets picked up on the next read
+			atomic.StoreInt32(&am.stale, 1)
 			continue
 		}
-		ams.queryDeviceSessionLevels(endpoint, peakLevels)
-		endpoint.Release()
+
+		processName := normalizeProcessName(session.executable)
+
+		// Keep highest peak if process has multiple sessions
+		if existing, ok := peakLevels[processName]; !ok || peak > existing {
+			peakLevels[processName] = peak
+		}
 	}
 
 	// Log peak levels at Debug level (only when there are some)
 	if len(peakLevels) > 0 {
-		ams.logger.Debugw("Audio peak levels", "levels", peakLevels)
+		am.logger.Debugw("Audio peak levels", "levels", peakLevels)
 	}
 
-	return peakLevels, nil
+	am.lastReading = audioMeterReading{levels: peakLevels, at: now}
+
+	return am.lastReading
 }
 
-// queryDeviceSessions enumerates all audio sessions on a device and checks
-// their peak audio levels, adding active processes to the map.
-func (ams *AudioMeterService) queryDeviceSessions(endpoint *wca.IMMDevice, activeProcesses map[string]bool) {
-	// Get session manager for this device
-	var audioSessionManager2 *wca.IAudioSessionManager2
-	if err := endpoint.Activate(
-		wca.IID_IAudioSessionManager2,
-		wca.CLSCTX_ALL,
-		nil,
-		&audioSessionManager2,
-	); err != nil {
-		return // Some devices don't support session enumeration
+// refresh lets go of every cached session and meters the ones there are now, across all active output devices
+func (am *audioMeter) refresh() error {
+	if am.enumerator == nil {
+		if err := am.createEnumerator(); err != nil {
+			return err
+		}
 	}
-	defer audioSessionManager2.Release()
 
-	// Get session enumerator
-	var sessionEnumerator *wca.IAudioSessionEnumerator
-	if err := audioSessionManager2.GetSessionEnumerator(&sessionEnumerator); err != nil {
-		return
-	}
-	defer sessionEnumerator.Release()
+	am.releaseSessions()
 
-	var sessionCount int
-	if err := sessionEnumerator.GetCount(&sessionCount); err != nil {
-		return
+	var deviceCollection *wca.IMMDeviceCollection
+	if err := am.enumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+		am.logger.Warnw("Failed to enumerate audio endpoints", "error", err)
+		return fmt.Errorf("enumerate audio endpoints: %w", err)
 	}
+	defer deviceCollection.Release()
 
-	// Query each session
-	for sessionIdx := 0; sessionIdx < sessionCount; sessionIdx++ {
-		ams.querySession(sessionEnumerator, sessionIdx, activeProcesses)
+	var deviceCount uint32
+	if err := deviceCollection.GetCount(&deviceCount); err != nil {
+		am.logger.Warnw("Failed to get device count", "error", err)
+		return fmt.Errorf("get device count: %w", err)
 	}
-}
 
-// querySession checks a single audio session's peak level and adds the process
-// to activeProcesses if it's above the threshold.
-func (ams *AudioMeterService) querySession(sessionEnumerator *wca.IAudioSessionEnumerator, sessionIdx int, activeProcesses map[string]bool) {
-	var audioSessionControl *wca.IAudioSessionControl
-	if err := sessionEnumerator.GetSession(sessionIdx, &audioSessionControl); err != nil {
-		return
+	for deviceIdx := uint32(0); deviceIdx < deviceCount; deviceIdx++ {
+		var endpoint *wca.IMMDevice
+		if err := deviceCollection.Item(deviceIdx, &endpoint); err != nil {
+			continue
+		}
+
+		am.meterDeviceSessions(endpoint)
+		endpoint.Release()
 	}
 
-	// Get IAudioSessionControl2 for process ID
-	dispatch, err := audioSessionControl.QueryInterface(wca.IID_IAudioSessionControl2)
-	if err != nil {
-		audioSessionControl.Release()
-		return
+	if err := am.nameSessions(); err != nil {
+		am.logger.Warnw("Failed to look up audio session processes", "error", err)
+		return err
 	}
-	audioSessionControl.Release()
 
-	audioSessionControl2 := (*wca.IAudioSessionControl2)(unsafe.Pointer(dispatch))
-	defer audioSessionControl2.Release()
+	am.refreshedAt = time.Now()
 
-	// Get process ID
-	var pid uint32
-	audioSessionControl2.GetProcessId(&pid)
+	am.logger.Debugw("Enumerated audio sessions", "devices", deviceCount, "sessions", len(am.sessions))
 
-	if pid == 0 {
-		// System sounds session - skip for LED purposes
-		return
-	}
+	return nil
+}
 
-	// Look up process name
-	process, err := ps.FindProcess(int(pid))
-	if err != nil || process == nil {
-		return
+// nameSessions fills in the executable of each metered session's process, letting go of those whose process is gone
+func (am *audioMeter) nameSessions() error {
+	pids := make([]uint32, 0, len(am.sessions))
+	for _, session := range am.sessions {
+		pids = append(pids, session.pid)
 	}
-	processName := strings.ToLower(process.Executable())
 
-	// Query IAudioMeterInformation for peak level
-	meterDispatch, err := audioSessionControl2.QueryInterface(IID_IAudioMeterInformation)
+	executables, err := am.processNames.lookup(pids)
 	if err != nil {
-		return
+		return err
 	}
 
-	audioMeter := (*IAudioMeterInformation)(unsafe.Pointer(meterDispatch))
-	defer audioMeter.Release()
+	named := am.sessions[:0]
 
-	// Get peak value (0.0 to 1.0)
-	peak, err := audioMeter.GetPeakValue()
-	if err != nil {
-		ams.logger.Warnw("Failed to get peak value", "process", processName, "error", err)
-		return
+	for _, session := range am.sessions {
+		executable, ok := executables[session.pid]
+		if !ok {
+			am.releaseSession(session)
+			continue
+		}
+
+		session.executable = executable
+		named = append(named, session)
 	}
 
-	ams.logger.Debugw("Peak level", "process", processName, "peak", peak)
+	am.sessions = named
+
+	return nil
+}
+
+func (am *audioMeter) createEnumerator() error {
+	if err := wca.CoCreateInstance(
+		wca.CLSID_MMDeviceEnumerator,
+		0,
+		wca.CLSCTX_ALL,
+		wca.IID_IMMDeviceEnumerator,
+		&am.enumerator,
+	); err != nil {
+		am.logger.Warnw("Failed to create device enumerator", "error", err)
+		am.enumerator = nil
 
-	if peak > audioActiveThreshold {
-		activeProcesses[processName] = true
+		return fmt.Errorf("create device enumerator: %w", err)
 	}
+
+	// without these, devices coming and going only get noticed on the periodic refresh
+	if err := am.enumerator.RegisterEndpointNotificationCallback(am.deviceNotifications); err != nil {
+		am.logger.Warnw("Failed to register for device notifications", "error", err)
+	}
+
+	return nil
 }
 
-// queryDeviceSessionLevels enumerates all audio sessions on a device and gets
-// their peak audio levels, storing them in the peakLevels map.
-func (ams *AudioMeterService) queryDeviceSessionLevels(endpoint *wca.IMMDevice, peakLevels map[string]float32) {
+// meterDeviceSessions keeps a meter for each of a device's sessions, and the device's session manager so that it
+// tells us about new ones
+func (am *audioMeter) meterDeviceSessions(endpoint *wca.IMMDevice) {
 	var audioSessionManager2 *wca.IAudioSessionManager2
 	if err := endpoint.Activate(
 		wca.IID_IAudioSessionManager2,
@@ -224,71 +430,148 @@ func (ams *AudioMeterService) queryDeviceSessionLevels(endpoint *wca.IMMDevice,
 		nil,
 		&audioSessionManager2,
 	); err != nil {
-		return
+		return // Some devices don't support session enumeration
 	}
-	defer audioSessionManager2.Release()
 
 	var sessionEnumerator *wca.IAudioSessionEnumerator
 	if err := audioSessionManager2.GetSessionEnumerator(&sessionEnumerator); err != nil {
+		audioSessionManager2.Release()
 		return
 	}
 	defer sessionEnumerator.Release()
 
+	if err := registerSessionNotification(audioSessionManager2, am.sessionNotifications); err != nil {
+		am.logger.Warnw("Failed to register for session notifications", "error", err)
+	}
+
+	am.managers = append(am.managers, audioSessionManager2)
+
 	var sessionCount int
 	if err := sessionEnumerator.GetCount(&sessionCount); err != nil {
 		return
 	}
 
 	for sessionIdx := 0; sessionIdx < sessionCount; sessionIdx++ {
-		ams.querySessionLevel(sessionEnumerator, sessionIdx, peakLevels)
+		if session, ok := am.meterSession(sessionEnumerator, sessionIdx); ok {
+			am.sessions = append(am.sessions, session)
+		}
 	}
 }
 
-// querySessionLevel gets a single audio session's peak level and stores it.
-func (ams *AudioMeterService) querySessionLevel(sessionEnumerator *wca.IAudioSessionEnumerator, sessionIdx int, peakLevels map[string]float32) {
+// meterSession gets a single audio session's peak meter, skipping expired sessions and the system sounds session
+func (am *audioMeter) meterSession(sessionEnumerator *wca.IAudioSessionEnumerator, sessionIdx int) (meteredSession, bool) {
 	var audioSessionControl *wca.IAudioSessionControl
 	if err := sessionEnumerator.GetSession(sessionIdx, &audioSessionControl); err != nil {
-		return
+		return meteredSession{}, false
 	}
 
 	dispatch, err := audioSessionControl.QueryInterface(wca.IID_IAudioSessionControl2)
 	if err != nil {
 		audioSessionControl.Release()
-		return
+		return meteredSession{}, false
 	}
 	audioSessionControl.Release()
 
 	audioSessionControl2 := (*wca.IAudioSessionControl2)(unsafe.Pointer(dispatch))
-	defer audioSessionControl2.Release()
+
+	// an expired session's process has most likely exited, leaving its pid free for another one
+	var state uint32
+	if err := audioSessionControl2.GetState(&state); err != nil || state == wca.AudioSessionStateExpired {
+		audioSessionControl2.Release()
+		return meteredSession{}, false
+	}
 
 	var pid uint32
 	audioSessionControl2.GetProcessId(&pid)
 
 	if pid == 0 {
-		return
-	}
-
-	process, err := ps.FindProcess(int(pid))
-	if err != nil || process == nil {
-		return
+		audioSessionControl2.Release()
+		return meteredSession{}, false
 	}
-	processName := strings.ToLower(process.Executable())
 
 	meterDispatch, err := audioSessionControl2.QueryInterface(IID_IAudioMeterInformation)
 	if err != nil {
-		return
+		audioSessionControl2.Release()
+		return meteredSession{}, false
 	}
 
-	audioMeter := (*IAudioMeterInformation)(unsafe.Pointer(meterDispatch))
-	defer audioMeter.Release()
+	// without these, sessions ending only get noticed on the periodic refresh
+	if err := registerSessionEvents(audioSessionControl2, am.sessionEvents); err != nil {
+		am.logger.Debugw("Failed to register for session events", "pid", pid, "error", err)
+	}
 
-	peak, err := audioMeter.GetPeakValue()
-	if err != nil {
-		return
+	return meteredSession{
+		pid:     pid,
+		meter:   (*IAudioMeterInformation)(unsafe.Pointer(meterDispatch)),
+		control: audioSessionControl2,
+	}, true
+}
+
+func (am *audioMeter) releaseSession(session meteredSession) {
+	unregisterSessionEvents(session.control, am.sessionEvents)
+	session.control.Release()
+	session.meter.Release()
+}
+
+func (am *audioMeter) releaseSessions() {
+	for _, session := range am.sessions {
+		am.releaseSession(session)
 	}
 
-	// Keep highest peak if process has multiple sessions
-	if existing, ok := peakLevels[processName]; !ok || peak > existing {
-		peakLevels[processName] = peak
+	for _, manager := range am.managers {
+		unregisterSessionNotification(manager, am.sessionNotifications)
+		manager.Release()
+	}
+
+	am.sessions = nil
+	am.managers = nil
+}
+
+// the callbacks below are called on COM's own threads, so all they do is mark what's cached as stale
+
+func (am *audioMeter) sessionCreatedCallback(this *audioSessionNotification, newSession uintptr) (hResult uintptr) {
+	atomic.StoreInt32(&am.stale, 1)
+	return
+}
+
+// a session that's expired has had its last stream closed, most likely by its process exiting. the ones going
+// between active and inactive as they start and stop playing are still metered as they are
+func (am *audioMeter) sessionStateChangedCallback(this *audioSessionEvents, newState uint32) (hResult uintptr) {
+	if newState == wca.AudioSessionStateExpired {
+		atomic.StoreInt32(&am.stale, 1)
 	}
+
+	return
+}
+
+func (am *audioMeter) sessionDisconnectedCallback(this *audioSessionEvents, disconnectReason uint32) (hResult uintptr) {
+	atomic.StoreInt32(&am.stale, 1)
+	return
+}
+
+func (am *audioMeter) deviceStateChangedCallback(
+	this *wca.IMMNotificationClient,
+	lpcwstr uintptr,
+	dwNewState uint32,
+) (hResult uintptr) {
+	atomic.StoreInt32(&am.stale, 1)
+	return
+}
+
+func (am *audioMeter) deviceAddedOrRemovedCallback(this *wca.IMMNotificationClient, lpcwstr uintptr) (hResult uintptr) {
+	atomic.StoreInt32(&am.stale, 1)
+	return
+}
+
+func (am *audioMeter) defaultDeviceChangedCallback(
+	this *wca.IMMNotificationClient,
+	EDataFlow, eRole uint32,
+	lpcwstr uintptr,
+) (hResult uintptr) {
+	atomic.StoreInt32(&am.stale, 1)
+	return
+}
+
+func (am *audioMeter) noopCallback() (hResult uintptr) {
+	return
 }
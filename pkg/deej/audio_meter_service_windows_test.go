@@ -0,0 +1,113 @@
+package deej
+
+import (
+	"testing"
+
+	ps "github.com/mitchellh/go-ps"
+)
+
+// how many audio sessions the benchmarks look up names for, about what a desktop with a few apps open has
+const benchmarkSessionCount = 8
+
+// benchmarkSessionPIDs picks running processes to stand in for ones with audio sessions
+func benchmarkSessionPIDs(b *testing.B) []uint32 {
+	processes, err := ps.Processes()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	pids := []uint32{}
+	for _, process := range processes {
+		if process.Pid() != 0 && len(pids) < benchmarkSessionCount {
+			pids = append(pids, uint32(process.Pid()))
+		}
+	}
+
+	if len(pids) < 2 {
+		b.Skip("not enough running processes to stand in for sessions")
+	}
+
+	return pids
+}
+
+// countProcessSnapshots has listProcesses count how often it's called, until the benchmark's done
+func countProcessSnapshots(b *testing.B) *int {
+	snapshots := 0
+	original := listProcesses
+
+	listProcesses = func() ([]ps.Process, error) {
+		snapshots++
+		return original()
+	}
+
+	b.Cleanup(func() { listProcesses = original })
+
+	return &snapshots
+}
+
+// BenchmarkProcessNamesFindProcess is how names were looked up before: ps.FindProcess for every session, which
+// snapshots every running process each time
+func BenchmarkProcessNamesFindProcess(b *testing.B) {
+	pids := benchmarkSessionPIDs(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, pid := range pids {
+			if _, err := ps.FindProcess(int(pid)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+
+	b.ReportMetric(float64(len(pids)), "snapshots/op")
+}
+
+// BenchmarkProcessNamesCached is looking the same sessions up again, which is what almost every refresh does
+func BenchmarkProcessNamesCached(b *testing.B) {
+	pids := benchmarkSessionPIDs(b)
+	cache := &processNameCache{}
+
+	if _, err := cache.lookup(pids); err != nil {
+		b.Fatal(err)
+	}
+
+	snapshots := countProcessSnapshots(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := cache.lookup(pids); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(*snapshots)/float64(b.N), "snapshots/op")
+}
+
+// BenchmarkProcessNamesCachedNewSession is a refresh with a session the cache hasn't seen, which takes one
+// snapshot however many sessions there are
+func BenchmarkProcessNamesCachedNewSession(b *testing.B) {
+	pids := benchmarkSessionPIDs(b)
+	cache := &processNameCache{}
+	snapshots := countProcessSnapshots(b)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+
+		// looking up all but the last one leaves the cache without it
+		if _, err := cache.lookup(pids[:len(pids)-1]); err != nil {
+			b.Fatal(err)
+		}
+
+		if _, err := cache.lookup(pids); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(*snapshots)/float64(b.N), "snapshots/op")
+}
@@ -8,6 +8,7 @@ import (
 	"unsafe"
 
 	ole "github.com/go-ole/go-ole"
+	wca "github.com/moutend/go-wca"
 )
 
 // IAudioMeterInformation represents a peak meter on an audio stream
@@ -49,3 +50,136 @@ func (v *IAudioMeterInformation) GetPeakValue() (float32, error) {
 
 // IID_IAudioMeterInformation is the GUID for IAudioMeterInformation interface
 var IID_IAudioMeterInformation = ole.NewGUID("{C02216F6-8C67-4B5B-9D00-D008E73E0064}")
+
+// audioSessionNotification is our side of IAudioSessionNotification, which a session manager calls whenever a new
+// session is created on its device. it lives in Go memory, so whoever registers it has to hold on to it
+// https://learn.microsoft.com/en-us/windows/win32/api/audiopolicy/nn-audiopolicy-iaudiosessionnotification
+type audioSessionNotification struct {
+	VTable *audioSessionNotificationVtbl
+}
+
+type audioSessionNotificationVtbl struct {
+	QueryInterface   uintptr
+	AddRef           uintptr
+	Release          uintptr
+	OnSessionCreated uintptr
+}
+
+// audioSessionManager2Vtbl is IAudioSessionManager2's VTable, for the session notification methods go-wca doesn't
+// let us pass our own notification to
+type audioSessionManager2Vtbl struct {
+	ole.IUnknownVtbl
+	GetAudioSessionControl        uintptr
+	GetSimpleAudioVolume          uintptr
+	GetSessionEnumerator          uintptr
+	RegisterSessionNotification   uintptr
+	UnregisterSessionNotification uintptr
+	RegisterDuckNotification      uintptr
+	UnregisterDuckNotification    uintptr
+}
+
+func audioSessionManager2VTable(manager *wca.IAudioSessionManager2) *audioSessionManager2Vtbl {
+	return (*audioSessionManager2Vtbl)(unsafe.Pointer(manager.RawVTable))
+}
+
+// registerSessionNotification has the session manager call the given notification for every new session. the
+// manager only starts notifying once its sessions have been enumerated at least once
+func registerSessionNotification(manager *wca.IAudioSessionManager2, notification *audioSessionNotification) error {
+	hr, _, _ := syscall.Syscall(
+		audioSessionManager2VTable(manager).RegisterSessionNotification,
+		2,
+		uintptr(unsafe.Pointer(manager)),
+		uintptr(unsafe.Pointer(notification)),
+		0)
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
+
+func unregisterSessionNotification(manager *wca.IAudioSessionManager2, notification *audioSessionNotification) error {
+	hr, _, _ := syscall.Syscall(
+		audioSessionManager2VTable(manager).UnregisterSessionNotification,
+		2,
+		uintptr(unsafe.Pointer(manager)),
+		uintptr(unsafe.Pointer(notification)),
+		0)
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
+
+// audioSessionEvents is our side of IAudioSessionEvents, which a session calls when it changes - we only care
+// about it expiring or being disconnected. like audioSessionNotification, whoever registers it holds on to it
+// https://learn.microsoft.com/en-us/windows/win32/api/audiopolicy/nn-audiopolicy-iaudiosessionevents
+type audioSessionEvents struct {
+	VTable *audioSessionEventsVtbl
+}
+
+type audioSessionEventsVtbl struct {
+	QueryInterface         uintptr
+	AddRef                 uintptr
+	Release                uintptr
+	OnDisplayNameChanged   uintptr
+	OnIconPathChanged      uintptr
+	OnSimpleVolumeChanged  uintptr
+	OnChannelVolumeChanged uintptr
+	OnGroupingParamChanged uintptr
+	OnStateChanged         uintptr
+	OnSessionDisconnected  uintptr
+}
+
+// audioSessionControlVtbl is IAudioSessionControl's VTable (which IAudioSessionControl2's starts with), for the
+// session event methods go-wca doesn't let us pass our own events to
+type audioSessionControlVtbl struct {
+	ole.IUnknownVtbl
+	GetState                           uintptr
+	GetDisplayName                     uintptr
+	SetDisplayName                     uintptr
+	GetIconPath                        uintptr
+	SetIconPath                        uintptr
+	GetGroupingParam                   uintptr
+	SetGroupingParam                   uintptr
+	RegisterAudioSessionNotification   uintptr
+	UnregisterAudioSessionNotification uintptr
+}
+
+func audioSessionControlVTable(control *wca.IAudioSessionControl2) *audioSessionControlVtbl {
+	return (*audioSessionControlVtbl)(unsafe.Pointer(control.RawVTable))
+}
+
+// registerSessionEvents has the session call the given events whenever it changes
+func registerSessionEvents(control *wca.IAudioSessionControl2, events *audioSessionEvents) error {
+	hr, _, _ := syscall.Syscall(
+		audioSessionControlVTable(control).RegisterAudioSessionNotification,
+		2,
+		uintptr(unsafe.Pointer(control)),
+		uintptr(unsafe.Pointer(events)),
+		0)
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
+
+func unregisterSessionEvents(control *wca.IAudioSessionControl2, events *audioSessionEvents) error {
+	hr, _, _ := syscall.Syscall(
+		audioSessionControlVTable(control).UnregisterAudioSessionNotification,
+		2,
+		uintptr(unsafe.Pointer(control)),
+		uintptr(unsafe.Pointer(events)),
+		0)
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
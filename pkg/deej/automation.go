@@ -0,0 +1,314 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const automationTickInterval = time.Second
+
+// scheduledAction runs an action every day (or on specific weekdays) at a given time
+type scheduledAction struct {
+	Hour   int
+	Minute int
+
+	// weekdays to run on, empty meaning every day
+	Days map[time.Weekday]bool
+
+	// the timezone Hour and Minute are in, nil meaning the automation timezone
+	Location *time.Location
+
+	Action string
+
+	// any other keys given for the entry, used as the action's arguments
+	Params map[string]string
+}
+
+// automationConfig holds everything the automation engine runs on its own
+type automationConfig struct {
+	Schedule []scheduledAction
+
+	// the timezone schedule times are in, unless an entry has its own
+	Location *time.Location
+
+	// how long a scheduled mute leaves a target alone after the user unmutes it
+	OverrideDuration time.Duration
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// automationEngine runs scheduled actions at their configured times
+type automationEngine struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock    sync.Mutex
+	running bool
+
+	// the minute we last checked the schedule for, so that every entry runs at most once per minute
+	lastCheckedMinute time.Time
+
+	targets *targetSchedule
+
+	stopChannel chan bool
+}
+
+func newAutomationEngine(deej *Deej, logger *zap.SugaredLogger) *automationEngine {
+	logger = logger.Named("automation")
+
+	ae := &automationEngine{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	ae.targets = newTargetSchedule(deej, logger)
+
+	logger.Debug("Created automation engine instance")
+
+	return ae
+}
+
+// Start begins checking the schedule
+func (ae *automationEngine) Start() {
+	ae.lock.Lock()
+	defer ae.lock.Unlock()
+
+	if ae.running {
+		return
+	}
+
+	ae.running = true
+	ae.lastCheckedMinute = time.Now().Truncate(time.Minute)
+
+	go ae.scheduleLoop()
+}
+
+// Stop stops checking the schedule. actions already running (such as a volume ramp) aren't affected
+func (ae *automationEngine) Stop() {
+	ae.lock.Lock()
+
+	if !ae.running {
+		ae.lock.Unlock()
+		return
+	}
+
+	ae.running = false
+	ae.lock.Unlock()
+
+	ae.stopChannel <- true
+}
+
+func (ae *automationEngine) scheduleLoop() {
+	ticker := time.NewTicker(automationTickInterval)
+	defer ticker.Stop()
+
+	// quiet hours might be on already
+	ae.deej.quietHours.update(ae.localTime(time.Now(), nil))
+
+	for {
+		select {
+		case <-ae.stopChannel:
+			return
+		case now := <-ticker.C:
+			minute := now.Truncate(time.Minute)
+			if !minute.After(ae.lastCheckedMinute) {
+				continue
+			}
+
+			ae.lastCheckedMinute = minute
+			ae.runDueActions(minute)
+			ae.targets.enforce(minute)
+			ae.deej.quietHours.update(ae.localTime(minute, nil))
+		}
+	}
+}
+
+func (ae *automationEngine) runDueActions(now time.Time) {
+	for _, entry := range ae.deej.config.Automation.Schedule {
+		local := ae.localTime(now, entry.Location)
+
+		if entry.Hour != local.Hour() || entry.Minute != local.Minute() {
+			continue
+		}
+
+		if len(entry.Days) > 0 && !entry.Days[local.Weekday()] {
+			continue
+		}
+
+		ae.logger.Infow("Running scheduled action", "action", entry.Action, "params", entry.Params)
+		ae.runAction(entry.Action, entry.Params, now)
+	}
+}
+
+// localTime returns the given time in the given timezone, falling back to the automation timezone
+func (ae *automationEngine) localTime(now time.Time, location *time.Location) time.Time {
+	if location == nil {
+		location = ae.deej.config.Automation.Location
+	}
+
+	if location == nil {
+		return now.Local()
+	}
+
+	return now.In(location)
+}
+
+func (ae *automationEngine) runAction(action string, params map[string]string, now time.Time) {
+	switch action {
+	case automationActionAlarmSound:
+		ae.deej.alarms.PlaySound(params)
+
+	case automationActionAlarmRamp:
+		ae.deej.alarms.Ramp(params)
+
+	case automationActionTargetMute:
+		ae.targets.Mute(params, now)
+
+	case automationActionTargetUnmute:
+		ae.targets.Unmute(params)
+
+	case automationActionTargetVolume:
+		ae.targets.SetVolume(params, now)
+
+	case buttonActionAppRoute:
+		if err := ae.deej.RouteAppTo(params["app"], params["device"]); err != nil {
+			ae.logger.Warnw("Failed to route app", "app", params["app"], "device", params["device"], "error", err)
+		}
+
+	default:
+		ae.logger.Warnw("Unknown scheduled action", "action", action)
+	}
+}
+
+// scheduledActionsFromConfig parses a list of schedule entries, each an object with "at", "action",
+// optionally "days" and "timezone", and any other keys the action needs
+func scheduledActionsFromConfig(logger *zap.SugaredLogger, raw interface{}) []scheduledAction {
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	schedule := []scheduledAction{}
+
+	for idx, rawEntry := range entries {
+		fields, ok := toStringMap(rawEntry)
+		if !ok {
+			logger.Warnw("Ignoring invalid schedule entry", "index", idx)
+			continue
+		}
+
+		entry := scheduledAction{
+			Hour:   -1,
+			Days:   map[time.Weekday]bool{},
+			Params: map[string]string{},
+		}
+
+		for key, value := range fields {
+			switch strings.ToLower(key) {
+			case "at":
+				hour, minute, err := parseTimeOfDay(fmt.Sprint(value))
+				if err != nil {
+					logger.Warnw("Ignoring schedule entry with invalid time", "index", idx, "error", err)
+					break
+				}
+
+				entry.Hour, entry.Minute = hour, minute
+
+			case "days":
+				entry.Days = parseWeekdays(value)
+
+			case "timezone":
+				location, err := parseTimezone(fmt.Sprint(value))
+				if err != nil {
+					logger.Warnw("Ignoring invalid schedule entry timezone", "index", idx, "error", err)
+					break
+				}
+
+				entry.Location = location
+
+			case "action":
+				entry.Action = strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+
+			default:
+				entry.Params[strings.ToLower(key)] = fmt.Sprint(value)
+			}
+		}
+
+		if entry.Hour == -1 || entry.Action == "" {
+			logger.Warnw("Ignoring schedule entry without a valid time and action", "index", idx)
+			continue
+		}
+
+		schedule = append(schedule, entry)
+	}
+
+	return schedule
+}
+
+// parseWeekdays reads a list of weekday names ("mon", "tuesday", ...), skipping any it doesn't know
+func parseWeekdays(value interface{}) map[time.Weekday]bool {
+	weekdays := map[time.Weekday]bool{}
+
+	days, _ := value.([]interface{})
+	for _, day := range days {
+		dayName := strings.ToLower(fmt.Sprint(day))
+		if len(dayName) > 3 {
+			dayName = dayName[:3]
+		}
+
+		if weekday, ok := weekdaysByName[dayName]; ok {
+			weekdays[weekday] = true
+		}
+	}
+
+	return weekdays
+}
+
+// parseTimezone loads an IANA timezone ("Europe/London"), with "local" or nothing meaning the system's (nil)
+func parseTimezone(value string) (*time.Location, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "local") {
+		return nil, nil
+	}
+
+	location, err := time.LoadLocation(value)
+	if err != nil {
+		return nil, fmt.Errorf("load timezone %q: %w", value, err)
+	}
+
+	return location, nil
+}
+
+// parseTimeOfDay parses a 24-hour "HH:MM" time
+func parseTimeOfDay(value string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("expected HH:MM, got %q", value)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return 0, 0, fmt.Errorf("invalid hour in %q", value)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return 0, 0, fmt.Errorf("invalid minute in %q", value)
+	}
+
+	return hour, minute, nil
+}
@@ -0,0 +1,120 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/getlantern/systray"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// what the startup entry is called, in the registry or the autostart directory
+	autostartName = "deej"
+
+	// added to the flags deej starts at login with, so that it knows to look for its config next to itself
+	autostartedFlag = "--autostarted"
+)
+
+// SetAutostart registers deej to start when the user logs in, with the given flags (e.g. --cli), or unregisters
+// it, for --autostart and --no-autostart. the startup entry runs this executable, so moving it breaks the entry
+func SetAutostart(logger *zap.SugaredLogger, out io.Writer, enable bool, args []string) error {
+	logger = logger.Named("autostart")
+
+	if err := setAutostart(logger, enable, args); err != nil {
+		return err
+	}
+
+	if !enable {
+		fmt.Fprintln(out, "deej won't start at login anymore")
+		return nil
+	}
+
+	if len(args) == 0 {
+		fmt.Fprintln(out, "deej will start at login")
+	} else {
+		fmt.Fprintf(out, "deej will start at login, with %s\n", strings.Join(args, " "))
+	}
+
+	return nil
+}
+
+// PrepareAutostart moves into deej's own directory if it was started at login, as the login starts it wherever
+// it likes. call it before anything else looks for the config or writes logs
+func PrepareAutostart(autostarted bool) error {
+	if !autostarted {
+		return nil
+	}
+
+	return util.MoveToExecutableDir()
+}
+
+func setAutostart(logger *zap.SugaredLogger, enable bool, args []string) error {
+	if !enable {
+		if err := disableAutostart(logger); err != nil {
+			return fmt.Errorf("remove startup entry: %w", err)
+		}
+
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	if err := enableAutostart(logger, executable, append([]string{autostartedFlag}, args...)); err != nil {
+		return fmt.Errorf("add startup entry: %w", err)
+	}
+
+	return nil
+}
+
+// addTrayAutostart adds a checked item for starting at login, which registers deej with the flags it was started
+// with this time around. it's disabled where there's no startup to register with, or deej already runs as a service
+func (d *Deej) addTrayAutostart(logger *zap.SugaredLogger) {
+	item := systray.AddMenuItem("Start at login", "Start deej when you log in, the way it was started this time")
+
+	enabled, err := autostartEnabled()
+	if err != nil {
+		logger.Debugw("Failed to check whether deej starts at login", "error", err)
+		item.Disable()
+
+		return
+	}
+
+	if enabled {
+		item.Check()
+	}
+
+	if runningAsService() {
+		item.Disable()
+		return
+	}
+
+	go func() {
+		for range item.ClickedCh {
+			enable := !enabled
+			logger.Infow("Start at login menu item clicked, changing startup entry", "enable", enable, "args", d.startupArgs)
+
+			if err := setAutostart(logger, enable, d.startupArgs); err != nil {
+				logger.Warnw("Failed to change startup entry", "error", err)
+				d.notifier.Notify("Couldn't change starting at login", err.Error())
+
+				continue
+			}
+
+			enabled = enable
+
+			if enabled {
+				item.Check()
+			} else {
+				item.Uncheck()
+			}
+		}
+	}()
+}
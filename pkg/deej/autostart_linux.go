@@ -0,0 +1,119 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// see autostart_other.go
+const autostartSupported = true
+
+// desktops following the XDG autostart spec start every .desktop file in here at login
+func autostartFilepath() (string, error) {
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("get home directory: %w", err)
+		}
+
+		configDir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(configDir, "autostart", autostartName+".desktop"), nil
+}
+
+func autostartEnabled() (bool, error) {
+	path, err := autostartFilepath()
+	if err != nil {
+		return false, err
+	}
+
+	return util.FileExists(path), nil
+}
+
+func enableAutostart(logger *zap.SugaredLogger, executable string, args []string) error {
+	path, err := autostartFilepath()
+	if err != nil {
+		return err
+	}
+
+	if err := util.EnsureDirExists(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	command := []string{desktopExecArg(executable)}
+	for _, arg := range args {
+		command = append(command, desktopExecArg(arg))
+	}
+
+	// Path has it start next to its config, though --autostarted would get it there anyway
+	entry := strings.Join([]string{
+		"[Desktop Entry]",
+		"Type=Application",
+		"Name=deej",
+		"Comment=Hardware volume mixer",
+		"Exec=" + strings.Join(command, " "),
+		"Path=" + filepath.Dir(executable),
+		"Terminal=false",
+		"X-GNOME-Autostart-enabled=true",
+	}, "\n") + "\n"
+
+	if err := ioutil.WriteFile(path, []byte(entry), 0644); err != nil {
+		return fmt.Errorf("write autostart entry: %w", err)
+	}
+
+	logger.Infow("Added startup entry", "path", path)
+
+	return nil
+}
+
+func disableAutostart(logger *zap.SugaredLogger) error {
+	path, err := autostartFilepath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove autostart entry: %w", err)
+	}
+
+	logger.Infow("Removed startup entry", "path", path)
+
+	return nil
+}
+
+// desktopExecArg quotes an argument for a .desktop file's Exec line. the spec quotes and escapes like a shell,
+// then escapes backslashes once more for the file itself, and % starts a field code unless doubled
+func desktopExecArg(arg string) string {
+	arg = strings.Replace(arg, "%", "%%", -1)
+
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\"'\\><~|&;$*?#()`") {
+		return arg
+	}
+
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+
+	for _, r := range arg {
+		switch r {
+		case '"', '`', '$':
+			quoted.WriteString(`\\`)
+		case '\\':
+			quoted.WriteString(`\\\`)
+		}
+
+		quoted.WriteRune(r)
+	}
+
+	quoted.WriteByte('"')
+
+	return quoted.String()
+}
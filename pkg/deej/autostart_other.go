@@ -0,0 +1,26 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// there's no startup entry deej knows how to write here (e.g. a launchd agent), so --autostart does nothing and
+// the tray's start at login item is disabled
+const autostartSupported = false
+
+func autostartEnabled() (bool, error) {
+	return false, util.ErrNotSupported
+}
+
+func enableAutostart(logger *zap.SugaredLogger, executable string, args []string) error {
+	return util.ErrNotSupported
+}
+
+func disableAutostart(logger *zap.SugaredLogger) error {
+	return util.ErrNotSupported
+}
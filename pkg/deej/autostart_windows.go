@@ -0,0 +1,77 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// see autostart_other.go
+const autostartSupported = true
+
+// the current user's Run key, which starts everything in it at login
+const autostartRunKey = `Software\Microsoft\Windows\CurrentVersion\Run`
+
+func autostartEnabled() (bool, error) {
+	key, err := registry.OpenKey(registry.CURRENT_USER, autostartRunKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false, fmt.Errorf("open Run key: %w", err)
+	}
+
+	defer key.Close()
+
+	if _, _, err := key.GetStringValue(autostartName); err != nil {
+		if errors.Is(err, registry.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, fmt.Errorf("read Run key value: %w", err)
+	}
+
+	return true, nil
+}
+
+func enableAutostart(logger *zap.SugaredLogger, executable string, args []string) error {
+	key, _, err := registry.CreateKey(registry.CURRENT_USER, autostartRunKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open Run key: %w", err)
+	}
+
+	defer key.Close()
+
+	commandLine := []string{windows.EscapeArg(executable)}
+	for _, arg := range args {
+		commandLine = append(commandLine, windows.EscapeArg(arg))
+	}
+
+	command := strings.Join(commandLine, " ")
+
+	if err := key.SetStringValue(autostartName, command); err != nil {
+		return fmt.Errorf("write Run key value: %w", err)
+	}
+
+	logger.Infow("Added startup entry", "key", autostartRunKey, "command", command)
+
+	return nil
+}
+
+func disableAutostart(logger *zap.SugaredLogger) error {
+	key, err := registry.OpenKey(registry.CURRENT_USER, autostartRunKey, registry.SET_VALUE)
+	if err != nil {
+		return fmt.Errorf("open Run key: %w", err)
+	}
+
+	defer key.Close()
+
+	if err := key.DeleteValue(autostartName); err != nil && !errors.Is(err, registry.ErrNotExist) {
+		return fmt.Errorf("delete Run key value: %w", err)
+	}
+
+	logger.Infow("Removed startup entry", "key", autostartRunKey)
+
+	return nil
+}
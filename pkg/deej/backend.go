@@ -0,0 +1,77 @@
+package deej
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+
+	// whatever this platform uses natively: wasapi on Windows, pulseaudio on Linux
+	backendAuto = "auto"
+
+	backendWASAPI     = "wasapi"
+	backendPulseAudio = "pulseaudio"
+
+	// PipeWire, through its PulseAudio server (pipewire-pulse). this is what WSLg and most current distros run
+	backendPipeWire = "pipewire"
+
+	// sessions that only exist inside deej, for trying things out and for tests that shouldn't touch real volumes
+	backendDummy = "dummy"
+
+	defaultBackend = backendAuto
+)
+
+// backendConfig picks the audio backend that sliders control
+type backendConfig struct {
+	Name string
+
+	// the sound server to connect to (pulseaudio and pipewire only), e.g. "unix:/mnt/wslg/PulseServer".
+	// empty means the usual one ($PULSE_SERVER, or the user's runtime directory)
+	Server string
+}
+
+// validBackend returns whether the given name is a backend deej knows of, on any platform
+func validBackend(name string) bool {
+	switch name {
+	case backendAuto, backendWASAPI, backendPulseAudio, backendPipeWire, backendDummy:
+		return true
+	}
+
+	return false
+}
+
+// newBackendSessionFinder creates the session finder for the configured backend. backends belonging
+// to another platform fail with util.ErrNotSupported, rather than quietly falling back to the native one
+func newBackendSessionFinder(logger *zap.SugaredLogger, config backendConfig) (SessionFinder, error) {
+	switch config.Name {
+	case backendAuto:
+		return newSessionFinder(logger, config.Server)
+
+	case backendDummy:
+		return newDummySessionFinder(logger), nil
+	}
+
+	if !platformBackends[config.Name] {
+		return nil, fmt.Errorf("use %s backend: %w", config.Name, util.ErrNotSupported)
+	}
+
+	return newSessionFinder(logger, config.Server)
+}
+
+// newDummySessionFinder creates a session finder with nothing behind it but master, system and mic
+// sessions, whose volumes go nowhere
+func newDummySessionFinder(logger *zap.SugaredLogger) SessionFinder {
+	sf := newSimulatedSessionFinder(logger.Named("session_finder"))
+
+	for _, name := range []string{masterSessionName, systemSessionName, inputSessionName} {
+		sf.setSession(name, 1, false)
+	}
+
+	logger.Named("session_finder").Debug("Created dummy session finder instance")
+
+	return sf
+}
@@ -0,0 +1,113 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	buttonModeMomentary = "momentary" // the action is active only while the button is held
+	buttonModeToggle    = "toggle"    // every press flips the action's state
+)
+
+// buttonBinding describes what a single hardware button does
+type buttonBinding struct {
+	Action string
+	Mode   string
+
+	// any other keys given for the button, used by actions that need an argument (e.g. which profile to switch to)
+	Params map[string]string
+}
+
+type buttonMap struct {
+	m    map[int]buttonBinding
+	lock sync.Locker
+}
+
+func newButtonMap() *buttonMap {
+	return &buttonMap{
+		m:    make(map[int]buttonBinding),
+		lock: &sync.Mutex{},
+	}
+}
+
+// buttonMapFromConfig accepts either a plain action name or an object with "action" and "mode" keys per button
+func buttonMapFromConfig(userMapping map[string]interface{}) *buttonMap {
+	resultMap := newButtonMap()
+
+	for buttonIdxString, value := range userMapping {
+		buttonIdx, err := strconv.Atoi(buttonIdxString)
+		if err != nil {
+			continue
+		}
+
+		binding := buttonBinding{Mode: buttonModeMomentary, Params: map[string]string{}}
+
+		switch typedValue := value.(type) {
+		case string:
+			binding.Action = typedValue
+		default:
+			fields, ok := toStringMap(typedValue)
+			if !ok {
+				continue
+			}
+
+			for key, fieldValue := range fields {
+				switch key {
+				case "action":
+					binding.Action = fmt.Sprint(fieldValue)
+				case "mode":
+					binding.Mode = strings.ToLower(fmt.Sprint(fieldValue))
+				default:
+					binding.Params[key] = fmt.Sprint(fieldValue)
+				}
+			}
+		}
+
+		binding.Action = strings.ToLower(strings.TrimSpace(binding.Action))
+		if binding.Action == "" {
+			continue
+		}
+
+		if binding.Mode != buttonModeToggle {
+			binding.Mode = buttonModeMomentary
+		}
+
+		resultMap.set(buttonIdx, binding)
+	}
+
+	return resultMap
+}
+
+func (m *buttonMap) iterate(f func(int, buttonBinding)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for key, value := range m.m {
+		f(key, value)
+	}
+}
+
+func (m *buttonMap) get(key int) (buttonBinding, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	value, ok := m.m[key]
+	return value, ok
+}
+
+func (m *buttonMap) set(key int, value buttonBinding) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.m[key] = value
+}
+
+func (m *buttonMap) String() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return fmt.Sprintf("<%d buttons mapped>", len(m.m))
+}
@@ -0,0 +1,256 @@
+package deej
+
+import (
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ButtonEvent represents a single button press or release captured by deej
+type ButtonEvent struct {
+	ButtonID int
+	Pressed  bool
+}
+
+const (
+	buttonActionPlayPause = "media.play_pause"
+	buttonActionPrevTrack = "media.prev_track"
+	buttonActionNextTrack = "media.next_track"
+
+	buttonActionMicToggleMute = "mic.toggle_mute"
+	buttonActionPushToTalk    = "mic.push_to_talk" // mic is muted unless the button is held
+	buttonActionPushToMute    = "mic.push_to_mute" // mic is live unless the button is held
+
+	buttonActionProfileNext   = "profile.next"   // cycle through profiles
+	buttonActionProfileSwitch = "profile.switch" // switch to the profile given by the "profile" key
+
+	// the session map re-acquires sessions whenever the config is reloaded, so give it a moment
+	// before trying to restore the mic's idle state
+	buttonConfigReloadDelay = 100 * time.Millisecond
+)
+
+// buttonActionKeys lists every button action, along with the keys each one needs (see dashboard.go)
+var buttonActionKeys = map[string][]string{
+	buttonActionPlayPause:     nil,
+	buttonActionPrevTrack:     nil,
+	buttonActionNextTrack:     nil,
+	buttonActionMicToggleMute: nil,
+	buttonActionPushToTalk:    nil,
+	buttonActionPushToMute:    nil,
+	buttonActionProfileNext:   nil,
+	buttonActionProfileSwitch: {"profile"},
+	buttonActionTimerToggle:   nil,
+	buttonActionTimerSkip:     nil,
+	buttonActionDNDToggle:     nil,
+	buttonActionHearingSnooze: nil,
+	buttonActionSceneApply:    {"scene"},
+	buttonActionAlarmCancel:   nil,
+	buttonActionOutputNext:    nil,
+	buttonActionOutputSet:     {"device"},
+	buttonActionAppRoute:      {"app", "device"},
+	buttonActionFocusHold:     nil,
+}
+
+type buttonHandler struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+}
+
+func newButtonHandler(deej *Deej, logger *zap.SugaredLogger) *buttonHandler {
+	logger = logger.Named("buttons")
+
+	bh := &buttonHandler{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created button handler instance")
+
+	return bh
+}
+
+func (bh *buttonHandler) initialize() {
+	bh.applyIdleMicState()
+
+	bh.setupOnConfigReload()
+	bh.setupOnButtonEvent()
+}
+
+func (bh *buttonHandler) setupOnConfigReload() {
+	bh.deej.onConfigReload(func() {
+		<-time.After(buttonConfigReloadDelay)
+		bh.applyIdleMicState()
+	})
+}
+
+func (bh *buttonHandler) setupOnButtonEvent() {
+	buttonEventsChannel := bh.deej.serial.SubscribeToButtonEvents().Events
+
+	go func() {
+		for {
+			select {
+			case event := <-buttonEventsChannel:
+				bh.handleButtonEvent(event)
+			}
+		}
+	}()
+}
+
+func (bh *buttonHandler) handleButtonEvent(event ButtonEvent) {
+	binding, ok := bh.deej.config.ButtonMapping.get(event.ButtonID)
+	if !ok {
+		if event.Pressed {
+			bh.logger.Debugw("No action mapped to button, ignoring", "buttonID", event.ButtonID)
+		}
+
+		return
+	}
+
+	if bh.deej.Verbose() {
+		bh.logger.Debugw("Handling button event", "event", event, "binding", binding)
+	}
+
+	switch binding.Action {
+	case buttonActionPlayPause:
+		if event.Pressed {
+			bh.deej.mediaController.PlayPause()
+		}
+
+	case buttonActionPrevTrack:
+		if event.Pressed {
+			bh.deej.mediaController.PrevTrack()
+		}
+
+	case buttonActionNextTrack:
+		if event.Pressed {
+			bh.deej.mediaController.NextTrack()
+		}
+
+	case buttonActionMicToggleMute:
+		if event.Pressed {
+			bh.toggleMicMute()
+		}
+
+	case buttonActionPushToTalk, buttonActionPushToMute:
+		bh.handleMicHold(event, binding)
+
+	case buttonActionProfileNext:
+		if event.Pressed {
+			bh.deej.config.NextProfile()
+		}
+
+	case buttonActionProfileSwitch:
+		if event.Pressed {
+			bh.deej.config.SwitchProfile(binding.Params["profile"])
+		}
+
+	case buttonActionTimerToggle:
+		if event.Pressed {
+			bh.deej.timer.Toggle()
+		}
+
+	case buttonActionTimerSkip:
+		if event.Pressed {
+			bh.deej.timer.Skip()
+		}
+
+	case buttonActionDNDToggle:
+		if event.Pressed {
+			bh.deej.dnd.Toggle()
+		}
+
+	case buttonActionHearingSnooze:
+		if event.Pressed {
+			bh.deej.hearing.Snooze()
+		}
+
+	case buttonActionSceneApply:
+		if event.Pressed {
+			bh.deej.ApplyScene(binding.Params["scene"])
+		}
+
+	case buttonActionAlarmCancel:
+		if event.Pressed {
+			bh.deej.alarms.Cancel()
+		}
+
+	case buttonActionOutputNext:
+		if event.Pressed {
+			bh.deej.NextOutputDevice()
+		}
+
+	case buttonActionOutputSet:
+		if event.Pressed {
+			bh.deej.SetOutputDevice(binding.Params["device"])
+		}
+
+	case buttonActionAppRoute:
+		if event.Pressed {
+			bh.deej.CycleAppRoute(binding.Params["app"], strings.Split(binding.Params["device"], ","))
+		}
+
+	case buttonActionFocusHold:
+		bh.deej.focus.handleHoldButton(event, binding)
+
+	default:
+		if event.Pressed {
+			bh.logger.Warnw("Unknown button action", "buttonID", event.ButtonID, "action", binding.Action)
+		}
+	}
+}
+
+// handleMicHold implements both push-to-talk and push-to-mute, in either momentary or toggle mode
+func (bh *buttonHandler) handleMicHold(event ButtonEvent, binding buttonBinding) {
+	if binding.Mode == buttonModeToggle {
+		if event.Pressed {
+			bh.toggleMicMute()
+		}
+
+		return
+	}
+
+	// push-to-talk is live while held, push-to-mute is muted while held
+	mute := !event.Pressed
+	if binding.Action == buttonActionPushToMute {
+		mute = event.Pressed
+	}
+
+	bh.setMicMute(mute)
+}
+
+func (bh *buttonHandler) toggleMicMute() {
+	muted, ok := bh.deej.sessions.getTargetMute(inputSessionName)
+	if !ok {
+		bh.logger.Warn("No input device available, can't toggle mic mute")
+		return
+	}
+
+	bh.setMicMute(!muted)
+}
+
+func (bh *buttonHandler) setMicMute(mute bool) {
+	if !bh.deej.sessions.setTargetMute(inputSessionName, mute) {
+		bh.logger.Warn("No input device available, can't change mic mute state")
+		return
+	}
+
+	bh.logger.Infow("Changed mic mute state", "muted", mute)
+}
+
+// applyIdleMicState mutes the mic if a momentary push-to-talk button is mapped,
+// so that the mic starts out matching the (released) state of the button
+func (bh *buttonHandler) applyIdleMicState() {
+	pushToTalkMapped := false
+
+	bh.deej.config.ButtonMapping.iterate(func(buttonID int, binding buttonBinding) {
+		if binding.Action == buttonActionPushToTalk && binding.Mode == buttonModeMomentary {
+			pushToTalkMapped = true
+		}
+	})
+
+	if pushToTalkMapped {
+		bh.logger.Debug("Momentary push-to-talk mapped, muting mic until the button is held")
+		bh.setMicMute(true)
+	}
+}
@@ -0,0 +1,175 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	maxRawSliderValue = 1023
+
+	// how long the guided calibration records slider extremes for
+	DefaultCalibrationDuration = 20 * time.Second
+)
+
+// sliderCalibration maps the range a slider actually reaches onto a clean 0-100%, for worn pots
+// or ones that don't reach the ends of their travel
+type sliderCalibration struct {
+	RawMin int
+	RawMax int
+
+	// fractions of the calibrated range at either end that snap to 0% and 100%
+	DeadzoneBottom float32
+	DeadzoneTop    float32
+}
+
+var defaultSliderCalibration = sliderCalibration{RawMin: 0, RawMax: maxRawSliderValue}
+
+// apply maps a raw slider value (0-1023) to a scalar between 0 and 1 through the calibration
+func (sc sliderCalibration) apply(raw int) float32 {
+	span := sc.RawMax - sc.RawMin
+	if span <= 0 {
+		return float32(raw) / maxRawSliderValue
+	}
+
+	value := float64(raw-sc.RawMin) / float64(span)
+
+	usable := float64(1 - sc.DeadzoneBottom - sc.DeadzoneTop)
+	if usable > 0 {
+		value = (value - float64(sc.DeadzoneBottom)) / usable
+	}
+
+	return float32(math.Max(0, math.Min(1, value)))
+}
+
+// sliderCalibrationFromConfig reads a slider's calibration object ("min", "max", "deadzone_bottom" and
+// "deadzone_top", the latter two in percent), starting from the given calibration for any missing keys
+func sliderCalibrationFromConfig(fields map[string]interface{}, base sliderCalibration) (sliderCalibration, error) {
+	result := base
+
+	readFloat := func(key string) (float64, bool, error) {
+		value, ok := fields[key]
+		if !ok {
+			return 0, false, nil
+		}
+
+		parsed, err := strconv.ParseFloat(fmt.Sprint(value), 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %s %v: %w", key, value, err)
+		}
+
+		return parsed, true, nil
+	}
+
+	for _, key := range []string{"min", "max", "deadzone_bottom", "deadzone_top"} {
+		value, ok, err := readFloat(key)
+		if err != nil {
+			return base, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "min":
+			result.RawMin = int(math.Max(0, math.Min(maxRawSliderValue, value)))
+		case "max":
+			result.RawMax = int(math.Max(0, math.Min(maxRawSliderValue, value)))
+		case "deadzone_bottom":
+			result.DeadzoneBottom = float32(math.Max(0, math.Min(50, value)) / 100)
+		case "deadzone_top":
+			result.DeadzoneTop = float32(math.Max(0, math.Min(50, value)) / 100)
+		}
+	}
+
+	if result.RawMax <= result.RawMin {
+		return base, fmt.Errorf("max (%d) must be above min (%d)", result.RawMax, result.RawMin)
+	}
+
+	return result, nil
+}
+
+// Calibrate runs the guided slider calibration: it connects to the device, records the extremes each slider
+// actually reaches while the user moves them all the way up and down, and saves them as the sliders' calibration
+func (d *Deej) Calibrate(duration time.Duration) error {
+	logger := d.logger.Named("calibration")
+
+	if err := d.config.Load(); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	subscription := d.serial.SubscribeToRawSliderValues()
+	defer subscription.Close()
+
+	if err := d.serial.Start(); err != nil {
+		return fmt.Errorf("connect to device: %w", err)
+	}
+
+	defer d.serial.Stop()
+
+	fmt.Printf("Move every slider all the way down and all the way up, a few times. Recording for %s...\n", duration)
+
+	minimums := map[int]int{}
+	maximums := map[int]int{}
+	deadline := time.After(duration)
+
+recording:
+	for {
+		select {
+		case <-deadline:
+			break recording
+
+		case rawValues := <-subscription.Values:
+			for sliderIdx, raw := range rawValues {
+				if current, ok := minimums[sliderIdx]; !ok || raw < current {
+					minimums[sliderIdx] = raw
+				}
+
+				if current, ok := maximums[sliderIdx]; !ok || raw > current {
+					maximums[sliderIdx] = raw
+				}
+			}
+		}
+	}
+
+	if len(minimums) == 0 {
+		return fmt.Errorf("no slider values received from the device")
+	}
+
+	calibrations := map[int]sliderCalibration{}
+	sliderIndices := []int{}
+
+	for sliderIdx, minimum := range minimums {
+		sliderIndices = append(sliderIndices, sliderIdx)
+
+		// a slider that barely moved was most likely skipped, so leave it alone rather than saving a useless range
+		if maximums[sliderIdx]-minimum < maxRawSliderValue/4 {
+			logger.Warnw("Slider barely moved during calibration, skipping it", "slider", sliderIdx)
+			continue
+		}
+
+		calibrations[sliderIdx] = sliderCalibration{RawMin: minimum, RawMax: maximums[sliderIdx]}
+	}
+
+	sort.Ints(sliderIndices)
+
+	for _, sliderIdx := range sliderIndices {
+		if calibration, ok := calibrations[sliderIdx]; ok {
+			fmt.Printf("Slider %d: %d - %d\n", sliderIdx, calibration.RawMin, calibration.RawMax)
+		} else {
+			fmt.Printf("Slider %d: skipped (barely moved)\n", sliderIdx)
+		}
+	}
+
+	if err := d.config.SaveSliderCalibrations(calibrations); err != nil {
+		return fmt.Errorf("save calibration: %w", err)
+	}
+
+	fmt.Println("Calibration saved. Any slider_calibration set in your config file still takes precedence.")
+
+	return nil
+}
@@ -0,0 +1,56 @@
+package deej
+
+import (
+	"runtime"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// Capability is an OS-specific feature, and whether this build of deej supports it. each one is implemented in a
+// per-OS file (e.g. media_keys_windows.go), with a no-op fallback (media_keys_other.go) everywhere else. a few are
+// optional instead, and left out of builds made with their tag (e.g. integrations_off.go)
+type Capability struct {
+	Name      string
+	Supported bool
+
+	// what deej does instead when it isn't supported
+	Fallback string
+}
+
+// Capabilities reports which OS-specific and optional features are supported by this build of deej
+func Capabilities() []Capability {
+	return []Capability{
+		{"audio sessions", audioSessionsSupported, "sliders don't control anything"},
+		{"audio peak meter", audioMeterSupported, "led_mode audio tracks running processes instead, and ducking stays off"},
+		{"media keys", mediaKeysSupported, "media button actions do nothing"},
+		{"do not disturb", osDoNotDisturbSupported, "do_not_disturb.sync stays off, and dnd.toggle does nothing"},
+		{"output device switching", outputSwitchSupported, "output.next and output.set do nothing"},
+		{"per-app output devices", appRoutingSupported, "app.route and deej route do nothing"},
+		{"now playing", nowPlayingSupported, "now_playing stays off, and now_playing rows show nothing"},
+		{"lock and idle detection", sleepDetectionSupported, "sleep stays off, and the device never sleeps"},
+		{"sound files", soundFilesSupported, "alarms go off silently"},
+		{"USB HID devices", hidDevicesSupported, "devices with hid IDs can't connect, only serial and network ones"},
+		{"hotplug notifications", hotplugSupported, "devices plugged in later are found by reconnect polling, every 5-30 seconds"},
+		{"start at login", autostartSupported, "--autostart does nothing, add deej to the desktop's startup apps by hand"},
+		{"Windows service", serviceSupported, "deej service does nothing, leave starting at boot to the system"},
+		{"terminal UI keys", tuiKeyModeSupported, "--tui takes a key at a time followed by Enter"},
+		{"focused window", util.ForegroundWindowSupported, "deej.current targets don't control anything"},
+		{"window titles and product names", util.WindowIdentitySupported, "title: and product: targets don't match anything"},
+		{"integrations", integrationsSupported, "built with deej_nointegrations, so weather and calendar pages, push_alerts and webhooks stay off"},
+		{"web pages", webUISupported, "built with deej_noweb, so /dashboard and /console only say they're missing"},
+	}
+}
+
+// logCapabilities lists the features this build doesn't support, so that their absence is never a mystery
+func logCapabilities(logger *zap.SugaredLogger) {
+	for _, capability := range Capabilities() {
+		if !capability.Supported {
+			logger.Infow("Feature not supported by this build",
+				"os", runtime.GOOS,
+				"feature", capability.Name,
+				"fallback", capability.Fallback)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package deej
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// chaosSettings say which faults --chaos injects into what's read from the device, and how often
+type chaosSettings struct {
+
+	// how long every line is held up before it's handled, plus up to jitter more
+	delay  time.Duration
+	jitter time.Duration
+
+	// the chance (0-1) of each line being dropped, handled twice, or garbled
+	drop      float64
+	duplicate float64
+	corrupt   float64
+
+	// drop the connection after every this many lines, to exercise reconnecting
+	disconnectEvery int
+
+	seed int64
+}
+
+// serialChaos injects faults into the lines read from the device, so that reconnection, backpressure and noise
+// handling can be exercised on purpose. the faults come from a seeded random source, so a run with the same seed
+// (and the same lines) gets the same faults in the same places
+type serialChaos struct {
+	deej     *Deej
+	logger   *zap.SugaredLogger
+	settings chaosSettings
+
+	lock   sync.Mutex
+	random *rand.Rand
+	lines  int
+}
+
+// SetChaos has deej inject faults into what it reads from the device, if called before Initialize. the spec is a
+// comma-separated list of delay=<duration>, jitter=<duration>, drop=<0-1>, duplicate=<0-1>, corrupt=<0-1>,
+// disconnect=<lines> and seed=<number> (picked from the clock if not set), e.g. "drop=0.05,delay=20ms,seed=42"
+func (d *Deej) SetChaos(spec string) error {
+	settings, err := parseChaosSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	if settings.seed == 0 {
+		settings.seed = time.Now().UnixNano()
+	}
+
+	d.chaos = &serialChaos{
+		deej:     d,
+		logger:   d.logger.Named("chaos"),
+		settings: settings,
+		random:   rand.New(rand.NewSource(settings.seed)),
+	}
+
+	d.logger.Warnw("Injecting faults into device traffic, pass the same seed to repeat them",
+		"delay", settings.delay,
+		"jitter", settings.jitter,
+		"drop", settings.drop,
+		"duplicate", settings.duplicate,
+		"corrupt", settings.corrupt,
+		"disconnectEvery", settings.disconnectEvery,
+		"seed", settings.seed)
+
+	return nil
+}
+
+func parseChaosSpec(spec string) (chaosSettings, error) {
+	settings := chaosSettings{}
+
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		equals := strings.Index(part, "=")
+		if equals == -1 {
+			return chaosSettings{}, fmt.Errorf("chaos setting %q isn't key=value", part)
+		}
+
+		key, value := strings.ToLower(part[:equals]), part[equals+1:]
+
+		var err error
+		switch key {
+		case "delay":
+			settings.delay, err = time.ParseDuration(value)
+		case "jitter":
+			settings.jitter, err = time.ParseDuration(value)
+		case "drop":
+			settings.drop, err = parseChaosChance(value)
+		case "duplicate":
+			settings.duplicate, err = parseChaosChance(value)
+		case "corrupt":
+			settings.corrupt, err = parseChaosChance(value)
+		case "disconnect":
+			settings.disconnectEvery, err = strconv.Atoi(value)
+		case "seed":
+			settings.seed, err = strconv.ParseInt(value, 10, 64)
+		default:
+			return chaosSettings{}, fmt.Errorf("unknown chaos setting %q", key)
+		}
+
+		if err != nil {
+			return chaosSettings{}, fmt.Errorf("chaos setting %s: %w", key, err)
+		}
+	}
+
+	if settings.delay < 0 || settings.jitter < 0 || settings.disconnectEvery < 0 {
+		return chaosSettings{}, fmt.Errorf("chaos delays and disconnect can't be negative")
+	}
+
+	return settings, nil
+}
+
+func parseChaosChance(value string) (float64, error) {
+	chance, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	if chance < 0 || chance > 1 {
+		return 0, fmt.Errorf("%v isn't between 0 and 1", chance)
+	}
+
+	return chance, nil
+}
+
+// apply works out what becomes of a line read from the device: the lines to handle in its place (none if it's
+// dropped), and whether to drop the connection after them. any delay is slept off here, in the reading goroutine,
+// so that it backs up the reads like a slow consumer would. without --chaos, lines go through as they are
+func (sc *serialChaos) apply(line string) ([]string, bool) {
+	if sc == nil {
+		return []string{line}, false
+	}
+
+	sc.lock.Lock()
+	settings := sc.settings
+
+	sc.lines++
+	disconnect := settings.disconnectEvery > 0 && sc.lines%settings.disconnectEvery == 0
+
+	// every roll happens for every line, so that one fault being turned off doesn't move the others around
+	delay := settings.delay
+	if jitterRoll := sc.random.Int63(); settings.jitter > 0 {
+		delay += time.Duration(jitterRoll % int64(settings.jitter))
+	}
+
+	drop := sc.random.Float64() < settings.drop
+	duplicate := sc.random.Float64() < settings.duplicate
+	corrupt := sc.random.Float64() < settings.corrupt
+	corruptAt := sc.random.Intn(len(line) + 1)
+	corruptWith := byte(sc.random.Intn(95) + ' ')
+	sc.lock.Unlock()
+
+	if delay > 0 {
+		<-time.After(delay)
+	}
+
+	if disconnect {
+		sc.logger.Infow("Dropping the connection", "afterLines", settings.disconnectEvery)
+	}
+
+	if drop {
+		if sc.deej.Verbose() {
+			sc.logger.Debugw("Dropped line", "line", line)
+		}
+
+		return nil, disconnect
+	}
+
+	if corrupt && len(line) > 0 {
+		garbled := []byte(line)
+		garbled[corruptAt%len(line)] = corruptWith
+
+		if sc.deej.Verbose() {
+			sc.logger.Debugw("Garbled line", "line", line, "garbled", string(garbled))
+		}
+
+		line = string(garbled)
+	}
+
+	if duplicate {
+		if sc.deej.Verbose() {
+			sc.logger.Debugw("Duplicated line", "line", line)
+		}
+
+		return []string{line, line}, disconnect
+	}
+
+	return []string{line}, disconnect
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/omriharel/deej/pkg/deej"
 )
@@ -14,21 +16,111 @@ var (
 
 	verbose   bool
 	logFilter string
+	logFormat string
+	logSink   string
 	cliMode   bool
+	tuiMode   bool
+	profile   string
+	calibrate bool
+	diagnose  bool
+	selfTest  bool
+	soak      time.Duration
+	record    string
+	chaos     string
+	replay    string
+
+	capabilities bool
+	safeMode     bool
+	simulate     bool
+
+	autostart   bool
+	noAutostart bool
+	autostarted bool
 )
 
+// the flags worth starting at login with, by what they're called (shorthands included), passed through by
+// --autostart and the tray's start at login item
+var startupFlags = map[string]string{
+	"verbose":    "verbose",
+	"v":          "verbose",
+	"log-filter": "log-filter",
+	"f":          "log-filter",
+	"log-format": "log-format",
+	"log-sink":   "log-sink",
+	"cli":        "cli",
+	"tui":        "tui",
+	"profile":    "profile",
+}
+
 func init() {
 	flag.BoolVar(&verbose, "verbose", false, "show verbose logs (useful for debugging)")
 	flag.BoolVar(&verbose, "v", false, "shorthand for --verbose")
 	flag.StringVar(&logFilter, "log-filter", "", "filter logs by component (e.g., 'audio-meter', 'serial', 'process-monitor')")
 	flag.StringVar(&logFilter, "f", "", "shorthand for --log-filter")
+	flag.StringVar(&logFormat, "log-format", deej.LogFormatConsole, "log as readable lines (console) or JSON objects for tools to ingest (json)")
+	flag.StringVar(&logSink, "log-sink", "", "also send every log entry to tcp://host:port (a line each) or udp://host:port (a datagram each)")
 	flag.BoolVar(&cliMode, "cli", false, "run in CLI mode (no tray icon, exits on Ctrl+C)")
+	flag.BoolVar(&tuiMode, "tui", false, "show live sliders, audio levels, connection state and logs in the terminal, with keys to reconnect and switch profiles (implies --cli)")
+	flag.StringVar(&profile, "profile", "", "start with the given slider mapping profile (as named under 'profiles' in the config)")
+	flag.BoolVar(&calibrate, "calibrate", false, "record each slider's actual range and save it as its calibration, then exit")
+	flag.BoolVar(&selfTest, "self-test", false, "check newly assembled hardware: cycle the LEDs, show a test page on the display, have you move every slider and press every button, and report what passed, then exit")
+	flag.BoolVar(&diagnose, "diagnose", false, "collect system info, serial ports, a few seconds of device traffic, the config (secrets left out), audio sessions and recent logs into a zip for support requests, then exit")
+	flag.DurationVar(&soak, "soak", 0, "run a soak test against simulated sliders and audio sessions for the given duration (e.g. 2h), report the results and exit")
+	flag.StringVar(&record, "record", "", "record device traffic, audio sessions and LED/volume commands to the given file, for replaying with --replay")
+	flag.StringVar(&chaos, "chaos", "", "inject faults into device traffic for robustness testing, e.g. \"delay=20ms,jitter=50ms,drop=0.05,duplicate=0.02,corrupt=0.01,disconnect=500,seed=42\"")
+	flag.StringVar(&replay, "replay", "", "replay a recording made with --record and check that the same LED and volume commands come out, then exit")
+	flag.BoolVar(&capabilities, "capabilities", false, "list which platform-specific features this build supports, then exit")
+	flag.BoolVar(&safeMode, "safe-mode", false, "start without integrations, audio metering and the API (deej does this by itself after repeated crashes)")
+	flag.BoolVar(&simulate, "simulate", false, "talk to a simulated device that moves its own sliders and presses its own buttons, logging what deej sends it (for development without hardware)")
+	flag.BoolVar(&autostart, "autostart", false, "start deej when you log in, with the other flags given alongside this one (e.g. --cli or --verbose), then exit")
+	flag.BoolVar(&noAutostart, "no-autostart", false, "stop deej from starting when you log in, then exit")
+	flag.BoolVar(&autostarted, "autostarted", false, "set by the start at login entry, to find the config next to deej wherever it's started from")
 	flag.Parse()
 }
 
+// startupArgs returns the flags given to deej that it should start at login with too
+func startupArgs() []string {
+	var args []string
+	seen := map[string]bool{}
+
+	flag.Visit(func(f *flag.Flag) {
+		name, ok := startupFlags[f.Name]
+		if !ok || seen[name] {
+			return
+		}
+
+		seen[name] = true
+
+		// bool flags are only ever set to true here, as nothing defaults to true
+		if _, isBool := f.Value.(interface{ IsBoolFlag() bool }); isBool {
+			args = append(args, "--"+name)
+		} else {
+			args = append(args, fmt.Sprintf("--%s=%s", name, f.Value.String()))
+		}
+	})
+
+	return args
+}
+
 func main() {
-	// Create logger with optional filtering
-	logger, err := deej.NewLoggerWithFilter(buildType, logFilter)
+	// services start in System32, so this has to come before anything looks for the config or writes logs
+	runningAsService, err := deej.PrepareService()
+	if err != nil {
+		panic(fmt.Sprintf("Failed to prepare service: %v", err))
+	}
+
+	// logins start deej wherever they like, so the same goes for them
+	if err = deej.PrepareAutostart(autostarted); err != nil {
+		panic(fmt.Sprintf("Failed to prepare for starting at login: %v", err))
+	}
+
+	// Create logger with optional filtering, logging into the terminal UI if there is one
+	logger, err := deej.NewLoggerWithOptions(buildType, deej.LoggerOptions{
+		Filter: logFilter,
+		TUI:    tuiMode,
+		Format: logFormat,
+		Sink:   logSink,
+	})
 	if err != nil {
 		panic(fmt.Sprintf("Failed to create logger: %v", err))
 	}
@@ -49,14 +141,210 @@ func main() {
 		named.Infow("Log filter active", "filter", logFilter)
 	}
 
-	// Create the deej instance
-	d, err := deej.NewDeej(logger, verbose)
-	if err != nil {
-		named.Fatalw("Failed to create deej object", "error", err)
+	if logSink != "" {
+		named.Infow("Sending logs to sink", "sink", logSink, "format", logFormat)
 	}
 
-	if cliMode {
-		d.SetCLIMode(true)
+	// Show the running instance's recent events instead of starting, for "deej events"
+	if flag.Arg(0) == "events" {
+		eventsFlags := flag.NewFlagSet("events", flag.ExitOnError)
+		tail := eventsFlags.Bool("tail", false, "keep printing new events as they happen")
+		count := eventsFlags.Int("count", 20, "how many recent events to show (0 for all of them)")
+		eventsFlags.Parse(flag.Args()[1:])
+
+		if err = deej.TailEvents(named, os.Stdout, *count, *tail); err != nil {
+			named.Fatalw("Failed to get events", "error", err)
+		}
+
+		return
+	}
+
+	// Draw the running instance's audio levels instead of starting, for "deej meter"
+	if flag.Arg(0) == "meter" {
+		meterFlags := flag.NewFlagSet("meter", flag.ExitOnError)
+		rate := meterFlags.Float64("rate", 10, "how many times a second to redraw the levels, at most")
+		sliders := meterFlags.String("sliders", "", "only show these sliders (e.g. 0,2-4)")
+		meterFlags.Parse(flag.Args()[1:])
+
+		if err = deej.ShowMeter(named, os.Stdout, *rate, *sliders); err != nil {
+			named.Fatalw("Failed to show meter", "error", err)
+		}
+
+		return
+	}
+
+	// Send an app to another output device instead of starting, for "deej route <app> <device>"
+	if flag.Arg(0) == "route" {
+		if flag.NArg() != 3 {
+			named.Fatal("Usage: deej route <app> <device name, pattern or \"default\">")
+		}
+
+		if err = deej.RouteApp(named, os.Stdout, flag.Arg(1), flag.Arg(2)); err != nil {
+			named.Fatalw("Failed to route app", "error", err)
+		}
+
+		return
+	}
+
+	// Switch the running instance's profile instead of starting, for "deej profile <name>" (or list them without one)
+	if flag.Arg(0) == "profile" {
+		switch flag.NArg() {
+		case 1:
+			err = deej.ListProfiles(named, os.Stdout)
+		case 2:
+			err = deej.SwitchRunningProfile(named, os.Stdout, flag.Arg(1))
+		default:
+			named.Fatal("Usage: deej profile [name]")
+		}
+
+		if err != nil {
+			named.Fatalw("Failed to manage profiles", "error", err)
+		}
+
+		return
+	}
+
+	// Update a network-connected device's firmware instead of starting, for "deej flash <device> <firmware>"
+	if flag.Arg(0) == "flash" {
+		flashFlags := flag.NewFlagSet("flash", flag.ExitOnError)
+		pull := flashFlags.Bool("pull", false, "have the device download the firmware from the given URL itself")
+		flashFlags.Parse(flag.Args()[1:])
+
+		if flashFlags.NArg() != 2 {
+			named.Fatal("Usage: deej flash [--pull] <device address> <firmware .bin file or URL>")
+		}
+
+		if err = deej.FlashFirmware(named, os.Stdout, flashFlags.Arg(0), flashFlags.Arg(1), *pull); err != nil {
+			named.Fatalw("Failed to flash firmware", "error", err)
+		}
+
+		return
+	}
+
+	// Let go of the device so new firmware can be uploaded, for "deej release"
+	if flag.Arg(0) == "release" {
+		releaseFlags := flag.NewFlagSet("release", flag.ExitOnError)
+		reset := releaseFlags.String("reset", "", "reset the board into its bootloader: none, dtr or 1200 (default: upload_reset from the config)")
+		releaseFlags.Parse(flag.Args()[1:])
+
+		if err = deej.ReleaseForUpload(named, os.Stdin, os.Stdout, *reset); err != nil {
+			named.Fatalw("Failed to release device", "error", err)
+		}
+
+		return
+	}
+
+	// Pair the connected device with the running deej instead of starting, for "deej pair"
+	if flag.Arg(0) == "pair" {
+		pairFlags := flag.NewFlagSet("pair", flag.ExitOnError)
+		forget := pairFlags.String("forget", "", "forget the pairing with the device with this ID")
+		pairFlags.Parse(flag.Args()[1:])
+
+		if *forget != "" {
+			err = deej.UnpairDevice(named, os.Stdout, *forget)
+		} else {
+			err = deej.PairDevice(named, os.Stdin, os.Stdout)
+		}
+
+		if err != nil {
+			named.Fatalw("Failed to pair device", "error", err)
+		}
+
+		return
+	}
+
+	// Install or control deej as a Windows service instead of starting, for "deej service install|uninstall|start|stop"
+	if flag.Arg(0) == "service" {
+		if flag.NArg() != 2 {
+			named.Fatal("Usage: deej service install|uninstall|start|stop")
+		}
+
+		if err = deej.ManageService(named, os.Stdout, flag.Arg(1)); err != nil {
+			named.Fatalw("Failed to manage service", "error", err)
+		}
+
+		return
+	}
+
+	// Add or remove the start at login entry instead of starting, if asked to
+	if autostart || noAutostart {
+		if err = deej.SetAutostart(named, os.Stdout, autostart, startupArgs()); err != nil {
+			named.Fatalw("Failed to change starting at login", "error", err)
+		}
+
+		return
+	}
+
+	// Manage guest tokens for the running deej's API, for "deej token create|list|revoke"
+	if flag.Arg(0) == "token" {
+		tokenFlags := flag.NewFlagSet("token", flag.ExitOnError)
+		scope := tokenFlags.String("scope", "read", "what the token can do: read, control or admin")
+		expires := tokenFlags.Duration("expires", 24*time.Hour, "how long the token lasts (e.g. 4h)")
+		tokenFlags.Parse(flag.Args()[1:])
+
+		switch tokenFlags.Arg(0) {
+		case "create":
+			if tokenFlags.NArg() != 2 {
+				named.Fatal("Usage: deej token [--scope read|control|admin] [--expires 24h] create <name>")
+			}
+
+			err = deej.CreateAPIToken(named, os.Stdout, tokenFlags.Arg(1), *scope, *expires)
+		case "list":
+			err = deej.ListAPITokens(named, os.Stdout)
+		case "revoke":
+			if tokenFlags.NArg() != 2 {
+				named.Fatal("Usage: deej token revoke <id>")
+			}
+
+			err = deej.RevokeAPIToken(named, os.Stdout, tokenFlags.Arg(1))
+		default:
+			named.Fatal("Usage: deej token create|list|revoke")
+		}
+
+		if err != nil {
+			named.Fatalw("Failed to manage API tokens", "error", err)
+		}
+
+		return
+	}
+
+	// List the platform-specific features instead of starting normally, if asked to
+	if capabilities {
+		for _, capability := range deej.Capabilities() {
+			if capability.Supported {
+				fmt.Printf("%-32s supported\n", capability.Name)
+			} else {
+				fmt.Printf("%-32s not supported - %s\n", capability.Name, capability.Fallback)
+			}
+		}
+
+		return
+	}
+
+	// Soak test against simulated hardware instead of starting normally, if asked to
+	if soak > 0 {
+		if err = deej.RunSoakTest(logger, soak); err != nil {
+			named.Fatalw("Soak test failed", "error", err)
+		}
+
+		return
+	}
+
+	// Replay a traffic recording instead of starting normally, if asked to
+	if replay != "" {
+		if err = deej.ReplayTraffic(logger, replay); err != nil {
+			named.Fatalw("Replay didn't match the recording", "error", err)
+		}
+
+		return
+	}
+
+	options := []deej.Option{
+		deej.WithVerbose(verbose),
+		deej.WithProfile(profile),
+		deej.WithSafeMode(safeMode),
+		deej.WithSimulatedDevice(simulate),
+		deej.WithStartupArgs(startupArgs()),
 	}
 
 	// Set version info for tray display if provided by build process
@@ -65,7 +353,72 @@ func main() {
 		if versionTag != "" {
 			identifier = versionTag
 		}
-		d.SetVersion(fmt.Sprintf("Version %s-%s", buildType, identifier))
+		options = append(options, deej.WithVersion(fmt.Sprintf("Version %s-%s", buildType, identifier)))
+	}
+
+	// Create the deej instance
+	d, err := deej.New(logger, options...)
+	if err != nil {
+		named.Fatalw("Failed to create deej object", "error", err)
+	}
+
+	if cliMode || tuiMode {
+		d.SetCLIMode(true)
+	}
+
+	if tuiMode {
+		d.SetTUIMode(true)
+	}
+
+	if record != "" {
+		if err = d.SetTrafficRecording(record); err != nil {
+			named.Fatalw("Failed to start recording traffic", "error", err)
+		}
+	}
+
+	if chaos != "" {
+		if err = d.SetChaos(chaos); err != nil {
+			named.Fatalw("Invalid --chaos settings", "error", err)
+		}
+	}
+
+	// Run under the service manager until it stops us, if it started us
+	if runningAsService {
+		if err = d.RunService(); err != nil {
+			named.Fatalw("Failed to run as a service", "error", err)
+		}
+
+		return
+	}
+
+	// Run the guided calibration instead of starting normally, if asked to
+	if calibrate {
+		if err = d.Calibrate(deej.DefaultCalibrationDuration); err != nil {
+			named.Fatalw("Failed to calibrate sliders", "error", err)
+		}
+
+		return
+	}
+
+	// Walk through checking the hardware instead of starting normally, if asked to
+	if selfTest {
+		if err = d.SelfTest(deej.DefaultSelfTestStepTimeout); err != nil {
+			named.Fatalw("Self-test failed", "error", err)
+		}
+
+		return
+	}
+
+	// Collect diagnostics for a support request instead of starting normally, if asked to
+	if diagnose {
+		path, err := d.Diagnose(deej.DefaultDiagnosticsCapture)
+		if err != nil {
+			named.Fatalw("Failed to collect diagnostics", "error", err)
+		}
+
+		fmt.Printf("Saved diagnostics to %s, attach it to your support request (secrets are left out, but have a look first)\n", path)
+
+		return
 	}
 
 	// Start deej
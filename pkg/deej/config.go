@@ -2,14 +2,20 @@ package deej
 
 import (
 	"fmt"
+	"math"
+	"net"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 
+	"github.com/omriharel/deej/pkg/deej/protocol"
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
@@ -17,26 +23,120 @@ import (
 // as well as loading/file watching logic for deej's configuration file
 type CanonicalConfig struct {
 	SliderMapping *sliderMap
+	ButtonMapping *buttonMap
+	SliderCurves  map[int]sliderCurve
+
+	// sliders worked out from the physical ones, by the slider ID they drive (see virtual_sliders.go)
+	VirtualSliders map[int]virtualSlider
+
+	// per-slider raw ranges and deadzones, from the user config or the guided calibration
+	SliderCalibrations map[int]sliderCalibration
+	SliderSmoothing    map[int]sliderSmoothing
+
+	// per-slider refinements of deej.unmapped
+	SliderUnmapped map[int]unmappedGroup
+
+	// sliders that only move the loudest or most recent of their apps, by slider ID (see slider_sessions.go)
+	SliderSessions map[int]string
+
+	// what slider moves do to targets that aren't running, by target
+	NotRunning map[string]notRunningRule
+
+	// every profile's slider mapping (including the default one), and the name of the one in use
+	Profiles      map[string]*sliderMap
+	ActiveProfile string
+
+	// named devices, and the ones each profile runs on (profiles without any use com_port)
+	Devices        map[string]deviceConnection
+	DeviceBindings map[string]deviceBinding
 
 	ConnectionInfo struct {
 		COMPort  string
 		BaudRate int
+
+		// "serial", or "mock" for a simulated device (see mock_device.go)
+		Transport string
+
+		// finds the device by its ID (see device_identity.go) instead of by com_port
+		DeviceID string
+
+		// connections to try in order instead of the above, if set (see device_binding.go)
+		Chain []deviceConnection
 	}
 
-	InvertSliders bool
+	// sliders to invert (i.e. top is 0%, bottom is 100%)
+	InvertSliders sliderSet
+
+	// the audio backend sliders control (see backend.go)
+	Backend backendConfig
+
+	// how lines to and from the device are framed, for devices that can do more than text (see serial_framing.go)
+	SerialFraming string
+
+	// how to reset the board after releasing it for a firmware upload (see firmware_upload.go)
+	UploadReset string
 
 	NoiseReductionLevel string
 	LEDRefreshInterval  time.Duration
 	LEDMode             string
 
+	// how each slider's LED combines its targets, by slider ID (see led_aggregation.go)
+	LEDAggregation map[int]string
+
+	// converts text sent to the device's display into a charset it can render
+	DisplayEncoder *displayTextEncoder
+	DisplayScreens displayScreensConfig
+
+	DisplayPages      displayPagesConfig
+	Timer             focusTimerConfig
+	DoNotDisturb      dndConfig
+	Focus             focusConfig
+	Scenes            map[string]sceneConfig
+	Automation        automationConfig
+	Fades             fadeConfig
+	Ducking           duckingConfig
+	PriorityClasses   []priorityClass
+	DSP               map[string]dspParameter
+	PushAlerts        pushAlertsConfig
+	Webhooks          []webhookConfig
+	LogShipping       logShippingConfig
+	LogFiles          logFilesConfig
+	API               apiConfig
+	OutputSwitch      outputSwitchConfig
+	LaunchSync        launchSyncConfig
+	NowPlaying        nowPlayingConfig
+	Sleep             sleepConfig
+	UsageStats        usageStatsConfig
+	HearingProtection hearingProtectionConfig
+	QuietHours        quietHoursConfig
+	Heartbeat         heartbeatConfig
+	JitterBuffer      jitterBufferConfig
+	LEDColors         ledColorsConfig
+	LEDAnimation      ledAnimationConfig
+	VUMeter           vuMeterConfig
+
+	// how many recent events to keep for deej events and the API
+	EventLogSize int
+
 	logger             *zap.SugaredLogger
 	notifier           Notifier
 	stopWatcherChannel chan bool
 
-	reloadConsumers []chan bool
+	reloads *eventTopic
+
+	// where config.yaml's include looks for files, and which file each top-level section last came from
+	includePatterns  []string
+	includedSections map[string]string
 
 	userConfig     *viper.Viper
 	internalConfig *viper.Viper
+
+	// the user config as it's written, before expandConfigValues filled in this machine's environment variables
+	// and home directory. it's what the dashboard edits, so that saving keeps the placeholders
+	unexpandedConfig *viper.Viper
+
+	// leaves out integrations, metering and the API, whatever the config says (see safe_mode.go)
+	safeMode bool
 }
 
 const (
@@ -51,18 +151,172 @@ const (
 	configType = "yaml"
 
 	configKeySliderMapping       = "slider_mapping"
+	configKeyProfiles            = "profiles"
+	configKeyDevices             = "devices"
+	configKeyProfileDevices      = "devices"    // under a profile, the named devices it runs on
+	configKeyProfileSliderIDs    = "slider_ids" // under a profile, which slider IDs each device's sliders drive
+	configKeyButtonMapping       = "button_mapping"
+	configKeySliderCurves        = "slider_curves"
+	configKeyVirtualSliders      = "virtual_sliders"
+	configKeySliderCalibration   = "slider_calibration"
+	configKeySliderSmoothing     = "slider_smoothing"
+	configKeySliderUnmapped      = "slider_unmapped"
+	configKeySliderSessions      = "slider_sessions"
+	configKeyNotRunning          = "not_running"
 	configKeyInvertSliders       = "invert_sliders"
 	configKeyCOMPort             = "com_port"
 	configKeyBaudRate            = "baud_rate"
+	configKeyDeviceID            = "device_id"
+	configKeyTransport           = "transport"
+	configKeyConnectionInfo      = "connection_info"
 	configKeyNoiseReductionLevel = "noise_reduction"
+	configKeyBackend             = "backend"
+	configKeyBackendServer       = "backend_server"
 	configKeyLEDRefreshInterval  = "led_refresh_interval"
 	configKeyLEDMode             = "led_mode"
+	configKeyLEDAggregation      = "led_aggregation"
+	configKeyDisplayCharset      = "display_charset"
+	configKeySerialFraming       = "serial_framing"
+	configKeyUploadReset         = "upload_reset"
+	configKeyTransliterations    = "transliterations"
+
+	configKeyDisplayScreenInterval        = "display_screens.interval"
+	configKeyDisplayScreenRefreshInterval = "display_screens.refresh_interval"
+	configKeyDisplayScreens               = "display_screens.screens"
+
+	configKeyDisplayPageInterval    = "display_pages.interval"
+	configKeyWeatherEnabled         = "display_pages.weather.enabled"
+	configKeyWeatherAPIKey          = "display_pages.weather.api_key"
+	configKeyWeatherLocation        = "display_pages.weather.location"
+	configKeyWeatherUnits           = "display_pages.weather.units"
+	configKeyWeatherRefreshMinutes  = "display_pages.weather.refresh_minutes"
+	configKeyCalendarEnabled        = "display_pages.calendar.enabled"
+	configKeyCalendarURL            = "display_pages.calendar.url"
+	configKeyCalendarRefreshMinutes = "display_pages.calendar.refresh_minutes"
+
+	configKeyTimerFocusMinutes          = "timer.focus_minutes"
+	configKeyTimerBreakMinutes          = "timer.break_minutes"
+	configKeyTimerLongBreakMinutes      = "timer.long_break_minutes"
+	configKeyTimerCyclesBeforeLongBreak = "timer.cycles_before_long_break"
+	configKeyTimerMuteDuringFocus       = "timer.mute_during_focus"
+
+	configKeyScenes = "scenes"
+	configKeyDSP    = "dsp"
+
+	configKeyFadeDuration = "fades.duration"
+	configKeyFadeEasing   = "fades.easing"
+
+	configKeyAutomationSchedule        = "automation.schedule"
+	configKeyAutomationTimezone        = "automation.timezone"
+	configKeyAutomationOverrideMinutes = "automation.override_minutes"
+
+	configKeyDuckingEnabled   = "ducking.enabled"
+	configKeyDuckingPriority  = "ducking.priority"
+	configKeyDuckingTargets   = "ducking.targets"
+	configKeyDuckingThreshold = "ducking.threshold"
+	configKeyDuckingAmountDB  = "ducking.amount_db"
+	configKeyDuckingRelease   = "ducking.release"
+
+	configKeyPriorityClasses = "priority_classes"
+
+	configKeyProcessNames = "process_names"
+
+	configKeyPushEnabled            = "push_alerts.enabled"
+	configKeyPushService            = "push_alerts.service"
+	configKeyPushNtfyServer         = "push_alerts.ntfy.server"
+	configKeyPushNtfyTopic          = "push_alerts.ntfy.topic"
+	configKeyPushPushoverToken      = "push_alerts.pushover.token"
+	configKeyPushPushoverUser       = "push_alerts.pushover.user"
+	configKeyPushWebhookURL         = "push_alerts.webhook.url"
+	configKeyPushDeviceDisconnected = "push_alerts.device_disconnected"
+	configKeyPushMicHotMinutes      = "push_alerts.mic_hot_minutes"
+
+	configKeyWebhooks = "webhooks"
+
+	configKeyLogShippingEnabled      = "log_shipping.enabled"
+	configKeyLogShippingProtocol     = "log_shipping.protocol"
+	configKeyLogShippingAddress      = "log_shipping.address"
+	configKeyLogShippingLevel        = "log_shipping.level"
+	configKeyLogShippingBatchSize    = "log_shipping.batch_size"
+	configKeyLogShippingFlushSeconds = "log_shipping.flush_seconds"
+	configKeyLogShippingHostname     = "log_shipping.hostname"
+	configKeyLogShippingRedact       = "log_shipping.redact"
+
+	configKeyLogFilesMaxSizeMB  = "log_files.max_size_mb"
+	configKeyLogFilesKeep       = "log_files.keep"
+	configKeyLogFilesMaxAgeDays = "log_files.max_age_days"
+
+	configKeyDNDSync         = "do_not_disturb.sync"
+	configKeyDNDPollSeconds  = "do_not_disturb.poll_seconds"
+	configKeyDNDProfile      = "do_not_disturb.profile"
+	configKeyDNDQuietVolumes = "do_not_disturb.quiet_volumes"
+
+	configKeyFocusMode         = "focus_follows.mode"
+	configKeyFocusPollInterval = "focus_follows.poll_interval"
+	configKeyFocusExclude      = "focus_follows.exclude"
+
+	configKeyLaunchSyncEnabled      = "launch_sync.enabled"
+	configKeyLaunchSyncPollInterval = "launch_sync.poll_interval"
+
+	configKeyNowPlayingEnabled       = "now_playing.enabled"
+	configKeyNowPlayingPollInterval  = "now_playing.poll_interval"
+	configKeyNowPlayingShowOnDisplay = "now_playing.show_on_display"
+
+	configKeySleepOnLock      = "sleep.on_lock"
+	configKeySleepOnIdle      = "sleep.on_idle"
+	configKeySleepIdleMinutes = "sleep.idle_minutes"
+
+	configKeyUsageStatsEnabled       = "usage_stats.enabled"
+	configKeyUsageStatsWeeklySummary = "usage_stats.weekly_summary"
+
+	configKeyHearingEnabled       = "hearing_protection.enabled"
+	configKeyHearingLevel         = "hearing_protection.level"
+	configKeyHearingMinutes       = "hearing_protection.minutes"
+	configKeyHearingLimitTo       = "hearing_protection.limit_to"
+	configKeyHearingSnoozeMinutes = "hearing_protection.snooze_minutes"
+
+	configKeyQuietHoursEnabled  = "quiet_hours.enabled"
+	configKeyQuietHoursFrom     = "quiet_hours.from"
+	configKeyQuietHoursTo       = "quiet_hours.to"
+	configKeyQuietHoursDays     = "quiet_hours.days"
+	configKeyQuietHoursMaster   = "quiet_hours.master"
+	configKeyQuietHoursApps     = "quiet_hours.apps"
+	configKeyQuietHoursLEDTheme = "quiet_hours.led_theme"
+
+	configKeyHeartbeatInterval = "heartbeat.interval_seconds"
+	configKeyHeartbeatSilence  = "heartbeat.silence_seconds"
+
+	configKeyJitterBufferMax = "jitter_buffer.max_ms"
+
+	configKeyLEDColorMode    = "led_colors.mode"
+	configKeyLEDColorTheme   = "led_colors.theme"
+	configKeyLEDColorThemes  = "led_colors.themes"
+	configKeyLEDColorTargets = "led_colors.targets"
+
+	configKeyLEDAnimationEffect      = "led_animation.effect"
+	configKeyLEDAnimationIdleMinutes = "led_animation.idle_minutes"
+	configKeyLEDAnimationCycleTime   = "led_animation.cycle_time"
+
+	configKeyVUMeterEnabled  = "vu_meter.enabled"
+	configKeyVUMeterSegments = "vu_meter.segments"
+
+	configKeyOutputSwitchDevices       = "output_switch.devices"
+	configKeyOutputSwitchShowOnDisplay = "output_switch.show_on_display"
+
+	configKeyAPIEnabled   = "api.enabled"
+	configKeyAPIAddress   = "api.address"
+	configKeyAPIPort      = "api.port"
+	configKeyAPIMetrics   = "api.metrics"
+	configKeyEventLogSize = "event_log.size"
 
 	defaultCOMPort           = "auto"
 	defaultBaudRate          = 9600
 	defaultLEDRefreshSeconds = 5
 	defaultLEDMode           = "process"
 
+	// the top-level slider_mapping is always available as a profile by this name
+	defaultProfileName = "default"
+
 	// LED mode constants
 	LEDModeProcess = "process" // LED on when process is running
 	LEDModeAudio   = "audio"   // LED on when process is outputting audio
@@ -78,14 +332,22 @@ var defaultSliderMapping = func() *sliderMap {
 	return emptyMap
 }()
 
+// matches the original hard-wired behavior of the 3 media buttons
+var defaultButtonMapping = map[string]interface{}{
+	"0": buttonActionPlayPause,
+	"1": buttonActionPrevTrack,
+	"2": buttonActionNextTrack,
+}
+
 // NewConfig creates a config instance for the deej object and sets up viper instances for deej's config files
 func NewConfig(logger *zap.SugaredLogger, notifier Notifier) (*CanonicalConfig, error) {
 	logger = logger.Named("config")
 
 	cc := &CanonicalConfig{
+		ActiveProfile:      defaultProfileName,
 		logger:             logger,
 		notifier:           notifier,
-		reloadConsumers:    []chan bool{},
+		reloads:            newEventTopic(logger, "config reloads", true, dropOldest, stateBufferSize),
 		stopWatcherChannel: make(chan bool),
 	}
 
@@ -96,11 +358,104 @@ func NewConfig(logger *zap.SugaredLogger, notifier Notifier) (*CanonicalConfig,
 	userConfig.AddConfigPath(userConfigPath)
 
 	userConfig.SetDefault(configKeySliderMapping, map[string][]string{})
+	userConfig.SetDefault(configKeyButtonMapping, defaultButtonMapping)
 	userConfig.SetDefault(configKeyInvertSliders, false)
 	userConfig.SetDefault(configKeyCOMPort, defaultCOMPort)
 	userConfig.SetDefault(configKeyBaudRate, defaultBaudRate)
+	userConfig.SetDefault(configKeyDeviceID, "")
+	userConfig.SetDefault(configKeyTransport, transportSerial)
+	userConfig.SetDefault(configKeyBackend, defaultBackend)
+	userConfig.SetDefault(configKeyBackendServer, "")
 	userConfig.SetDefault(configKeyLEDRefreshInterval, defaultLEDRefreshSeconds)
 	userConfig.SetDefault(configKeyLEDMode, defaultLEDMode)
+	userConfig.SetDefault(configKeyDisplayCharset, displayCharsetUTF8)
+	userConfig.SetDefault(configKeySerialFraming, defaultSerialFraming)
+	userConfig.SetDefault(configKeyUploadReset, defaultUploadReset)
+	userConfig.SetDefault(configKeyDisplayScreenInterval, defaultDisplayScreenIntervalSeconds)
+	userConfig.SetDefault(configKeyDisplayScreenRefreshInterval, defaultDisplayScreenRefreshMillis)
+	userConfig.SetDefault(configKeyDisplayScreens, []interface{}{})
+	userConfig.SetDefault(configKeyDisplayPageInterval, defaultDisplayPageIntervalSeconds)
+	userConfig.SetDefault(configKeyWeatherEnabled, false)
+	userConfig.SetDefault(configKeyWeatherUnits, weatherUnitsMetric)
+	userConfig.SetDefault(configKeyWeatherRefreshMinutes, int(minWeatherRefreshInterval.Minutes()))
+	userConfig.SetDefault(configKeyCalendarEnabled, false)
+	userConfig.SetDefault(configKeyCalendarRefreshMinutes, int(minCalendarRefreshInterval.Minutes()))
+	userConfig.SetDefault(configKeyTimerFocusMinutes, defaultTimerFocusMinutes)
+	userConfig.SetDefault(configKeyTimerBreakMinutes, defaultTimerBreakMinutes)
+	userConfig.SetDefault(configKeyTimerLongBreakMinutes, defaultTimerLongBreakMinutes)
+	userConfig.SetDefault(configKeyTimerCyclesBeforeLongBreak, defaultTimerCyclesBeforeLong)
+	userConfig.SetDefault(configKeyTimerMuteDuringFocus, []string{})
+	userConfig.SetDefault(configKeyFadeDuration, defaultFadeMilliseconds)
+	userConfig.SetDefault(configKeyFadeEasing, defaultFadeEasing)
+	userConfig.SetDefault(configKeyAutomationTimezone, "")
+	userConfig.SetDefault(configKeyAutomationOverrideMinutes, defaultAutomationOverrideMinutes)
+	userConfig.SetDefault(configKeyDuckingEnabled, false)
+	userConfig.SetDefault(configKeyDuckingPriority, []string{})
+	userConfig.SetDefault(configKeyDuckingTargets, []string{})
+	userConfig.SetDefault(configKeyDuckingThreshold, defaultDuckingThreshold)
+	userConfig.SetDefault(configKeyDuckingAmountDB, defaultDuckingAmountDB)
+	userConfig.SetDefault(configKeyDuckingRelease, defaultDuckingReleaseMillisecs)
+	userConfig.SetDefault(configKeyPushEnabled, false)
+	userConfig.SetDefault(configKeyPushService, pushServiceNtfy)
+	userConfig.SetDefault(configKeyPushNtfyServer, defaultNtfyServer)
+	userConfig.SetDefault(configKeyPushDeviceDisconnected, true)
+	userConfig.SetDefault(configKeyPushMicHotMinutes, defaultMicHotAlertMinutes)
+	userConfig.SetDefault(configKeyLogShippingEnabled, false)
+	userConfig.SetDefault(configKeyLogShippingProtocol, defaultLogShippingProtocol)
+	userConfig.SetDefault(configKeyLogShippingLevel, defaultLogShippingLevel)
+	userConfig.SetDefault(configKeyLogShippingBatchSize, defaultLogShippingBatchSize)
+	userConfig.SetDefault(configKeyLogShippingFlushSeconds, defaultLogShippingFlushSeconds)
+
+	userConfig.SetDefault(configKeyLogFilesMaxSizeMB, defaultLogFilesMaxSizeMB)
+	userConfig.SetDefault(configKeyLogFilesKeep, defaultLogFilesKeep)
+	userConfig.SetDefault(configKeyLogFilesMaxAgeDays, defaultLogFilesMaxAgeDays)
+	userConfig.SetDefault(configKeyDNDSync, false)
+	userConfig.SetDefault(configKeyDNDPollSeconds, defaultDNDPollSeconds)
+	userConfig.SetDefault(configKeyDNDQuietVolumes, map[string]interface{}{})
+	userConfig.SetDefault(configKeyFocusMode, focusModePoll)
+	userConfig.SetDefault(configKeyFocusPollInterval, defaultFocusPollInterval.Milliseconds())
+	userConfig.SetDefault(configKeyFocusExclude, []string{})
+	userConfig.SetDefault(configKeyLaunchSyncEnabled, true)
+	userConfig.SetDefault(configKeyLaunchSyncPollInterval, defaultLaunchSyncPollInterval.Milliseconds())
+	userConfig.SetDefault(configKeyNowPlayingEnabled, false)
+	userConfig.SetDefault(configKeyNowPlayingPollInterval, defaultNowPlayingPollInterval.Milliseconds())
+	userConfig.SetDefault(configKeyNowPlayingShowOnDisplay, false)
+	userConfig.SetDefault(configKeySleepOnLock, false)
+	userConfig.SetDefault(configKeySleepOnIdle, false)
+	userConfig.SetDefault(configKeySleepIdleMinutes, defaultSleepIdleMinutes)
+	userConfig.SetDefault(configKeyUsageStatsEnabled, false)
+	userConfig.SetDefault(configKeyUsageStatsWeeklySummary, true)
+	userConfig.SetDefault(configKeyHearingEnabled, false)
+	userConfig.SetDefault(configKeyHearingLevel, defaultHearingLevel)
+	userConfig.SetDefault(configKeyHearingMinutes, defaultHearingMinutes)
+	userConfig.SetDefault(configKeyHearingLimitTo, defaultHearingLimitTo)
+	userConfig.SetDefault(configKeyHearingSnoozeMinutes, defaultHearingSnoozeMinutes)
+	userConfig.SetDefault(configKeyQuietHoursEnabled, false)
+	userConfig.SetDefault(configKeyQuietHoursFrom, defaultQuietHoursFrom)
+	userConfig.SetDefault(configKeyQuietHoursTo, defaultQuietHoursTo)
+	userConfig.SetDefault(configKeyQuietHoursDays, []string{})
+	userConfig.SetDefault(configKeyQuietHoursMaster, defaultQuietHoursMaster)
+	userConfig.SetDefault(configKeyQuietHoursApps, defaultQuietHoursApps)
+	userConfig.SetDefault(configKeyQuietHoursLEDTheme, "")
+	userConfig.SetDefault(configKeyHeartbeatInterval, defaultHeartbeatIntervalSeconds)
+	userConfig.SetDefault(configKeyHeartbeatSilence, defaultHeartbeatSilenceSeconds)
+	userConfig.SetDefault(configKeyJitterBufferMax, defaultJitterBufferMaxMillis)
+	userConfig.SetDefault(configKeyLEDColorMode, defaultLEDColorMode)
+	userConfig.SetDefault(configKeyLEDColorTheme, defaultLEDColorTheme)
+	userConfig.SetDefault(configKeyLEDColorThemes, map[string]interface{}{})
+	userConfig.SetDefault(configKeyLEDColorTargets, map[string]interface{}{})
+	userConfig.SetDefault(configKeyLEDAnimationEffect, defaultLEDAnimation)
+	userConfig.SetDefault(configKeyLEDAnimationIdleMinutes, defaultLEDAnimationIdleMinutes)
+	userConfig.SetDefault(configKeyLEDAnimationCycleTime, defaultLEDAnimationCycleMillis)
+	userConfig.SetDefault(configKeyVUMeterEnabled, false)
+	userConfig.SetDefault(configKeyVUMeterSegments, defaultVUMeterSegments)
+	userConfig.SetDefault(configKeyOutputSwitchDevices, []string{})
+	userConfig.SetDefault(configKeyOutputSwitchShowOnDisplay, false)
+	userConfig.SetDefault(configKeyAPIEnabled, false)
+	userConfig.SetDefault(configKeyAPIAddress, defaultAPIAddress)
+	userConfig.SetDefault(configKeyAPIPort, defaultAPIPort)
+	userConfig.SetDefault(configKeyAPIMetrics, false)
+	userConfig.SetDefault(configKeyEventLogSize, defaultEventLogSize)
 
 	internalConfig := viper.New()
 	internalConfig.SetConfigName(internalConfigName)
@@ -143,6 +498,27 @@ func (cc *CanonicalConfig) Load() error {
 		return fmt.Errorf("read user config: %w", err)
 	}
 
+	// upgrade configs written for older versions of deej, before anything reads them
+	cc.migrate()
+
+	// bring in the files it includes, if any
+	if err := cc.mergeIncludes(); err != nil {
+		cc.logger.Warnw("Failed to merge included config files", "error", err)
+		return fmt.Errorf("merge included configs: %w", err)
+	}
+
+	// and this machine's overrides over all of it
+	if err := cc.mergeLocalConfig(); err != nil {
+		cc.logger.Warnw("Failed to merge per-machine config", "error", err)
+		return fmt.Errorf("merge local config: %w", err)
+	}
+
+	// then fill in environment variables and home directories, now that everything that could use them is in
+	if err := cc.expandConfigValues(); err != nil {
+		cc.logger.Warnw("Failed to expand config values", "error", err)
+		return fmt.Errorf("expand config values: %w", err)
+	}
+
 	// load the internal config - this doesn't have to exist, so it can error
 	if err := cc.internalConfig.ReadInConfig(); err != nil {
 		cc.logger.Debugw("Viper failed to read internal config", "error", err, "reminder", "this is fine")
@@ -156,7 +532,9 @@ func (cc *CanonicalConfig) Load() error {
 
 	cc.logger.Info("Loaded config successfully")
 	cc.logger.Infow("Config values",
+		"profile", cc.ActiveProfile,
 		"sliderMapping", cc.SliderMapping,
+		"buttonMapping", cc.ButtonMapping,
 		"connectionInfo", cc.ConnectionInfo,
 		"invertSliders", cc.InvertSliders)
 
@@ -164,11 +542,90 @@ func (cc *CanonicalConfig) Load() error {
 }
 
 // SubscribeToChanges allows external components to receive updates when the config is reloaded
-func (cc *CanonicalConfig) SubscribeToChanges() chan bool {
-	c := make(chan bool)
-	cc.reloadConsumers = append(cc.reloadConsumers, c)
+func (cc *CanonicalConfig) SubscribeToChanges() *ConfigSubscription {
+
+	// whoever reads a reload reads the config as it is now anyway, so a subscriber only ever needs the one waiting
+	subscription, channel := cc.reloads.subscribe()
+	return &ConfigSubscription{Subscription: subscription, Reloads: channel.(chan bool)}
+}
+
+// SetInitialProfile selects the profile to use once the config is first loaded
+func (cc *CanonicalConfig) SetInitialProfile(name string) {
+	cc.ActiveProfile = strings.ToLower(name)
+}
 
-	return c
+// ProfileNames returns the names of all configured profiles, in alphabetical order
+func (cc *CanonicalConfig) ProfileNames() []string {
+	names := make([]string, 0, len(cc.Profiles))
+	for name := range cc.Profiles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// SwitchProfile activates the named profile's slider mapping. Consumers are notified
+// just like they are on a config reload, which also makes sure volumes are re-applied
+func (cc *CanonicalConfig) SwitchProfile(name string) error {
+	name = strings.ToLower(name)
+
+	mapping, ok := cc.Profiles[name]
+	if !ok {
+		cc.logger.Warnw("Can't switch to unknown profile", "profile", name)
+		return fmt.Errorf("unknown profile: %s", name)
+	}
+
+	if name == cc.ActiveProfile {
+		return nil
+	}
+
+	cc.ActiveProfile = name
+	cc.SliderMapping = mapping
+
+	cc.logger.Infow("Switched profile", "profile", name, "sliderMapping", mapping)
+	cc.notifier.Notify("Profile switched", fmt.Sprintf("Now using the \"%s\" profile.", name))
+
+	cc.onConfigReloaded()
+
+	return nil
+}
+
+// RemapSlider maps the slider to the given targets in the active profile, until the config is next loaded.
+// consumers are notified like they are on a profile switch, so the slider's volume applies to its new targets
+func (cc *CanonicalConfig) RemapSlider(sliderID int, targets []string) {
+	cc.SliderMapping.set(sliderID, targets)
+
+	cc.logger.Infow("Remapped slider", "sliderID", sliderID, "targets", targets)
+
+	cc.onConfigReloaded()
+}
+
+// SetLEDMode switches the LEDs between following processes and audio, until the config is next loaded
+func (cc *CanonicalConfig) SetLEDMode(mode string) {
+	if mode == cc.LEDMode {
+		return
+	}
+
+	cc.LEDMode = mode
+
+	cc.logger.Infow("Switched LED mode", "ledMode", mode)
+
+	cc.onConfigReloaded()
+}
+
+// NextProfile switches to the profile following the active one (alphabetically, wrapping around)
+func (cc *CanonicalConfig) NextProfile() error {
+	names := cc.ProfileNames()
+
+	for idx, name := range names {
+		if name == cc.ActiveProfile {
+			return cc.SwitchProfile(names[(idx+1)%len(names)])
+		}
+	}
+
+	return cc.SwitchProfile(defaultProfileName)
 }
 
 // WatchConfigFileChanges starts watching for configuration file changes
@@ -183,43 +640,69 @@ func (cc *CanonicalConfig) WatchConfigFileChanges() {
 
 	lastAttemptedReload := time.Now()
 
-	// establish watch using viper as opposed to doing it ourselves, though our internal cooldown is still required
-	cc.userConfig.WatchConfig()
-	cc.userConfig.OnConfigChange(func(event fsnotify.Event) {
+	// config.yaml and the files it includes are watched separately, but reload the same way
+	var reloadLock sync.Mutex
+	var includes *includeWatcher
 
-		// when we get a write event...
-		if event.Op&fsnotify.Write == fsnotify.Write {
+	reload := func() {
+		reloadLock.Lock()
+		defer reloadLock.Unlock()
 
-			now := time.Now()
+		now := time.Now()
 
-			// ... check if it's not a duplicate (many editors will write to a file twice)
-			if lastAttemptedReload.Add(minTimeBetweenReloadAttempts).Before(now) {
+		// check if it's not a duplicate (many editors will write to a file twice)
+		if !lastAttemptedReload.Add(minTimeBetweenReloadAttempts).Before(now) {
+			return
+		}
 
-				// and attempt reload if appropriate
-				cc.logger.Debugw("Config file modified, attempting reload", "event", event)
+		// wait a bit to let the editor actually flush the new file contents to disk
+		<-time.After(delayBetweenEventAndReload)
 
-				// wait a bit to let the editor actually flush the new file contents to disk
-				<-time.After(delayBetweenEventAndReload)
+		if err := cc.Load(); err != nil {
+			cc.logger.Warnw("Failed to reload config file", "error", err)
+		} else {
+			cc.logger.Info("Reloaded config successfully")
+			cc.notifier.Notify("Configuration reloaded!", "Your changes have been applied.")
 
-				if err := cc.Load(); err != nil {
-					cc.logger.Warnw("Failed to reload config file", "error", err)
-				} else {
-					cc.logger.Info("Reloaded config successfully")
-					cc.notifier.Notify("Configuration reloaded!", "Your changes have been applied.")
+			cc.onConfigReloaded()
+		}
 
-					cc.onConfigReloaded()
-				}
+		// the include list may have changed along with it
+		if includes != nil {
+			includes.sync()
+		}
 
-				// don't forget to update the time
-				lastAttemptedReload = now
-			}
+		// don't forget to update the time
+		lastAttemptedReload = now
+	}
+
+	// establish watch using viper as opposed to doing it ourselves, though our internal cooldown is still required
+	cc.userConfig.WatchConfig()
+	cc.userConfig.OnConfigChange(func(event fsnotify.Event) {
+
+		// when we get a write event, attempt reload if appropriate
+		if event.Op&fsnotify.Write == fsnotify.Write {
+			cc.logger.Debugw("Config file modified", "event", event)
+			reload()
 		}
 	})
 
+	reloadLock.Lock()
+	includes, err := cc.watchIncludedFiles(reload)
+	reloadLock.Unlock()
+
+	if err != nil {
+		cc.logger.Warnw("Failed to watch included config files, changes to them need a restart", "error", err)
+	}
+
 	// wait till they stop us
 	<-cc.stopWatcherChannel
 	cc.logger.Debug("Stopping user config file watcher")
 	cc.userConfig.OnConfigChange(nil)
+
+	if includes != nil {
+		includes.close()
+	}
 }
 
 // StopWatchingConfigFile signals our filesystem watcher to stop
@@ -230,10 +713,43 @@ func (cc *CanonicalConfig) StopWatchingConfigFile() {
 func (cc *CanonicalConfig) populateFromVipers() error {
 
 	// merge the slider mappings from the user and internal configs
-	cc.SliderMapping = sliderMapFromConfigs(
-		cc.userConfig.GetStringMapStringSlice(configKeySliderMapping),
-		cc.internalConfig.GetStringMapStringSlice(configKeySliderMapping),
-	)
+	cc.Profiles = map[string]*sliderMap{
+		defaultProfileName: sliderMapFromConfigs(
+			cc.userConfig.GetStringMapStringSlice(configKeySliderMapping),
+			cc.internalConfig.GetStringMapStringSlice(configKeySliderMapping),
+		),
+	}
+
+	// each named profile brings its own slider mapping
+	for profileName := range cc.userConfig.GetStringMap(configKeyProfiles) {
+		profileName = strings.ToLower(profileName)
+
+		cc.Profiles[profileName] = sliderMapFromConfigs(
+			cc.userConfig.GetStringMapStringSlice(fmt.Sprintf("%s.%s.%s", configKeyProfiles, profileName, configKeySliderMapping)),
+			nil,
+		)
+	}
+
+	// keep whichever profile was active before the reload, as long as it still exists
+	if _, ok := cc.Profiles[cc.ActiveProfile]; !ok {
+		cc.logger.Warnw("Active profile no longer exists, using default",
+			"profile", cc.ActiveProfile,
+			"default", defaultProfileName)
+
+		cc.ActiveProfile = defaultProfileName
+	}
+
+	cc.SliderMapping = cc.Profiles[cc.ActiveProfile]
+	cc.warnAboutInvalidTargetPatterns()
+
+	cc.ButtonMapping = buttonMapFromConfig(cc.userConfig.GetStringMap(configKeyButtonMapping))
+	cc.populateSliderCurves()
+	cc.populateVirtualSliders()
+	cc.populateSliderCalibrations()
+	cc.populateSliderSmoothing()
+	cc.populateSliderUnmapped()
+	cc.populateSliderSessions()
+	cc.populateNotRunning()
 
 	// get the rest of the config fields - viper saves us a lot of effort here
 	cc.ConnectionInfo.COMPort = cc.userConfig.GetString(configKeyCOMPort)
@@ -251,7 +767,25 @@ func (cc *CanonicalConfig) populateFromVipers() error {
 		cc.ConnectionInfo.BaudRate = defaultBaudRate
 	}
 
-	cc.InvertSliders = cc.userConfig.GetBool(configKeyInvertSliders)
+	cc.ConnectionInfo.DeviceID = strings.TrimSpace(cc.userConfig.GetString(configKeyDeviceID))
+
+	cc.ConnectionInfo.Transport = strings.ToLower(cc.userConfig.GetString(configKeyTransport))
+	if cc.ConnectionInfo.Transport != transportSerial && cc.ConnectionInfo.Transport != transportMock {
+		cc.logger.Warnw("Invalid transport, using default",
+			"key", configKeyTransport,
+			"invalidValue", cc.ConnectionInfo.Transport,
+			"defaultValue", transportSerial)
+
+		cc.ConnectionInfo.Transport = transportSerial
+	}
+
+	cc.populateDevices()
+	cc.populateConnectionChain()
+
+	cc.populateInvertSliders()
+	cc.populateBackend()
+	cc.populateSerialFraming()
+	cc.populateUploadReset()
 	cc.NoiseReductionLevel = cc.userConfig.GetString(configKeyNoiseReductionLevel)
 
 	ledRefreshSeconds := cc.userConfig.GetInt(configKeyLEDRefreshInterval)
@@ -268,15 +802,1140 @@ func (cc *CanonicalConfig) populateFromVipers() error {
 		cc.LEDMode = defaultLEDMode
 	}
 
+	cc.populateLEDAggregation()
+
+	cc.populateDisplayEncoder()
+	cc.populateDisplayPages()
+	cc.populateDisplayScreens()
+	cc.populateTimer()
+	cc.populateFades()
+	cc.populateDucking()
+	cc.populatePriorityClasses()
+	cc.populateProcessNames()
+	cc.populateDoNotDisturb()
+	cc.populateFocus()
+	cc.populateLaunchSync()
+	cc.populateNowPlaying()
+	cc.populateSleep()
+	cc.UsageStats.Enabled = cc.userConfig.GetBool(configKeyUsageStatsEnabled)
+	cc.UsageStats.WeeklySummary = cc.userConfig.GetBool(configKeyUsageStatsWeeklySummary)
+	cc.populateHearingProtection()
+	cc.populateHeartbeat()
+	cc.populateJitterBuffer()
+	cc.populateLEDColors()
+	cc.populateQuietHours()
+	cc.populateLEDAnimation()
+	cc.populateVUMeter()
+	cc.populateScenes()
+	cc.populateDSP()
+	cc.populatePushAlerts()
+	cc.Webhooks = webhooksFromConfig(cc.logger, cc.userConfig.Get(configKeyWebhooks))
+	cc.populateLogShipping()
+	cc.populateLogFiles()
+	cc.populateAPI()
+
+	cc.OutputSwitch.Devices = cc.userConfig.GetStringSlice(configKeyOutputSwitchDevices)
+	cc.OutputSwitch.ShowOnDisplay = cc.userConfig.GetBool(configKeyOutputSwitchShowOnDisplay)
+
+	cc.populateAutomation()
+
+	if !integrationsSupported {
+		cc.disableIntegrations()
+	}
+
+	if cc.safeMode {
+		cc.applySafeMode()
+	}
+
 	cc.logger.Debug("Populated config fields from vipers")
 
 	return nil
 }
 
+// disableIntegrations turns off what this build of deej was made without (see integrations_off.go), pointing out
+// anything the user asked for that won't happen
+func (cc *CanonicalConfig) disableIntegrations() {
+	if cc.DisplayPages.Weather.Enabled || cc.DisplayPages.Calendar.Enabled || cc.PushAlerts.Enabled || len(cc.Webhooks) > 0 {
+		cc.logger.Warnw("This build of deej doesn't include integrations, ignoring their config",
+			"weather", cc.DisplayPages.Weather.Enabled,
+			"calendar", cc.DisplayPages.Calendar.Enabled,
+			"pushAlerts", cc.PushAlerts.Enabled,
+			"webhooks", len(cc.Webhooks))
+	}
+
+	cc.DisplayPages.Weather.Enabled = false
+	cc.DisplayPages.Calendar.Enabled = false
+	cc.PushAlerts.Enabled = false
+	cc.Webhooks = nil
+}
+
+// warnAboutInvalidTargetPatterns points out pattern targets that don't compile, as they'll never match anything
+func (cc *CanonicalConfig) warnAboutInvalidTargetPatterns() {
+	for profileName, mapping := range cc.Profiles {
+		mapping.iterate(func(sliderIdx int, targets []string) {
+			for _, target := range targets {
+
+				// identity and device targets can hold a pattern too
+				pattern := target
+				if _, value, ok := splitIdentityTarget(target); ok {
+					pattern = value
+				} else if name, ok := splitDeviceTarget(target); ok {
+					pattern = name
+				}
+
+				if !isTargetPattern(pattern) {
+					continue
+				}
+
+				if _, err := compileTargetPattern(pattern); err != nil {
+					cc.logger.Warnw("Invalid target pattern, it won't match anything",
+						"profile", profileName,
+						"slider", sliderIdx,
+						"target", target,
+						"error", err)
+				}
+			}
+		})
+	}
+}
+
+// populateInvertSliders accepts true/false for every slider, a list of slider indices (e.g. [0, 3]),
+// or an object of per-slider values (e.g. {0: true, 3: true})
+func (cc *CanonicalConfig) populateInvertSliders() {
+	cc.InvertSliders = newSliderSet()
+
+	rawValue := cc.userConfig.Get(configKeyInvertSliders)
+
+	switch value := rawValue.(type) {
+	case bool:
+		cc.InvertSliders.all = value
+
+	case []interface{}:
+		for _, rawIdx := range value {
+			sliderIdx, err := strconv.Atoi(fmt.Sprint(rawIdx))
+			if err != nil || sliderIdx < 0 {
+				cc.logger.Warnw("Ignoring invalid slider index in inverted sliders", "value", rawIdx)
+				continue
+			}
+
+			cc.InvertSliders.indices[sliderIdx] = true
+		}
+
+	default:
+		perSlider, ok := toStringMap(rawValue)
+		if !ok {
+
+			// environment variables and the like come in as strings
+			invert, _ := strconv.ParseBool(fmt.Sprint(rawValue))
+			cc.InvertSliders.all = invert
+
+			return
+		}
+
+		for sliderIdxString, sliderValue := range perSlider {
+			sliderIdx, err := strconv.Atoi(sliderIdxString)
+			if err != nil {
+				continue
+			}
+
+			// either a plain boolean, or an object with an "invert" key
+			if fields, ok := toStringMap(sliderValue); ok {
+				sliderValue = fields["invert"]
+			}
+
+			if invert, err := strconv.ParseBool(fmt.Sprint(sliderValue)); err == nil && invert {
+				cc.InvertSliders.indices[sliderIdx] = true
+			}
+		}
+	}
+}
+
+func (cc *CanonicalConfig) populateSliderCurves() {
+	cc.SliderCurves = make(map[int]sliderCurve)
+
+	for sliderIdxString, value := range cc.userConfig.GetStringMap(configKeySliderCurves) {
+		sliderIdx, err := strconv.Atoi(sliderIdxString)
+		if err != nil {
+			continue
+		}
+
+		curve, err := sliderCurveFromConfig(value)
+		if err != nil {
+			cc.logger.Warnw("Invalid slider curve, using linear", "slider", sliderIdx, "error", err)
+			continue
+		}
+
+		cc.SliderCurves[sliderIdx] = curve
+	}
+}
+
+// populateVirtualSliders reads the virtual sliders' expressions. they can only use physical sliders, as one
+// virtual slider using another could go round in circles
+func (cc *CanonicalConfig) populateVirtualSliders() {
+	cc.VirtualSliders = make(map[int]virtualSlider)
+
+	for sliderIDString, value := range cc.userConfig.GetStringMap(configKeyVirtualSliders) {
+		sliderID, err := strconv.Atoi(sliderIDString)
+		if err != nil || sliderID < 0 {
+			cc.logger.Warnw("Invalid virtual slider ID, ignoring", "key", configKeyVirtualSliders, "invalidValue", sliderIDString)
+			continue
+		}
+
+		virtual, err := virtualSliderFromConfig(value)
+		if err != nil {
+			cc.logger.Warnw("Invalid virtual slider expression, ignoring", "slider", sliderID, "invalidValue", value, "error", err)
+			continue
+		}
+
+		cc.VirtualSliders[sliderID] = virtual
+	}
+
+	for sliderID, virtual := range cc.VirtualSliders {
+		for _, input := range virtual.inputs {
+			if _, ok := cc.VirtualSliders[input]; ok {
+				cc.logger.Warnw("Virtual slider uses another virtual slider, ignoring",
+					"slider", sliderID,
+					"expression", virtual.expression,
+					"input", input)
+
+				delete(cc.VirtualSliders, sliderID)
+				break
+			}
+		}
+	}
+}
+
+// populateSliderCalibrations reads calibrations saved by the guided calibration (in the internal config),
+// with anything set in the user config taking precedence, key by key
+func (cc *CanonicalConfig) populateSliderCalibrations() {
+	cc.SliderCalibrations = make(map[int]sliderCalibration)
+
+	for _, source := range []*viper.Viper{cc.internalConfig, cc.userConfig} {
+		for sliderIdxString, value := range source.GetStringMap(configKeySliderCalibration) {
+			sliderIdx, err := strconv.Atoi(sliderIdxString)
+			if err != nil {
+				continue
+			}
+
+			fields, ok := toStringMap(value)
+			if !ok {
+				continue
+			}
+
+			base, ok := cc.SliderCalibrations[sliderIdx]
+			if !ok {
+				base = defaultSliderCalibration
+			}
+
+			calibration, err := sliderCalibrationFromConfig(fields, base)
+			if err != nil {
+				cc.logger.Warnw("Invalid slider calibration, ignoring", "slider", sliderIdx, "error", err)
+				continue
+			}
+
+			cc.SliderCalibrations[sliderIdx] = calibration
+		}
+	}
+}
+
+func (cc *CanonicalConfig) populateSliderSmoothing() {
+	cc.SliderSmoothing = make(map[int]sliderSmoothing)
+
+	for sliderIdxString, value := range cc.userConfig.GetStringMap(configKeySliderSmoothing) {
+		sliderIdx, err := strconv.Atoi(sliderIdxString)
+		if err != nil {
+			continue
+		}
+
+		fields, ok := toStringMap(value)
+		if !ok {
+			continue
+		}
+
+		smoothing, err := sliderSmoothingFromConfig(fields)
+		if err != nil {
+			cc.logger.Warnw("Invalid slider smoothing, ignoring", "slider", sliderIdx, "error", err)
+			continue
+		}
+
+		cc.SliderSmoothing[sliderIdx] = smoothing
+	}
+}
+
+func (cc *CanonicalConfig) populateSliderUnmapped() {
+	cc.SliderUnmapped = make(map[int]unmappedGroup)
+
+	for sliderIdxString, value := range cc.userConfig.GetStringMap(configKeySliderUnmapped) {
+		sliderIdx, err := strconv.Atoi(sliderIdxString)
+		if err != nil {
+			continue
+		}
+
+		fields, ok := toStringMap(value)
+		if !ok {
+			continue
+		}
+
+		group, err := unmappedGroupFromConfig(fields)
+		if err != nil {
+			cc.logger.Warnw("Invalid unmapped group settings, ignoring", "slider", sliderIdx, "error", err)
+			continue
+		}
+
+		cc.SliderUnmapped[sliderIdx] = group
+	}
+}
+
+func (cc *CanonicalConfig) populateNotRunning() {
+	cc.NotRunning = make(map[string]notRunningRule)
+
+	for target, value := range cc.userConfig.GetStringMap(configKeyNotRunning) {
+		rule, err := notRunningRuleFromConfig(value)
+		if err != nil {
+			cc.logger.Warnw("Invalid not running rule, ignoring", "target", target, "error", err)
+			continue
+		}
+
+		cc.NotRunning[strings.ToLower(target)] = rule
+	}
+}
+
+// SaveSliderCalibrations stores the results of the guided calibration in the internal config
+func (cc *CanonicalConfig) SaveSliderCalibrations(calibrations map[int]sliderCalibration) error {
+	saved := make(map[string]interface{}, len(calibrations))
+
+	for sliderIdx, calibration := range calibrations {
+		saved[strconv.Itoa(sliderIdx)] = map[string]interface{}{
+			"min": calibration.RawMin,
+			"max": calibration.RawMax,
+		}
+	}
+
+	cc.internalConfig.Set(configKeySliderCalibration, saved)
+
+	if err := cc.internalConfig.WriteConfigAs(path.Join(internalConfigPath, internalConfigFilepath)); err != nil {
+		cc.logger.Warnw("Failed to write internal config", "error", err)
+		return fmt.Errorf("write internal config: %w", err)
+	}
+
+	cc.logger.Infow("Saved slider calibrations", "calibrations", calibrations)
+
+	return nil
+}
+
+func (cc *CanonicalConfig) populateDisplayEncoder() {
+	charset := strings.ToLower(cc.userConfig.GetString(configKeyDisplayCharset))
+
+	switch charset {
+	case displayCharsetUTF8, displayCharsetASCII, displayCharsetLatin1, displayCharsetCP1251:
+	default:
+		cc.logger.Warnw("Invalid display charset, using default",
+			"key", configKeyDisplayCharset,
+			"invalidValue", charset,
+			"defaultValue", displayCharsetUTF8)
+
+		charset = displayCharsetUTF8
+	}
+
+	// these are a list rather than a map, as viper would lowercase map keys
+	custom := make(map[string]string)
+	rawTransliterations, _ := cc.userConfig.Get(configKeyTransliterations).([]interface{})
+
+	for _, rawEntry := range rawTransliterations {
+		fields, ok := toStringMap(rawEntry)
+		if !ok {
+			continue
+		}
+
+		from, to := fmt.Sprint(fields["from"]), fmt.Sprint(fields["to"])
+		if fields["from"] == nil || fields["to"] == nil || from == "" {
+			cc.logger.Warnw("Ignoring transliteration without both from and to", "entry", fields)
+			continue
+		}
+
+		custom[from] = to
+	}
+
+	cc.DisplayEncoder = newDisplayTextEncoder(charset, custom)
+}
+
+func (cc *CanonicalConfig) populateDisplayScreens() {
+	screens := &cc.DisplayScreens
+
+	intervalSeconds := cc.userConfig.GetInt(configKeyDisplayScreenInterval)
+	if intervalSeconds <= 0 {
+		cc.logger.Warnw("Invalid display screen interval, using default",
+			"key", configKeyDisplayScreenInterval,
+			"invalidValue", intervalSeconds,
+			"defaultValue", defaultDisplayScreenIntervalSeconds)
+
+		intervalSeconds = defaultDisplayScreenIntervalSeconds
+	}
+	screens.Interval = time.Duration(intervalSeconds) * time.Second
+
+	refreshMillis := cc.userConfig.GetInt(configKeyDisplayScreenRefreshInterval)
+	if refreshMillis <= 0 {
+		cc.logger.Warnw("Invalid display screen refresh interval, using default",
+			"key", configKeyDisplayScreenRefreshInterval,
+			"invalidValue", refreshMillis,
+			"defaultValue", defaultDisplayScreenRefreshMillis)
+
+		refreshMillis = defaultDisplayScreenRefreshMillis
+	}
+	screens.RefreshInterval = time.Duration(refreshMillis) * time.Millisecond
+
+	screens.Screens = []displayScreen{}
+
+	entries, _ := cc.userConfig.Get(configKeyDisplayScreens).([]interface{})
+	for idx, entry := range entries {
+		fields, ok := toStringMap(entry)
+		if !ok {
+			cc.logger.Warnw("Invalid display screen, ignoring", "key", configKeyDisplayScreens, "index", idx)
+			continue
+		}
+
+		screen := displayScreen{}
+		if title, ok := fields["title"]; ok {
+			screen.Title = fmt.Sprint(title)
+		}
+
+		rows, _ := fields["rows"].([]interface{})
+		for _, row := range rows {
+			kind := strings.ToLower(strings.TrimSpace(fmt.Sprint(row)))
+
+			if !validScreenRowKind(kind) {
+				cc.logger.Warnw("Unknown display screen row, ignoring", "screen", screen.Title, "row", row)
+				continue
+			}
+
+			screen.Rows = append(screen.Rows, kind)
+		}
+
+		if len(screen.Rows) == 0 {
+			cc.logger.Warnw("Display screen has no rows, ignoring", "screen", screen.Title)
+			continue
+		}
+
+		screens.Screens = append(screens.Screens, screen)
+	}
+}
+
+func (cc *CanonicalConfig) populateDisplayPages() {
+	pages := &cc.DisplayPages
+
+	intervalSeconds := cc.userConfig.GetInt(configKeyDisplayPageInterval)
+	if intervalSeconds <= 0 {
+		intervalSeconds = defaultDisplayPageIntervalSeconds
+	}
+	pages.Interval = time.Duration(intervalSeconds) * time.Second
+
+	pages.Weather.Enabled = cc.userConfig.GetBool(configKeyWeatherEnabled)
+	pages.Weather.APIKey = cc.userConfig.GetString(configKeyWeatherAPIKey)
+	pages.Weather.Location = cc.userConfig.GetString(configKeyWeatherLocation)
+
+	pages.Weather.Units = strings.ToLower(cc.userConfig.GetString(configKeyWeatherUnits))
+	if pages.Weather.Units != weatherUnitsMetric && pages.Weather.Units != weatherUnitsImperial {
+		cc.logger.Warnw("Invalid weather units, using default",
+			"value", pages.Weather.Units,
+			"default", weatherUnitsMetric)
+		pages.Weather.Units = weatherUnitsMetric
+	}
+
+	// never let users refresh more often than each provider's rate limit
+	pages.Weather.RefreshInterval = time.Duration(cc.userConfig.GetInt(configKeyWeatherRefreshMinutes)) * time.Minute
+	if pages.Weather.RefreshInterval < minWeatherRefreshInterval {
+		pages.Weather.RefreshInterval = minWeatherRefreshInterval
+	}
+
+	pages.Calendar.Enabled = cc.userConfig.GetBool(configKeyCalendarEnabled)
+	pages.Calendar.URL = cc.userConfig.GetString(configKeyCalendarURL)
+
+	pages.Calendar.RefreshInterval = time.Duration(cc.userConfig.GetInt(configKeyCalendarRefreshMinutes)) * time.Minute
+	if pages.Calendar.RefreshInterval < minCalendarRefreshInterval {
+		pages.Calendar.RefreshInterval = minCalendarRefreshInterval
+	}
+}
+
+func (cc *CanonicalConfig) populateTimer() {
+	timer := &cc.Timer
+
+	// fall back to the defaults for any non-positive value, which would otherwise make for a very confusing timer
+	positiveOrDefault := func(key string, defaultValue int) int {
+		value := cc.userConfig.GetInt(key)
+		if value <= 0 {
+			cc.logger.Warnw("Invalid timer setting, using default",
+				"key", key,
+				"invalidValue", value,
+				"defaultValue", defaultValue)
+
+			return defaultValue
+		}
+
+		return value
+	}
+
+	timer.FocusDuration = time.Duration(positiveOrDefault(configKeyTimerFocusMinutes, defaultTimerFocusMinutes)) * time.Minute
+	timer.BreakDuration = time.Duration(positiveOrDefault(configKeyTimerBreakMinutes, defaultTimerBreakMinutes)) * time.Minute
+	timer.LongBreakDuration = time.Duration(positiveOrDefault(configKeyTimerLongBreakMinutes, defaultTimerLongBreakMinutes)) * time.Minute
+	timer.CyclesBeforeLongBreak = positiveOrDefault(configKeyTimerCyclesBeforeLongBreak, defaultTimerCyclesBeforeLong)
+
+	timer.MuteDuringFocus = cc.userConfig.GetStringSlice(configKeyTimerMuteDuringFocus)
+}
+
+func (cc *CanonicalConfig) populateDoNotDisturb() {
+	dnd := &cc.DoNotDisturb
+
+	dnd.Sync = cc.userConfig.GetBool(configKeyDNDSync)
+
+	pollSeconds := cc.userConfig.GetInt(configKeyDNDPollSeconds)
+	if pollSeconds <= 0 {
+		cc.logger.Warnw("Invalid do not disturb poll interval, using default",
+			"key", configKeyDNDPollSeconds,
+			"invalidValue", pollSeconds,
+			"defaultValue", defaultDNDPollSeconds)
+
+		pollSeconds = defaultDNDPollSeconds
+	}
+
+	dnd.PollInterval = time.Duration(pollSeconds) * time.Second
+	dnd.Profile = strings.ToLower(cc.userConfig.GetString(configKeyDNDProfile))
+	dnd.QuietVolumes = targetVolumesFromConfig(cc.userConfig.GetStringMap(configKeyDNDQuietVolumes))
+}
+
+func (cc *CanonicalConfig) populateFocus() {
+	focus := &cc.Focus
+
+	focus.Mode = strings.ToLower(cc.userConfig.GetString(configKeyFocusMode))
+	if focus.Mode != focusModePoll && focus.Mode != focusModeEvent {
+		cc.logger.Warnw("Invalid focus follow mode, using default",
+			"key", configKeyFocusMode,
+			"invalidValue", focus.Mode,
+			"defaultValue", focusModePoll)
+
+		focus.Mode = focusModePoll
+	}
+
+	pollMilliseconds := cc.userConfig.GetInt(configKeyFocusPollInterval)
+	if pollMilliseconds <= 0 {
+		cc.logger.Warnw("Invalid focus poll interval, using default",
+			"key", configKeyFocusPollInterval,
+			"invalidValue", pollMilliseconds,
+			"defaultValue", defaultFocusPollInterval.Milliseconds())
+
+		pollMilliseconds = int(defaultFocusPollInterval.Milliseconds())
+	}
+
+	focus.PollInterval = time.Duration(pollMilliseconds) * time.Millisecond
+	focus.Exclude = normalizeTargets(cc.userConfig.GetStringSlice(configKeyFocusExclude))
+}
+
+func (cc *CanonicalConfig) populateFades() {
+	fadeMilliseconds := cc.userConfig.GetInt(configKeyFadeDuration)
+	if fadeMilliseconds < 0 {
+		fadeMilliseconds = 0
+	}
+
+	cc.Fades.Duration = time.Duration(fadeMilliseconds) * time.Millisecond
+	cc.Fades.Easing = cc.parseFadeEasing(configKeyFadeEasing, defaultFadeEasing)
+}
+
+// parseFadeEasing reads an easing curve name, falling back to the given default if it isn't one we know
+func (cc *CanonicalConfig) parseFadeEasing(key string, defaultValue string) string {
+	easing := strings.ToLower(cc.userConfig.GetString(key))
+	if easing == "" {
+		return defaultValue
+	}
+
+	if !validFadeEasing(easing) {
+		cc.logger.Warnw("Invalid easing curve, using default",
+			"key", key,
+			"invalidValue", easing,
+			"defaultValue", defaultValue)
+
+		return defaultValue
+	}
+
+	return easing
+}
+
+func (cc *CanonicalConfig) populateDucking() {
+	ducking := &cc.Ducking
+
+	ducking.Enabled = cc.userConfig.GetBool(configKeyDuckingEnabled)
+	ducking.PriorityTargets = normalizeTargets(cc.userConfig.GetStringSlice(configKeyDuckingPriority))
+	ducking.Targets = normalizeTargets(cc.userConfig.GetStringSlice(configKeyDuckingTargets))
+
+	ducking.Threshold = float32(cc.userConfig.GetFloat64(configKeyDuckingThreshold))
+	if ducking.Threshold <= 0 || ducking.Threshold >= 1 {
+		cc.logger.Warnw("Invalid ducking threshold, using default",
+			"key", configKeyDuckingThreshold,
+			"invalidValue", ducking.Threshold,
+			"defaultValue", defaultDuckingThreshold)
+
+		ducking.Threshold = defaultDuckingThreshold
+	}
+
+	ducking.AmountDB = float32(math.Abs(cc.userConfig.GetFloat64(configKeyDuckingAmountDB)))
+
+	releaseMilliseconds := cc.userConfig.GetInt(configKeyDuckingRelease)
+	if releaseMilliseconds < 0 {
+		releaseMilliseconds = 0
+	}
+
+	ducking.Release = time.Duration(releaseMilliseconds) * time.Millisecond
+}
+
+func (cc *CanonicalConfig) populateScenes() {
+	cc.Scenes = make(map[string]sceneConfig)
+
+	for sceneName := range cc.userConfig.GetStringMap(configKeyScenes) {
+		sceneKey := fmt.Sprintf("%s.%s", configKeyScenes, sceneName)
+
+		fade := cc.Fades.Duration
+		if cc.userConfig.IsSet(sceneKey + ".fade") {
+			fade = time.Duration(cc.userConfig.GetInt(sceneKey+".fade")) * time.Millisecond
+		}
+
+		if fade < 0 {
+			fade = 0
+		}
+
+		cc.Scenes[strings.ToLower(sceneName)] = sceneConfig{
+			Volumes: targetVolumesFromConfig(cc.userConfig.GetStringMap(sceneKey + ".volumes")),
+			Fade:    fade,
+			Easing:  cc.parseFadeEasing(sceneKey+".easing", cc.Fades.Easing),
+			Routes:  cc.userConfig.GetStringMapString(sceneKey + ".routes"),
+		}
+	}
+}
+
+func (cc *CanonicalConfig) populateDSP() {
+	cc.DSP = make(map[string]dspParameter)
+
+	for name := range cc.userConfig.GetStringMap(configKeyDSP) {
+		key := func(field string) string {
+			return fmt.Sprintf("%s.%s.%s", configKeyDSP, name, field)
+		}
+
+		parameter := dspParameter{
+			Type:     strings.ToLower(cc.userConfig.GetString(key("type"))),
+			Min:      cc.userConfig.GetFloat64(key("min")),
+			Max:      1,
+			File:     cc.userConfig.GetString(key("file")),
+			Template: cc.userConfig.GetString(key("template")),
+			Address:  cc.userConfig.GetString(key("address")),
+			Path:     cc.userConfig.GetString(key("path")),
+		}
+
+		if cc.userConfig.IsSet(key("max")) {
+			parameter.Max = cc.userConfig.GetFloat64(key("max"))
+		}
+
+		// parameters start out in the middle of their range unless told otherwise (0 dB for a symmetric gain)
+		parameter.Default = (parameter.Min + parameter.Max) / 2
+		if cc.userConfig.IsSet(key("default")) {
+			parameter.Default = cc.userConfig.GetFloat64(key("default"))
+		}
+
+		valid := false
+		switch parameter.Type {
+		case dspTypeEqualizerAPO:
+			valid = parameter.File != "" && strings.Contains(parameter.Template, equalizerAPOValuePlaceholder)
+		case dspTypeOSC:
+			valid = parameter.Address != "" && strings.HasPrefix(parameter.Path, "/")
+		}
+
+		if !valid {
+			cc.logger.Warnw("Ignoring invalid DSP parameter", "name", name, "type", parameter.Type)
+			continue
+		}
+
+		cc.DSP[strings.ToLower(name)] = parameter
+	}
+}
+
+func (cc *CanonicalConfig) populatePushAlerts() {
+	push := &cc.PushAlerts
+
+	push.Enabled = cc.userConfig.GetBool(configKeyPushEnabled)
+	push.Service = strings.ToLower(cc.userConfig.GetString(configKeyPushService))
+	push.NtfyServer = cc.userConfig.GetString(configKeyPushNtfyServer)
+	push.NtfyTopic = cc.userConfig.GetString(configKeyPushNtfyTopic)
+	push.PushoverToken = cc.userConfig.GetString(configKeyPushPushoverToken)
+	push.PushoverUser = cc.userConfig.GetString(configKeyPushPushoverUser)
+	push.WebhookURL = cc.userConfig.GetString(configKeyPushWebhookURL)
+	push.DeviceDisconnected = cc.userConfig.GetBool(configKeyPushDeviceDisconnected)
+
+	micHotMinutes := cc.userConfig.GetInt(configKeyPushMicHotMinutes)
+	if micHotMinutes < 0 {
+		micHotMinutes = 0
+	}
+
+	push.MicHotAfter = time.Duration(micHotMinutes) * time.Minute
+}
+
+func (cc *CanonicalConfig) populateLaunchSync() {
+	cc.LaunchSync.Enabled = cc.userConfig.GetBool(configKeyLaunchSyncEnabled)
+
+	pollMilliseconds := cc.userConfig.GetInt(configKeyLaunchSyncPollInterval)
+	if pollMilliseconds <= 0 {
+		cc.logger.Warnw("Invalid launch sync poll interval, using default",
+			"key", configKeyLaunchSyncPollInterval,
+			"invalidValue", pollMilliseconds,
+			"defaultValue", defaultLaunchSyncPollInterval.Milliseconds())
+
+		pollMilliseconds = int(defaultLaunchSyncPollInterval.Milliseconds())
+	}
+
+	cc.LaunchSync.PollInterval = time.Duration(pollMilliseconds) * time.Millisecond
+}
+
+func (cc *CanonicalConfig) populateNowPlaying() {
+	cc.NowPlaying.Enabled = cc.userConfig.GetBool(configKeyNowPlayingEnabled)
+	cc.NowPlaying.ShowOnDisplay = cc.userConfig.GetBool(configKeyNowPlayingShowOnDisplay)
+
+	pollMilliseconds := cc.userConfig.GetInt(configKeyNowPlayingPollInterval)
+	if pollMilliseconds <= 0 {
+		cc.logger.Warnw("Invalid now playing poll interval, using default",
+			"key", configKeyNowPlayingPollInterval,
+			"invalidValue", pollMilliseconds,
+			"defaultValue", defaultNowPlayingPollInterval.Milliseconds())
+
+		pollMilliseconds = int(defaultNowPlayingPollInterval.Milliseconds())
+	}
+
+	cc.NowPlaying.PollInterval = time.Duration(pollMilliseconds) * time.Millisecond
+}
+
+func (cc *CanonicalConfig) populateSleep() {
+	cc.Sleep.OnLock = cc.userConfig.GetBool(configKeySleepOnLock)
+	cc.Sleep.IdleAfter = 0
+
+	if !cc.userConfig.GetBool(configKeySleepOnIdle) {
+		return
+	}
+
+	idleMinutes := cc.userConfig.GetInt(configKeySleepIdleMinutes)
+	if idleMinutes <= 0 {
+		cc.logger.Warnw("Invalid sleep idle minutes, using default",
+			"key", configKeySleepIdleMinutes,
+			"invalidValue", idleMinutes,
+			"defaultValue", defaultSleepIdleMinutes)
+
+		idleMinutes = defaultSleepIdleMinutes
+	}
+
+	cc.Sleep.IdleAfter = time.Duration(idleMinutes) * time.Minute
+}
+
+func (cc *CanonicalConfig) populateHearingProtection() {
+	hearing := &cc.HearingProtection
+
+	hearing.Enabled = cc.userConfig.GetBool(configKeyHearingEnabled)
+
+	// levels are percentages in the config
+	percent := func(key string, defaultValue int) float32 {
+		value := cc.userConfig.GetInt(key)
+		if value <= 0 || value > 100 {
+			cc.logger.Warnw("Invalid hearing protection level, using default",
+				"key", key,
+				"invalidValue", value,
+				"defaultValue", defaultValue)
+
+			value = defaultValue
+		}
+
+		return float32(value) / 100
+	}
+
+	minutes := func(key string, defaultValue int) time.Duration {
+		value := cc.userConfig.GetInt(key)
+		if value <= 0 {
+			cc.logger.Warnw("Invalid hearing protection minutes, using default",
+				"key", key,
+				"invalidValue", value,
+				"defaultValue", defaultValue)
+
+			value = defaultValue
+		}
+
+		return time.Duration(value) * time.Minute
+	}
+
+	hearing.Level = percent(configKeyHearingLevel, defaultHearingLevel)
+	hearing.LimitTo = percent(configKeyHearingLimitTo, defaultHearingLimitTo)
+	hearing.Duration = minutes(configKeyHearingMinutes, defaultHearingMinutes)
+	hearing.Snooze = minutes(configKeyHearingSnoozeMinutes, defaultHearingSnoozeMinutes)
+}
+
+func (cc *CanonicalConfig) populateAutomation() {
+	cc.Automation.Schedule = scheduledActionsFromConfig(cc.logger, cc.userConfig.Get(configKeyAutomationSchedule))
+
+	location, err := parseTimezone(cc.userConfig.GetString(configKeyAutomationTimezone))
+	if err != nil {
+		cc.logger.Warnw("Invalid automation timezone, using the system's", "key", configKeyAutomationTimezone, "error", err)
+	}
+
+	cc.Automation.Location = location
+
+	overrideMinutes := cc.userConfig.GetInt(configKeyAutomationOverrideMinutes)
+	if overrideMinutes < 0 {
+		cc.logger.Warnw("Invalid automation override minutes, using default",
+			"key", configKeyAutomationOverrideMinutes,
+			"invalidValue", overrideMinutes,
+			"defaultValue", defaultAutomationOverrideMinutes)
+
+		overrideMinutes = defaultAutomationOverrideMinutes
+	}
+
+	cc.Automation.OverrideDuration = time.Duration(overrideMinutes) * time.Minute
+}
+
+func (cc *CanonicalConfig) populateQuietHours() {
+	quiet := &cc.QuietHours
+
+	quiet.Enabled = cc.userConfig.GetBool(configKeyQuietHoursEnabled)
+	quiet.Days = parseWeekdays(cc.userConfig.Get(configKeyQuietHoursDays))
+
+	timeOfDay := func(key string, defaultValue string) int {
+		hour, minute, err := parseTimeOfDay(cc.userConfig.GetString(key))
+		if err != nil {
+			cc.logger.Warnw("Invalid quiet hours time, using default",
+				"key", key,
+				"error", err,
+				"defaultValue", defaultValue)
+
+			hour, minute, _ = parseTimeOfDay(defaultValue)
+		}
+
+		return hour*60 + minute
+	}
+
+	quiet.From = timeOfDay(configKeyQuietHoursFrom, defaultQuietHoursFrom)
+	quiet.To = timeOfDay(configKeyQuietHoursTo, defaultQuietHoursTo)
+
+	// volumes are percentages in the config
+	percent := func(key string, defaultValue int) float32 {
+		value := cc.userConfig.GetInt(key)
+		if value < 0 || value > 100 {
+			cc.logger.Warnw("Invalid quiet hours volume, using default",
+				"key", key,
+				"invalidValue", value,
+				"defaultValue", defaultValue)
+
+			value = defaultValue
+		}
+
+		return float32(value) / 100
+	}
+
+	quiet.Master = percent(configKeyQuietHoursMaster, defaultQuietHoursMaster)
+	quiet.Apps = percent(configKeyQuietHoursApps, defaultQuietHoursApps)
+
+	quiet.LEDTheme = nil
+	if themeName := strings.ToLower(cc.userConfig.GetString(configKeyQuietHoursLEDTheme)); themeName != "" {
+		theme, ok := cc.LEDColors.Themes[themeName]
+		if !ok {
+			cc.logger.Warnw("Unknown LED color theme for quiet hours, leaving the LEDs alone",
+				"key", configKeyQuietHoursLEDTheme,
+				"invalidValue", themeName)
+		} else {
+			quiet.LEDTheme = &theme
+		}
+	}
+}
+
+func (cc *CanonicalConfig) populateHeartbeat() {
+	interval := cc.userConfig.GetInt(configKeyHeartbeatInterval)
+	if interval < 0 {
+		cc.logger.Warnw("Invalid heartbeat interval, using default",
+			"key", configKeyHeartbeatInterval,
+			"invalidValue", interval,
+			"defaultValue", defaultHeartbeatIntervalSeconds)
+
+		interval = defaultHeartbeatIntervalSeconds
+	}
+
+	silence := cc.userConfig.GetInt(configKeyHeartbeatSilence)
+	if silence < 0 {
+		cc.logger.Warnw("Invalid heartbeat silence timeout, using default",
+			"key", configKeyHeartbeatSilence,
+			"invalidValue", silence,
+			"defaultValue", defaultHeartbeatSilenceSeconds)
+
+		silence = defaultHeartbeatSilenceSeconds
+	}
+
+	cc.Heartbeat.Interval = time.Duration(interval) * time.Second
+	cc.Heartbeat.SilenceTimeout = time.Duration(silence) * time.Second
+}
+
+func (cc *CanonicalConfig) populateJitterBuffer() {
+	maxMillis := cc.userConfig.GetInt(configKeyJitterBufferMax)
+	if maxMillis < 0 {
+		cc.logger.Warnw("Invalid jitter buffer delay, using default",
+			"key", configKeyJitterBufferMax,
+			"invalidValue", maxMillis,
+			"defaultValue", defaultJitterBufferMaxMillis)
+
+		maxMillis = defaultJitterBufferMaxMillis
+	}
+
+	cc.JitterBuffer.MaxDelay = time.Duration(maxMillis) * time.Millisecond
+}
+
+func (cc *CanonicalConfig) populateAPI() {
+	cc.API.Enabled = cc.userConfig.GetBool(configKeyAPIEnabled)
+	cc.API.Metrics = cc.userConfig.GetBool(configKeyAPIMetrics)
+
+	cc.API.Address = strings.TrimSpace(cc.userConfig.GetString(configKeyAPIAddress))
+	if cc.API.Address == "" || cc.API.Address == "localhost" {
+		cc.API.Address = defaultAPIAddress
+	} else if net.ParseIP(cc.API.Address) == nil {
+		cc.logger.Warnw("Invalid API address, using default",
+			"key", configKeyAPIAddress,
+			"invalidValue", cc.API.Address,
+			"defaultValue", defaultAPIAddress)
+
+		cc.API.Address = defaultAPIAddress
+	}
+
+	cc.API.Port = cc.userConfig.GetInt(configKeyAPIPort)
+	if cc.API.Port <= 0 || cc.API.Port > 65535 {
+		cc.logger.Warnw("Invalid API port, using default",
+			"key", configKeyAPIPort,
+			"invalidValue", cc.API.Port,
+			"defaultValue", defaultAPIPort)
+
+		cc.API.Port = defaultAPIPort
+	}
+
+	cc.EventLogSize = cc.userConfig.GetInt(configKeyEventLogSize)
+	if cc.EventLogSize <= 0 {
+		cc.logger.Warnw("Invalid event log size, using default",
+			"key", configKeyEventLogSize,
+			"invalidValue", cc.EventLogSize,
+			"defaultValue", defaultEventLogSize)
+
+		cc.EventLogSize = defaultEventLogSize
+	}
+}
+
 func (cc *CanonicalConfig) onConfigReloaded() {
 	cc.logger.Debug("Notifying consumers about configuration reload")
 
-	for _, consumer := range cc.reloadConsumers {
-		consumer <- true
+	cc.reloads.publish(true)
+}
+
+// targetVolumesFromConfig parses a "target: percent" object (e.g. "spotify.exe: 15") into volume scalars
+func targetVolumesFromConfig(raw map[string]interface{}) map[string]float32 {
+	volumes := make(map[string]float32, len(raw))
+
+	for target, value := range raw {
+		percent, err := strconv.ParseFloat(fmt.Sprint(value), 32)
+		if err != nil {
+			continue
+		}
+
+		volumes[strings.ToLower(target)] = float32(math.Max(0, math.Min(100, percent)) / 100)
+	}
+
+	return volumes
+}
+
+// toStringMap converts a nested YAML object (as decoded by viper) into a string-keyed map
+func (cc *CanonicalConfig) populateLEDColors() {
+	ledColors := &cc.LEDColors
+
+	ledColors.Mode = strings.ToLower(cc.userConfig.GetString(configKeyLEDColorMode))
+
+	// an unquoted off is a boolean as far as YAML is concerned
+	if ledColors.Mode == "false" {
+		ledColors.Mode = ledColorModeOff
+	}
+
+	switch ledColors.Mode {
+	case ledColorModeOff, ledColorModeTarget, ledColorModeVolume, ledColorModePeak:
+	default:
+		cc.logger.Warnw("Invalid LED color mode, using default",
+			"key", configKeyLEDColorMode,
+			"invalidValue", ledColors.Mode,
+			"defaultValue", defaultLEDColorMode)
+
+		ledColors.Mode = defaultLEDColorMode
+	}
+
+	if ledColors.Mode == ledColorModePeak && cc.LEDMode != LEDModeAudio {
+		cc.logger.Warnw("LED colors follow audio peaks, which needs audio LED mode - LEDs will use the active color",
+			"key", configKeyLEDColorMode,
+			"ledMode", cc.LEDMode)
+	}
+
+	// user themes can be new ones, or change some colors of a built-in one
+	themes := make(map[string]ledColorTheme, len(builtInLEDColorThemes))
+	for name, theme := range builtInLEDColorThemes {
+		themes[name] = theme
+	}
+
+	for name, value := range cc.userConfig.GetStringMap(configKeyLEDColorThemes) {
+		base, ok := builtInLEDColorThemes[name]
+		if !ok {
+			base = builtInLEDColorThemes[defaultLEDColorTheme]
+		}
+
+		theme, err := ledThemeFromConfig(value, base)
+		if err != nil {
+			cc.logger.Warnw("Invalid LED color theme, ignoring", "theme", name, "invalidValue", value, "error", err)
+			continue
+		}
+
+		themes[name] = theme
+	}
+
+	themeName := strings.ToLower(cc.userConfig.GetString(configKeyLEDColorTheme))
+	theme, ok := themes[themeName]
+	if !ok {
+		cc.logger.Warnw("Unknown LED color theme, using default",
+			"key", configKeyLEDColorTheme,
+			"invalidValue", themeName,
+			"defaultValue", defaultLEDColorTheme)
+
+		theme = themes[defaultLEDColorTheme]
 	}
+
+	ledColors.Theme = theme
+	ledColors.Themes = themes
+
+	ledColors.Targets = map[string]protocol.Color{}
+	for target, value := range cc.userConfig.GetStringMap(configKeyLEDColorTargets) {
+		color, err := parseLEDColor(value)
+		if err != nil {
+			cc.logger.Warnw("Invalid LED color for target, ignoring", "target", target, "invalidValue", value, "error", err)
+			continue
+		}
+
+		ledColors.Targets[strings.ToLower(target)] = color
+	}
+}
+
+func (cc *CanonicalConfig) populateBackend() {
+	cc.Backend.Name = strings.ToLower(cc.userConfig.GetString(configKeyBackend))
+	cc.Backend.Server = cc.userConfig.GetString(configKeyBackendServer)
+
+	if !validBackend(cc.Backend.Name) {
+		cc.logger.Warnw("Invalid audio backend, using default",
+			"key", configKeyBackend,
+			"invalidValue", cc.Backend.Name,
+			"defaultValue", defaultBackend)
+
+		cc.Backend.Name = defaultBackend
+	}
+}
+
+func (cc *CanonicalConfig) populateSerialFraming() {
+	cc.SerialFraming = strings.ToLower(cc.userConfig.GetString(configKeySerialFraming))
+
+	if cc.SerialFraming != serialFramingText && cc.SerialFraming != serialFramingBinary {
+		cc.logger.Warnw("Invalid serial framing, using default",
+			"key", configKeySerialFraming,
+			"invalidValue", cc.SerialFraming,
+			"defaultValue", defaultSerialFraming)
+
+		cc.SerialFraming = defaultSerialFraming
+	}
+}
+
+func (cc *CanonicalConfig) populateUploadReset() {
+	cc.UploadReset = strings.ToLower(cc.userConfig.GetString(configKeyUploadReset))
+
+	if !validUploadReset(cc.UploadReset) {
+		cc.logger.Warnw("Invalid upload reset, using default",
+			"key", configKeyUploadReset,
+			"invalidValue", cc.UploadReset,
+			"defaultValue", defaultUploadReset)
+
+		cc.UploadReset = defaultUploadReset
+	}
+}
+
+func (cc *CanonicalConfig) populateLEDAnimation() {
+	animation := &cc.LEDAnimation
+
+	animation.Effect = strings.ToLower(cc.userConfig.GetString(configKeyLEDAnimationEffect))
+
+	// an unquoted off is a boolean as far as YAML is concerned
+	if animation.Effect == "false" {
+		animation.Effect = ledAnimationOff
+	}
+
+	switch animation.Effect {
+	case ledAnimationOff, ledAnimationBreathing, ledAnimationChase, ledAnimationRainbow:
+	default:
+		cc.logger.Warnw("Invalid LED animation effect, using default",
+			"key", configKeyLEDAnimationEffect,
+			"invalidValue", animation.Effect,
+			"defaultValue", defaultLEDAnimation)
+
+		animation.Effect = defaultLEDAnimation
+	}
+
+	idleMinutes := cc.userConfig.GetInt(configKeyLEDAnimationIdleMinutes)
+	if idleMinutes <= 0 {
+		cc.logger.Warnw("Invalid LED animation idle minutes, using default",
+			"key", configKeyLEDAnimationIdleMinutes,
+			"invalidValue", idleMinutes,
+			"defaultValue", defaultLEDAnimationIdleMinutes)
+
+		idleMinutes = defaultLEDAnimationIdleMinutes
+	}
+
+	animation.IdleAfter = time.Duration(idleMinutes) * time.Minute
+
+	cycleMilliseconds := cc.userConfig.GetInt(configKeyLEDAnimationCycleTime)
+	if cycleMilliseconds < int(ledAnimationFrameInterval.Milliseconds()) {
+		cc.logger.Warnw("Invalid LED animation cycle time, using default",
+			"key", configKeyLEDAnimationCycleTime,
+			"invalidValue", cycleMilliseconds,
+			"defaultValue", defaultLEDAnimationCycleMillis)
+
+		cycleMilliseconds = defaultLEDAnimationCycleMillis
+	}
+
+	animation.Cycle = time.Duration(cycleMilliseconds) * time.Millisecond
+}
+
+func (cc *CanonicalConfig) populateVUMeter() {
+	cc.VUMeter.Enabled = cc.userConfig.GetBool(configKeyVUMeterEnabled)
+
+	if cc.VUMeter.Enabled && cc.LEDMode != LEDModeAudio {
+		cc.logger.Warnw("VU meters follow audio peaks, which needs audio LED mode - they won't be sent",
+			"key", configKeyVUMeterEnabled,
+			"ledMode", cc.LEDMode)
+	}
+
+	cc.VUMeter.Segments = cc.userConfig.GetInt(configKeyVUMeterSegments)
+	if cc.VUMeter.Segments < 1 || cc.VUMeter.Segments > maxVUMeterSegments {
+		cc.logger.Warnw("Invalid VU meter segment count, using default",
+			"key", configKeyVUMeterSegments,
+			"invalidValue", cc.VUMeter.Segments,
+			"defaultValue", defaultVUMeterSegments)
+
+		cc.VUMeter.Segments = defaultVUMeterSegments
+	}
+}
+
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		return typedValue, true
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typedValue))
+		for key, v := range typedValue {
+			result[strings.ToLower(fmt.Sprint(key))] = v
+		}
+
+		return result, true
+	}
+
+	return nil, false
 }
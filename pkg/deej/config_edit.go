@@ -0,0 +1,145 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keys and values that can go into the config as they are, without quotes
+var plainYAMLScalarPattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.\-]*$`)
+
+// words YAML would read as something other than a string
+var reservedYAMLScalars = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "null": true, "~": true,
+}
+
+// replaceConfigSection swaps a top-level section of the user's config.yaml for the given lines (indented as they
+// should be), leaving everything around it - comments included - as it was. commented-out lines at the end of the
+// section (like the examples deej ships with) are kept after the new lines. a section that isn't there yet is
+// added at the end
+func replaceConfigSection(contents string, key string, lines []string) string {
+	fileLines := strings.Split(contents, "\n")
+	header := key + ":"
+
+	start := -1
+	for idx, line := range fileLines {
+		if line == header || strings.HasPrefix(line, header+" ") {
+			start = idx
+			break
+		}
+	}
+
+	section := append([]string{header}, lines...)
+	if len(lines) == 0 {
+		section = []string{header + " {}"}
+	}
+
+	if start == -1 {
+		return strings.TrimRight(contents, "\n") + "\n\n" + strings.Join(section, "\n") + "\n"
+	}
+
+	// the section runs for as long as lines are indented, with blank lines counting only if more of it follows
+	end := start + 1
+	lastContent := start
+	for end < len(fileLines) {
+		line := fileLines[end]
+
+		if strings.TrimSpace(line) == "" {
+			end++
+			continue
+		}
+
+		if line[0] != ' ' && line[0] != '\t' {
+			break
+		}
+
+		lastContent = end
+		end++
+	}
+
+	// trailing commented-out lines stay
+	trailing := []string{}
+	for idx := lastContent; idx > start; idx-- {
+		if !strings.HasPrefix(strings.TrimSpace(fileLines[idx]), "#") {
+			break
+		}
+
+		trailing = append([]string{fileLines[idx]}, trailing...)
+	}
+
+	section = append(section, trailing...)
+
+	result := append([]string{}, fileLines[:start]...)
+	result = append(result, section...)
+	result = append(result, fileLines[lastContent+1:]...)
+
+	return strings.Join(result, "\n")
+}
+
+// writeConfigSections replaces the given sections of the user's config (see replaceConfigSection), each in the file
+// it comes from - config.yaml, or one it includes. the config watcher picks the change up like any other edit
+func (cc *CanonicalConfig) writeConfigSections(sections map[string][]string) error {
+	byFile := map[string]map[string][]string{}
+	for key, lines := range sections {
+		file := cc.configFileFor(key)
+
+		if byFile[file] == nil {
+			byFile[file] = map[string][]string{}
+		}
+
+		byFile[file][key] = lines
+	}
+
+	for file, fileSections := range byFile {
+		if err := writeConfigFileSections(file, fileSections); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeConfigFileSections(file string, sections map[string][]string) error {
+	info, err := os.Stat(file)
+	if err != nil {
+		return fmt.Errorf("stat config file: %w", err)
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	updated := string(contents)
+
+	keys := make([]string, 0, len(sections))
+	for key := range sections {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		updated = replaceConfigSection(updated, key, sections[key])
+	}
+
+	if err := ioutil.WriteFile(file, []byte(updated), info.Mode()); err != nil {
+		return fmt.Errorf("write config file %s: %w", file, err)
+	}
+
+	return nil
+}
+
+// yamlScalar writes a string the way it'd be written by hand: as it is where that's unambiguous, quoted otherwise
+func yamlScalar(value string) string {
+	if plainYAMLScalarPattern.MatchString(value) && !reservedYAMLScalars[strings.ToLower(value)] {
+		return value
+	}
+
+	return strconv.Quote(value)
+}
@@ -0,0 +1,190 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// ${NAME} is replaced with the environment variable, and $${NAME} is left as a literal ${NAME}. a bare $NAME isn't
+// expanded, as regex targets are full of dollar signs
+var configEnvVarPattern = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandConfigValues expands environment variables and ~ in every string value of the user config (config.yaml and
+// everything it includes), so that one config works across machines and user accounts. it runs on each load, with
+// deej's own environment, and anything that isn't set is left as it is. the values as written are kept aside,
+// for anything that writes the config back
+func (cc *CanonicalConfig) expandConfigValues() error {
+	missing := map[string]bool{}
+	settings := cc.userConfig.AllSettings()
+
+	// viper hands out some of its own maps in AllSettings, which merging the expanded values would change
+	unexpanded := viper.New()
+	if err := unexpanded.MergeConfigMap(copyConfigValue(settings).(map[string]interface{})); err != nil {
+		return fmt.Errorf("keep unexpanded config values: %w", err)
+	}
+
+	cc.unexpandedConfig = unexpanded
+
+	changed, ok := expandConfigValue(settings, true, missing)
+	if ok {
+		if err := cc.userConfig.MergeConfigMap(changed.(map[string]interface{})); err != nil {
+			return fmt.Errorf("merge expanded config values: %w", err)
+		}
+	}
+
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		cc.logger.Warnw("Config refers to environment variables that aren't set, leaving them as they are",
+			"variables", names)
+	}
+
+	return nil
+}
+
+// configAsWritten returns the user config without environment variables and home directories filled in, or the
+// config itself if it was never loaded
+func (cc *CanonicalConfig) configAsWritten() *viper.Viper {
+	if cc.unexpandedConfig == nil {
+		return cc.userConfig
+	}
+
+	return cc.unexpandedConfig
+}
+
+// expandConfigValue expands a config value, and reports whether that changed it. with sparse set, a map comes back
+// with only its changed values, ready to merge over the original. lists are always replaced whole, so the maps in
+// them come back whole too
+func expandConfigValue(value interface{}, sparse bool, missing map[string]bool) (interface{}, bool) {
+	switch typed := value.(type) {
+	case string:
+		expanded := expandConfigString(typed, missing)
+		return expanded, expanded != typed
+
+	case map[string]interface{}:
+		result := map[string]interface{}{}
+		anyChanged := false
+
+		for key, entry := range typed {
+			expanded, changed := expandConfigValue(entry, sparse, missing)
+			if changed || !sparse {
+				result[key] = expanded
+			}
+
+			anyChanged = anyChanged || changed
+		}
+
+		return result, anyChanged
+
+	case map[interface{}]interface{}:
+		result := map[interface{}]interface{}{}
+		anyChanged := false
+
+		for key, entry := range typed {
+			expanded, changed := expandConfigValue(entry, false, missing)
+			result[key] = expanded
+			anyChanged = anyChanged || changed
+		}
+
+		return result, anyChanged
+
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		anyChanged := false
+
+		for idx, entry := range typed {
+			expanded, changed := expandConfigValue(entry, false, missing)
+			result[idx] = expanded
+			anyChanged = anyChanged || changed
+		}
+
+		return result, anyChanged
+
+	case []string:
+		result := make([]string, len(typed))
+		anyChanged := false
+
+		for idx, entry := range typed {
+			result[idx] = expandConfigString(entry, missing)
+			anyChanged = anyChanged || result[idx] != entry
+		}
+
+		return result, anyChanged
+	}
+
+	return value, false
+}
+
+// copyConfigValue deep copies a config value's maps and lists
+func copyConfigValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, entry := range typed {
+			result[key] = copyConfigValue(entry)
+		}
+
+		return result
+
+	case map[interface{}]interface{}:
+		result := make(map[interface{}]interface{}, len(typed))
+		for key, entry := range typed {
+			result[key] = copyConfigValue(entry)
+		}
+
+		return result
+
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for idx, entry := range typed {
+			result[idx] = copyConfigValue(entry)
+		}
+
+		return result
+
+	case []string:
+		return append([]string{}, typed...)
+	}
+
+	return value
+}
+
+// expandConfigString replaces ${NAME} with the environment variable's value, and a leading ~ with the user's home
+// directory. variables that aren't set are added to missing
+func expandConfigString(value string, missing map[string]bool) string {
+	if strings.HasPrefix(value, "~/") || strings.HasPrefix(value, `~\`) {
+		if home, err := os.UserHomeDir(); err == nil {
+			value = home + value[1:]
+		}
+	}
+
+	if !strings.Contains(value, "${") {
+		return value
+	}
+
+	return configEnvVarPattern.ReplaceAllStringFunc(value, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+
+		name := configEnvVarPattern.FindStringSubmatch(match)[1]
+
+		expanded, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+			return match
+		}
+
+		return expanded
+	})
+}
@@ -0,0 +1,122 @@
+package deej
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// upstream deej's (github.com/omriharel/deej) configs only have a handful of options, which this fork reads the
+// same way - apart from ones upstream itself dropped. importing one clears those out of the way and spells out the
+// options this fork's built around, so the user has somewhere to start from rather than a config that looks like
+// nothing changed
+
+// an option older upstream versions had, from before deej noticed new apps by itself
+const upstreamConfigKeyProcessRefresh = "process_refresh_frequency"
+
+// every option an upstream config can have. a config with anything else was written for this fork
+var upstreamConfigKeys = map[string]bool{
+	configKeySliderMapping:          true,
+	configKeyInvertSliders:          true,
+	configKeyCOMPort:                true,
+	configKeyBaudRate:               true,
+	configKeyNoiseReductionLevel:    true,
+	upstreamConfigKeyProcessRefresh: true,
+}
+
+// what's worth pointing someone coming from upstream at, by the config option that turns it on
+var upstreamImportFeatures = []struct {
+	name string
+	key  string
+}{
+	{"buttons", configKeyButtonMapping},
+	{"profiles", configKeyProfiles},
+	{"LED modes", configKeyLEDMode},
+	{"scenes", configKeyScenes},
+	{"display pages", "display_pages"},
+	{"ducking", "ducking"},
+	{"the local API", "api"},
+}
+
+var upstreamProcessRefreshLinePattern = regexp.MustCompile(`(?m)^` + upstreamConfigKeyProcessRefresh + `:.*$`)
+
+// the options this fork adds for the hardware upstream deej runs on, appended to an imported config. every other
+// option's default is the same as not having it
+const upstreamImportedOptions = `
+# imported from upstream deej - your slider_mapping above is the "default" profile, and these are new. the
+# config.yaml that comes with this version of deej explains every option, including the ones not listed here
+
+# LED mode: "process" (LED on when app is running) or "audio" (LED on when app is outputting audio), for boards
+# with an LED per slider
+led_mode: ` + defaultLEDMode + `
+
+# what the board's buttons do, by button index (firmware sends #B<index> when one is clicked)
+button_mapping: {}
+#   0: media.play_pause
+#   1: mic.toggle_mute
+
+# optional named profiles, each with its own slider mapping, to switch between from the tray menu
+# profiles:
+#   gaming:
+#     slider_mapping:
+#       0: master
+#       1: game.exe
+`
+
+// upstreamImport is what importing an upstream config did, for telling the user
+type upstreamImport struct {
+	converted []string
+	available []string
+}
+
+// isUpstreamConfig returns whether the given config text is upstream deej's, going by it having nothing but the
+// options upstream has
+func isUpstreamConfig(contents string) bool {
+	parsed := viper.New()
+	parsed.SetConfigType(configType)
+
+	if err := parsed.ReadConfig(strings.NewReader(contents)); err != nil {
+		return false
+	}
+
+	settings := parsed.AllSettings()
+	if _, ok := settings[configKeySliderMapping]; !ok {
+		return false
+	}
+
+	for key := range settings {
+		if !upstreamConfigKeys[key] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// importUpstreamConfig rewrites an upstream config's text into this fork's, returning it and what was done
+func importUpstreamConfig(contents string) (string, upstreamImport) {
+	result := upstreamImport{
+		converted: []string{"slider_mapping is now the default profile"},
+	}
+
+	// commented out rather than removed, like anything else the user wrote
+	if upstreamProcessRefreshLinePattern.MatchString(contents) {
+		contents = upstreamProcessRefreshLinePattern.ReplaceAllStringFunc(contents, func(line string) string {
+			return "# no longer used, deej picks up new apps as they start\n# " + line
+		})
+
+		result.converted = append(result.converted, upstreamConfigKeyProcessRefresh+" is no longer used")
+	}
+
+	contents = strings.TrimRight(contents, "\n") + "\n" + upstreamImportedOptions
+	result.converted = append(result.converted, fmt.Sprintf("added %s and %s, with an example of %s",
+		configKeyLEDMode, configKeyButtonMapping, configKeyProfiles))
+
+	for _, feature := range upstreamImportFeatures {
+		result.available = append(result.available, fmt.Sprintf("%s (%s)", feature.name, feature.key))
+	}
+
+	return contents, result
+}
@@ -0,0 +1,205 @@
+package deej
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+)
+
+const configKeyInclude = "include"
+
+// mergeIncludes merges the files listed under config.yaml's include into the user config, in the order they're listed
+// (files matched by one pattern go in name order), each overriding what came before it. maps (like slider_mapping)
+// are merged key by key, anything else is replaced whole. included files can't include others
+func (cc *CanonicalConfig) mergeIncludes() error {
+	patterns := []string{}
+	files := []string{}
+	sections := map[string]string{}
+
+	for _, include := range cc.userConfig.GetStringSlice(configKeyInclude) {
+
+		// unset variables leave a pattern that won't match anything, which is warned about below
+		pattern := expandConfigString(include, map[string]bool{})
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(userConfigPath, pattern)
+		}
+
+		patterns = append(patterns, filepath.Clean(pattern))
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			cc.logger.Warnw("Ignoring invalid include pattern", "include", include, "error", err)
+			continue
+		}
+
+		if len(matches) == 0 {
+			cc.logger.Warnw("Included config file not found", "include", include)
+			continue
+		}
+
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+
+	// set before merging, so that an included file that fails to load is still watched for its fix
+	cc.includePatterns = patterns
+
+	for _, file := range files {
+		settings, err := cc.mergeConfigFile(file)
+		if err != nil {
+			return err
+		}
+
+		for key := range settings {
+			sections[key] = file
+		}
+	}
+
+	if len(files) > 0 {
+		cc.logger.Debugw("Merged included config files", "files", files)
+	}
+
+	cc.includedSections = sections
+
+	return nil
+}
+
+// mergeConfigFile merges a single file (an included one, or config.local.yaml) over the user config, returning the
+// top-level sections it set
+func (cc *CanonicalConfig) mergeConfigFile(file string) (map[string]interface{}, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read config %s: %w", file, err)
+	}
+
+	included := viper.New()
+	included.SetConfigType(configType)
+
+	if err := included.ReadConfig(bytes.NewReader(contents)); err != nil {
+		if strings.Contains(err.Error(), "yaml:") {
+			cc.notifier.Notify("Invalid configuration!",
+				fmt.Sprintf("Please make sure %s is in a valid YAML format.", file))
+		}
+
+		return nil, fmt.Errorf("read config %s: %w", file, err)
+	}
+
+	settings := included.AllSettings()
+	if _, ok := settings[configKeyInclude]; ok {
+		cc.logger.Warnw("Only config.yaml can include other files, ignoring this one's include", "file", file)
+		delete(settings, configKeyInclude)
+	}
+
+	if err := cc.userConfig.MergeConfigMap(settings); err != nil {
+		return nil, fmt.Errorf("merge config %s: %w", file, err)
+	}
+
+	return settings, nil
+}
+
+// configFileFor returns the file a top-level section of the config comes from, so that edits to it (like the
+// dashboard's) go where they'll take effect: config.local.yaml or the last included file that has it, or config.yaml
+func (cc *CanonicalConfig) configFileFor(key string) string {
+	if file, ok := cc.includedSections[key]; ok {
+		return file
+	}
+
+	return userConfigFilepath
+}
+
+// includeWatcher reloads the config when an included file changes. viper only watches config.yaml itself, so
+// this watches the directories included files are in, and picks out the events for them
+type includeWatcher struct {
+	cc      *CanonicalConfig
+	watcher *fsnotify.Watcher
+
+	lock    sync.Mutex
+	watched map[string]bool
+}
+
+func (cc *CanonicalConfig) watchIncludedFiles(reload func()) (*includeWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create include watcher: %w", err)
+	}
+
+	iw := &includeWatcher{
+		cc:      cc,
+		watcher: watcher,
+		watched: map[string]bool{},
+	}
+
+	iw.sync()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+
+				if event.Op == fsnotify.Chmod || !iw.included(event.Name) {
+					continue
+				}
+
+				cc.logger.Debugw("Included config file modified", "event", event)
+				reload()
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+
+				cc.logger.Warnw("Include watcher error", "error", err)
+			}
+		}
+	}()
+
+	return iw, nil
+}
+
+// sync watches the directories of everything config.yaml includes now
+func (iw *includeWatcher) sync() {
+	iw.lock.Lock()
+	defer iw.lock.Unlock()
+
+	for _, pattern := range iw.cc.includePatterns {
+		directory := filepath.Dir(pattern)
+		if iw.watched[directory] {
+			continue
+		}
+
+		if err := iw.watcher.Add(directory); err != nil {
+			iw.cc.logger.Warnw("Failed to watch included config files", "directory", directory, "error", err)
+			continue
+		}
+
+		iw.watched[directory] = true
+	}
+}
+
+func (iw *includeWatcher) included(name string) bool {
+	name = filepath.Clean(name)
+
+	for _, pattern := range iw.cc.includePatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (iw *includeWatcher) close() {
+	if err := iw.watcher.Close(); err != nil {
+		iw.cc.logger.Debugw("Failed to close include watcher", "error", err)
+	}
+}
@@ -0,0 +1,34 @@
+package deej
+
+import (
+	"path/filepath"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// config.local.yaml sits next to config.yaml and overrides it (and everything it includes) on this machine only, so
+// a config synced between machines can keep its per-machine settings (like com_port) out of the shared file
+const localConfigFilepath = "config.local.yaml"
+
+// mergeLocalConfig merges config.local.yaml over the user config, if there is one. it merges like an included file,
+// but always last, and is watched for changes even while it doesn't exist so that creating it takes effect too
+func (cc *CanonicalConfig) mergeLocalConfig() error {
+	cc.includePatterns = append(cc.includePatterns, filepath.Clean(filepath.Join(userConfigPath, localConfigFilepath)))
+
+	if !util.FileExists(localConfigFilepath) {
+		return nil
+	}
+
+	settings, err := cc.mergeConfigFile(localConfigFilepath)
+	if err != nil {
+		return err
+	}
+
+	for key := range settings {
+		cc.includedSections[key] = localConfigFilepath
+	}
+
+	cc.logger.Debugw("Merged per-machine config", "path", localConfigFilepath)
+
+	return nil
+}
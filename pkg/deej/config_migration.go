@@ -0,0 +1,164 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	configKeyConfigVersion = "config_version"
+
+	// the original is kept next to the config, named after the version it was written for
+	configBackupFilepathFormat = "%s.v%d.bak"
+)
+
+// configMigration upgrades the text of a config.yaml by one version. migrations work on the file's text, like the
+// dashboard's edits do (see config_edit.go), so that comments and the user's own layout survive them
+type configMigration struct {
+	description string
+	apply       func(contents string) string
+}
+
+// configMigrations[n] takes a config from version n to n+1. when an option is renamed or restructured, add a
+// migration here that rewrites the old form into the new one - never change one that's already shipped
+var configMigrations = []configMigration{
+
+	// configs without a version (this fork's from before config_version, and upstream deej's once imported - see
+	// config_import.go) already load as they are. they're left without one until a later migration changes them
+	{"configs from before config_version", func(contents string) string { return contents }},
+}
+
+// the version configs are written for by this build of deej
+var currentConfigVersion = len(configMigrations)
+
+var configVersionLinePattern = regexp.MustCompile(`(?m)^` + configKeyConfigVersion + `:.*$`)
+
+// migrate upgrades the user's config if it was written for an older version of deej, backing up the original
+// first. the upgraded config is what's loaded, even if it can't be written back
+func (cc *CanonicalConfig) migrate() {
+	version := cc.userConfig.GetInt(configKeyConfigVersion)
+
+	if version == currentConfigVersion {
+		return
+	}
+
+	if version < 0 {
+		cc.logger.Warnw("Config has an invalid version, not migrating it",
+			"key", configKeyConfigVersion,
+			"invalidValue", version)
+
+		return
+	}
+
+	if version > currentConfigVersion {
+		cc.logger.Warnw("Config is from a newer version of deej, options it added may be ignored",
+			"version", version,
+			"supportedVersion", currentConfigVersion)
+
+		return
+	}
+
+	info, err := os.Stat(userConfigFilepath)
+	if err != nil {
+		cc.logger.Warnw("Failed to stat config file for migration", "error", err)
+		return
+	}
+
+	contents, err := ioutil.ReadFile(userConfigFilepath)
+	if err != nil {
+		cc.logger.Warnw("Failed to read config file for migration", "error", err)
+		return
+	}
+
+	source := string(contents)
+
+	// upstream deej's configs are imported into this fork's first, then upgraded like any other
+	var imported *upstreamImport
+	if version == 0 && isUpstreamConfig(source) {
+		converted, result := importUpstreamConfig(source)
+		source, imported = converted, &result
+	}
+
+	migrated, applied := migrateConfig(source, version)
+
+	// nothing needed changing, so the file's left exactly as it is - without a backup, or its version recorded
+	if migrated == string(contents) {
+		cc.logger.Debugw("Config needs no migrating", "version", version)
+		return
+	}
+
+	migrated = setConfigVersion(migrated, currentConfigVersion)
+
+	if err := cc.userConfig.ReadConfig(strings.NewReader(migrated)); err != nil {
+		cc.logger.Warnw("Failed to load migrated config, using it as it was", "error", err)
+
+		// put the original back, as that's what the rest of loading expects to find
+		cc.userConfig.ReadConfig(strings.NewReader(string(contents)))
+
+		return
+	}
+
+	cc.logger.Infow("Migrated config", "from", version, "to", currentConfigVersion, "migrations", applied)
+
+	if imported != nil {
+		cc.logger.Infow("Imported upstream deej config", "converted", imported.converted, "available", imported.available)
+	}
+
+	// an existing backup is from an even earlier migration, and closer to what the user wrote
+	backupFilepath := fmt.Sprintf(configBackupFilepathFormat, userConfigFilepath, version)
+	if _, err := os.Stat(backupFilepath); os.IsNotExist(err) {
+		if err := ioutil.WriteFile(backupFilepath, contents, info.Mode()); err != nil {
+			cc.logger.Warnw("Failed to back up config before migrating, leaving the file as it is", "error", err)
+			return
+		}
+	}
+
+	if err := ioutil.WriteFile(userConfigFilepath, []byte(migrated), info.Mode()); err != nil {
+		cc.logger.Warnw("Failed to write migrated config, it'll be migrated again next time", "error", err)
+		return
+	}
+
+	if imported != nil {
+		cc.notifier.Notify("Configuration imported",
+			fmt.Sprintf("%s was imported from upstream deej: %s. New to try: %s. The original is saved as %s.",
+				userConfigFilepath, strings.Join(imported.converted, ", "), strings.Join(imported.available, ", "), backupFilepath))
+
+		return
+	}
+
+	cc.notifier.Notify("Configuration upgraded",
+		fmt.Sprintf("%s was upgraded for this version of deej. The original is saved as %s.", userConfigFilepath, backupFilepath))
+}
+
+// migrateConfig runs every migration from the given version on, returning the upgraded config and the migrations
+// that changed it
+func migrateConfig(contents string, version int) (string, []string) {
+	applied := []string{}
+
+	for _, migration := range configMigrations[version:] {
+		migrated := migration.apply(contents)
+
+		if migrated != contents {
+			applied = append(applied, migration.description)
+		}
+
+		contents = migrated
+	}
+
+	return contents, applied
+}
+
+// setConfigVersion updates the config's version line, or adds one at the top if it has none
+func setConfigVersion(contents string, version int) string {
+	line := fmt.Sprintf("%s: %d", configKeyConfigVersion, version)
+
+	if configVersionLinePattern.MatchString(contents) {
+		return configVersionLinePattern.ReplaceAllLiteralString(contents, line)
+	}
+
+	return fmt.Sprintf("# the version of deej this config was written for, which upgrades it as needed (leave this as it is)\n%s\n\n%s",
+		line, contents)
+}
@@ -0,0 +1,122 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// loadConfigForMigration loads the config.yaml in the working directory, returning what was logged while loading it
+func loadConfigForMigration(t *testing.T) *observer.ObservedLogs {
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	cc, err := NewConfig(logger, &loggingNotifier{logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cc.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	return logs
+}
+
+func readConfigFile(t *testing.T) string {
+	contents, err := ioutil.ReadFile(userConfigFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(contents)
+}
+
+// with nothing to migrate, an unversioned config shouldn't be touched on its first run
+func TestMigrationLeavesUnchangedConfigAlone(t *testing.T) {
+	original := "slider_mapping:\n  0: master\nbackend: dummy\n"
+	inTempDir(t, original)
+
+	loadConfigForMigration(t)
+
+	if contents := readConfigFile(t); contents != original {
+		t.Errorf("config was rewritten without anything to migrate:\n%s", contents)
+	}
+
+	if _, err := os.Stat(fmt.Sprintf(configBackupFilepathFormat, userConfigFilepath, 0)); !os.IsNotExist(err) {
+		t.Error("config was backed up without anything to migrate")
+	}
+}
+
+func TestMigrationRewritesChangedConfig(t *testing.T) {
+	original := "slider_mapping:\n  0: master\nbackend: dummy\nold_option: true\n"
+	inTempDir(t, original)
+
+	// a release renaming old_option, as the next version
+	migrations := configMigrations
+	t.Cleanup(func() {
+		configMigrations = migrations
+		currentConfigVersion = len(configMigrations)
+	})
+
+	configMigrations = append(migrations[:len(migrations):len(migrations)], configMigration{
+		"rename old_option", func(contents string) string {
+			return strings.Replace(contents, "old_option:", "new_option:", 1)
+		},
+	})
+	currentConfigVersion = len(configMigrations)
+
+	loadConfigForMigration(t)
+
+	contents := readConfigFile(t)
+
+	if !strings.Contains(contents, "new_option: true") || strings.Contains(contents, "old_option") {
+		t.Errorf("expected old_option to be renamed:\n%s", contents)
+	}
+
+	if !strings.Contains(contents, fmt.Sprintf("%s: %d", configKeyConfigVersion, currentConfigVersion)) {
+		t.Errorf("expected the migrated config to have its version recorded:\n%s", contents)
+	}
+
+	backup, err := ioutil.ReadFile(fmt.Sprintf(configBackupFilepathFormat, userConfigFilepath, 0))
+	if err != nil {
+		t.Fatalf("expected a backup of the original: %v", err)
+	}
+
+	if string(backup) != original {
+		t.Errorf("backup isn't the original config:\n%s", backup)
+	}
+}
+
+func TestMigrationWarnsAboutInvalidVersion(t *testing.T) {
+	for _, c := range []struct {
+		version int
+		message string
+	}{
+		{-1, "invalid version"},
+		{currentConfigVersion + 1, "newer version"},
+	} {
+		original := fmt.Sprintf("%s: %d\nslider_mapping:\n  0: master\nbackend: dummy\n", configKeyConfigVersion, c.version)
+		inTempDir(t, original)
+
+		logs := loadConfigForMigration(t)
+
+		if contents := readConfigFile(t); contents != original {
+			t.Errorf("version %d: config was rewritten:\n%s", c.version, contents)
+		}
+
+		warned := false
+		for _, entry := range logs.All() {
+			warned = warned || entry.Level == zap.WarnLevel && strings.Contains(entry.Message, c.message)
+		}
+
+		if !warned {
+			t.Errorf("version %d: expected a warning mentioning %q", c.version, c.message)
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiPathDashboard      = "/dashboard"
+	apiPathConfigMappings = "/config/mappings"
+
+	// far more than any mapping needs, just to keep a bad request from filling memory
+	maxMappingsRequestSize = 1 << 20
+)
+
+// dashboardButton is a button's binding, as the dashboard sees it
+type dashboardButton struct {
+	Action string            `json:"action"`
+	Mode   string            `json:"mode,omitempty"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// dashboardMappings is the part of the config the dashboard edits: config.yaml's own slider and button mappings
+// (not the active profile's, or ones set from the tray)
+type dashboardMappings struct {
+	Sliders map[string][]string        `json:"sliders"`
+	Buttons map[string]dashboardButton `json:"buttons"`
+}
+
+// handleDashboard serves the dashboard page, which shows the sliders live and edits their mappings
+func (as *apiServer) handleDashboard(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if _, err := writer.Write([]byte(dashboardPage)); err != nil {
+		as.logger.Debugw("Failed to write dashboard page", "error", err)
+	}
+}
+
+// handleConfigMappings returns the mappings along with what the dashboard needs to edit them (GET), or validates
+// and saves new ones to config.yaml (POST), answering with what's wrong with them if anything is
+func (as *apiServer) handleConfigMappings(writer http.ResponseWriter, request *http.Request) {
+	switch request.Method {
+	case http.MethodGet:
+		response := struct {
+			dashboardMappings
+
+			// every button action, with the keys it needs
+			Actions  map[string][]string `json:"actions"`
+			Profiles []string            `json:"profiles"`
+		}{
+			dashboardMappings: as.currentMappings(),
+			Actions:           buttonActionKeys,
+			Profiles:          as.deej.config.ProfileNames(),
+		}
+
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(response); err != nil {
+			as.logger.Debugw("Failed to write mappings response", "error", err)
+		}
+
+	case http.MethodPost:
+
+		// a form on some other website can post text/plain, but not JSON - that takes a CORS preflight
+		mediaType, _, err := mime.ParseMediaType(request.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			http.Error(writer, "mappings have to be sent as application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		mappings := dashboardMappings{}
+		if err := json.NewDecoder(io.LimitReader(request.Body, maxMappingsRequestSize)).Decode(&mappings); err != nil {
+			http.Error(writer, fmt.Sprintf("invalid mappings: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if problems := as.validateMappings(mappings); len(problems) > 0 {
+			writer.Header().Set("Content-Type", "application/json")
+			writer.WriteHeader(http.StatusBadRequest)
+
+			if err := json.NewEncoder(writer).Encode(map[string][]string{"errors": problems}); err != nil {
+				as.logger.Debugw("Failed to write mappings response", "error", err)
+			}
+
+			return
+		}
+
+		err = as.deej.config.writeConfigSections(map[string][]string{
+			configKeySliderMapping: sliderMappingLines(mappings.Sliders),
+			configKeyButtonMapping: buttonMappingLines(mappings.Buttons),
+		})
+
+		if err != nil {
+			as.logger.Warnw("Failed to save mappings", "error", err)
+			http.Error(writer, "failed to save the config", http.StatusInternalServerError)
+			return
+		}
+
+		as.logger.Infow("Saved mappings from the dashboard",
+			"sliders", len(mappings.Sliders),
+			"buttons", len(mappings.Buttons))
+
+	default:
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// currentMappings returns the mappings as they're written in the config, so that saving them doesn't swap the
+// environment variables and ~ in them for this machine's values
+func (as *apiServer) currentMappings() dashboardMappings {
+	written := as.deej.config.configAsWritten()
+
+	mappings := dashboardMappings{
+		Sliders: written.GetStringMapStringSlice(configKeySliderMapping),
+		Buttons: map[string]dashboardButton{},
+	}
+
+	buttonMapFromConfig(written.GetStringMap(configKeyButtonMapping)).iterate(func(buttonID int, binding buttonBinding) {
+		mappings.Buttons[strconv.Itoa(buttonID)] = dashboardButton{
+			Action: binding.Action,
+			Mode:   binding.Mode,
+			Params: binding.Params,
+		}
+	})
+
+	return mappings
+}
+
+// validateMappings returns everything that's wrong with the given mappings, so it can all be fixed in one go
+func (as *apiServer) validateMappings(mappings dashboardMappings) []string {
+	problems := []string{}
+	profiles := as.deej.config.ProfileNames()
+
+	for sliderID, targets := range mappings.Sliders {
+		if id, err := strconv.Atoi(sliderID); err != nil || id < 0 {
+			problems = append(problems, fmt.Sprintf("slider %q: not a slider ID", sliderID))
+		}
+
+		for _, target := range targets {
+			if strings.TrimSpace(target) == "" {
+				problems = append(problems, fmt.Sprintf("slider %s: empty target", sliderID))
+				continue
+			}
+
+			if isTargetPattern(target) {
+				if _, err := compileTargetPattern(target); err != nil {
+					problems = append(problems, fmt.Sprintf("slider %s: invalid pattern %q: %v", sliderID, target, err))
+				}
+			}
+		}
+	}
+
+	for buttonID, button := range mappings.Buttons {
+		if id, err := strconv.Atoi(buttonID); err != nil || id < 0 {
+			problems = append(problems, fmt.Sprintf("button %q: not a button ID", buttonID))
+		}
+
+		requiredKeys, ok := buttonActionKeys[button.Action]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("button %s: unknown action %q", buttonID, button.Action))
+			continue
+		}
+
+		if button.Mode != "" && button.Mode != buttonModeMomentary && button.Mode != buttonModeToggle {
+			problems = append(problems, fmt.Sprintf("button %s: mode must be momentary or toggle", buttonID))
+		}
+
+		for _, key := range requiredKeys {
+			if strings.TrimSpace(button.Params[key]) == "" {
+				problems = append(problems, fmt.Sprintf("button %s: %s needs a %q", buttonID, button.Action, key))
+			}
+		}
+
+		for key := range button.Params {
+			if !plainYAMLScalarPattern.MatchString(key) || key == "action" || key == "mode" {
+				problems = append(problems, fmt.Sprintf("button %s: invalid key %q", buttonID, key))
+			}
+		}
+
+		if profile, ok := button.Params["profile"]; ok && button.Action == buttonActionProfileSwitch {
+			found := false
+			for _, name := range profiles {
+				found = found || name == strings.ToLower(profile)
+			}
+
+			if !found {
+				problems = append(problems, fmt.Sprintf("button %s: there's no profile %q", buttonID, profile))
+			}
+		}
+	}
+
+	sort.Strings(problems)
+
+	return problems
+}
+
+// sliderMappingLines writes slider targets as config lines, sliders in order
+func sliderMappingLines(sliders map[string][]string) []string {
+	lines := []string{}
+
+	for _, sliderID := range sortedNumericKeys(sliders) {
+		targets := sliders[sliderID]
+		if len(targets) == 0 {
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s:", sliderID))
+
+		for _, target := range targets {
+			lines = append(lines, fmt.Sprintf("    - %s", yamlScalar(strings.TrimSpace(target))))
+		}
+	}
+
+	return lines
+}
+
+// buttonMappingLines writes button bindings as config lines, buttons in order. plain actions go on one line,
+// like the ones deej ships with
+func buttonMappingLines(buttons map[string]dashboardButton) []string {
+	lines := []string{}
+
+	buttonIDs := make(map[string][]string, len(buttons))
+	for buttonID := range buttons {
+		buttonIDs[buttonID] = nil
+	}
+
+	for _, buttonID := range sortedNumericKeys(buttonIDs) {
+		button := buttons[buttonID]
+
+		if len(button.Params) == 0 && (button.Mode == "" || button.Mode == buttonModeMomentary) {
+			lines = append(lines, fmt.Sprintf("  %s: %s", buttonID, yamlScalar(button.Action)))
+			continue
+		}
+
+		lines = append(lines, fmt.Sprintf("  %s:", buttonID), fmt.Sprintf("    action: %s", yamlScalar(button.Action)))
+
+		if button.Mode == buttonModeToggle {
+			lines = append(lines, fmt.Sprintf("    mode: %s", buttonModeToggle))
+		}
+
+		keys := make([]string, 0, len(button.Params))
+		for key := range button.Params {
+			keys = append(keys, key)
+		}
+
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			lines = append(lines, fmt.Sprintf("    %s: %s", key, yamlScalar(button.Params[key])))
+		}
+	}
+
+	return lines
+}
+
+// sortedNumericKeys returns a mapping's keys in numeric order
+func sortedNumericKeys(mapping map[string][]string) []string {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		left, _ := strconv.Atoi(keys[i])
+		right, _ := strconv.Atoi(keys[j])
+
+		return left < right
+	})
+
+	return keys
+}
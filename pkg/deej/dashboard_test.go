@@ -0,0 +1,77 @@
+package deej
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// saving the dashboard's mappings unchanged should leave the environment variables and ~ in them alone
+func TestDashboardKeepsPlaceholders(t *testing.T) {
+	os.Setenv("DEEJ_TEST_APP", "game.exe")
+	t.Cleanup(func() { os.Unsetenv("DEEJ_TEST_APP") })
+
+	inTempDir(t, strings.Join([]string{
+		"slider_mapping:",
+		"  0:",
+		"    - ${DEEJ_TEST_APP}",
+		"button_mapping:",
+		"  1:",
+		"    action: output.set",
+		"    device: ~/speakers",
+		"",
+	}, "\n"))
+
+	logger := zap.NewNop().Sugar()
+
+	d, err := newSimulatedDeej(logger, newSimulatedSessionFinder(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.config.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if targets := d.config.userConfig.GetStringMapStringSlice(configKeySliderMapping)["0"]; len(targets) != 1 ||
+		targets[0] != "game.exe" {
+		t.Fatalf("expected the loaded config to have ${DEEJ_TEST_APP} filled in, got %v", targets)
+	}
+
+	as := newAPIServer(d, logger)
+
+	getRecorder := httptest.NewRecorder()
+	as.handleConfigMappings(getRecorder, httptest.NewRequest(http.MethodGet, apiPathConfigMappings, nil))
+
+	if getRecorder.Code != http.StatusOK {
+		t.Fatalf("GET mappings: %d %s", getRecorder.Code, getRecorder.Body)
+	}
+
+	// post back what the dashboard was handed, the way it does when saving without edits
+	request := httptest.NewRequest(http.MethodPost, apiPathConfigMappings, bytes.NewReader(getRecorder.Body.Bytes()))
+	request.Header.Set("Content-Type", "application/json")
+
+	postRecorder := httptest.NewRecorder()
+	as.handleConfigMappings(postRecorder, request)
+
+	if postRecorder.Code != http.StatusOK {
+		t.Fatalf("POST mappings: %d %s", postRecorder.Code, postRecorder.Body)
+	}
+
+	saved, err := ioutil.ReadFile(userConfigFilepath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, placeholder := range []string{"${DEEJ_TEST_APP}", "~/speakers"} {
+		if !strings.Contains(string(saved), placeholder) {
+			t.Errorf("saved config lost %s:\n%s", placeholder, saved)
+		}
+	}
+}
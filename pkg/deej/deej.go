@@ -1,10 +1,15 @@
 // Package deej provides a machine-side client that pairs with an Arduino
 // chip to form a tactile, physical volume control system/
+//
+// Other programs can embed it: New creates an instance set up by options (see library.go),
+// and Start and Stop run it in the background without taking over the process
 package deej
 
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"go.uber.org/zap"
@@ -23,25 +28,98 @@ type Deej struct {
 	logger          *zap.SugaredLogger
 	notifier        Notifier
 	config          *CanonicalConfig
+	bus             *eventBus
+	state           *stateStore
 	serial          *SerialIO
 	sessions        *sessionMap
 	processMonitor  *ProcessMonitor
 	mediaController *MediaController
+	buttons         *buttonHandler
+	displayPages    *displayPager
+	displayScreens  *displayScreener
+	timer           *focusTimer
+	dnd             *dndSync
+	focus           *focusFollower
+	fader           *volumeFader
+	automation      *automationEngine
+	alarms          *alarmController
+	ducker          *audioDucker
+	sessionActivity *sessionActivityTracker
+	dsp             *dspController
+	alerts          *pushAlerter
+	webhooks        *webhookSender
+	logShipper      *logShipper
+	recorder        *trafficRecorder
+	chaos           *serialChaos
+	events          *eventLog
+	console         *serialConsole
+	link            *linkMonitor
+	api             *apiServer
+	launchSync      *launchSync
+	nowPlaying      *nowPlayingWatcher
+	sleep           *deviceSleeper
+	usage           *usageTracker
+	hearing         *hearingProtector
+	quietHours      *quietHours
+	hotplug         *hotplugWatcher
+	tui             *terminalUI
 
 	stopChannel chan bool
+	stopOnce    sync.Once
 	version     string
 	verbose     bool
 	cliMode     bool
+	tuiMode     bool
+
+	// the goroutines following config reloads for the components (see onConfigReload)
+	reloadWatchers sync.WaitGroup
+
+	// the flags deej was started with, to start at login with (see autostart.go)
+	startupArgs []string
+
+	// set when a program embedding deej started it (see library.go), which stops it without exiting. stoppedChannel
+	// is closed once it has, with stopErr saying how that went
+	embedded       bool
+	stoppedChannel chan bool
+	stopErr        error
+
+	// how to reach the device instead of a serial port, if the embedding program brought one
+	transport Transport
+
+	// talk to a simulated device instead of a real one, whatever the config says (see mock_device.go)
+	simulate bool
+
+	// set while crashing, so that the stop that goes with it doesn't count as a clean one
+	panicked bool
 }
 
 // NewDeej creates a Deej instance
 func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
+	return New(logger, WithVerbose(verbose))
+}
+
+// New creates a Deej instance, set up by the given options (see library.go)
+func New(logger *zap.SugaredLogger, opts ...Option) (*Deej, error) {
 	logger = logger.Named("deej")
 
-	notifier, err := NewToastNotifier(logger)
-	if err != nil {
-		logger.Errorw("Failed to create ToastNotifier", "error", err)
-		return nil, fmt.Errorf("create new ToastNotifier: %w", err)
+	options := &deejOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	notifier := options.notifier
+
+	// a service's notifications wouldn't reach anyone's desktop, so they're only logged
+	if notifier == nil && runningAsService() {
+		notifier = &loggingNotifier{logger: logger.Named("notifier")}
+	}
+
+	if notifier == nil {
+		var err error
+		if notifier, err = NewToastNotifier(logger); err != nil {
+			logger.Errorw("Failed to create ToastNotifier", "error", err)
+			return nil, fmt.Errorf("create new ToastNotifier: %w", err)
+		}
 	}
 
 	config, err := NewConfig(logger, notifier)
@@ -54,10 +132,39 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 		logger:      logger,
 		notifier:    notifier,
 		config:      config,
+		transport:   options.transport,
+		simulate:    options.simulate,
 		stopChannel: make(chan bool),
-		verbose:     verbose,
+		verbose:     options.verbose,
+		version:     options.version,
+		startupArgs: options.startupArgs,
 	}
 
+	if options.profile != "" {
+		d.SetProfile(options.profile)
+	}
+
+	d.SetSafeMode(options.safeMode)
+
+	// parts tell each other what's going on through the event bus, so it comes before all of them
+	d.bus = newEventBus(logger)
+
+	// then the state store, as the state it loads is what everything else picks up from
+	d.state = newStateStore(logger, filepath.Join(logDirectory, stateFilename))
+
+	// create the push alerter and webhook sender first, as the serial connection raises alerts and events too
+	d.alerts = newPushAlerter(d, logger)
+	d.webhooks = newWebhookSender(d, logger)
+
+	// and the log shipper, so that it can ship everything from the first connection on
+	d.logShipper = newLogShipper(d, logger)
+
+	// same goes for the event log, which keeps track of recent connections, slider moves and volume changes
+	d.events = newEventLog(d, logger)
+	d.console = newSerialConsole(logger)
+	d.link = newLinkMonitor(d, logger)
+	d.api = newAPIServer(d, logger)
+
 	serial, err := NewSerialIO(d, logger)
 	if err != nil {
 		logger.Errorw("Failed to create SerialIO", "error", err)
@@ -66,13 +173,8 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 
 	d.serial = serial
 
-	sessionFinder, err := newSessionFinder(logger)
-	if err != nil {
-		logger.Errorw("Failed to create SessionFinder", "error", err)
-		return nil, fmt.Errorf("create new SessionFinder: %w", err)
-	}
-
-	sessions, err := newSessionMap(d, logger, sessionFinder)
+	// unless one was given, the session finder is created once the config says which backend to use
+	sessions, err := newSessionMap(d, logger, options.sessionFinder)
 	if err != nil {
 		logger.Errorw("Failed to create sessionMap", "error", err)
 		return nil, fmt.Errorf("create new sessionMap: %w", err)
@@ -80,31 +182,78 @@ func NewDeej(logger *zap.SugaredLogger, verbose bool) (*Deej, error) {
 
 	d.sessions = sessions
 
+	// create the volume fader, used for gradual (non-slider) volume changes like scenes
+	d.fader = newVolumeFader(d, logger)
+
+	// create the automation engine, which runs scheduled actions (such as alarms) at their configured times
+	d.automation = newAutomationEngine(d, logger)
+	d.alarms = newAlarmController(d, logger)
+
+	// create the audio ducker, which lowers other apps while a priority app (e.g. voice chat) is making noise
+	d.ducker = newAudioDucker(d, logger)
+
+	// create the session activity tracker, for sliders that only move whichever of their apps is playing
+	d.sessionActivity = newSessionActivityTracker(d, logger)
+
+	// create the DSP controller, which lets sliders drive external DSP parameters ("dsp." targets)
+	d.dsp = newDSPController(d, logger)
+
 	// create process monitor for LED updates
 	d.processMonitor = NewProcessMonitor(d, serial, logger)
 
 	// create media controller for media key simulation
 	d.mediaController = NewMediaController(logger)
 
+	// create button handler to dispatch button presses to their mapped actions
+	d.buttons = newButtonHandler(d, logger)
+
+	// create display pager for optional info pages (weather, calendar)
+	d.displayPages = newDisplayPager(d, logger)
+
+	// create display screener for structured screens (slider labels, volumes and peaks) on devices that can show them
+	d.displayScreens = newDisplayScreener(d, logger)
+
+	// create the pomodoro-style focus timer, controlled from buttons
+	d.timer = newFocusTimer(d, logger)
+
+	// create the do not disturb sync, which applies a quieter setup while the OS's do not disturb is on
+	d.dnd = newDNDSync(d, logger)
+
+	// create the focus follower, which keeps track of the focused app for deej.current targets
+	d.focus = newFocusFollower(d, logger)
+
+	// create the launch sync, which brings apps launched mid-session to their slider's volume right away
+	d.launchSync = newLaunchSync(d, logger)
+
+	// create the now playing watcher, which follows the track the OS's media session is playing
+	d.nowPlaying = newNowPlayingWatcher(d, logger)
+	d.sleep = newDeviceSleeper(d, logger)
+
+	// create the usage tracker, which keeps long-term volume statistics by app (only while enabled)
+	d.usage = newUsageTracker(d, logger)
+
+	// create the hearing protector, which turns master down after listening loud for too long (only while enabled)
+	d.hearing = newHearingProtector(d, logger)
+
+	// create quiet hours, which cap volumes at night (the automation engine starts and ends them)
+	d.quietHours = newQuietHours(d, logger)
+
+	// create the hotplug watcher, which has the reconnect loop look for the device as soon as one is plugged in
+	d.hotplug = newHotplugWatcher(d, logger)
+
+	// create the terminal UI, which only takes over the terminal with --tui
+	d.tui = newTerminalUI(d, logger)
+
 	logger.Debug("Created deej instance")
 
 	return d, nil
 }
 
-// Initialize sets up components and starts to run in the background
+// Initialize sets up components and starts to run in the background. it takes over the process: deej runs in
+// the tray (or until interrupted, in CLI mode) and exits once stopped. programs embedding deej use Start instead
 func (d *Deej) Initialize() error {
-	d.logger.Debug("Initializing")
-
-	// load the config for the first time
-	if err := d.config.Load(); err != nil {
-		d.logger.Errorw("Failed to load config during initialization", "error", err)
-		return fmt.Errorf("load config during init: %w", err)
-	}
-
-	// initialize the session map
-	if err := d.sessions.initialize(); err != nil {
-		d.logger.Errorw("Failed to initialize session map", "error", err)
-		return fmt.Errorf("init session map: %w", err)
+	if err := d.prepare(); err != nil {
+		return err
 	}
 
 	// decide whether to run with/without tray
@@ -117,6 +266,11 @@ func (d *Deej) Initialize() error {
 			d.logger.Debugw("Running without tray icon", "reason", "envvar set")
 		}
 
+		// show sliders and logs in the terminal instead of scrolling logs through it, if asked to
+		if d.tuiMode {
+			d.tui.Start()
+		}
+
 		// run in main thread while waiting on ctrl+C
 		d.setupInterruptHandler()
 		d.run()
@@ -129,6 +283,61 @@ func (d *Deej) Initialize() error {
 	return nil
 }
 
+// prepare loads the config and sets up everything that needs it, ahead of running
+func (d *Deej) prepare() error {
+	d.logger.Debug("Initializing")
+
+	// say upfront which features this platform can't provide
+	logCapabilities(d.logger)
+
+	// read what the last run left behind
+	d.state.load()
+
+	// count this startup as unstable until it proves otherwise, and hold back most features after repeated crashes
+	if crashedBefore := d.trackStartup(); crashedBefore || d.config.safeMode {
+		d.enterSafeMode(!crashedBefore)
+	}
+
+	// load the config for the first time
+	if err := d.config.Load(); err != nil {
+		d.logger.Errorw("Failed to load config during initialization", "error", err)
+		return fmt.Errorf("load config during init: %w", err)
+	}
+
+	// keep the log file and its history within the config's limits
+	d.followLogFileLimits()
+
+	// start the traffic recording (if there is one) from the config we're starting with
+	d.recorder.recordConfig(d.config)
+
+	// initialize the session map
+	if err := d.sessions.initialize(); err != nil {
+		d.logger.Errorw("Failed to initialize session map", "error", err)
+		return fmt.Errorf("init session map: %w", err)
+	}
+
+	// start listening to button events
+	d.buttons.initialize()
+
+	// follow along with config changes that map or unmap deej.current
+	d.focus.initialize()
+
+	// switch LED modes without a restart
+	d.processMonitor.initialize()
+
+	// keep recent events around for deej events and the API
+	d.events.initialize()
+	d.api.initialize()
+
+	// watch for profile switches and slider thresholds to send webhooks for
+	d.webhooks.initialize()
+
+	// start or stop shipping logs as the config changes
+	d.logShipper.initialize()
+
+	return nil
+}
+
 // SetVersion causes deej to add a version string to its tray menu if called before Initialize
 func (d *Deej) SetVersion(version string) {
 	d.version = version
@@ -139,6 +348,16 @@ func (d *Deej) SetCLIMode(enabled bool) {
 	d.cliMode = enabled
 }
 
+// SetTUIMode shows a terminal UI with live sliders, connection state and logs while running in CLI mode
+func (d *Deej) SetTUIMode(enabled bool) {
+	d.tuiMode = enabled
+}
+
+// SetProfile selects the profile deej starts with, if called before Initialize
+func (d *Deej) SetProfile(name string) {
+	d.config.SetInitialProfile(name)
+}
+
 // Verbose returns a boolean indicating whether deej is running in verbose mode
 func (d *Deej) Verbose() bool {
 	return d.verbose
@@ -157,9 +376,84 @@ func (d *Deej) setupInterruptHandler() {
 func (d *Deej) run() {
 	d.logger.Info("Run loop starting")
 
+	d.startComponents()
+
+	// wait until stopped (gracefully)
+	<-d.stopChannel
+	d.logger.Debug("Stop channel signaled, terminating")
+
+	if err := d.stop(); err != nil {
+		d.logger.Warnw("Failed to stop deej", "error", err)
+		os.Exit(1)
+	} else {
+		// exit with 0
+		os.Exit(0)
+	}
+}
+
+// startComponents gets everything going, including the first connection to the device
+func (d *Deej) startComponents() {
+
 	// watch the config file for changes
 	go d.config.WatchConfigFileChanges()
 
+	// having made it this far for a while, this startup didn't crash
+	time.AfterFunc(stableStartupDuration, d.startupSucceeded)
+
+	// start cycling display pages (this is a no-op unless a page provider is enabled)
+	d.displayPages.Start()
+
+	// keep structured screens up to date (a no-op unless some are configured and the device can show them)
+	d.displayScreens.Start()
+
+	// follow the OS's do not disturb state (a no-op unless enabled)
+	d.dnd.Start()
+
+	// keep track of the focused app (a no-op unless a slider is mapped to deej.current)
+	d.focus.Start()
+
+	// watch for mapped apps launching (this only polls processes if launch sync is enabled)
+	d.launchSync.Start()
+
+	// follow what's playing, for the tray tooltip, display and API (this only polls if now playing is enabled)
+	d.nowPlaying.Start()
+
+	// blank the device while the workstation is locked or the user is away (this only sends anything if enabled)
+	d.sleep.Start()
+
+	// keep an eye on the connection's health, reconnecting if it goes silent
+	d.link.Start()
+
+	// listen for devices being plugged in, so a disconnected device is found right away
+	d.hotplug.Start()
+
+	// keep long-term volume statistics (this only samples anything if enabled)
+	d.usage.Start()
+
+	// keep track of how long the user's been listening loud (this only checks anything if enabled)
+	d.hearing.Start()
+
+	// start running scheduled actions
+	d.automation.Start()
+
+	// start watching for priority audio (this only polls audio levels if ducking is enabled)
+	d.ducker.Start()
+
+	// listen for which apps are playing (this only polls audio levels if a slider uses slider_sessions)
+	d.sessionActivity.Start()
+
+	// start watching for push alert conditions (a no-op unless push alerts are enabled)
+	d.alerts.Start()
+
+	// start sending webhooks, for whichever are configured
+	d.webhooks.Start()
+
+	// start shipping logs (a no-op unless log shipping is enabled)
+	d.logShipper.Start()
+
+	// serve the local API (a no-op unless enabled)
+	d.api.Start()
+
 	// connect to the arduino for the first time
 	go func() {
 		if err := d.serial.Start(); err != nil {
@@ -175,31 +469,76 @@ func (d *Deej) run() {
 		<-time.After(1 * time.Second)
 		d.processMonitor.Start()
 	}()
-
-	// wait until stopped (gracefully)
-	<-d.stopChannel
-	d.logger.Debug("Stop channel signaled, terminating")
-
-	if err := d.stop(); err != nil {
-		d.logger.Warnw("Failed to stop deej", "error", err)
-		os.Exit(1)
-	} else {
-		// exit with 0
-		os.Exit(0)
-	}
 }
 
+// signalStop has deej stop. anything can ask for that, any number of times (the tray, a crash, an embedding
+// program), and only the first one does anything
 func (d *Deej) signalStop() {
-	d.logger.Debug("Signalling stop channel")
-	d.stopChannel <- true
+	d.stopOnce.Do(func() {
+		d.logger.Debug("Signalling stop channel")
+		close(d.stopChannel)
+	})
+}
+
+// onConfigReload calls reloaded after every config reload, until deej stops
+func (d *Deej) onConfigReload(reloaded func()) {
+	configReloads := d.config.SubscribeToChanges()
+
+	d.reloadWatchers.Add(1)
+	go func() {
+		defer d.reloadWatchers.Done()
+		defer configReloads.Close()
+
+		for {
+			select {
+			case <-d.stopChannel:
+				return
+			case <-configReloads.Reloads:
+				reloaded()
+			}
+		}
+	}()
 }
 
 func (d *Deej) stop() error {
 	d.logger.Info("Stopping")
 
+	// stopping cleanly means this startup was fine, however short it was
+	if !d.panicked {
+		d.startupSucceeded()
+	}
+
+	// give the terminal back first, so that the rest of stopping is logged to it as usual
+	d.tui.Stop()
+
+	// no more reloads from here on, and none still restarting anything that's about to be stopped
 	d.config.StopWatchingConfigFile()
-	d.processMonitor.Stop()
-	d.serial.Stop()
+	waitForGoroutines(d.logger, &d.reloadWatchers)
+
+	d.timer.Stop()
+	d.dnd.Stop()
+	d.focus.Stop()
+	d.launchSync.Stop()
+	d.nowPlaying.Stop()
+	d.sleep.Stop()
+	d.link.Stop()
+	d.hotplug.Stop()
+	d.usage.Stop()
+	d.hearing.Stop()
+	d.automation.Stop()
+	d.ducker.Stop()
+	d.sessionActivity.Stop()
+	d.alerts.Stop()
+	d.webhooks.Stop()
+	d.api.Stop()
+	d.alarms.Cancel()
+
+	// turn the LEDs off while the device is still there to hear it, then close the port and wait for everything
+	// reading from it to finish, so nothing's left delivering slider moves to the session map released below
+	d.processMonitor.Shutdown()
+	d.displayPages.Stop()
+	d.displayScreens.Stop()
+	d.serial.Shutdown()
 
 	// release the session map
 	if err := d.sessions.release(); err != nil {
@@ -207,10 +546,18 @@ func (d *Deej) stop() error {
 		return fmt.Errorf("release session map: %w", err)
 	}
 
-	if !d.cliMode {
+	if !d.cliMode && !d.embedded {
 		d.stopTray()
 	}
 
+	d.recorder.close()
+
+	// save anything that changed in the last few seconds
+	d.state.flush()
+
+	// ship the last of the logs, now that stopping's been logged
+	d.logShipper.Stop()
+
 	// attempt to sync on exit - this won't necessarily work but can't harm
 	d.logger.Sync()
 
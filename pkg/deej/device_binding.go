@@ -0,0 +1,294 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// deviceConnection is how to connect to one of the user's named devices (or, without a name, to the one
+// set up by com_port and baud_rate, or one step of connection_info). devices with an ID, USB IDs or a USB serial
+// number are found by them, wherever they are, ones with a listen address connect to deej over the network (see network_listener.go)
+// and ones with HID IDs enumerate as USB HID devices instead of serial ports (see hid_device.go)
+type deviceConnection struct {
+	Name     string
+	COMPort  string
+	BaudRate int
+	ID       string
+	Listen   string
+	HID      string
+
+	// the USB vendor and product IDs (as "vid:pid" in lowercase hex) and serial number of the board's USB serial chip
+	USB          string
+	SerialNumber string
+}
+
+// deviceBinding says which named devices a profile runs on, in order of preference, and which of the profile's
+// slider IDs each device's sliders drive. devices without slider IDs drive the same IDs as their slider indices
+type deviceBinding struct {
+	Devices   []string
+	SliderIDs map[string][]int
+}
+
+// populateDevices reads the named devices and each profile's binding to them
+func (cc *CanonicalConfig) populateDevices() {
+	cc.Devices = map[string]deviceConnection{}
+
+	for name, value := range cc.userConfig.GetStringMap(configKeyDevices) {
+		fields, ok := toStringMap(value)
+		if !ok {
+			cc.logger.Warnw("Invalid device, ignoring", "key", configKeyDevices, "device", name, "invalidValue", value)
+			continue
+		}
+
+		device := cc.deviceConnectionFromConfig(name, fields)
+		device.Name = strings.ToLower(name)
+
+		cc.Devices[device.Name] = device
+	}
+
+	cc.DeviceBindings = map[string]deviceBinding{}
+
+	for profileName := range cc.Profiles {
+		key := fmt.Sprintf("%s.%s", configKeyProfiles, profileName)
+
+		binding := deviceBinding{SliderIDs: map[string][]int{}}
+
+		for _, name := range cc.userConfig.GetStringSlice(key + "." + configKeyProfileDevices) {
+			name = strings.ToLower(name)
+
+			if _, ok := cc.Devices[name]; !ok {
+				cc.logger.Warnw("Profile uses unknown device, ignoring it", "profile", profileName, "device", name)
+				continue
+			}
+
+			binding.Devices = append(binding.Devices, name)
+		}
+
+		if len(binding.Devices) == 0 {
+			continue
+		}
+
+		for name, value := range cc.userConfig.GetStringMap(key + "." + configKeyProfileSliderIDs) {
+			sliderIDs, err := sliderIDsFromConfig(value)
+			if err != nil {
+				cc.logger.Warnw("Invalid profile slider IDs, ignoring",
+					"profile", profileName,
+					"device", name,
+					"invalidValue", value,
+					"error", err)
+
+				continue
+			}
+
+			binding.SliderIDs[strings.ToLower(name)] = sliderIDs
+		}
+
+		cc.DeviceBindings[profileName] = binding
+	}
+}
+
+// populateConnectionChain reads connection_info, the connections to try in order for profiles that aren't bound
+// to named devices (instead of just com_port)
+func (cc *CanonicalConfig) populateConnectionChain() {
+	cc.ConnectionInfo.Chain = nil
+
+	value := cc.userConfig.Get(configKeyConnectionInfo)
+	if value == nil {
+		return
+	}
+
+	steps, ok := value.([]interface{})
+	if !ok {
+		cc.logger.Warnw("Invalid connection chain, using com_port", "key", configKeyConnectionInfo, "invalidValue", value)
+		return
+	}
+
+	for idx, step := range steps {
+		fields, ok := toStringMap(step)
+		if !ok {
+			cc.logger.Warnw("Invalid connection chain step, ignoring", "key", configKeyConnectionInfo, "step", idx, "invalidValue", step)
+			continue
+		}
+
+		cc.ConnectionInfo.Chain = append(cc.ConnectionInfo.Chain, cc.deviceConnectionFromConfig(fmt.Sprintf("step %d", idx), fields))
+	}
+}
+
+// deviceConnectionFromConfig reads a named device or connection chain step, which leaves out whatever it
+// doesn't need: com_port is "auto" and baud_rate the global one unless set
+func (cc *CanonicalConfig) deviceConnectionFromConfig(name string, fields map[string]interface{}) deviceConnection {
+	device := deviceConnection{COMPort: "auto", BaudRate: cc.ConnectionInfo.BaudRate}
+
+	if port, ok := fields["com_port"]; ok && !strings.EqualFold(fmt.Sprint(port), "auto") {
+		device.COMPort = fmt.Sprint(port)
+	}
+
+	if id, ok := fields["id"]; ok {
+		device.ID = strings.TrimSpace(fmt.Sprint(id))
+	}
+
+	if listen, ok := fields["listen"]; ok {
+		device.Listen = strings.TrimSpace(fmt.Sprint(listen))
+	}
+
+	if hid, ok := fields["hid"]; ok {
+		value := strings.TrimSpace(fmt.Sprint(hid))
+		if _, _, err := parseHIDIDs(value); err != nil {
+			cc.logger.Warnw("Invalid device HID IDs, ignoring", "device", name, "invalidValue", hid, "error", err)
+		} else {
+			device.HID = value
+		}
+	}
+
+	if usb, ok := fields["usb"]; ok {
+		vendorID, productID, err := parseUSBIDs(strings.TrimSpace(fmt.Sprint(usb)))
+		if err != nil {
+			cc.logger.Warnw("Invalid device USB IDs, ignoring", "device", name, "invalidValue", usb, "error", err)
+		} else {
+			device.USB = fmt.Sprintf("%04x:%04x", vendorID, productID)
+		}
+	}
+
+	if serialNumber, ok := fields["serial_number"]; ok {
+		device.SerialNumber = strings.TrimSpace(fmt.Sprint(serialNumber))
+	}
+
+	if baudRate, ok := fields["baud_rate"]; ok {
+		parsed, err := strconv.Atoi(fmt.Sprint(baudRate))
+		if err != nil || parsed <= 0 {
+			cc.logger.Warnw("Invalid device baud rate, using the global one",
+				"device", name,
+				"invalidValue", baudRate,
+				"defaultValue", device.BaudRate)
+		} else {
+			device.BaudRate = parsed
+		}
+	}
+
+	return device
+}
+
+// parseUSBIDs reads USB vendor and product IDs, given in hex like "2341:8036"
+func parseUSBIDs(value string) (uint16, uint16, error) {
+	ids := strings.SplitN(value, ":", 2)
+	if len(ids) != 2 {
+		return 0, 0, fmt.Errorf("expected <vendor id>:<product id>, got %q", value)
+	}
+
+	vendorID, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(ids[0]), "0x"), 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vendor ID %q", ids[0])
+	}
+
+	productID, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(ids[1]), "0x"), 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid product ID %q", ids[1])
+	}
+
+	return uint16(vendorID), uint16(productID), nil
+}
+
+func sliderIDsFromConfig(value interface{}) ([]int, error) {
+	values, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("expected a list of slider IDs")
+	}
+
+	sliderIDs := make([]int, len(values))
+	for idx, value := range values {
+		sliderID, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil || sliderID < 0 {
+			return nil, fmt.Errorf("invalid slider ID %v", value)
+		}
+
+		sliderIDs[idx] = sliderID
+	}
+
+	return sliderIDs, nil
+}
+
+// connectionCandidates returns the devices to try connecting to, in order: those the active profile is bound to,
+// or for profiles that aren't bound to any, connection_info's steps (or just the one set up by com_port and baud_rate)
+func (cc *CanonicalConfig) connectionCandidates() []deviceConnection {
+	binding, ok := cc.DeviceBindings[cc.ActiveProfile]
+	if !ok {
+		if len(cc.ConnectionInfo.Chain) > 0 {
+			return cc.ConnectionInfo.Chain
+		}
+
+		return []deviceConnection{{
+			COMPort:  cc.ConnectionInfo.COMPort,
+			BaudRate: cc.ConnectionInfo.BaudRate,
+			ID:       cc.ConnectionInfo.DeviceID,
+		}}
+	}
+
+	candidates := make([]deviceConnection, 0, len(binding.Devices))
+	for _, name := range binding.Devices {
+		candidates = append(candidates, cc.Devices[name])
+	}
+
+	return candidates
+}
+
+// boundSliderIDs returns the profile slider IDs the given device's sliders drive in the active profile,
+// or false if they drive the same IDs as their indices
+func (cc *CanonicalConfig) boundSliderIDs(deviceName string) ([]int, bool) {
+	binding, ok := cc.DeviceBindings[cc.ActiveProfile]
+	if !ok {
+		return nil, false
+	}
+
+	sliderIDs, ok := binding.SliderIDs[deviceName]
+	return sliderIDs, ok
+}
+
+// profileSliderID translates a slider index on the connected device to the slider ID the active profile knows it as.
+// sliders beyond the device's slider IDs don't drive anything
+func (sio *SerialIO) profileSliderID(sliderIdx int) (int, bool) {
+	sliderIDs, ok := sio.deej.config.boundSliderIDs(sio.deviceName)
+	if !ok {
+		return sliderIdx, true
+	}
+
+	if sliderIdx >= len(sliderIDs) {
+		return 0, false
+	}
+
+	return sliderIDs[sliderIdx], true
+}
+
+// deviceSliderIndices maps the active profile's slider IDs to the connected device's slider indices (leaving out those
+// no slider on the device drives), along with how many sliders that makes. it's nil when they're one and the same
+func (sio *SerialIO) deviceSliderIndices(numSliders int) (map[int]int, int) {
+	sliderIDs, ok := sio.deej.config.boundSliderIDs(sio.deviceName)
+	if !ok {
+		return nil, numSliders
+	}
+
+	indices := make(map[int]int, len(sliderIDs))
+	for sliderIdx, sliderID := range sliderIDs {
+		indices[sliderID] = sliderIdx
+	}
+
+	return indices, len(sliderIDs)
+}
+
+// boundDeviceChanged reports whether the connected device is no longer one the active profile runs on
+func (sio *SerialIO) boundDeviceChanged() bool {
+	binding, bound := sio.deej.config.DeviceBindings[sio.deej.config.ActiveProfile]
+
+	// profiles that aren't bound to any device connect through com_port
+	if !bound {
+		return sio.deviceName != ""
+	}
+
+	for _, name := range binding.Devices {
+		if name == sio.deviceName {
+			return false
+		}
+	}
+
+	return true
+}
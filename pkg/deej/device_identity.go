@@ -0,0 +1,79 @@
+package deej
+
+import (
+	"strings"
+
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+)
+
+// devices can report a unique ID with a line like "#ID:desk-mixer", either by themselves or when asked to
+// (see protocol.IdentityRequest). a device's ID stays the same when windows hands it a different COM port
+const deviceIdentityPrefix = "#ID:"
+
+// parseDeviceIdentity reads the ID from an "#ID:..." line, or returns false if it's empty
+func parseDeviceIdentity(line string) (string, bool) {
+	identity := strings.TrimSpace(strings.TrimPrefix(line, deviceIdentityPrefix))
+
+	return identity, identity != ""
+}
+
+// findPortByIdentity returns the port the device with the given ID is on, or an empty string if it can't be found.
+// the ID can be a USB serial number, which is checked without opening any port, or one the firmware reports
+func findPortByIdentity(logger *zap.SugaredLogger, identity string, baudRate int) string {
+	if portName := findPortByUSBSerialNumber(logger, identity); portName != "" {
+		logger.Infow("Found device by USB serial number", "id", identity, "port", portName)
+		return portName
+	}
+
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		logger.Warnw("Failed to enumerate serial ports", "error", err)
+		return ""
+	}
+
+	logger.Debugw("Asking devices for their ID", "id", identity, "ports", ports)
+
+	for _, portName := range ports {
+		found, reportedIdentity := probePort(logger, portName, baudRate, true)
+		if !found {
+			continue
+		}
+
+		if strings.EqualFold(reportedIdentity, identity) {
+			logger.Infow("Found device by ID", "id", identity, "port", portName)
+			return portName
+		}
+
+		logger.Debugw("Skipping deej device with another ID", "port", portName, "reportedID", reportedIdentity)
+	}
+
+	logger.Debugw("No deej device with this ID on any port", "id", identity)
+	return ""
+}
+
+func (sio *SerialIO) handleDeviceIdentity(logger *zap.SugaredLogger, line string) {
+	identity, ok := parseDeviceIdentity(line)
+	if !ok {
+		logger.Warnw("Got empty device ID, ignoring", "line", line)
+		return
+	}
+
+	if identity == sio.deviceIdentity {
+		return
+	}
+
+	sio.deviceIdentity = identity
+	logger.Infow("Device reported its ID", "id", identity)
+}
+
+// wantedIdentityChanged reports whether the ID the device should be found by is different in the config now,
+// either the one for com_port setups or (for profiles bound to named devices) the connected device's one
+func (sio *SerialIO) wantedIdentityChanged(bound bool) bool {
+	if !bound {
+		return sio.deej.config.ConnectionInfo.DeviceID != sio.wantedIdentity
+	}
+
+	device, ok := sio.deej.config.Devices[sio.deviceName]
+	return ok && device.ID != sio.wantedIdentity
+}
@@ -0,0 +1,201 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	defaultSleepIdleMinutes = 10
+
+	// how often the lock and idle state are checked
+	sleepPollInterval = 2 * time.Second
+)
+
+// sleepConfig holds the user's device sleep settings
+type sleepConfig struct {
+
+	// put the device to sleep while the workstation is locked
+	OnLock bool
+
+	// put the device to sleep after this long without keyboard or mouse input (0 to stay awake)
+	IdleAfter time.Duration
+}
+
+func (sc sleepConfig) enabled() bool {
+	return sc.OnLock || sc.IdleAfter > 0
+}
+
+// deviceSleeper blanks the device's display and LEDs while the workstation is locked or the user is away,
+// and wakes it back up as soon as they're back. it keeps running while disabled, to pick up a config change
+type deviceSleeper struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+
+	// whether the device was last told to sleep, and whether it was connected then - a device that
+	// reconnects comes back awake, and needs telling again
+	asleep    bool
+	connected bool
+
+	stopChannel chan bool
+}
+
+func newDeviceSleeper(deej *Deej, logger *zap.SugaredLogger) *deviceSleeper {
+	logger = logger.Named("sleep")
+
+	ds := &deviceSleeper{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created device sleeper instance")
+
+	return ds
+}
+
+// Start begins watching the lock and idle state
+func (ds *deviceSleeper) Start() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.running {
+		return
+	}
+
+	if !sleepDetectionSupported {
+		if ds.deej.config.Sleep.enabled() {
+			ds.logger.Warnw("Detecting lock and idle isn't supported on this platform", "error", util.ErrNotSupported)
+		}
+
+		return
+	}
+
+	ds.running = true
+
+	go ds.pollLoop()
+}
+
+// Stop ends watching, waking the device if it's asleep
+func (ds *deviceSleeper) Stop() {
+	ds.lock.Lock()
+
+	if !ds.running {
+		ds.lock.Unlock()
+		return
+	}
+
+	ds.running = false
+
+	if ds.asleep {
+		ds.setAsleep(false, "stopping")
+	}
+
+	ds.lock.Unlock()
+
+	ds.stopChannel <- true
+}
+
+func (ds *deviceSleeper) pollLoop() {
+	for {
+		select {
+		case <-ds.stopChannel:
+			return
+		case <-time.After(sleepPollInterval):
+			ds.poll()
+		}
+	}
+}
+
+func (ds *deviceSleeper) poll() {
+	asleep, reason := ds.shouldSleep()
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if !ds.running {
+		return
+	}
+
+	connected := ds.deej.serial.isConnected()
+	reconnected := connected && !ds.connected
+	ds.connected = connected
+
+	if asleep != ds.asleep || (asleep && reconnected) {
+		ds.setAsleep(asleep, reason)
+	}
+}
+
+// shouldSleep returns whether the device should be asleep right now, and why
+func (ds *deviceSleeper) shouldSleep() (bool, string) {
+	config := ds.deej.config.Sleep
+
+	if config.OnLock {
+		locked, err := workstationLocked()
+		if err != nil {
+			if ds.deej.Verbose() {
+				ds.logger.Debugw("Failed to check whether the workstation is locked", "error", err)
+			}
+		} else if locked {
+			return true, "locked"
+		}
+	}
+
+	if config.IdleAfter > 0 {
+		idle, err := userIdleTime()
+		if err != nil {
+			if ds.deej.Verbose() {
+				ds.logger.Debugw("Failed to check how long the user has been idle", "error", err)
+			}
+		} else if idle >= config.IdleAfter {
+			return true, "idle"
+		}
+	}
+
+	return false, "active"
+}
+
+// setAsleep tells the device to sleep or wake up. assumes the lock is held
+func (ds *deviceSleeper) setAsleep(asleep bool, reason string) {
+	if err := ds.deej.serial.SendSleep(asleep); err != nil {
+		if ds.deej.Verbose() {
+			ds.logger.Warnw("Failed to send sleep state", "asleep", asleep, "error", err)
+		}
+
+		// not connected: whatever connects next starts out awake
+		ds.asleep = false
+		return
+	}
+
+	ds.logger.Infow("Changed device sleep state", "asleep", asleep, "reason", reason)
+	ds.asleep = asleep
+}
+
+// SendSleep blanks the device's display and LEDs, or wakes them back up
+func (sio *SerialIO) SendSleep(asleep bool) error {
+	if !sio.isConnected() {
+		return errors.New("serial: not connected")
+	}
+
+	if err := sio.writeCommand(protocol.Sleep(asleep)); err != nil {
+		sio.logger.Warnw("Failed to send sleep state", "error", err)
+		return fmt.Errorf("write sleep state: %w", err)
+	}
+
+	if sio.deej.Verbose() {
+		sio.logger.Debugw("Sent sleep state", "asleep", asleep)
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// see device_sleep_other.go
+const sleepDetectionSupported = true
+
+// the lock and idle state come from logind, which desktops keep up to date (the idle hint is only set
+// once the desktop's own idle delay passes, so idle_minutes can't be any shorter than that)
+func loginSessionProperties() (map[string]string, error) {
+	session := os.Getenv("XDG_SESSION_ID")
+	if session == "" {
+		session = "self"
+	}
+
+	output, err := exec.Command("loginctl", "show-session", session,
+		"-p", "LockedHint", "-p", "IdleHint", "-p", "IdleSinceHint").Output()
+	if err != nil {
+		return nil, fmt.Errorf("show login session: %w", err)
+	}
+
+	properties := map[string]string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		if parts := strings.SplitN(line, "=", 2); len(parts) == 2 {
+			properties[parts[0]] = strings.TrimSpace(parts[1])
+		}
+	}
+
+	return properties, nil
+}
+
+func workstationLocked() (bool, error) {
+	properties, err := loginSessionProperties()
+	if err != nil {
+		return false, err
+	}
+
+	return properties["LockedHint"] == "yes", nil
+}
+
+func userIdleTime() (time.Duration, error) {
+	properties, err := loginSessionProperties()
+	if err != nil {
+		return 0, err
+	}
+
+	if properties["IdleHint"] != "yes" {
+		return 0, nil
+	}
+
+	// microseconds since the epoch
+	since, err := strconv.ParseInt(properties["IdleSinceHint"], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse idle since hint: %w", err)
+	}
+
+	return time.Since(time.Unix(0, since*int64(time.Microsecond))), nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// there's no known way to tell whether the workstation is locked or the user is away here,
+// so the device never sleeps
+const sleepDetectionSupported = false
+
+func workstationLocked() (bool, error) {
+	return false, util.ErrNotSupported
+}
+
+func userIdleTime() (time.Duration, error) {
+	return 0, util.ErrNotSupported
+}
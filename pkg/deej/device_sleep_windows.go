@@ -0,0 +1,69 @@
+package deej
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// see device_sleep_other.go
+const sleepDetectionSupported = true
+
+var (
+	procOpenInputDesktop = user32.NewProc("OpenInputDesktop")
+	procCloseDesktop     = user32.NewProc("CloseDesktop")
+	procGetLastInputInfo = user32.NewProc("GetLastInputInfo")
+
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procGetTickCount = kernel32.NewProc("GetTickCount")
+)
+
+const desktopSwitchDesktop = 0x0100
+
+type lastInputInfo struct {
+	cbSize uint32
+	dwTime uint32
+}
+
+// workstationLocked returns whether the lock screen is up. while it is, the input desktop is the secure one,
+// which a regular process can't open (the same goes for UAC prompts, which are just as good a reason to sleep)
+func workstationLocked() (bool, error) {
+
+	// a service has a desktop of its own, but hears about the user's locks from the service manager
+	if locked, ok := serviceSessionLocked(); ok {
+		return locked, nil
+	}
+
+	desktop, _, _ := procOpenInputDesktop.Call(0, 0, desktopSwitchDesktop)
+	if desktop == 0 {
+		return true, nil
+	}
+
+	procCloseDesktop.Call(desktop)
+
+	return false, nil
+}
+
+// userIdleTime returns how long it's been since the last keyboard or mouse input
+func userIdleTime() (time.Duration, error) {
+
+	// input is counted per session, and a service's never gets any
+	if runningAsService() {
+		return 0, fmt.Errorf("user input can't be seen from a service: %w", util.ErrNotSupported)
+	}
+
+	info := lastInputInfo{}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+
+	if ret, _, err := procGetLastInputInfo.Call(uintptr(unsafe.Pointer(&info))); ret == 0 {
+		return 0, fmt.Errorf("get last input info: %w", err)
+	}
+
+	now, _, _ := procGetTickCount.Call()
+
+	// both are milliseconds since boot, wrapping around every 49 days
+	return time.Duration(uint32(now)-info.dwTime) * time.Millisecond, nil
+}
@@ -0,0 +1,331 @@
+package deej
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultDiagnosticsCapture is how long --diagnose listens to the device for
+	DefaultDiagnosticsCapture = 5 * time.Second
+
+	diagnosticsFilenameFormat = "deej-diagnostics-%s.zip"
+
+	// logs past this size only have their end included, which is where whatever went wrong usually is
+	maxDiagnosticsLogSize = 1024 * 1024
+
+	// how many earlier runs' logs and crashlogs go in, newest first
+	diagnosticsLogHistory = 2
+	diagnosticsCrashlogs  = 3
+)
+
+// config values under keys named like any of these are left out, on top of log shipping's sensitive field names.
+// urls carry webhook and calendar secrets more often than not
+var diagnosticsSensitiveKeys = append([]string{"url", "user", "topic"}, sensitiveLogFieldNames...)
+
+var diagnosticsRedactPattern = regexp.MustCompile(`(?im)^(\s*(?:-\s+)?["']?[\w.-]*(?:` +
+	strings.Join(diagnosticsSensitiveKeys, "|") + `)[\w.-]*["']?\s*:\s+)(\S.*)$`)
+
+// diagnosticsBundle is the files going into the zip, in order
+type diagnosticsBundle struct {
+	names    []string
+	contents map[string][]byte
+}
+
+func (db *diagnosticsBundle) add(name string, contents string) {
+	if db.contents == nil {
+		db.contents = map[string][]byte{}
+	}
+
+	if _, ok := db.contents[name]; !ok {
+		db.names = append(db.names, name)
+	}
+
+	db.contents[name] = []byte(contents)
+}
+
+func (db *diagnosticsBundle) zip() ([]byte, error) {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+
+	for _, name := range db.names {
+		writer, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+		if err != nil {
+			return nil, fmt.Errorf("add %s: %w", name, err)
+		}
+
+		if _, err := writer.Write(db.contents[name]); err != nil {
+			return nil, fmt.Errorf("write %s: %w", name, err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return nil, fmt.Errorf("finish zip: %w", err)
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Diagnose collects what it takes to look into a problem without access to the machine - system info, serial
+// ports, a few seconds of what the device sends, the config (with secrets left out), audio sessions and recent
+// logs - into a zip next to deej, returning its path. a part that can't be collected says why in its place, as
+// that's often the problem
+func (d *Deej) Diagnose(capture time.Duration) (string, error) {
+	logger := d.logger.Named("diagnose")
+	bundle := &diagnosticsBundle{}
+
+	configErr := d.config.Load()
+
+	bundle.add("system.txt", d.diagnoseSystem(configErr))
+	bundle.add("ports.txt", diagnoseSerialPorts())
+
+	// the rest goes by the config, so it has to have loaded
+	if configErr == nil {
+		fmt.Printf("Listening to the device for %s...\n", capture)
+
+		bundle.add("capture.txt", d.diagnoseCapture(capture))
+		bundle.add("sessions.txt", d.diagnoseSessions())
+	}
+
+	for _, file := range d.diagnosedConfigFiles() {
+		bundle.add(filepath.ToSlash(filepath.Join("config", file)), diagnoseConfigFile(file))
+	}
+
+	for _, file := range recentLogFiles() {
+		bundle.add(filepath.ToSlash(filepath.Join("logs", filepath.Base(file))), diagnoseLogFile(file))
+	}
+
+	contents, err := bundle.zip()
+	if err != nil {
+		return "", fmt.Errorf("create diagnostics zip: %w", err)
+	}
+
+	path := fmt.Sprintf(diagnosticsFilenameFormat, time.Now().Format(crashlogTimestampFormat))
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return "", fmt.Errorf("write diagnostics zip: %w", err)
+	}
+
+	logger.Infow("Saved diagnostics", "path", path, "files", len(bundle.names))
+
+	return path, nil
+}
+
+func (d *Deej) diagnoseSystem(configErr error) string {
+	var builder strings.Builder
+
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&builder, format+"\n", args...)
+	}
+
+	version := d.version
+	if version == "" {
+		version = "unknown (development build)"
+	}
+
+	line("deej: %s", version)
+	line("collected: %s", time.Now().Format(time.RFC3339))
+	line("os: %s/%s, %d CPUs, built with %s", runtime.GOOS, runtime.GOARCH, runtime.NumCPU(), runtime.Version())
+
+	if workingDir, err := os.Getwd(); err == nil {
+		line("running in: %s", redactLogLine(workingDir, nil))
+	}
+
+	if configErr != nil {
+		line("config: failed to load (%v)", configErr)
+	} else {
+		line("config: loaded, profile %s, backend %s, safe mode %t", d.config.ActiveProfile, d.config.Backend.Name, d.config.safeMode)
+	}
+
+	line("")
+	line("capabilities:")
+
+	for _, capability := range Capabilities() {
+		if capability.Supported {
+			line("  %s: supported", capability.Name)
+		} else {
+			line("  %s: not supported - %s", capability.Name, capability.Fallback)
+		}
+	}
+
+	return builder.String()
+}
+
+func diagnoseSerialPorts() string {
+	ports, err := describeSerialPorts()
+	if err != nil {
+		return fmt.Sprintf("failed to list serial ports: %v\n", err)
+	}
+
+	if len(ports) == 0 {
+		return "no serial ports found\n"
+	}
+
+	return strings.Join(ports, "\n") + "\n"
+}
+
+// diagnoseCapture connects to the device like deej would, and returns what went back and forth for a while
+func (d *Deej) diagnoseCapture(capture time.Duration) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, "com_port: %s, baud rate %d, transport %s\n",
+		d.config.ConnectionInfo.COMPort, d.config.ConnectionInfo.BaudRate, d.config.ConnectionInfo.Transport)
+
+	// a port that's busy usually means deej's already running and holding on to it
+	if err := d.serial.Start(); err != nil {
+		fmt.Fprintf(&builder, "failed to connect (is deej already running?): %v\n", err)
+		return builder.String()
+	}
+
+	time.Sleep(capture)
+
+	fmt.Fprintf(&builder, "connected to %s, device %q, id %q\n\n", d.serial.comPort, d.serial.deviceName, d.serial.deviceIdentity)
+
+	d.serial.Stop()
+
+	frames := d.console.since(0, "", "", 0)
+	if len(frames) == 0 {
+		fmt.Fprintf(&builder, "nothing was received in %s\n", capture)
+	}
+
+	for _, frame := range frames {
+		fmt.Fprintf(&builder, "%s %-3s %s\n", frame.At.Format("15:04:05.000"), frame.Direction, frame.Line)
+	}
+
+	return builder.String()
+}
+
+// diagnoseSessions lists the audio sessions the configured backend finds right now
+func (d *Deej) diagnoseSessions() string {
+	sessionFinder, err := newBackendSessionFinder(zap.NewNop().Sugar(), d.config.Backend)
+	if err != nil {
+		return fmt.Sprintf("failed to create session finder for %s backend: %v\n", d.config.Backend.Name, err)
+	}
+
+	defer sessionFinder.Release()
+
+	sessions, err := sessionFinder.GetAllSessions()
+	if err != nil {
+		return fmt.Sprintf("failed to get sessions: %v\n", err)
+	}
+
+	lines := []string{}
+	for _, session := range sessions {
+		description := fmt.Sprintf("%s: volume %.0f%%", session.Key(), session.GetVolume()*100)
+
+		if session.GetMute() {
+			description += ", muted"
+		}
+
+		if identified, ok := session.(identifiedSession); ok {
+			if product := identified.ProductName(); product != "" {
+				description += fmt.Sprintf(", product %q", product)
+			}
+		}
+
+		lines = append(lines, description)
+		session.Release()
+	}
+
+	sort.Strings(lines)
+
+	if len(lines) == 0 {
+		return "no audio sessions found\n"
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// diagnosedConfigFiles returns config.yaml, the files it includes and config.local.yaml (whether or not there is one)
+func (d *Deej) diagnosedConfigFiles() []string {
+	files := []string{userConfigFilepath}
+	seen := map[string]bool{userConfigFilepath: true}
+
+	for _, file := range d.config.includedSections {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	if !seen[localConfigFilepath] {
+		files = append(files, localConfigFilepath)
+	}
+
+	sort.Strings(files[1:])
+
+	return files
+}
+
+// diagnoseConfigFile returns a config file with every value under a key that might hold a secret left out
+func diagnoseConfigFile(file string) string {
+	contents, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "(doesn't exist)\n"
+	} else if err != nil {
+		return fmt.Sprintf("failed to read: %v\n", err)
+	}
+
+	redacted := diagnosticsRedactPattern.ReplaceAllStringFunc(string(contents), func(line string) string {
+		match := diagnosticsRedactPattern.FindStringSubmatch(line)
+
+		// that there's nothing set is worth seeing
+		switch strings.TrimSpace(match[2]) {
+		case `""`, "''", "[]", "{}":
+			return line
+		}
+
+		return match[1] + redactedLogValue
+	})
+
+	return redactLogLine(redacted, nil)
+}
+
+// recentLogFiles returns this run's log, the last few runs' and the latest crashlogs
+func recentLogFiles() []string {
+	files := []string{filepath.Join(logDirectory, logFilename)}
+
+	newest := func(pattern string, count int) []string {
+		matches, _ := filepath.Glob(filepath.Join(logDirectory, pattern))
+
+		// both are named for when they were written, which sorts oldest first
+		sort.Sort(sort.Reverse(sort.StringSlice(matches)))
+
+		if len(matches) > count {
+			matches = matches[:count]
+		}
+
+		return matches
+	}
+
+	files = append(files, newest(logHistoryPrefix+"*.log", diagnosticsLogHistory)...)
+	files = append(files, newest(fmt.Sprintf(crashlogFilename, "*"), diagnosticsCrashlogs)...)
+
+	return files
+}
+
+func diagnoseLogFile(file string) string {
+	contents, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return "(doesn't exist - development builds log to the terminal)\n"
+	} else if err != nil {
+		return fmt.Sprintf("failed to read: %v\n", err)
+	}
+
+	text := string(contents)
+	if len(text) > maxDiagnosticsLogSize {
+		text = "(cut to its last part)\n" + text[len(text)-maxDiagnosticsLogSize:]
+	}
+
+	return redactLogLine(text, nil)
+}
@@ -0,0 +1,228 @@
+package deej
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	weatherUnitsMetric   = "metric"
+	weatherUnitsImperial = "imperial"
+
+	// OpenWeather's free tier updates roughly every 10 minutes anyway, so don't go below that
+	minWeatherRefreshInterval = 10 * time.Minute
+
+	// calendar feeds are usually regenerated lazily by their hosts, there's no point in fetching them constantly
+	minCalendarRefreshInterval = 5 * time.Minute
+)
+
+// displayPage is a short, two-line screen shown on devices with a display
+type displayPage struct {
+	Title string
+	Text  string
+}
+
+// pageProvider is a (usually internet-backed) source of display pages.
+// refresh is potentially slow and is only ever called by the pager, no more often than refreshInterval
+type pageProvider interface {
+	name() string
+	refreshInterval() time.Duration
+	refresh() error
+	page() (displayPage, bool)
+}
+
+// displayPagesConfig holds the user's display page settings
+type displayPagesConfig struct {
+	Interval time.Duration
+
+	Weather struct {
+		Enabled         bool
+		APIKey          string
+		Location        string
+		Units           string
+		RefreshInterval time.Duration
+	}
+
+	Calendar struct {
+		Enabled         bool
+		URL             string
+		RefreshInterval time.Duration
+	}
+}
+
+const (
+	defaultDisplayPageIntervalSeconds = 30
+
+	// display pages are pushed at a slow pace, so there's no need to check much more often than this
+	displayPagerTickInterval = time.Second
+
+	// how long to wait for a provider's remote service to respond
+	pageProviderHTTPTimeout = 10 * time.Second
+)
+
+type providerState struct {
+	provider    pageProvider
+	lastRefresh time.Time
+	refreshing  bool
+}
+
+// displayPager periodically refreshes its page providers and cycles their pages on the device's display
+type displayPager struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	httpClient *http.Client
+
+	providers     []*providerState
+	providersLock sync.Mutex
+
+	nextPageIdx  int
+	lastPageSent time.Time
+
+	stopChannel chan bool
+	running     bool
+}
+
+func newDisplayPager(deej *Deej, logger *zap.SugaredLogger) *displayPager {
+	logger = logger.Named("display-pages")
+
+	dp := &displayPager{
+		deej:        deej,
+		logger:      logger,
+		httpClient:  &http.Client{Timeout: pageProviderHTTPTimeout},
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created display pager instance")
+
+	return dp
+}
+
+// Start begins refreshing providers and cycling their pages, if any are enabled
+func (dp *displayPager) Start() {
+	dp.buildProviders()
+	dp.setupOnConfigReload()
+
+	dp.running = true
+	go dp.pagerLoop()
+}
+
+// Stop signals the pager to stop
+func (dp *displayPager) Stop() {
+	if !dp.running {
+		return
+	}
+
+	dp.logger.Debug("Stopping display pager")
+	dp.running = false
+	dp.stopChannel <- true
+}
+
+func (dp *displayPager) setupOnConfigReload() {
+	dp.deej.onConfigReload(func() {
+		dp.logger.Debug("Detected config reload, rebuilding page providers")
+		dp.buildProviders()
+	})
+}
+
+func (dp *displayPager) buildProviders() {
+	config := dp.deej.config.DisplayPages
+	providers := []*providerState{}
+
+	if config.Weather.Enabled {
+		providers = append(providers, &providerState{provider: newWeatherPageProvider(dp.logger, dp.httpClient, config)})
+	}
+
+	if config.Calendar.Enabled {
+		providers = append(providers, &providerState{provider: newCalendarPageProvider(dp.logger, dp.httpClient, config)})
+	}
+
+	dp.providersLock.Lock()
+	defer dp.providersLock.Unlock()
+
+	dp.providers = providers
+	dp.nextPageIdx = 0
+
+	if len(providers) > 0 {
+		dp.logger.Infow("Display page providers enabled", "amount", len(providers))
+	}
+}
+
+func (dp *displayPager) pagerLoop() {
+	ticker := time.NewTicker(displayPagerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-dp.stopChannel:
+			dp.logger.Debug("Display pager stopped")
+			return
+		case <-ticker.C:
+			dp.refreshDueProviders()
+			dp.maybeSendNextPage()
+		}
+	}
+}
+
+// refreshDueProviders kicks off a background refresh for every provider whose refresh interval has elapsed.
+// this is what keeps us from hammering remote services, regardless of how often pages are shown
+func (dp *displayPager) refreshDueProviders() {
+	dp.providersLock.Lock()
+	defer dp.providersLock.Unlock()
+
+	now := time.Now()
+
+	for _, state := range dp.providers {
+		if state.refreshing || state.lastRefresh.Add(state.provider.refreshInterval()).After(now) {
+			continue
+		}
+
+		state.refreshing = true
+		state.lastRefresh = now
+
+		go func(state *providerState) {
+			if err := state.provider.refresh(); err != nil {
+				dp.logger.Warnw("Failed to refresh page provider", "provider", state.provider.name(), "error", err)
+			} else {
+				dp.logger.Debugw("Refreshed page provider", "provider", state.provider.name())
+			}
+
+			dp.providersLock.Lock()
+			state.refreshing = false
+			dp.providersLock.Unlock()
+		}(state)
+	}
+}
+
+func (dp *displayPager) maybeSendNextPage() {
+	if dp.lastPageSent.Add(dp.deej.config.DisplayPages.Interval).After(time.Now()) {
+		return
+	}
+
+	dp.providersLock.Lock()
+	defer dp.providersLock.Unlock()
+
+	// look for the next provider that actually has something to show
+	for attempt := 0; attempt < len(dp.providers); attempt++ {
+		state := dp.providers[dp.nextPageIdx%len(dp.providers)]
+		dp.nextPageIdx = (dp.nextPageIdx + 1) % len(dp.providers)
+
+		page, ok := state.provider.page()
+		if !ok {
+			continue
+		}
+
+		dp.lastPageSent = time.Now()
+
+		if err := dp.deej.serial.SendDisplayPage(page); err != nil {
+			if dp.deej.Verbose() {
+				dp.logger.Warnw("Failed to send display page", "provider", state.provider.name(), "error", err)
+			}
+		}
+
+		return
+	}
+}
@@ -0,0 +1,256 @@
+package deej
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	// every mapped slider gets a row: its app, volume (as text and a bar) and audio peak (as a meter)
+	screenRowSliders = "sliders"
+
+	// a single slider's row, by slider ID (e.g. "slider:2")
+	screenRowSliderPrefix = "slider:"
+
+	// the active profile's name
+	screenRowProfile = "profile"
+
+	// the current time
+	screenRowClock = "clock"
+
+	defaultDisplayScreenIntervalSeconds = 10
+	defaultDisplayScreenRefreshMillis   = 250
+)
+
+// displayScreensConfig holds the user's structured screens, cycled on devices whose display declared rows
+type displayScreensConfig struct {
+	Interval        time.Duration
+	RefreshInterval time.Duration
+	Screens         []displayScreen
+}
+
+// displayScreen is a titled screen made of rows, each of them one of the screenRow kinds above
+type displayScreen struct {
+	Title string
+	Rows  []string
+}
+
+// screenRow is what a single row shows. bar and meter are 0-100, or -1 to leave them out
+type screenRow struct {
+	Label string
+	Text  string
+	Bar   int
+	Meter int
+}
+
+func validScreenRowKind(kind string) bool {
+	switch kind {
+	case screenRowSliders, screenRowProfile, screenRowClock, screenRowNowPlaying:
+		return true
+	}
+
+	if strings.HasPrefix(kind, screenRowSliderPrefix) {
+		sliderID, err := strconv.Atoi(strings.TrimPrefix(kind, screenRowSliderPrefix))
+		return err == nil && sliderID >= 0
+	}
+
+	return false
+}
+
+// displayScreener composes the configured screens from deej's state and keeps them up to date on the device.
+// screens are only sent to devices that declared how many rows their display has (#CAPS:...,rows=8), since
+// others don't know the screen commands
+type displayScreener struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+
+	screenIdx        int
+	lastScreenChange time.Time
+
+	// what was last sent, so unchanged screens aren't sent again
+	lastFrames string
+
+	stopChannel chan bool
+}
+
+func newDisplayScreener(deej *Deej, logger *zap.SugaredLogger) *displayScreener {
+	logger = logger.Named("display-screens")
+
+	ds := &displayScreener{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created display screener instance")
+
+	return ds
+}
+
+// Start begins sending screens. it keeps running without any configured, to pick up a config change
+func (ds *displayScreener) Start() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.running {
+		return
+	}
+
+	ds.running = true
+
+	go ds.screenLoop()
+}
+
+// Stop ends sending screens
+func (ds *displayScreener) Stop() {
+	ds.lock.Lock()
+
+	if !ds.running {
+		ds.lock.Unlock()
+		return
+	}
+
+	ds.running = false
+	ds.lock.Unlock()
+
+	ds.stopChannel <- true
+}
+
+func (ds *displayScreener) screenLoop() {
+	for {
+		select {
+		case <-ds.stopChannel:
+			return
+
+		// the interval can change with the config, so it's picked up every time around
+		case <-time.After(ds.deej.config.DisplayScreens.RefreshInterval):
+			ds.update()
+		}
+	}
+}
+
+// update moves on to the next screen when it's time to, and sends the current one if anything on it changed
+func (ds *displayScreener) update() {
+	config := ds.deej.config.DisplayScreens
+	capabilities, charset := ds.deej.serial.currentDisplayCapabilities()
+
+	if len(config.Screens) == 0 || capabilities.Rows == 0 || !ds.deej.serial.isConnected() {
+		ds.lastFrames = ""
+		return
+	}
+
+	if ds.lastScreenChange.Add(config.Interval).Before(time.Now()) {
+		ds.screenIdx++
+		ds.lastScreenChange = time.Now()
+	}
+
+	screen := config.Screens[ds.screenIdx%len(config.Screens)]
+	rows := ds.composeRows(screen)
+
+	if len(rows) > capabilities.Rows {
+		rows = rows[:capabilities.Rows]
+	}
+
+	encoder := ds.deej.config.DisplayEncoder
+
+	title := encoder.formatDisplayText(protocol.SanitizeDisplayText(screen.Title), capabilities.TitleWidth, charset)
+
+	frames := []string{protocol.ScreenBegin(title)}
+	for rowIdx, row := range rows {
+		label := encoder.formatDisplayLabel(protocol.SanitizeDisplayText(row.Label), capabilities.LabelWidth, charset)
+		text := encoder.formatDisplayText(protocol.SanitizeDisplayText(row.Text), capabilities.TextWidth, charset)
+
+		frames = append(frames, protocol.ScreenRow(rowIdx, label, text, row.Bar, row.Meter))
+	}
+	frames = append(frames, protocol.ScreenEnd())
+
+	joined := strings.Join(frames, "")
+	if joined == ds.lastFrames {
+		return
+	}
+
+	for _, frame := range frames {
+		if err := ds.deej.serial.writeCommand(frame); err != nil {
+			if ds.deej.Verbose() {
+				ds.logger.Warnw("Failed to send display screen", "title", screen.Title, "error", err)
+			}
+
+			return
+		}
+	}
+
+	ds.lastFrames = joined
+}
+
+// composeRows works out what each of the screen's rows shows right now
+func (ds *displayScreener) composeRows(screen displayScreen) []screenRow {
+	rows := []screenRow{}
+
+	for _, kind := range screen.Rows {
+		switch {
+		case kind == screenRowSliders:
+			sliderIDs := []int{}
+			ds.deej.config.SliderMapping.iterate(func(sliderID int, targets []string) {
+				sliderIDs = append(sliderIDs, sliderID)
+			})
+			sort.Ints(sliderIDs)
+
+			for _, sliderID := range sliderIDs {
+				rows = append(rows, ds.sliderRow(sliderID))
+			}
+
+		case strings.HasPrefix(kind, screenRowSliderPrefix):
+			sliderID, err := strconv.Atoi(strings.TrimPrefix(kind, screenRowSliderPrefix))
+			if err == nil {
+				rows = append(rows, ds.sliderRow(sliderID))
+			}
+
+		case kind == screenRowProfile:
+			rows = append(rows, screenRow{Label: "Profile", Text: ds.deej.config.ActiveProfile, Bar: -1, Meter: -1})
+
+		case kind == screenRowClock:
+			rows = append(rows, screenRow{Label: "Time", Text: time.Now().Format("15:04"), Bar: -1, Meter: -1})
+
+		case kind == screenRowNowPlaying:
+			rows = append(rows, ds.nowPlayingRow())
+		}
+	}
+
+	return rows
+}
+
+// sliderRow shows the slider's app (the loudest one, in audio LED mode), its position and volume, and its audio peak
+func (ds *displayScreener) sliderRow(sliderID int) screenRow {
+	row := screenRow{Text: "-", Bar: -1, Meter: -1}
+
+	if targets, ok := ds.deej.config.SliderMapping.get(sliderID); ok && len(targets) > 0 {
+		row.Label = strings.TrimSuffix(targets[0], ".exe")
+	}
+
+	if peak, name, ok := ds.deej.processMonitor.sliderActivity(sliderID); ok {
+		row.Meter = peak
+
+		if name != "" {
+			row.Label = name
+		}
+	}
+
+	// the bar follows the fader, and the text says where that put its apps if it's somewhere else
+	if readout, ok := ds.deej.sessions.sliderReadout(sliderID); ok {
+		row.Bar = readout.position
+		row.Text = readout.compact()
+	}
+
+	return row
+}
@@ -0,0 +1,159 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// every piece of text sent to a device's display goes through here, so that it's romanized for the display's
+// charset, cut to the display's width on character (not byte) boundaries, and only then encoded
+
+const (
+	// devices declare their display's capabilities with a line like "#CAPS:charset=ascii,label=4,title=10,text=21"
+	displayCapabilitiesPrefix = "#CAPS:"
+
+	utf8Ellipsis  = "…"
+	asciiEllipsis = "."
+)
+
+// displayCapabilities describes what a device's display can show
+type displayCapabilities struct {
+
+	// empty to use the config's display_charset
+	Charset string
+
+	LabelWidth int // per-slider app labels
+	TitleWidth int // display page titles
+	TextWidth  int // display page text
+
+	// rows on a structured screen (see display_screens.go), or 0 for displays that can't show them
+	Rows int
+}
+
+// used until (or unless) the device declares its own - these fit a 128px wide screen and the firmware's buffers
+var defaultDisplayCapabilities = displayCapabilities{
+	LabelWidth: 4,
+	TitleWidth: 10,
+	TextWidth:  21,
+}
+
+// parseDisplayCapabilities reads a "#CAPS:key=value,..." line, starting from the defaults for any missing keys
+func parseDisplayCapabilities(line string) (displayCapabilities, error) {
+	capabilities := defaultDisplayCapabilities
+
+	fields := strings.TrimSpace(strings.TrimPrefix(line, displayCapabilitiesPrefix))
+
+	for _, field := range strings.Split(fields, ",") {
+		keyValue := strings.SplitN(field, "=", 2)
+		if len(keyValue) != 2 {
+			return capabilities, fmt.Errorf("invalid capability %q", field)
+		}
+
+		key, value := strings.ToLower(keyValue[0]), strings.ToLower(keyValue[1])
+
+		if key == "charset" {
+			switch value {
+			case displayCharsetUTF8, displayCharsetASCII, displayCharsetLatin1, displayCharsetCP1251:
+				capabilities.Charset = value
+			default:
+				return capabilities, fmt.Errorf("unknown charset %q", value)
+			}
+
+			continue
+		}
+
+		width, err := strconv.Atoi(value)
+		if err != nil || width < 1 {
+			return capabilities, fmt.Errorf("invalid width for %s: %q", key, value)
+		}
+
+		switch key {
+		case "label":
+			capabilities.LabelWidth = width
+		case "title":
+			capabilities.TitleWidth = width
+		case "text":
+			capabilities.TextWidth = width
+		case "rows":
+			capabilities.Rows = width
+		}
+	}
+
+	return capabilities, nil
+}
+
+// formatDisplayText prepares text for a field of the given width, ending it with an ellipsis if it had to be cut
+func (dte *displayTextEncoder) formatDisplayText(text string, width int, charset string) string {
+	text = dte.romanize(text, charset)
+
+	ellipsis := asciiEllipsis
+	if charset == displayCharsetUTF8 {
+		ellipsis = utf8Ellipsis
+	}
+
+	return encodeDisplayCharset(fitDisplayText(text, width, ellipsis), charset)
+}
+
+// formatDisplayLabel prepares an app name as a label of the given width, abbreviating rather than cutting it
+func (dte *displayTextEncoder) formatDisplayLabel(name string, width int, charset string) string {
+	return encodeDisplayCharset(abbreviateDisplayLabel(dte.romanize(name, charset), width), charset)
+}
+
+// fitDisplayText shortens text to at most width characters, the last of which is the given ellipsis if it was cut
+func fitDisplayText(text string, width int, ellipsis string) string {
+	runes := []rune(text)
+	if len(runes) <= width {
+		return text
+	}
+
+	ellipsisRunes := []rune(ellipsis)
+	if width <= len(ellipsisRunes) {
+		return string(runes[:width])
+	}
+
+	return string(runes[:width-len(ellipsisRunes)]) + ellipsis
+}
+
+// abbreviateDisplayLabel creates an abbreviation of at most width characters, preferring consonants
+// e.g., "chrome" → "chrm", "firefox" → "frfx", "discord" → "dscr"
+func abbreviateDisplayLabel(name string, width int) string {
+	runes := []rune(name)
+	if len(runes) <= width {
+		return name
+	}
+
+	isVowel := func(r rune) bool {
+		return strings.ContainsRune("aeiouAEIOU", r)
+	}
+
+	// keep the first character whatever it is, then as many consonants as fit
+	picked := make([]bool, len(runes))
+	picked[0] = true
+	count := 1
+
+	for idx := 1; idx < len(runes) && count < width; idx++ {
+		if !isVowel(runes[idx]) && !unicode.IsSpace(runes[idx]) {
+			picked[idx] = true
+			count++
+		}
+	}
+
+	// not enough consonants - top up with the earliest remaining characters
+	for idx := 1; idx < len(runes) && count < width; idx++ {
+		if !picked[idx] {
+			picked[idx] = true
+			count++
+		}
+	}
+
+	result := make([]rune, 0, width)
+	for idx, r := range runes {
+		if picked[idx] {
+			result = append(result, r)
+		}
+	}
+
+	return string(result)
+}
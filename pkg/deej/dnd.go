@@ -0,0 +1,227 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	buttonActionDNDToggle = "dnd.toggle" // turn the OS's do not disturb mode on or off
+
+	defaultDNDPollSeconds = 5
+)
+
+// dndConfig holds the user's do not disturb sync settings
+type dndConfig struct {
+	Sync         bool
+	PollInterval time.Duration
+
+	// profile to switch to while do not disturb is on (empty to leave profiles alone)
+	Profile string
+
+	// volumes to apply while do not disturb is on, restored when it's turned off
+	QuietVolumes map[string]float32
+}
+
+// dndSync follows the OS's do not disturb state (Focus Assist on Windows, GNOME's notification banners on Linux),
+// applying a quieter setup while it's on and restoring the previous one when it's turned off
+type dndSync struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+	active  bool
+
+	// what we changed when do not disturb was turned on, to be restored when it's turned off
+	previousProfile string
+	previousVolumes map[string]float32
+
+	stopChannel chan bool
+}
+
+func newDNDSync(deej *Deej, logger *zap.SugaredLogger) *dndSync {
+	logger = logger.Named("dnd")
+
+	ds := &dndSync{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created do not disturb sync instance")
+
+	return ds
+}
+
+// Start begins polling the OS's do not disturb state, if enabled in the config
+func (ds *dndSync) Start() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.running || !ds.deej.config.DoNotDisturb.Sync {
+		return
+	}
+
+	if !osDoNotDisturbSupported {
+		ds.logger.Warnw("Do not disturb sync isn't supported on this platform", "error", util.ErrNotSupported)
+		return
+	}
+
+	ds.running = true
+
+	go ds.pollLoop()
+}
+
+// Stop ends polling, restoring anything changed while do not disturb was on
+func (ds *dndSync) Stop() {
+	ds.lock.Lock()
+
+	if !ds.running {
+		ds.lock.Unlock()
+		return
+	}
+
+	ds.running = false
+
+	if ds.active {
+		ds.active = false
+		ds.restore()
+	}
+
+	ds.lock.Unlock()
+
+	ds.stopChannel <- true
+}
+
+// Toggle flips the OS's do not disturb state. when syncing, the change is picked up on the next poll
+func (ds *dndSync) Toggle() {
+	enabled, err := getOSDoNotDisturb()
+	if err != nil {
+		ds.logger.Warnw("Failed to get do not disturb state", "error", err)
+		return
+	}
+
+	if err := setOSDoNotDisturb(!enabled); err != nil {
+		ds.logger.Warnw("Failed to set do not disturb state", "error", err)
+		ds.deej.notifier.Notify("Can't change Do Not Disturb", "Your system doesn't allow deej to change it.")
+		return
+	}
+
+	ds.logger.Infow("Changed do not disturb state", "enabled", !enabled)
+
+	// don't wait for the next poll to apply the quiet setup
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.running {
+		ds.applyState(!enabled)
+	}
+}
+
+func (ds *dndSync) pollLoop() {
+	ticker := time.NewTicker(ds.deej.config.DoNotDisturb.PollInterval)
+	defer ticker.Stop()
+
+	ds.poll()
+
+	for {
+		select {
+		case <-ds.stopChannel:
+			return
+		case <-ticker.C:
+			ds.poll()
+		}
+	}
+}
+
+func (ds *dndSync) poll() {
+	enabled, err := getOSDoNotDisturb()
+	if err != nil {
+		if ds.deej.Verbose() {
+			ds.logger.Debugw("Failed to get do not disturb state", "error", err)
+		}
+
+		return
+	}
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.running {
+		ds.applyState(enabled)
+	}
+}
+
+// applyState applies or restores the quiet setup if the state changed. assumes the lock is held
+func (ds *dndSync) applyState(enabled bool) {
+	if enabled == ds.active {
+		return
+	}
+
+	ds.active = enabled
+
+	if enabled {
+		ds.logger.Info("Do not disturb turned on, applying quiet setup")
+		ds.applyQuiet()
+	} else {
+		ds.logger.Info("Do not disturb turned off, restoring previous setup")
+		ds.restore()
+	}
+}
+
+func (ds *dndSync) applyQuiet() {
+	config := ds.deej.config.DoNotDisturb
+
+	ds.previousVolumes = make(map[string]float32)
+
+	for target, volume := range config.QuietVolumes {
+		if ds.deej.config.automationExempt(target) {
+			continue
+		}
+
+		previous, ok := ds.deej.sessions.getTargetVolume(target)
+		if !ok {
+			continue
+		}
+
+		if ds.deej.fader.fadeTargetDefault(target, volume) {
+			ds.previousVolumes[target] = previous
+		}
+	}
+
+	ds.previousProfile = ""
+
+	if config.Profile != "" && config.Profile != ds.deej.config.ActiveProfile {
+		ds.previousProfile = ds.deej.config.ActiveProfile
+
+		// switching profiles notifies config consumers, which mustn't wait on us
+		go ds.switchProfile(config.Profile)
+	}
+}
+
+func (ds *dndSync) restore() {
+	for target, volume := range ds.previousVolumes {
+		ds.deej.fader.fadeTargetDefault(target, volume)
+	}
+
+	ds.previousVolumes = nil
+
+	// only switch back if the user didn't pick another profile in the meantime
+	if ds.previousProfile != "" && ds.deej.config.ActiveProfile == ds.deej.config.DoNotDisturb.Profile {
+		go ds.switchProfile(ds.previousProfile)
+	}
+
+	ds.previousProfile = ""
+}
+
+func (ds *dndSync) switchProfile(name string) {
+	if err := ds.deej.config.SwitchProfile(name); err != nil {
+		ds.logger.Warnw("Failed to switch profile for do not disturb", "profile", name, "error", err)
+	}
+}
@@ -0,0 +1,37 @@
+package deej
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// see dnd_other.go
+const osDoNotDisturbSupported = true
+
+// GNOME implements do not disturb by hiding notification banners, so that's what we follow here.
+// other desktops aren't supported - there the state can't be read, and syncing is effectively a no-op
+const (
+	gnomeNotificationsSchema = "org.gnome.desktop.notifications"
+	gnomeShowBannersKey      = "show-banners"
+)
+
+func getOSDoNotDisturb() (bool, error) {
+	output, err := exec.Command("gsettings", "get", gnomeNotificationsSchema, gnomeShowBannersKey).Output()
+	if err != nil {
+		return false, fmt.Errorf("get notification banner setting: %w", err)
+	}
+
+	// banners are shown unless do not disturb is on
+	return strings.TrimSpace(string(output)) == "false", nil
+}
+
+func setOSDoNotDisturb(enabled bool) error {
+	showBanners := fmt.Sprint(!enabled)
+
+	if err := exec.Command("gsettings", "set", gnomeNotificationsSchema, gnomeShowBannersKey, showBanners).Run(); err != nil {
+		return fmt.Errorf("set notification banner setting: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// there's no known way to read or change the OS's do not disturb state here, so do_not_disturb.sync
+// stays off and the dnd.toggle button action does nothing. that includes macOS, whose Focus modes have no API
+// for other apps to read or change them
+const osDoNotDisturbSupported = false
+
+func getOSDoNotDisturb() (bool, error) {
+	return false, util.ErrNotSupported
+}
+
+func setOSDoNotDisturb(enabled bool) error {
+	return util.ErrNotSupported
+}
@@ -0,0 +1,72 @@
+package deej
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// see dnd_other.go
+const osDoNotDisturbSupported = true
+
+// Focus Assist has no public API - its state is published through the (undocumented, but long stable)
+// windows notification facility, which is also what the action center's own toggle writes to
+var (
+	ntdll                    = syscall.NewLazyDLL("ntdll.dll")
+	procZwQueryWnfStateData  = ntdll.NewProc("ZwQueryWnfStateData")
+	procZwUpdateWnfStateData = ntdll.NewProc("ZwUpdateWnfStateData")
+)
+
+const (
+	wnfShelQuietHoursActiveProfileChanged uint64 = 0x0D83063EA3BF1C75
+
+	focusAssistOff          uint32 = 0
+	focusAssistPriorityOnly uint32 = 1
+)
+
+func getOSDoNotDisturb() (bool, error) {
+	stateName := wnfShelQuietHoursActiveProfileChanged
+
+	var changeStamp uint32
+	var profile uint32
+	bufferSize := uint32(unsafe.Sizeof(profile))
+
+	status, _, _ := procZwQueryWnfStateData.Call(
+		uintptr(unsafe.Pointer(&stateName)),
+		0,
+		0,
+		uintptr(unsafe.Pointer(&changeStamp)),
+		uintptr(unsafe.Pointer(&profile)),
+		uintptr(unsafe.Pointer(&bufferSize)))
+
+	if status != 0 {
+		return false, fmt.Errorf("query focus assist state: NTSTATUS 0x%x", status)
+	}
+
+	// anything other than off (priority only, alarms only) counts as do not disturb
+	return profile != focusAssistOff, nil
+}
+
+func setOSDoNotDisturb(enabled bool) error {
+	stateName := wnfShelQuietHoursActiveProfileChanged
+
+	profile := focusAssistOff
+	if enabled {
+		profile = focusAssistPriorityOnly
+	}
+
+	status, _, _ := procZwUpdateWnfStateData.Call(
+		uintptr(unsafe.Pointer(&stateName)),
+		uintptr(unsafe.Pointer(&profile)),
+		unsafe.Sizeof(profile),
+		0,
+		0,
+		0,
+		0)
+
+	if status != 0 {
+		return fmt.Errorf("update focus assist state: NTSTATUS 0x%x", status)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// slider targets starting with this prefix drive a named DSP parameter instead of an audio session
+	dspTargetPrefix = "dsp."
+
+	dspTypeEqualizerAPO = "equalizer_apo" // also covers Peace, which is a frontend for Equalizer APO
+	dspTypeOSC          = "osc"
+
+	// Equalizer APO reloads its config whenever the file changes, so batch up rapid slider moves
+	dspFileWriteDelay = 100 * time.Millisecond
+)
+
+// dspParameter is a single named parameter of an external DSP, driven by a slider mapped to "dsp.<name>"
+type dspParameter struct {
+	Type string
+
+	// the range the slider's 0-100% is mapped onto (e.g. -12 to 12 for a gain in dB)
+	Min     float64
+	Max     float64
+	Default float64
+
+	// equalizer_apo: the config file to write, and the line to write into it with {value} replaced
+	File     string
+	Template string
+
+	// osc: the host:port to send to, and the OSC address of the parameter
+	Address string
+	Path    string
+}
+
+// dspController forwards slider moves on "dsp." targets to the configured external DSPs
+type dspController struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	values       map[string]float64
+	pendingFiles map[string]bool
+
+	osc *oscSender
+}
+
+func newDSPController(deej *Deej, logger *zap.SugaredLogger) *dspController {
+	logger = logger.Named("dsp")
+
+	dc := &dspController{
+		deej:         deej,
+		logger:       logger,
+		values:       make(map[string]float64),
+		pendingFiles: make(map[string]bool),
+		osc:          newOSCSender(),
+	}
+
+	logger.Debug("Created DSP controller instance")
+
+	return dc
+}
+
+// handlesTarget reports whether the given slider target is a DSP parameter
+func (dc *dspController) handlesTarget(target string) bool {
+	return strings.HasPrefix(strings.ToLower(target), dspTargetPrefix)
+}
+
+// setParameter maps a slider's value onto the named parameter's range and sends it to its DSP
+func (dc *dspController) setParameter(target string, percentValue float32) error {
+	name := strings.TrimPrefix(strings.ToLower(target), dspTargetPrefix)
+
+	parameter, ok := dc.deej.config.DSP[name]
+	if !ok {
+		return fmt.Errorf("unknown DSP parameter: %s", name)
+	}
+
+	value := parameter.Min + (parameter.Max-parameter.Min)*float64(percentValue)
+
+	dc.lock.Lock()
+	defer dc.lock.Unlock()
+
+	if previous, ok := dc.values[name]; ok && previous == value {
+		return nil
+	}
+
+	dc.values[name] = value
+
+	switch parameter.Type {
+	case dspTypeEqualizerAPO:
+		dc.scheduleFileWrite(parameter.File)
+
+	case dspTypeOSC:
+		if err := dc.osc.send(parameter.Address, parameter.Path, float32(value)); err != nil {
+			return fmt.Errorf("send OSC parameter %s: %w", name, err)
+		}
+
+	default:
+		return fmt.Errorf("unknown DSP type %q for parameter %s", parameter.Type, name)
+	}
+
+	return nil
+}
+
+// scheduleFileWrite writes the given Equalizer APO config file shortly, unless a write is already pending.
+// assumes the lock is held
+func (dc *dspController) scheduleFileWrite(file string) {
+	if dc.pendingFiles[file] {
+		return
+	}
+
+	dc.pendingFiles[file] = true
+
+	time.AfterFunc(dspFileWriteDelay, func() {
+		dc.lock.Lock()
+		defer dc.lock.Unlock()
+
+		delete(dc.pendingFiles, file)
+
+		if err := writeEqualizerAPOConfig(file, dc.deej.config.DSP, dc.values); err != nil {
+			dc.logger.Warnw("Failed to write Equalizer APO config", "file", file, "error", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const equalizerAPOValuePlaceholder = "{value}"
+
+// writeEqualizerAPOConfig writes one line per parameter that targets the given file, each with its current value
+// (or its default, if its slider hasn't moved yet). the file is meant to be dedicated to deej, and included
+// from Equalizer APO's config.txt (or selected in Peace) with "Include: <file>"
+func writeEqualizerAPOConfig(file string, parameters map[string]dspParameter, values map[string]float64) error {
+	names := []string{}
+	for name, parameter := range parameters {
+		if parameter.Type == dspTypeEqualizerAPO && parameter.File == file {
+			names = append(names, name)
+		}
+	}
+
+	// keep the file stable between writes
+	sort.Strings(names)
+
+	lines := []string{"# written by deej - changes to this file will be overwritten"}
+
+	for _, name := range names {
+		parameter := parameters[name]
+
+		value, ok := values[name]
+		if !ok {
+			value = parameter.Default
+		}
+
+		lines = append(lines, strings.Replace(parameter.Template, equalizerAPOValuePlaceholder, fmt.Sprintf("%.1f", value), -1))
+	}
+
+	// write to a temporary file first, so Equalizer APO never picks up a half-written config
+	tempFile := file + ".tmp"
+	if err := ioutil.WriteFile(tempFile, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0644); err != nil {
+		return fmt.Errorf("write temporary config %s: %w", filepath.Base(tempFile), err)
+	}
+
+	if err := os.Rename(tempFile, file); err != nil {
+		return fmt.Errorf("replace config %s: %w", filepath.Base(file), err)
+	}
+
+	return nil
+}
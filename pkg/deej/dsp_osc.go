@@ -0,0 +1,63 @@
+package deej
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+)
+
+// oscSender sends single-float OSC messages over UDP (e.g. to a VST host), keeping one connection per address.
+// callers are expected to serialize access
+type oscSender struct {
+	connections map[string]net.Conn
+}
+
+func newOSCSender() *oscSender {
+	return &oscSender{
+		connections: make(map[string]net.Conn),
+	}
+}
+
+func (osc *oscSender) send(address string, path string, value float32) error {
+	connection, ok := osc.connections[address]
+	if !ok {
+		var err error
+
+		connection, err = net.Dial("udp", address)
+		if err != nil {
+			return fmt.Errorf("dial %s: %w", address, err)
+		}
+
+		osc.connections[address] = connection
+	}
+
+	if _, err := connection.Write(encodeOSCFloatMessage(path, value)); err != nil {
+		connection.Close()
+		delete(osc.connections, address)
+
+		return fmt.Errorf("write to %s: %w", address, err)
+	}
+
+	return nil
+}
+
+// encodeOSCFloatMessage builds an OSC 1.0 message carrying a single float32 argument
+func encodeOSCFloatMessage(path string, value float32) []byte {
+	buffer := &bytes.Buffer{}
+
+	writeOSCString(buffer, path)
+	writeOSCString(buffer, ",f")
+	binary.Write(buffer, binary.BigEndian, math.Float32bits(value))
+
+	return buffer.Bytes()
+}
+
+// writeOSCString writes a null-terminated string, padded to a multiple of 4 bytes
+func writeOSCString(buffer *bytes.Buffer, value string) {
+	buffer.WriteString(value)
+
+	padding := 4 - len(value)%4
+	buffer.Write(make([]byte, padding))
+}
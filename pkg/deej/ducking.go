@@ -0,0 +1,276 @@
+package deej
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	// how often to check whether the priority targets are making noise
+	duckingCheckInterval = 100 * time.Millisecond
+
+	defaultDuckingThreshold        = 0.05
+	defaultDuckingAmountDB         = 12
+	defaultDuckingReleaseMillisecs = 1000
+)
+
+// duckingConfig holds the user's automatic ducking settings
+type duckingConfig struct {
+	Enabled bool
+
+	// targets whose audio causes everything else to be ducked (e.g. discord.exe)
+	PriorityTargets []string
+
+	// targets to duck, or empty to duck every (non-priority) target mapped to a slider
+	Targets []string
+
+	// peak level (0-1) above which a priority target counts as making noise
+	Threshold float32
+
+	// how far to lower ducked targets, in dB
+	AmountDB float32
+
+	// how long the priority targets need to stay quiet before ducked targets are restored
+	Release time.Duration
+}
+
+// audioDucker lowers other targets' volumes while a priority target outputs audio, and restores them once it stops
+type audioDucker struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	meter *AudioMeterService
+
+	lock sync.Mutex
+
+	running           bool
+	lastPriorityAudio time.Time
+
+	// the volume each currently ducked target had before being ducked
+	duckedVolumes map[string]float32
+
+	stopChannel chan bool
+}
+
+func newAudioDucker(deej *Deej, logger *zap.SugaredLogger) *audioDucker {
+	logger = logger.Named("ducking")
+
+	ad := &audioDucker{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created audio ducker instance")
+
+	return ad
+}
+
+// Start begins watching the priority targets. ducking can be enabled or disabled at any time from the config
+func (ad *audioDucker) Start() {
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+
+	if ad.running {
+		return
+	}
+
+	// without a meter there's no telling when a priority app makes noise (see audio_meter_other.go)
+	if !audioMeterSupported {
+		if ad.deej.config.Ducking.Enabled {
+			ad.logger.Warnw("Ducking isn't supported on this platform, leaving volumes alone", "error", util.ErrNotSupported)
+		}
+
+		return
+	}
+
+	ad.running = true
+
+	ad.setupOnSliderMove()
+	go ad.duckingLoop()
+}
+
+// Stop ends ducking, restoring anything currently ducked
+func (ad *audioDucker) Stop() {
+	ad.lock.Lock()
+
+	if !ad.running {
+		ad.lock.Unlock()
+		return
+	}
+
+	ad.running = false
+	ad.restore()
+	ad.lock.Unlock()
+
+	ad.stopChannel <- true
+}
+
+// setupOnSliderMove forgets ducked targets when the user moves their slider, so we don't later "restore" them
+// to a volume the user has since moved away from
+func (ad *audioDucker) setupOnSliderMove() {
+	sliderEventsChannel := ad.deej.serial.SubscribeToSliderMoveEvents().Events
+
+	go func() {
+		for {
+			select {
+			case event := <-sliderEventsChannel:
+				targets, ok := ad.deej.config.SliderMapping.get(event.SliderID)
+				if !ok {
+					continue
+				}
+
+				ad.lock.Lock()
+				for _, target := range targets {
+					delete(ad.duckedVolumes, normalizeTarget(target))
+				}
+				ad.lock.Unlock()
+			}
+		}
+	}()
+}
+
+func (ad *audioDucker) duckingLoop() {
+	ticker := time.NewTicker(duckingCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ad.stopChannel:
+			return
+		case <-ticker.C:
+			ad.check()
+		}
+	}
+}
+
+func (ad *audioDucker) check() {
+	config := ad.deej.config.Ducking
+
+	ad.lock.Lock()
+	defer ad.lock.Unlock()
+
+	if !config.Enabled || len(config.PriorityTargets) == 0 {
+		ad.restore()
+		return
+	}
+
+	// the meter is only created once ducking is actually in use, as polling it isn't free
+	if ad.meter == nil {
+		ad.meter = NewAudioMeterService(ad.logger)
+	}
+
+	peakLevels, err := ad.meter.GetAudioPeakLevels()
+	if err != nil {
+		if ad.deej.Verbose() {
+			ad.logger.Debugw("Failed to get audio peak levels", "error", err)
+		}
+
+		return
+	}
+
+	priorityAudio := false
+	for _, target := range ad.deej.sessions.expandIdentityTargets(config.PriorityTargets) {
+		for _, level := range matchingPeakLevels(target, peakLevels) {
+			if level > config.Threshold {
+				priorityAudio = true
+			}
+		}
+	}
+
+	now := time.Now()
+
+	if priorityAudio {
+		ad.lastPriorityAudio = now
+
+		if ad.duckedVolumes == nil {
+			ad.duck(config)
+		}
+
+		return
+	}
+
+	if ad.duckedVolumes != nil && now.Sub(ad.lastPriorityAudio) > config.Release {
+		ad.restore()
+	}
+}
+
+// duck lowers every target to be ducked. assumes the lock is held
+func (ad *audioDucker) duck(config duckingConfig) {
+	ad.duckedVolumes = make(map[string]float32)
+
+	for _, target := range ad.duckTargets(config) {
+
+		// priority classes can keep a target out of it, or have it ducked further than the rest
+		factor := ad.deej.config.duckFactor(target)
+		if factor == 0 {
+			continue
+		}
+
+		gain := float32(math.Pow(10, -float64(config.AmountDB*factor)/20))
+
+		volume, ok := ad.deej.sessions.getTargetVolume(target)
+		if !ok || volume == 0 {
+			continue
+		}
+
+		if ad.deej.fader.fadeTargetDefault(target, volume*gain) {
+			ad.duckedVolumes[target] = volume
+		}
+	}
+
+	ad.logger.Debugw("Priority audio detected, ducked targets", "targets", ad.duckedVolumes, "amountDB", config.AmountDB)
+}
+
+// restore brings every ducked target back to its previous volume. assumes the lock is held
+func (ad *audioDucker) restore() {
+	if ad.duckedVolumes == nil {
+		return
+	}
+
+	for target, volume := range ad.duckedVolumes {
+		ad.deej.fader.fadeTargetDefault(target, volume)
+	}
+
+	ad.logger.Debugw("Priority audio stopped, restored ducked targets", "targets", ad.duckedVolumes)
+	ad.duckedVolumes = nil
+}
+
+// duckTargets returns the configured targets to duck, or every regular target mapped to a slider
+// (skipping the priority targets themselves, device-wide targets and special ones)
+func (ad *audioDucker) duckTargets(config duckingConfig) []string {
+	if len(config.Targets) > 0 {
+		return config.Targets
+	}
+
+	excluded := map[string]bool{
+		masterSessionName: true,
+		inputSessionName:  true,
+	}
+
+	for _, target := range config.PriorityTargets {
+		excluded[target] = true
+	}
+
+	targets := []string{}
+
+	ad.deej.config.SliderMapping.iterate(func(sliderID int, sliderTargets []string) {
+		for _, target := range sliderTargets {
+			target = normalizeTarget(target)
+
+			if excluded[target] || ad.deej.sessions.targetHasSpecialTransform(target) {
+				continue
+			}
+
+			excluded[target] = true
+			targets = append(targets, target)
+		}
+	})
+
+	return targets
+}
@@ -0,0 +1,211 @@
+// deej-emulator pretends to be a deej board, for checking that deej is set up right before the hardware arrives
+// (or working on deej without it). it opens a pseudo-terminal for deej's com_port to point at (linux), or connects
+// to deej over the network like a Wi-Fi board would (connection_info's listen). type commands to move its sliders
+// and press its buttons, and it logs what deej sends it
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/omriharel/deej/pkg/deej/emulator"
+)
+
+const (
+	// how long to wait for deej to take a network connection, and between attempts
+	dialTimeout    = 2 * time.Second
+	reconnectDelay = 2 * time.Second
+
+	commandHelp = `commands:
+  <slider>=<percent>  move a slider, e.g. 0=75
+  b<button>           click a button, e.g. b1
+  status              show where the sliders are and which LEDs are on
+  help                show this`
+)
+
+var (
+	verbose bool
+	usePTY  bool
+	connect string
+	options emulator.Options
+)
+
+func init() {
+	flag.BoolVar(&verbose, "verbose", false, "show every frame deej sends")
+	flag.BoolVar(&verbose, "v", false, "shorthand for --verbose")
+	flag.BoolVar(&usePTY, "pty", false, "open a pseudo-terminal for deej's com_port to point at (linux only)")
+	flag.StringVar(&connect, "connect", "", "connect to deej listening for network devices at the given address (e.g. localhost:5335), reconnecting whenever the connection drops")
+	flag.IntVar(&options.Sliders, "sliders", 5, "how many sliders the device has")
+	flag.IntVar(&options.Buttons, "buttons", 0, "how many buttons the device has")
+	flag.StringVar(&options.ID, "id", "emulator", "the device's unique ID, as reported with #ID")
+	flag.StringVar(&options.Firmware, "fw", "emulator", "the firmware version reported in #HELLO")
+	flag.BoolVar(&options.LEDs, "leds", true, "whether the device has an LED per slider")
+	flag.BoolVar(&options.RGB, "rgb", true, "whether its LEDs can show colors")
+	flag.BoolVar(&options.Display, "display", true, "whether it has a display")
+	flag.StringVar(&options.Motion, "motion", emulator.MotionStill, "how the sliders move by themselves: still, sweep or random (careful, these move real volumes)")
+	flag.DurationVar(&options.Interval, "interval", emulator.DefaultLineInterval, "how often to send slider values")
+	flag.Parse()
+}
+
+func main() {
+	logger, err := newLogger(verbose)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if usePTY == (connect != "") {
+		logger.Fatal("Use either --pty or --connect <address>")
+	}
+
+	device, err := emulator.New(options, logger)
+	if err != nil {
+		logger.Fatalw("Failed to create emulated device", "error", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-interrupts
+		logger.Info("Interrupted, stopping")
+		cancel()
+	}()
+
+	go readCommands(logger, device)
+
+	if usePTY {
+		err = runPTY(ctx, logger, device)
+	} else {
+		runNetwork(ctx, logger, device, connect)
+	}
+
+	if err != nil {
+		logger.Fatalw("Failed to emulate device", "error", err)
+	}
+}
+
+func runPTY(ctx context.Context, logger *zap.SugaredLogger, device *emulator.Device) error {
+	pty, err := emulator.OpenPTY()
+	if err != nil {
+		return err
+	}
+
+	defer pty.Close()
+
+	logger.Infow("Emulating a device, set deej's com_port to its port", "port", pty.Name)
+
+	// reads never fail while the pseudo-terminal's open (see emulator.PTY), so this only returns once stopped
+	return device.Run(ctx, pty)
+}
+
+func runNetwork(ctx context.Context, logger *zap.SugaredLogger, device *emulator.Device, address string) {
+	logger.Infow("Emulating a device, connecting to deej", "address", address)
+
+	for {
+		conn, err := net.DialTimeout("tcp", address, dialTimeout)
+		if err != nil {
+			logger.Infow("Couldn't connect to deej, is it listening there? Retrying", "address", address, "error", err)
+		} else {
+			logger.Infow("Connected to deej", "address", address)
+
+			err = device.Run(ctx, conn)
+			conn.Close()
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.Warnw("Lost connection to deej, reconnecting", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// readCommands moves the device's sliders and presses its buttons as typed into the terminal
+func readCommands(logger *zap.SugaredLogger, device *emulator.Device) {
+	fmt.Println(commandHelp)
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		command := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case command == "":
+			continue
+
+		case command == "help":
+			fmt.Println(commandHelp)
+
+		case command == "status":
+			fmt.Println(device.Status())
+
+		case strings.HasPrefix(command, "b"):
+			buttonID, err := strconv.Atoi(strings.TrimPrefix(command, "b"))
+			if err == nil {
+				err = device.PressButton(buttonID)
+			}
+
+			if err != nil {
+				logger.Warnw("Can't press button", "command", command, "error", err)
+			}
+
+		case strings.Contains(command, "="):
+			fields := strings.SplitN(command, "=", 2)
+
+			sliderIdx, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+			if err != nil {
+				logger.Warnw("Can't move slider", "command", command, "error", err)
+				continue
+			}
+
+			percent, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(fields[1]), "%"))
+			if err == nil {
+				err = device.SetSlider(sliderIdx, percent)
+			}
+
+			if err != nil {
+				logger.Warnw("Can't move slider", "command", command, "error", err)
+			}
+
+		default:
+			logger.Warnw("Unknown command, type help for the list", "command", command)
+		}
+	}
+}
+
+// newLogger logs to the terminal like deej's development builds do, but only shows debug logs with --verbose
+func newLogger(verbose bool) (*zap.SugaredLogger, error) {
+	config := zap.NewDevelopmentConfig()
+	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+
+	if !verbose {
+		config.Level = zap.NewAtomicLevelAt(zap.InfoLevel)
+	}
+
+	logger, err := config.Build()
+	if err != nil {
+		return nil, fmt.Errorf("create logger: %w", err)
+	}
+
+	return logger.Sugar(), nil
+}
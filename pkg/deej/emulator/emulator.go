@@ -0,0 +1,503 @@
+// Package emulator pretends to be a deej board. it sends slider values and button presses, answers the handshake,
+// heartbeats and identity requests, and keeps track of what deej sends it (LEDs, display pages and so on) the way
+// firmware would. deej-emulator (see cmd) connects it to deej over a pseudo-terminal or the network, for checking
+// a setup before the hardware arrives, or for working on firmware-facing parts of deej without any
+package emulator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+// how the sliders move by themselves, if at all
+const (
+	MotionStill  = "still"  // only when told to (see SetSlider), which is the default as moving them moves real volumes
+	MotionSweep  = "sweep"  // slowly up and down, each a little behind the one before it
+	MotionRandom = "random" // to somewhere new now and then, like someone using them
+)
+
+const (
+	// roughly how often real firmware sends slider values
+	DefaultLineInterval = 10 * time.Millisecond
+
+	maxRawValue = 1023
+
+	// how long #Q keeps the firmware from sending slider values
+	quietDuration = 10 * time.Second
+
+	// how long a button is held down for when pressed (see PressButton)
+	pressDuration = 150 * time.Millisecond
+
+	// how long a sweeping slider takes to go up and back down
+	sweepPeriod = 8 * time.Second
+
+	// how far a randomly moving slider goes per line, and the chance per line of it heading somewhere new
+	randomStep       = 8
+	randomMoveChance = 0.005
+
+	// lines (replies and button presses) waiting to go out between slider values
+	pendingLines = 32
+
+	// what the display can show, sent along with #HELLO by devices that have one
+	displayCapabilities = "#CAPS:charset=ascii,label=4,title=16,text=21,rows=4"
+)
+
+// Options describe the board to emulate
+type Options struct {
+	Sliders int
+	Buttons int
+
+	// what it reports about itself in #HELLO and #ID
+	ID       string
+	Firmware string
+
+	LEDs    bool
+	RGB     bool
+	Display bool
+
+	// see the Motion constants, and how often slider values go out
+	Motion   string
+	Interval time.Duration
+}
+
+// Device is an emulated board. it keeps its sliders, LEDs and display between connections, like a board
+// that's unplugged and plugged back in without losing power would
+type Device struct {
+	options Options
+	logger  *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// the sliders' raw values (0-1023), and where randomly moving ones are heading
+	values  []int
+	targets []int
+
+	leds   []bool
+	colors []string
+	asleep bool
+
+	// the screen being sent between #SB and #SE
+	screen []string
+
+	// #Q stops slider values until then
+	quietUntil time.Time
+
+	pending chan string
+	random  *rand.Rand
+	started time.Time
+}
+
+// New creates an emulated board, with its sliders halfway up
+func New(options Options, logger *zap.SugaredLogger) (*Device, error) {
+	if options.Sliders < 1 {
+		return nil, fmt.Errorf("emulate device: needs at least one slider, got %d", options.Sliders)
+	}
+
+	if options.Buttons < 0 {
+		return nil, fmt.Errorf("emulate device: invalid button count %d", options.Buttons)
+	}
+
+	switch options.Motion {
+	case "":
+		options.Motion = MotionStill
+	case MotionStill, MotionSweep, MotionRandom:
+	default:
+		return nil, fmt.Errorf("emulate device: unknown motion %q, use %s, %s or %s",
+			options.Motion, MotionStill, MotionSweep, MotionRandom)
+	}
+
+	if options.Interval <= 0 {
+		options.Interval = DefaultLineInterval
+	}
+
+	// boards without LEDs can't color them either
+	options.RGB = options.RGB && options.LEDs
+
+	device := &Device{
+		options: options,
+		logger:  logger.Named("emulator"),
+		values:  make([]int, options.Sliders),
+		targets: make([]int, options.Sliders),
+		leds:    make([]bool, options.Sliders),
+		colors:  make([]string, options.Sliders),
+		pending: make(chan string, pendingLines),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		started: time.Now(),
+	}
+
+	for sliderIdx := range device.values {
+		device.values[sliderIdx] = maxRawValue / 2
+		device.targets[sliderIdx] = maxRawValue / 2
+	}
+
+	return device, nil
+}
+
+// Run is the firmware's main loop on the given connection: it sends slider values and whatever's waiting to go
+// out, and handles what deej sends, until the context is done or the connection fails. close the connection
+// once it returns, which is what stops it reading
+func (d *Device) Run(ctx context.Context, conn io.ReadWriter) error {
+
+	// whatever was waiting to go out was meant for the last connection
+	for len(d.pending) > 0 {
+		<-d.pending
+	}
+
+	frames := make(chan string)
+	readErrors := make(chan error, 1)
+
+	go func() {
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			select {
+			case frames <- strings.TrimSpace(scanner.Text()):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		err := scanner.Err()
+		if err == nil {
+			err = io.EOF
+		}
+
+		readErrors <- err
+	}()
+
+	ticker := time.NewTicker(d.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		var line string
+
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case err := <-readErrors:
+			return fmt.Errorf("read from host: %w", err)
+
+		case frame := <-frames:
+			if frame != "" {
+				d.handle(frame)
+			}
+
+			continue
+
+		case line = <-d.pending:
+
+		case now := <-ticker.C:
+			line = d.sliderLine(now)
+			if line == "" {
+				continue
+			}
+		}
+
+		if _, err := io.WriteString(conn, line+"\r\n"); err != nil {
+			return fmt.Errorf("write to host: %w", err)
+		}
+	}
+}
+
+// SetSlider moves the given slider to the given percentage (0-100)
+func (d *Device) SetSlider(sliderIdx int, percent int) error {
+	if sliderIdx < 0 || sliderIdx >= d.options.Sliders {
+		return fmt.Errorf("no slider %d, the device has %d", sliderIdx, d.options.Sliders)
+	}
+
+	if percent < 0 || percent > 100 {
+		return fmt.Errorf("invalid percentage %d, use 0-100", percent)
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.values[sliderIdx] = int(math.Round(float64(percent) * maxRawValue / 100))
+	d.targets[sliderIdx] = d.values[sliderIdx]
+
+	return nil
+}
+
+// PressButton presses the given button and lets go of it shortly after, like a click
+func (d *Device) PressButton(buttonID int) error {
+	if buttonID < 0 || buttonID >= d.options.Buttons {
+		return fmt.Errorf("no button %d, the device has %d", buttonID, d.options.Buttons)
+	}
+
+	d.send(fmt.Sprintf("#B%d:1", buttonID))
+
+	go func() {
+		<-time.After(pressDuration)
+		d.send(fmt.Sprintf("#B%d:0", buttonID))
+	}()
+
+	return nil
+}
+
+// Status describes the sliders and LEDs as they are now, e.g. "sliders 50% 100% 0%, leds 1 0 1"
+func (d *Device) Status() string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	sliders := make([]string, len(d.values))
+	for sliderIdx, value := range d.values {
+		sliders[sliderIdx] = fmt.Sprintf("%d%%", int(math.Round(float64(value)*100/maxRawValue)))
+	}
+
+	status := "sliders " + strings.Join(sliders, " ")
+
+	if d.options.LEDs {
+		status += ", leds " + d.ledStates()
+	}
+
+	if d.asleep {
+		status += ", asleep"
+	}
+
+	return status
+}
+
+// send queues a line to go out between slider values, dropping it if too many are waiting already
+func (d *Device) send(line string) {
+	select {
+	case d.pending <- line:
+	default:
+		d.logger.Warnw("Too many lines waiting to go out, dropping one", "line", line)
+	}
+}
+
+// sliderLine moves the sliders as their motion says, and returns the line of their values, or an empty one
+// while quiet
+func (d *Device) sliderLine(now time.Time) string {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if now.Before(d.quietUntil) {
+		return ""
+	}
+
+	values := make([]string, len(d.values))
+
+	for sliderIdx := range d.values {
+		switch d.options.Motion {
+		case MotionSweep:
+			phase := now.Sub(d.started).Seconds()/sweepPeriod.Seconds() - float64(sliderIdx)/float64(len(d.values))
+			d.values[sliderIdx] = int(math.Round((1 - math.Cos(2*math.Pi*phase)) / 2 * maxRawValue))
+
+		case MotionRandom:
+			d.values[sliderIdx] = d.moveRandomly(sliderIdx)
+		}
+
+		values[sliderIdx] = strconv.Itoa(d.values[sliderIdx])
+	}
+
+	return strings.Join(values, "|")
+}
+
+func (d *Device) moveRandomly(sliderIdx int) int {
+	value, target := d.values[sliderIdx], d.targets[sliderIdx]
+
+	switch {
+	case value < target:
+		return minInt(value+randomStep, target)
+	case value > target:
+		return maxInt(value-randomStep, target)
+	case d.random.Float64() < randomMoveChance:
+		d.targets[sliderIdx] = d.random.Intn(maxRawValue + 1)
+	}
+
+	return value
+}
+
+// handle answers and keeps track of a frame from deej (see protocol/reference.go for what each of them is)
+func (d *Device) handle(frame string) {
+	d.logger.Debugw("Received", "frame", frame)
+
+	name, payload := frame, ""
+	if colon := strings.Index(frame, ":"); colon >= 0 {
+		name, payload = frame[:colon], frame[colon+1:]
+	}
+
+	switch {
+	case name == "#HELLO":
+		d.logger.Infow("Handshake", "host", helloField(payload, "app"))
+		d.send(d.hello())
+
+		if d.options.Display {
+			d.send(displayCapabilities)
+		}
+
+	case name == "#ID?":
+		d.send("#ID:" + d.options.ID)
+
+	case name == "#K":
+		d.send(frame)
+
+	case name == "#LS" || name == "#LC":
+		d.handleLEDs(name, payload)
+
+	case strings.HasPrefix(name, "#L"):
+		d.handleLED(strings.TrimPrefix(name, "#L"), payload)
+
+	case name == "#D":
+		d.logger.Infow("Display page", "page", payload)
+
+	case name == "#SB":
+		d.lock.Lock()
+		d.screen = []string{payload}
+		d.lock.Unlock()
+
+	case name == "#SR":
+		d.lock.Lock()
+		d.screen = append(d.screen, payload)
+		d.lock.Unlock()
+
+	case name == "#SE":
+		d.lock.Lock()
+		screen := d.screen
+		d.screen = nil
+		d.lock.Unlock()
+
+		if len(screen) > 0 {
+			d.logger.Infow("Display screen", "title", screen[0], "rows", screen[1:])
+		}
+
+	case name == "#Z":
+		d.lock.Lock()
+		d.asleep = payload == "1"
+		d.lock.Unlock()
+
+		d.logger.Infow("Sleep", "asleep", payload == "1")
+
+	case name == "#Q":
+		d.lock.Lock()
+		d.quietUntil = time.Now().Add(quietDuration)
+		d.lock.Unlock()
+
+		d.logger.Infow("Going quiet for an upload", "for", quietDuration)
+
+	case name == "#VS" || name == "#VU" || name == "#AP":
+
+		// sent all the time, so they're only shown with debug logs (above)
+
+	default:
+		d.logger.Infow("Ignoring frame the emulator doesn't support", "frame", frame)
+	}
+}
+
+func (d *Device) hello() string {
+	return fmt.Sprintf("#HELLO:proto=%d,fw=%s,sliders=%d,buttons=%d,leds=%s,rgb=%s,display=%s,id=%s",
+		protocol.Version, d.options.Firmware, d.options.Sliders, d.options.Buttons,
+		boolFlag(d.options.LEDs), boolFlag(d.options.RGB), boolFlag(d.options.Display), d.options.ID)
+}
+
+// handleLED sets a single LED, for #L<slider>:<0|1>
+func (d *Device) handleLED(slider string, payload string) {
+	if !d.options.LEDs {
+		d.logger.Warnw("Got an LED frame despite saying the device has no LEDs", "frame", "#L"+slider)
+		return
+	}
+
+	sliderIdx, err := strconv.Atoi(slider)
+	if err != nil || sliderIdx < 0 || sliderIdx >= d.options.Sliders {
+		d.logger.Warnw("Invalid LED frame", "slider", slider)
+		return
+	}
+
+	d.lock.Lock()
+	changed := d.leds[sliderIdx] != (payload == "1")
+	d.leds[sliderIdx] = payload == "1"
+	states := d.ledStates()
+	d.lock.Unlock()
+
+	if changed {
+		d.logger.Infow("LEDs", "states", states)
+	}
+}
+
+// handleLEDs sets every LED's state (#LS) or color (#LC) at once
+func (d *Device) handleLEDs(name string, payload string) {
+	if !d.options.LEDs || (name == "#LC" && !d.options.RGB) {
+		d.logger.Warnw("Got an LED frame despite saying the device can't show it", "frame", name)
+		return
+	}
+
+	fields := strings.Split(payload, ",")
+
+	d.lock.Lock()
+
+	changed := false
+	for sliderIdx := 0; sliderIdx < len(fields) && sliderIdx < d.options.Sliders; sliderIdx++ {
+		if name == "#LS" {
+			changed = changed || d.leds[sliderIdx] != (fields[sliderIdx] == "1")
+			d.leds[sliderIdx] = fields[sliderIdx] == "1"
+		} else {
+			changed = changed || d.colors[sliderIdx] != fields[sliderIdx]
+			d.colors[sliderIdx] = fields[sliderIdx]
+		}
+	}
+
+	states, colors := d.ledStates(), strings.Join(d.colors, " ")
+	d.lock.Unlock()
+
+	if changed {
+		d.logger.Infow("LEDs", "states", states, "colors", colors)
+	}
+}
+
+// ledStates shows every LED as 1 or 0, in slider order
+func (d *Device) ledStates() string {
+	states := make([]string, len(d.leds))
+	for sliderIdx, on := range d.leds {
+		states[sliderIdx] = boolFlag(on)
+	}
+
+	return strings.Join(states, " ")
+}
+
+// helloField returns a field of a #HELLO's key=value pairs
+func helloField(payload string, key string) string {
+	for _, field := range strings.Split(payload, ",") {
+		if strings.HasPrefix(field, key+"=") {
+			return strings.TrimPrefix(field, key+"=")
+		}
+	}
+
+	return ""
+}
+
+func boolFlag(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
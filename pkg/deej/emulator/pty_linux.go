@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+package emulator
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// how long a line waits for room in the pseudo-terminal before it's dropped. nothing reads the lines while deej
+// isn't connected, and firmware doesn't wait for anyone either
+const ptyWriteTimeout = 50 * time.Millisecond
+
+// PTY is a pseudo-terminal, whose other end (Name, like /dev/pts/3) deej opens like any serial port
+type PTY struct {
+	Name string
+
+	master *os.File
+
+	// kept open, so that reading the master doesn't fail whenever deej lets go of the other end
+	slave *os.File
+}
+
+// OpenPTY opens a pseudo-terminal for deej to connect to
+func OpenPTY() (*PTY, error) {
+
+	// non-blocking, so that reads and writes go through the runtime's poller and writes can time out
+	masterFD, err := unix.Open("/dev/ptmx", unix.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open pseudo-terminal: %w", err)
+	}
+
+	master := os.NewFile(uintptr(masterFD), "/dev/ptmx")
+
+	if err := unix.IoctlSetPointerInt(masterFD, unix.TIOCSPTLCK, 0); err != nil {
+		master.Close()
+		return nil, fmt.Errorf("unlock pseudo-terminal: %w", err)
+	}
+
+	number, err := unix.IoctlGetInt(masterFD, unix.TIOCGPTN)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("get pseudo-terminal number: %w", err)
+	}
+
+	name := fmt.Sprintf("/dev/pts/%d", number)
+
+	slaveFD, err := unix.Open(name, unix.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		master.Close()
+		return nil, fmt.Errorf("open pseudo-terminal's other end: %w", err)
+	}
+
+	slave := os.NewFile(uintptr(slaveFD), name)
+
+	// deej sets this up when it connects too, but lines shouldn't echo back to the emulator before it does
+	if err := makeRaw(slaveFD); err != nil {
+		slave.Close()
+		master.Close()
+		return nil, fmt.Errorf("set up pseudo-terminal: %w", err)
+	}
+
+	return &PTY{Name: name, master: master, slave: slave}, nil
+}
+
+func (pty *PTY) Read(p []byte) (int, error) {
+	return pty.master.Read(p)
+}
+
+// Write sends what it can, dropping what doesn't fit in time (see ptyWriteTimeout)
+func (pty *PTY) Write(p []byte) (int, error) {
+	if err := pty.master.SetWriteDeadline(time.Now().Add(ptyWriteTimeout)); err != nil {
+		return 0, fmt.Errorf("set write deadline: %w", err)
+	}
+
+	n, err := pty.master.Write(p)
+	if err != nil && os.IsTimeout(err) {
+		return len(p), nil
+	}
+
+	return n, err
+}
+
+// Close closes both ends
+func (pty *PTY) Close() error {
+	pty.slave.Close()
+	return pty.master.Close()
+}
+
+// makeRaw turns off everything a terminal does to what goes through it (echo, line editing, newline conversion)
+func makeRaw(fd int) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, termios)
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// pseudo-terminals are only opened on linux for now. on windows, a virtual COM port pair (like com0com's) is the
+// closest thing, which the emulator can't create by itself - connect over the network instead
+
+// PTY is a pseudo-terminal, whose other end (Name) deej opens like any serial port
+type PTY struct {
+	Name string
+}
+
+// OpenPTY opens a pseudo-terminal for deej to connect to
+func OpenPTY() (*PTY, error) {
+	return nil, fmt.Errorf("open pseudo-terminal: %w", util.ErrNotSupported)
+}
+
+func (pty *PTY) Read(p []byte) (int, error) {
+	return 0, util.ErrNotSupported
+}
+
+func (pty *PTY) Write(p []byte) (int, error) {
+	return 0, util.ErrNotSupported
+}
+
+// Close closes both ends
+func (pty *PTY) Close() error {
+	return nil
+}
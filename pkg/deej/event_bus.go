@@ -0,0 +1,328 @@
+package deej
+
+import (
+	"reflect"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// deej's parts (and programs embedding it) learn about what's going on from the event bus rather than from each
+// other: every kind of event has a topic that hands it to everyone subscribed. publishing never waits on a
+// subscriber, so one that's stuck can't hold up reading from the device (or polling, or reloading the config)
+
+// what happens to a subscriber whose channel is full when something's published
+type backpressurePolicy int
+
+const (
+	// it misses the new event, and every one after until it catches up. for streams where each event counts
+	// (button presses), so that what a subscriber does get comes in order
+	dropNewest backpressurePolicy = iota
+
+	// its oldest unread event makes room for the new one. for state that only matters as of now (the connection,
+	// peaks, what's playing), where a subscriber that was busy wants the latest rather than the whole history
+	dropOldest
+
+	// its unread events are cut down to the latest of each kind (see eventKey), keeping their order.
+	// for streams of several things' positions (slider moves), where a subscriber that was busy can skip
+	// how something got somewhere, but not where it ended up
+	coalesceByKey
+)
+
+const (
+	// how many events a stream's subscriber can fall behind by before it starts missing them
+	eventBufferSize = 64
+
+	// state only ever has its latest value waiting, so several changes while a subscriber's busy come as one
+	stateBufferSize = 1
+)
+
+// Subscription is a handle on one of deej's event channels
+type Subscription struct {
+	topic *eventTopic
+	id    int
+}
+
+// SliderMoveSubscription receives every slider move, see SubscribeToSliderMoveEvents
+type SliderMoveSubscription struct {
+	*Subscription
+	Events <-chan SliderMoveEvent
+}
+
+// ButtonSubscription receives every button press and release, see SubscribeToButtonEvents
+type ButtonSubscription struct {
+	*Subscription
+	Events <-chan ButtonEvent
+}
+
+// RawSliderValueSubscription receives every line's raw slider values, see SubscribeToRawSliderValues
+type RawSliderValueSubscription struct {
+	*Subscription
+	Values <-chan []int
+}
+
+// ConfigSubscription receives a value whenever the config is reloaded, see SubscribeToChanges. reloads that
+// happen while one is still waiting to be read come as just the one
+type ConfigSubscription struct {
+	*Subscription
+	Reloads <-chan bool
+}
+
+// SessionSubscription receives the audio sessions that appear and go away, see SubscribeToSessionChanges
+type SessionSubscription struct {
+	*Subscription
+	Events <-chan SessionEvent
+}
+
+// ConnectionSubscription receives the device connecting and disconnecting, see SubscribeToConnectionChanges.
+// a subscriber that was busy gets only the latest
+type ConnectionSubscription struct {
+	*Subscription
+	Events <-chan ConnectionEvent
+}
+
+// PeakSubscription receives the sliders' audio peaks as they're measured, see SubscribeToPeaks. a subscriber
+// that was busy gets only the latest
+type PeakSubscription struct {
+	*Subscription
+	Events <-chan PeakEvent
+}
+
+// what's playing and how the link's doing, for the tray
+type nowPlayingSubscription struct {
+	*Subscription
+	Changes <-chan nowPlayingInfo
+}
+
+type linkSubscription struct {
+	*Subscription
+	Changes <-chan linkHealth
+}
+
+// eventBus has a topic for each kind of event deej's parts tell each other about. the config has its own (see
+// SubscribeToChanges), as it's made on its own before anything else
+type eventBus struct {
+	sliderMoves     *eventTopic
+	buttons         *eventTopic
+	rawSliderValues *eventTopic
+	sessions        *eventTopic
+	connection      *eventTopic
+	peaks           *eventTopic
+	nowPlaying      *eventTopic
+	link            *eventTopic
+}
+
+func newEventBus(logger *zap.SugaredLogger) *eventBus {
+	logger = logger.Named("events")
+
+	bus := &eventBus{
+		sliderMoves:     newEventTopic(logger, "slider moves", SliderMoveEvent{}, coalesceByKey, eventBufferSize),
+		buttons:         newEventTopic(logger, "buttons", ButtonEvent{}, dropNewest, eventBufferSize),
+		rawSliderValues: newEventTopic(logger, "raw slider values", []int{}, dropNewest, eventBufferSize),
+		sessions:        newEventTopic(logger, "sessions", SessionEvent{}, dropNewest, eventBufferSize),
+		connection:      newEventTopic(logger, "connection", ConnectionEvent{}, dropOldest, stateBufferSize),
+		peaks:           newEventTopic(logger, "peaks", PeakEvent{}, dropOldest, stateBufferSize),
+		nowPlaying:      newEventTopic(logger, "now playing", nowPlayingInfo{}, dropOldest, stateBufferSize),
+		link:            newEventTopic(logger, "link", linkHealth{}, dropOldest, stateBufferSize),
+	}
+
+	logger.Debug("Created event bus instance")
+
+	return bus
+}
+
+func (bus *eventBus) subscribeToSliderMoves() *SliderMoveSubscription {
+	subscription, channel := bus.sliderMoves.subscribe()
+	return &SliderMoveSubscription{Subscription: subscription, Events: channel.(chan SliderMoveEvent)}
+}
+
+func (bus *eventBus) subscribeToButtons() *ButtonSubscription {
+	subscription, channel := bus.buttons.subscribe()
+	return &ButtonSubscription{Subscription: subscription, Events: channel.(chan ButtonEvent)}
+}
+
+func (bus *eventBus) subscribeToRawSliderValues() *RawSliderValueSubscription {
+	subscription, channel := bus.rawSliderValues.subscribe()
+	return &RawSliderValueSubscription{Subscription: subscription, Values: channel.(chan []int)}
+}
+
+func (bus *eventBus) subscribeToSessions() *SessionSubscription {
+	subscription, channel := bus.sessions.subscribe()
+	return &SessionSubscription{Subscription: subscription, Events: channel.(chan SessionEvent)}
+}
+
+func (bus *eventBus) subscribeToConnection() *ConnectionSubscription {
+	subscription, channel := bus.connection.subscribe()
+	return &ConnectionSubscription{Subscription: subscription, Events: channel.(chan ConnectionEvent)}
+}
+
+func (bus *eventBus) subscribeToPeaks() *PeakSubscription {
+	subscription, channel := bus.peaks.subscribe()
+	return &PeakSubscription{Subscription: subscription, Events: channel.(chan PeakEvent)}
+}
+
+func (bus *eventBus) subscribeToNowPlaying() *nowPlayingSubscription {
+	subscription, channel := bus.nowPlaying.subscribe()
+	return &nowPlayingSubscription{Subscription: subscription, Changes: channel.(chan nowPlayingInfo)}
+}
+
+func (bus *eventBus) subscribeToLink() *linkSubscription {
+	subscription, channel := bus.link.subscribe()
+	return &linkSubscription{Subscription: subscription, Changes: channel.(chan linkHealth)}
+}
+
+// eventTopic hands one kind of event to everyone subscribed to it, in the order they subscribed. each subscriber
+// gets its own channel of the topic's event type, buffered and kept up with as the topic's policy says
+type eventTopic struct {
+	logger    *zap.SugaredLogger
+	name      string
+	eventType reflect.Type
+	policy    backpressurePolicy
+	buffer    int
+
+	lock        sync.Mutex
+	nextID      int
+	subscribers []*subscriber
+}
+
+type subscriber struct {
+	id      int
+	channel reflect.Value
+
+	// whether it's missed events since it last got one, so that falling behind is only warned about once
+	behind bool
+}
+
+// newEventTopic creates a topic for events of the same type as example
+func newEventTopic(logger *zap.SugaredLogger, name string, example interface{}, policy backpressurePolicy, buffer int) *eventTopic {
+	return &eventTopic{
+		logger:    logger,
+		name:      name,
+		eventType: reflect.TypeOf(example),
+		policy:    policy,
+		buffer:    buffer,
+	}
+}
+
+// eventKey is what events are coalesced by: the slider they're about, for the ones that have one
+func eventKey(event interface{}) interface{} {
+	if sliderMove, ok := event.(SliderMoveEvent); ok {
+		return sliderMove.SliderID
+	}
+
+	return event
+}
+
+// Close stops the subscription's events and closes its channel, which ends any range over it. closing it again
+// does nothing
+func (s *Subscription) Close() {
+	s.topic.unsubscribe(s.id)
+}
+
+// subscribe returns a new subscription, and its channel (a chan of the topic's event type) to read events from
+func (topic *eventTopic) subscribe() (*Subscription, interface{}) {
+	channel := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, topic.eventType), topic.buffer)
+
+	topic.lock.Lock()
+	defer topic.lock.Unlock()
+
+	topic.nextID++
+	topic.subscribers = append(topic.subscribers, &subscriber{id: topic.nextID, channel: channel})
+
+	return &Subscription{topic: topic, id: topic.nextID}, channel.Interface()
+}
+
+func (topic *eventTopic) unsubscribe(id int) {
+	topic.lock.Lock()
+	defer topic.lock.Unlock()
+
+	for idx, sub := range topic.subscribers {
+		if sub.id == id {
+			topic.subscribers = append(topic.subscribers[:idx], topic.subscribers[idx+1:]...)
+
+			// nothing's sent without the lock, so nothing can be sent on it once it's closed
+			sub.channel.Close()
+			return
+		}
+	}
+}
+
+// publish hands the event to every subscriber without waiting on any of them. the ones without room for it get
+// it or miss it as the topic's policy says
+func (topic *eventTopic) publish(event interface{}) {
+	value := reflect.ValueOf(event)
+
+	topic.lock.Lock()
+	defer topic.lock.Unlock()
+
+	for _, sub := range topic.subscribers {
+		if sub.channel.TrySend(value) {
+			sub.behind = false
+			continue
+		}
+
+		// the subscriber may read in between, in which case there's room without dropping anything
+		if topic.policy == dropOldest {
+			sub.channel.TryRecv()
+
+			if sub.channel.TrySend(value) {
+				continue
+			}
+		}
+
+		if topic.policy == coalesceByKey && topic.coalesce(sub, value) {
+			continue
+		}
+
+		if !sub.behind {
+			sub.behind = true
+			topic.logger.Warnw("Subscriber fell behind, dropping events until it catches up",
+				"events", topic.name,
+				"buffer", topic.buffer)
+		}
+	}
+}
+
+// coalesce takes everything waiting in a subscriber's channel and puts back only the latest event of each key,
+// with the new one last. it returns false if that didn't make room for it (every waiting event has its own key)
+func (topic *eventTopic) coalesce(sub *subscriber, value reflect.Value) bool {
+	waiting := []reflect.Value{}
+	for {
+		event, ok := sub.channel.TryRecv()
+		if !ok {
+			break
+		}
+
+		waiting = append(waiting, event)
+	}
+
+	waiting = append(waiting, value)
+
+	latest := map[interface{}]int{}
+	for idx, event := range waiting {
+		latest[eventKey(event.Interface())] = idx
+	}
+
+	sent := 0
+	for idx, event := range waiting {
+		if latest[eventKey(event.Interface())] != idx {
+			continue
+		}
+
+		// nothing else sends without the lock, so only the new event can be left without room
+		if !sub.channel.TrySend(event) {
+			return false
+		}
+
+		sent++
+	}
+
+	if sent < len(waiting) && !sub.behind {
+		sub.behind = true
+		topic.logger.Warnw("Subscriber fell behind, keeping only the latest of its events",
+			"events", topic.name,
+			"buffer", topic.buffer)
+	}
+
+	return true
+}
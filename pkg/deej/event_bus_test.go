@@ -0,0 +1,41 @@
+package deej
+
+import (
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// a subscriber that falls behind on slider moves should still learn where every slider ended up
+func TestSliderMovesKeepFinalPositions(t *testing.T) {
+	bus := newEventBus(zap.NewNop().Sugar())
+
+	subscription := bus.subscribeToSliderMoves()
+	defer subscription.Close()
+
+	// slider 1 only moves once, early on, then slider 0 sweeps well past the buffer
+	bus.sliderMoves.publish(SliderMoveEvent{SliderID: 0, PercentValue: 0})
+	bus.sliderMoves.publish(SliderMoveEvent{SliderID: 1, PercentValue: 0.5})
+
+	for step := 1; step <= 3*eventBufferSize; step++ {
+		bus.sliderMoves.publish(SliderMoveEvent{SliderID: 0, PercentValue: float32(step) / (3 * eventBufferSize)})
+	}
+
+	final := map[int]float32{}
+	order := []int{}
+
+	for len(subscription.Events) > 0 {
+		event := <-subscription.Events
+		final[event.SliderID] = event.PercentValue
+		order = append(order, event.SliderID)
+	}
+
+	if final[0] != 1 || final[1] != 0.5 {
+		t.Errorf("expected sliders to end up at 1 and 0.5, got %v", final)
+	}
+
+	// slider 0's earlier moves were coalesced into later ones, leaving slider 1's first
+	if len(order) == 0 || order[0] != 1 {
+		t.Errorf("expected slider 1's move to come first, got moves of sliders %v", order)
+	}
+}
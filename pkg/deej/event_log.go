@@ -0,0 +1,244 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	eventKindSlider     = "slider"     // a slider moved
+	eventKindButton     = "button"     // a button was pressed or released
+	eventKindConnection = "connection" // the device connected or disconnected
+	eventKindVolume     = "volume"     // a session's volume was set (by a slider, scene, fade and so on)
+	eventKindMedia      = "media"      // the track playing in the OS's media session changed
+
+	defaultEventLogSize = 200
+
+	// dragging a slider (or fading a volume) would fill the log in a second, so an event repeating
+	// within this long of the same one updates that entry instead of adding another
+	eventLogCoalesceWindow = time.Second
+
+	// how far back to look for the entry to update - a single slider move can log a few volume events in between
+	eventLogCoalesceLookback = 16
+)
+
+// loggedEvent is a single entry of the event log
+type loggedEvent struct {
+	Seq  uint64    `json:"seq"` // increases with every new (or coalesced) entry, so clients can ask for what they haven't seen
+	At   time.Time `json:"at"`
+	Kind string    `json:"kind"`
+
+	// what the event happened to (e.g. "slider 2", "spotify.exe") and what happened (e.g. "45%", "pressed")
+	Subject string `json:"subject"`
+	Value   string `json:"value"`
+
+	// the same as numbers and flags, where there are any (see event_schema.go)
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	// how many times it happened in a row, when coalesced
+	Count int `json:"count"`
+}
+
+// eventLog keeps the last few hundred slider, button, connection, volume and media events in memory, so that
+// "what happened just now?" can be answered (through deej events or the API) without verbose logs
+type eventLog struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// a ring buffer: once full, start points at the oldest entry, which is the next to be overwritten
+	entries []loggedEvent
+	start   int
+	size    int
+	lastSeq uint64
+}
+
+func newEventLog(deej *Deej, logger *zap.SugaredLogger) *eventLog {
+	logger = logger.Named("events")
+
+	el := &eventLog{
+		deej:   deej,
+		logger: logger,
+		size:   defaultEventLogSize,
+	}
+
+	logger.Debug("Created event log instance")
+
+	return el
+}
+
+func (el *eventLog) initialize() {
+	el.resize(el.deej.config.EventLogSize)
+
+	el.setupOnConfigReload()
+	el.setupOnSliderMove()
+	el.setupOnButtonEvent()
+}
+
+func (el *eventLog) recordSlider(sliderID int, value float32) {
+	el.record(eventKindSlider, fmt.Sprintf("slider %d", sliderID), formatEventPercent(value),
+		map[string]interface{}{"slider": sliderID, "percent": eventPercent(value)})
+}
+
+func (el *eventLog) recordButton(buttonID int, pressed bool) {
+	value := "released"
+	if pressed {
+		value = "pressed"
+	}
+
+	el.record(eventKindButton, fmt.Sprintf("button %d", buttonID), value,
+		map[string]interface{}{"button": buttonID, "pressed": pressed})
+}
+
+func (el *eventLog) recordConnection(port string, connected bool) {
+	value := "disconnected"
+	if connected {
+		value = "connected"
+	}
+
+	el.record(eventKindConnection, port, value, map[string]interface{}{"connected": connected})
+}
+
+func (el *eventLog) recordVolume(target string, volume float32) {
+	el.record(eventKindVolume, target, formatEventPercent(volume), map[string]interface{}{"percent": eventPercent(volume)})
+}
+
+func (el *eventLog) recordMedia(app string, track string) {
+	el.record(eventKindMedia, app, track, nil)
+}
+
+func (el *eventLog) record(kind string, subject string, value string, data map[string]interface{}) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	now := time.Now()
+
+	// button presses and connections are worth seeing one by one, only continuous changes are coalesced
+	if kind == eventKindSlider || kind == eventKindVolume {
+		if previous := el.findRecentLocked(kind, subject); previous != nil && now.Sub(previous.At) < eventLogCoalesceWindow {
+			el.lastSeq++
+
+			previous.Seq = el.lastSeq
+			previous.At = now
+			previous.Value = value
+			previous.Data = data
+			previous.Count++
+
+			return
+		}
+	}
+
+	el.lastSeq++
+
+	entry := loggedEvent{
+		Seq:     el.lastSeq,
+		At:      now,
+		Kind:    kind,
+		Subject: subject,
+		Value:   value,
+		Data:    data,
+		Count:   1,
+	}
+
+	if len(el.entries) < el.size {
+		el.entries = append(el.entries, entry)
+		return
+	}
+
+	el.entries[el.start] = entry
+	el.start = (el.start + 1) % len(el.entries)
+}
+
+// findRecentLocked returns the newest of the last few entries with the given kind and subject, if any.
+// assumes the lock is held
+func (el *eventLog) findRecentLocked(kind string, subject string) *loggedEvent {
+	for back := 1; back <= eventLogCoalesceLookback && back <= len(el.entries); back++ {
+		idx := (el.start + len(el.entries) - back) % len(el.entries)
+
+		if el.entries[idx].Kind == kind && el.entries[idx].Subject == subject {
+			return &el.entries[idx]
+		}
+	}
+
+	return nil
+}
+
+// since returns the entries added or updated after the given sequence number, in the order they were added.
+// a limit above 0 only returns that many of the newest ones
+func (el *eventLog) since(seq uint64, limit int) []loggedEvent {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	result := []loggedEvent{}
+
+	for offset := 0; offset < len(el.entries); offset++ {
+		entry := el.entries[(el.start+offset)%len(el.entries)]
+
+		if entry.Seq > seq {
+			result = append(result, entry)
+		}
+	}
+
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+
+	return result
+}
+
+// resize changes how many entries are kept, keeping the newest ones
+func (el *eventLog) resize(size int) {
+	el.lock.Lock()
+	defer el.lock.Unlock()
+
+	if size == el.size {
+		return
+	}
+
+	entries := make([]loggedEvent, 0, len(el.entries))
+	for offset := 0; offset < len(el.entries); offset++ {
+		entries = append(entries, el.entries[(el.start+offset)%len(el.entries)])
+	}
+
+	if len(entries) > size {
+		entries = entries[len(entries)-size:]
+	}
+
+	el.entries = entries
+	el.start = 0
+	el.size = size
+}
+
+func (el *eventLog) setupOnConfigReload() {
+	el.deej.onConfigReload(func() {
+		el.resize(el.deej.config.EventLogSize)
+	})
+}
+
+func (el *eventLog) setupOnSliderMove() {
+	sliderEventsChannel := el.deej.serial.SubscribeToSliderMoveEvents().Events
+
+	go func() {
+		for event := range sliderEventsChannel {
+			el.recordSlider(event.SliderID, event.PercentValue)
+		}
+	}()
+}
+
+func (el *eventLog) setupOnButtonEvent() {
+	buttonEventsChannel := el.deej.serial.SubscribeToButtonEvents().Events
+
+	go func() {
+		for event := range buttonEventsChannel {
+			el.recordButton(event.ButtonID, event.Pressed)
+		}
+	}()
+}
+
+func formatEventPercent(value float32) string {
+	return fmt.Sprintf("%.0f%%", value*100)
+}
@@ -0,0 +1,67 @@
+package deej
+
+import (
+	"math"
+	"os"
+	"time"
+)
+
+const (
+	// every event leaving deej says what it is and which version of it, so flows can check before relying on it.
+	// the version only goes up when something's renamed or removed - new types and data fields don't bump it
+	eventSchemaName    = "deej.event"
+	eventSchemaVersion = 1
+)
+
+// the machine deej runs on, so a single flow can tell several deej PCs apart
+var eventHost, _ = os.Hostname()
+
+// deejEvent is how events look outside of deej, whichever way they're sent (webhooks, the API's
+// /events?schema=1), so flow tools like Node-RED can take them all the same way. see docs/events
+type deejEvent struct {
+	Schema  string `json:"schema"`
+	Version int    `json:"version"`
+
+	// what kind of event it is (slider, button, connection, volume, media, profile, mute or threshold), what it
+	// happened to and what happened, as the event log shows them
+	Type    string `json:"type"`
+	Subject string `json:"subject"`
+	Value   string `json:"value"`
+
+	// the same as numbers and flags where there are any (e.g. {"slider": 2, "percent": 45}), so flows don't have
+	// to pick strings apart
+	Data map[string]interface{} `json:"data,omitempty"`
+
+	Time time.Time `json:"time"`
+	Host string    `json:"host"`
+
+	// where the event is in the event log, for events that come from it
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+func newDeejEvent(kind string, subject string, value string, data map[string]interface{}) deejEvent {
+	return deejEvent{
+		Schema:  eventSchemaName,
+		Version: eventSchemaVersion,
+		Type:    kind,
+		Subject: subject,
+		Value:   value,
+		Data:    data,
+		Time:    time.Now(),
+		Host:    eventHost,
+	}
+}
+
+// normalized returns the event log entry as it's sent out of deej
+func (entry loggedEvent) normalized() deejEvent {
+	event := newDeejEvent(entry.Kind, entry.Subject, entry.Value, entry.Data)
+	event.Time = entry.At
+	event.Seq = entry.Seq
+
+	return event
+}
+
+// eventPercent is a 0-1 value as a whole percentage, for event data
+func eventPercent(value float32) int {
+	return int(math.Round(float64(value) * 100))
+}
@@ -0,0 +1,118 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	eventTailPollInterval = 500 * time.Millisecond
+	eventTailTimeout      = 5 * time.Second
+)
+
+// TailEvents prints the given number of recent events (all of them for 0) from the deej instance running
+// on this machine, found through its local API. if follow is set, it then keeps printing new ones as they come
+func TailEvents(logger *zap.SugaredLogger, out io.Writer, count int, follow bool) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: eventTailTimeout}
+	address := apiAddress + apiPathEvents
+
+	events, err := fetchEvents(client, fmt.Sprintf("%s?limit=%d", address, count))
+	if err != nil {
+		return err
+	}
+
+	var lastSeq uint64
+	for _, event := range events {
+		printEvent(out, event)
+
+		if event.Seq > lastSeq {
+			lastSeq = event.Seq
+		}
+	}
+
+	for follow {
+		<-time.After(eventTailPollInterval)
+
+		events, err := fetchEvents(client, fmt.Sprintf("%s?since=%d", address, lastSeq))
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			printEvent(out, event)
+
+			if event.Seq > lastSeq {
+				lastSeq = event.Seq
+			}
+		}
+	}
+
+	return nil
+}
+
+// localAPIAddress returns where the API of the deej instance running on this machine would be. its port is in
+// the config it's using, so that's read the same way (quietly)
+func localAPIAddress(logger *zap.SugaredLogger) (string, error) {
+	config, err := NewConfig(zap.NewNop().Sugar(), &loggingNotifier{logger: logger})
+	if err != nil {
+		return "", fmt.Errorf("create new Config: %w", err)
+	}
+
+	if err := config.Load(); err != nil {
+		return "", fmt.Errorf("load config: %w", err)
+	}
+
+	if !config.API.Enabled {
+		return "", fmt.Errorf("the API is disabled (see api.enabled in the config)")
+	}
+
+	// listening everywhere includes loopback, otherwise it has to be the one address it's on
+	host := config.API.Address
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = defaultAPIAddress
+	}
+
+	return fmt.Sprintf("http://%s", net.JoinHostPort(host, strconv.Itoa(config.API.Port))), nil
+}
+
+func fetchEvents(client *http.Client, url string) ([]loggedEvent, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("get events (is deej running?): %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("get events: unexpected status %s", response.Status)
+	}
+
+	events := []loggedEvent{}
+	if err := json.NewDecoder(response.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("decode events: %w", err)
+	}
+
+	return events, nil
+}
+
+func printEvent(out io.Writer, event loggedEvent) {
+	repeated := ""
+	if event.Count > 1 {
+		repeated = fmt.Sprintf(" (x%d)", event.Count)
+	}
+
+	fmt.Fprintf(out, "%s  %-10s  %-24s  %s%s\n",
+		event.At.Local().Format("15:04:05.000"), event.Kind, event.Subject, event.Value, repeated)
+}
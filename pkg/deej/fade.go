@@ -0,0 +1,172 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// how often a fading target's volume is stepped towards its destination
+	fadeStepInterval = 20 * time.Millisecond
+
+	fadeEasingLinear    = "linear"
+	fadeEasingEaseIn    = "ease_in"     // starts slow, ends fast
+	fadeEasingEaseOut   = "ease_out"    // starts fast, ends slow
+	fadeEasingEaseInOut = "ease_in_out" // slow at both ends
+
+	defaultFadeMilliseconds = 500
+	defaultFadeEasing       = fadeEasingEaseInOut
+)
+
+// fadeConfig holds the defaults for programmatic volume changes, each of which can override them
+type fadeConfig struct {
+	Duration time.Duration
+	Easing   string
+}
+
+// validFadeEasing reports whether the given easing curve name is one we know
+func validFadeEasing(easing string) bool {
+	switch easing {
+	case fadeEasingLinear, fadeEasingEaseIn, fadeEasingEaseOut, fadeEasingEaseInOut:
+		return true
+	}
+
+	return false
+}
+
+// easeProgress maps linear progress (0-1) through the given easing curve
+func easeProgress(easing string, progress float32) float32 {
+	switch easing {
+	case fadeEasingEaseIn:
+		return progress * progress
+	case fadeEasingEaseOut:
+		return progress * (2 - progress)
+	case fadeEasingEaseInOut:
+		return progress * progress * (3 - 2*progress)
+	default:
+		return progress
+	}
+}
+
+// volumeFader moves targets' volumes gradually rather than all at once, along an easing curve.
+// only one fade runs per target - starting another one (or moving a slider mapped to it) cancels the first
+type volumeFader struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock  sync.Mutex
+	fades map[string]chan bool
+}
+
+func newVolumeFader(deej *Deej, logger *zap.SugaredLogger) *volumeFader {
+	logger = logger.Named("fader")
+
+	vf := &volumeFader{
+		deej:   deej,
+		logger: logger,
+		fades:  make(map[string]chan bool),
+	}
+
+	logger.Debug("Created volume fader instance")
+
+	return vf
+}
+
+// fadeTargetDefault moves the given target to a volume using the configured default duration and easing
+func (vf *volumeFader) fadeTargetDefault(target string, volume float32) bool {
+	defaults := vf.deej.config.Fades
+	return vf.fadeTarget(target, volume, defaults.Duration, defaults.Easing)
+}
+
+// fadeTarget moves the given target to a volume over the given duration, returning false if it wasn't found
+func (vf *volumeFader) fadeTarget(target string, volume float32, duration time.Duration, easing string) bool {
+	target = normalizeTarget(target)
+	vf.cancel(target)
+
+	from, ok := vf.deej.sessions.getTargetVolume(target)
+	if !ok {
+		return false
+	}
+
+	if duration <= 0 || from == volume {
+		return vf.deej.sessions.setTargetVolume(target, volume)
+	}
+
+	cancelChannel := make(chan bool)
+
+	vf.lock.Lock()
+	vf.fades[target] = cancelChannel
+	vf.lock.Unlock()
+
+	go vf.runFade(target, from, volume, duration, easing, cancelChannel)
+
+	return true
+}
+
+// unmuteTarget unmutes the given target, fading its volume back up from silence rather than jumping straight to it
+func (vf *volumeFader) unmuteTarget(target string) bool {
+	volume, ok := vf.deej.sessions.getTargetVolume(target)
+	if !ok {
+		return false
+	}
+
+	vf.cancel(target)
+
+	if vf.deej.config.Fades.Duration > 0 {
+		vf.deej.sessions.setTargetVolume(target, 0)
+	}
+
+	vf.deej.sessions.setTargetMute(target, false)
+
+	return vf.fadeTargetDefault(target, volume)
+}
+
+// cancel stops any running fade on the given target, leaving its volume wherever the fade got to
+func (vf *volumeFader) cancel(target string) {
+	target = normalizeTarget(target)
+
+	vf.lock.Lock()
+	defer vf.lock.Unlock()
+
+	if cancelChannel, ok := vf.fades[target]; ok {
+		close(cancelChannel)
+		delete(vf.fades, target)
+	}
+}
+
+func (vf *volumeFader) runFade(target string, from float32, to float32, duration time.Duration, easing string, cancelChannel chan bool) {
+	ticker := time.NewTicker(fadeStepInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+
+	for {
+		select {
+		case <-cancelChannel:
+			return
+
+		case now := <-ticker.C:
+			progress := float32(now.Sub(start)) / float32(duration)
+			if progress >= 1 {
+				vf.deej.sessions.setTargetVolume(target, to)
+				vf.finish(target, cancelChannel)
+
+				return
+			}
+
+			vf.deej.sessions.setTargetVolume(target, from+(to-from)*easeProgress(easing, progress))
+		}
+	}
+}
+
+// finish forgets a completed fade, unless it's already been replaced by a newer one
+func (vf *volumeFader) finish(target string, cancelChannel chan bool) {
+	vf.lock.Lock()
+	defer vf.lock.Unlock()
+
+	if vf.fades[target] == cancelChannel {
+		delete(vf.fades, target)
+	}
+}
@@ -0,0 +1,175 @@
+package deej
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	apiPathDeviceRelease = "/device/release"
+
+	// what to do to the board after letting go of its port, to get it into its bootloader
+	uploadResetNone = "none"
+	uploadResetDTR  = "dtr"  // pulse DTR, which resets boards with a USB-serial chip (like the Uno and Nano)
+	uploadReset1200 = "1200" // open and close the port at 1200 baud, which resets boards with native USB (like the Leonardo)
+
+	uploadResetTouchBaudRate = 1200
+
+	defaultUploadReset = uploadResetNone
+
+	// how long to wait for the connection to close before touching the port
+	uploadReleaseTimeout = 2 * time.Second
+	uploadResetPulse     = 100 * time.Millisecond
+)
+
+// releasedDevice is what the API answers a release with
+type releasedDevice struct {
+	Port string `json:"port"`
+}
+
+// ReleaseForUpload has the running deej let go of its device's port, optionally resetting the board into its
+// bootloader, and reconnects once the user (on in and out) says they're done flashing
+func ReleaseForUpload(logger *zap.SugaredLogger, in io.Reader, out io.Writer, reset string) error {
+	// without one, the running deej goes by upload_reset in its config
+	if reset != "" && !validUploadReset(reset) {
+		return fmt.Errorf("unknown reset %q (expected %s, %s or %s)", reset, uploadResetNone, uploadResetDTR, uploadReset1200)
+	}
+
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	released := releasedDevice{}
+	if err := postLocalAPI(apiAddress+apiPathDeviceRelease+"?reset="+url.QueryEscape(reset), &released); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "deej let go of %s, flash your firmware now (with the Arduino IDE or avrdude)\n", released.Port)
+	fmt.Fprint(out, "Press Enter when you're done to have deej reconnect")
+
+	bufio.NewReader(in).ReadString('\n')
+
+	if err := postLocalAPI(apiAddress+apiPathDeviceResume, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Asked deej to reconnect to the device")
+
+	return nil
+}
+
+func validUploadReset(reset string) bool {
+	return reset == uploadResetNone || reset == uploadResetDTR || reset == uploadReset1200
+}
+
+// handleDeviceRelease lets go of the device's port for a firmware upload, until handleDeviceResume
+func (as *apiServer) handleDeviceRelease(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reset := request.URL.Query().Get("reset")
+	if reset == "" {
+		reset = as.deej.config.UploadReset
+	}
+
+	if !validUploadReset(reset) {
+		http.Error(writer, "reset must be none, dtr or 1200", http.StatusBadRequest)
+		return
+	}
+
+	port, err := as.deej.serial.releaseForUpload(reset)
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(releasedDevice{Port: port}); err != nil {
+		as.logger.Debugw("Failed to write release response", "error", err)
+	}
+}
+
+// releaseForUpload quiets the device, closes its port and keeps away from it until resume, returning the
+// port's name. with a reset, the board is also sent into its bootloader
+func (sio *SerialIO) releaseForUpload(reset string) (string, error) {
+	if sio.deej.transport != nil {
+		return "", errors.New("the device isn't connected through a serial port")
+	}
+
+	port := sio.comPort
+	if !sio.isConnected() && (port == "" || port == "auto") {
+		return "", errors.New("not connected to a device yet")
+	}
+
+	// stops the device from streaming slider values for a while, which would only confuse the uploader
+	if sio.isConnected() {
+		if err := sio.writeCommand(protocol.Quiet()); err != nil {
+			sio.logger.Debugw("Failed to quiet device before releasing it", "error", err)
+		}
+	}
+
+	sio.hold()
+
+	if reset == uploadResetNone {
+		return port, nil
+	}
+
+	// the port has to be closed before it can be opened for the reset
+	for deadline := time.Now().Add(uploadReleaseTimeout); sio.isConnected() && time.Now().Before(deadline); {
+		<-time.After(50 * time.Millisecond)
+	}
+
+	if err := resetForUpload(port, reset); err != nil {
+		sio.logger.Warnw("Failed to reset device for upload", "port", port, "reset", reset, "error", err)
+		return port, fmt.Errorf("reset device: %w", err)
+	}
+
+	sio.logger.Infow("Reset device for upload", "port", port, "reset", reset)
+
+	return port, nil
+}
+
+// resetForUpload sends the board on the given port into its bootloader
+func resetForUpload(port string, reset string) error {
+	baudRate := defaultBaudRate
+	if reset == uploadReset1200 {
+		baudRate = uploadResetTouchBaudRate
+	}
+
+	conn, err := serial.Open(port, &serial.Mode{BaudRate: baudRate})
+	if err != nil {
+		return fmt.Errorf("open port: %w", err)
+	}
+
+	defer conn.Close()
+
+	// native USB boards reset when the port closes at 1200 baud with DTR low, the others when DTR drops
+	if err := conn.SetDTR(false); err != nil {
+		return fmt.Errorf("drop DTR: %w", err)
+	}
+
+	if reset == uploadResetDTR {
+		<-time.After(uploadResetPulse)
+
+		if err := conn.SetDTR(true); err != nil {
+			return fmt.Errorf("raise DTR: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,326 @@
+package deej
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/thoas/go-funk"
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	focusModePoll  = "poll"  // check the focused window every poll interval
+	focusModeEvent = "event" // have the OS tell us whenever the focused window changes (windows only)
+
+	// deej.current only follows the focused app while this button is held (or toggled on)
+	buttonActionFocusHold = "focus.hold"
+
+	defaultFocusPollInterval = 350 * time.Millisecond
+
+	// deej.current.<n> follows the focused app on the nth monitor, counting from the left
+	specialTargetCurrentMonitorPrefix = specialTargetCurrentWindow + "."
+)
+
+// focusConfig holds the user's settings for the deej.current target
+type focusConfig struct {
+	Mode         string
+	PollInterval time.Duration
+
+	// apps (names or patterns) that never become the focused app - focusing them keeps the previous one
+	Exclude []string
+}
+
+// focusFollower keeps track of the focused app for the deej.current targets, both overall and per monitor.
+// it only runs while a slider is mapped to one of them
+type focusFollower struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+	mode    string
+
+	// the last focused app (including its child windows' processes) that isn't excluded, and the same per monitor
+	current    []string
+	perMonitor map[int][]string
+
+	// whether a focus.hold button currently lets deej.current follow focus
+	holding bool
+
+	changeChannel chan bool
+	stopChannel   chan bool
+	stopWatching  func()
+}
+
+func newFocusFollower(deej *Deej, logger *zap.SugaredLogger) *focusFollower {
+	logger = logger.Named("focus")
+
+	ff := &focusFollower{
+		deej:          deej,
+		logger:        logger,
+		perMonitor:    map[int][]string{},
+		changeChannel: make(chan bool, 1),
+		stopChannel:   make(chan bool),
+	}
+
+	logger.Debug("Created focus follower instance")
+
+	return ff
+}
+
+func (ff *focusFollower) initialize() {
+	ff.setupOnConfigReload()
+}
+
+// Start begins following focus, if any slider is mapped to a deej.current target
+func (ff *focusFollower) Start() {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	if ff.running || !ff.neededByConfig() {
+		return
+	}
+
+	if !util.ForegroundWindowSupported {
+		ff.logger.Warnw("Following focus isn't supported on this platform, deej.current won't control anything",
+			"error", util.ErrNotSupported)
+		return
+	}
+
+	ff.running = true
+	ff.mode = ff.deej.config.Focus.Mode
+
+	if ff.mode == focusModeEvent {
+		stop, err := util.WatchForegroundWindow(ff.onForegroundChanged)
+		if err != nil {
+			ff.logger.Warnw("Failed to watch for focus changes, polling instead", "error", err)
+			ff.mode = focusModePoll
+		} else {
+			ff.stopWatching = stop
+		}
+	}
+
+	ff.logger.Debugw("Following focus", "mode", ff.mode)
+
+	go ff.followLoop(ff.mode)
+}
+
+// Stop ends following focus, forgetting the focused apps
+func (ff *focusFollower) Stop() {
+	ff.lock.Lock()
+
+	if !ff.running {
+		ff.lock.Unlock()
+		return
+	}
+
+	ff.running = false
+
+	if ff.stopWatching != nil {
+		ff.stopWatching()
+		ff.stopWatching = nil
+	}
+
+	ff.current = nil
+	ff.perMonitor = map[int][]string{}
+
+	ff.lock.Unlock()
+
+	ff.stopChannel <- true
+}
+
+// currentProcessNames returns the focused app's process names for deej.current (monitor 0) or
+// deej.current.<monitor>, or nothing if a focus.hold button isn't letting it through
+func (ff *focusFollower) currentProcessNames(monitor int) []string {
+	if !ff.holdAllows() {
+		return nil
+	}
+
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	// before the first update (or when nothing needed following until just now), look it up on the spot
+	if !ff.running || ff.current == nil {
+		ff.updateLocked()
+	}
+
+	if monitor == 0 {
+		return ff.current
+	}
+
+	return ff.perMonitor[monitor]
+}
+
+// handleHoldButton implements the focus.hold button action
+func (ff *focusFollower) handleHoldButton(event ButtonEvent, binding buttonBinding) {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	if binding.Mode == buttonModeToggle {
+		if event.Pressed {
+			ff.holding = !ff.holding
+		}
+	} else {
+		ff.holding = event.Pressed
+	}
+
+	if ff.deej.Verbose() {
+		ff.logger.Debugw("Focus hold changed", "holding", ff.holding)
+	}
+}
+
+// holdAllows reports whether deej.current may follow focus right now: always, unless a button is bound to focus.hold
+func (ff *focusFollower) holdAllows() bool {
+	holdBound := false
+
+	ff.deej.config.ButtonMapping.iterate(func(buttonID int, binding buttonBinding) {
+		if binding.Action == buttonActionFocusHold {
+			holdBound = true
+		}
+	})
+
+	if !holdBound {
+		return true
+	}
+
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	return ff.holding
+}
+
+func (ff *focusFollower) followLoop(mode string) {
+	var tick <-chan time.Time
+
+	if mode == focusModePoll {
+		ticker := time.NewTicker(ff.deej.config.Focus.PollInterval)
+		defer ticker.Stop()
+
+		tick = ticker.C
+	}
+
+	ff.update()
+
+	for {
+		select {
+		case <-ff.stopChannel:
+			return
+		case <-tick:
+			ff.update()
+		case <-ff.changeChannel:
+			ff.update()
+		}
+	}
+}
+
+// onForegroundChanged is called from the OS's event hook, so it only nudges the follow loop
+func (ff *focusFollower) onForegroundChanged() {
+	select {
+	case ff.changeChannel <- true:
+	default:
+	}
+}
+
+func (ff *focusFollower) update() {
+	ff.lock.Lock()
+	defer ff.lock.Unlock()
+
+	ff.updateLocked()
+}
+
+// updateLocked looks up the focused window, keeping the previous app if it's excluded. assumes the lock is held
+func (ff *focusFollower) updateLocked() {
+	window, err := util.GetForegroundWindow()
+	if err != nil {
+		if ff.deej.Verbose() {
+			ff.logger.Debugw("Failed to get foreground window", "error", err)
+		}
+
+		return
+	}
+
+	processNames := []string{}
+	for _, name := range window.ProcessNames {
+		name = normalizeProcessName(strings.ToLower(name))
+
+		if !ff.excluded(name) {
+			processNames = append(processNames, name)
+		}
+	}
+
+	processNames = funk.UniqString(processNames)
+
+	// nothing focused, or nothing we're allowed to follow
+	if len(processNames) == 0 {
+		return
+	}
+
+	if ff.deej.Verbose() && strings.Join(processNames, ",") != strings.Join(ff.current, ",") {
+		ff.logger.Debugw("Focus changed", "processes", processNames, "monitor", window.Monitor)
+	}
+
+	ff.current = processNames
+
+	if window.Monitor > 0 {
+		ff.perMonitor[window.Monitor] = processNames
+	}
+}
+
+func (ff *focusFollower) excluded(name string) bool {
+	for _, target := range ff.deej.config.Focus.Exclude {
+		if targetMatchesName(target, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// neededByConfig reports whether any profile maps a slider to a deej.current target
+func (ff *focusFollower) neededByConfig() bool {
+	needed := false
+
+	for _, mapping := range ff.deej.config.Profiles {
+		mapping.iterate(func(sliderIdx int, targets []string) {
+			for _, target := range targets {
+				if _, ok := parseCurrentWindowTarget(strings.ToLower(target)); ok {
+					needed = true
+				}
+			}
+		})
+	}
+
+	return needed
+}
+
+// restart on every reload, in case the mode changed or deej.current was mapped (or unmapped)
+func (ff *focusFollower) setupOnConfigReload() {
+	ff.deej.onConfigReload(func() {
+		ff.Stop()
+		ff.Start()
+	})
+}
+
+// parseCurrentWindowTarget returns the monitor a deej.current target follows (0 for any), or false if it isn't one
+func parseCurrentWindowTarget(target string) (int, bool) {
+	if target == specialTargetTransformPrefix+specialTargetCurrentWindow {
+		return 0, true
+	}
+
+	monitorPrefix := specialTargetTransformPrefix + specialTargetCurrentMonitorPrefix
+	if !strings.HasPrefix(target, monitorPrefix) {
+		return 0, false
+	}
+
+	monitor, err := strconv.Atoi(strings.TrimPrefix(target, monitorPrefix))
+	if err != nil || monitor < 1 {
+		return 0, false
+	}
+
+	return monitor, true
+}
@@ -0,0 +1,242 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+// devices that know the handshake answer deej's protocol.Hello (and may send one by themselves when they start)
+// with a line like "#HELLO:proto=1,fw=1.3.0,sliders=4,buttons=3,leds=1,rgb=0,display=1,id=desk-mixer".
+// devices that don't are left alone, and everything keeps working the way it did before the handshake
+const deviceHelloPrefix = "#HELLO:"
+
+// features a device can say it doesn't have
+const (
+	deviceFeatureLEDs    = protocol.FeatureLEDs
+	deviceFeatureRGB     = protocol.FeatureRGB
+	deviceFeatureDisplay = protocol.FeatureDisplay
+)
+
+// deviceHello is what a device said about itself in the handshake. features it didn't mention are assumed present
+type deviceHello struct {
+	Protocol int
+	Firmware string
+	ID       string
+
+	// the framing the device can switch to besides text, if any (see serial_framing.go)
+	Framing string
+
+	// whether the device was paired, and only talks through an encrypted session (see pairing.go)
+	Secure bool
+
+	Sliders  int
+	Buttons  int
+	Encoders int
+
+	LEDs    bool
+	RGB     bool
+	Display bool
+}
+
+// parseDeviceHello reads a "#HELLO:key=value,..." line. unknown keys are skipped, for firmware newer than deej
+func parseDeviceHello(line string) (deviceHello, error) {
+	hello := deviceHello{LEDs: true, RGB: true, Display: true}
+
+	fields := strings.TrimSpace(strings.TrimPrefix(line, deviceHelloPrefix))
+
+	for _, field := range strings.Split(fields, ",") {
+		keyValue := strings.SplitN(field, "=", 2)
+		if len(keyValue) != 2 {
+			return hello, fmt.Errorf("invalid field %q", field)
+		}
+
+		key, value := strings.ToLower(strings.TrimSpace(keyValue[0])), strings.TrimSpace(keyValue[1])
+
+		switch key {
+		case "fw":
+			hello.Firmware = value
+			continue
+		case "id":
+			hello.ID = value
+			continue
+		case "framing":
+			hello.Framing = strings.ToLower(value)
+			continue
+		case "secure":
+			hello.Secure = value == "1"
+			continue
+		case deviceFeatureLEDs, deviceFeatureRGB, deviceFeatureDisplay:
+			if value != "0" && value != "1" {
+				return hello, fmt.Errorf("invalid flag for %s: %q", key, value)
+			}
+
+			flag := value == "1"
+
+			switch key {
+			case deviceFeatureLEDs:
+				hello.LEDs = flag
+			case deviceFeatureRGB:
+				hello.RGB = flag
+			default:
+				hello.Display = flag
+			}
+
+			continue
+
+		case "proto", "sliders", "buttons", "encoders":
+		default:
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return hello, fmt.Errorf("invalid number for %s: %q", key, value)
+		}
+
+		switch key {
+		case "proto":
+			hello.Protocol = number
+		case "sliders":
+			hello.Sliders = number
+		case "buttons":
+			hello.Buttons = number
+		case "encoders":
+			hello.Encoders = number
+		}
+	}
+
+	if hello.Protocol == 0 {
+		return hello, fmt.Errorf("missing protocol version")
+	}
+
+	// there's no color without LEDs
+	hello.RGB = hello.RGB && hello.LEDs
+
+	return hello, nil
+}
+
+// sendHello starts the handshake. it waits for the device's first line, as boards that reset when
+// the port opens can't hear anything before then
+func (sio *SerialIO) sendHello(logger *zap.SugaredLogger) {
+	sio.helloSent = true
+
+	// the tray's "Version release-v1.0" is just "release-v1.0" here
+	version := strings.TrimPrefix(sio.deej.version, "Version ")
+	if version == "" {
+		version = "unknown"
+	}
+
+	if err := sio.writeCommand(protocol.Hello(version)); err != nil {
+		logger.Warnw("Failed to send handshake", "error", err)
+	}
+}
+
+func (sio *SerialIO) handleDeviceHello(logger *zap.SugaredLogger, line string) {
+	hello, err := parseDeviceHello(line)
+	if err != nil {
+		logger.Warnw("Got malformed handshake, ignoring", "line", line, "error", err)
+		return
+	}
+
+	sio.helloLock.Lock()
+	previous := sio.hello
+	sio.hello = &hello
+	sio.helloLock.Unlock()
+
+	// pairing keys are kept by ID, so it's needed before starting a session
+	if hello.ID != "" && hello.ID != sio.deviceIdentity {
+		sio.deviceIdentity = hello.ID
+		logger.Infow("Device reported its ID", "id", hello.ID)
+	}
+
+	// sessions are always binary framed
+	if !sio.startSession(logger, hello) {
+		sio.requestBinaryFraming(logger, hello)
+	}
+
+	// devices say hello by themselves on boot too, which is only news if something changed
+	if previous != nil && *previous == hello {
+		return
+	}
+
+	logger.Infow("Device introduced itself",
+		"protocol", hello.Protocol,
+		"firmware", hello.Firmware,
+		"sliders", hello.Sliders,
+		"buttons", hello.Buttons,
+		"encoders", hello.Encoders,
+		"leds", hello.LEDs,
+		"rgb", hello.RGB,
+		"display", hello.Display,
+		"framing", hello.Framing,
+		"secure", hello.Secure)
+
+	firmware := hello.Firmware
+	if firmware == "" {
+		firmware = "unknown version"
+	}
+
+	if hello.Protocol > protocol.Version {
+		logger.Warnw("Device firmware is newer than this version of deej",
+			"deviceProtocol", hello.Protocol,
+			"protocol", protocol.Version)
+
+		sio.deej.notifier.Notify("Update deej",
+			fmt.Sprintf("Your device's firmware (%s) is newer than this version of deej, some of its features won't work.",
+				firmware))
+	} else if hello.Protocol < protocol.Version {
+		logger.Warnw("Device firmware is older than this version of deej",
+			"deviceProtocol", hello.Protocol,
+			"protocol", protocol.Version)
+
+		sio.deej.notifier.Notify("Update your device's firmware",
+			fmt.Sprintf("Your device's firmware (%s) is older than this version of deej, some features won't work.",
+				firmware))
+	}
+
+	if hello.Sliders > 0 {
+		sio.deej.config.SliderMapping.iterate(func(sliderID int, targets []string) {
+			if sliderID >= hello.Sliders {
+				logger.Warnw("Slider mapping has a slider the device doesn't",
+					"sliderID", sliderID,
+					"deviceSliders", hello.Sliders)
+			}
+		})
+	}
+}
+
+// deviceLacks returns whether the device said in the handshake that it doesn't have a feature, so there's
+// no point sending it anything for it. devices that didn't shake hands lack nothing
+func (sio *SerialIO) deviceLacks(feature string) bool {
+	sio.helloLock.Lock()
+	defer sio.helloLock.Unlock()
+
+	if sio.hello == nil {
+		return false
+	}
+
+	switch feature {
+	case deviceFeatureLEDs:
+		return !sio.hello.LEDs
+	case deviceFeatureRGB:
+		return !sio.hello.RGB
+	case deviceFeatureDisplay:
+		return !sio.hello.Display
+	}
+
+	return false
+}
+
+// forgetHello clears what the last device said, for whatever connects next to introduce itself
+func (sio *SerialIO) forgetHello() {
+	sio.helloLock.Lock()
+	defer sio.helloLock.Unlock()
+
+	sio.hello = nil
+	sio.helloSent = false
+}
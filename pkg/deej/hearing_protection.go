@@ -0,0 +1,335 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	apiPathHearing       = "/hearing"
+	apiPathHearingSnooze = "/hearing/snooze"
+
+	buttonActionHearingSnooze = "hearing.snooze" // stop hearing protection from turning the volume down for a while
+
+	// how often the listening level is checked. gaps longer than a couple of these (like the machine sleeping)
+	// only count as one check
+	hearingCheckInterval = 5 * time.Second
+	hearingMaxCheckGap   = 2 * hearingCheckInterval
+
+	// listening below this level for long enough counts as a break, and starts the exposure over
+	hearingBreakLevel    = 0.05
+	hearingBreakDuration = 10 * time.Minute
+
+	// how far master goes down every check while limiting, so it's a gradual fade rather than a sudden drop
+	hearingLimitStep = 0.02
+
+	defaultHearingLevel         = 70
+	defaultHearingMinutes       = 60
+	defaultHearingLimitTo       = 50
+	defaultHearingSnoozeMinutes = 30
+)
+
+// hearingProtectionConfig holds the user's hearing protection settings
+type hearingProtectionConfig struct {
+	Enabled bool
+
+	// listening level (0-1) that counts as loud, and how long it takes of it before limiting starts
+	Level    float32
+	Duration time.Duration
+
+	// master volume (0-1) limiting brings things down to
+	LimitTo float32
+
+	// how long the snooze action holds off limiting for
+	Snooze time.Duration
+}
+
+// hearingProtector keeps track of how long the user has been listening loud, and once it's been too long,
+// gradually turns master down (and keeps sliders from turning it back up) until they take a break or snooze it.
+// the listening level is master's volume times the loudest app's peak, or just master's volume without a meter
+type hearingProtector struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	meter *AudioMeterService
+
+	lock sync.Mutex
+
+	running   bool
+	lastCheck time.Time
+	lastLoud  time.Time
+
+	// how long the user has listened at or above the configured level since their last break
+	exposure time.Duration
+
+	limiting     bool
+	snoozedUntil time.Time
+
+	stopChannel chan bool
+}
+
+func newHearingProtector(deej *Deej, logger *zap.SugaredLogger) *hearingProtector {
+	logger = logger.Named("hearing")
+
+	hp := &hearingProtector{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created hearing protector instance")
+
+	return hp
+}
+
+// Start begins checking the listening level. it keeps running while disabled, to pick up a config change
+func (hp *hearingProtector) Start() {
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+
+	if hp.running {
+		return
+	}
+
+	hp.running = true
+	hp.lastCheck = time.Now()
+	hp.lastLoud = hp.lastCheck
+
+	go hp.pollLoop()
+}
+
+// Stop ends checking the listening level, and lets sliders turn master back up
+func (hp *hearingProtector) Stop() {
+	hp.lock.Lock()
+
+	if !hp.running {
+		hp.lock.Unlock()
+		return
+	}
+
+	hp.running = false
+	hp.limiting = false
+	hp.lock.Unlock()
+
+	hp.stopChannel <- true
+}
+
+func (hp *hearingProtector) pollLoop() {
+	for {
+		select {
+		case <-hp.stopChannel:
+			return
+		case <-time.After(hearingCheckInterval):
+			hp.check(time.Now())
+		}
+	}
+}
+
+func (hp *hearingProtector) check(now time.Time) {
+	config := hp.deej.config.HearingProtection
+
+	// read outside the lock, as slider moves ask volumeCap while setting volumes
+	level, ok := float32(0), false
+	if config.Enabled {
+		level, ok = hp.listeningLevel()
+	}
+
+	hp.lock.Lock()
+
+	elapsed := now.Sub(hp.lastCheck)
+	hp.lastCheck = now
+
+	if elapsed > hearingMaxCheckGap {
+		elapsed = hearingCheckInterval
+	}
+
+	if !config.Enabled || !ok || now.Before(hp.snoozedUntil) {
+		hp.exposure = 0
+		hp.limiting = false
+		hp.lastLoud = now
+		hp.lock.Unlock()
+
+		return
+	}
+
+	if level >= config.Level {
+		hp.exposure += elapsed
+	}
+
+	if level >= hearingBreakLevel {
+		hp.lastLoud = now
+	} else if now.Sub(hp.lastLoud) >= hearingBreakDuration && hp.exposure > 0 {
+		hp.logger.Infow("Listening break taken, starting exposure over", "exposure", hp.exposure, "wasLimiting", hp.limiting)
+
+		hp.exposure = 0
+		hp.limiting = false
+	}
+
+	started := !hp.limiting && hp.exposure >= config.Duration
+	if started {
+		hp.limiting = true
+		hp.logger.Infow("Listened loud for too long, limiting master volume",
+			"exposure", hp.exposure,
+			"level", config.Level,
+			"limitTo", config.LimitTo)
+	}
+
+	limiting := hp.limiting
+	hp.lock.Unlock()
+
+	if started {
+		hp.deej.notifier.Notify("Time to turn it down",
+			fmt.Sprintf("You've been listening loud for %s. Turning the volume down to %.0f%% - take a break, or snooze this",
+				formatUsageDuration(config.Duration.Seconds()), config.LimitTo*100))
+	}
+
+	if limiting {
+		hp.stepDown(config)
+	}
+}
+
+// listeningLevel returns how loud what's playing is, or false if there's no master session to go by
+func (hp *hearingProtector) listeningLevel() (float32, bool) {
+	muted, ok := hp.deej.sessions.getTargetMute(masterSessionName)
+	if !ok {
+		return 0, false
+	}
+
+	if muted {
+		return 0, true
+	}
+
+	volume, _ := hp.deej.sessions.getTargetVolume(masterSessionName)
+
+	// without a meter, assume something's always playing
+	if !audioMeterSupported {
+		return volume, true
+	}
+
+	// only created once hearing protection is actually in use, like the ducker's
+	if hp.meter == nil {
+		hp.meter = NewAudioMeterService(hp.logger)
+	}
+
+	peakLevels, err := hp.meter.GetAudioPeakLevels()
+	if err != nil {
+		if hp.deej.Verbose() {
+			hp.logger.Debugw("Failed to get audio peak levels", "error", err)
+		}
+
+		return volume, true
+	}
+
+	loudest := float32(0)
+	for _, level := range peakLevels {
+		if level > loudest {
+			loudest = level
+		}
+	}
+
+	return volume * loudest, true
+}
+
+// stepDown brings master one step closer to the configured limit
+func (hp *hearingProtector) stepDown(config hearingProtectionConfig) {
+	volume, ok := hp.deej.sessions.getTargetVolume(masterSessionName)
+	if !ok || volume <= config.LimitTo {
+		return
+	}
+
+	target := volume - hearingLimitStep
+	if target < config.LimitTo {
+		target = config.LimitTo
+	}
+
+	// a fade still running on master would undo this
+	hp.deej.fader.cancel(masterSessionName)
+
+	if !hp.deej.sessions.setTargetVolume(masterSessionName, target) {
+		hp.logger.Warn("Failed to turn master volume down")
+		return
+	}
+
+	if hp.deej.Verbose() {
+		hp.logger.Debugw("Turned master volume down", "from", volume, "to", target)
+	}
+}
+
+// volumeCap keeps sliders from turning master back up past the limit while limiting (see volume_limits.go)
+func (hp *hearingProtector) volumeCap(sessionKey string) (float32, bool) {
+	if sessionKey != masterSessionName {
+		return 0, false
+	}
+
+	hp.lock.Lock()
+	defer hp.lock.Unlock()
+
+	return hp.deej.config.HearingProtection.LimitTo, hp.limiting
+}
+
+// Snooze stops limiting and holds off starting again for the configured snooze time
+func (hp *hearingProtector) Snooze() {
+	config := hp.deej.config.HearingProtection
+	if !config.Enabled {
+		hp.logger.Info("Hearing protection isn't enabled, nothing to snooze")
+		return
+	}
+
+	hp.lock.Lock()
+	hp.snoozedUntil = time.Now().Add(config.Snooze)
+	hp.exposure = 0
+	hp.limiting = false
+	hp.lock.Unlock()
+
+	hp.logger.Infow("Snoozed hearing protection", "for", config.Snooze)
+	hp.deej.notifier.Notify("Hearing protection snoozed",
+		fmt.Sprintf("Leaving the volume alone for %s", formatUsageDuration(config.Snooze.Seconds())))
+}
+
+// handleHearing returns the hearing protector's state as JSON
+func (as *apiServer) handleHearing(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hp := as.deej.hearing
+
+	hp.lock.Lock()
+	response := struct {
+		Enabled         bool       `json:"enabled"`
+		ExposureMinutes float64    `json:"exposureMinutes"`
+		Limiting        bool       `json:"limiting"`
+		SnoozedUntil    *time.Time `json:"snoozedUntil,omitempty"`
+	}{
+		Enabled:         as.deej.config.HearingProtection.Enabled,
+		ExposureMinutes: hp.exposure.Minutes(),
+		Limiting:        hp.limiting,
+	}
+
+	if snoozedUntil := hp.snoozedUntil; time.Now().Before(snoozedUntil) {
+		response.SnoozedUntil = &snoozedUntil
+	}
+	hp.lock.Unlock()
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write hearing response", "error", err)
+	}
+}
+
+// handleHearingSnooze snoozes hearing protection, like the hearing.snooze button action
+func (as *apiServer) handleHearingSnooze(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	as.deej.hearing.Snooze()
+}
@@ -0,0 +1,105 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+// hid: auto finds devices by the vendor and product IDs deej's HID firmware uses
+const hidAuto = "auto"
+
+// hidDevice is an open USB HID device (see hid_device_linux.go and hid_device_windows.go)
+type hidDevice interface {
+
+	// readReport blocks for the next input report, without a report ID
+	readReport() ([]byte, error)
+
+	// writeFeatureReport sends a feature report, report ID first
+	writeFeatureReport(report []byte) error
+
+	Close() error
+}
+
+// hidConn turns a HID device's reports into the lines and commands the rest of deej speaks (see protocol/hid.go)
+type hidConn struct {
+	device  hidDevice
+	pending []byte
+}
+
+func (hc *hidConn) Read(p []byte) (int, error) {
+	for len(hc.pending) == 0 {
+		report, err := hc.device.readReport()
+		if err != nil {
+			return 0, err
+		}
+
+		// empty reports (all padding) and ones deej doesn't know are skipped
+		line, err := protocol.HIDReportToLine(report)
+		if err != nil {
+			continue
+		}
+
+		hc.pending = []byte(line)
+	}
+
+	n := copy(p, hc.pending)
+	hc.pending = hc.pending[n:]
+
+	return n, nil
+}
+
+func (hc *hidConn) Write(p []byte) (int, error) {
+	report, err := protocol.HIDFeatureReport(string(p))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := hc.device.writeFeatureReport(report); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (hc *hidConn) Close() error {
+	return hc.device.Close()
+}
+
+// parseHIDIDs reads a device's hid setting: "auto", or its vendor and product IDs in hex (like "1209:dee1")
+func parseHIDIDs(value string) (uint16, uint16, error) {
+	if strings.EqualFold(value, hidAuto) {
+		return protocol.HIDVendorID, protocol.HIDProductID, nil
+	}
+
+	return parseUSBIDs(value)
+}
+
+// openHID connects to a device that enumerates as USB HID instead of a serial port
+func (sio *SerialIO) openHID(device deviceConnection) error {
+	sio.deviceName = device.Name
+	sio.wantedIdentity = device.ID
+	sio.deviceIdentity = ""
+
+	vendorID, productID, err := parseHIDIDs(device.HID)
+	if err != nil {
+		return fmt.Errorf("open HID connection: %w", err)
+	}
+
+	sio.logger.Debugw("Attempting HID connection",
+		"device", device.Name,
+		"vendorID", fmt.Sprintf("%04x", vendorID),
+		"productID", fmt.Sprintf("%04x", productID))
+
+	hid, path, err := openHIDDevice(vendorID, productID)
+	if err != nil {
+		return fmt.Errorf("open HID connection: %w", err)
+	}
+
+	sio.comPort = "hid:" + path
+	sio.link = linkHID
+	sio.setPort(&transportPort{&hidConn{device: hid}})
+
+	return nil
+}
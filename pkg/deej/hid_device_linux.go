@@ -0,0 +1,114 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+// see hid_device_other.go
+const hidDevicesSupported = true
+
+// hidraw's HIDIOCSFEATURE ioctl, which takes the report's length in its request number
+func hidiocsfeature(length int) uintptr {
+	const (
+		iocRead  = 2
+		iocWrite = 1
+	)
+
+	return uintptr((iocRead|iocWrite)<<30 | length<<16 | 'H'<<8 | 0x06)
+}
+
+// hidrawDevice is a HID device opened through hidraw, which gives raw reports with no driver in the way.
+// reading /dev/hidraw* needs a udev rule granting the user access to it
+type hidrawDevice struct {
+	file *os.File
+}
+
+// openHIDDevice opens the first hidraw device with the given vendor and product IDs, going by
+// what sysfs says about each
+func openHIDDevice(vendorID uint16, productID uint16) (hidDevice, string, error) {
+	devices, err := filepath.Glob("/sys/class/hidraw/hidraw*")
+	if err != nil {
+		return nil, "", fmt.Errorf("list hidraw devices: %w", err)
+	}
+
+	// like HID_ID=0003:00001209:0000DEE1, the first part being the bus (USB, Bluetooth and so on)
+	wanted := fmt.Sprintf(":%08X:%08X", vendorID, productID)
+
+	for _, device := range devices {
+		uevent, err := ioutil.ReadFile(filepath.Join(device, "device", "uevent"))
+		if err != nil {
+			continue
+		}
+
+		matches := false
+		for _, line := range strings.Split(string(uevent), "\n") {
+			if strings.HasPrefix(line, "HID_ID=") && strings.HasSuffix(strings.ToUpper(line), wanted) {
+				matches = true
+			}
+		}
+
+		if !matches {
+			continue
+		}
+
+		path := filepath.Join("/dev", filepath.Base(device))
+
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			return nil, "", fmt.Errorf("open %s: %w", path, err)
+		}
+
+		return &hidrawDevice{file: file}, path, nil
+	}
+
+	return nil, "", errors.New("no matching HID device found")
+}
+
+func (hd *hidrawDevice) readReport() ([]byte, error) {
+	report := make([]byte, protocol.HIDReportSize)
+
+	n, err := hd.file.Read(report)
+	if err != nil {
+		return nil, err
+	}
+
+	return report[:n], nil
+}
+
+func (hd *hidrawDevice) writeFeatureReport(report []byte) error {
+	rawConn, err := hd.file.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("write feature report: %w", err)
+	}
+
+	// through the raw connection rather than Fd(), which would put the file in blocking mode and keep
+	// Close from interrupting a read
+	var errno syscall.Errno
+	controlErr := rawConn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, hidiocsfeature(len(report)),
+			uintptr(unsafe.Pointer(&report[0])))
+	})
+
+	if controlErr != nil {
+		return fmt.Errorf("write feature report: %w", controlErr)
+	}
+
+	if errno != 0 {
+		return fmt.Errorf("write feature report: %w", errno)
+	}
+
+	return nil
+}
+
+func (hd *hidrawDevice) Close() error {
+	return hd.file.Close()
+}
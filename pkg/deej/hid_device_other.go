@@ -0,0 +1,15 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// HID devices can't be opened here yet (that takes IOKit, which needs cgo), so they're only reachable as serial ports
+const hidDevicesSupported = false
+
+func openHIDDevice(vendorID uint16, productID uint16) (hidDevice, string, error) {
+	return nil, "", util.ErrNotSupported
+}
@@ -0,0 +1,216 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+// see hid_device_other.go
+const hidDevicesSupported = true
+
+var (
+	hidDLL                  = syscall.NewLazyDLL("hid.dll")
+	procHidDGetHidGuid      = hidDLL.NewProc("HidD_GetHidGuid")
+	procHidDGetAttributes   = hidDLL.NewProc("HidD_GetAttributes")
+	procHidDSetFeature      = hidDLL.NewProc("HidD_SetFeature")
+	procCreateEventW        = kernel32.NewProc("CreateEventW")
+	procGetOverlappedResult = kernel32.NewProc("GetOverlappedResult")
+
+	setupapi                             = syscall.NewLazyDLL("setupapi.dll")
+	procSetupDiGetClassDevsW             = setupapi.NewProc("SetupDiGetClassDevsW")
+	procSetupDiEnumDeviceInterfaces      = setupapi.NewProc("SetupDiEnumDeviceInterfaces")
+	procSetupDiGetDeviceInterfaceDetailW = setupapi.NewProc("SetupDiGetDeviceInterfaceDetailW")
+	procSetupDiDestroyDeviceInfoList     = setupapi.NewProc("SetupDiDestroyDeviceInfoList")
+)
+
+const (
+	digcfPresent         = 0x02
+	digcfDeviceInterface = 0x10
+)
+
+type spDeviceInterfaceData struct {
+	cbSize             uint32
+	interfaceClassGUID syscall.GUID
+	flags              uint32
+	reserved           uintptr
+}
+
+type hiddAttributes struct {
+	size          uint32
+	vendorID      uint16
+	productID     uint16
+	versionNumber uint16
+}
+
+// windowsHIDDevice is a HID device opened through its device interface. it's opened for overlapped I/O,
+// so that closing it can cancel a read that's waiting for a report
+type windowsHIDDevice struct {
+	handle syscall.Handle
+}
+
+// openHIDDevice opens the first HID device with the given vendor and product IDs
+func openHIDDevice(vendorID uint16, productID uint16) (hidDevice, string, error) {
+	paths, err := hidDevicePaths()
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, path := range paths {
+		if !hidDeviceMatches(path, vendorID, productID) {
+			continue
+		}
+
+		pathPtr, err := syscall.UTF16PtrFromString(path)
+		if err != nil {
+			continue
+		}
+
+		handle, err := syscall.CreateFile(pathPtr,
+			syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+			syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+			nil, syscall.OPEN_EXISTING, syscall.FILE_FLAG_OVERLAPPED, 0)
+
+		if err != nil {
+			return nil, "", fmt.Errorf("open %s: %w", path, err)
+		}
+
+		return &windowsHIDDevice{handle: handle}, path, nil
+	}
+
+	return nil, "", errors.New("no matching HID device found")
+}
+
+// hidDevicePaths lists the device interface paths of every HID device present
+func hidDevicePaths() ([]string, error) {
+	guid := syscall.GUID{}
+	procHidDGetHidGuid.Call(uintptr(unsafe.Pointer(&guid)))
+
+	devInfo, _, err := procSetupDiGetClassDevsW.Call(uintptr(unsafe.Pointer(&guid)), 0, 0,
+		digcfPresent|digcfDeviceInterface)
+
+	if syscall.Handle(devInfo) == syscall.InvalidHandle {
+		return nil, fmt.Errorf("list HID devices: %w", err)
+	}
+
+	defer procSetupDiDestroyDeviceInfoList.Call(devInfo)
+
+	paths := []string{}
+
+	for index := 0; ; index++ {
+		interfaceData := spDeviceInterfaceData{}
+		interfaceData.cbSize = uint32(unsafe.Sizeof(interfaceData))
+
+		ok, _, _ := procSetupDiEnumDeviceInterfaces.Call(devInfo, 0, uintptr(unsafe.Pointer(&guid)),
+			uintptr(index), uintptr(unsafe.Pointer(&interfaceData)))
+
+		if ok == 0 {
+			break
+		}
+
+		// the first call only says how big the details are
+		required := uint32(0)
+		procSetupDiGetDeviceInterfaceDetailW.Call(devInfo, uintptr(unsafe.Pointer(&interfaceData)), 0, 0,
+			uintptr(unsafe.Pointer(&required)), 0)
+
+		if required < 6 {
+			continue
+		}
+
+		// SP_DEVICE_INTERFACE_DETAIL_DATA_W: its size (which counts its padding on 64-bit), then the path
+		detail := make([]uint16, required/2+1)
+		cbSize := uint32(6)
+		if unsafe.Sizeof(uintptr(0)) == 8 {
+			cbSize = 8
+		}
+
+		*(*uint32)(unsafe.Pointer(&detail[0])) = cbSize
+
+		ok, _, _ = procSetupDiGetDeviceInterfaceDetailW.Call(devInfo, uintptr(unsafe.Pointer(&interfaceData)),
+			uintptr(unsafe.Pointer(&detail[0])), uintptr(required), 0, 0)
+
+		if ok == 0 {
+			continue
+		}
+
+		paths = append(paths, syscall.UTF16ToString(detail[2:]))
+	}
+
+	return paths, nil
+}
+
+// hidDeviceMatches returns whether the HID device at the given path has the given vendor and product IDs.
+// it opens the device without asking for access, which works even for keyboards and mice the OS keeps to itself
+func hidDeviceMatches(path string, vendorID uint16, productID uint16) bool {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return false
+	}
+
+	handle, err := syscall.CreateFile(pathPtr, 0, syscall.FILE_SHARE_READ|syscall.FILE_SHARE_WRITE,
+		nil, syscall.OPEN_EXISTING, 0, 0)
+
+	if err != nil {
+		return false
+	}
+
+	defer syscall.CloseHandle(handle)
+
+	attributes := hiddAttributes{}
+	attributes.size = uint32(unsafe.Sizeof(attributes))
+
+	ok, _, _ := procHidDGetAttributes.Call(uintptr(handle), uintptr(unsafe.Pointer(&attributes)))
+
+	return ok != 0 && attributes.vendorID == vendorID && attributes.productID == productID
+}
+
+func (wd *windowsHIDDevice) readReport() ([]byte, error) {
+	// a manual-reset event, for waiting on the read
+	eventHandle, _, err := procCreateEventW.Call(0, 1, 0, 0)
+	if eventHandle == 0 {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+
+	event := syscall.Handle(eventHandle)
+	defer syscall.CloseHandle(event)
+
+	// windows puts the report ID in front, even when the device doesn't use them
+	report := make([]byte, protocol.HIDFeatureReportSize)
+	overlapped := syscall.Overlapped{HEvent: event}
+	read := uint32(0)
+
+	if err := syscall.ReadFile(wd.handle, report, &read, &overlapped); err != nil && err != syscall.ERROR_IO_PENDING {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+
+	ok, _, err := procGetOverlappedResult.Call(uintptr(wd.handle), uintptr(unsafe.Pointer(&overlapped)),
+		uintptr(unsafe.Pointer(&read)), 1)
+
+	if ok == 0 {
+		return nil, fmt.Errorf("read report: %w", err)
+	}
+
+	if read == 0 {
+		return nil, nil
+	}
+
+	return report[1:read], nil
+}
+
+func (wd *windowsHIDDevice) writeFeatureReport(report []byte) error {
+	ok, _, err := procHidDSetFeature.Call(uintptr(wd.handle), uintptr(unsafe.Pointer(&report[0])), uintptr(len(report)))
+	if ok == 0 {
+		return fmt.Errorf("write feature report: %w", err)
+	}
+
+	return nil
+}
+
+func (wd *windowsHIDDevice) Close() error {
+	syscall.CancelIoEx(wd.handle, nil)
+
+	return syscall.CloseHandle(wd.handle)
+}
@@ -0,0 +1,127 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// devices show up as a burst of notifications (the USB device, its interfaces, its port), and their port
+// isn't always ready to open right away. the reconnect loop is only poked once things have settled down
+const hotplugSettleDelay = time.Second
+
+// hotplugWatcher listens for the OS telling it a device was plugged in (see hotplug_linux.go and
+// hotplug_windows.go), so the reconnect loop can look for the deej device right away instead of on its next try
+type hotplugWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+	settle  *time.Timer
+
+	stopChannel chan bool
+}
+
+func newHotplugWatcher(deej *Deej, logger *zap.SugaredLogger) *hotplugWatcher {
+	logger = logger.Named("hotplug")
+
+	hw := &hotplugWatcher{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created hotplug watcher instance")
+
+	return hw
+}
+
+// Start begins listening for devices being plugged in. where that isn't possible, the reconnect loop's
+// polling is all there is
+func (hw *hotplugWatcher) Start() {
+	hw.lock.Lock()
+	defer hw.lock.Unlock()
+
+	if hw.running {
+		return
+	}
+
+	if !hotplugSupported {
+		hw.logger.Debugw("Can't listen for devices being plugged in, relying on reconnect polling",
+			"error", util.ErrNotSupported)
+
+		return
+	}
+
+	hw.running = true
+
+	go func() {
+		if err := watchDeviceArrivals(hw.stopChannel, hw.deviceArrived); err != nil {
+			hw.logger.Warnw("Stopped listening for devices being plugged in, relying on reconnect polling", "error", err)
+
+			// wait for Stop all the same, so it doesn't block
+			<-hw.stopChannel
+		}
+	}()
+}
+
+// Stop ends listening for devices being plugged in
+func (hw *hotplugWatcher) Stop() {
+	hw.lock.Lock()
+
+	if !hw.running {
+		hw.lock.Unlock()
+		return
+	}
+
+	hw.running = false
+
+	if hw.settle != nil {
+		hw.settle.Stop()
+		hw.settle = nil
+	}
+
+	hw.lock.Unlock()
+
+	hw.stopChannel <- true
+}
+
+// deviceArrived is called for every device the OS says was plugged in, and waits for the burst to settle
+func (hw *hotplugWatcher) deviceArrived() {
+	hw.lock.Lock()
+	defer hw.lock.Unlock()
+
+	if !hw.running {
+		return
+	}
+
+	if hw.settle != nil {
+		hw.settle.Reset(hotplugSettleDelay)
+		return
+	}
+
+	hw.settle = time.AfterFunc(hotplugSettleDelay, func() {
+		hw.lock.Lock()
+		hw.settle = nil
+		hw.lock.Unlock()
+
+		if hw.deej.Verbose() {
+			hw.logger.Debug("Device plugged in")
+		}
+
+		hw.deej.serial.deviceArrived()
+	})
+}
+
+// deviceArrived has the reconnect loop (if it's running) look for the device right away
+func (sio *SerialIO) deviceArrived() {
+	select {
+	case sio.arrivalChannel <- true:
+	default:
+	}
+}
@@ -0,0 +1,86 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// see hotplug_other.go
+const hotplugSupported = true
+
+const (
+	netlinkKobjectUevent = 15
+
+	// the kernel's own uevents, which (unlike udev's) don't need udevd running
+	ueventKernelGroup = 1
+
+	// how often a wait for uevents stops to check whether to stop altogether
+	ueventReceiveTimeout = time.Second
+)
+
+// the subsystems deej devices' ports belong to
+var ueventSubsystems = map[string]bool{
+	"SUBSYSTEM=tty":    true,
+	"SUBSYSTEM=hidraw": true,
+}
+
+// watchDeviceArrivals calls arrived for every serial port or HID device that shows up, until stopped
+func watchDeviceArrivals(stop chan bool, arrived func()) error {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, netlinkKobjectUevent)
+	if err != nil {
+		return fmt.Errorf("open uevent socket: %w", err)
+	}
+
+	defer syscall.Close(fd)
+
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: ueventKernelGroup}); err != nil {
+		return fmt.Errorf("bind uevent socket: %w", err)
+	}
+
+	timeout := syscall.NsecToTimeval(ueventReceiveTimeout.Nanoseconds())
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		return fmt.Errorf("set uevent socket timeout: %w", err)
+	}
+
+	buffer := make([]byte, 8192)
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		n, _, err := syscall.Recvfrom(fd, buffer, 0)
+		if err != nil {
+			if err == syscall.EAGAIN || err == syscall.EINTR {
+				continue
+			}
+
+			return fmt.Errorf("read uevent: %w", err)
+		}
+
+		if ueventIsArrival(buffer[:n]) {
+			arrived()
+		}
+	}
+}
+
+// ueventIsArrival returns whether a uevent is about a port being added. they're "action@devpath"
+// followed by KEY=value fields, all NUL-separated
+func ueventIsArrival(message []byte) bool {
+	fields := strings.Split(string(message), "\x00")
+	if !strings.HasPrefix(fields[0], "add@") {
+		return false
+	}
+
+	for _, field := range fields[1:] {
+		if ueventSubsystems[field] {
+			return true
+		}
+	}
+
+	return false
+}
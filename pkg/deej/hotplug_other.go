@@ -0,0 +1,16 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// hearing about devices being plugged in takes IOKit here, which needs cgo. the reconnect loop's polling
+// still finds them, just not right away
+const hotplugSupported = false
+
+func watchDeviceArrivals(stop chan bool, arrived func()) error {
+	return util.ErrNotSupported
+}
@@ -0,0 +1,174 @@
+package deej
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// see hotplug_other.go
+const hotplugSupported = true
+
+var (
+	procRegisterClassExW             = user32.NewProc("RegisterClassExW")
+	procCreateWindowExW              = user32.NewProc("CreateWindowExW")
+	procDestroyWindow                = user32.NewProc("DestroyWindow")
+	procDefWindowProcW               = user32.NewProc("DefWindowProcW")
+	procGetMessageW                  = user32.NewProc("GetMessageW")
+	procDispatchMessageW             = user32.NewProc("DispatchMessageW")
+	procPostMessageW                 = user32.NewProc("PostMessageW")
+	procPostQuitMessage              = user32.NewProc("PostQuitMessage")
+	procRegisterDeviceNotificationW  = user32.NewProc("RegisterDeviceNotificationW")
+	procUnregisterDeviceNotification = user32.NewProc("UnregisterDeviceNotification")
+	procGetModuleHandleW             = kernel32.NewProc("GetModuleHandleW")
+)
+
+const (
+	wmDestroy      = 0x0002
+	wmClose        = 0x0010
+	wmDeviceChange = 0x0219
+
+	dbtDeviceArrival         = 0x8000
+	dbtDevtypDeviceInterface = 5
+
+	// DEVICE_NOTIFY_WINDOW_HANDLE | DEVICE_NOTIFY_ALL_INTERFACE_CLASSES
+	deviceNotifyAllInterfaceClasses = 0x4
+
+	errorClassAlreadyExists = syscall.Errno(1410)
+
+	hotplugWindowClass = "deejHotplug"
+
+	// HWND_MESSAGE, the parent that makes a window message-only: it's never shown, and only gets messages sent to it
+	hwndMessage = ^uintptr(2)
+)
+
+type wndClassEx struct {
+	size       uint32
+	style      uint32
+	wndProc    uintptr
+	clsExtra   int32
+	wndExtra   int32
+	instance   syscall.Handle
+	icon       syscall.Handle
+	cursor     syscall.Handle
+	background syscall.Handle
+	menuName   *uint16
+	className  *uint16
+	iconSm     syscall.Handle
+}
+
+type windowMessage struct {
+	hwnd    syscall.Handle
+	message uint32
+	wParam  uintptr
+	lParam  uintptr
+	time    uint32
+	ptX     int32
+	ptY     int32
+}
+
+type devBroadcastDeviceInterface struct {
+	size       uint32
+	deviceType uint32
+	reserved   uint32
+	classGUID  syscall.GUID
+	name       [1]uint16
+}
+
+// hotplugArrived is what the window procedure calls on a device arrival. there's only ever one hotplug window,
+// and windows callbacks can't carry any state of their own
+var hotplugArrived func()
+
+// made once, as there's a limit on how many callbacks a process can make
+var hotplugWindowProc = syscall.NewCallback(func(hwnd uintptr, message uintptr, wParam uintptr, lParam uintptr) uintptr {
+	switch message {
+	case wmDeviceChange:
+		if wParam == dbtDeviceArrival && hotplugArrived != nil {
+			hotplugArrived()
+		}
+
+		return 1
+
+	case wmDestroy:
+		procPostQuitMessage.Call(0)
+		return 0
+	}
+
+	result, _, _ := procDefWindowProcW.Call(hwnd, message, wParam, lParam)
+
+	return result
+})
+
+// watchDeviceArrivals calls arrived for every device interface that shows up (WM_DEVICECHANGE), until stopped.
+// that takes a window, so it makes a message-only one and runs its message loop
+func watchDeviceArrivals(stop chan bool, arrived func()) error {
+
+	// a window's messages go to the thread that made it
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	hotplugArrived = arrived
+
+	instance, _, _ := procGetModuleHandleW.Call(0)
+
+	className, err := syscall.UTF16PtrFromString(hotplugWindowClass)
+	if err != nil {
+		return fmt.Errorf("register window class: %w", err)
+	}
+
+	class := wndClassEx{
+		wndProc:   hotplugWindowProc,
+		instance:  syscall.Handle(instance),
+		className: className,
+	}
+
+	class.size = uint32(unsafe.Sizeof(class))
+
+	// it's still around from the last time deej was started, if it was stopped since
+	if atom, _, err := procRegisterClassExW.Call(uintptr(unsafe.Pointer(&class))); atom == 0 && err != errorClassAlreadyExists {
+		return fmt.Errorf("register window class: %w", err)
+	}
+
+	hwnd, _, err := procCreateWindowExW.Call(0, uintptr(unsafe.Pointer(className)), 0, 0, 0, 0, 0, 0,
+		hwndMessage, 0, instance, 0)
+
+	if hwnd == 0 {
+		return fmt.Errorf("create window: %w", err)
+	}
+
+	filter := devBroadcastDeviceInterface{deviceType: dbtDevtypDeviceInterface}
+	filter.size = uint32(unsafe.Sizeof(filter))
+
+	notification, _, err := procRegisterDeviceNotificationW.Call(hwnd, uintptr(unsafe.Pointer(&filter)),
+		deviceNotifyAllInterfaceClasses)
+
+	if notification == 0 {
+		procDestroyWindow.Call(hwnd)
+		return fmt.Errorf("register for device notifications: %w", err)
+	}
+
+	defer procUnregisterDeviceNotification.Call(notification)
+
+	// closing the window ends the message loop below
+	go func() {
+		<-stop
+		procPostMessageW.Call(hwnd, wmClose, 0, 0)
+	}()
+
+	message := windowMessage{}
+
+	for {
+		result, _, err := procGetMessageW.Call(uintptr(unsafe.Pointer(&message)), 0, 0, 0)
+
+		switch int32(result) {
+		case 0:
+			return nil
+		case -1:
+			procDestroyWindow.Call(hwnd)
+			return fmt.Errorf("get message: %w", err)
+		}
+
+		procDispatchMessageW.Call(uintptr(unsafe.Pointer(&message)))
+	}
+}
@@ -0,0 +1,9 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+// integrations are the parts of deej that talk to services on the internet: weather and calendar display pages,
+// push alerts and webhooks. headless builds can leave them out with the deej_nointegrations tag, see
+// integrations_off.go
+const integrationsSupported = true
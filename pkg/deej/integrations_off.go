@@ -0,0 +1,73 @@
+//go:build deej_nointegrations
+// +build deej_nointegrations
+
+package deej
+
+import (
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// built with deej_nointegrations, for headless setups that only want serial and volume control: none of the code that
+// talks to services on the internet is built in, and the config turns them off (see disableIntegrations)
+const integrationsSupported = false
+
+type pushAlerter struct{}
+
+func newPushAlerter(deej *Deej, logger *zap.SugaredLogger) *pushAlerter {
+	return &pushAlerter{}
+}
+
+func (pa *pushAlerter) Start() {}
+
+func (pa *pushAlerter) Stop() {}
+
+func (pa *pushAlerter) Alert(kind string, title string, message string) {}
+
+type webhookSender struct{}
+
+func newWebhookSender(deej *Deej, logger *zap.SugaredLogger) *webhookSender {
+	return &webhookSender{}
+}
+
+func (ws *webhookSender) initialize() {}
+
+func (ws *webhookSender) Start() {}
+
+func (ws *webhookSender) Stop() {}
+
+func (ws *webhookSender) emit(kind string, subject string, value string, data map[string]interface{}) {
+}
+
+// missingPageProvider stands in for the weather and calendar providers, and never has a page to show
+type missingPageProvider struct {
+	providerName string
+}
+
+func newWeatherPageProvider(logger *zap.SugaredLogger, httpClient *http.Client, config displayPagesConfig) pageProvider {
+	return &missingPageProvider{"weather"}
+}
+
+func newCalendarPageProvider(logger *zap.SugaredLogger, httpClient *http.Client, config displayPagesConfig) pageProvider {
+	return &missingPageProvider{"calendar"}
+}
+
+func (mp *missingPageProvider) name() string {
+	return mp.providerName
+}
+
+func (mp *missingPageProvider) refreshInterval() time.Duration {
+	return time.Hour
+}
+
+func (mp *missingPageProvider) refresh() error {
+	return util.ErrNotSupported
+}
+
+func (mp *missingPageProvider) page() (displayPage, bool) {
+	return displayPage{}, false
+}
@@ -0,0 +1,261 @@
+package deej
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+
+	// devices on a network link can put the time (their own clock, in milliseconds) they read their sliders
+	// in front of a line, like "@123456:512|300|1023\r\n". lines without one are passed on as they come
+	lineTimestampPrefix = "@"
+
+	defaultJitterBufferMaxMillis = 60
+
+	// how many recent frames the buffer's delay and the clocks' offset are worked out from
+	jitterWindowSize = 128
+
+	// the buffer's delay covers this share of recent frames' jitter, and the rest arrive late
+	jitterPercentile = 0.95
+
+	// how many read lines can wait to be paced before reading holds up
+	jitterQueueSize = 64
+)
+
+// jitterBufferConfig holds the user's jitter buffer settings
+type jitterBufferConfig struct {
+
+	// the most a timestamped line is held back by, to even out how unevenly they arrive (0 to not hold them back)
+	MaxDelay time.Duration
+}
+
+// jitterStats is how timestamped lines have been arriving, for diagnostics
+type jitterStats struct {
+	Timestamped bool `json:"timestamped"`
+
+	// how unevenly lines arrive (the average, past the fastest one), and how long they're held back to even that out
+	JitterMs float64 `json:"jitterMs"`
+	BufferMs float64 `json:"bufferMs"`
+
+	// lines that arrived after the buffer's delay, and ones dropped for being older than one already passed on
+	LateFrames  int `json:"lateFrames"`
+	StaleFrames int `json:"staleFrames"`
+}
+
+// stampedLine is a line along with when it was read
+type stampedLine struct {
+	line    string
+	arrived time.Time
+}
+
+// jitterBuffer evens out timestamped lines from network devices: Wi-Fi delivers them in bursts, which would
+// have volumes jump instead of following the slider. every line is held back so that it comes out a fixed
+// time after the device read it - as short a time as lets nearly all of them make it, worked out from how
+// they've been arriving. the device's clock doesn't need to match this machine's, only to keep time
+type jitterBuffer struct {
+	deej *Deej
+
+	lock sync.Mutex
+
+	// the device's clock, unwrapped past its 32-bit millisecond counter rolling over
+	lastDeviceTime int64
+	wraps          int64
+
+	// recent transit times (arrival minus the device's time, so including the clocks' offset), oldest first
+	transits []int64
+
+	delay time.Duration
+
+	// the device time of the last line passed on, which anything older is stale next to
+	lastReleased int64
+
+	stats jitterStats
+}
+
+func newJitterBuffer(deej *Deej) *jitterBuffer {
+	return &jitterBuffer{deej: deej, lastReleased: -1}
+}
+
+// pace passes lines on from in as they should be handled, holding timestamped ones back and taking their
+// timestamps off. it closes the returned channel once in is closed, or the context is cancelled. the goroutine
+// doing it is counted in the given wait group
+func (jb *jitterBuffer) pace(ctx context.Context, goroutines *sync.WaitGroup, logger *zap.SugaredLogger,
+	in <-chan stampedLine) chan string {
+
+	out := make(chan string)
+
+	// nobody reads what's left once the context is cancelled
+	deliver := func(line string) bool {
+		select {
+		case out <- line:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	goroutines.Add(1)
+	go func() {
+		defer goroutines.Done()
+		defer close(out)
+
+		for stamped := range in {
+			line, deviceTime, ok := splitLineTimestamp(stamped.line)
+			if !ok {
+				if !deliver(stamped.line) {
+					return
+				}
+
+				continue
+			}
+
+			releaseAt, deviceTime := jb.schedule(deviceTime, stamped.arrived)
+			if wait := time.Until(releaseAt); wait > 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			if !jb.release(deviceTime) {
+				if jb.deej.Verbose() {
+					logger.Debugw("Dropped stale timestamped line", "line", line)
+				}
+
+				continue
+			}
+
+			if !deliver(line) {
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// splitLineTimestamp takes the timestamp off a line, if it has one
+func splitLineTimestamp(line string) (string, int64, bool) {
+	if !strings.HasPrefix(line, lineTimestampPrefix) {
+		return line, 0, false
+	}
+
+	fields := strings.SplitN(strings.TrimPrefix(line, lineTimestampPrefix), ":", 2)
+	if len(fields) != 2 {
+		return line, 0, false
+	}
+
+	deviceTime, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return line, 0, false
+	}
+
+	return fields[1], int64(deviceTime), true
+}
+
+// schedule works a line into the buffer's picture of the link, and returns when it should be passed on,
+// along with its unwrapped device time
+func (jb *jitterBuffer) schedule(deviceTime int64, arrived time.Time) (time.Time, int64) {
+	jb.lock.Lock()
+	defer jb.lock.Unlock()
+
+	deviceTime = jb.unwrap(deviceTime)
+
+	transit := arrived.UnixNano()/int64(time.Millisecond) - deviceTime
+	jb.transits = append(jb.transits, transit)
+	if len(jb.transits) > jitterWindowSize {
+		jb.transits = jb.transits[1:]
+	}
+
+	// the fastest recent line tells the clocks' offset, and everything slower was held up on the way
+	fastest := jb.transits[0]
+	for _, t := range jb.transits {
+		if t < fastest {
+			fastest = t
+		}
+	}
+
+	jitters := make([]int64, len(jb.transits))
+	total := int64(0)
+	for idx, t := range jb.transits {
+		jitters[idx] = t - fastest
+		total += jitters[idx]
+	}
+
+	sort.Slice(jitters, func(i, j int) bool { return jitters[i] < jitters[j] })
+
+	jb.delay = time.Duration(jitters[int(float64(len(jitters)-1)*jitterPercentile)]) * time.Millisecond
+	if maxDelay := jb.deej.config.JitterBuffer.MaxDelay; jb.delay > maxDelay {
+		jb.delay = maxDelay
+	}
+
+	jb.stats.Timestamped = true
+	jb.stats.JitterMs = float64(total) / float64(len(jitters))
+	jb.stats.BufferMs = float64(jb.delay) / float64(time.Millisecond)
+
+	// this line's own hold up counts towards the delay already
+	held := time.Duration(transit-fastest) * time.Millisecond
+	if held > jb.delay {
+		jb.stats.LateFrames++
+		return arrived, deviceTime
+	}
+
+	return arrived.Add(jb.delay - held), deviceTime
+}
+
+// release returns whether a line can be passed on, which it can't if a newer one already was
+func (jb *jitterBuffer) release(deviceTime int64) bool {
+	jb.lock.Lock()
+	defer jb.lock.Unlock()
+
+	if deviceTime <= jb.lastReleased {
+		jb.stats.StaleFrames++
+		return false
+	}
+
+	jb.lastReleased = deviceTime
+
+	return true
+}
+
+// unwrap carries the device's 32-bit millisecond clock on past rolling over (every 49 days or so). assumes
+// the lock is held
+func (jb *jitterBuffer) unwrap(deviceTime int64) int64 {
+	previous := jb.lastDeviceTime - jb.wraps<<32
+	if deviceTime < previous-1<<31 {
+		jb.wraps++
+	}
+
+	jb.lastDeviceTime = deviceTime + jb.wraps<<32
+
+	return jb.lastDeviceTime
+}
+
+// current returns how timestamped lines have been arriving
+func (jb *jitterBuffer) current() jitterStats {
+	jb.lock.Lock()
+	defer jb.lock.Unlock()
+
+	return jb.stats
+}
+
+// reset starts over, for whatever connects next (which has its own clock)
+func (jb *jitterBuffer) reset() {
+	jb.lock.Lock()
+	defer jb.lock.Unlock()
+
+	jb.lastDeviceTime = 0
+	jb.wraps = 0
+	jb.transits = nil
+	jb.delay = 0
+	jb.lastReleased = -1
+	jb.stats = jitterStats{}
+}
@@ -0,0 +1,214 @@
+package deej
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	ps "github.com/mitchellh/go-ps"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLaunchSyncPollInterval = time.Second
+
+	// apps usually don't open an audio session until they first play something, so a launched app's
+	// session is looked for on every poll for this long before giving up on it (until its slider moves)
+	launchSyncSessionWait = 10 * time.Second
+)
+
+// launchSyncConfig holds the user's settings for syncing launched apps to their sliders
+type launchSyncConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+}
+
+// launchSync makes apps launched while deej is running start out at their slider's volume, rather than at
+// whatever volume they had last time. the session map applies the volume to every new session it finds
+// (see applyToLaunchedSessions), and this watches for mapped apps starting so it finds them right away
+type launchSync struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+
+	// names of the processes that were running at the last poll, and the mapped ones that started since
+	// but don't have a session yet, by when they were first seen
+	knownProcesses map[string]bool
+	pending        map[string]time.Time
+
+	stopChannel chan bool
+}
+
+func newLaunchSync(deej *Deej, logger *zap.SugaredLogger) *launchSync {
+	logger = logger.Named("launch-sync")
+
+	ls := &launchSync{
+		deej:        deej,
+		logger:      logger,
+		pending:     map[string]time.Time{},
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created launch sync instance")
+
+	return ls
+}
+
+// Start begins watching for mapped apps starting. it keeps running when disabled, to pick up a config change
+func (ls *launchSync) Start() {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	if ls.running {
+		return
+	}
+
+	ls.running = true
+
+	go ls.pollLoop()
+}
+
+// Stop ends watching for mapped apps
+func (ls *launchSync) Stop() {
+	ls.lock.Lock()
+
+	if !ls.running {
+		ls.lock.Unlock()
+		return
+	}
+
+	ls.running = false
+	ls.lock.Unlock()
+
+	ls.stopChannel <- true
+}
+
+func (ls *launchSync) pollLoop() {
+	for {
+		select {
+		case <-ls.stopChannel:
+			return
+
+		// the interval can change with the config, so it's picked up every time around
+		case <-time.After(ls.deej.config.LaunchSync.PollInterval):
+			if ls.deej.config.LaunchSync.Enabled {
+				ls.poll()
+			} else {
+				ls.knownProcesses = nil
+			}
+		}
+	}
+}
+
+func (ls *launchSync) poll() {
+	processes, err := ps.Processes()
+	if err != nil {
+		if ls.deej.Verbose() {
+			ls.logger.Warnw("Failed to enumerate processes", "error", err)
+		}
+
+		return
+	}
+
+	running := make(map[string]bool, len(processes))
+	for _, process := range processes {
+		running[normalizeProcessName(strings.ToLower(process.Executable()))] = true
+	}
+
+	// everything's new on the first poll, but whatever was already running had its sessions found at startup
+	if ls.knownProcesses != nil {
+		for name := range running {
+			if !ls.knownProcesses[name] && ls.processMapped(name) {
+				ls.logger.Debugw("Mapped app launched, looking for its session", "process", name)
+				ls.pending[name] = time.Now()
+			}
+		}
+	}
+
+	ls.knownProcesses = running
+
+	if len(ls.pending) == 0 {
+		return
+	}
+
+	// performance: the reason that forcing a refresh here is okay is that it only happens while a mapped app
+	// that just launched is still missing its session, and for a few seconds at most
+	ls.deej.sessions.refreshSessions(true)
+
+	for name, seen := range ls.pending {
+		if _, ok := ls.deej.sessions.get(name); ok || !running[name] || time.Since(seen) > launchSyncSessionWait {
+			delete(ls.pending, name)
+		}
+	}
+}
+
+// processMapped reports whether any slider in the current profile is mapped to the given process by name or pattern
+func (ls *launchSync) processMapped(name string) bool {
+	mapped := false
+
+	ls.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
+		for _, target := range targets {
+			if !isIdentityTarget(target) && !isDeviceTarget(target) && targetMatchesName(target, name) {
+				mapped = true
+			}
+		}
+	})
+
+	return mapped
+}
+
+func (m *sessionMap) rememberSliderValue(sliderID int, value float32) {
+	m.sliderValuesLock.Lock()
+	defer m.sliderValuesLock.Unlock()
+
+	m.sliderValues[sliderID] = value
+	m.lastSliderMove = time.Now()
+
+	m.deej.state.update(func(state *persistedState) {
+		state.SliderValues[sliderID] = value
+	})
+}
+
+// applyToLaunchedSessions sets sessions that just showed up to their slider's volume, and lets the focus timer mute
+// them if it's holding their app muted. sessions no slider is mapped to, or whose slider hasn't moved yet, are left alone
+func (m *sessionMap) applyToLaunchedSessions(sessions []Session) {
+	if !m.deej.config.LaunchSync.Enabled {
+		return
+	}
+
+	for _, session := range sessions {
+		if !isAppSessionKey(session.Key()) {
+			continue
+		}
+
+		sliderIdx, ok := m.sliderMappedTo(session)
+		if !ok {
+			continue
+		}
+
+		m.sliderValuesLock.Lock()
+		volume, ok := m.sliderValues[sliderIdx]
+		m.sliderValuesLock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		if session.GetVolume() != volume {
+			if err := session.SetVolume(volume); err != nil {
+				m.logger.Warnw("Failed to apply slider volume to launched app", "session", session.Key(), "error", err)
+				continue
+			}
+
+			m.deej.recorder.recordVolume(session.Key(), volume)
+			m.deej.events.recordVolume(session.Key(), volume)
+		}
+
+		m.logger.Infow("Applied slider volume to launched app", "session", session.Key(), "slider", sliderIdx, "volume", volume)
+
+		m.deej.timer.muteLaunchedApp(session.Key())
+	}
+}
@@ -0,0 +1,153 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// how a slider with several targets (or patterns and title:/product: targets matching several apps) lights its LED
+const (
+	ledAggregationAny = "any" // on while any target is active, showing the loudest app (the default)
+	ledAggregationAll = "all" // on only while every target is, showing the quietest target
+	ledAggregationMax = "max" // follows the loudest app alone, on only while it's loud enough to show on the meter
+)
+
+// targetActivity is how active one of a slider's targets is, going by the apps it stands for
+type targetActivity struct {
+	active bool
+
+	// the loudest app it matches (0-100) and its name, in audio mode
+	peak int
+	name string
+
+	// deej.unmapped and deej.current don't stand for any app in particular, so they're left out of "all"
+	specific bool
+}
+
+func (cc *CanonicalConfig) populateLEDAggregation() {
+	cc.LEDAggregation = make(map[int]string)
+
+	for sliderIdxString, value := range cc.userConfig.GetStringMap(configKeyLEDAggregation) {
+		sliderIdx, err := strconv.Atoi(sliderIdxString)
+		if err != nil {
+			continue
+		}
+
+		mode := strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+
+		switch mode {
+		case ledAggregationAny, ledAggregationAll, ledAggregationMax:
+			cc.LEDAggregation[sliderIdx] = mode
+		default:
+			cc.logger.Warnw("Invalid LED aggregation, using default",
+				"key", configKeyLEDAggregation+"."+sliderIdxString,
+				"invalidValue", value,
+				"defaultValue", ledAggregationAny)
+		}
+	}
+}
+
+// ledAggregation returns how the given slider's LED combines its targets
+func (cc *CanonicalConfig) ledAggregation(sliderID int) string {
+	if mode, ok := cc.LEDAggregation[sliderID]; ok {
+		return mode
+	}
+
+	return ledAggregationAny
+}
+
+// sliderTargetActivity works out the activity of each of a slider's targets, one at a time so that a pattern or
+// title:/product: target counts once however many apps it matches
+func (pm *ProcessMonitor) sliderTargetActivity(targets []string, activeProcesses map[string]bool,
+	peakLevels map[string]float32) []targetActivity {
+
+	activities := make([]targetActivity, 0, len(targets))
+
+	for _, target := range targets {
+		targetLower := strings.ToLower(target)
+		_, current := parseCurrentWindowTarget(targetLower)
+
+		activity := targetActivity{
+			specific: !current && targetLower != specialTargetTransformPrefix+specialTargetAllUnmapped,
+		}
+
+		// title and product targets light up with whichever processes they currently match
+		expanded := pm.deej.sessions.expandIdentityTargets([]string{target})
+
+		activity.active = pm.isAnyTargetActive(expanded, activeProcesses)
+
+		if peakLevels != nil {
+			for _, matched := range expanded {
+				for name, level := range matchingPeakLevels(matched, peakLevels) {
+					activity.peak, activity.name = louderApp(activity.peak, activity.name, int(level*100), name)
+				}
+			}
+		}
+
+		activities = append(activities, activity)
+	}
+
+	return activities
+}
+
+// aggregateLEDActivity combines a slider's target activities into whether its LED is on, and the peak and app
+// name it shows, as the given mode says
+func aggregateLEDActivity(mode string, activities []targetActivity, audio bool) (bool, int, string) {
+	active := false
+	peak := 0
+	name := ""
+
+	for _, activity := range activities {
+		active = active || activity.active
+		peak, name = louderApp(peak, name, activity.peak, activity.name)
+	}
+
+	switch mode {
+	case ledAggregationAll:
+		counted := 0
+		quietest := targetActivity{peak: -1}
+
+		for _, activity := range activities {
+			if !activity.specific {
+				continue
+			}
+
+			if !activity.active {
+				return false, 0, ""
+			}
+
+			counted++
+			if quietest.peak < 0 || activity.peak < quietest.peak {
+				quietest = activity
+			}
+		}
+
+		if counted == 0 {
+			return false, 0, ""
+		}
+
+		return true, quietest.peak, quietest.name
+
+	case ledAggregationMax:
+		// without audio there's nothing to be loudest, so this is the same as "any"
+		if audio {
+			return peak > 0, peak, name
+		}
+	}
+
+	return active, peak, name
+}
+
+// louderApp returns whichever of the two apps is louder. ties go to the alphabetically first app, so a pattern's
+// name doesn't flicker between equally loud ones
+func louderApp(peak int, name string, otherPeak int, otherName string) (int, string) {
+	// Extract app name (remove .exe)
+	otherName = strings.TrimSuffix(otherName, ".exe")
+
+	if otherPeak > peak || (otherPeak > 0 && otherPeak == peak && otherName < name) {
+		return otherPeak, otherName
+	}
+
+	return peak, name
+}
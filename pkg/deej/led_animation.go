@@ -0,0 +1,216 @@
+package deej
+
+import (
+	"math"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	ledAnimationOff = "off"
+
+	// every LED fades in and out together (or blinks slowly, on plain LEDs)
+	ledAnimationBreathing = "breathing"
+
+	// a single lit LED runs along the sliders
+	ledAnimationChase = "chase"
+
+	// the LEDs cycle through the colors of the rainbow, each a step ahead of the last (chase, on plain LEDs)
+	ledAnimationRainbow = "rainbow"
+
+	defaultLEDAnimation            = ledAnimationOff
+	defaultLEDAnimationIdleMinutes = 5
+	defaultLEDAnimationCycleMillis = 4000
+
+	// how often the animation's LEDs are updated
+	ledAnimationFrameInterval = 50 * time.Millisecond
+)
+
+// ledAnimationConfig holds the user's idle LED effect settings
+type ledAnimationConfig struct {
+	Effect string
+
+	// how long without audio or slider moves before the effect starts
+	IdleAfter time.Duration
+
+	// how long the effect takes to go around once
+	Cycle time.Duration
+}
+
+// ledAnimationFrame works out every LED's state and color a given way (0-1) through the effect's cycle.
+// colors are only sent to devices with RGB LEDs (see led_colors.go)
+func ledAnimationFrame(effect string, phase float64, numSliders int, theme ledColorTheme, rgb bool) (map[int]bool, map[int]protocol.Color) {
+	states := make(map[int]bool, numSliders)
+	colors := make(map[int]protocol.Color, numSliders)
+
+	// there's no rainbow without colors, so plain LEDs chase instead
+	if effect == ledAnimationRainbow && !rgb {
+		effect = ledAnimationChase
+	}
+
+	for ledIdx := 0; ledIdx < numSliders; ledIdx++ {
+		switch effect {
+		case ledAnimationBreathing:
+			brightness := (1 - math.Cos(2*math.Pi*phase)) / 2
+
+			states[ledIdx] = rgb || brightness >= 0.5
+			colors[ledIdx] = blendLEDColors(protocol.Color{}, theme.Active, float32(brightness))
+
+		case ledAnimationChase:
+			lit := ledIdx == int(phase*float64(numSliders))%numSliders
+
+			states[ledIdx] = lit
+			colors[ledIdx] = theme.Idle
+			if lit {
+				colors[ledIdx] = theme.Active
+			}
+
+		case ledAnimationRainbow:
+			hue := math.Mod(phase+float64(ledIdx)/float64(numSliders), 1)
+
+			states[ledIdx] = true
+			colors[ledIdx] = rainbowColor(hue)
+		}
+	}
+
+	return states, colors
+}
+
+// rainbowColor returns the fully saturated color at the given hue (0-1)
+func rainbowColor(hue float64) protocol.Color {
+	sector := hue * 6
+	rising := uint8((sector-math.Floor(sector))*255 + 0.5)
+	falling := 255 - rising
+
+	switch int(sector) % 6 {
+	case 0:
+		return protocol.Color{R: 255, G: rising}
+	case 1:
+		return protocol.Color{R: falling, G: 255}
+	case 2:
+		return protocol.Color{G: 255, B: rising}
+	case 3:
+		return protocol.Color{G: falling, B: 255}
+	case 4:
+		return protocol.Color{R: rising, B: 255}
+	default:
+		return protocol.Color{R: 255, B: falling}
+	}
+}
+
+// updateAnimation starts the idle effect once there's been no audio or slider moves for long enough,
+// shows its next frame while it runs, and hands the LEDs back to their state as soon as there's activity
+func (pm *ProcessMonitor) updateAnimation() {
+	config := pm.deej.config.LEDAnimation
+	if config.Effect == ledAnimationOff || pm.numSliders == 0 {
+		return
+	}
+
+	// the focus timer (or any other override) is showing something on the LEDs already
+	_, overridden := pm.currentLEDOverrideStates()
+
+	idle := !overridden &&
+		time.Since(pm.lastActivity) >= config.IdleAfter &&
+		time.Since(pm.deej.sessions.lastSliderMoveTime()) >= config.IdleAfter
+
+	if !idle {
+		if pm.animationStart.IsZero() {
+			return
+		}
+
+		pm.logger.Info("Activity resumed, stopping LED animation")
+		pm.animationStart = time.Time{}
+
+		// forget what was last sent, so every LED's real state goes out again right away
+		pm.lastKnownStates = make(map[int]bool)
+
+		pm.lastKnownColorsLock.Lock()
+		pm.lastKnownColors = make(map[int]protocol.Color)
+		pm.lastKnownColorsLock.Unlock()
+
+		pm.checkProcesses()
+		return
+	}
+
+	if pm.animationStart.IsZero() {
+		pm.logger.Infow("Idle, starting LED animation", "effect", config.Effect)
+		pm.animationStart = time.Now()
+	}
+
+	elapsed := time.Since(pm.animationStart)
+	phase := math.Mod(elapsed.Seconds()/config.Cycle.Seconds(), 1)
+
+	rgb := pm.deej.config.LEDColors.Mode != ledColorModeOff
+	states, colors := ledAnimationFrame(config.Effect, phase, pm.numSliders, pm.ledTheme(), rgb)
+
+	if !ledStatesEqual(states, pm.lastKnownStates) {
+		if err := pm.serial.SendAllLEDStates(states, pm.numSliders); err != nil {
+			if pm.deej.Verbose() {
+				pm.logger.Warnw("Failed to send LED animation states", "error", err)
+			}
+		} else {
+			pm.lastKnownStates = states
+		}
+	}
+
+	if rgb {
+		pm.lastKnownColorsLock.Lock()
+		defer pm.lastKnownColorsLock.Unlock()
+
+		if ledColorsEqual(colors, pm.lastKnownColors) {
+			return
+		}
+
+		if err := pm.serial.SendLEDColors(colors, pm.numSliders); err != nil {
+			if pm.deej.Verbose() {
+				pm.logger.Warnw("Failed to send LED animation colors", "error", err)
+			}
+
+			return
+		}
+
+		pm.lastKnownColors = colors
+	}
+}
+
+// animating returns whether the idle effect has the LEDs
+func (pm *ProcessMonitor) animating() bool {
+	return !pm.animationStart.IsZero()
+}
+
+func ledStatesEqual(a map[int]bool, b map[int]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for ledIdx, on := range a {
+		if other, ok := b[ledIdx]; !ok || other != on {
+			return false
+		}
+	}
+
+	return true
+}
+
+func ledColorsEqual(a map[int]protocol.Color, b map[int]protocol.Color) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for ledIdx, color := range a {
+		if other, ok := b[ledIdx]; !ok || other != color {
+			return false
+		}
+	}
+
+	return true
+}
+
+// lastSliderMoveTime returns when a slider last moved (or the zero time, if none have since deej started)
+func (m *sessionMap) lastSliderMoveTime() time.Time {
+	m.sliderValuesLock.Lock()
+	defer m.sliderValuesLock.Unlock()
+
+	return m.lastSliderMove
+}
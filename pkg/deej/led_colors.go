@@ -0,0 +1,259 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	// devices with plain LEDs don't know #LC, so colors are only sent when asked for
+	ledColorModeOff = "off"
+
+	// each slider's LED takes the color set for its target app (or the theme's active color), while it's active
+	ledColorModeTarget = "target"
+
+	// active LEDs fade from the theme's low color to its high color as their slider goes up
+	ledColorModeVolume = "volume"
+
+	// active LEDs fade from the theme's low color to its high color with their slider's audio peak (led_mode: audio)
+	ledColorModePeak = "peak"
+
+	defaultLEDColorMode  = ledColorModeOff
+	defaultLEDColorTheme = "default"
+)
+
+// ledColorTheme is the set of colors the LEDs are drawn from
+type ledColorTheme struct {
+	Idle   protocol.Color
+	Active protocol.Color
+	Low    protocol.Color
+	High   protocol.Color
+}
+
+// ledColorsConfig holds the user's settings for RGB LEDs
+type ledColorsConfig struct {
+	Mode    string
+	Theme   ledColorTheme
+	Targets map[string]protocol.Color
+
+	// every theme by name, built-in and the user's
+	Themes map[string]ledColorTheme
+}
+
+// built-in themes, which user-defined ones with the same name replace
+var builtInLEDColorThemes = map[string]ledColorTheme{
+	"default": {
+		Idle:   protocol.Color{},
+		Active: protocol.Color{R: 255, G: 255, B: 255},
+		Low:    protocol.Color{G: 255},
+		High:   protocol.Color{R: 255},
+	},
+	"ocean": {
+		Idle:   protocol.Color{B: 24},
+		Active: protocol.Color{G: 160, B: 255},
+		Low:    protocol.Color{B: 255},
+		High:   protocol.Color{G: 255, B: 200},
+	},
+	"sunset": {
+		Idle:   protocol.Color{R: 24},
+		Active: protocol.Color{R: 255, G: 96},
+		Low:    protocol.Color{R: 255, G: 160},
+		High:   protocol.Color{R: 200, B: 120},
+	},
+	"night": {
+		Idle:   protocol.Color{},
+		Active: protocol.Color{R: 40},
+		Low:    protocol.Color{R: 12},
+		High:   protocol.Color{R: 48, G: 8},
+	},
+}
+
+// parseLEDColor reads a color written as "#rrggbb" (the # is optional)
+func parseLEDColor(value interface{}) (protocol.Color, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(fmt.Sprint(value)), "#")
+	if len(hex) != 6 {
+		return protocol.Color{}, fmt.Errorf("expected a color like #ff8800, got %v", value)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return protocol.Color{}, fmt.Errorf("expected a color like #ff8800, got %v", value)
+	}
+
+	return protocol.Color{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb)}, nil
+}
+
+// ledThemeFromConfig reads a theme's colors, leaving any it doesn't set as they are in base
+func ledThemeFromConfig(value interface{}, base ledColorTheme) (ledColorTheme, error) {
+	fields, ok := toStringMap(value)
+	if !ok {
+		return base, fmt.Errorf("expected idle, active, low and high colors")
+	}
+
+	theme := base
+	for key, color := range map[string]*protocol.Color{
+		"idle":   &theme.Idle,
+		"active": &theme.Active,
+		"low":    &theme.Low,
+		"high":   &theme.High,
+	} {
+		rawValue, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		parsed, err := parseLEDColor(rawValue)
+		if err != nil {
+			return base, fmt.Errorf("%s: %w", key, err)
+		}
+
+		*color = parsed
+	}
+
+	return theme, nil
+}
+
+// blendLEDColors mixes from and to, with amount (0-1) being how far along from one to the other
+func blendLEDColors(from protocol.Color, to protocol.Color, amount float32) protocol.Color {
+	if amount < 0 {
+		amount = 0
+	} else if amount > 1 {
+		amount = 1
+	}
+
+	blend := func(a uint8, b uint8) uint8 {
+		return uint8(float32(a) + (float32(b)-float32(a))*amount + 0.5)
+	}
+
+	return protocol.Color{R: blend(from.R, to.R), G: blend(from.G, to.G), B: blend(from.B, to.B)}
+}
+
+// ledColors works out each slider's LED color for the configured mode, given which LEDs are on
+// and (in audio mode) each slider's peak level, 0-100. while an override (like the focus timer) has
+// the LEDs, they're plainly on or off, since what they show has nothing to do with the sliders
+func (pm *ProcessMonitor) ledColors(states map[int]bool, peaks map[int]int, overridden bool) map[int]protocol.Color {
+	config := pm.deej.config.LEDColors
+	theme := pm.ledTheme()
+	colors := make(map[int]protocol.Color, len(states))
+
+	for sliderID, on := range states {
+		if !on {
+			colors[sliderID] = theme.Idle
+			continue
+		}
+
+		colors[sliderID] = theme.Active
+		if overridden {
+			continue
+		}
+
+		switch config.Mode {
+		case ledColorModeTarget:
+			if color, ok := pm.targetLEDColor(sliderID); ok {
+				colors[sliderID] = color
+			}
+
+		case ledColorModeVolume:
+			if value, ok := pm.deej.sessions.sliderValue(sliderID); ok {
+				colors[sliderID] = blendLEDColors(theme.Low, theme.High, value)
+			}
+
+		case ledColorModePeak:
+			if peak, ok := peaks[sliderID]; ok {
+				colors[sliderID] = blendLEDColors(theme.Low, theme.High, float32(peak)/100)
+			}
+		}
+	}
+
+	return colors
+}
+
+// ledTheme returns the theme the LEDs are drawn from right now: the configured one, unless quiet hours have their own
+func (pm *ProcessMonitor) ledTheme() ledColorTheme {
+	if theme, ok := pm.deej.quietHours.ledTheme(); ok {
+		return theme
+	}
+
+	return pm.deej.config.LEDColors.Theme
+}
+
+// targetLEDColor returns the color set for the first of the slider's targets that has one
+func (pm *ProcessMonitor) targetLEDColor(sliderID int) (protocol.Color, bool) {
+	targets, ok := pm.deej.config.SliderMapping.get(sliderID)
+	if !ok {
+		return protocol.Color{}, false
+	}
+
+	for _, target := range targets {
+		if color, ok := pm.deej.config.LEDColors.Targets[strings.ToLower(target)]; ok {
+			return color, true
+		}
+	}
+
+	return protocol.Color{}, false
+}
+
+// applyLEDColors sends every LED's color if any of them changed since they were last sent
+func (pm *ProcessMonitor) applyLEDColors(states map[int]bool, peaks map[int]int, overridden bool) {
+	if pm.deej.config.LEDColors.Mode == ledColorModeOff || pm.numSliders == 0 {
+		return
+	}
+
+	colors := pm.ledColors(states, peaks, overridden)
+
+	pm.lastKnownColorsLock.Lock()
+	defer pm.lastKnownColorsLock.Unlock()
+
+	changed := len(colors) != len(pm.lastKnownColors)
+	for sliderID, color := range colors {
+		if lastColor, ok := pm.lastKnownColors[sliderID]; !ok || lastColor != color {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := pm.serial.SendLEDColors(colors, pm.numSliders); err != nil {
+		if pm.deej.Verbose() {
+			pm.logger.Warnw("Failed to update LED colors", "error", err)
+		}
+
+		return
+	}
+
+	pm.lastKnownColors = colors
+}
+
+// refreshLEDColors resends the last LED colors, along with the periodic LED state refresh
+func (pm *ProcessMonitor) refreshLEDColors() {
+	if pm.deej.config.LEDColors.Mode == ledColorModeOff {
+		return
+	}
+
+	pm.lastKnownColorsLock.Lock()
+	defer pm.lastKnownColorsLock.Unlock()
+
+	if len(pm.lastKnownColors) == 0 {
+		return
+	}
+
+	if err := pm.serial.SendLEDColors(pm.lastKnownColors, pm.numSliders); err != nil {
+		if pm.deej.Verbose() {
+			pm.logger.Warnw("Failed to refresh LED colors", "error", err)
+		}
+	}
+}
+
+// sliderValue returns the slider's last known value (0-1), or false if it hasn't moved since deej started
+func (m *sessionMap) sliderValue(sliderID int) (float32, bool) {
+	m.sliderValuesLock.Lock()
+	defer m.sliderValuesLock.Unlock()
+
+	value, ok := m.sliderValues[sliderID]
+	return value, ok
+}
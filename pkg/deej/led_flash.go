@@ -0,0 +1,55 @@
+package deej
+
+import (
+	"time"
+)
+
+const (
+	// a flash is a few quick blinks of a single LED
+	ledFlashBlinks   = 3
+	ledFlashInterval = 120 * time.Millisecond
+
+	// a slider held against a cap keeps asking for flashes, which only start again this long after the last
+	ledFlashCooldown = 2 * time.Second
+)
+
+// FlashLED blinks a slider's LED a few times, to say no to whatever the slider just tried to do. flashes
+// are dropped while the LEDs aren't being driven (no device connected), or while the slider's last is still fresh
+func (pm *ProcessMonitor) FlashLED(sliderID int) {
+	pm.flashLock.Lock()
+	defer pm.flashLock.Unlock()
+
+	now := time.Now()
+	if last, ok := pm.lastFlash[sliderID]; ok && now.Sub(last) < ledFlashCooldown {
+		return
+	}
+
+	select {
+	case pm.flashChannel <- sliderID:
+		pm.lastFlash[sliderID] = now
+	default:
+	}
+}
+
+// flashLED runs a flash from the monitor loop, then leaves the LED as it was
+func (pm *ProcessMonitor) flashLED(sliderID int) {
+	if pm.animating() {
+		return
+	}
+
+	on := pm.lastKnownStates[sliderID]
+
+	for blink := 0; blink < ledFlashBlinks; blink++ {
+		for _, state := range []bool{!on, on} {
+			if err := pm.serial.SendLEDState(sliderID, state); err != nil {
+				if pm.deej.Verbose() {
+					pm.logger.Warnw("Failed to flash LED", "sliderID", sliderID, "error", err)
+				}
+
+				return
+			}
+
+			<-time.After(ledFlashInterval)
+		}
+	}
+}
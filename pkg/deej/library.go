@@ -0,0 +1,209 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Option sets up a Deej instance created with New. everything left unset behaves like the deej executable
+type Option func(*deejOptions)
+
+type deejOptions struct {
+	verbose   bool
+	notifier  Notifier
+	transport Transport
+	profile   string
+	version   string
+	safeMode  bool
+	simulate  bool
+
+	startupArgs   []string
+	sessionFinder SessionFinder
+}
+
+// WithVerbose makes deej log every slider move, command and volume change, like --verbose does
+func WithVerbose(verbose bool) Option {
+	return func(options *deejOptions) {
+		options.verbose = verbose
+	}
+}
+
+// WithNotifier shows deej's notifications (device found, config errors and so on) through the given notifier,
+// instead of as desktop notifications
+func WithNotifier(notifier Notifier) Option {
+	return func(options *deejOptions) {
+		options.notifier = notifier
+	}
+}
+
+// WithTransport reaches the device through the given transport instead of a serial port. the config's
+// com_port, baud_rate and devices are left alone
+func WithTransport(transport Transport) Option {
+	return func(options *deejOptions) {
+		options.transport = transport
+	}
+}
+
+// WithSimulatedDevice has deej talk to a simulated device instead of a real one, like --simulate does
+func WithSimulatedDevice(enabled bool) Option {
+	return func(options *deejOptions) {
+		options.simulate = enabled
+	}
+}
+
+// WithProfile starts deej with the given profile, instead of the one set in the config, like --profile does
+func WithProfile(name string) Option {
+	return func(options *deejOptions) {
+		options.profile = name
+	}
+}
+
+// WithVersion shows the given version string in the tray menu
+func WithVersion(version string) Option {
+	return func(options *deejOptions) {
+		options.version = version
+	}
+}
+
+// WithStartupArgs gives the flags deej was started with (e.g. --cli), for the tray's start at login item to
+// start it with next time
+func WithStartupArgs(args []string) Option {
+	return func(options *deejOptions) {
+		options.startupArgs = args
+	}
+}
+
+// WithSafeMode starts deej without integrations, audio metering and the API, like --safe-mode does
+func WithSafeMode(enabled bool) Option {
+	return func(options *deejOptions) {
+		options.safeMode = enabled
+	}
+}
+
+// WithSessionFinder has sliders control the sessions the given finder finds, instead of the configured backend's
+func WithSessionFinder(sessionFinder SessionFinder) Option {
+	return func(options *deejOptions) {
+		options.sessionFinder = sessionFinder
+	}
+}
+
+// Start loads the config and runs deej in the background, for programs embedding it: unlike Initialize, it
+// returns right away, shows no tray icon, doesn't handle interrupts and doesn't exit the process when stopped
+func (d *Deej) Start() error {
+	if d.embedded {
+		return errors.New("deej: already started")
+	}
+
+	if err := d.prepare(); err != nil {
+		return fmt.Errorf("prepare to start: %w", err)
+	}
+
+	d.embedded = true
+	d.stoppedChannel = make(chan bool)
+
+	d.logger.Info("Starting in the background")
+	d.startComponents()
+
+	go func() {
+		<-d.stopChannel
+		d.logger.Debug("Stop channel signaled, stopping")
+
+		d.stopErr = d.stop()
+		close(d.stoppedChannel)
+	}()
+
+	return nil
+}
+
+// Stop stops deej started with Start, and returns once it's done. stopping it again, or after it stopped by
+// itself (say, when part of it crashed), returns the same as the first time
+func (d *Deej) Stop() error {
+	if !d.embedded {
+		return errors.New("deej: not started")
+	}
+
+	d.signalStop()
+	<-d.stoppedChannel
+
+	return d.stopErr
+}
+
+// SubscribeToSliderMoveEvents returns a subscription that receives every slider move, after calibration, smoothing
+// and curves. deej doesn't wait for subscribers: one that falls too far behind misses moves until it catches up.
+// Close it when done, which also closes its channel
+func (d *Deej) SubscribeToSliderMoveEvents() *SliderMoveSubscription {
+	return d.serial.SubscribeToSliderMoveEvents()
+}
+
+// SubscribeToButtonEvents returns a subscription that receives every button press and release. like slider moves,
+// a subscriber that falls too far behind misses some, and Close ends it
+func (d *Deej) SubscribeToButtonEvents() *ButtonSubscription {
+	return d.serial.SubscribeToButtonEvents()
+}
+
+// SubscribeToConfigChanges returns a subscription that receives a value whenever the config is reloaded or the
+// active profile switches. reloads in quick succession can come as one, and Close ends it
+func (d *Deej) SubscribeToConfigChanges() *ConfigSubscription {
+	return d.config.SubscribeToChanges()
+}
+
+// SubscribeToSessionChanges returns a subscription that receives the audio sessions that appeared and went away
+// whenever deej looks them up again. like slider moves, a subscriber that falls too far behind misses some
+func (d *Deej) SubscribeToSessionChanges() *SessionSubscription {
+	return d.bus.subscribeToSessions()
+}
+
+// SubscribeToConnectionChanges returns a subscription that receives the device connecting and disconnecting. only
+// the latest is kept for a subscriber that's busy, so it always ends up knowing whether the device is connected
+func (d *Deej) SubscribeToConnectionChanges() *ConnectionSubscription {
+	return d.bus.subscribeToConnection()
+}
+
+// SubscribeToPeaks returns a subscription that receives every slider's audio peak, ten times a second while
+// led_mode is audio. like connection changes, only the latest is kept for a subscriber that's busy
+func (d *Deej) SubscribeToPeaks() *PeakSubscription {
+	return d.bus.subscribeToPeaks()
+}
+
+// SetVolume sets every session matching the given target to the given volume (0-1). targets are written
+// the same way as in slider_mapping (e.g. "spotify.exe", "master", "mic"). it returns false if none matched
+func (d *Deej) SetVolume(target string, volume float32) bool {
+	if volume < 0 {
+		volume = 0
+	} else if volume > 1 {
+		volume = 1
+	}
+
+	return d.sessions.setTargetVolume(target, volume)
+}
+
+// Volume returns the volume (0-1) of the first session matching the given target, or false if none match
+func (d *Deej) Volume(target string) (float32, bool) {
+	return d.sessions.getTargetVolume(target)
+}
+
+// SliderMapping returns the active profile's targets for each slider. changing it changes nothing
+func (d *Deej) SliderMapping() map[int][]string {
+	mapping := map[int][]string{}
+
+	d.config.SliderMapping.iterate(func(sliderID int, targets []string) {
+		mapping[sliderID] = append([]string{}, targets...)
+	})
+
+	return mapping
+}
+
+// Profiles returns the names of all configured profiles, in alphabetical order
+func (d *Deej) Profiles() []string {
+	return d.config.ProfileNames()
+}
+
+// ActiveProfile returns the name of the profile in use
+func (d *Deej) ActiveProfile() string {
+	return d.config.ActiveProfile
+}
+
+// SwitchProfile switches to the profile with the given name
+func (d *Deej) SwitchProfile(name string) error {
+	return d.config.SwitchProfile(name)
+}
@@ -0,0 +1,118 @@
+package deej
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// inTempDir runs a test from a directory of its own holding the given config.yaml, like deej would be run from
+func inTempDir(t *testing.T, config string) {
+	dir, err := ioutil.TempDir("", "deej-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.Chdir(workingDir)
+		os.RemoveAll(dir)
+	})
+
+	if err := ioutil.WriteFile(userConfigFilepath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stopWithin calls Stop, failing the test if it doesn't return in time
+func stopWithin(t *testing.T, d *Deej, timeout time.Duration) error {
+	stopped := make(chan error, 1)
+	go func() { stopped <- d.Stop() }()
+
+	select {
+	case err := <-stopped:
+		return err
+	case <-time.After(timeout):
+		t.Fatal("Stop didn't return")
+		return nil
+	}
+}
+
+func TestStopAfterFailedStart(t *testing.T) {
+	inTempDir(t, "slider_mapping: [not, a, map\n")
+
+	d, err := New(zap.NewNop().Sugar(), WithSimulatedDevice(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Start(); err == nil {
+		t.Fatal("expected Start to fail with a broken config")
+	}
+
+	if err := stopWithin(t, d, 2*time.Second); err == nil {
+		t.Error("expected Stop to say deej isn't started")
+	}
+}
+
+func TestStopIsIdempotent(t *testing.T) {
+	inTempDir(t, "slider_mapping:\n  0: master\nbackend: dummy\n")
+
+	d, err := New(zap.NewNop().Sugar(), WithSimulatedDevice(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// like a crashed part of deej would
+	d.signalStop()
+
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := stopWithin(t, d, 5*time.Second); err != nil {
+			t.Errorf("stop %d: %v", attempt+1, err)
+		}
+	}
+}
+
+// everything following config reloads should let go of them once deej stops, or embedding programs that start and
+// stop it over and over pile up goroutines
+func TestStopEndsConfigSubscriptions(t *testing.T) {
+	inTempDir(t, "slider_mapping:\n  0: master\nbackend: dummy\n")
+
+	d, err := New(zap.NewNop().Sugar(), WithSimulatedDevice(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := stopWithin(t, d, 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := d.config.reloads
+
+	reloads.lock.Lock()
+	left := len(reloads.subscribers)
+	reloads.lock.Unlock()
+
+	if left != 0 {
+		t.Errorf("%d config subscriptions left open after stopping", left)
+	}
+}
@@ -0,0 +1,389 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	apiPathMetrics = "/metrics"
+
+	defaultHeartbeatIntervalSeconds = 5
+
+	// devices go quiet for 10 seconds when asked to (for firmware uploads), which mustn't count as silence
+	defaultHeartbeatSilenceSeconds = 15
+
+	heartbeatPrefix = "#K:"
+
+	// how often the link is checked, whatever the heartbeat interval
+	linkPollInterval = time.Second
+)
+
+// heartbeatConfig holds the user's link health settings
+type heartbeatConfig struct {
+
+	// how often to ping the device (0 to not ping it)
+	Interval time.Duration
+
+	// how long the device can go without sending anything before the connection is dropped and made again
+	// (0 to never drop it)
+	SilenceTimeout time.Duration
+}
+
+// linkHealth is how the connection to the device is doing, since it was made
+type linkHealth struct {
+	Connected bool `json:"connected"`
+
+	// the last heartbeat's round trip, and a running average of them
+	RoundTripMs        float64 `json:"roundTripMs"`
+	AverageRoundTripMs float64 `json:"averageRoundTripMs"`
+
+	HeartbeatsSent     int `json:"heartbeatsSent"`
+	HeartbeatsAnswered int `json:"heartbeatsAnswered"`
+	MissedHeartbeats   int `json:"missedHeartbeats"`
+
+	// garbled lines and binary frames that failed their CRC or couldn't be unsealed
+	LineErrors int `json:"lineErrors"`
+
+	// how many times the connection was dropped for going silent, since deej started
+	SilenceReconnects int `json:"silenceReconnects"`
+
+	// how timestamped lines from a network device have been arriving (see jitter_buffer.go)
+	Latency jitterStats `json:"latency"`
+}
+
+// String sums up the link for the tray tooltip
+func (lh linkHealth) String() string {
+	if !lh.Connected {
+		return "device not connected"
+	}
+
+	parts := []string{"device connected"}
+	if lh.HeartbeatsAnswered > 0 {
+		parts = append(parts, fmt.Sprintf("%.0f ms", lh.AverageRoundTripMs))
+	}
+
+	if lh.MissedHeartbeats > 0 {
+		parts = append(parts, fmt.Sprintf("%d missed", lh.MissedHeartbeats))
+	}
+
+	if lh.LineErrors > 0 {
+		parts = append(parts, fmt.Sprintf("%d errors", lh.LineErrors))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// linkMonitor pings the device (#K:<seq>, which the device echoes back) to measure round trips, keeps count of
+// what went wrong on the link, and drops the connection if the device goes silent, so that it's made again.
+// devices that don't answer heartbeats are fine: missed ones only count once the device has answered one,
+// and as long as slider values keep coming in, the link isn't silent
+type linkMonitor struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+
+	health linkHealth
+
+	// heartbeats waiting for an answer, by sequence number
+	pending   map[int]time.Time
+	sequence  int
+	lastPing  time.Time
+	answering bool
+
+	// when the device last sent anything (zero until the connection's first poll)
+	lastLine time.Time
+
+	stopChannel chan bool
+}
+
+func newLinkMonitor(deej *Deej, logger *zap.SugaredLogger) *linkMonitor {
+	logger = logger.Named("link")
+
+	lm := &linkMonitor{
+		deej:        deej,
+		logger:      logger,
+		pending:     map[int]time.Time{},
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created link monitor instance")
+
+	return lm
+}
+
+// Start begins checking the link
+func (lm *linkMonitor) Start() {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	if lm.running {
+		return
+	}
+
+	lm.running = true
+
+	go lm.pollLoop()
+}
+
+// Stop ends checking the link
+func (lm *linkMonitor) Stop() {
+	lm.lock.Lock()
+
+	if !lm.running {
+		lm.lock.Unlock()
+		return
+	}
+
+	lm.running = false
+	lm.lock.Unlock()
+
+	lm.stopChannel <- true
+}
+
+// current returns how the link is doing
+func (lm *linkMonitor) current() linkHealth {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	health := lm.health
+	health.Connected = lm.deej.serial != nil && lm.deej.serial.isConnected()
+
+	if lm.deej.serial != nil {
+		health.Latency = lm.deej.serial.jitter.current()
+	}
+
+	return health
+}
+
+func (lm *linkMonitor) pollLoop() {
+	for {
+		select {
+		case <-lm.stopChannel:
+			return
+		case <-time.After(linkPollInterval):
+			lm.poll()
+		}
+	}
+}
+
+func (lm *linkMonitor) poll() {
+	sio := lm.deej.serial
+	config := lm.deej.config.Heartbeat
+
+	if !sio.isConnected() {
+		lm.deej.bus.link.publish(lm.current())
+		return
+	}
+
+	now := time.Now()
+
+	lm.lock.Lock()
+
+	if lm.lastLine.IsZero() {
+		lm.lastLine = now
+	}
+
+	silentFor := now.Sub(lm.lastLine)
+
+	// a heartbeat that wasn't answered by the time the next one's due never will be
+	missed := 0
+	for sequence, sent := range lm.pending {
+		if now.Sub(sent) >= config.Interval {
+			delete(lm.pending, sequence)
+
+			if lm.answering {
+				missed++
+			}
+		}
+	}
+
+	lm.health.MissedHeartbeats += missed
+	totalMissed := lm.health.MissedHeartbeats
+
+	due := config.Interval > 0 && now.Sub(lm.lastPing) >= config.Interval
+	sequence := 0
+	if due {
+		lm.sequence++
+		sequence = lm.sequence
+		lm.pending[sequence] = now
+		lm.lastPing = now
+		lm.health.HeartbeatsSent++
+	}
+
+	// the connection takes a moment to close, which shouldn't count as more silence
+	silent := config.SilenceTimeout > 0 && silentFor >= config.SilenceTimeout
+	if silent {
+		lm.health.SilenceReconnects++
+		lm.lastLine = now
+	}
+
+	lm.lock.Unlock()
+
+	if silent {
+		lm.logger.Warnw("Device went silent, reconnecting", "silentFor", silentFor.Round(time.Second))
+		sio.dropConnection()
+		lm.deej.bus.link.publish(lm.current())
+
+		return
+	}
+
+	if missed > 0 {
+		lm.logger.Warnw("Device missed heartbeats", "missed", missed, "totalMissed", totalMissed)
+	}
+
+	if due {
+		if err := sio.SendHeartbeat(sequence); err != nil && lm.deej.Verbose() {
+			lm.logger.Debugw("Failed to send heartbeat", "error", err)
+		}
+	}
+
+	lm.deej.bus.link.publish(lm.current())
+}
+
+// recordLine notes that the device sent something, whatever it was
+func (lm *linkMonitor) recordLine() {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	lm.lastLine = time.Now()
+}
+
+// recordLineError counts a line or frame from the device that had to be dropped
+func (lm *linkMonitor) recordLineError() {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	lm.health.LineErrors++
+}
+
+// recordHeartbeat handles the device's answer to a heartbeat (format: #K:<seq>\r\n)
+func (lm *linkMonitor) recordHeartbeat(line string) {
+	sequence, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, heartbeatPrefix)))
+	if err != nil {
+		return
+	}
+
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	sent, ok := lm.pending[sequence]
+	if !ok {
+		return
+	}
+
+	delete(lm.pending, sequence)
+
+	roundTrip := float64(time.Since(sent)) / float64(time.Millisecond)
+	if lm.health.HeartbeatsAnswered == 0 {
+		lm.health.AverageRoundTripMs = roundTrip
+	} else {
+		lm.health.AverageRoundTripMs = lm.health.AverageRoundTripMs*0.8 + roundTrip*0.2
+	}
+
+	lm.health.RoundTripMs = roundTrip
+	lm.health.HeartbeatsAnswered++
+	lm.answering = true
+
+	if lm.deej.Verbose() {
+		lm.logger.Debugw("Got heartbeat", "sequence", sequence, "roundTripMs", roundTrip)
+	}
+}
+
+// reset starts counting afresh, for whatever connects next
+func (lm *linkMonitor) reset() {
+	lm.lock.Lock()
+	defer lm.lock.Unlock()
+
+	lm.health = linkHealth{SilenceReconnects: lm.health.SilenceReconnects}
+	lm.pending = map[int]time.Time{}
+	lm.lastPing = time.Time{}
+	lm.lastLine = time.Time{}
+	lm.answering = false
+}
+
+// SendHeartbeat pings the device, which answers with the same sequence number
+func (sio *SerialIO) SendHeartbeat(sequence int) error {
+	if !sio.isConnected() {
+		return errors.New("serial: not connected")
+	}
+
+	if err := sio.writeCommand(protocol.Heartbeat(sequence)); err != nil {
+		return fmt.Errorf("write heartbeat: %w", err)
+	}
+
+	return nil
+}
+
+// dropConnection closes the port out from under the reader, which then goes through the usual disconnect and
+// reconnect. it's for links that went quiet without the OS noticing
+func (sio *SerialIO) dropConnection() {
+	if conn := sio.port(); conn != nil {
+		if err := conn.Close(); err != nil {
+			sio.logger.Debugw("Failed to drop connection", "error", err)
+		}
+	}
+}
+
+// handleMetrics serves link health in the Prometheus text format, if metrics are enabled
+func (as *apiServer) handleMetrics(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !as.deej.config.API.Metrics {
+		http.NotFound(writer, request)
+		return
+	}
+
+	health := as.deej.link.current()
+
+	connected := 0
+	if health.Connected {
+		connected = 1
+	}
+
+	builder := strings.Builder{}
+	writeMetric := func(name string, kind string, help string, value float64) {
+		builder.WriteString(fmt.Sprintf("# HELP %s %s\n# TYPE %s %s\n%s %g\n", name, help, name, kind, name, value))
+	}
+
+	writeMetric("deej_link_connected", "gauge", "Whether a device is connected.", float64(connected))
+	writeMetric("deej_link_round_trip_seconds", "gauge", "The last heartbeat's round trip.",
+		health.RoundTripMs/1000)
+	writeMetric("deej_link_average_round_trip_seconds", "gauge", "The average heartbeat round trip.",
+		health.AverageRoundTripMs/1000)
+	writeMetric("deej_link_heartbeats_sent_total", "counter", "Heartbeats sent on this connection.",
+		float64(health.HeartbeatsSent))
+	writeMetric("deej_link_heartbeats_missed_total", "counter", "Heartbeats the device didn't answer on this connection.",
+		float64(health.MissedHeartbeats))
+	writeMetric("deej_link_line_errors_total", "counter", "Lines and frames dropped as garbled on this connection.",
+		float64(health.LineErrors))
+	writeMetric("deej_link_silence_reconnects_total", "counter", "Connections dropped for going silent.",
+		float64(health.SilenceReconnects))
+	writeMetric("deej_link_jitter_seconds", "gauge", "How unevenly timestamped lines arrive, on average.",
+		health.Latency.JitterMs/1000)
+	writeMetric("deej_link_jitter_buffer_seconds", "gauge", "How long timestamped lines are held back to even out jitter.",
+		health.Latency.BufferMs/1000)
+	writeMetric("deej_link_late_frames_total", "counter", "Timestamped lines that arrived after the jitter buffer's delay.",
+		float64(health.Latency.LateFrames))
+
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	if _, err := writer.Write([]byte(builder.String())); err != nil {
+		as.logger.Debugw("Failed to write metrics response", "error", err)
+	}
+}
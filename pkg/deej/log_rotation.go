@@ -0,0 +1,294 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	logFileSinkScheme = "deej-log"
+	logFileSinkURL    = logFileSinkScheme + ":"
+
+	// earlier runs' logs (and the current run's, once it grows past the size limit) are kept as these, named for
+	// when they were last written to
+	logHistoryPrefix          = "deej-run-"
+	logHistoryFilename        = logHistoryPrefix + "%s.log"
+	logHistoryTimestampFormat = "2006.01.02-15.04.05"
+
+	defaultLogFilesMaxSizeMB  = 10
+	defaultLogFilesKeep       = 5
+	defaultLogFilesMaxAgeDays = 30
+)
+
+// logFilesConfig holds how big the log file gets and how many earlier ones are kept, for release builds
+type logFilesConfig struct {
+	// 0 only starts a new file with every run
+	MaxSize int64
+
+	Keep int
+
+	// 0 keeps them however old they are
+	MaxAge time.Duration
+}
+
+// logFiles is the log file release builds write to (see newLogger). it starts out with the default limits, as the
+// logger's made before the config's loaded, and follows the config's from then on
+var (
+	logFiles = &rotatingLogFile{
+		path: filepath.Join(logDirectory, logFilename),
+		limits: logFilesConfig{
+			MaxSize: defaultLogFilesMaxSizeMB * 1024 * 1024,
+			Keep:    defaultLogFilesKeep,
+			MaxAge:  defaultLogFilesMaxAgeDays * 24 * time.Hour,
+		},
+	}
+
+	logFileSinkOnce sync.Once
+	logFileSinkErr  error
+)
+
+func registerLogFileSink() error {
+	logFileSinkOnce.Do(func() {
+		logFileSinkErr = zap.RegisterSink(logFileSinkScheme, func(*url.URL) (zap.Sink, error) {
+			if err := logFiles.open(); err != nil {
+				return nil, err
+			}
+
+			return logFiles, nil
+		})
+	})
+
+	return logFileSinkErr
+}
+
+// rotatingLogFile is a zap sink writing to deej-latest-run.log, which starts fresh with every run and whenever it
+// gets too big. the file it replaces goes into the history, which is trimmed to the newest few
+type rotatingLogFile struct {
+	path string
+
+	lock   sync.Mutex
+	limits logFilesConfig
+	file   *os.File
+	size   int64
+}
+
+// open moves the last run's log into the history and starts this run's
+func (rf *rotatingLogFile) open() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file != nil {
+		return nil
+	}
+
+	// not being able to keep the last run's log around is no reason not to log this one
+	if err := rf.rotate(); err != nil && rf.file == nil {
+		return err
+	}
+
+	return nil
+}
+
+// configure applies new limits, trimming the history right away if they're tighter
+func (rf *rotatingLogFile) configure(limits logFilesConfig) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	rf.limits = limits
+
+	if rf.file != nil {
+		rf.prune()
+	}
+}
+
+func (rf *rotatingLogFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.limits.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.limits.MaxSize {
+
+		// zap reports a failed write on stderr, which is all that can be done about it from in here
+		if err := rf.rotate(); err != nil && rf.file == nil {
+			return 0, err
+		}
+	}
+
+	if rf.file == nil {
+		return 0, fmt.Errorf("log file %s isn't open", rf.path)
+	}
+
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+
+	return n, err
+}
+
+func (rf *rotatingLogFile) Sync() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	return rf.file.Sync()
+}
+
+func (rf *rotatingLogFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+
+	if rf.file == nil {
+		return nil
+	}
+
+	err := rf.file.Close()
+	rf.file = nil
+
+	return err
+}
+
+// rotate moves the current file into the history and starts a new one. if it can't be moved, logging carries on
+// in it (with an error returned), and it gets another max size's worth before trying again
+func (rf *rotatingLogFile) rotate() error {
+	if rf.file != nil {
+		rf.file.Close()
+		rf.file = nil
+	}
+
+	archiveErr := archiveLogFile(rf.path)
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if archiveErr == nil {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(rf.path, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+
+	rf.file = file
+	rf.size = 0
+
+	rf.prune()
+
+	return archiveErr
+}
+
+// prune deletes the history's oldest files past the limits. it's best-effort, as there's nowhere to log to
+func (rf *rotatingLogFile) prune() {
+	entries, err := ioutil.ReadDir(filepath.Dir(rf.path))
+	if err != nil {
+		return
+	}
+
+	var history []os.FileInfo
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasPrefix(entry.Name(), logHistoryPrefix) && strings.HasSuffix(entry.Name(), ".log") {
+			history = append(history, entry)
+		}
+	}
+
+	// newest first
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].ModTime().After(history[j].ModTime())
+	})
+
+	for idx, entry := range history {
+		tooMany := idx >= rf.limits.Keep
+		tooOld := rf.limits.MaxAge > 0 && time.Since(entry.ModTime()) > rf.limits.MaxAge
+
+		if tooMany || tooOld {
+			os.Remove(filepath.Join(filepath.Dir(rf.path), entry.Name()))
+		}
+	}
+}
+
+// archiveLogFile renames the log file at path into the history, if there's anything in it
+func archiveLogFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("stat log file: %w", err)
+	}
+
+	if info.Size() == 0 {
+		return nil
+	}
+
+	// two rotations in the same second (a crash loop, say) each get their own file
+	timestamp := info.ModTime().Format(logHistoryTimestampFormat)
+
+	name := timestamp
+	for idx := 2; util.FileExists(filepath.Join(filepath.Dir(path), fmt.Sprintf(logHistoryFilename, name))); idx++ {
+		name = fmt.Sprintf("%s-%d", timestamp, idx)
+	}
+
+	archivePath := filepath.Join(filepath.Dir(path), fmt.Sprintf(logHistoryFilename, name))
+
+	if err := os.Rename(path, archivePath); err != nil {
+		return fmt.Errorf("move log file into history: %w", err)
+	}
+
+	return nil
+}
+
+// followLogFileLimits applies the config's log file limits now and whenever it's reloaded
+func (d *Deej) followLogFileLimits() {
+	logFiles.configure(d.config.LogFiles)
+
+	d.onConfigReload(func() {
+		logFiles.configure(d.config.LogFiles)
+	})
+}
+
+func (cc *CanonicalConfig) populateLogFiles() {
+	files := &cc.LogFiles
+
+	maxSizeMB := cc.userConfig.GetInt(configKeyLogFilesMaxSizeMB)
+	if maxSizeMB < 0 {
+		cc.logger.Warnw("Invalid log file size limit, using default",
+			"key", configKeyLogFilesMaxSizeMB,
+			"invalidValue", maxSizeMB,
+			"defaultValue", defaultLogFilesMaxSizeMB)
+
+		maxSizeMB = defaultLogFilesMaxSizeMB
+	}
+
+	files.MaxSize = int64(maxSizeMB) * 1024 * 1024
+
+	files.Keep = cc.userConfig.GetInt(configKeyLogFilesKeep)
+	if files.Keep < 0 {
+		cc.logger.Warnw("Invalid number of log files to keep, using default",
+			"key", configKeyLogFilesKeep,
+			"invalidValue", files.Keep,
+			"defaultValue", defaultLogFilesKeep)
+
+		files.Keep = defaultLogFilesKeep
+	}
+
+	maxAgeDays := cc.userConfig.GetInt(configKeyLogFilesMaxAgeDays)
+	if maxAgeDays < 0 {
+		cc.logger.Warnw("Invalid log file age limit, using default",
+			"key", configKeyLogFilesMaxAgeDays,
+			"invalidValue", maxAgeDays,
+			"defaultValue", defaultLogFilesMaxAgeDays)
+
+		maxAgeDays = defaultLogFilesMaxAgeDays
+	}
+
+	files.MaxAge = time.Duration(maxAgeDays) * 24 * time.Hour
+}
@@ -0,0 +1,520 @@
+package deej
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	logShippingSyslog = "syslog" // RFC 5424 syslog over UDP, a datagram per line
+	logShippingHTTP   = "http"   // batches of JSON lines POSTed to a URL (NDJSON)
+
+	defaultLogShippingProtocol     = logShippingSyslog
+	defaultLogShippingLevel        = "info"
+	defaultLogShippingBatchSize    = 50
+	defaultLogShippingFlushSeconds = 5
+
+	// lines past this many waiting (say, while the server's down) are dropped, oldest first
+	maxQueuedLogLines = 1000
+
+	logShippingRequestTimeout = 5 * time.Second
+
+	// syslog's "user-level messages" facility
+	syslogFacilityUser = 1
+
+	redactedLogValue = "[redacted]"
+
+	// the shipper's own logs stay local, or a server that's down would get told about it forever
+	logShipperName = "log-shipping"
+)
+
+// fields named like any of these are never shipped as they are, whatever the user's redact patterns
+var sensitiveLogFieldNames = []string{"token", "password", "secret", "apikey", "api_key", "authorization"}
+
+// logShippingConfig holds the user's remote log settings
+type logShippingConfig struct {
+	Enabled  bool
+	Protocol string
+
+	// host:port for syslog, a URL for http
+	Address string
+
+	Level         zapcore.Level
+	BatchSize     int
+	FlushInterval time.Duration
+
+	// how this PC names itself to the server, its hostname unless set
+	Hostname string
+
+	// patterns whose matches are replaced before lines leave the PC
+	Redact []*regexp.Regexp
+}
+
+// remoteLogs is where every logger (see newLogger) sends a copy of its entries, for the log shipper to pick up once
+// it's running. until then, and with shipping off, entries only go where they always did
+var remoteLogs = &remoteLogSwitch{}
+
+type remoteLogSwitch struct {
+	lock    sync.RWMutex
+	shipper *logShipper
+}
+
+func (rs *remoteLogSwitch) set(shipper *logShipper) {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+
+	rs.shipper = shipper
+}
+
+func (rs *remoteLogSwitch) current() *logShipper {
+	rs.lock.RLock()
+	defer rs.lock.RUnlock()
+
+	return rs.shipper
+}
+
+// remoteLogCore is the zap core that hands entries to whichever log shipper is running, if any
+type remoteLogCore struct {
+	logs   *remoteLogSwitch
+	fields []zapcore.Field
+}
+
+func (rc *remoteLogCore) Enabled(level zapcore.Level) bool {
+	shipper := rc.logs.current()
+	return shipper != nil && shipper.wants(level)
+}
+
+func (rc *remoteLogCore) With(fields []zapcore.Field) zapcore.Core {
+	combined := make([]zapcore.Field, 0, len(rc.fields)+len(fields))
+	combined = append(append(combined, rc.fields...), fields...)
+
+	return &remoteLogCore{logs: rc.logs, fields: combined}
+}
+
+func (rc *remoteLogCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if strings.HasSuffix(entry.LoggerName, logShipperName) || !rc.Enabled(entry.Level) {
+		return checked
+	}
+
+	return checked.AddCore(entry, rc)
+}
+
+func (rc *remoteLogCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if shipper := rc.logs.current(); shipper != nil {
+		combined := make([]zapcore.Field, 0, len(rc.fields)+len(fields))
+		shipper.ship(entry, append(append(combined, rc.fields...), fields...))
+	}
+
+	return nil
+}
+
+func (rc *remoteLogCore) Sync() error {
+	return nil
+}
+
+// logShipper sends deej's logs to a syslog server or an HTTP ingest endpoint, in batches, so that several PCs
+// running deej can be troubleshot from one place. lines are redacted before they're queued
+type logShipper struct {
+	deej       *Deej
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+
+	lock     sync.Mutex
+	running  bool
+	settings logShippingConfig
+	encoder  zapcore.Encoder
+	queued   []string
+	dropped  int
+
+	flushChannel chan bool
+	stopChannel  chan bool
+}
+
+func newLogShipper(deej *Deej, logger *zap.SugaredLogger) *logShipper {
+	logger = logger.Named(logShipperName)
+
+	ls := &logShipper{
+		deej:         deej,
+		logger:       logger,
+		httpClient:   &http.Client{Timeout: logShippingRequestTimeout},
+		flushChannel: make(chan bool, 1),
+		stopChannel:  make(chan bool),
+	}
+
+	logger.Debug("Created log shipper instance")
+
+	return ls
+}
+
+func (ls *logShipper) initialize() {
+	ls.deej.onConfigReload(func() {
+		ls.applyConfig()
+	})
+}
+
+// Start begins shipping logs, if the config says to
+func (ls *logShipper) Start() {
+	ls.lock.Lock()
+
+	if ls.running {
+		ls.lock.Unlock()
+		return
+	}
+
+	ls.running = true
+	ls.lock.Unlock()
+
+	ls.applyConfig()
+
+	go ls.flushLoop()
+}
+
+// Stop ships whatever's still waiting and stops taking new lines
+func (ls *logShipper) Stop() {
+	ls.lock.Lock()
+
+	if !ls.running {
+		ls.lock.Unlock()
+		return
+	}
+
+	ls.running = false
+	ls.lock.Unlock()
+
+	remoteLogs.set(nil)
+	ls.stopChannel <- true
+
+	ls.flush()
+}
+
+// applyConfig picks up the shipping settings, and starts or stops taking lines to match them
+func (ls *logShipper) applyConfig() {
+	settings := ls.deej.config.LogShipping
+
+	ls.lock.Lock()
+	ls.settings = settings
+	ls.encoder = newLogShippingEncoder(settings.Protocol)
+	running := ls.running
+	ls.lock.Unlock()
+
+	if !running || !settings.Enabled {
+		remoteLogs.set(nil)
+		return
+	}
+
+	remoteLogs.set(ls)
+
+	ls.logger.Infow("Shipping logs",
+		"protocol", settings.Protocol,
+		"address", settings.Address,
+		"level", settings.Level,
+		"hostname", settings.Hostname)
+}
+
+func newLogShippingEncoder(protocol string) zapcore.Encoder {
+	encoderConfig := zapcore.EncoderConfig{
+		MessageKey:     "msg",
+		NameKey:        "logger",
+		LineEnding:     zapcore.DefaultLineEnding,
+		EncodeLevel:    zapcore.LowercaseLevelEncoder,
+		EncodeTime:     zapcore.ISO8601TimeEncoder,
+		EncodeDuration: zapcore.StringDurationEncoder,
+		EncodeName:     zapcore.FullNameEncoder,
+	}
+
+	// syslog's header has the time and level already
+	if protocol == logShippingSyslog {
+		return zapcore.NewConsoleEncoder(encoderConfig)
+	}
+
+	encoderConfig.TimeKey = "ts"
+	encoderConfig.LevelKey = "level"
+
+	return zapcore.NewJSONEncoder(encoderConfig)
+}
+
+func (ls *logShipper) wants(level zapcore.Level) bool {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	return ls.running && ls.settings.Enabled && level >= ls.settings.Level
+}
+
+// ship redacts, formats and queues a log entry, flushing the queue early if that fills a batch
+func (ls *logShipper) ship(entry zapcore.Entry, fields []zapcore.Field) {
+	ls.lock.Lock()
+	settings := ls.settings
+	encoder := ls.encoder
+	ls.lock.Unlock()
+
+	for idx, field := range fields {
+		if sensitiveLogField(field.Key) {
+			fields[idx] = zap.String(field.Key, redactedLogValue)
+		}
+	}
+
+	if settings.Protocol == logShippingHTTP {
+		fields = append(fields, zap.String("host", settings.Hostname))
+	}
+
+	encoded, err := encoder.EncodeEntry(entry, fields)
+	if err != nil {
+		return
+	}
+
+	line := redactLogLine(strings.TrimRight(encoded.String(), "\n"), settings.Redact)
+	encoded.Free()
+
+	if settings.Protocol == logShippingSyslog {
+		line = syslogLine(entry, settings.Hostname, line)
+	}
+
+	ls.lock.Lock()
+	ls.queueLocked([]string{line})
+	full := len(ls.queued) >= settings.BatchSize
+	ls.lock.Unlock()
+
+	if full {
+		select {
+		case ls.flushChannel <- true:
+		default:
+		}
+	}
+}
+
+// queueLocked adds lines to the end of the queue, dropping the oldest ones past the limit
+func (ls *logShipper) queueLocked(lines []string) {
+	ls.queued = append(ls.queued, lines...)
+
+	if overflow := len(ls.queued) - maxQueuedLogLines; overflow > 0 {
+		ls.queued = ls.queued[overflow:]
+		ls.dropped += overflow
+	}
+}
+
+func (ls *logShipper) flushLoop() {
+	for {
+		ls.lock.Lock()
+		interval := ls.settings.FlushInterval
+		ls.lock.Unlock()
+
+		select {
+		case <-ls.stopChannel:
+			return
+		case <-ls.flushChannel:
+		case <-time.After(interval):
+		}
+
+		ls.flush()
+	}
+}
+
+// flush sends everything that's queued. a batch that can't be sent goes back to wait for the next flush
+func (ls *logShipper) flush() {
+	ls.lock.Lock()
+	settings := ls.settings
+	lines := ls.queued
+	dropped := ls.dropped
+	ls.queued = nil
+	ls.dropped = 0
+	ls.lock.Unlock()
+
+	if len(lines) == 0 || !settings.Enabled {
+		return
+	}
+
+	if err := ls.send(settings, lines); err != nil {
+		ls.logger.Warnw("Failed to ship logs, will retry", "lines", len(lines), "address", settings.Address, "error", err)
+
+		ls.lock.Lock()
+		ls.queued, lines = lines, ls.queued
+		ls.dropped += dropped
+		ls.queueLocked(lines)
+		ls.lock.Unlock()
+
+		return
+	}
+
+	if dropped > 0 {
+		ls.logger.Warnw("Dropped logs that couldn't be shipped in time", "lines", dropped)
+	}
+
+	if ls.deej.Verbose() {
+		ls.logger.Debugw("Shipped logs", "lines", len(lines))
+	}
+}
+
+func (ls *logShipper) send(settings logShippingConfig, lines []string) error {
+	if settings.Protocol == logShippingSyslog {
+		connection, err := net.DialTimeout("udp", settings.Address, logShippingRequestTimeout)
+		if err != nil {
+			return fmt.Errorf("dial syslog server: %w", err)
+		}
+
+		defer connection.Close()
+
+		for _, line := range lines {
+			if _, err := connection.Write([]byte(line)); err != nil {
+				return fmt.Errorf("write syslog message: %w", err)
+			}
+		}
+
+		return nil
+	}
+
+	body := strings.Join(lines, "\n") + "\n"
+
+	response, err := ls.httpClient.Post(settings.Address, "application/x-ndjson", strings.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("post logs: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("post logs: unexpected status %s", response.Status)
+	}
+
+	return nil
+}
+
+// syslogLine wraps a line in an RFC 5424 header
+func syslogLine(entry zapcore.Entry, hostname string, line string) string {
+	severity := 6 // informational
+	switch {
+	case entry.Level >= zapcore.ErrorLevel:
+		severity = 3
+	case entry.Level == zapcore.WarnLevel:
+		severity = 4
+	case entry.Level == zapcore.DebugLevel:
+		severity = 7
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s deej %d - - %s",
+		syslogFacilityUser*8+severity,
+		entry.Time.Format("2006-01-02T15:04:05.000Z07:00"),
+		hostname,
+		os.Getpid(),
+		line)
+}
+
+func sensitiveLogField(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, name := range sensitiveLogFieldNames {
+		if strings.Contains(key, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactLogLine replaces the user's home directory (which usually has their name in it) with ~, and whatever the
+// redact patterns match with a placeholder
+func redactLogLine(line string, patterns []*regexp.Regexp) string {
+	if home, err := os.UserHomeDir(); err == nil && len(home) > 1 {
+		line = strings.Replace(line, home, "~", -1)
+	}
+
+	for _, pattern := range patterns {
+		line = pattern.ReplaceAllString(line, redactedLogValue)
+	}
+
+	return line
+}
+
+func (cc *CanonicalConfig) populateLogShipping() {
+	shipping := &cc.LogShipping
+
+	shipping.Enabled = cc.userConfig.GetBool(configKeyLogShippingEnabled)
+	shipping.Address = strings.TrimSpace(cc.userConfig.GetString(configKeyLogShippingAddress))
+
+	shipping.Protocol = strings.ToLower(cc.userConfig.GetString(configKeyLogShippingProtocol))
+	if shipping.Protocol != logShippingSyslog && shipping.Protocol != logShippingHTTP {
+		cc.logger.Warnw("Invalid log shipping protocol, using default",
+			"key", configKeyLogShippingProtocol,
+			"invalidValue", shipping.Protocol,
+			"defaultValue", defaultLogShippingProtocol)
+
+		shipping.Protocol = defaultLogShippingProtocol
+	}
+
+	level := cc.userConfig.GetString(configKeyLogShippingLevel)
+	if err := shipping.Level.UnmarshalText([]byte(level)); err != nil {
+		cc.logger.Warnw("Invalid log shipping level, using default",
+			"key", configKeyLogShippingLevel,
+			"invalidValue", level,
+			"defaultValue", defaultLogShippingLevel)
+
+		shipping.Level = zapcore.InfoLevel
+	}
+
+	shipping.BatchSize = cc.userConfig.GetInt(configKeyLogShippingBatchSize)
+	if shipping.BatchSize <= 0 || shipping.BatchSize > maxQueuedLogLines {
+		cc.logger.Warnw("Invalid log shipping batch size, using default",
+			"key", configKeyLogShippingBatchSize,
+			"invalidValue", shipping.BatchSize,
+			"defaultValue", defaultLogShippingBatchSize)
+
+		shipping.BatchSize = defaultLogShippingBatchSize
+	}
+
+	flushSeconds := cc.userConfig.GetInt(configKeyLogShippingFlushSeconds)
+	if flushSeconds <= 0 {
+		cc.logger.Warnw("Invalid log shipping flush interval, using default",
+			"key", configKeyLogShippingFlushSeconds,
+			"invalidValue", flushSeconds,
+			"defaultValue", defaultLogShippingFlushSeconds)
+
+		flushSeconds = defaultLogShippingFlushSeconds
+	}
+
+	shipping.FlushInterval = time.Duration(flushSeconds) * time.Second
+
+	shipping.Hostname = cc.userConfig.GetString(configKeyLogShippingHostname)
+	if shipping.Hostname == "" {
+		shipping.Hostname, _ = os.Hostname()
+	}
+
+	// syslog takes no spaces in the hostname, and "-" for none
+	shipping.Hostname = strings.Replace(strings.TrimSpace(shipping.Hostname), " ", "-", -1)
+	if shipping.Hostname == "" {
+		shipping.Hostname = "-"
+	}
+
+	shipping.Redact = nil
+	for _, rawPattern := range cc.userConfig.GetStringSlice(configKeyLogShippingRedact) {
+		pattern, err := regexp.Compile(rawPattern)
+		if err != nil {
+			cc.logger.Warnw("Ignoring invalid log redaction pattern", "pattern", rawPattern, "error", err)
+			continue
+		}
+
+		shipping.Redact = append(shipping.Redact, pattern)
+	}
+
+	if shipping.Enabled && shipping.Address == "" {
+		cc.logger.Warnw("Log shipping is enabled without an address, leaving it off", "key", configKeyLogShippingAddress)
+		shipping.Enabled = false
+	}
+
+	if shipping.Enabled && shipping.Protocol == logShippingHTTP &&
+		!(strings.HasPrefix(shipping.Address, "http://") || strings.HasPrefix(shipping.Address, "https://")) {
+
+		cc.logger.Warnw("Log shipping over http needs an http or https URL, leaving it off",
+			"key", configKeyLogShippingAddress,
+			"invalidValue", shipping.Address)
+
+		shipping.Enabled = false
+	}
+}
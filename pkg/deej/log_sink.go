@@ -0,0 +1,129 @@
+package deej
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// --log-sink sends every log entry, as it's logged, to whatever's listening at tcp://host:port (one per line) or
+// udp://host:port (one per datagram) - for tools that ingest logs, with --log-format=json. unlike log shipping (see
+// log_shipping.go) nothing's batched, redacted or kept for later: entries logged while the other end is down are
+// dropped, so a sink that's gone can't hold deej up
+
+const (
+	networkLogSinkDialTimeout  = time.Second
+	networkLogSinkWriteTimeout = time.Second
+
+	// how long a sink that couldn't be reached is left alone before trying again
+	networkLogSinkRetryDelay = 5 * time.Second
+)
+
+var (
+	networkLogSinkSchemes = []string{"tcp", "udp"}
+
+	networkLogSinkOnce sync.Once
+	networkLogSinkErr  error
+)
+
+func registerNetworkLogSinks() error {
+	networkLogSinkOnce.Do(func() {
+		for _, scheme := range networkLogSinkSchemes {
+			if err := zap.RegisterSink(scheme, newNetworkLogSink); err != nil {
+				networkLogSinkErr = err
+				return
+			}
+		}
+	})
+
+	return networkLogSinkErr
+}
+
+// validateNetworkLogSink checks a --log-sink URL before zap gets it, which says less about what's wrong with one
+func validateNetworkLogSink(sink string) error {
+	parsed, err := url.Parse(sink)
+	if err != nil {
+		return fmt.Errorf("parse log sink %q: %w", sink, err)
+	}
+
+	if parsed.Scheme != "tcp" && parsed.Scheme != "udp" {
+		return fmt.Errorf("log sink %q should start with tcp:// or udp://", sink)
+	}
+
+	if _, _, err := net.SplitHostPort(parsed.Host); err != nil {
+		return fmt.Errorf("log sink %q should be tcp://host:port or udp://host:port: %w", sink, err)
+	}
+
+	return nil
+}
+
+// networkLogSink is a zap sink writing to a TCP or UDP address, connecting on the first write (and again after
+// losing the connection)
+type networkLogSink struct {
+	network string
+	address string
+
+	lock    sync.Mutex
+	conn    net.Conn
+	retryAt time.Time
+}
+
+func newNetworkLogSink(sinkURL *url.URL) (zap.Sink, error) {
+	return &networkLogSink{network: sinkURL.Scheme, address: sinkURL.Host}, nil
+}
+
+func (ns *networkLogSink) Write(p []byte) (int, error) {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if ns.conn == nil {
+		if time.Now().Before(ns.retryAt) {
+			return len(p), nil
+		}
+
+		conn, err := net.DialTimeout(ns.network, ns.address, networkLogSinkDialTimeout)
+		if err != nil {
+			ns.retryAt = time.Now().Add(networkLogSinkRetryDelay)
+
+			// zap reports this on stderr, once per retry rather than for every entry dropped in between
+			return 0, fmt.Errorf("connect to log sink %s://%s: %w", ns.network, ns.address, err)
+		}
+
+		ns.conn = conn
+	}
+
+	ns.conn.SetWriteDeadline(time.Now().Add(networkLogSinkWriteTimeout))
+
+	n, err := ns.conn.Write(p)
+	if err != nil {
+		ns.conn.Close()
+		ns.conn = nil
+		ns.retryAt = time.Now().Add(networkLogSinkRetryDelay)
+
+		return n, fmt.Errorf("write to log sink %s://%s: %w", ns.network, ns.address, err)
+	}
+
+	return n, nil
+}
+
+func (ns *networkLogSink) Sync() error {
+	return nil
+}
+
+func (ns *networkLogSink) Close() error {
+	ns.lock.Lock()
+	defer ns.lock.Unlock()
+
+	if ns.conn == nil {
+		return nil
+	}
+
+	err := ns.conn.Close()
+	ns.conn = nil
+
+	return err
+}
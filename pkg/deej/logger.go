@@ -2,7 +2,6 @@ package deej
 
 import (
 	"fmt"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -18,6 +17,10 @@ const (
 
 	logDirectory = "logs"
 	logFilename  = "deej-latest-run.log"
+
+	// LogFormatConsole is for reading, LogFormatJSON is for tools to ingest
+	LogFormatConsole = "console"
+	LogFormatJSON    = "json"
 )
 
 // filterCore wraps a zapcore.Core to filter log entries by logger name.
@@ -48,25 +51,59 @@ func (f *filterCore) With(fields []zapcore.Field) zapcore.Core {
 	}
 }
 
+// LoggerOptions are the ways a logger can differ from the build type's default one
+type LoggerOptions struct {
+	// only log entries from loggers whose name contains this, if set
+	Filter string
+
+	// log into the terminal UI (see tui.go) instead of over it once the UI is showing
+	TUI bool
+
+	// LogFormatConsole (the default) or LogFormatJSON, for tools to read
+	Format string
+
+	// also send every entry to tcp://host:port or udp://host:port, if set (see log_sink.go)
+	Sink string
+}
+
 // NewLogger provides a logger instance for the whole program.
 func NewLogger(buildType string) (*zap.SugaredLogger, error) {
-	return NewLoggerWithFilter(buildType, "")
+	return NewLoggerWithOptions(buildType, LoggerOptions{})
 }
 
 // NewLoggerWithFilter provides a logger with optional name filtering.
 // When logFilter is non-empty, only log entries from loggers whose name
 // contains the filter string will be output.
 func NewLoggerWithFilter(buildType string, logFilter string) (*zap.SugaredLogger, error) {
+	return NewLoggerWithOptions(buildType, LoggerOptions{Filter: logFilter})
+}
+
+// NewTUILogger provides a logger like NewLoggerWithFilter, but one that logs into the terminal UI (see tui.go)
+// instead of over it once the UI is showing
+func NewTUILogger(buildType string, logFilter string) (*zap.SugaredLogger, error) {
+	return NewLoggerWithOptions(buildType, LoggerOptions{Filter: logFilter, TUI: true})
+}
+
+// NewLoggerWithOptions provides a logger for the given build type, with any of the options set
+func NewLoggerWithOptions(buildType string, options LoggerOptions) (*zap.SugaredLogger, error) {
+	return newLogger(buildType, options)
+}
+
+func newLogger(buildType string, options LoggerOptions) (*zap.SugaredLogger, error) {
 	var loggerConfig zap.Config
 
-	// release: info and above, log to file only (no UI)
+	// release: info and above, log to file only (no UI), starting a new one each run (see log_rotation.go)
 	if buildType == buildTypeRelease {
 		if err := util.EnsureDirExists(logDirectory); err != nil {
 			return nil, fmt.Errorf("ensure log directory exists: %w", err)
 		}
 
+		if err := registerLogFileSink(); err != nil {
+			return nil, fmt.Errorf("register log file sink: %w", err)
+		}
+
 		loggerConfig = zap.NewProductionConfig()
-		loggerConfig.OutputPaths = []string{filepath.Join(logDirectory, logFilename)}
+		loggerConfig.OutputPaths = []string{logFileSinkURL}
 		loggerConfig.Encoding = "console"
 	} else {
 		// development: debug and above, log to stderr only, colorful
@@ -74,13 +111,55 @@ func NewLoggerWithFilter(buildType string, logFilter string) (*zap.SugaredLogger
 		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
 	}
 
-	// all build types: make it readable
-	loggerConfig.EncoderConfig.EncodeCaller = nil
-	loggerConfig.EncoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
-		enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
+	// the terminal UI shows the logs itself, cut to fit, which colors would get in the way of
+	if options.TUI {
+		if err := registerTUILogSink(); err != nil {
+			return nil, fmt.Errorf("register terminal UI log sink: %w", err)
+		}
+
+		if buildType != buildTypeRelease {
+			loggerConfig.OutputPaths = nil
+		}
+
+		loggerConfig.OutputPaths = append(loggerConfig.OutputPaths, tuiLogSinkURL)
+		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+	}
+
+	if options.Sink != "" {
+		if err := registerNetworkLogSinks(); err != nil {
+			return nil, fmt.Errorf("register network log sinks: %w", err)
+		}
+
+		if err := validateNetworkLogSink(options.Sink); err != nil {
+			return nil, err
+		}
+
+		// whatever's on the other end doesn't want terminal colors either
+		loggerConfig.OutputPaths = append(loggerConfig.OutputPaths, options.Sink)
+		loggerConfig.EncoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
 	}
-	loggerConfig.EncoderConfig.EncodeName = func(s string, enc zapcore.PrimitiveArrayEncoder) {
-		enc.AppendString(fmt.Sprintf("%-27s", s))
+
+	switch options.Format {
+
+	// all build types: make it readable
+	case "", LogFormatConsole:
+		loggerConfig.EncoderConfig.EncodeCaller = nil
+		loggerConfig.EncoderConfig.EncodeTime = func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(t.Format("2006-01-02 15:04:05.000"))
+		}
+		loggerConfig.EncoderConfig.EncodeName = func(s string, enc zapcore.PrimitiveArrayEncoder) {
+			enc.AppendString(fmt.Sprintf("%-27s", s))
+		}
+
+	// or easy to parse, with timestamps that say which time zone they're in and nothing lined up or colored
+	case LogFormatJSON:
+		loggerConfig.Encoding = "json"
+		loggerConfig.EncoderConfig = zap.NewProductionEncoderConfig()
+		loggerConfig.EncoderConfig.CallerKey = zapcore.OmitKey
+		loggerConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	default:
+		return nil, fmt.Errorf("unknown log format %q, use %s or %s", options.Format, LogFormatConsole, LogFormatJSON)
 	}
 
 	logger, err := loggerConfig.Build()
@@ -89,11 +168,17 @@ func NewLoggerWithFilter(buildType string, logFilter string) (*zap.SugaredLogger
 	}
 
 	// Apply log filter if specified
-	if logFilter != "" {
+	if options.Filter != "" {
 		logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
-			return &filterCore{Core: c, filter: logFilter}
+			return &filterCore{Core: c, filter: options.Filter}
 		}))
 	}
 
+	// send a copy of everything to the log shipper, once there is one (see log_shipping.go). this goes around the
+	// filter, which is only there to make the terminal readable
+	logger = logger.WithOptions(zap.WrapCore(func(c zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(c, &remoteLogCore{logs: remoteLogs})
+	}))
+
 	return logger.Sugar(), nil
 }
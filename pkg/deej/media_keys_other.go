@@ -0,0 +1,45 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// media keys are only simulated on windows for now. elsewhere, media buttons just say so
+const mediaKeysSupported = false
+
+// MediaController handles media key simulation
+type MediaController struct {
+	logger *zap.SugaredLogger
+}
+
+// NewMediaController creates a new MediaController
+func NewMediaController(logger *zap.SugaredLogger) *MediaController {
+	return &MediaController{
+		logger: logger.Named("media"),
+	}
+}
+
+// PlayPause simulates pressing the play/pause media key
+func (mc *MediaController) PlayPause() error {
+	return mc.unsupported("play/pause")
+}
+
+// NextTrack simulates pressing the next track media key
+func (mc *MediaController) NextTrack() error {
+	return mc.unsupported("next track")
+}
+
+// PrevTrack simulates pressing the previous track media key
+func (mc *MediaController) PrevTrack() error {
+	return mc.unsupported("previous track")
+}
+
+func (mc *MediaController) unsupported(key string) error {
+	mc.logger.Warnw("Can't simulate media key press", "key", key, "error", util.ErrNotSupported)
+	return util.ErrNotSupported
+}
@@ -12,6 +12,9 @@ var (
 	procSendInput = user32.NewProc("SendInput")
 )
 
+// see media_keys_other.go
+const mediaKeysSupported = true
+
 const (
 	INPUT_KEYBOARD      = 1
 	KEYEVENTF_KEYUP     = 0x0002
@@ -0,0 +1,117 @@
+package deej
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultMeterTailRate = 10
+
+	meterTailBarWidth = 30
+)
+
+// ShowMeter draws a VU bar per slider from the deej instance running on this machine, found through its local API,
+// redrawing them in place as the levels change. it's for checking what audio-mode LEDs should be doing (e.g. with
+// --simulate) without a device to look at, and runs until deej stops or the process is interrupted
+func ShowMeter(logger *zap.SugaredLogger, out io.Writer, rate float64, sliders string) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	if rate <= 0 {
+		rate = defaultMeterTailRate
+	}
+
+	address := fmt.Sprintf("%s%s?rate=%s", apiAddress, apiPathMeter, strconv.FormatFloat(rate, 'f', -1, 64))
+	if sliders != "" {
+		address += "&sliders=" + sliders
+	}
+
+	// the stream stays open for as long as deej does, so there's no timeout
+	response, err := http.Get(address)
+	if err != nil {
+		return fmt.Errorf("get meter (is deej running?): %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("get meter: unexpected status %s %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	// the first reading goes over this line
+	fmt.Fprintln(out, "Waiting for audio levels (Ctrl+C to stop)")
+	drawnLines := 1
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+
+		reading := map[string]meterEntry{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &reading); err != nil {
+			return fmt.Errorf("decode meter reading: %w", err)
+		}
+
+		drawnLines = drawMeterReading(out, reading, drawnLines)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read meter: %w", err)
+	}
+
+	fmt.Fprintln(out, "deej stopped")
+
+	return nil
+}
+
+// drawMeterReading draws over the last reading's lines with this one's, returning how many it drew
+func drawMeterReading(out io.Writer, reading map[string]meterEntry, drawnLines int) int {
+	sliderIDs := make([]int, 0, len(reading))
+	for key := range reading {
+		if sliderID, err := strconv.Atoi(key); err == nil {
+			sliderIDs = append(sliderIDs, sliderID)
+		}
+	}
+
+	sort.Ints(sliderIDs)
+
+	var frame strings.Builder
+
+	if drawnLines > 0 {
+		fmt.Fprintf(&frame, "\x1b[%dA\r", drawnLines)
+	}
+
+	for _, sliderID := range sliderIDs {
+		entry := reading[strconv.Itoa(sliderID)]
+
+		volume := fmt.Sprintf("%3d%%", entry.Volume)
+		if entry.Muted {
+			volume = "muted"
+		}
+
+		fmt.Fprintf(&frame, "Slider %-2d [%s] %3d  %5s  %s\x1b[K\n",
+			sliderID, tuiBar(float32(entry.Peak)/100, meterTailBarWidth, '|', ' '), entry.Peak, volume, entry.App)
+	}
+
+	// a reading with fewer sliders than the last leaves lines to clear below it
+	frame.WriteString("\x1b[J")
+
+	io.WriteString(out, frame.String())
+
+	return len(sliderIDs)
+}
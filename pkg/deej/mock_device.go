@@ -0,0 +1,250 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	transportSerial = "serial"
+	transportMock   = "mock"
+
+	mockDeviceName = "mock"
+
+	// roughly how often real firmware sends slider values
+	mockLineInterval = 20 * time.Millisecond
+
+	// how far a moving slider goes per line, on the firmware's 0-1023 scale
+	mockSliderStep = 8
+
+	// chances per line of a resting slider starting to move somewhere new, and of a button being pressed
+	mockMoveChance  = 0.005
+	mockPressChance = 0.002
+
+	// how long a simulated button press is held for
+	mockPressDuration = 150 * time.Millisecond
+)
+
+// mockDevice stands in for a deej board, for working on deej without one (--simulate, or transport: mock).
+// it moves its sliders around and presses its buttons now and then, answers the handshake and heartbeats like
+// firmware would, and logs everything deej sends it (LEDs, display pages and so on). it has as many sliders and
+// buttons as the config maps
+type mockDevice struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+}
+
+func newMockDevice(deej *Deej, logger *zap.SugaredLogger) *mockDevice {
+	return &mockDevice{
+		deej:   deej,
+		logger: logger.Named("mock"),
+	}
+}
+
+// Name is what the mock device shows up as instead of a port name
+func (md *mockDevice) Name() string {
+	return mockDeviceName
+}
+
+// Open starts a simulated connection
+func (md *mockDevice) Open() (io.ReadWriteCloser, error) {
+	numSliders, numButtons := md.layout()
+
+	reader, writer := io.Pipe()
+
+	conn := &mockConn{
+		device:      md,
+		reader:      reader,
+		writer:      writer,
+		replies:     make(chan string, 16),
+		stopChannel: make(chan bool),
+		values:      make([]int, numSliders),
+		targets:     make([]int, numSliders),
+		numButtons:  numButtons,
+		random:      rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+
+	// start out somewhere in the middle, like sliders someone left where they were
+	for sliderIdx := range conn.values {
+		conn.values[sliderIdx] = conn.random.Intn(1024)
+		conn.targets[sliderIdx] = conn.values[sliderIdx]
+	}
+
+	md.logger.Infow("Simulating device", "sliders", numSliders, "buttons", numButtons)
+
+	go conn.run()
+
+	return conn, nil
+}
+
+// layout works out how many sliders and buttons to simulate from what the config maps to them
+func (md *mockDevice) layout() (int, int) {
+	numSliders, numButtons := 1, 0
+
+	md.deej.config.SliderMapping.iterate(func(sliderID int, _ []string) {
+		if _, virtual := md.deej.config.VirtualSliders[sliderID]; !virtual && sliderID >= numSliders {
+			numSliders = sliderID + 1
+		}
+	})
+
+	md.deej.config.ButtonMapping.iterate(func(buttonID int, _ buttonBinding) {
+		if buttonID >= numButtons {
+			numButtons = buttonID + 1
+		}
+	})
+
+	return numSliders, numButtons
+}
+
+// simulatingDevice returns whether to connect to the mock device instead of a real one
+func (d *Deej) simulatingDevice() bool {
+	return d.simulate || d.config.ConnectionInfo.Transport == transportMock
+}
+
+// mockConn is a connection to the mock device. what it "sends" comes out of a pipe that deej reads from
+type mockConn struct {
+	device *mockDevice
+
+	reader *io.PipeReader
+	writer *io.PipeWriter
+
+	// lines answering what deej sent, to go out between slider values
+	replies chan string
+
+	stopChannel chan bool
+	stopOnce    sync.Once
+
+	values     []int
+	targets    []int
+	numButtons int
+
+	random *rand.Rand
+}
+
+func (mc *mockConn) Read(p []byte) (int, error) {
+	return mc.reader.Read(p)
+}
+
+// Write takes frames from deej, logging them and answering the ones firmware would
+func (mc *mockConn) Write(p []byte) (int, error) {
+	for _, frame := range strings.Split(strings.TrimRight(string(p), "\r\n"), "\n") {
+		frame = strings.TrimSpace(frame)
+		if frame == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(frame, heartbeatPrefix):
+			mc.device.logger.Debugw("Device received", "frame", frame)
+			mc.reply(frame)
+			continue
+
+		case strings.HasPrefix(frame, "#HELLO"):
+			mc.reply(fmt.Sprintf("%sproto=%d,fw=%s,sliders=%d,buttons=%d",
+				deviceHelloPrefix, protocol.Version, mockDeviceName, len(mc.values), mc.numButtons))
+
+		case frame == strings.TrimSpace(protocol.IdentityRequest()):
+			mc.reply(deviceIdentityPrefix + mockDeviceName)
+		}
+
+		mc.device.logger.Infow("Device received", "frame", frame)
+	}
+
+	return len(p), nil
+}
+
+// Close ends the simulated connection, which deej sees as the device going away
+func (mc *mockConn) Close() error {
+	mc.stopOnce.Do(func() {
+		close(mc.stopChannel)
+		mc.writer.CloseWithError(io.EOF)
+	})
+
+	return nil
+}
+
+func (mc *mockConn) reply(line string) {
+	select {
+	case mc.replies <- line:
+	default:
+		mc.device.logger.Debugw("Too many replies queued, dropping one", "line", line)
+	}
+}
+
+func (mc *mockConn) run() {
+	ticker := time.NewTicker(mockLineInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mc.stopChannel:
+			return
+
+		case line := <-mc.replies:
+			mc.send(line)
+
+		case <-ticker.C:
+			mc.moveSliders()
+			mc.send(mc.sliderLine())
+
+			if mc.numButtons > 0 && mc.random.Float64() < mockPressChance {
+				go mc.pressButton(mc.random.Intn(mc.numButtons))
+			}
+		}
+	}
+}
+
+// moveSliders brings every moving slider a step closer to where it's going, and starts resting ones moving
+func (mc *mockConn) moveSliders() {
+	for sliderIdx, value := range mc.values {
+		target := mc.targets[sliderIdx]
+
+		switch {
+		case value < target:
+			value += mockSliderStep
+			if value > target {
+				value = target
+			}
+		case value > target:
+			value -= mockSliderStep
+			if value < target {
+				value = target
+			}
+		case mc.random.Float64() < mockMoveChance:
+			mc.targets[sliderIdx] = mc.random.Intn(1024)
+		}
+
+		mc.values[sliderIdx] = value
+	}
+}
+
+func (mc *mockConn) sliderLine() string {
+	values := make([]string, len(mc.values))
+	for sliderIdx, value := range mc.values {
+		values[sliderIdx] = strconv.Itoa(value)
+	}
+
+	return strings.Join(values, "|")
+}
+
+func (mc *mockConn) pressButton(buttonID int) {
+	mc.device.logger.Infow("Pressing button", "buttonID", buttonID)
+
+	mc.reply(fmt.Sprintf("#B%d:1", buttonID))
+	<-time.After(mockPressDuration)
+	mc.reply(fmt.Sprintf("#B%d:0", buttonID))
+}
+
+// send writes a line the way firmware does, giving up quietly if the connection was closed meanwhile
+func (mc *mockConn) send(line string) {
+	mc.writer.Write([]byte(line + "\r\n"))
+}
@@ -0,0 +1,91 @@
+package deej
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// how long each connection attempt waits for a device to connect over the network, before moving on
+// to the next connection in line. devices that connect in between wait in the listener's backlog
+const networkAcceptTimeout = 2 * time.Second
+
+// openListener waits for a device to connect to deej over the network (like an ESP-based mixer on Wi-Fi).
+// the listener stays open between attempts, so a device can connect while deej is trying something else.
+// anyone on the network can connect, so only a paired device's sealed frames are listened to (see trustedLine)
+func (sio *SerialIO) openListener(device deviceConnection) error {
+	sio.deviceName = device.Name
+	sio.wantedIdentity = device.ID
+	sio.deviceIdentity = ""
+
+	listener, err := sio.networkListener(device.Listen)
+	if err != nil {
+		sio.logger.Warnw("Failed to listen for network devices", "address", device.Listen, "error", err)
+		return fmt.Errorf("open network connection: %w", err)
+	}
+
+	sio.logger.Debugw("Waiting for a network device to connect", "device", device.Name, "address", device.Listen)
+
+	if err := listener.SetDeadline(time.Now().Add(networkAcceptTimeout)); err != nil {
+		return fmt.Errorf("open network connection: %w", err)
+	}
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("open network connection: no device connected to %s: %w", device.Listen, err)
+	}
+
+	sio.comPort = "tcp://" + conn.RemoteAddr().String()
+	sio.link = linkNetwork
+	sio.setPort(&transportPort{conn})
+
+	return nil
+}
+
+// networkListener returns the listener for the given address, opening it the first time
+func (sio *SerialIO) networkListener(address string) (*net.TCPListener, error) {
+	if listener, ok := sio.listeners[address]; ok {
+		return listener, nil
+	}
+
+	tcpAddress, err := net.ResolveTCPAddr("tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("resolve listen address: %w", err)
+	}
+
+	listener, err := net.ListenTCP("tcp", tcpAddress)
+	if err != nil {
+		return nil, fmt.Errorf("listen: %w", err)
+	}
+
+	sio.logger.Infow("Listening for network devices", "address", listener.Addr())
+
+	if sio.listeners == nil {
+		sio.listeners = map[string]*net.TCPListener{}
+	}
+
+	sio.listeners[address] = listener
+
+	return listener, nil
+}
+
+// closeUnusedListeners stops listening on addresses no connection uses anymore
+func (sio *SerialIO) closeUnusedListeners(candidates []deviceConnection) {
+	for address, listener := range sio.listeners {
+		used := false
+		for _, candidate := range candidates {
+			used = used || candidate.Listen == address
+		}
+
+		if used {
+			continue
+		}
+
+		if err := listener.Close(); err != nil {
+			sio.logger.Debugw("Failed to close network listener", "address", address, "error", err)
+		}
+
+		delete(sio.listeners, address)
+		sio.logger.Infow("Stopped listening for network devices", "address", address)
+	}
+}
@@ -0,0 +1,174 @@
+package deej
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	notRunningIgnore   = "ignore"   // drop the move (the default, and what deej always used to do)
+	notRunningQueue    = "queue"    // remember the volume and apply it once the app shows up
+	notRunningFallback = "fallback" // move another target instead, until the app shows up
+
+	// how often to look for apps with a queued volume. refreshes can't happen more often than this anyway
+	notRunningQueueCheckInterval = minTimeBetweenSessionRefreshes
+)
+
+// notRunningRule says what a slider move does to a target whose app isn't running
+type notRunningRule struct {
+	Action   string
+	Fallback string
+}
+
+// notRunningRuleFromConfig reads a target's rule, which is either an action name or an object
+// naming a fallback target (e.g. {fallback: master})
+func notRunningRuleFromConfig(value interface{}) (notRunningRule, error) {
+	if fields, ok := toStringMap(value); ok {
+		fallback := strings.TrimSpace(fmt.Sprint(fields["fallback"]))
+		if fields["fallback"] == nil || fallback == "" {
+			return notRunningRule{}, fmt.Errorf("expected a fallback target, got %v", value)
+		}
+
+		return notRunningRule{Action: notRunningFallback, Fallback: normalizeTarget(fallback)}, nil
+	}
+
+	action := strings.ToLower(fmt.Sprint(value))
+
+	switch action {
+	case notRunningIgnore, notRunningQueue:
+		return notRunningRule{Action: action}, nil
+	case notRunningFallback:
+		return notRunningRule{}, fmt.Errorf("fallback needs a target, i.e. {fallback: master}")
+	}
+
+	return notRunningRule{}, fmt.Errorf("unknown action %q", action)
+}
+
+// notRunningRule returns the rule for the given target, ignoring its moves if it has none
+func (cc *CanonicalConfig) notRunningRule(target string) notRunningRule {
+	if rule, ok := cc.NotRunning[strings.ToLower(target)]; ok {
+		return rule
+	}
+
+	return notRunningRule{Action: notRunningIgnore}
+}
+
+// handleTargetNotRunning applies a slider move to a target without any sessions, as its not_running rule says.
+// it returns the sessions to move instead (the fallback's), if any
+func (m *sessionMap) handleTargetNotRunning(target string, volume float32) []Session {
+	rule := m.deej.config.notRunningRule(target)
+
+	switch rule.Action {
+	case notRunningQueue:
+		m.queueVolume(target, volume)
+
+	case notRunningFallback:
+		if m.deej.Verbose() {
+			m.logger.Debugw("Target not running, moving its fallback", "target", target, "fallback", rule.Fallback)
+		}
+
+		return m.targetSessions(rule.Fallback)
+	}
+
+	return nil
+}
+
+func (m *sessionMap) queueVolume(target string, volume float32) {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	if m.deej.Verbose() {
+		m.logger.Debugw("Target not running, queueing its volume", "target", target, "volume", volume)
+	}
+
+	m.queuedVolumes[normalizeTarget(target)] = volume
+	m.persistQueuedVolumesLocked()
+
+	// keep looking for it (and any other queued app) until everything queued got applied
+	if !m.watchingQueue {
+		m.watchingQueue = true
+		m.goroutines.Add(1)
+		go m.watchQueue()
+	}
+}
+
+// forgetQueuedVolume drops a target's queued volume, once its slider moved it for real
+func (m *sessionMap) forgetQueuedVolume(target string) {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	if _, ok := m.queuedVolumes[normalizeTarget(target)]; ok {
+		delete(m.queuedVolumes, normalizeTarget(target))
+		m.persistQueuedVolumesLocked()
+	}
+}
+
+// persistQueuedVolumesLocked saves the queued volumes, so they're still applied if deej restarts before their
+// apps launch. assumes the queue lock is held
+func (m *sessionMap) persistQueuedVolumesLocked() {
+	queued := make(map[string]float32, len(m.queuedVolumes))
+	for target, volume := range m.queuedVolumes {
+		queued[target] = volume
+	}
+
+	m.deej.state.update(func(state *persistedState) {
+		state.QueuedVolumes = queued
+	})
+}
+
+func (m *sessionMap) watchQueue() {
+	defer m.goroutines.Done()
+
+	ticker := time.NewTicker(notRunningQueueCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		m.queueLock.Lock()
+		empty := len(m.queuedVolumes) == 0
+		if empty {
+			m.watchingQueue = false
+		}
+		m.queueLock.Unlock()
+
+		if empty {
+			return
+		}
+
+		// applyQueuedVolumes runs as part of every refresh
+		m.refreshSessions(false)
+	}
+}
+
+// applyQueuedVolumes sets every queued target that has sessions by now to its queued volume
+func (m *sessionMap) applyQueuedVolumes() {
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	for target, volume := range m.queuedVolumes {
+		sessions := m.targetSessions(target)
+		if len(sessions) == 0 {
+			continue
+		}
+
+		for _, session := range sessions {
+			if err := session.SetVolume(volume); err != nil {
+				m.logger.Warnw("Failed to apply queued volume", "target", target, "error", err)
+				continue
+			}
+
+			m.deej.events.recordVolume(session.Key(), volume)
+		}
+
+		m.logger.Infow("Applied queued volume to launched app", "target", target, "volume", volume)
+
+		delete(m.queuedVolumes, target)
+		m.persistQueuedVolumesLocked()
+	}
+}
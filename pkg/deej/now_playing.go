@@ -0,0 +1,202 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	nowPlayingStatusPlaying = "playing"
+	nowPlayingStatusPaused  = "paused"
+	nowPlayingStatusStopped = "stopped"
+
+	// what the track is, and whether it's playing (e.g. a "Playing" label next to "Artist - Title")
+	screenRowNowPlaying = "now_playing"
+
+	defaultNowPlayingPollInterval = 2 * time.Second
+)
+
+// nowPlayingConfig holds the user's now playing settings
+type nowPlayingConfig struct {
+	Enabled      bool
+	PollInterval time.Duration
+
+	// show a display page whenever the track changes
+	ShowOnDisplay bool
+}
+
+// nowPlayingInfo is what the OS says the current media session is playing. it's empty when nothing is
+type nowPlayingInfo struct {
+	App    string `json:"app"`
+	Title  string `json:"title"`
+	Artist string `json:"artist"`
+	Status string `json:"status"`
+}
+
+func (info nowPlayingInfo) empty() bool {
+	return info.Title == "" && info.Artist == ""
+}
+
+// String returns the track as "Artist - Title", or just the title when there's no artist
+func (info nowPlayingInfo) String() string {
+	if info.Artist == "" {
+		return info.Title
+	}
+
+	if info.Title == "" {
+		return info.Artist
+	}
+
+	return fmt.Sprintf("%s - %s", info.Artist, info.Title)
+}
+
+// nowPlayingWatcher follows what the OS's media controls say is playing (the same session the media keys
+// control), and shares it with the tray tooltip, display screens, the event log and the API
+type nowPlayingWatcher struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running bool
+	info    nowPlayingInfo
+
+	stopChannel chan bool
+}
+
+func newNowPlayingWatcher(deej *Deej, logger *zap.SugaredLogger) *nowPlayingWatcher {
+	logger = logger.Named("now-playing")
+
+	nw := &nowPlayingWatcher{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created now playing watcher instance")
+
+	return nw
+}
+
+// Start begins polling the OS's media session. it keeps running while disabled, to pick up a config change
+func (nw *nowPlayingWatcher) Start() {
+	nw.lock.Lock()
+	defer nw.lock.Unlock()
+
+	if nw.running {
+		return
+	}
+
+	if !nowPlayingSupported {
+		if nw.deej.config.NowPlaying.Enabled {
+			nw.logger.Warnw("Now playing isn't supported on this platform", "error", util.ErrNotSupported)
+		}
+
+		return
+	}
+
+	nw.running = true
+
+	go nw.pollLoop()
+}
+
+// Stop ends polling
+func (nw *nowPlayingWatcher) Stop() {
+	nw.lock.Lock()
+
+	if !nw.running {
+		nw.lock.Unlock()
+		return
+	}
+
+	nw.running = false
+	nw.lock.Unlock()
+
+	nw.stopChannel <- true
+}
+
+// current returns what's playing, as of the last poll
+func (nw *nowPlayingWatcher) current() nowPlayingInfo {
+	nw.lock.Lock()
+	defer nw.lock.Unlock()
+
+	return nw.info
+}
+
+func (nw *nowPlayingWatcher) pollLoop() {
+	for {
+		select {
+		case <-nw.stopChannel:
+			return
+
+		// the interval can change with the config, so it's picked up every time around
+		case <-time.After(nw.deej.config.NowPlaying.PollInterval):
+			nw.poll()
+		}
+	}
+}
+
+func (nw *nowPlayingWatcher) poll() {
+	info := nowPlayingInfo{}
+
+	if nw.deej.config.NowPlaying.Enabled {
+		var err error
+		if info, err = getNowPlaying(); err != nil {
+			if nw.deej.Verbose() {
+				nw.logger.Debugw("Failed to get now playing info", "error", err)
+			}
+
+			return
+		}
+	}
+
+	nw.lock.Lock()
+	if info == nw.info {
+		nw.lock.Unlock()
+		return
+	}
+
+	trackChanged := info.String() != nw.info.String()
+	nw.info = info
+	nw.lock.Unlock()
+
+	nw.logger.Infow("Now playing changed", "app", info.App, "track", info.String(), "status", info.Status)
+
+	if trackChanged && !info.empty() {
+		nw.deej.events.recordMedia(info.App, info.String())
+
+		if nw.deej.config.NowPlaying.ShowOnDisplay {
+			if err := nw.deej.serial.SendDisplayPage(displayPage{Title: "Now playing", Text: info.String()}); err != nil && nw.deej.Verbose() {
+				nw.logger.Warnw("Failed to send now playing display page", "error", err)
+			}
+		}
+	}
+
+	nw.deej.bus.nowPlaying.publish(info)
+}
+
+// nowPlayingRow shows whether the track is playing or paused, and what it is
+func (ds *displayScreener) nowPlayingRow() screenRow {
+	info := ds.deej.nowPlaying.current()
+	row := screenRow{Label: "Media", Text: "-", Bar: -1, Meter: -1}
+
+	if info.empty() {
+		return row
+	}
+
+	switch info.Status {
+	case nowPlayingStatusPlaying:
+		row.Label = "Playing"
+	case nowPlayingStatusPaused:
+		row.Label = "Paused"
+	}
+
+	row.Text = info.String()
+
+	return row
+}
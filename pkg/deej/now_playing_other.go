@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// there's no media session to ask about here (yet), so now_playing stays off and now_playing rows show nothing
+const nowPlayingSupported = false
+
+func getNowPlaying() (nowPlayingInfo, error) {
+	return nowPlayingInfo{}, util.ErrNotSupported
+}
@@ -0,0 +1,449 @@
+//go:build windows
+// +build windows
+
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+)
+
+// what's playing comes from the global system media transport controls - the same media session windows shows
+// in its volume flyout, and the one media keys control
+const nowPlayingSupported = true
+
+const (
+	mediaSessionManagerClass = "Windows.Media.Control.GlobalSystemMediaTransportControlsSessionManager"
+
+	// how long to wait on the media session to answer, before trying again on the next poll
+	nowPlayingAsyncTimeout      = 2 * time.Second
+	nowPlayingAsyncPollInterval = 10 * time.Millisecond
+)
+
+// AsyncStatus values
+const (
+	asyncStatusStarted   uint32 = 0
+	asyncStatusCompleted uint32 = 1
+	asyncStatusCanceled  uint32 = 2
+	asyncStatusError     uint32 = 3
+)
+
+// GlobalSystemMediaTransportControlsSessionPlaybackStatus values
+const (
+	mediaPlaybackStatusClosed   uint32 = 0
+	mediaPlaybackStatusOpened   uint32 = 1
+	mediaPlaybackStatusChanging uint32 = 2
+	mediaPlaybackStatusStopped  uint32 = 3
+	mediaPlaybackStatusPlaying  uint32 = 4
+	mediaPlaybackStatusPaused   uint32 = 5
+)
+
+var (
+	IID_IAsyncInfo                  = ole.NewGUID("{00000036-0000-0000-C000-000000000046}")
+	IID_IMediaSessionManagerStatics = ole.NewGUID("{2050C4EE-11A0-57DE-AED7-C97C70338245}")
+)
+
+// winrtVtbl is the start of every windows runtime interface's vtable: IUnknown's methods, then IInspectable's
+type winrtVtbl struct {
+	ole.IUnknownVtbl
+	GetIids             uintptr
+	GetRuntimeClassName uintptr
+	GetTrustLevel       uintptr
+}
+
+// IMediaSessionManagerStatics is the activation factory for the media session manager
+type IMediaSessionManagerStatics struct {
+	ole.IUnknown
+}
+
+type IMediaSessionManagerStaticsVtbl struct {
+	winrtVtbl
+	RequestAsync uintptr
+}
+
+func (v *IMediaSessionManagerStatics) VTable() *IMediaSessionManagerStaticsVtbl {
+	return (*IMediaSessionManagerStaticsVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// RequestAsync starts getting the media session manager
+func (v *IMediaSessionManagerStatics) RequestAsync() (*IAsyncOperation, error) {
+	var operation *IAsyncOperation
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().RequestAsync,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&operation)),
+		0)
+
+	if hr != 0 {
+		return nil, ole.NewError(hr)
+	}
+
+	return operation, nil
+}
+
+// IAsyncOperation is any IAsyncOperation<T> - they only differ in the type GetResults hands out
+type IAsyncOperation struct {
+	ole.IUnknown
+}
+
+type IAsyncOperationVtbl struct {
+	winrtVtbl
+	PutCompleted uintptr
+	GetCompleted uintptr
+	GetResults   uintptr
+}
+
+func (v *IAsyncOperation) VTable() *IAsyncOperationVtbl {
+	return (*IAsyncOperationVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// wait blocks until the operation is done, and stores its result (an interface pointer) in result
+func (v *IAsyncOperation) wait(result unsafe.Pointer) error {
+	info, err := v.QueryInterface(IID_IAsyncInfo)
+	if err != nil {
+		return fmt.Errorf("get async info: %w", err)
+	}
+	defer info.Release()
+
+	asyncInfo := (*IAsyncInfo)(unsafe.Pointer(info))
+	deadline := time.Now().Add(nowPlayingAsyncTimeout)
+
+	for {
+		status, err := asyncInfo.GetStatus()
+		if err != nil {
+			return fmt.Errorf("get async status: %w", err)
+		}
+
+		switch status {
+		case asyncStatusCompleted:
+			hr, _, _ := syscall.Syscall(
+				v.VTable().GetResults,
+				2,
+				uintptr(unsafe.Pointer(v)),
+				uintptr(result),
+				0)
+
+			if hr != 0 {
+				return ole.NewError(hr)
+			}
+
+			return nil
+
+		case asyncStatusCanceled, asyncStatusError:
+			return fmt.Errorf("async operation failed (status %d)", status)
+		}
+
+		if time.Now().After(deadline) {
+			asyncInfo.Cancel()
+			return errors.New("async operation timed out")
+		}
+
+		time.Sleep(nowPlayingAsyncPollInterval)
+	}
+}
+
+// IAsyncInfo tells how an async operation is getting on
+type IAsyncInfo struct {
+	ole.IUnknown
+}
+
+type IAsyncInfoVtbl struct {
+	winrtVtbl
+	GetID        uintptr
+	GetStatus    uintptr
+	GetErrorCode uintptr
+	Cancel       uintptr
+	Close        uintptr
+}
+
+func (v *IAsyncInfo) VTable() *IAsyncInfoVtbl {
+	return (*IAsyncInfoVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+func (v *IAsyncInfo) GetStatus() (uint32, error) {
+	var status uint32
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().GetStatus,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&status)),
+		0)
+
+	if hr != 0 {
+		return 0, ole.NewError(hr)
+	}
+
+	return status, nil
+}
+
+func (v *IAsyncInfo) Cancel() {
+	syscall.Syscall(v.VTable().Cancel, 1, uintptr(unsafe.Pointer(v)), 0, 0)
+}
+
+// IMediaSessionManager knows about every app's media session, and which one is current
+type IMediaSessionManager struct {
+	ole.IUnknown
+}
+
+type IMediaSessionManagerVtbl struct {
+	winrtVtbl
+	GetCurrentSession uintptr
+}
+
+func (v *IMediaSessionManager) VTable() *IMediaSessionManagerVtbl {
+	return (*IMediaSessionManagerVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// GetCurrentSession returns the session windows considers current, or nil if there are none
+func (v *IMediaSessionManager) GetCurrentSession() (*IMediaSession, error) {
+	var session *IMediaSession
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().GetCurrentSession,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&session)),
+		0)
+
+	if hr != 0 {
+		return nil, ole.NewError(hr)
+	}
+
+	return session, nil
+}
+
+// IMediaSession is a single app's media session
+type IMediaSession struct {
+	ole.IUnknown
+}
+
+type IMediaSessionVtbl struct {
+	winrtVtbl
+	GetSourceAppUserModelID    uintptr
+	TryGetMediaPropertiesAsync uintptr
+	GetTimelineProperties      uintptr
+	GetPlaybackInfo            uintptr
+}
+
+func (v *IMediaSession) VTable() *IMediaSessionVtbl {
+	return (*IMediaSessionVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// GetSourceAppUserModelID returns the ID of the app the session belongs to (e.g. "Spotify.exe")
+func (v *IMediaSession) GetSourceAppUserModelID() (string, error) {
+	return getHStringProperty(unsafe.Pointer(v), v.VTable().GetSourceAppUserModelID)
+}
+
+// TryGetMediaPropertiesAsync starts getting the session's track info
+func (v *IMediaSession) TryGetMediaPropertiesAsync() (*IAsyncOperation, error) {
+	var operation *IAsyncOperation
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().TryGetMediaPropertiesAsync,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&operation)),
+		0)
+
+	if hr != 0 {
+		return nil, ole.NewError(hr)
+	}
+
+	return operation, nil
+}
+
+// GetPlaybackInfo returns the session's playback state
+func (v *IMediaSession) GetPlaybackInfo() (*IMediaPlaybackInfo, error) {
+	var playbackInfo *IMediaPlaybackInfo
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().GetPlaybackInfo,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&playbackInfo)),
+		0)
+
+	if hr != 0 {
+		return nil, ole.NewError(hr)
+	}
+
+	return playbackInfo, nil
+}
+
+// IMediaProperties is what's playing in a session. only the first few properties are of any use here
+type IMediaProperties struct {
+	ole.IUnknown
+}
+
+type IMediaPropertiesVtbl struct {
+	winrtVtbl
+	GetTitle       uintptr
+	GetSubtitle    uintptr
+	GetAlbumArtist uintptr
+	GetArtist      uintptr
+}
+
+func (v *IMediaProperties) VTable() *IMediaPropertiesVtbl {
+	return (*IMediaPropertiesVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+func (v *IMediaProperties) GetTitle() (string, error) {
+	return getHStringProperty(unsafe.Pointer(v), v.VTable().GetTitle)
+}
+
+func (v *IMediaProperties) GetArtist() (string, error) {
+	return getHStringProperty(unsafe.Pointer(v), v.VTable().GetArtist)
+}
+
+// IMediaPlaybackInfo is a session's playback state
+type IMediaPlaybackInfo struct {
+	ole.IUnknown
+}
+
+type IMediaPlaybackInfoVtbl struct {
+	winrtVtbl
+	GetControls       uintptr
+	GetPlaybackStatus uintptr
+}
+
+func (v *IMediaPlaybackInfo) VTable() *IMediaPlaybackInfoVtbl {
+	return (*IMediaPlaybackInfoVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+func (v *IMediaPlaybackInfo) GetPlaybackStatus() (uint32, error) {
+	var status uint32
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().GetPlaybackStatus,
+		2,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(&status)),
+		0)
+
+	if hr != 0 {
+		return 0, ole.NewError(hr)
+	}
+
+	return status, nil
+}
+
+// getHStringProperty calls a string property's getter on the given interface
+func getHStringProperty(this unsafe.Pointer, getter uintptr) (string, error) {
+	var hstring uintptr
+
+	hr, _, _ := syscall.Syscall(getter, 2, uintptr(this), uintptr(unsafe.Pointer(&hstring)), 0)
+	if hr != 0 {
+		return "", ole.NewError(hr)
+	}
+
+	return takeHString(hstring), nil
+}
+
+func getNowPlaying() (nowPlayingInfo, error) {
+	info := nowPlayingInfo{}
+
+	err := withCOM(func() error {
+		className, err := createHString(mediaSessionManagerClass)
+		if err != nil {
+			return fmt.Errorf("create class name string: %w", err)
+		}
+		defer procWindowsDeleteString.Call(className)
+
+		var statics *IMediaSessionManagerStatics
+
+		hr, _, _ := procRoGetActivationFactory.Call(
+			className,
+			uintptr(unsafe.Pointer(IID_IMediaSessionManagerStatics)),
+			uintptr(unsafe.Pointer(&statics)))
+
+		if hr != 0 {
+			return fmt.Errorf("get media session manager factory: %w", ole.NewError(hr))
+		}
+		defer statics.Release()
+
+		request, err := statics.RequestAsync()
+		if err != nil {
+			return fmt.Errorf("request media session manager: %w", err)
+		}
+		defer request.Release()
+
+		var manager *IMediaSessionManager
+		if err := request.wait(unsafe.Pointer(&manager)); err != nil {
+			return fmt.Errorf("wait for media session manager: %w", err)
+		}
+		defer manager.Release()
+
+		session, err := manager.GetCurrentSession()
+		if err != nil {
+			return fmt.Errorf("get current media session: %w", err)
+		}
+
+		// nothing's playing, or has been recently enough to still have a session
+		if session == nil {
+			return nil
+		}
+		defer session.Release()
+
+		if info.App, err = session.GetSourceAppUserModelID(); err != nil {
+			return fmt.Errorf("get media session app: %w", err)
+		}
+
+		if info.Status, err = getMediaSessionStatus(session); err != nil {
+			return err
+		}
+
+		propertiesRequest, err := session.TryGetMediaPropertiesAsync()
+		if err != nil {
+			return fmt.Errorf("request media properties: %w", err)
+		}
+		defer propertiesRequest.Release()
+
+		var properties *IMediaProperties
+		if err := propertiesRequest.wait(unsafe.Pointer(&properties)); err != nil {
+			return fmt.Errorf("wait for media properties: %w", err)
+		}
+		defer properties.Release()
+
+		if info.Title, err = properties.GetTitle(); err != nil {
+			return fmt.Errorf("get media title: %w", err)
+		}
+
+		if info.Artist, err = properties.GetArtist(); err != nil {
+			return fmt.Errorf("get media artist: %w", err)
+		}
+
+		return nil
+	})
+
+	return info, err
+}
+
+func getMediaSessionStatus(session *IMediaSession) (string, error) {
+	playbackInfo, err := session.GetPlaybackInfo()
+	if err != nil {
+		return "", fmt.Errorf("get media playback info: %w", err)
+	}
+	defer playbackInfo.Release()
+
+	status, err := playbackInfo.GetPlaybackStatus()
+	if err != nil {
+		return "", fmt.Errorf("get media playback status: %w", err)
+	}
+
+	switch status {
+	case mediaPlaybackStatusPlaying:
+		return nowPlayingStatusPlaying, nil
+	case mediaPlaybackStatusPaused:
+		return nowPlayingStatusPaused, nil
+	default:
+		return nowPlayingStatusStopped, nil
+	}
+}
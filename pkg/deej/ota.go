@@ -0,0 +1,331 @@
+package deej
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	apiPathDeviceHold   = "/device/hold"
+	apiPathDeviceResume = "/device/resume"
+
+	// the ESP HTTP update server's upload endpoint, which also takes ?url=<image> on firmware that can fetch it itself
+	otaUpdatePath      = "/update"
+	otaUploadFieldName = "update"
+
+	// every ESP32 (and ESP8266) application image starts with this byte
+	espImageMagic = 0xE9
+
+	// far more than any ESP's flash holds, just to keep a wrong URL from filling memory
+	maxFirmwareImageSize = 16 << 20
+
+	otaDownloadTimeout = 2 * time.Minute
+	otaUploadTimeout   = 5 * time.Minute
+
+	// how long the device gets to flash itself and reboot before it should answer again
+	otaRebootDelay    = 3 * time.Second
+	otaRebootTimeout  = 90 * time.Second
+	otaRebootInterval = 2 * time.Second
+)
+
+// FlashFirmware updates a network-connected (ESP-based) deej device: it uploads the given firmware image (a file
+// or an http(s) URL) to the device's update endpoint, or with pull set, hands the device the URL to fetch itself.
+// a deej instance running on this machine is asked to let go of the device while it flashes and reboots, and
+// to reconnect once it's back
+func FlashFirmware(logger *zap.SugaredLogger, out io.Writer, device string, firmware string, pull bool) error {
+	deviceURL := device
+	if !strings.Contains(deviceURL, "://") {
+		deviceURL = "http://" + deviceURL
+	}
+
+	deviceURL = strings.TrimSuffix(deviceURL, "/")
+
+	var image []byte
+	if pull {
+		if !isHTTPURL(firmware) {
+			return errors.New("the device can only pull firmware from an http(s) URL")
+		}
+	} else {
+		var err error
+		if image, err = loadFirmwareImage(firmware); err != nil {
+			return err
+		}
+
+		fmt.Fprintf(out, "Loaded firmware image (%d KB)\n", len(image)/1024)
+	}
+
+	// flashing goes ahead without a running deej, there's just nothing to coordinate then
+	apiAddress, err := localAPIAddress(logger)
+	if err == nil {
+		if err := postLocalAPI(apiAddress+apiPathDeviceHold, nil); err != nil {
+			logger.Debugw("Couldn't ask deej to let go of the device", "error", err)
+			apiAddress = ""
+		} else {
+			fmt.Fprintln(out, "Asked deej to let go of the device")
+		}
+	}
+
+	if apiAddress != "" {
+		defer func() {
+			if err := postLocalAPI(apiAddress+apiPathDeviceResume, nil); err != nil {
+				logger.Warnw("Failed to ask deej to reconnect to the device", "error", err)
+				return
+			}
+
+			fmt.Fprintln(out, "Asked deej to reconnect to the device")
+		}()
+	}
+
+	if pull {
+		fmt.Fprintf(out, "Asking %s to update itself from %s\n", deviceURL, firmware)
+		err = requestFirmwarePull(deviceURL, firmware)
+	} else {
+		fmt.Fprintf(out, "Uploading firmware to %s\n", deviceURL)
+		err = uploadFirmwareImage(deviceURL, path.Base(firmware), image)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Firmware accepted, waiting for the device to reboot")
+
+	if err := waitForDevice(deviceURL); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "Device is back")
+
+	return nil
+}
+
+func isHTTPURL(value string) bool {
+	return strings.HasPrefix(value, "http://") || strings.HasPrefix(value, "https://")
+}
+
+// loadFirmwareImage reads a firmware image from a file or downloads it, and checks that it looks like an ESP image
+func loadFirmwareImage(firmware string) ([]byte, error) {
+	var image []byte
+
+	if isHTTPURL(firmware) {
+		client := &http.Client{Timeout: otaDownloadTimeout}
+
+		response, err := client.Get(firmware)
+		if err != nil {
+			return nil, fmt.Errorf("download firmware: %w", err)
+		}
+
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("download firmware: unexpected status %s", response.Status)
+		}
+
+		if image, err = ioutil.ReadAll(io.LimitReader(response.Body, maxFirmwareImageSize+1)); err != nil {
+			return nil, fmt.Errorf("download firmware: %w", err)
+		}
+	} else {
+		var err error
+		if image, err = ioutil.ReadFile(firmware); err != nil {
+			return nil, fmt.Errorf("read firmware: %w", err)
+		}
+	}
+
+	if len(image) > maxFirmwareImageSize {
+		return nil, fmt.Errorf("firmware image is over %d MB, that can't be right", maxFirmwareImageSize>>20)
+	}
+
+	// a web page or a zip would only brick the update (or be rejected halfway through)
+	if len(image) == 0 || image[0] != espImageMagic {
+		return nil, errors.New("that doesn't look like an ESP firmware image (expected a .bin file)")
+	}
+
+	return image, nil
+}
+
+// uploadFirmwareImage sends the image to the device's update endpoint, which flashes it and reboots
+func uploadFirmwareImage(deviceURL string, filename string, image []byte) error {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	part, err := writer.CreateFormFile(otaUploadFieldName, filename)
+	if err != nil {
+		return fmt.Errorf("create upload form: %w", err)
+	}
+
+	if _, err := part.Write(image); err != nil {
+		return fmt.Errorf("create upload form: %w", err)
+	}
+
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("create upload form: %w", err)
+	}
+
+	client := &http.Client{Timeout: otaUploadTimeout}
+
+	response, err := client.Post(deviceURL+otaUpdatePath, writer.FormDataContentType(), body)
+	if err != nil {
+		return fmt.Errorf("upload firmware: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	return checkOTAResponse(response)
+}
+
+// requestFirmwarePull hands the device a URL to update itself from, for firmware with its own updater
+func requestFirmwarePull(deviceURL string, firmwareURL string) error {
+	client := &http.Client{Timeout: otaUploadTimeout}
+
+	response, err := client.Post(deviceURL+otaUpdatePath+"?url="+url.QueryEscape(firmwareURL), "text/plain", nil)
+	if err != nil {
+		return fmt.Errorf("request firmware update: %w", err)
+	}
+
+	defer response.Body.Close()
+
+	return checkOTAResponse(response)
+}
+
+// checkOTAResponse makes sure the device took the update. the ESP update server answers 200 either way,
+// so its message is checked too
+func checkOTAResponse(response *http.Response) error {
+	message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+	text := strings.TrimSpace(string(message))
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("device rejected the update: %s %s", response.Status, text)
+	}
+
+	if lower := strings.ToLower(text); strings.Contains(lower, "fail") || strings.Contains(lower, "error") {
+		return fmt.Errorf("device failed to update: %s", text)
+	}
+
+	return nil
+}
+
+// waitForDevice waits for the device to answer again after rebooting into its new firmware
+func waitForDevice(deviceURL string) error {
+	client := &http.Client{Timeout: otaRebootInterval}
+	deadline := time.Now().Add(otaRebootTimeout)
+
+	<-time.After(otaRebootDelay)
+
+	for time.Now().Before(deadline) {
+		if response, err := client.Get(deviceURL + "/"); err == nil {
+			response.Body.Close()
+			return nil
+		}
+
+		<-time.After(otaRebootInterval)
+	}
+
+	return fmt.Errorf("device didn't come back within %s of updating", otaRebootTimeout)
+}
+
+// postLocalAPI posts to the running deej's API, decoding its JSON answer into result unless it's nil
+func postLocalAPI(address string, result interface{}) error {
+	client := &http.Client{Timeout: eventTailTimeout}
+
+	response, err := client.Post(address, "text/plain", nil)
+	if err != nil {
+		return fmt.Errorf("post to deej (is it running?): %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("post to deej: unexpected status %s %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("decode deej's response: %w", err)
+	}
+
+	return nil
+}
+
+// getLocalAPI gets from the running deej's API, decoding its JSON answer into result
+func getLocalAPI(address string, result interface{}) error {
+	client := &http.Client{Timeout: eventTailTimeout}
+
+	response, err := client.Get(address)
+	if err != nil {
+		return fmt.Errorf("get from deej (is it running?): %w", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		message, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("get from deej: unexpected status %s %s", response.Status, strings.TrimSpace(string(message)))
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+		return fmt.Errorf("decode deej's response: %w", err)
+	}
+
+	return nil
+}
+
+// handleDeviceHold closes the device connection without trying to reconnect, until handleDeviceResume.
+// it's what deej flash uses to keep deej away from the device while it updates
+func (as *apiServer) handleDeviceHold(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	as.deej.serial.hold()
+}
+
+// handleDeviceResume reconnects to the device after handleDeviceHold
+func (as *apiServer) handleDeviceResume(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	as.deej.serial.resume()
+}
+
+// hold closes the connection (or stops looking for the device), and stays away from it until resume
+func (sio *SerialIO) hold() {
+	sio.logger.Info("Letting go of the device until asked to reconnect")
+	sio.held = true
+
+	if sio.isConnected() {
+		sio.deej.processMonitor.Stop()
+	}
+
+	sio.Stop()
+}
+
+// resume starts looking for the device again
+func (sio *SerialIO) resume() {
+	sio.held = false
+
+	if sio.isConnected() {
+		return
+	}
+
+	sio.logger.Info("Reconnecting to the device")
+	sio.startReconnectLoop()
+}
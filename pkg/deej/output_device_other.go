@@ -0,0 +1,20 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// deej only knows how to change the default output device on Windows, so the output.* button actions
+// and the tray item do nothing here
+const outputSwitchSupported = false
+
+func listOutputDevices() ([]outputDevice, error) {
+	return nil, util.ErrNotSupported
+}
+
+func setDefaultOutputDevice(device outputDevice) error {
+	return util.ErrNotSupported
+}
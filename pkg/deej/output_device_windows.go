@@ -0,0 +1,205 @@
+//go:build windows
+// +build windows
+
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	ole "github.com/go-ole/go-ole"
+	wca "github.com/moutend/go-wca"
+)
+
+// changing the default device goes through IPolicyConfig, an undocumented (but long-stable) interface that's
+// also what the sound control panel uses
+const outputSwitchSupported = true
+
+// IPolicyConfig lets deej change the default audio endpoint for each role
+type IPolicyConfig struct {
+	ole.IUnknown
+}
+
+type IPolicyConfigVtbl struct {
+	ole.IUnknownVtbl
+	GetMixFormat          uintptr
+	GetDeviceFormat       uintptr
+	ResetDeviceFormat     uintptr
+	SetDeviceFormat       uintptr
+	GetProcessingPeriod   uintptr
+	SetProcessingPeriod   uintptr
+	GetShareMode          uintptr
+	SetShareMode          uintptr
+	GetPropertyValue      uintptr
+	SetPropertyValue      uintptr
+	SetDefaultEndpoint    uintptr
+	SetEndpointVisibility uintptr
+}
+
+func (v *IPolicyConfig) VTable() *IPolicyConfigVtbl {
+	return (*IPolicyConfigVtbl)(unsafe.Pointer(v.RawVTable))
+}
+
+// SetDefaultEndpoint makes the device with the given ID the default one for the given role
+func (v *IPolicyConfig) SetDefaultEndpoint(deviceID string, role uint32) error {
+	deviceIDPtr, err := syscall.UTF16PtrFromString(deviceID)
+	if err != nil {
+		return err
+	}
+
+	hr, _, _ := syscall.Syscall(
+		v.VTable().SetDefaultEndpoint,
+		3,
+		uintptr(unsafe.Pointer(v)),
+		uintptr(unsafe.Pointer(deviceIDPtr)),
+		uintptr(role))
+
+	if hr != 0 {
+		return ole.NewError(hr)
+	}
+
+	return nil
+}
+
+// CLSID_PolicyConfigClient and IID_IPolicyConfig are the GUIDs for the policy config class and interface
+var (
+	CLSID_PolicyConfigClient = ole.NewGUID("{870AF99C-171D-4F9E-AF0D-E63DF40C2BC9}")
+	IID_IPolicyConfig        = ole.NewGUID("{F8679F50-850A-41CF-9C72-430F290290C8}")
+)
+
+// withCOM runs f with COM initialized, on a single OS thread
+func withCOM(f func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if err := ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED); err != nil {
+		oleError := &ole.OleError{}
+
+		// code 1 = S_FALSE (already initialized) - this is fine
+		if !errors.As(err, &oleError) || oleError.Code() != 1 {
+			return fmt.Errorf("call CoInitializeEx: %w", err)
+		}
+	}
+	defer ole.CoUninitialize()
+
+	return f()
+}
+
+// withDeviceEnumerator runs f with COM initialized and a device enumerator ready
+func withDeviceEnumerator(f func(enumerator *wca.IMMDeviceEnumerator) error) error {
+	return withCOM(func() error {
+		var mmDeviceEnumerator *wca.IMMDeviceEnumerator
+		if err := wca.CoCreateInstance(
+			wca.CLSID_MMDeviceEnumerator,
+			0,
+			wca.CLSCTX_ALL,
+			wca.IID_IMMDeviceEnumerator,
+			&mmDeviceEnumerator,
+		); err != nil {
+			return fmt.Errorf("create device enumerator: %w", err)
+		}
+		defer mmDeviceEnumerator.Release()
+
+		return f(mmDeviceEnumerator)
+	})
+}
+
+// listOutputDevices returns every active output device, marking the current default one
+func listOutputDevices() ([]outputDevice, error) {
+	devices := []outputDevice{}
+
+	err := withDeviceEnumerator(func(enumerator *wca.IMMDeviceEnumerator) error {
+		defaultID := ""
+
+		var defaultDevice *wca.IMMDevice
+		if err := enumerator.GetDefaultAudioEndpoint(wca.ERender, wca.EConsole, &defaultDevice); err == nil {
+			if err := defaultDevice.GetId(&defaultID); err != nil {
+				defaultID = ""
+			}
+			defaultDevice.Release()
+		}
+
+		var deviceCollection *wca.IMMDeviceCollection
+		if err := enumerator.EnumAudioEndpoints(wca.ERender, wca.DEVICE_STATE_ACTIVE, &deviceCollection); err != nil {
+			return fmt.Errorf("enumerate output devices: %w", err)
+		}
+		defer deviceCollection.Release()
+
+		var deviceCount uint32
+		if err := deviceCollection.GetCount(&deviceCount); err != nil {
+			return fmt.Errorf("get output device count: %w", err)
+		}
+
+		for deviceIdx := uint32(0); deviceIdx < deviceCount; deviceIdx++ {
+			device, err := describeOutputDevice(deviceCollection, deviceIdx)
+			if err != nil {
+				return err
+			}
+
+			device.Default = device.ID == defaultID
+			devices = append(devices, device)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return devices, nil
+}
+
+func describeOutputDevice(deviceCollection *wca.IMMDeviceCollection, deviceIdx uint32) (outputDevice, error) {
+	var endpoint *wca.IMMDevice
+	if err := deviceCollection.Item(deviceIdx, &endpoint); err != nil {
+		return outputDevice{}, fmt.Errorf("get output device %d: %w", deviceIdx, err)
+	}
+	defer endpoint.Release()
+
+	var id string
+	if err := endpoint.GetId(&id); err != nil {
+		return outputDevice{}, fmt.Errorf("get output device %d ID: %w", deviceIdx, err)
+	}
+
+	var propertyStore *wca.IPropertyStore
+	if err := endpoint.OpenPropertyStore(wca.STGM_READ, &propertyStore); err != nil {
+		return outputDevice{}, fmt.Errorf("open output device %d property store: %w", deviceIdx, err)
+	}
+	defer propertyStore.Release()
+
+	value := &wca.PROPVARIANT{}
+	if err := propertyStore.GetValue(&wca.PKEY_Device_FriendlyName, value); err != nil {
+		return outputDevice{}, fmt.Errorf("get output device %d friendly name: %w", deviceIdx, err)
+	}
+
+	return outputDevice{ID: id, Name: value.String()}, nil
+}
+
+// setDefaultOutputDevice makes the given device the default for every role, like the sound control panel does
+func setDefaultOutputDevice(device outputDevice) error {
+	return withCOM(func() error {
+		var policyConfig *IPolicyConfig
+		if err := wca.CoCreateInstance(
+			CLSID_PolicyConfigClient,
+			0,
+			wca.CLSCTX_ALL,
+			IID_IPolicyConfig,
+			&policyConfig,
+		); err != nil {
+			return fmt.Errorf("create policy config: %w", err)
+		}
+		defer policyConfig.Release()
+
+		for _, role := range []uint32{wca.EConsole, wca.EMultimedia, wca.ECommunications} {
+			if err := policyConfig.SetDefaultEndpoint(device.ID, role); err != nil {
+				return fmt.Errorf("set default output device (role %d): %w", role, err)
+			}
+		}
+
+		return nil
+	})
+}
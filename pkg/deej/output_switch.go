@@ -0,0 +1,136 @@
+package deej
+
+import (
+	"fmt"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	buttonActionOutputNext = "output.next" // make the next output device the default one
+	buttonActionOutputSet  = "output.set"  // make the output device given by the "device" key (a name or pattern) the default
+)
+
+// outputSwitchConfig holds the user's output device switching settings
+type outputSwitchConfig struct {
+
+	// names (or patterns) of the devices output.next cycles between, in order. empty cycles between all of them
+	Devices []string
+
+	// also show the new device's name on devices with a display
+	ShowOnDisplay bool
+}
+
+// outputDevice is an active output (playback) device
+type outputDevice struct {
+	ID      string
+	Name    string
+	Default bool
+}
+
+// NextOutputDevice makes the next output device (out of the configured ones, if any) the system's default
+func (d *Deej) NextOutputDevice() error {
+	logger := d.logger.Named("output")
+
+	if !outputSwitchSupported {
+		logger.Warnw("Output device switching isn't supported on this platform", "error", util.ErrNotSupported)
+		return util.ErrNotSupported
+	}
+
+	devices, err := d.switchableOutputDevices()
+	if err != nil {
+		logger.Warnw("Failed to list output devices", "error", err)
+		return fmt.Errorf("list output devices: %w", err)
+	}
+
+	if len(devices) == 0 {
+		logger.Warn("No output devices to switch between")
+		return fmt.Errorf("no output devices to switch between")
+	}
+
+	// start right after the current default, or from the first one if it isn't in the cycle
+	nextIdx := 0
+	for idx, device := range devices {
+		if device.Default {
+			nextIdx = (idx + 1) % len(devices)
+			break
+		}
+	}
+
+	return d.switchOutputDevice(devices[nextIdx])
+}
+
+// SetOutputDevice makes the first output device matching the given name (or pattern) the system's default
+func (d *Deej) SetOutputDevice(name string) error {
+	logger := d.logger.Named("output")
+
+	if !outputSwitchSupported {
+		logger.Warnw("Output device switching isn't supported on this platform", "error", util.ErrNotSupported)
+		return util.ErrNotSupported
+	}
+
+	devices, err := listOutputDevices()
+	if err != nil {
+		logger.Warnw("Failed to list output devices", "error", err)
+		return fmt.Errorf("list output devices: %w", err)
+	}
+
+	for _, device := range devices {
+		if deviceNameMatches(name, device.Name) {
+			return d.switchOutputDevice(device)
+		}
+	}
+
+	logger.Warnw("Can't switch to unknown output device", "device", name)
+	return fmt.Errorf("unknown output device: %s", name)
+}
+
+// switchableOutputDevices returns the devices output.next cycles between - those in output_switch.devices,
+// in that order, or all active ones if none are configured
+func (d *Deej) switchableOutputDevices() ([]outputDevice, error) {
+	devices, err := listOutputDevices()
+	if err != nil {
+		return nil, err
+	}
+
+	names := d.config.OutputSwitch.Devices
+	if len(names) == 0 {
+		return devices, nil
+	}
+
+	switchable := []outputDevice{}
+	added := map[string]bool{}
+
+	for _, name := range names {
+		for _, device := range devices {
+			if !added[device.ID] && deviceNameMatches(name, device.Name) {
+				switchable = append(switchable, device)
+				added[device.ID] = true
+			}
+		}
+	}
+
+	return switchable, nil
+}
+
+func (d *Deej) switchOutputDevice(device outputDevice) error {
+	logger := d.logger.Named("output")
+
+	if err := setDefaultOutputDevice(device); err != nil {
+		logger.Warnw("Failed to switch output device", "device", device.Name, "error", err)
+		return fmt.Errorf("switch output device: %w", err)
+	}
+
+	logger.Infow("Switched output device", "device", device.Name)
+
+	// the session finder hears about the new default on its own, and re-acquires the master session
+	d.notifier.Notify("Output device", device.Name)
+
+	if d.config.OutputSwitch.ShowOnDisplay {
+		if err := d.serial.SendDisplayPage(displayPage{Title: "Output", Text: device.Name}); err != nil && d.Verbose() {
+			logger.Warnw("Failed to send output device display page", "error", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	icsDateTimeFormat    = "20060102T150405"
+	icsDateTimeUTCFormat = "20060102T150405Z"
+	icsDateFormat        = "20060102"
+)
+
+// calendarEvent is the subset of an ICS VEVENT we care about
+type calendarEvent struct {
+	Summary string
+	Start   time.Time
+}
+
+// calendarPageProvider shows the next upcoming event from an ICS feed (e.g. a "secret address" calendar export).
+// recurring events (RRULE) are only considered by their first occurrence
+type calendarPageProvider struct {
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+
+	url      string
+	interval time.Duration
+
+	lock   sync.Mutex
+	events []calendarEvent
+}
+
+func newCalendarPageProvider(logger *zap.SugaredLogger, httpClient *http.Client, config displayPagesConfig) *calendarPageProvider {
+	return &calendarPageProvider{
+		logger:     logger.Named("calendar"),
+		httpClient: httpClient,
+		url:        config.Calendar.URL,
+		interval:   config.Calendar.RefreshInterval,
+	}
+}
+
+func (cp *calendarPageProvider) name() string {
+	return "calendar"
+}
+
+func (cp *calendarPageProvider) refreshInterval() time.Duration {
+	return cp.interval
+}
+
+func (cp *calendarPageProvider) refresh() error {
+	if cp.url == "" {
+		return fmt.Errorf("calendar: url must be set")
+	}
+
+	// webcal:// is just a hint for calendar apps, the feed itself is served over https
+	feedURL := cp.url
+	if strings.HasPrefix(feedURL, "webcal://") {
+		feedURL = "https://" + strings.TrimPrefix(feedURL, "webcal://")
+	}
+
+	response, err := cp.httpClient.Get(feedURL)
+	if err != nil {
+		return fmt.Errorf("request calendar feed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request calendar feed: unexpected status %s", response.Status)
+	}
+
+	events, err := parseICSEvents(response.Body)
+	if err != nil {
+		return fmt.Errorf("parse calendar feed: %w", err)
+	}
+
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	cp.events = events
+
+	return nil
+}
+
+func (cp *calendarPageProvider) page() (displayPage, bool) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	now := time.Now()
+	var next *calendarEvent
+
+	for idx, event := range cp.events {
+		if event.Start.Before(now) {
+			continue
+		}
+
+		if next == nil || event.Start.Before(next.Start) {
+			next = &cp.events[idx]
+		}
+	}
+
+	if next == nil {
+		return displayPage{}, false
+	}
+
+	// today's events only need a time, anything further away also gets a day
+	when := next.Start.Format("15:04")
+	if next.Start.YearDay() != now.YearDay() || next.Start.Year() != now.Year() {
+		when = next.Start.Format("Mon 15:04")
+	}
+
+	return displayPage{
+		Title: when,
+		Text:  next.Summary,
+	}, true
+}
+
+// parseICSEvents extracts the summary and start time of every VEVENT in an ICS stream
+func parseICSEvents(reader io.Reader) ([]calendarEvent, error) {
+	events := []calendarEvent{}
+
+	var current *calendarEvent
+
+	for _, line := range unfoldICSLines(reader) {
+		name, params, value := splitICSLine(line)
+
+		switch {
+		case name == "BEGIN" && value == "VEVENT":
+			current = &calendarEvent{}
+
+		case name == "END" && value == "VEVENT":
+			if current != nil && !current.Start.IsZero() {
+				events = append(events, *current)
+			}
+
+			current = nil
+
+		case current == nil:
+			continue
+
+		case name == "SUMMARY":
+			current.Summary = unescapeICSText(value)
+
+		case name == "DTSTART":
+			start, err := parseICSTime(params, value)
+			if err != nil {
+				return nil, fmt.Errorf("parse event start %q: %w", value, err)
+			}
+
+			current.Start = start
+		}
+	}
+
+	return events, nil
+}
+
+// unfoldICSLines joins continuation lines (those starting with whitespace) back onto their logical line
+func unfoldICSLines(reader io.Reader) []string {
+	lines := []string{}
+	scanner := bufio.NewScanner(reader)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// splitICSLine splits "DTSTART;TZID=Europe/London:20200101T100000" into its name, parameters and value
+func splitICSLine(line string) (string, map[string]string, string) {
+	colonIdx := strings.Index(line, ":")
+	if colonIdx == -1 {
+		return "", nil, ""
+	}
+
+	nameAndParams := strings.Split(line[:colonIdx], ";")
+	params := make(map[string]string)
+
+	for _, param := range nameAndParams[1:] {
+		keyValue := strings.SplitN(param, "=", 2)
+		if len(keyValue) == 2 {
+			params[strings.ToUpper(keyValue[0])] = strings.Trim(keyValue[1], "\"")
+		}
+	}
+
+	return strings.ToUpper(nameAndParams[0]), params, line[colonIdx+1:]
+}
+
+func parseICSTime(params map[string]string, value string) (time.Time, error) {
+	if params["VALUE"] == "DATE" {
+		return time.ParseInLocation(icsDateFormat, value, time.Local)
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		return time.Parse(icsDateTimeUTCFormat, value)
+	}
+
+	location := time.Local
+	if tzid, ok := params["TZID"]; ok {
+		if loaded, err := time.LoadLocation(tzid); err == nil {
+			location = loaded
+		}
+	}
+
+	return time.ParseInLocation(icsDateTimeFormat, value, location)
+}
+
+func unescapeICSText(value string) string {
+	replacer := strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
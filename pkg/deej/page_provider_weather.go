@@ -0,0 +1,124 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const openWeatherEndpoint = "https://api.openweathermap.org/data/2.5/weather"
+
+// weatherPageProvider shows the current conditions for a single location, using OpenWeather's current weather API
+type weatherPageProvider struct {
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+
+	apiKey   string
+	location string
+	units    string
+	interval time.Duration
+
+	lock    sync.Mutex
+	current *displayPage
+}
+
+type openWeatherResponse struct {
+	Name    string `json:"name"`
+	Weather []struct {
+		Main string `json:"main"`
+	} `json:"weather"`
+	Main struct {
+		Temp float64 `json:"temp"`
+	} `json:"main"`
+}
+
+func newWeatherPageProvider(logger *zap.SugaredLogger, httpClient *http.Client, config displayPagesConfig) *weatherPageProvider {
+	return &weatherPageProvider{
+		logger:     logger.Named("weather"),
+		httpClient: httpClient,
+		apiKey:     config.Weather.APIKey,
+		location:   config.Weather.Location,
+		units:      config.Weather.Units,
+		interval:   config.Weather.RefreshInterval,
+	}
+}
+
+func (wp *weatherPageProvider) name() string {
+	return "weather"
+}
+
+func (wp *weatherPageProvider) refreshInterval() time.Duration {
+	return wp.interval
+}
+
+func (wp *weatherPageProvider) refresh() error {
+	if wp.apiKey == "" || wp.location == "" {
+		return fmt.Errorf("weather: api key and location must both be set")
+	}
+
+	query := url.Values{}
+	query.Set("q", wp.location)
+	query.Set("appid", wp.apiKey)
+	query.Set("units", wp.units)
+
+	response, err := wp.httpClient.Get(fmt.Sprintf("%s?%s", openWeatherEndpoint, query.Encode()))
+	if err != nil {
+		return fmt.Errorf("request current weather: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("request current weather: unexpected status %s", response.Status)
+	}
+
+	parsed := openWeatherResponse{}
+	if err := json.NewDecoder(response.Body).Decode(&parsed); err != nil {
+		return fmt.Errorf("decode current weather: %w", err)
+	}
+
+	unitSymbol := "C"
+	if wp.units == weatherUnitsImperial {
+		unitSymbol = "F"
+	}
+
+	text := fmt.Sprintf("%d%s", int(math.Round(parsed.Main.Temp)), unitSymbol)
+	if len(parsed.Weather) > 0 {
+		text = fmt.Sprintf("%s %s", text, parsed.Weather[0].Main)
+	}
+
+	title := parsed.Name
+	if title == "" {
+		title = strings.Split(wp.location, ",")[0]
+	}
+
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+
+	wp.current = &displayPage{
+		Title: title,
+		Text:  text,
+	}
+
+	return nil
+}
+
+func (wp *weatherPageProvider) page() (displayPage, bool) {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+
+	if wp.current == nil {
+		return displayPage{}, false
+	}
+
+	return *wp.current, true
+}
@@ -0,0 +1,428 @@
+package deej
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	apiPathDevicePair       = "/device/pair"
+	apiPathDevicePairFinish = "/device/pair/finish"
+	apiPathDeviceUnpair     = "/device/unpair"
+
+	// how long the user has to compare codes before the new key is thrown away
+	pairingTimeout = 2 * time.Minute
+
+	sessionStartPrefix = "#S:"
+)
+
+// connectionLink is the kind of link a device is connected over, which decides how far it's trusted
+type connectionLink int
+
+const (
+	linkSerial connectionLink = iota
+	linkHID
+
+	// a device that connected to a listen: address, which could be anyone on the network
+	linkNetwork
+
+	// whatever a program embedding deej brought (see transport.go), or the simulated device
+	linkTransport
+)
+
+// local returns whether the link is a cable to this machine, which nobody else can listen in on
+func (link connectionLink) local() bool {
+	return link == linkSerial || link == linkHID
+}
+
+func (link connectionLink) String() string {
+	switch link {
+	case linkSerial:
+		return "serial"
+	case linkHID:
+		return "HID"
+	case linkNetwork:
+		return "network"
+	}
+
+	return "transport"
+}
+
+// deviceSession is the encrypted session with a paired device (see protocol/pairing.go). it's started when the
+// device says hello, and only carries frames once the device has acknowledged it with its own nonce
+type deviceSession struct {
+	pairingKey []byte
+	nonce      []byte
+
+	// nil until the device acknowledges
+	key []byte
+
+	// the last counter sent, and the last one received (which every frame from the device has to be above)
+	sent     uint64
+	received uint64
+}
+
+// pendingPairing is a key handed to the device that the user hasn't confirmed yet
+type pendingPairing struct {
+	id      string
+	key     []byte
+	expires time.Time
+}
+
+// pairingStarted is what the API answers a pairing request with
+type pairingStarted struct {
+	ID   string `json:"id"`
+	Code string `json:"code"`
+}
+
+// PairDevice pairs the device the running deej is connected to, asking the user (on in and out) to check that
+// the code the device shows matches. the device should be connected over a trusted link (like USB) while pairing,
+// after which it only accepts encrypted commands, however it's connected
+func PairDevice(logger *zap.SugaredLogger, in io.Reader, out io.Writer) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	started := pairingStarted{}
+	if err := postLocalAPI(apiAddress+apiPathDevicePair, &started); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Pairing with %s, which should be showing the code %s\n", started.ID, started.Code)
+	fmt.Fprint(out, "Does it? [y/N] ")
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	accept := answer == "y" || answer == "yes"
+
+	finish := fmt.Sprintf("%s%s?accept=%t", apiAddress, apiPathDevicePairFinish, accept)
+	if err := postLocalAPI(finish, nil); err != nil {
+		return err
+	}
+
+	if !accept {
+		return errors.New("pairing cancelled, the codes didn't match")
+	}
+
+	fmt.Fprintf(out, "Paired with %s\n", started.ID)
+
+	return nil
+}
+
+// UnpairDevice forgets a paired device's key, after which deej takes unencrypted lines from it again.
+// the device keeps its key until it's paired again or reset
+func UnpairDevice(logger *zap.SugaredLogger, out io.Writer, id string) error {
+	apiAddress, err := localAPIAddress(logger)
+	if err != nil {
+		return err
+	}
+
+	if err := postLocalAPI(apiAddress+apiPathDeviceUnpair+"?id="+url.QueryEscape(id), nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Forgot the pairing with %s\n", id)
+
+	return nil
+}
+
+// handleDevicePair hands the connected device a new key, and answers with the code it should be showing
+func (as *apiServer) handleDevicePair(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	started, err := as.deej.serial.startPairing()
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(started); err != nil {
+		as.logger.Debugw("Failed to write pairing response", "error", err)
+	}
+}
+
+// handleDevicePairFinish keeps the key handed out by handleDevicePair (with accept=true) or throws it away
+func (as *apiServer) handleDevicePairFinish(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := as.deej.serial.finishPairing(request.URL.Query().Get("accept") == "true"); err != nil {
+		http.Error(writer, err.Error(), http.StatusConflict)
+	}
+}
+
+// handleDeviceUnpair forgets the key for the device with the given ID
+func (as *apiServer) handleDeviceUnpair(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodPost {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	if _, ok := as.deej.serial.pairingKey(id); !ok {
+		http.Error(writer, "no device paired with that ID", http.StatusNotFound)
+		return
+	}
+
+	as.deej.state.update(func(state *persistedState) {
+		delete(state.PairedDevices, strings.ToLower(id))
+	})
+
+	as.logger.Infow("Forgot paired device", "id", id)
+}
+
+// startPairing hands the connected device a new key to show the code for. it's kept once the user confirms
+func (sio *SerialIO) startPairing() (pairingStarted, error) {
+	if !sio.isConnected() {
+		return pairingStarted{}, errors.New("no device connected")
+	}
+
+	// the key goes to the device in the clear, so only over a cable
+	if !sio.link.local() {
+		return pairingStarted{}, fmt.Errorf("the device is connected over a %s link, which isn't safe to hand it a key "+
+			"over - connect it with USB (serial or HID) to pair it", sio.link)
+	}
+
+	// keys are kept by ID, so that it doesn't matter which port or transport the device shows up on
+	if sio.deviceIdentity == "" {
+		return pairingStarted{}, errors.New("the device didn't report an ID, which pairing needs")
+	}
+
+	key := make([]byte, protocol.PairingKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return pairingStarted{}, fmt.Errorf("generate pairing key: %w", err)
+	}
+
+	sio.sessionLock.Lock()
+	sio.pairing = &pendingPairing{
+		id:      sio.deviceIdentity,
+		key:     key,
+		expires: time.Now().Add(pairingTimeout),
+	}
+	sio.sessionLock.Unlock()
+
+	if err := sio.writeCommand(protocol.Pair(key)); err != nil {
+		return pairingStarted{}, fmt.Errorf("send pairing key: %w", err)
+	}
+
+	sio.logger.Infow("Started pairing", "id", sio.deviceIdentity)
+
+	return pairingStarted{ID: sio.deviceIdentity, Code: protocol.PairingCode(key)}, nil
+}
+
+// finishPairing keeps the pending key or throws it away, and lets the device know which
+func (sio *SerialIO) finishPairing(accept bool) error {
+	sio.sessionLock.Lock()
+	pairing := sio.pairing
+	sio.pairing = nil
+	sio.sessionLock.Unlock()
+
+	if pairing == nil || time.Now().After(pairing.expires) {
+		return errors.New("no pairing in progress (it may have timed out)")
+	}
+
+	if accept {
+		if err := sio.deej.state.updateNow(func(state *persistedState) {
+			state.PairedDevices[strings.ToLower(pairing.id)] = hex.EncodeToString(pairing.key)
+		}); err != nil {
+			return fmt.Errorf("save pairing key: %w", err)
+		}
+
+		sio.logger.Infow("Paired with device", "id", pairing.id)
+	} else {
+		sio.logger.Infow("Pairing cancelled", "id", pairing.id)
+	}
+
+	if !sio.isConnected() {
+		return nil
+	}
+
+	// the device says hello again once it takes the key, which starts the first session
+	if err := sio.writeCommand(protocol.PairResult(accept)); err != nil {
+		return fmt.Errorf("send pairing result: %w", err)
+	}
+
+	return nil
+}
+
+// pairingKey returns the key the device with the given ID was paired with, if it was
+func (sio *SerialIO) pairingKey(id string) ([]byte, bool) {
+	if id == "" {
+		return nil, false
+	}
+
+	var encoded string
+	sio.deej.state.view(func(state *persistedState) {
+		encoded = state.PairedDevices[strings.ToLower(id)]
+	})
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil || len(key) != protocol.PairingKeySize {
+		return nil, false
+	}
+
+	return key, true
+}
+
+// pairedKey returns the key of the paired device deej is (or is supposed to be) talking to, if any. when the
+// device was looked up by an ID that's paired, anything claiming to be it has to prove it
+func (sio *SerialIO) pairedKey() ([]byte, bool) {
+	if key, ok := sio.pairingKey(sio.wantedIdentity); ok {
+		return key, true
+	}
+
+	return sio.pairingKey(sio.deviceIdentity)
+}
+
+// startSession begins an encrypted session with a paired device once it says hello, returning whether it did
+// (or one is already up). a device with a paired ID that doesn't offer one is someone else's (or one that lost
+// its key), and nothing it sends is trusted
+func (sio *SerialIO) startSession(logger *zap.SugaredLogger, hello deviceHello) bool {
+	key, ok := sio.pairedKey()
+	if !ok {
+		if sio.link == linkNetwork {
+			logger.Warnw("Network device isn't paired, ignoring it until it's paired over USB", "id", hello.ID)
+		}
+
+		return false
+	}
+
+	if !hello.Secure {
+		logger.Warnw("Device has a paired ID but didn't offer an encrypted session, ignoring it", "id", hello.ID)
+		sio.deej.notifier.Notify("Unpaired device ignored",
+			fmt.Sprintf("A device claiming to be %s couldn't prove it. If you reset it, pair it again.", hello.ID))
+
+		return false
+	}
+
+	nonce := make([]byte, protocol.SessionNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		logger.Warnw("Failed to generate session nonce", "error", err)
+		return false
+	}
+
+	sio.sessionLock.Lock()
+	if sio.session != nil && sio.session.key != nil {
+		sio.sessionLock.Unlock()
+		return true
+	}
+
+	sio.session = &deviceSession{pairingKey: key, nonce: nonce}
+	sio.sessionLock.Unlock()
+
+	logger.Debug("Starting encrypted session")
+
+	if err := sio.writeCommand(protocol.StartSession(nonce)); err != nil {
+		logger.Warnw("Failed to start encrypted session", "error", err)
+	}
+
+	return true
+}
+
+// acknowledgeSession finishes starting the session when the device answers with its nonce, as the last line
+// it sends unsealed. everything after it is read as sealed frames
+func (sio *SerialIO) acknowledgeSession(logger *zap.SugaredLogger, line string) {
+	deviceNonce, err := hex.DecodeString(strings.TrimSpace(strings.TrimPrefix(line, sessionStartPrefix)))
+	if err != nil || len(deviceNonce) != protocol.SessionNonceSize {
+		logger.Warnw("Got malformed session acknowledgement, ignoring", "line", line)
+		return
+	}
+
+	sio.sessionLock.Lock()
+	session := sio.session
+	if session == nil || session.key != nil {
+		sio.sessionLock.Unlock()
+		return
+	}
+
+	session.key = protocol.SessionKey(session.pairingKey, session.nonce, deviceNonce)
+	sio.sessionLock.Unlock()
+
+	sio.setFraming(protocol.FramingBinary)
+	logger.Info("Encrypted session started")
+}
+
+// secured returns whether frames are going through an encrypted session
+func (sio *SerialIO) secured() bool {
+	sio.sessionLock.Lock()
+	defer sio.sessionLock.Unlock()
+
+	return sio.session != nil && sio.session.key != nil
+}
+
+// trustedLine returns whether a line should be handled. until a paired device's session is up, only what it
+// takes to start one is. devices on the network always need one, paired or not, as anyone could be connecting
+func (sio *SerialIO) trustedLine(line string) bool {
+	if sio.secured() {
+		return true
+	}
+
+	if _, ok := sio.pairedKey(); !ok && sio.link != linkNetwork {
+		return true
+	}
+
+	return strings.HasPrefix(line, deviceHelloPrefix) || strings.HasPrefix(line, sessionStartPrefix)
+}
+
+// sealFrame encrypts a frame for the session
+func (sio *SerialIO) sealFrame(command string) ([]byte, error) {
+	sio.sessionLock.Lock()
+	defer sio.sessionLock.Unlock()
+
+	sio.session.sent++
+	kind, payload := protocol.BinaryPayload(command)
+
+	return protocol.Seal(sio.session.key, protocol.SealedToDevice, sio.session.sent, kind, payload)
+}
+
+// unsealFrame decrypts a sealed frame from the device, refusing any that were replayed
+func (sio *SerialIO) unsealFrame(payload []byte) (byte, []byte, error) {
+	sio.sessionLock.Lock()
+	defer sio.sessionLock.Unlock()
+
+	if sio.session == nil || sio.session.key == nil {
+		return 0, nil, errors.New("sealed frame outside of a session")
+	}
+
+	counter, kind, inner, err := protocol.Unseal(sio.session.key, protocol.SealedFromDevice, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if counter <= sio.session.received {
+		return 0, nil, fmt.Errorf("replayed sealed frame (counter %d)", counter)
+	}
+
+	sio.session.received = counter
+
+	return kind, inner, nil
+}
+
+// forgetSession ends the session, for whatever connects next to start its own
+func (sio *SerialIO) forgetSession() {
+	sio.sessionLock.Lock()
+	defer sio.sessionLock.Unlock()
+
+	sio.session = nil
+}
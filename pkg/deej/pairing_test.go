@@ -0,0 +1,90 @@
+package deej
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// anyone on the network can connect to a listen: address, so what they send doesn't count without a session
+func TestNetworkListenerDropsUnsealedLines(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	d, err := newSimulatedDeej(logger, newSimulatedSessionFinder(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sio := d.serial
+
+	listener, err := sio.networkListener("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// connecting before deej accepts leaves the connection in the listener's backlog, like a device would
+	device, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer device.Close()
+
+	if err := sio.openListener(deviceConnection{Listen: "127.0.0.1:0"}); err != nil {
+		t.Fatal(err)
+	}
+	defer sio.conn.Close()
+
+	moves := sio.SubscribeToSliderMoveEvents()
+	defer moves.Close()
+
+	fmt.Fprint(device, "512|1023\r\n")
+
+	line, err := bufio.NewReader(sio.conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sio.handleLine(logger, line)
+
+	if len(moves.Events) > 0 {
+		t.Fatalf("unsealed line %q from the network moved a slider: %+v", line, <-moves.Events)
+	}
+
+	// the same line over a cable does move them, so it was the link that got it dropped
+	sio.link = linkSerial
+	sio.handleLine(logger, line)
+
+	if len(moves.Events) == 0 {
+		t.Errorf("line %q over serial didn't move any sliders", line)
+	}
+}
+
+func TestPairingRefusedOverNetwork(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+
+	d, err := newSimulatedDeej(logger, newSimulatedSessionFinder(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sio := d.serial
+	sio.connected = true
+	sio.conn = &transportPort{}
+	sio.deviceIdentity = "deej-4"
+
+	for _, link := range []connectionLink{linkNetwork, linkTransport} {
+		sio.link = link
+
+		if _, err := sio.startPairing(); err == nil {
+			t.Errorf("pairing started over a %s link", link)
+		}
+
+		if sio.pairing != nil {
+			t.Errorf("pairing over a %s link left a key pending", link)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package deej
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -29,6 +30,12 @@ Stack trace:
 %s
 -----------------------------------------------------------------
 `
+
+	// a subsystem that panics is restarted after a moment, unless it's crashed this many times within the window,
+	// in which case it's probably going to keep doing it
+	subsystemRestartDelay = time.Second
+	subsystemCrashLimit   = 3
+	subsystemCrashWindow  = 5 * time.Minute
 )
 
 func (d *Deej) recoverFromPanic() {
@@ -39,19 +46,16 @@ func (d *Deej) recoverFromPanic() {
 	}
 
 	// if we got here, we're recovering from a panic!
-	now := time.Now()
-
-	// that would suck
-	if err := util.EnsureDirExists(logDirectory); err != nil {
-		panic(fmt.Errorf("ensure crashlog dir exists: %w", err))
-	}
+	d.crash(r, debug.Stack())
+}
 
-	crashlogBytes := bytes.NewBufferString(fmt.Sprintf(crashMessage, now.Format(crashlogTimestampFormat), r, debug.Stack()))
-	crashlogPath := filepath.Join(logDirectory, fmt.Sprintf(crashlogFilename, now.Format(crashlogTimestampFormat)))
+// crash writes a crashlog for the given panic, tells the user and exits
+func (d *Deej) crash(r interface{}, stack []byte) {
+	crashlogPath, err := writeCrashlog(r, stack)
 
 	// that would REALLY suck
-	if err := ioutil.WriteFile(crashlogPath, crashlogBytes.Bytes(), os.ModePerm); err != nil {
-		panic(fmt.Errorf("can't even write the crashlog file contents: %w", err))
+	if err != nil {
+		panic(err)
 	}
 
 	d.logger.Errorw("Encountered and logged panic, crashing",
@@ -62,7 +66,98 @@ func (d *Deej) recoverFromPanic() {
 		fmt.Sprintf("More details in %s", crashlogPath))
 
 	// bye :(
+	d.panicked = true
 	d.signalStop()
 	d.logger.Errorw("Quitting", "exitCode", 1)
 	os.Exit(1)
 }
+
+// supervise runs one of deej's long-running loops until it returns, restarting it if it panics rather than
+// letting it take the rest of deej down too. each panic is logged with its stack, written to a crashlog and
+// shown to the user. a loop that keeps panicking (see subsystemCrashLimit) crashes deej after all, which is
+// what gets safe mode going (see safe_mode.go)
+func (d *Deej) supervise(ctx context.Context, name string, loop func()) {
+	var crashes []time.Time
+
+	for {
+		r, stack := runRecovering(loop)
+		if r == nil {
+			return
+		}
+
+		now := time.Now()
+
+		recent := crashes[:0]
+		for _, crashed := range crashes {
+			if now.Sub(crashed) < subsystemCrashWindow {
+				recent = append(recent, crashed)
+			}
+		}
+
+		crashes = append(recent, now)
+
+		if len(crashes) >= subsystemCrashLimit {
+			d.logger.Errorw("Subsystem keeps crashing, giving up on it",
+				"subsystem", name,
+				"crashes", len(crashes),
+				"within", subsystemCrashWindow)
+
+			d.crash(r, stack)
+		}
+
+		details := "More details are in the logs"
+
+		crashlogPath, err := writeCrashlog(r, stack)
+		if err != nil {
+			d.logger.Warnw("Failed to write crashlog", "error", err)
+		} else {
+			details = fmt.Sprintf("More details in %s", crashlogPath)
+		}
+
+		d.logger.Errorw("Subsystem crashed, restarting it",
+			"subsystem", name,
+			"error", r,
+			"crashlogPath", crashlogPath,
+			"stack", string(stack))
+
+		d.notifier.Notify(fmt.Sprintf("deej's %s crashed and was restarted", name), details)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(subsystemRestartDelay):
+		}
+	}
+}
+
+// runRecovering runs the given function, returning what it panicked with and where, if it did
+func runRecovering(run func()) (recovered interface{}, stack []byte) {
+	defer func() {
+		if recovered = recover(); recovered != nil {
+			stack = debug.Stack()
+		}
+	}()
+
+	run()
+
+	return nil, nil
+}
+
+// writeCrashlog writes the given panic and its stack to a new crashlog, returning its path
+func writeCrashlog(r interface{}, stack []byte) (string, error) {
+	now := time.Now()
+
+	// that would suck
+	if err := util.EnsureDirExists(logDirectory); err != nil {
+		return "", fmt.Errorf("ensure crashlog dir exists: %w", err)
+	}
+
+	crashlogBytes := bytes.NewBufferString(fmt.Sprintf(crashMessage, now.Format(crashlogTimestampFormat), r, stack))
+	crashlogPath := filepath.Join(logDirectory, fmt.Sprintf(crashlogFilename, now.Format(crashlogTimestampFormat)))
+
+	if err := ioutil.WriteFile(crashlogPath, crashlogBytes.Bytes(), os.ModePerm); err != nil {
+		return "", fmt.Errorf("can't even write the crashlog file contents: %w", err)
+	}
+
+	return crashlogPath, nil
+}
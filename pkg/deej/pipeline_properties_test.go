@@ -0,0 +1,508 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	pipelineCheckNumSliders = 4
+
+	// how many random cases every property is checked against, and with -short
+	pipelineCheckCases      = 1000
+	pipelineCheckShortCases = 100
+
+	// the slowest filter we generate, and enough readings for it to settle from anywhere
+	pipelineCheckMinFilterAlpha = 0.05
+	pipelineCheckSettleReadings = 400
+
+	// how many readings a random movement or sweep runs for, at most
+	pipelineCheckMaxReadings  = 50
+	pipelineCheckMaxSweepStep = 60
+
+	// how far off float32 can be from the number it's meant to hold, between 0 and 1
+	pipelineCheckRoundingError = 0.000001
+)
+
+// pipelineProperty is an invariant of the slider pipeline, checked against a single random case at a time.
+// check returns a description of the case if the invariant doesn't hold for it
+type pipelineProperty struct {
+	name  string
+	check func(rng *rand.Rand, pc *pipelineChecker) error
+}
+
+var pipelineProperties = []pipelineProperty{
+	{"calibration stays within 0-1", checkCalibrationRange},
+	{"calibration never decreases as a slider moves up", checkCalibrationMonotonic},
+	{"curves stay within 0-1", checkCurveRange},
+	{"curves with rising points never decrease", checkCurveMonotonic},
+	{"curves keep their ends", checkCurveEnds},
+	{"smoothing stays within the range of its readings", checkFilterRange},
+	{"smoothing settles exactly on a steady reading", checkFilterSettles},
+	{"normalization is idempotent", checkNormalizationIdempotent},
+	{"the pipeline only sets volumes within 0-1", checkPipelineRange},
+	{"sweeping a slider moves its volume one way", checkPipelineSweep},
+	{"a slider at rest stops sending moves", checkPipelineRest},
+}
+
+// TestSliderPipelineProperties checks invariants of the slider pipeline (calibration, smoothing, normalization,
+// inversion and curves) against random cases, so that changes to how slider values are mapped can't quietly
+// break them. every case comes from its own seed, which a failure reports so it can be reproduced
+func TestSliderPipelineProperties(t *testing.T) {
+
+	// the pipeline logs every case's slider detection, which would drown out the results
+	pc, err := newPipelineChecker(zap.NewNop().Sugar())
+	if err != nil {
+		t.Fatalf("create pipeline checker: %v", err)
+	}
+
+	config := &quick.Config{MaxCount: pipelineCheckCases}
+	if testing.Short() {
+		config.MaxCount = pipelineCheckShortCases
+	}
+
+	for _, property := range pipelineProperties {
+		property := property
+
+		t.Run(property.name, func(t *testing.T) {
+			var failure error
+
+			if err := quick.Check(func(seed int64) bool {
+				failure = property.check(rand.New(rand.NewSource(seed)), pc)
+				return failure == nil
+			}, config); err != nil {
+				t.Errorf("%v: %v", err, failure)
+			}
+		})
+	}
+}
+
+// pipelineChecker feeds lines through a simulated deej's slider handling, as configured by a pipelineCase
+type pipelineChecker struct {
+	logger     *zap.SugaredLogger
+	deej       *Deej
+	moveEvents <-chan SliderMoveEvent
+}
+
+func newPipelineChecker(logger *zap.SugaredLogger) (*pipelineChecker, error) {
+	d, err := newSimulatedDeej(logger, newSimulatedSessionFinder(logger))
+	if err != nil {
+		return nil, err
+	}
+
+	pc := &pipelineChecker{
+		logger:     logger,
+		deej:       d,
+		moveEvents: d.serial.SubscribeToSliderMoveEvents().Events,
+	}
+
+	return pc, nil
+}
+
+// configure sets up the given case, starting every slider from scratch (like a fresh connection would)
+func (pc *pipelineChecker) configure(pipelineCase pipelineCase) {
+	config := pc.deej.config
+
+	config.SliderCalibrations = pipelineCase.calibrations
+	config.SliderSmoothing = pipelineCase.smoothing
+	config.SliderCurves = pipelineCase.curves
+	config.InvertSliders = pipelineCase.inverted
+	config.NoiseReductionLevel = pipelineCase.noiseReduction
+
+	pc.deej.serial.lastKnownNumSliders = 0
+}
+
+// feed sends a single line of raw values through the pipeline, returning the move events it caused
+func (pc *pipelineChecker) feed(rawValues []int) []SliderMoveEvent {
+	parts := make([]string, len(rawValues))
+	for sliderIdx, raw := range rawValues {
+		parts[sliderIdx] = fmt.Sprint(raw)
+	}
+
+	pc.deej.serial.handleLine(pc.logger, strings.Join(parts, "|")+"\r\n")
+
+	events := []SliderMoveEvent{}
+	for {
+		select {
+		case event := <-pc.moveEvents:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+// pipelineCase is a randomly generated per-slider configuration
+type pipelineCase struct {
+	calibrations   map[int]sliderCalibration
+	smoothing      map[int]sliderSmoothing
+	curves         map[int]sliderCurve
+	inverted       sliderSet
+	noiseReduction string
+}
+
+// randomPipelineCase generates a configuration, leaving each part unset for some sliders.
+// curves are kept rising when monotonic is set, as falling custom curves are a legitimate (if odd) choice
+func randomPipelineCase(rng *rand.Rand, monotonic bool) pipelineCase {
+	pipelineCase := pipelineCase{
+		calibrations:   map[int]sliderCalibration{},
+		smoothing:      map[int]sliderSmoothing{},
+		curves:         map[int]sliderCurve{},
+		inverted:       newSliderSet(),
+		noiseReduction: []string{"low", "", "high"}[rng.Intn(3)],
+	}
+
+	for sliderIdx := 0; sliderIdx < pipelineCheckNumSliders; sliderIdx++ {
+		if rng.Intn(2) == 0 {
+			pipelineCase.calibrations[sliderIdx] = randomCalibration(rng)
+		}
+
+		if rng.Intn(2) == 0 {
+			pipelineCase.smoothing[sliderIdx] = randomSmoothing(rng)
+		}
+
+		if rng.Intn(2) == 0 {
+			pipelineCase.curves[sliderIdx] = randomCurve(rng, monotonic)
+		}
+
+		if rng.Intn(4) == 0 {
+			pipelineCase.inverted.indices[sliderIdx] = true
+		}
+	}
+
+	return pipelineCase
+}
+
+func (pipelineCase pipelineCase) String() string {
+	return fmt.Sprintf("calibrations %v, smoothing %v, curves %v, inverted %v, noise reduction %q",
+		pipelineCase.calibrations, pipelineCase.smoothing, pipelineCase.curves,
+		pipelineCase.inverted, pipelineCase.noiseReduction)
+}
+
+// randomCalibration generates a calibration the config would accept
+func randomCalibration(rng *rand.Rand) sliderCalibration {
+	return sliderCalibration{
+		RawMin:         rng.Intn(400),
+		RawMax:         maxRawSliderValue - rng.Intn(400),
+		DeadzoneBottom: float32(rng.Intn(51)) / 100,
+		DeadzoneTop:    float32(rng.Intn(51)) / 100,
+	}
+}
+
+// randomSmoothing generates smoothing settings the config would accept
+func randomSmoothing(rng *rand.Rand) sliderSmoothing {
+	smoothing := sliderSmoothing{
+		Filter: sliderFilterEMA,
+		Alpha:  pipelineCheckMinFilterAlpha + rng.Float32()*(1-pipelineCheckMinFilterAlpha),
+		Window: 1 + rng.Intn(maxSliderFilterWindow),
+		Bypass: float32(1+rng.Intn(100)) / 100,
+	}
+
+	if rng.Intn(2) == 0 {
+		smoothing.Filter = sliderFilterMedian
+	}
+
+	return smoothing
+}
+
+func randomCurve(rng *rand.Rand, monotonic bool) sliderCurve {
+	switch rng.Intn(4) {
+	case 0:
+		return sliderCurve{kind: sliderCurveLinear}
+	case 1:
+		return sliderCurve{kind: sliderCurveLog}
+	case 2:
+		return sliderCurve{kind: sliderCurveExponential}
+	}
+
+	points := make([]float32, 2+rng.Intn(7))
+	for pointIdx := range points {
+		points[pointIdx] = float32(rng.Intn(101)) / 100
+	}
+
+	if monotonic {
+		sort.Slice(points, func(i, j int) bool { return points[i] < points[j] })
+	}
+
+	return sliderCurve{kind: sliderCurveCustom, points: points}
+}
+
+// randomScalar returns a value between 0 and 1, favoring the ends and round percentages a little
+func randomScalar(rng *rand.Rand) float32 {
+	switch rng.Intn(5) {
+	case 0:
+		return float32(rng.Intn(2))
+	case 1:
+		return float32(rng.Intn(101)) / 100
+	}
+
+	return rng.Float32()
+}
+
+func withinUnitRange(value float32) bool {
+	return value >= 0 && value <= 1 && !math.IsNaN(float64(value))
+}
+
+func checkCalibrationRange(rng *rand.Rand, pc *pipelineChecker) error {
+	calibration := randomCalibration(rng)
+
+	// raw values past the ends do show up, from dirty lines and firmware quirks
+	raw := rng.Intn(maxRawSliderValue+201) - 100
+
+	if value := calibration.apply(raw); !withinUnitRange(value) {
+		return fmt.Errorf("calibration %+v maps raw %d to %v", calibration, raw, value)
+	}
+
+	return nil
+}
+
+func checkCalibrationMonotonic(rng *rand.Rand, pc *pipelineChecker) error {
+	calibration := randomCalibration(rng)
+
+	lower := rng.Intn(maxRawSliderValue + 1)
+	higher := lower + rng.Intn(maxRawSliderValue+1-lower)
+
+	if calibration.apply(lower) > calibration.apply(higher) {
+		return fmt.Errorf("calibration %+v maps raw %d to %v, but raw %d to %v",
+			calibration, lower, calibration.apply(lower), higher, calibration.apply(higher))
+	}
+
+	return nil
+}
+
+func checkCurveRange(rng *rand.Rand, pc *pipelineChecker) error {
+	curve := randomCurve(rng, false)
+	value := randomScalar(rng)
+
+	if shaped := curve.apply(value); !withinUnitRange(shaped) {
+		return fmt.Errorf("curve %+v maps %v to %v", curve, value, shaped)
+	}
+
+	return nil
+}
+
+// checkCurveMonotonic compares normalized values, as that's what the pipeline sends - a curve's raw output
+// can wobble by a rounding error where custom curve segments meet, which doesn't matter to anyone
+func checkCurveMonotonic(rng *rand.Rand, pc *pipelineChecker) error {
+	curve := randomCurve(rng, true)
+
+	lower := randomScalar(rng)
+	higher := lower + rng.Float32()*(1-lower)
+
+	lowerShaped := util.NormalizeScalar(curve.apply(lower))
+	higherShaped := util.NormalizeScalar(curve.apply(higher))
+
+	if lowerShaped > higherShaped {
+		return fmt.Errorf("curve %+v maps %v to %v, but %v to %v", curve, lower, lowerShaped, higher, higherShaped)
+	}
+
+	return nil
+}
+
+func checkCurveEnds(rng *rand.Rand, pc *pipelineChecker) error {
+	curve := randomCurve(rng, false)
+
+	expectedBottom, expectedTop := float32(0), float32(1)
+	if curve.kind == sliderCurveCustom {
+		expectedBottom, expectedTop = curve.points[0], curve.points[len(curve.points)-1]
+	}
+
+	bottom := util.NormalizeScalar(curve.apply(0))
+	top := util.NormalizeScalar(curve.apply(1))
+
+	if bottom != util.NormalizeScalar(expectedBottom) || top != util.NormalizeScalar(expectedTop) {
+		return fmt.Errorf("curve %+v maps 0-1 to %v-%v, expected %v-%v", curve, bottom, top, expectedBottom, expectedTop)
+	}
+
+	return nil
+}
+
+func checkFilterRange(rng *rand.Rand, pc *pipelineChecker) error {
+	smoothing := randomSmoothing(rng)
+	filter := newSliderFilter(smoothing)
+
+	lowest, highest := float32(1), float32(0)
+
+	for readingIdx := 0; readingIdx < 1+rng.Intn(pipelineCheckMaxReadings); readingIdx++ {
+		reading := randomScalar(rng)
+		lowest = float32(math.Min(float64(lowest), float64(reading)))
+		highest = float32(math.Max(float64(highest), float64(reading)))
+
+		if smoothed := filter.apply(reading); smoothed < lowest || smoothed > highest {
+			return fmt.Errorf("filter %+v smoothed reading #%d (%v) to %v, outside of its readings' %v-%v",
+				smoothing, readingIdx+1, reading, smoothed, lowest, highest)
+		}
+	}
+
+	return nil
+}
+
+// checkFilterSettles makes sure a slider left alone ends up exactly where it is - a filter settling a hair
+// below a round value would make the pipeline's normalization drop a whole percent
+func checkFilterSettles(rng *rand.Rand, pc *pipelineChecker) error {
+	smoothing := randomSmoothing(rng)
+	filter := newSliderFilter(smoothing)
+
+	for readingIdx := 0; readingIdx < rng.Intn(pipelineCheckMaxReadings); readingIdx++ {
+		filter.apply(randomScalar(rng))
+	}
+
+	steady := randomScalar(rng)
+
+	var smoothed float32
+	for readingIdx := 0; readingIdx < pipelineCheckSettleReadings; readingIdx++ {
+		smoothed = filter.apply(steady)
+	}
+
+	if smoothed != steady {
+		return fmt.Errorf("filter %+v settled on %v for a steady %v", smoothing, smoothed, steady)
+	}
+
+	if again := filter.apply(steady); again != smoothed {
+		return fmt.Errorf("filter %+v moved from %v to %v on another steady %v", smoothing, smoothed, again, steady)
+	}
+
+	return nil
+}
+
+func checkNormalizationIdempotent(rng *rand.Rand, pc *pipelineChecker) error {
+	value := randomScalar(rng)
+
+	once := util.NormalizeScalar(value)
+	twice := util.NormalizeScalar(once)
+
+	if once != twice {
+		return fmt.Errorf("%v normalizes to %v, which normalizes to %v", value, once, twice)
+	}
+
+	// normalizing only ever rounds down (give or take a rounding error), and by less than a percent
+	if difference := float64(value) - float64(once); difference < -pipelineCheckRoundingError || difference >= 0.01 {
+		return fmt.Errorf("%v normalizes to %v, more than a percent away", value, once)
+	}
+
+	return nil
+}
+
+func checkPipelineRange(rng *rand.Rand, pc *pipelineChecker) error {
+	pipelineCase := randomPipelineCase(rng, false)
+	pc.configure(pipelineCase)
+
+	for lineIdx := 0; lineIdx < 1+rng.Intn(pipelineCheckMaxReadings); lineIdx++ {
+		rawValues := make([]int, pipelineCheckNumSliders)
+		for sliderIdx := range rawValues {
+			rawValues[sliderIdx] = rng.Intn(maxRawSliderValue + 1)
+
+			// only the first value is checked for being in range, the others can come in dirty
+			if sliderIdx > 0 && rng.Intn(20) == 0 {
+				rawValues[sliderIdx] = rng.Intn(3*maxRawSliderValue) - maxRawSliderValue
+			}
+		}
+
+		for _, event := range pc.feed(rawValues) {
+			if !withinUnitRange(event.PercentValue) {
+				return fmt.Errorf("line %v set slider %d to %v with %v",
+					rawValues, event.SliderID, event.PercentValue, pipelineCase)
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkPipelineSweep(rng *rand.Rand, pc *pipelineChecker) error {
+	pipelineCase := randomPipelineCase(rng, true)
+	pc.configure(pipelineCase)
+
+	// every slider sweeps from somewhere to somewhere else, at its own pace
+	rawValues := make([]int, pipelineCheckNumSliders)
+	targets := make([]int, pipelineCheckNumSliders)
+	steps := make([]int, pipelineCheckNumSliders)
+
+	for sliderIdx := range rawValues {
+		rawValues[sliderIdx] = rng.Intn(maxRawSliderValue + 1)
+		targets[sliderIdx] = rng.Intn(maxRawSliderValue + 1)
+		steps[sliderIdx] = 1 + rng.Intn(pipelineCheckMaxSweepStep)
+	}
+
+	rising := make([]bool, pipelineCheckNumSliders)
+	for sliderIdx := range rawValues {
+		rising[sliderIdx] = targets[sliderIdx] >= rawValues[sliderIdx] != pipelineCase.inverted.contains(sliderIdx)
+	}
+
+	lastValues := map[int]float32{}
+
+	for moving := true; moving; {
+		for _, event := range pc.feed(rawValues) {
+			sliderIdx := event.SliderID
+			last, ok := lastValues[sliderIdx]
+
+			if ok && (rising[sliderIdx] && event.PercentValue < last || !rising[sliderIdx] && event.PercentValue > last) {
+				return fmt.Errorf("slider %d went from %v to %v while sweeping towards raw %d (now at %d) with %v",
+					sliderIdx, last, event.PercentValue, targets[sliderIdx], rawValues[sliderIdx], pipelineCase)
+			}
+
+			lastValues[sliderIdx] = event.PercentValue
+		}
+
+		moving = false
+		for sliderIdx := range rawValues {
+			remaining := targets[sliderIdx] - rawValues[sliderIdx]
+			if remaining == 0 {
+				continue
+			}
+
+			moving = true
+
+			step := steps[sliderIdx]
+			if remaining < 0 {
+				step = -step
+			}
+
+			if math.Abs(float64(step)) > math.Abs(float64(remaining)) {
+				step = remaining
+			}
+
+			rawValues[sliderIdx] += step
+		}
+	}
+
+	return nil
+}
+
+func checkPipelineRest(rng *rand.Rand, pc *pipelineChecker) error {
+	pipelineCase := randomPipelineCase(rng, false)
+	pc.configure(pipelineCase)
+
+	randomLine := func() []int {
+		rawValues := make([]int, pipelineCheckNumSliders)
+		for sliderIdx := range rawValues {
+			rawValues[sliderIdx] = rng.Intn(maxRawSliderValue + 1)
+		}
+
+		return rawValues
+	}
+
+	for lineIdx := 0; lineIdx < rng.Intn(pipelineCheckMaxReadings); lineIdx++ {
+		pc.feed(randomLine())
+	}
+
+	resting := randomLine()
+	for lineIdx := 0; lineIdx < pipelineCheckSettleReadings; lineIdx++ {
+		pc.feed(resting)
+	}
+
+	if events := pc.feed(resting); len(events) > 0 {
+		return fmt.Errorf("sliders resting at %v still moved (%v) with %v", resting, events, pipelineCase)
+	}
+
+	return nil
+}
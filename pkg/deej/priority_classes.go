@@ -0,0 +1,97 @@
+package deej
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// priorityClass groups targets that automation features should treat differently to the rest: protected ones
+// (screen readers, alarms) are never ducked, capped or muted by deej on its own, others duck more or less than usual
+type priorityClass struct {
+	Name    string
+	Targets []string
+
+	// never touched by ducking, quiet hours, do not disturb, focus phases or scheduled mutes
+	Protected bool
+
+	// how much of the usual ducking amount these targets get (0 to never duck them, 2 to duck them twice as far)
+	Duck float32
+}
+
+func (cc *CanonicalConfig) populatePriorityClasses() {
+	cc.PriorityClasses = nil
+
+	for name := range cc.userConfig.GetStringMap(configKeyPriorityClasses) {
+		key := func(field string) string {
+			return fmt.Sprintf("%s.%s.%s", configKeyPriorityClasses, name, field)
+		}
+
+		class := priorityClass{
+			Name:      strings.ToLower(name),
+			Targets:   normalizeTargets(cc.userConfig.GetStringSlice(key("targets"))),
+			Protected: cc.userConfig.GetBool(key("protected")),
+			Duck:      1,
+		}
+
+		if cc.userConfig.IsSet(key("duck")) {
+			class.Duck = float32(cc.userConfig.GetFloat64(key("duck")))
+		}
+
+		if class.Duck < 0 {
+			cc.logger.Warnw("Invalid priority class duck amount, using default",
+				"key", key("duck"),
+				"invalidValue", class.Duck,
+				"defaultValue", 1)
+
+			class.Duck = 1
+		}
+
+		if class.Protected {
+			class.Duck = 0
+		}
+
+		if len(class.Targets) == 0 {
+			cc.logger.Warnw("Ignoring priority class without targets", "name", name)
+			continue
+		}
+
+		cc.PriorityClasses = append(cc.PriorityClasses, class)
+	}
+
+	// a target listed in several classes belongs to the first one by name, whichever order the file has them in
+	sort.Slice(cc.PriorityClasses, func(i, j int) bool {
+		return cc.PriorityClasses[i].Name < cc.PriorityClasses[j].Name
+	})
+}
+
+// priorityClassOf returns the class a target or session key belongs to, if any
+func (cc *CanonicalConfig) priorityClassOf(target string) (priorityClass, bool) {
+	target = normalizeTarget(target)
+
+	for _, class := range cc.PriorityClasses {
+		for _, classTarget := range class.Targets {
+			if classTarget == target || targetMatchesName(classTarget, target) {
+				return class, true
+			}
+		}
+	}
+
+	return priorityClass{}, false
+}
+
+// automationExempt tells whether automation features should leave a target or session key alone
+func (cc *CanonicalConfig) automationExempt(target string) bool {
+	class, ok := cc.priorityClassOf(target)
+	return ok && class.Protected
+}
+
+// duckFactor is how much of the ducking amount a target gets, 1 unless its class says otherwise
+func (cc *CanonicalConfig) duckFactor(target string) float32 {
+	class, ok := cc.priorityClassOf(target)
+	if !ok {
+		return 1
+	}
+
+	return class.Duck
+}
@@ -1,11 +1,17 @@
 package deej
 
 import (
+	"context"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	ps "github.com/mitchellh/go-ps"
 	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+	"github.com/omriharel/deej/pkg/deej/util"
 )
 
 const (
@@ -26,10 +32,65 @@ type ProcessMonitor struct {
 
 	audioMeter *AudioMeterService
 
-	stopChannel     chan bool
+	// LEDs follow audio output rather than running processes (only once there's a meter to follow it with)
+	audioMode bool
+
+	// the LED mode it was started with, as switching modes takes a restart
+	runLock sync.Mutex
+	running bool
+	ledMode string
+
+	// cancelled by Shutdown, for good, and the current run's within it, cancelled by Stop. the monitor loop is
+	// waited for when they are, and so is the LED mode watcher on Shutdown
+	ctx        context.Context
+	cancel     context.CancelFunc
+	runCancel  context.CancelFunc
+	loop       sync.WaitGroup
+	background sync.WaitGroup
+
 	lastKnownStates map[int]bool
 	lastKnownPeaks  map[int]int
+	lastKnownNames  map[int]string
 	numSliders      int
+
+	// the peaks and names are also read by the display screens, from their own goroutine
+	activityLock sync.Mutex
+
+	// the VU meter levels last sent, for devices with LED bars (see vu_meter.go)
+	lastKnownVULevels map[int]int
+
+	ledOverride     ledOverride
+	ledOverrideLock sync.Mutex
+
+	// what the LEDs were last told to be, for devices with RGB LEDs (see led_colors.go)
+	lastKnownColors     map[int]protocol.Color
+	lastKnownColorsLock sync.Mutex
+	ledsOverridden      bool
+
+	// when there was last audio, and when the idle effect took over the LEDs if it has (see led_animation.go)
+	lastActivity   time.Time
+	animationStart time.Time
+
+	// LEDs to flash, and when each last was (see led_flash.go)
+	flashChannel chan int
+	lastFlash    map[int]time.Time
+	flashLock    sync.Mutex
+}
+
+// ledOverride lets another subsystem (such as the focus timer) temporarily take control of the LEDs.
+// it returns the desired state of each LED, or false if it no longer wants control
+type ledOverride interface {
+	ledStates(numSliders int) (map[int]bool, bool)
+}
+
+// effectiveLEDMode returns the LED mode the process monitor runs in for the given led_mode: audio falls back to
+// process where there's no audio meter (see Start)
+func effectiveLEDMode(ledMode string) string {
+	if ledMode == LEDModeAudio && !audioMeterSupported {
+		return LEDModeProcess
+	}
+
+	return ledMode
 }
 
 // NewProcessMonitor creates a new ProcessMonitor instance.
@@ -37,43 +98,169 @@ type ProcessMonitor struct {
 func NewProcessMonitor(deej *Deej, serial *SerialIO, logger *zap.SugaredLogger) *ProcessMonitor {
 	logger = logger.Named("process-monitor")
 
-	return &ProcessMonitor{
+	pm := &ProcessMonitor{
 		deej:            deej,
 		serial:          serial,
 		logger:          logger,
-		stopChannel:     make(chan bool),
 		lastKnownStates: make(map[int]bool),
 		lastKnownPeaks:  make(map[int]int),
+		lastKnownColors: make(map[int]protocol.Color),
+		flashChannel:    make(chan int, 1),
+		lastFlash:       make(map[int]time.Time),
 	}
+
+	pm.ctx, pm.cancel = context.WithCancel(context.Background())
+
+	return pm
 }
 
-// Start begins monitoring processes and updating LED states.
+// initialize restarts monitoring whenever the LED mode changes (from the config or the tray)
+func (pm *ProcessMonitor) initialize() {
+	configReloads := pm.deej.config.SubscribeToChanges()
+
+	pm.background.Add(1)
+	go func() {
+		defer pm.background.Done()
+		defer configReloads.Close()
+
+		for {
+			select {
+			case <-pm.ctx.Done():
+				return
+			case <-configReloads.Reloads:
+			}
+
+			pm.runLock.Lock()
+			changed := pm.running && pm.ledMode != pm.deej.config.LEDMode
+			pm.runLock.Unlock()
+
+			if changed {
+				pm.logger.Infow("LED mode changed, restarting", "ledMode", pm.deej.config.LEDMode)
+
+				pm.Stop()
+				pm.Start()
+			}
+		}
+	}()
+}
+
+// Start begins monitoring processes and updating LED states. it does nothing after Shutdown, so that
+// reconnects racing it don't bring the LEDs back.
 func (pm *ProcessMonitor) Start() {
+	pm.runLock.Lock()
+	defer pm.runLock.Unlock()
+
+	if pm.running || pm.ctx.Err() != nil {
+		return
+	}
+
+	pm.running = true
+	pm.ledMode = pm.deej.config.LEDMode
+
 	pm.logger.Debug("Starting process monitor")
 
+	// a previous run's meter goes, in case it's been switched to process mode since
+	pm.audioMeter = nil
+	pm.audioMode = false
+
 	// Create audio meter service if in audio mode.
 	// This must be done here (not in constructor) because config is loaded
 	// in Initialize() which runs after NewProcessMonitor().
-	if pm.deej.config.LEDMode == LEDModeAudio {
+	if pm.deej.config.LEDMode == LEDModeAudio && !audioMeterSupported {
+		pm.logger.Warnw("Audio mode isn't supported on this platform - LEDs will track running processes instead",
+			"error", util.ErrNotSupported)
+	} else if pm.deej.config.LEDMode == LEDModeAudio {
 		pm.logger.Info("Audio mode enabled - LEDs will track audio output")
 		pm.audioMeter = NewAudioMeterService(pm.logger)
+		pm.audioMode = pm.audioMeter != nil
 	} else {
 		pm.logger.Info("Process mode enabled - LEDs will track running processes")
 	}
 
-	go pm.monitorLoop()
+	// don't go straight into the idle effect, however long it's been since the last slider move
+	pm.lastActivity = time.Now()
+	pm.animationStart = time.Time{}
+
+	var ctx context.Context
+	ctx, pm.runCancel = context.WithCancel(pm.ctx)
+
+	pm.loop.Add(1)
+	go func() {
+		defer pm.loop.Done()
+
+		pm.deej.supervise(ctx, "process monitor", func() {
+			pm.monitorLoop(ctx)
+		})
+	}()
 }
 
-// Stop signals the process monitor to stop.
+// SetLEDOverride hands control of the LEDs to the given override until it's cleared.
+func (pm *ProcessMonitor) SetLEDOverride(override ledOverride) {
+	pm.ledOverrideLock.Lock()
+	defer pm.ledOverrideLock.Unlock()
+
+	pm.ledOverride = override
+}
+
+// ClearLEDOverride returns control of the LEDs to the process monitor, if the given override still holds it.
+func (pm *ProcessMonitor) ClearLEDOverride(override ledOverride) {
+	pm.ledOverrideLock.Lock()
+	defer pm.ledOverrideLock.Unlock()
+
+	if pm.ledOverride == override {
+		pm.ledOverride = nil
+	}
+}
+
+// Stop stops the process monitor, and waits for its loop to finish.
 func (pm *ProcessMonitor) Stop() {
+	pm.runLock.Lock()
+
+	if !pm.running {
+		pm.runLock.Unlock()
+		return
+	}
+
+	pm.running = false
+	cancel := pm.runCancel
+	pm.runLock.Unlock()
+
 	pm.logger.Debug("Stopping process monitor")
-	pm.stopChannel <- true
+
+	cancel()
+	waitForGoroutines(pm.logger, &pm.loop)
 }
 
-func (pm *ProcessMonitor) monitorLoop() {
+// Shutdown stops the process monitor for good and turns the LEDs off, so the device doesn't go on showing
+// activity deej no longer follows.
+func (pm *ProcessMonitor) Shutdown() {
+	pm.cancel()
+	pm.Stop()
+
+	waitForGoroutines(pm.logger, &pm.background)
+
+	pm.turnLEDsOff()
+}
+
+func (pm *ProcessMonitor) turnLEDsOff() {
+	if pm.numSliders == 0 {
+		return
+	}
+
+	pm.deej.recorder.recordLEDsOff()
+
+	if err := pm.serial.SendAllLEDStates(map[int]bool{}, pm.numSliders); err != nil {
+		pm.logger.Debugw("Failed to turn LEDs off", "error", err)
+		return
+	}
+
+	pm.logger.Debug("Turned LEDs off")
+}
+
+func (pm *ProcessMonitor) monitorLoop(ctx context.Context) {
 	// Select polling interval based on mode
 	checkInterval := processCheckInterval
-	if pm.deej.config.LEDMode == LEDModeAudio {
+	if pm.ledMode == LEDModeAudio {
 		checkInterval = audioMeterCheckInterval
 	}
 	pm.logger.Debugw("Monitor loop started", "checkInterval", checkInterval)
@@ -93,24 +280,63 @@ func (pm *ProcessMonitor) monitorLoop() {
 		pm.logger.Debugw("LED refresh enabled", "interval", refreshInterval)
 	}
 
-	// Initial check
+	// LED colors that follow the sliders need to keep up with them, not just with the process checks
+	var colorChan <-chan time.Time
+
+	if pm.deej.config.LEDColors.Mode == ledColorModeVolume {
+		colorTicker := time.NewTicker(audioMeterCheckInterval)
+		colorChan = colorTicker.C
+		defer colorTicker.Stop()
+	}
+
+	// the idle effect needs its own frames
+	var animationChan <-chan time.Time
+
+	if pm.deej.config.LEDAnimation.Effect != ledAnimationOff {
+		animationTicker := time.NewTicker(ledAnimationFrameInterval)
+		animationChan = animationTicker.C
+		defer animationTicker.Stop()
+	}
+
+	// Initial check, then every LED at once, as a device that just connected only knows the ones that changed
 	pm.checkProcesses()
+	pm.refreshAllLEDs()
 
 	for {
 		select {
-		case <-pm.stopChannel:
+		case <-ctx.Done():
 			pm.logger.Debug("Process monitor stopped")
 			return
 		case <-processTicker.C:
 			pm.checkProcesses()
 		case <-refreshChan:
 			pm.refreshAllLEDs()
+		case <-colorChan:
+			if !pm.animating() {
+				pm.applyLEDColors(pm.lastKnownStates, nil, pm.ledsOverridden)
+			}
+		case <-animationChan:
+			pm.updateAnimation()
+		case sliderID := <-pm.flashChannel:
+			pm.flashLED(sliderID)
 		}
 	}
 }
 
 // checkProcesses queries active processes/audio and updates LED states.
 func (pm *ProcessMonitor) checkProcesses() {
+	activeProcesses, peakLevels, ok := pm.currentActivity()
+	if !ok {
+		return
+	}
+
+	pm.deej.recorder.recordActivity(activeProcesses, peakLevels, pm.deej.config.SliderMapping)
+	pm.applyActivity(activeProcesses, peakLevels)
+}
+
+// currentActivity returns which processes are running (process mode) or making noise along with
+// their peak levels (audio mode), or false if they couldn't be queried.
+func (pm *ProcessMonitor) currentActivity() (map[string]bool, map[string]float32, bool) {
 	var activeProcesses map[string]bool
 	var peakLevels map[string]float32
 
@@ -122,7 +348,7 @@ func (pm *ProcessMonitor) checkProcesses() {
 			if pm.deej.Verbose() {
 				pm.logger.Warnw("Failed to get audio peak levels", "error", err)
 			}
-			return
+			return nil, nil, false
 		}
 
 		// Build activeProcesses from peak levels
@@ -137,39 +363,35 @@ func (pm *ProcessMonitor) checkProcesses() {
 		processes, err := ps.Processes()
 		if err != nil {
 			pm.logger.Warnw("Failed to enumerate processes", "error", err)
-			return
+			return nil, nil, false
 		}
 
 		activeProcesses = make(map[string]bool)
 		for _, p := range processes {
-			activeProcesses[strings.ToLower(p.Executable())] = true
+			activeProcesses[normalizeProcessName(strings.ToLower(p.Executable()))] = true
 		}
 	}
 
-	// Track current peak values and app names per slider
+	return activeProcesses, peakLevels, true
+}
+
+// applyActivity works out each LED's state from the given activity and sends whatever changed.
+// this is kept apart from gathering the activity so that recorded activity can be replayed through it.
+func (pm *ProcessMonitor) applyActivity(activeProcesses map[string]bool, peakLevels map[string]float32) {
+
+	// Track current peak values, app names and desired LED states per slider
 	currentPeaks := make(map[int]int)
 	currentNames := make(map[int]string)
+	desiredStates := make(map[int]bool)
 
 	// Check each slider mapping and update LED state if changed
 	pm.deej.config.SliderMapping.iterate(func(sliderID int, targets []string) {
-		active := pm.isAnyTargetActive(targets, activeProcesses)
-
-		// Get peak level and app name for this slider (use highest peak)
-		peakValue := 0
-		appName := ""
-		if peakLevels != nil {
-			for _, target := range targets {
-				targetLower := strings.ToLower(target)
-				if level, ok := peakLevels[targetLower]; ok {
-					levelInt := int(level * 100)
-					if levelInt > peakValue {
-						peakValue = levelInt
-						// Extract app name (remove .exe)
-						appName = strings.TrimSuffix(targetLower, ".exe")
-					}
-				}
-			}
-		}
+
+		// combine the targets as the slider's led_aggregation says (see led_aggregation.go)
+		activities := pm.sliderTargetActivity(targets, activeProcesses, peakLevels)
+		active, peakValue, appName := aggregateLEDActivity(
+			pm.deej.config.ledAggregation(sliderID), activities, peakLevels != nil)
+
 		currentPeaks[sliderID] = peakValue
 		currentNames[sliderID] = appName
 
@@ -178,7 +400,68 @@ func (pm *ProcessMonitor) checkProcesses() {
 			pm.numSliders = sliderID + 1
 		}
 
-		// Only send update if state changed
+		desiredStates[sliderID] = active
+	})
+
+	// Let an active override (e.g. a timer countdown) decide the LED states instead
+	overrideStates, overridden := pm.currentLEDOverrideStates()
+	if overridden {
+		desiredStates = overrideStates
+	}
+	pm.ledsOverridden = overridden
+
+	for _, peak := range currentPeaks {
+		if peak > 0 {
+			pm.lastActivity = time.Now()
+			break
+		}
+	}
+
+	pm.applyLEDStates(desiredStates, currentPeaks, overridden)
+
+	// Send audio peaks if in audio mode
+	if pm.audioMode && pm.numSliders > 0 {
+		if err := pm.serial.SendAudioPeaks(currentPeaks, currentNames, pm.numSliders); err != nil {
+			if pm.deej.Verbose() {
+				pm.logger.Warnw("Failed to send audio peaks", "error", err)
+			}
+		}
+		pm.activityLock.Lock()
+		pm.lastKnownPeaks = currentPeaks
+		pm.lastKnownNames = currentNames
+		pm.activityLock.Unlock()
+
+		pm.applyVUMeter(currentPeaks)
+	}
+
+	if peakLevels != nil {
+		pm.deej.bus.peaks.publish(PeakEvent{Peaks: currentPeaks, Apps: currentNames})
+	}
+}
+
+// PeakEvent is every slider's audio peak (0-100) as of the latest check, and the app that's loudest on it
+type PeakEvent struct {
+	Peaks map[int]int
+	Apps  map[int]string
+}
+
+// applyLEDStates sends the LED states (and colors) that changed, unless the idle effect has the LEDs
+func (pm *ProcessMonitor) applyLEDStates(desiredStates map[int]bool, currentPeaks map[int]int, overridden bool) {
+	if pm.animating() {
+		return
+	}
+
+	// Only send updates for LEDs whose state changed, in slider order so the same states always
+	// produce the same commands
+	sliderIDs := make([]int, 0, len(desiredStates))
+	for sliderID := range desiredStates {
+		sliderIDs = append(sliderIDs, sliderID)
+	}
+	sort.Ints(sliderIDs)
+
+	for _, sliderID := range sliderIDs {
+		active := desiredStates[sliderID]
+
 		if lastState, exists := pm.lastKnownStates[sliderID]; !exists || lastState != active {
 			pm.lastKnownStates[sliderID] = active
 
@@ -190,17 +473,46 @@ func (pm *ProcessMonitor) checkProcesses() {
 				pm.logger.Infow("LED state changed", "sliderID", sliderID, "on", active)
 			}
 		}
-	})
+	}
 
-	// Send audio peaks if in audio mode
-	if pm.audioMeter != nil && pm.numSliders > 0 {
-		if err := pm.serial.SendAudioPeaks(currentPeaks, currentNames, pm.numSliders); err != nil {
-			if pm.deej.Verbose() {
-				pm.logger.Warnw("Failed to send audio peaks", "error", err)
-			}
-		}
-		pm.lastKnownPeaks = currentPeaks
+	// RGB LEDs get their colors on top of being on or off
+	var colorPeaks map[int]int
+	if pm.audioMode {
+		colorPeaks = currentPeaks
+	}
+	pm.applyLEDColors(desiredStates, colorPeaks, overridden)
+}
+
+// sliderActivity returns the slider's last audio peak (0-100) and the loudest app behind it,
+// or false if the LEDs don't follow audio
+func (pm *ProcessMonitor) sliderActivity(sliderID int) (int, string, bool) {
+	if !pm.audioMode {
+		return 0, "", false
+	}
+
+	pm.activityLock.Lock()
+	defer pm.activityLock.Unlock()
+
+	return pm.lastKnownPeaks[sliderID], pm.lastKnownNames[sliderID], true
+}
+
+// currentLEDOverrideStates returns the LED states requested by the active override, if there is one.
+// overrides that no longer want control are dropped here.
+func (pm *ProcessMonitor) currentLEDOverrideStates() (map[int]bool, bool) {
+	pm.ledOverrideLock.Lock()
+	defer pm.ledOverrideLock.Unlock()
+
+	if pm.ledOverride == nil {
+		return nil, false
 	}
+
+	states, ok := pm.ledOverride.ledStates(pm.numSliders)
+	if !ok {
+		pm.ledOverride = nil
+		return nil, false
+	}
+
+	return states, true
 }
 
 // refreshAllLEDs sends the current state of all LEDs as a batched command.
@@ -210,30 +522,49 @@ func (pm *ProcessMonitor) refreshAllLEDs() {
 		return
 	}
 
+	pm.deej.recorder.recordLEDRefresh()
+
 	if err := pm.serial.SendAllLEDStates(pm.lastKnownStates, pm.numSliders); err != nil {
 		if pm.deej.Verbose() {
 			pm.logger.Warnw("Failed to refresh LED states", "error", err)
 		}
 	}
+
+	pm.refreshLEDColors()
 }
 
 // isAnyTargetActive checks if any of the target processes are active.
 func (pm *ProcessMonitor) isAnyTargetActive(targets []string, activeProcesses map[string]bool) bool {
 	for _, target := range targets {
+
+		// Patterns are active if any process they match is
+		if isTargetPattern(target) {
+			for name := range activeProcesses {
+				if targetMatchesName(target, name) {
+					return true
+				}
+			}
+
+			continue
+		}
+
 		targetLower := strings.ToLower(target)
 
-		// In process mode, special sessions are always "active" (they always exist)
-		if pm.audioMeter == nil {
+		// In process mode, special sessions are always "active" (they always exist), and so are devices
+		if !pm.audioMode {
 			switch targetLower {
 			case masterSessionName, inputSessionName, systemSessionName:
 				return true
 			}
+
+			if isDeviceTarget(targetLower) {
+				return true
+			}
 		}
 
 		// Skip unmapped/current window targets - these don't map to specific processes
-		switch targetLower {
-		case specialTargetTransformPrefix + specialTargetAllUnmapped,
-			specialTargetTransformPrefix + specialTargetCurrentWindow:
+		if _, ok := parseCurrentWindowTarget(targetLower); ok ||
+			targetLower == specialTargetTransformPrefix+specialTargetAllUnmapped {
 			return false
 		}
 
@@ -0,0 +1,125 @@
+package deej
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// a version number, along with whatever separates it from the rest of the name: "_v123", "-1.2.3", "64"
+var processNameVersionPattern = regexp.MustCompile(`(?:[-_ ]+v?)?\d+(?:[._]\d+)*`)
+
+// processNameRule renames the processes it matches, for apps whose executable changes name between updates
+// (helper_v123.exe, versioned launchers) so that they keep mapping, metering and matching as one name
+type processNameRule struct {
+
+	// a process name, wildcard or re: pattern, like targets
+	Match string
+
+	// what to call matching processes. with a re: pattern, $1 (or ${name}) is what its groups captured
+	Name string
+
+	// drop version numbers from the name instead of renaming it, i.e. helper_v123.exe -> helper.exe
+	StripDigits bool
+
+	pattern *regexp.Regexp
+}
+
+// the rules every process name goes through before deej looks at it, set when the config loads. they're kept
+// outside the config as session keys are worked out deep in the audio code, which doesn't have it
+var (
+	processNameRules     []processNameRule
+	processNameRulesLock sync.RWMutex
+)
+
+// normalizeProcessName returns what deej calls the given (lowercase) process name: whatever the first rule that
+// matches it says, or the name itself
+func normalizeProcessName(name string) string {
+	processNameRulesLock.RLock()
+	defer processNameRulesLock.RUnlock()
+
+	for _, rule := range processNameRules {
+		if !rule.pattern.MatchString(name) {
+			continue
+		}
+
+		if rule.StripDigits {
+			return processNameVersionPattern.ReplaceAllString(name, "")
+		}
+
+		// a wildcard pattern has no groups, so there's nothing to expand and this is just the name
+		var expanded []byte
+		for _, submatches := range rule.pattern.FindAllStringSubmatchIndex(name, 1) {
+			expanded = rule.pattern.ExpandString(expanded, rule.Name, name, submatches)
+		}
+
+		return strings.ToLower(string(expanded))
+	}
+
+	return name
+}
+
+func (cc *CanonicalConfig) populateProcessNames() {
+	rules := []processNameRule{}
+
+	entries, _ := cc.userConfig.Get(configKeyProcessNames).([]interface{})
+	for idx, entry := range entries {
+		fields, ok := toStringMap(entry)
+		if !ok {
+			cc.logger.Warnw("Ignoring invalid process name rule", "index", idx)
+			continue
+		}
+
+		rule, err := processNameRuleFromFields(fields)
+		if err != nil {
+			cc.logger.Warnw("Ignoring invalid process name rule", "index", idx, "error", err)
+			continue
+		}
+
+		rules = append(rules, rule)
+	}
+
+	processNameRulesLock.Lock()
+	processNameRules = rules
+	processNameRulesLock.Unlock()
+}
+
+func processNameRuleFromFields(fields map[string]interface{}) (processNameRule, error) {
+	rule := processNameRule{}
+
+	if match, ok := fields["match"]; ok {
+		rule.Match = strings.TrimSpace(fmt.Sprint(match))
+	}
+
+	if name, ok := fields["name"]; ok {
+		rule.Name = strings.TrimSpace(fmt.Sprint(name))
+	}
+
+	if stripDigits, ok := fields["strip_digits"].(bool); ok {
+		rule.StripDigits = stripDigits
+	}
+
+	if rule.Match == "" {
+		return processNameRule{}, fmt.Errorf("match is required")
+	}
+
+	if (rule.Name == "") == !rule.StripDigits {
+		return processNameRule{}, fmt.Errorf("needs a name or strip_digits: true (but not both)")
+	}
+
+	// a plain name is matched as it is, like a target
+	pattern := rule.Match
+	if !isTargetPattern(pattern) {
+		pattern = targetRegexPrefix + "^" + regexp.QuoteMeta(pattern) + "$"
+	}
+
+	compiled, err := compileTargetPattern(pattern)
+	if err != nil {
+		return processNameRule{}, fmt.Errorf("invalid match pattern: %w", err)
+	}
+
+	rule.pattern = compiled
+
+	return rule, nil
+}
@@ -0,0 +1,237 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// binary framing is an alternative to plain lines, for links noisy enough to garble them and for devices that
+// would rather not parse text. it's switched to through the handshake (see SwitchFraming), after which every
+// frame is a start byte, the frame's kind, its payload's length, the payload and a CRC of everything but the start:
+//
+//	0xD5 <kind> <length> <payload...> <crc high> <crc low>
+//
+// slider values, LED states, LED colors and VU meter levels get compact payloads of their own. everything else
+// is sent as its usual text, minus the terminator
+const (
+	FramingText   = "text"
+	FramingBinary = "crc"
+
+	binaryFrameStart = 0xD5
+
+	BinaryKindText      byte = 0x01
+	BinaryKindSliders   byte = 0x02 // from the device: every slider's raw value, two bytes each (big-endian)
+	BinaryKindLEDStates byte = 0x03 // the slider count, then one bit per LED (slider 0 in the first byte's lowest bit)
+	BinaryKindLEDColors byte = 0x04 // three bytes (red, green, blue) per LED
+	BinaryKindVUMeter   byte = 0x05 // the segment count, then a byte per slider
+	BinaryKindSealed    byte = 0x06 // another frame's kind and payload, encrypted for a paired device (see pairing.go)
+
+	maxBinaryPayload = 255
+)
+
+// ErrCorruptFrame is returned for a binary frame that didn't match its CRC. the bytes read for it are dropped,
+// and reading picks up at the next start byte
+var ErrCorruptFrame = errors.New("corrupt binary frame")
+
+// SwitchFraming asks the device to switch framing (FramingText or FramingBinary). it's always sent as text, and
+// the device acknowledges with the same line (as the last it sends in the old framing), after which both sides
+// use the new one. devices still accept text frames after switching
+// Format: #F:<framing>
+func SwitchFraming(framing string) string {
+	return "#F:" + framing + frameTerminator
+}
+
+// BinaryFrame wraps a payload of the given kind in a binary frame. payloads over 255 bytes can't be framed
+func BinaryFrame(kind byte, payload []byte) ([]byte, error) {
+	if len(payload) > maxBinaryPayload {
+		return nil, fmt.Errorf("payload of %d bytes doesn't fit a binary frame", len(payload))
+	}
+
+	frame := make([]byte, 0, len(payload)+5)
+	frame = append(frame, binaryFrameStart, kind, byte(len(payload)))
+	frame = append(frame, payload...)
+
+	crc := CRC16(frame[1:])
+
+	return append(frame, byte(crc>>8), byte(crc)), nil
+}
+
+// ToBinary converts a text frame (as built by this package) into a binary one, with a compact payload
+// for the frames that have one
+func ToBinary(frame string) ([]byte, error) {
+	return BinaryFrame(BinaryPayload(frame))
+}
+
+// BinaryPayload returns the kind and payload a text frame is sent as when binary framed
+func BinaryPayload(frame string) (byte, []byte) {
+	text := strings.TrimSuffix(frame, frameTerminator)
+
+	if kind, payload, ok := compactPayload(text); ok {
+		return kind, payload
+	}
+
+	return BinaryKindText, []byte(text)
+}
+
+// compactPayload returns the compact form of a text frame, if it has one
+func compactPayload(text string) (byte, []byte, bool) {
+	switch {
+	case strings.HasPrefix(text, "#LS:"):
+		values := splitValues(strings.TrimPrefix(text, "#LS:"))
+		if len(values) > maxBinaryPayload {
+			return 0, nil, false
+		}
+
+		payload := make([]byte, 1+(len(values)+7)/8)
+		payload[0] = byte(len(values))
+
+		for ledIdx, value := range values {
+			if value == "1" {
+				payload[1+ledIdx/8] |= 1 << uint(ledIdx%8)
+			}
+		}
+
+		return BinaryKindLEDStates, payload, true
+
+	case strings.HasPrefix(text, "#LC:"):
+		payload := []byte{}
+
+		for _, value := range splitValues(strings.TrimPrefix(text, "#LC:")) {
+			color, err := hex.DecodeString(value)
+			if err != nil || len(color) != 3 {
+				return 0, nil, false
+			}
+
+			payload = append(payload, color...)
+		}
+
+		return BinaryKindLEDColors, payload, true
+
+	case strings.HasPrefix(text, "#VU:"):
+		fields := strings.SplitN(strings.TrimPrefix(text, "#VU:"), ":", 2)
+		if len(fields) != 2 {
+			return 0, nil, false
+		}
+
+		segments, err := strconv.Atoi(fields[0])
+		if err != nil || segments > 255 {
+			return 0, nil, false
+		}
+
+		payload := []byte{byte(segments)}
+
+		for _, value := range splitValues(fields[1]) {
+			level, err := strconv.Atoi(value)
+			if err != nil || level > 255 {
+				return 0, nil, false
+			}
+
+			payload = append(payload, byte(level))
+		}
+
+		return BinaryKindVUMeter, payload, true
+	}
+
+	return 0, nil, false
+}
+
+// splitValues splits a frame's comma-separated values, of which there are none for zero sliders
+func splitValues(values string) []string {
+	if values == "" {
+		return nil
+	}
+
+	return strings.Split(values, ",")
+}
+
+// ReadBinaryFrame reads the next binary frame, skipping anything before its start byte
+func ReadBinaryFrame(reader io.ByteReader) (byte, []byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if b == binaryFrameStart {
+			break
+		}
+	}
+
+	header := make([]byte, 2)
+	for idx := range header {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		header[idx] = b
+	}
+
+	// the payload and the CRC after it
+	rest := make([]byte, int(header[1])+2)
+	for idx := range rest {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		rest[idx] = b
+	}
+
+	payload := rest[:len(rest)-2]
+	expected := binary.BigEndian.Uint16(rest[len(rest)-2:])
+
+	if CRC16(append(header, payload...)) != expected {
+		return 0, nil, ErrCorruptFrame
+	}
+
+	return header[0], payload, nil
+}
+
+// BinaryToLine turns a binary frame from the device back into the line it stands for, so that it can be handled
+// like any other. slider values come out the way the device would have written them as text
+func BinaryToLine(kind byte, payload []byte) (string, error) {
+	switch kind {
+	case BinaryKindText:
+		return string(payload) + "\r\n", nil
+
+	case BinaryKindSliders:
+		if len(payload) == 0 || len(payload)%2 != 0 {
+			return "", fmt.Errorf("slider payload of %d bytes", len(payload))
+		}
+
+		values := make([]string, 0, len(payload)/2)
+		for idx := 0; idx < len(payload); idx += 2 {
+			values = append(values, strconv.Itoa(int(binary.BigEndian.Uint16(payload[idx:]))))
+		}
+
+		return strings.Join(values, "|") + "\r\n", nil
+	}
+
+	return "", fmt.Errorf("unexpected frame kind 0x%02x from device", kind)
+}
+
+// CRC16 is CRC-16/CCITT-FALSE (polynomial 0x1021, starting from 0xFFFF), which is easy to compute on
+// an 8-bit microcontroller without a table
+func CRC16(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
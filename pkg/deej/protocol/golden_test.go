@@ -0,0 +1,245 @@
+package protocol
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// run with -update to accept changes to the generated frames
+var update = flag.Bool("update", false, "regenerate the golden file from the current frames instead of checking them")
+
+// goldenFile is where the expected frames are kept, relative to this package
+const goldenFile = "testdata/frames.golden"
+
+// goldenCase is a single generated frame, checked against the one kept in the golden file
+type goldenCase struct {
+	Name  string
+	Frame string
+}
+
+// goldenCases returns a frame for every command, across slider counts and edge cases.
+// when adding a command, add its cases here and regenerate the golden file with -update
+func goldenCases() []goldenCase {
+	cases := []goldenCase{
+		{"led/first-on", LEDState(0, true)},
+		{"led/first-off", LEDState(0, false)},
+		{"led/high-slider", LEDState(15, true)},
+	}
+
+	for _, numSliders := range []int{0, 1, 5, 8} {
+		alternating := map[int]bool{}
+		for sliderID := 0; sliderID < numSliders; sliderID += 2 {
+			alternating[sliderID] = true
+		}
+
+		cases = append(cases,
+			goldenCase{fmt.Sprintf("all-leds/%d-sliders-off", numSliders), AllLEDStates(nil, numSliders)},
+			goldenCase{fmt.Sprintf("all-leds/%d-sliders-alternating", numSliders), AllLEDStates(alternating, numSliders)},
+		)
+	}
+
+	cases = append(cases,
+		goldenCase{"all-leds/states-beyond-slider-count", AllLEDStates(map[int]bool{0: true, 7: true}, 3)},
+
+		goldenCase{"led-colors/0-sliders", LEDColors(nil, 0)},
+		goldenCase{"led-colors/3-sliders", LEDColors(map[int]Color{0: {255, 0, 0}, 1: {0, 255, 0}, 2: {0, 0, 255}}, 3)},
+		goldenCase{"led-colors/missing-sliders-off", LEDColors(map[int]Color{1: {18, 52, 86}}, 3)},
+		goldenCase{"led-colors/colors-beyond-slider-count", LEDColors(map[int]Color{0: {1, 2, 3}, 5: {255, 255, 255}}, 2)},
+
+		goldenCase{"audio-peaks/0-sliders", AudioPeaks(nil, nil, 0)},
+		goldenCase{"audio-peaks/1-slider-silent", AudioPeaks(map[int]int{0: 0}, map[int]string{0: ""}, 1)},
+		goldenCase{"audio-peaks/5-sliders", AudioPeaks(
+			map[int]int{0: 50, 1: 75, 2: 30, 3: 0, 4: 100},
+			map[int]string{0: "chrm", 1: "frfx", 2: "dscd", 4: "spfy"},
+			5)},
+		goldenCase{"audio-peaks/out-of-range-peaks", AudioPeaks(map[int]int{0: -5, 1: 150}, map[int]string{0: "a", 1: "b"}, 2)},
+		goldenCase{"audio-peaks/separators-in-labels", AudioPeaks(map[int]int{0: 10}, map[int]string{0: "a,b:c"}, 1)},
+		goldenCase{"audio-peaks/unicode-labels", AudioPeaks(map[int]int{0: 20, 1: 40}, map[int]string{0: "Вкон", 1: "音楽"}, 2)},
+
+		goldenCase{"vu-meter/0-sliders", VUMeter(nil, 8, 0)},
+		goldenCase{"vu-meter/4-sliders", VUMeter(map[int]int{0: 3, 1: 8, 3: 5}, 8, 4)},
+		goldenCase{"vu-meter/out-of-range-levels", VUMeter(map[int]int{0: -1, 1: 20}, 12, 2)},
+
+		goldenCase{"slider-states/0-sliders", SliderStates(nil, 0)},
+		goldenCase{"slider-states/mixed", SliderStates(map[int]SliderState{0: {50, false}, 1: {100, true}, 3: {0, false}}, 4)},
+		goldenCase{"slider-states/out-of-range", SliderStates(map[int]SliderState{0: {-5, false}, 1: {140, true}}, 2)},
+
+		goldenCase{"display/simple", DisplayPage("TIMER", "24:59 left")},
+		goldenCase{"display/empty", DisplayPage("", "")},
+		goldenCase{"display/separators-in-text", DisplayPage("a|b", "line\r\nbreak")},
+		goldenCase{"display/unicode", DisplayPage("Погода", "12° ☁ облачно")},
+		goldenCase{"display/ascii-ellipsis", DisplayPage("Calendar", "Standup with the...")},
+
+		goldenCase{"screen/begin", ScreenBegin("Mixer")},
+		goldenCase{"screen/begin-separators-in-title", ScreenBegin("a|b\nc")},
+		goldenCase{"screen/slider-row", ScreenRow(0, "Chrm", "75%", 75, 40)},
+		goldenCase{"screen/text-row", ScreenRow(3, "Time", "14:05", -1, -1)},
+		goldenCase{"screen/out-of-range-levels", ScreenRow(1, "a", "b", 150, -5)},
+		goldenCase{"screen/separators-in-row", ScreenRow(2, "a|b", "c\r\nd", 0, 0)},
+		goldenCase{"screen/end", ScreenEnd()},
+
+		goldenCase{"identity/request", IdentityRequest()},
+
+		goldenCase{"hello/versioned", Hello("Version release-v0.9.10")},
+		goldenCase{"hello/no-version", Hello("")},
+		goldenCase{"hello/separators-in-version", Hello("a,b=c\r\n")},
+		goldenCase{"hello/long-version", Hello("Version nightly-0123456789abcdef0123456789abcdef")},
+
+		goldenCase{"sleep/asleep", Sleep(true)},
+		goldenCase{"sleep/awake", Sleep(false)},
+
+		goldenCase{"quiet", Quiet()},
+
+		goldenCase{"heartbeat/first", Heartbeat(1)},
+		goldenCase{"heartbeat/later", Heartbeat(4821)},
+
+		goldenCase{"framing/switch-binary", SwitchFraming(FramingBinary)},
+		goldenCase{"framing/switch-text", SwitchFraming(FramingText)},
+
+		goldenCase{"pairing/pair", Pair(goldenPairingKey)},
+		goldenCase{"pairing/accepted", PairResult(true)},
+		goldenCase{"pairing/rejected", PairResult(false)},
+		goldenCase{"pairing/code", PairingCode(goldenPairingKey)},
+		goldenCase{"pairing/start-session", StartSession([]byte{1, 2, 3, 4, 5, 6, 7, 8})},
+	)
+
+	// a sealed frame, which is only the same every time for a fixed key and counter
+	sessionKey := SessionKey(goldenPairingKey, []byte("deejnonc"), []byte("devnonce"))
+	kind, payload := BinaryPayload(AllLEDStates(map[int]bool{1: true}, 4))
+
+	sealed, err := Seal(sessionKey, SealedToDevice, 7, kind, payload)
+	if err != nil {
+		sealed = []byte(err.Error())
+	}
+
+	cases = append(cases, goldenCase{"pairing/sealed-led-states", string(sealed)})
+
+	// the same frames again, binary framed
+	for _, frameCase := range []goldenCase{
+		{"binary/led-states-0-sliders", AllLEDStates(nil, 0)},
+		{"binary/led-states-alternating", AllLEDStates(map[int]bool{0: true, 2: true, 8: true}, 10)},
+		{"binary/led-colors", LEDColors(map[int]Color{0: {255, 0, 0}, 2: {18, 52, 86}}, 3)},
+		{"binary/vu-meter", VUMeter(map[int]int{0: 3, 1: 8, 3: 5}, 8, 4)},
+		{"binary/display-as-text", DisplayPage("TIMER", "24:59 left")},
+		{"binary/hello-as-text", Hello("release-v1.0")},
+	} {
+		frame, err := ToBinary(frameCase.Frame)
+		if err != nil {
+			frame = []byte(err.Error())
+		}
+
+		cases = append(cases, goldenCase{frameCase.Name, string(frame)})
+	}
+
+	// and as feature reports for HID devices
+	for _, frameCase := range []goldenCase{
+		{"hid/led-states", AllLEDStates(map[int]bool{0: true, 3: true}, 5)},
+		{"hid/led-colors", LEDColors(map[int]Color{1: {0, 128, 255}}, 2)},
+		{"hid/hello-as-text", Hello("release-v1.0")},
+	} {
+		report, err := HIDFeatureReport(frameCase.Frame)
+		if err != nil {
+			report = []byte(err.Error())
+		}
+
+		cases = append(cases, goldenCase{frameCase.Name, string(report)})
+	}
+
+	return cases
+}
+
+// a made-up pairing key, for the pairing cases
+var goldenPairingKey = []byte("0123456789abcdef")
+
+// formatGolden renders cases the way they're kept in the golden file: one per line, the case's name
+// followed by its quoted frame, so that every byte (including the terminator) is visible
+func formatGolden(cases []goldenCase) string {
+	builder := strings.Builder{}
+
+	for _, frameCase := range cases {
+		builder.WriteString(fmt.Sprintf("%s %s\n", frameCase.Name, strconv.Quote(frameCase.Frame)))
+	}
+
+	return builder.String()
+}
+
+func readGolden(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open golden file: %w", err)
+	}
+	defer file.Close()
+
+	expected := map[string]string{}
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+
+		spaceIdx := strings.Index(line, " ")
+		if spaceIdx == -1 {
+			return nil, fmt.Errorf("golden file line %d: missing frame", lineNumber)
+		}
+
+		frame, err := strconv.Unquote(line[spaceIdx+1:])
+		if err != nil {
+			return nil, fmt.Errorf("golden file line %d: unquote frame: %w", lineNumber, err)
+		}
+
+		expected[line[:spaceIdx]] = frame
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read golden file: %w", err)
+	}
+
+	return expected, nil
+}
+
+// TestGoldenFrames checks the generated frames against the golden file, so that any change
+// to what deej sends its device is deliberate
+func TestGoldenFrames(t *testing.T) {
+	cases := goldenCases()
+
+	if *update {
+		if err := ioutil.WriteFile(goldenFile, []byte(formatGolden(cases)), 0644); err != nil {
+			t.Fatalf("write golden file: %v", err)
+		}
+
+		t.Logf("Updated %s", goldenFile)
+		return
+	}
+
+	expected, err := readGolden(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := map[string]bool{}
+
+	for _, frameCase := range cases {
+		seen[frameCase.Name] = true
+
+		frame, ok := expected[frameCase.Name]
+		if !ok {
+			t.Errorf("%s: missing from golden file", frameCase.Name)
+		} else if frame != frameCase.Frame {
+			t.Errorf("%s: expected %q, got %q", frameCase.Name, frame, frameCase.Frame)
+		}
+	}
+
+	for name := range expected {
+		if !seen[name] {
+			t.Errorf("%s: no longer generated", name)
+		}
+	}
+}
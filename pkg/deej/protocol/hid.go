@@ -0,0 +1,56 @@
+package protocol
+
+import (
+	"fmt"
+)
+
+// devices can also show up as USB HID devices instead of serial ports, which need no drivers and no COM port
+// to pick. they speak the binary frames' kinds and payloads (see binary.go) in fixed-size reports, without the
+// start byte and CRC (USB checks reports itself):
+//
+//	<kind> <length> <payload...> <zero padding>
+//
+// slider values and the device's other lines come in as input reports, and deej's commands go out as feature
+// reports. reports don't use report IDs, so feature reports start with a zero one, as the OS expects
+const (
+	HIDReportSize = 64
+
+	// the OS takes feature reports with their report ID in front
+	HIDFeatureReportSize = HIDReportSize + 1
+
+	maxHIDPayload = HIDReportSize - 2
+
+	// the vendor and product IDs deej's HID firmware enumerates with, from pid.codes' open source range
+	HIDVendorID  uint16 = 0x1209
+	HIDProductID uint16 = 0xDEE1
+)
+
+// HIDFeatureReport converts a text frame (as built by this package) into the feature report it's sent to
+// a HID device as, report ID included. frames whose payload doesn't fit a report can't be sent
+func HIDFeatureReport(frame string) ([]byte, error) {
+	kind, payload := BinaryPayload(frame)
+	if len(payload) > maxHIDPayload {
+		return nil, fmt.Errorf("payload of %d bytes doesn't fit a HID report", len(payload))
+	}
+
+	report := make([]byte, HIDFeatureReportSize)
+	report[1] = kind
+	report[2] = byte(len(payload))
+	copy(report[3:], payload)
+
+	return report, nil
+}
+
+// HIDReportToLine turns an input report from a HID device back into the line it stands for
+func HIDReportToLine(report []byte) (string, error) {
+	if len(report) < 2 {
+		return "", fmt.Errorf("HID report of %d bytes", len(report))
+	}
+
+	length := int(report[1])
+	if 2+length > len(report) {
+		return "", fmt.Errorf("HID report payload of %d bytes in a %d byte report", length, len(report))
+	}
+
+	return BinaryToLine(report[0], report[2:2+length])
+}
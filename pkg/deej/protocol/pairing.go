@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// devices on a link anyone nearby can reach (Wi-Fi, Bluetooth) can be paired with deej, so that nobody else can
+// move their sliders or press their buttons. pairing hands the device a key over a link that's already trusted
+// (usually USB), which both sides then show a code for, for the user to compare (see PairingCode).
+//
+// a paired device says secure=1 in its hello. deej then sends #S with a nonce of its own, which the device
+// acknowledges with #S and its nonce (the last text line it sends), and from then on everything either side sends
+// is a BinaryKindSealed frame: an 8-byte counter (big-endian, going up with every frame) followed by the inner
+// frame's kind and payload, encrypted with AES-128-GCM under a key derived from the pairing key and both nonces
+const (
+	PairingKeySize   = 16
+	SessionNonceSize = 8
+
+	// which way a sealed frame is going, so that neither side's frames can be sent back to it
+	SealedToDevice   byte = 0x01
+	SealedFromDevice byte = 0x02
+
+	sealedCounterSize = 8
+)
+
+// ErrUnsealFailed is returned for a sealed frame that wasn't encrypted with the session's key, or was tampered with
+var ErrUnsealFailed = errors.New("sealed frame failed authentication")
+
+// Pair hands the device a new pairing key. the device keeps it aside, shows PairingCode for it, and only starts
+// using it once PairResult says the user confirmed the codes match
+// Format: #PAIR:<32 hex digits>
+func Pair(key []byte) string {
+	return "#PAIR:" + hex.EncodeToString(key) + frameTerminator
+}
+
+// PairResult tells the device whether to keep the key it was handed with Pair
+// Format: #PAIRED:<0|1>
+func PairResult(accepted bool) string {
+	return "#PAIRED:" + boolFlag(accepted) + frameTerminator
+}
+
+// StartSession begins an encrypted session with a paired device
+// Format: #S:<16 hex digits>
+func StartSession(nonce []byte) string {
+	return "#S:" + hex.EncodeToString(nonce) + frameTerminator
+}
+
+// PairingCode is the six-digit code shown on both sides while pairing, for the user to check that the device got
+// the same key deej sent (and not one from someone in between)
+func PairingCode(key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("deej pairing code"))
+
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(mac.Sum(nil))%1000000)
+}
+
+// SessionKey derives the key a session's frames are sealed with, which is different for every connection
+func SessionKey(pairingKey []byte, deejNonce []byte, deviceNonce []byte) []byte {
+	mac := hmac.New(sha256.New, pairingKey)
+	mac.Write([]byte("deej session"))
+	mac.Write(deejNonce)
+	mac.Write(deviceNonce)
+
+	return mac.Sum(nil)[:PairingKeySize]
+}
+
+// Seal encrypts a frame's kind and payload into a BinaryKindSealed frame. every frame sent in a session
+// needs a higher counter than the last
+func Seal(sessionKey []byte, direction byte, counter uint64, kind byte, payload []byte) ([]byte, error) {
+	aead, err := newSessionCipher(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, sealedCounterSize, sealedCounterSize+1+len(payload)+aead.Overhead())
+	binary.BigEndian.PutUint64(sealed, counter)
+
+	plaintext := append([]byte{kind}, payload...)
+	sealed = aead.Seal(sealed, sessionNonce(direction, counter, aead.NonceSize()), plaintext, nil)
+
+	return BinaryFrame(BinaryKindSealed, sealed)
+}
+
+// Unseal decrypts a BinaryKindSealed frame's payload, returning its counter and the inner frame's kind and payload
+func Unseal(sessionKey []byte, direction byte, sealed []byte) (uint64, byte, []byte, error) {
+	aead, err := newSessionCipher(sessionKey)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	if len(sealed) < sealedCounterSize+1+aead.Overhead() {
+		return 0, 0, nil, fmt.Errorf("sealed payload of %d bytes", len(sealed))
+	}
+
+	counter := binary.BigEndian.Uint64(sealed)
+
+	plaintext, err := aead.Open(nil, sessionNonce(direction, counter, aead.NonceSize()), sealed[sealedCounterSize:], nil)
+	if err != nil {
+		return 0, 0, nil, ErrUnsealFailed
+	}
+
+	return counter, plaintext[0], plaintext[1:], nil
+}
+
+func newSessionCipher(sessionKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(sessionKey)
+	if err != nil {
+		return nil, fmt.Errorf("create session cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("create session cipher: %w", err)
+	}
+
+	return aead, nil
+}
+
+// sessionNonce is the direction, zeros, and the counter in the last 8 bytes
+func sessionNonce(direction byte, counter uint64, size int) []byte {
+	nonce := make([]byte, size)
+	nonce[0] = direction
+	binary.BigEndian.PutUint64(nonce[size-sealedCounterSize:], counter)
+
+	return nonce
+}
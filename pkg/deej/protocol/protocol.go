@@ -0,0 +1,241 @@
+// Package protocol builds the frames deej sends to its device over serial. every frame is a single line
+// starting with '#' and the command's name, which is what tells them apart from lines of slider values
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is the protocol version deej speaks, sent along with Hello. it goes up whenever frames change in a way
+// that older firmware would misread
+const Version = 1
+
+const (
+	// every frame ends with a newline, which is what the firmware reads up to
+	frameTerminator = "\n"
+
+	// keeps #HELLO within the smallest firmware's command buffer
+	maxHelloAppLength = 24
+
+	// audio peaks are percentages
+	minAudioPeak = 0
+	maxAudioPeak = 100
+)
+
+// characters that separate fields within a frame, and can't be allowed to come from names or text
+var (
+	audioPeakLabelSanitizer = strings.NewReplacer(",", "", ":", "")
+	displayTextSanitizer    = strings.NewReplacer("|", "/", "\r", " ", "\n", " ")
+	helloFieldSanitizer     = strings.NewReplacer(",", " ", "=", " ", "\r", "", "\n", "")
+)
+
+// LEDState turns a single slider's LED on or off
+// Format: #L<slider>:<0|1>
+func LEDState(sliderID int, on bool) string {
+	return fmt.Sprintf("#L%d:%s%s", sliderID, boolFlag(on), frameTerminator)
+}
+
+// AllLEDStates sets every LED at once, in slider order. sliders missing from states are off
+// Format: #LS:1,0,1,0
+func AllLEDStates(states map[int]bool, numSliders int) string {
+	flags := make([]string, numSliders)
+	for sliderID := 0; sliderID < numSliders; sliderID++ {
+		flags[sliderID] = boolFlag(states[sliderID])
+	}
+
+	return fmt.Sprintf("#LS:%s%s", strings.Join(flags, ","), frameTerminator)
+}
+
+// Color is an RGB color, for devices with addressable LEDs
+type Color struct {
+	R uint8
+	G uint8
+	B uint8
+}
+
+// Hex returns the color as six lowercase hex digits, the way frames carry it
+func (c Color) Hex() string {
+	return fmt.Sprintf("%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// LEDColors sets every slider's LED color at once, in slider order, for devices with addressable (RGB) LEDs.
+// sliders missing from colors are off (black)
+// Format: #LC:ff0000,00ff00,000000
+func LEDColors(colors map[int]Color, numSliders int) string {
+	hexColors := make([]string, numSliders)
+	for sliderID := 0; sliderID < numSliders; sliderID++ {
+		hexColors[sliderID] = colors[sliderID].Hex()
+	}
+
+	return fmt.Sprintf("#LC:%s%s", strings.Join(hexColors, ","), frameTerminator)
+}
+
+// AudioPeaks sends every slider's audio peak (clamped to 0-100) along with a short label, in slider order.
+// labels should already be shortened for the device's display
+// Format: #AP:50:chrm,75:frfx,30:dscd,0:
+func AudioPeaks(peaks map[int]int, labels map[int]string, numSliders int) string {
+	parts := make([]string, numSliders)
+	for sliderID := 0; sliderID < numSliders; sliderID++ {
+		peak := peaks[sliderID]
+		if peak < minAudioPeak {
+			peak = minAudioPeak
+		} else if peak > maxAudioPeak {
+			peak = maxAudioPeak
+		}
+
+		parts[sliderID] = fmt.Sprintf("%d:%s", peak, SanitizeAudioPeakLabel(labels[sliderID]))
+	}
+
+	return fmt.Sprintf("#AP:%s%s", strings.Join(parts, ","), frameTerminator)
+}
+
+// VUMeter sends every slider's VU meter level as a number of lit segments (clamped to 0-segments), in slider order,
+// for devices with LED bars or rings. the segment count comes first, so the firmware can scale it to its own LEDs
+// Format: #VU:8:3,8,0,5
+func VUMeter(levels map[int]int, segments int, numSliders int) string {
+	values := make([]string, numSliders)
+	for sliderID := 0; sliderID < numSliders; sliderID++ {
+		level := levels[sliderID]
+		if level < 0 {
+			level = 0
+		} else if level > segments {
+			level = segments
+		}
+
+		values[sliderID] = fmt.Sprintf("%d", level)
+	}
+
+	return fmt.Sprintf("#VU:%d:%s%s", segments, strings.Join(values, ","), frameTerminator)
+}
+
+// SliderState is where a slider's targets currently are, for devices that show it
+type SliderState struct {
+	Volume int // 0-100
+	Muted  bool
+}
+
+// SliderStates tells the device where every slider's targets are, in slider order, so that motorized faders,
+// LED rings and displays show the right thing before any slider moves. sliders whose targets can't be found
+// (or that aren't mapped) are "-", which devices should leave as they are
+// Format: #VS:50:0,100:1,-
+func SliderStates(states map[int]SliderState, numSliders int) string {
+	values := make([]string, numSliders)
+	for sliderID := 0; sliderID < numSliders; sliderID++ {
+		state, ok := states[sliderID]
+		if !ok {
+			values[sliderID] = "-"
+			continue
+		}
+
+		volume := state.Volume
+		if volume < 0 {
+			volume = 0
+		} else if volume > 100 {
+			volume = 100
+		}
+
+		values[sliderID] = fmt.Sprintf("%d:%s", volume, boolFlag(state.Muted))
+	}
+
+	return fmt.Sprintf("#VS:%s%s", strings.Join(values, ","), frameTerminator)
+}
+
+// DisplayPage sends a short two-line page for devices with a display to show.
+// title and text should already be fitted to the device's display
+// Format: #D:<title>|<text>
+func DisplayPage(title string, text string) string {
+	return fmt.Sprintf("#D:%s|%s%s", SanitizeDisplayText(title), SanitizeDisplayText(text), frameTerminator)
+}
+
+// ScreenBegin starts a structured screen with the given title, for devices with a display that declared how
+// many rows it has. the device keeps showing its current screen until the new one's ScreenEnd arrives
+// Format: #SB:<title>
+func ScreenBegin(title string) string {
+	return fmt.Sprintf("#SB:%s%s", SanitizeDisplayText(title), frameTerminator)
+}
+
+// ScreenRow sets a row of the screen being sent: a label, some text, and optionally a bar and a meter (0-100,
+// left out when negative), such as a slider's app, its volume as text and as a bar, and its audio peak.
+// label and text should already be fitted to the device's display
+// Format: #SR:<row>:<label>|<text>|<bar>|<meter>
+func ScreenRow(row int, label string, text string, bar int, meter int) string {
+	return fmt.Sprintf("#SR:%d:%s|%s|%s|%s%s",
+		row, SanitizeDisplayText(label), SanitizeDisplayText(text), screenLevel(bar), screenLevel(meter), frameTerminator)
+}
+
+// ScreenEnd finishes the screen being sent, for the device to show it
+// Format: #SE
+func ScreenEnd() string {
+	return "#SE" + frameTerminator
+}
+
+// IdentityRequest asks the device to report its unique ID, which it answers with a line like "#ID:desk-mixer"
+// Format: #ID?
+func IdentityRequest() string {
+	return "#ID?" + frameTerminator
+}
+
+// Hello starts the handshake, which the device answers with a #HELLO line of its own describing itself
+// (firmware version, slider count and what it has). app is deej's version, for the device to show or log,
+// cut short if it's too long
+// Format: #HELLO:proto=<version>,app=<app>
+func Hello(app string) string {
+	app = helloFieldSanitizer.Replace(app)
+	if len(app) > maxHelloAppLength {
+		app = app[:maxHelloAppLength]
+	}
+
+	return fmt.Sprintf("#HELLO:proto=%d,app=%s", Version, app) + frameTerminator
+}
+
+// Quiet has the device stop sending slider values for ten seconds, leaving the port to a firmware uploader
+// Format: #Q
+func Quiet() string {
+	return "#Q" + frameTerminator
+}
+
+// Heartbeat pings the device, which answers with the same line. the sequence number tells answers apart
+// Format: #K:<sequence>
+func Heartbeat(sequence int) string {
+	return fmt.Sprintf("#K:%d%s", sequence, frameTerminator)
+}
+
+// Sleep blanks the device's display and LEDs, or wakes them back up. the device keeps taking commands while
+// asleep, so that it shows what's current once woken
+// Format: #Z:<0|1>
+func Sleep(asleep bool) string {
+	return "#Z:" + boolFlag(asleep) + frameTerminator
+}
+
+// SanitizeAudioPeakLabel removes the characters that separate #AP fields from a label.
+// do this before shortening a label, so that it doesn't come out shorter than it could be
+func SanitizeAudioPeakLabel(label string) string {
+	return audioPeakLabelSanitizer.Replace(label)
+}
+
+// SanitizeDisplayText replaces the characters that separate #D fields (or end the frame early) in display text.
+// do this before fitting text to the display, for the same reason
+func SanitizeDisplayText(text string) string {
+	return displayTextSanitizer.Replace(text)
+}
+
+func screenLevel(level int) string {
+	if level < 0 {
+		return ""
+	}
+
+	if level > maxAudioPeak {
+		level = maxAudioPeak
+	}
+
+	return fmt.Sprintf("%d", level)
+}
+
+func boolFlag(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,181 @@
+package protocol
+
+import "strings"
+
+// the reference deej serves firmware authors, describing every frame of this version of the protocol. examples
+// of what deej sends come from the same functions that build the frames, so they can't drift from the real thing
+
+// which way a frame goes
+const (
+	ToDevice   = "to-device"
+	FromDevice = "from-device"
+)
+
+// the #HELLO and #CAPS fields that decide whether deej sends a device some of its frames. leds, rgb and display
+// are assumed present unless the device turns them off, the rest are off unless it says otherwise
+const (
+	FeatureLEDs    = "leds"
+	FeatureRGB     = "rgb"
+	FeatureDisplay = "display"
+	FeatureRows    = "rows"
+	FeatureFraming = "framing"
+	FeatureSecure  = "secure"
+)
+
+// Command is one of the protocol's frames
+type Command struct {
+	Name        string `json:"name"`
+	Direction   string `json:"direction"`
+	Format      string `json:"format"`
+	Example     string `json:"example"`
+	Description string `json:"description"`
+
+	// the feature the device needs for deej to send it this, if any
+	Requires string `json:"requires,omitempty"`
+}
+
+// Field is one of the key=value fields of a frame that has several (#HELLO, #CAPS)
+type Field struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// Kind is one of the binary frames' kinds (see binary.go)
+type Kind struct {
+	Kind        byte   `json:"kind"`
+	Description string `json:"description"`
+}
+
+// Reference describes everything a device can send and be sent, in this version of the protocol
+type Reference struct {
+	Version             int       `json:"version"`
+	Commands            []Command `json:"commands"`
+	Hello               []Field   `json:"hello"`
+	DisplayCapabilities []Field   `json:"displayCapabilities"`
+	BinaryKinds         []Kind    `json:"binaryKinds"`
+}
+
+// a made-up pairing key, for the #PAIR example
+var examplePairingKey = []byte("0123456789abcdef")
+
+// CurrentReference returns the reference for the protocol version deej speaks
+func CurrentReference() Reference {
+	return Reference{
+		Version:             Version,
+		Commands:            referenceCommands(),
+		Hello:               referenceHelloFields(),
+		DisplayCapabilities: referenceDisplayCapabilities(),
+		BinaryKinds:         referenceBinaryKinds(),
+	}
+}
+
+func referenceCommands() []Command {
+	nonce := []byte("deejnonc")
+
+	commands := []Command{
+		{"#HELLO", ToDevice, "#HELLO:proto=<version>,app=<app>", Hello("v1.0"),
+			"Starts the handshake once the device sends its first line. The device answers with a #HELLO of its own", ""},
+		{"#ID?", ToDevice, "#ID?", IdentityRequest(),
+			"Asks the device for its unique ID, which it answers with #ID", ""},
+		{"#VS", ToDevice, "#VS:<volume>:<muted>,...", SliderStates(map[int]SliderState{0: {50, false}, 1: {100, true}}, 3),
+			"Where every slider's targets are, in slider order, sent once per connection. \"-\" is a slider whose " +
+				"targets aren't running, which the device should leave as it is", ""},
+		{"#L", ToDevice, "#L<slider>:<0|1>", LEDState(2, true),
+			"Turns a single slider's LED on or off", FeatureLEDs},
+		{"#LS", ToDevice, "#LS:<0|1>,...", AllLEDStates(map[int]bool{0: true, 2: true}, 4),
+			"Sets every LED at once, in slider order", FeatureLEDs},
+		{"#LC", ToDevice, "#LC:<rrggbb>,...", LEDColors(map[int]Color{0: {255, 0, 0}, 1: {0, 255, 0}}, 3),
+			"Sets every LED's color at once, in slider order", FeatureRGB},
+		{"#VU", ToDevice, "#VU:<segments>:<level>,...", VUMeter(map[int]int{0: 3, 1: 8, 3: 5}, 8, 4),
+			"Every slider's VU meter level as a number of lit segments, out of the segment count that comes first",
+			FeatureLEDs},
+		{"#AP", ToDevice, "#AP:<peak>:<label>,...", AudioPeaks(map[int]int{0: 50, 1: 75}, map[int]string{0: "chrm", 1: "frfx"}, 2),
+			"Every slider's audio peak (0-100) and a short label for its loudest app, in slider order", FeatureDisplay},
+		{"#D", ToDevice, "#D:<title>|<text>", DisplayPage("Weather", "12C light rain"),
+			"A two-line page for the display, already fitted to its #CAPS widths", FeatureDisplay},
+		{"#SB", ToDevice, "#SB:<title>", ScreenBegin("Mixer"),
+			"Starts a structured screen. The device keeps showing its current one until #SE", FeatureRows},
+		{"#SR", ToDevice, "#SR:<row>:<label>|<text>|<bar>|<meter>", ScreenRow(0, "spfy", "90%", 90, 40),
+			"Sets a row of the screen being sent. Bar and meter (0-100) are empty when the row has none", FeatureRows},
+		{"#SE", ToDevice, "#SE", ScreenEnd(),
+			"Finishes the screen being sent, for the device to show it", FeatureRows},
+		{"#K", ToDevice, "#K:<sequence>", Heartbeat(42),
+			"Pings the device, which answers with the same line", ""},
+		{"#Z", ToDevice, "#Z:<0|1>", Sleep(true),
+			"Blanks the display and LEDs, or wakes them back up. The device keeps taking commands while asleep", ""},
+		{"#Q", ToDevice, "#Q", Quiet(),
+			"Has the device stop sending slider values for ten seconds, leaving the port to a firmware uploader", ""},
+		{"#F", ToDevice, "#F:<framing>", SwitchFraming(FramingBinary),
+			"Asks the device to switch framing. It acknowledges with the same line, the last it sends in the old one",
+			FeatureFraming},
+		{"#PAIR", ToDevice, "#PAIR:<32 hex digits>", Pair(examplePairingKey),
+			"Hands the device a pairing key, to keep aside until #PAIRED says the user confirmed the codes match", ""},
+		{"#PAIRED", ToDevice, "#PAIRED:<0|1>", PairResult(true),
+			"Tells the device whether to keep the key it was handed with #PAIR", ""},
+		{"#S", ToDevice, "#S:<16 hex digits>", StartSession(nonce),
+			"Begins an encrypted session with a paired device, which acknowledges with #S and a nonce of its own", FeatureSecure},
+
+		{"values", FromDevice, "<raw>|<raw>|...", "512|1023|0",
+			"Every slider's raw value (0-1023), in slider order", ""},
+		{"@", FromDevice, "@<milliseconds>:<raw>|<raw>|...", "@123456:512|1023|0",
+			"Slider values with the time the device read them, by its own clock, for network links", ""},
+		{"#B", FromDevice, "#B<button>:<0|1>", "#B1:1",
+			"A button was pressed (1) or released (0). \"#B<button>\" alone is a full click, from older firmware", ""},
+		{"#HELLO", FromDevice, "#HELLO:<key>=<value>,...", "#HELLO:proto=1,fw=1.3.0,sliders=4,buttons=3,leds=1,rgb=0,display=1,id=desk-mixer",
+			"Describes the device (see the hello fields), in answer to deej's #HELLO or by itself on boot", ""},
+		{"#ID", FromDevice, "#ID:<id>", "#ID:desk-mixer",
+			"The device's unique ID, by itself or in answer to #ID?", ""},
+		{"#CAPS", FromDevice, "#CAPS:<key>=<value>,...", "#CAPS:charset=ascii,label=4,title=10,text=21,rows=4",
+			"What the device's display can show (see the display capabilities)", ""},
+		{"#K", FromDevice, "#K:<sequence>", Heartbeat(42),
+			"The answer to a heartbeat, with its sequence number", ""},
+		{"#F", FromDevice, "#F:<framing>", SwitchFraming(FramingBinary),
+			"Acknowledges #F, after which both sides use the new framing", ""},
+		{"#S", FromDevice, "#S:<16 hex digits>", "#S:0011223344556677",
+			"Acknowledges #S with the device's nonce, the last text line it sends before the session's sealed frames", ""},
+	}
+
+	// shown as lines, the way they'd look in a serial monitor
+	for idx := range commands {
+		commands[idx].Example = strings.TrimSuffix(commands[idx].Example, frameTerminator)
+	}
+
+	return commands
+}
+
+func referenceHelloFields() []Field {
+	return []Field{
+		{"proto", "The protocol version the firmware speaks (required)"},
+		{"fw", "The firmware's version, for logs and notifications"},
+		{"id", "The device's unique ID, for profiles and pairing"},
+		{"sliders", "How many sliders it has"},
+		{"buttons", "How many buttons it has"},
+		{"encoders", "How many rotary encoders it has"},
+		{FeatureLEDs, "0 if it has no LEDs (default 1)"},
+		{FeatureRGB, "0 if its LEDs can't show colors (default 1)"},
+		{FeatureDisplay, "0 if it has no display (default 1)"},
+		{FeatureFraming, "A framing it can switch to besides text, e.g. " + FramingBinary},
+		{FeatureSecure, "1 if it was paired, and only talks through an encrypted session"},
+	}
+}
+
+func referenceDisplayCapabilities() []Field {
+	return []Field{
+		{"charset", "utf8, ascii, latin1 or cp1251"},
+		{"label", "How many characters fit a slider's label"},
+		{"title", "How many characters fit a page's title"},
+		{"text", "How many characters fit a page's text"},
+		{FeatureRows, "How many rows a structured screen has, 0 (the default) for none"},
+	}
+}
+
+func referenceBinaryKinds() []Kind {
+	return []Kind{
+		{BinaryKindText, "Any text frame, minus its terminator"},
+		{BinaryKindSliders, "From the device: every slider's raw value, two bytes each (big-endian)"},
+		{BinaryKindLEDStates, "The slider count, then one bit per LED (slider 0 in the first byte's lowest bit)"},
+		{BinaryKindLEDColors, "Three bytes (red, green, blue) per LED"},
+		{BinaryKindVUMeter, "The segment count, then a byte per slider"},
+		{BinaryKindSealed, "Another frame's kind and payload, encrypted for a paired device"},
+	}
+}
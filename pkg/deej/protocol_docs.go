@@ -0,0 +1,277 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const apiPathProtocol = "/protocol"
+
+// protocolDocs is the protocol reference (see protocol/reference.go) as this deej speaks it, along with what the
+// connected device said about itself and which frames deej sends it because of that
+type protocolDocs struct {
+	Version int `json:"version"`
+
+	// deej's own version, and the framing the link uses right now
+	App     string `json:"app"`
+	Framing string `json:"framing"`
+
+	// nil until a device introduces itself, and until then frames aren't marked with whether they're sent
+	Device *protocolDevice `json:"device"`
+
+	Commands            []protocolCommand `json:"commands"`
+	Hello               []protocol.Field  `json:"hello"`
+	DisplayCapabilities []protocol.Field  `json:"displayCapabilities"`
+	BinaryKinds         []protocol.Kind   `json:"binaryKinds"`
+}
+
+// protocolDevice is what the connected device said in its #HELLO and #CAPS
+type protocolDevice struct {
+	Protocol int    `json:"protocol"`
+	Firmware string `json:"firmware"`
+	ID       string `json:"id"`
+	Sliders  int    `json:"sliders"`
+	Buttons  int    `json:"buttons"`
+	Encoders int    `json:"encoders"`
+	LEDs     bool   `json:"leds"`
+	RGB      bool   `json:"rgb"`
+	Display  bool   `json:"display"`
+	Framing  string `json:"framing"`
+	Secure   bool   `json:"secure"`
+
+	Charset    string `json:"charset"`
+	LabelWidth int    `json:"label"`
+	TitleWidth int    `json:"title"`
+	TextWidth  int    `json:"text"`
+	Rows       int    `json:"rows"`
+}
+
+// protocolCommand is a frame, and for the ones deej sends, whether it sends them to the connected device
+type protocolCommand struct {
+	protocol.Command
+	Sent *bool `json:"sent,omitempty"`
+}
+
+// handleProtocol returns the protocol reference as JSON, or as Markdown with ?format=markdown, for firmware
+// authors to check exactly what the running deej speaks and sends their device
+func (as *apiServer) handleProtocol(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	docs := as.deej.serial.protocolDocs()
+
+	switch format := request.URL.Query().Get("format"); format {
+	case "", "json":
+		writer.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(writer).Encode(docs); err != nil {
+			as.logger.Debugw("Failed to write protocol response", "error", err)
+		}
+
+	case "markdown", "md":
+		writer.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+
+		if _, err := writer.Write([]byte(docs.markdown())); err != nil {
+			as.logger.Debugw("Failed to write protocol response", "error", err)
+		}
+
+	default:
+		http.Error(writer, fmt.Sprintf("unknown format %q, use json or markdown", format), http.StatusBadRequest)
+	}
+}
+
+func (sio *SerialIO) protocolDocs() protocolDocs {
+	reference := protocol.CurrentReference()
+
+	docs := protocolDocs{
+		Version:             reference.Version,
+		App:                 strings.TrimPrefix(sio.deej.version, "Version "),
+		Framing:             sio.currentFraming(),
+		Hello:               reference.Hello,
+		DisplayCapabilities: reference.DisplayCapabilities,
+		BinaryKinds:         reference.BinaryKinds,
+	}
+
+	if docs.App == "" {
+		docs.App = "unknown"
+	}
+
+	sio.helloLock.Lock()
+	hello := sio.hello
+	sio.helloLock.Unlock()
+
+	if hello != nil && sio.isConnected() {
+		capabilities, charset := sio.currentDisplayCapabilities()
+
+		docs.Device = &protocolDevice{
+			Protocol:   hello.Protocol,
+			Firmware:   hello.Firmware,
+			ID:         hello.ID,
+			Sliders:    hello.Sliders,
+			Buttons:    hello.Buttons,
+			Encoders:   hello.Encoders,
+			LEDs:       hello.LEDs,
+			RGB:        hello.RGB,
+			Display:    hello.Display,
+			Framing:    hello.Framing,
+			Secure:     hello.Secure,
+			Charset:    charset,
+			LabelWidth: capabilities.LabelWidth,
+			TitleWidth: capabilities.TitleWidth,
+			TextWidth:  capabilities.TextWidth,
+			Rows:       capabilities.Rows,
+		}
+	}
+
+	for _, command := range reference.Commands {
+		entry := protocolCommand{Command: command}
+
+		if docs.Device != nil && command.Direction == protocol.ToDevice {
+			sent := sio.sendsFeature(*hello, command.Requires)
+			entry.Sent = &sent
+		}
+
+		docs.Commands = append(docs.Commands, entry)
+	}
+
+	return docs
+}
+
+// sendsFeature returns whether deej sends the device frames that need the given feature (see protocol.Feature*)
+func (sio *SerialIO) sendsFeature(hello deviceHello, feature string) bool {
+	switch feature {
+	case "":
+		return true
+	case protocol.FeatureLEDs, protocol.FeatureRGB, protocol.FeatureDisplay:
+		return !sio.deviceLacks(feature)
+	case protocol.FeatureRows:
+		capabilities, _ := sio.currentDisplayCapabilities()
+		return hello.Display && capabilities.Rows > 0
+	case protocol.FeatureFraming:
+		return hello.Framing == protocol.FramingBinary && sio.deej.config.SerialFraming == serialFramingBinary
+	case protocol.FeatureSecure:
+		return hello.Secure
+	}
+
+	return false
+}
+
+// markdown renders the docs as a document to read (or save next to firmware sources)
+func (docs protocolDocs) markdown() string {
+	var builder strings.Builder
+
+	line := func(format string, args ...interface{}) {
+		fmt.Fprintf(&builder, format+"\n", args...)
+	}
+
+	line("# deej serial protocol, version %d", docs.Version)
+	line("")
+	line("As spoken by deej version %s. Every frame is a line ending in `\\n` (devices may end theirs in `\\r\\n`), "+
+		"unless the link switched to binary framing. This link uses %s framing.", docs.App, docs.Framing)
+	line("")
+
+	line("## Connected device")
+	line("")
+
+	if device := docs.Device; device != nil {
+		line("| Field | Value |")
+		line("| --- | --- |")
+		line("| proto | %d |", device.Protocol)
+		line("| fw | %s |", markdownCell(device.Firmware))
+		line("| id | %s |", markdownCell(device.ID))
+		line("| sliders, buttons, encoders | %d, %d, %d |", device.Sliders, device.Buttons, device.Encoders)
+		line("| leds, rgb, display | %s, %s, %s |", boolFlag(device.LEDs), boolFlag(device.RGB), boolFlag(device.Display))
+		line("| framing | %s |", markdownCell(device.Framing))
+		line("| secure | %s |", boolFlag(device.Secure))
+		line("| display | %s, label %d, title %d, text %d, rows %d |",
+			device.Charset, device.LabelWidth, device.TitleWidth, device.TextWidth, device.Rows)
+	} else {
+		line("No device has introduced itself with `#HELLO` yet, so frames aren't marked with whether deej sends them.")
+	}
+
+	line("")
+	line("## Sent to the device")
+	line("")
+	line("| Frame | Format | Example | Needs | Sent | Description |")
+	line("| --- | --- | --- | --- | --- | --- |")
+
+	for _, command := range docs.Commands {
+		if command.Direction != protocol.ToDevice {
+			continue
+		}
+
+		sent := "-"
+		if command.Sent != nil {
+			sent = boolFlag(*command.Sent)
+		}
+
+		line("| `%s` | `%s` | `%s` | %s | %s | %s |", markdownCell(command.Name), markdownCell(command.Format),
+			markdownCell(command.Example), markdownCell(command.Requires), sent, markdownCell(command.Description))
+	}
+
+	line("")
+	line("## Sent by the device")
+	line("")
+	line("| Frame | Format | Example | Description |")
+	line("| --- | --- | --- | --- |")
+
+	for _, command := range docs.Commands {
+		if command.Direction != protocol.FromDevice {
+			continue
+		}
+
+		line("| `%s` | `%s` | `%s` | %s |", markdownCell(command.Name), markdownCell(command.Format),
+			markdownCell(command.Example), markdownCell(command.Description))
+	}
+
+	sections := []struct {
+		title  string
+		fields []protocol.Field
+	}{
+		{"`#HELLO` fields", docs.Hello},
+		{"`#CAPS` fields", docs.DisplayCapabilities},
+	}
+
+	for _, section := range sections {
+		line("")
+		line("## %s", section.title)
+		line("")
+		line("| Key | Description |")
+		line("| --- | --- |")
+
+		for _, field := range section.fields {
+			line("| `%s` | %s |", markdownCell(field.Key), markdownCell(field.Description))
+		}
+	}
+
+	line("")
+	line("## Binary frame kinds")
+	line("")
+	line("| Kind | Description |")
+	line("| --- | --- |")
+
+	for _, kind := range docs.BinaryKinds {
+		line("| `0x%02X` | %s |", kind.Kind, markdownCell(kind.Description))
+	}
+
+	return builder.String()
+}
+
+// markdownCell escapes the pipes that would otherwise end a table cell early
+func markdownCell(text string) string {
+	return strings.Replace(text, "|", `\|`, -1)
+}
+
+func boolFlag(value bool) string {
+	if value {
+		return "1"
+	}
+
+	return "0"
+}
@@ -0,0 +1,201 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// the same alert isn't pushed more often than this, so a flaky cable doesn't flood the phone
+	pushAlertCooldown = 5 * time.Minute
+
+	micHotCheckInterval = 30 * time.Second
+	pushRequestTimeout  = 10 * time.Second
+)
+
+// pushAlert is a single critical alert, meant for when nobody's at the PC to see a toast
+type pushAlert struct {
+	Kind    string `json:"kind"`
+	Title   string `json:"title"`
+	Message string `json:"message"`
+}
+
+// pushBackend delivers alerts to a phone through a specific service
+type pushBackend interface {
+	name() string
+	push(alert pushAlert) error
+}
+
+// pushAlerter sends critical alerts (device disconnected, mic left unmuted) to a phone through a pluggable backend
+type pushAlerter struct {
+	deej       *Deej
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+
+	lock       sync.Mutex
+	lastPushed map[string]time.Time
+
+	running      bool
+	micHotSince  time.Time
+	micHotPushed bool
+
+	stopChannel chan bool
+}
+
+func newPushAlerter(deej *Deej, logger *zap.SugaredLogger) *pushAlerter {
+	logger = logger.Named("push")
+
+	pa := &pushAlerter{
+		deej:        deej,
+		logger:      logger,
+		httpClient:  &http.Client{Timeout: pushRequestTimeout},
+		lastPushed:  make(map[string]time.Time),
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created push alerter instance")
+
+	return pa
+}
+
+// Start begins watching for alerts that aren't raised by other components (such as the mic being left on)
+func (pa *pushAlerter) Start() {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+
+	if pa.running {
+		return
+	}
+
+	pa.running = true
+
+	go pa.watchLoop()
+}
+
+// Stop stops watching for alerts
+func (pa *pushAlerter) Stop() {
+	pa.lock.Lock()
+
+	if !pa.running {
+		pa.lock.Unlock()
+		return
+	}
+
+	pa.running = false
+	pa.lock.Unlock()
+
+	pa.stopChannel <- true
+}
+
+// Alert pushes an alert of the given kind in the background, if push alerts (and this kind of alert) are enabled
+func (pa *pushAlerter) Alert(kind string, title string, message string) {
+	config := pa.deej.config.PushAlerts
+	if !config.Enabled || !pa.alertEnabled(config, kind) {
+		return
+	}
+
+	backend := pa.backend(config)
+	if backend == nil {
+		pa.logger.Warnw("Push alerts enabled with an unknown or incomplete service", "service", config.Service)
+		return
+	}
+
+	pa.lock.Lock()
+	if last, ok := pa.lastPushed[kind]; ok && time.Since(last) < pushAlertCooldown {
+		pa.lock.Unlock()
+		pa.logger.Debugw("Skipping push alert during cooldown", "kind", kind)
+
+		return
+	}
+
+	pa.lastPushed[kind] = time.Now()
+	pa.lock.Unlock()
+
+	alert := pushAlert{Kind: kind, Title: title, Message: message}
+
+	go func() {
+		if err := backend.push(alert); err != nil {
+			pa.logger.Warnw("Failed to push alert", "service", backend.name(), "kind", kind, "error", err)
+			return
+		}
+
+		pa.logger.Infow("Pushed alert", "service", backend.name(), "kind", kind)
+	}()
+}
+
+func (pa *pushAlerter) alertEnabled(config pushAlertsConfig, kind string) bool {
+	switch kind {
+	case alertDeviceDisconnected:
+		return config.DeviceDisconnected
+	case alertMicHot:
+		return config.MicHotAfter > 0
+	}
+
+	return true
+}
+
+func (pa *pushAlerter) backend(config pushAlertsConfig) pushBackend {
+	switch config.Service {
+	case pushServiceNtfy:
+		if config.NtfyTopic != "" {
+			return &ntfyBackend{httpClient: pa.httpClient, server: config.NtfyServer, topic: config.NtfyTopic}
+		}
+
+	case pushServicePushover:
+		if config.PushoverToken != "" && config.PushoverUser != "" {
+			return &pushoverBackend{httpClient: pa.httpClient, token: config.PushoverToken, user: config.PushoverUser}
+		}
+
+	case pushServiceWebhook:
+		if config.WebhookURL != "" {
+			return &webhookBackend{httpClient: pa.httpClient, url: config.WebhookURL}
+		}
+	}
+
+	return nil
+}
+
+func (pa *pushAlerter) watchLoop() {
+	ticker := time.NewTicker(micHotCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pa.stopChannel:
+			return
+		case now := <-ticker.C:
+			pa.checkMicHot(now)
+		}
+	}
+}
+
+// checkMicHot pushes a single alert once the mic has stayed unmuted for the configured time
+func (pa *pushAlerter) checkMicHot(now time.Time) {
+	config := pa.deej.config.PushAlerts
+	if !config.Enabled || config.MicHotAfter <= 0 {
+		return
+	}
+
+	muted, ok := pa.deej.sessions.getTargetMute(inputSessionName)
+	if !ok || muted {
+		pa.micHotSince = time.Time{}
+		pa.micHotPushed = false
+
+		return
+	}
+
+	if pa.micHotSince.IsZero() {
+		pa.micHotSince = now
+	}
+
+	if !pa.micHotPushed && now.Sub(pa.micHotSince) >= config.MicHotAfter {
+		pa.micHotPushed = true
+		pa.Alert(alertMicHot, "Mic left on", "Your microphone has been unmuted for a while.")
+	}
+}
@@ -0,0 +1,34 @@
+package deej
+
+import "time"
+
+const (
+	alertDeviceDisconnected = "device_disconnected"
+	alertMicHot             = "mic_hot"
+
+	pushServiceNtfy     = "ntfy"
+	pushServicePushover = "pushover"
+	pushServiceWebhook  = "webhook"
+
+	defaultNtfyServer         = "https://ntfy.sh"
+	defaultMicHotAlertMinutes = 30
+)
+
+// pushAlertsConfig holds the user's push alert settings
+type pushAlertsConfig struct {
+	Enabled bool
+	Service string
+
+	NtfyServer string
+	NtfyTopic  string
+
+	PushoverToken string
+	PushoverUser  string
+
+	WebhookURL string
+
+	DeviceDisconnected bool
+
+	// how long the mic can stay unmuted before an alert is pushed (0 to disable)
+	MicHotAfter time.Duration
+}
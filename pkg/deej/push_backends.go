@@ -0,0 +1,109 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const pushoverEndpoint = "https://api.pushover.net/1/messages.json"
+
+// ntfyBackend publishes alerts to an ntfy topic (https://ntfy.sh, or a self-hosted server)
+type ntfyBackend struct {
+	httpClient *http.Client
+	server     string
+	topic      string
+}
+
+func (nb *ntfyBackend) name() string {
+	return pushServiceNtfy
+}
+
+func (nb *ntfyBackend) push(alert pushAlert) error {
+	request, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/%s", strings.TrimRight(nb.server, "/"), url.PathEscape(nb.topic)),
+		strings.NewReader(alert.Message))
+
+	if err != nil {
+		return fmt.Errorf("create ntfy request: %w", err)
+	}
+
+	request.Header.Set("Title", alert.Title)
+	request.Header.Set("Tags", "deej,"+alert.Kind)
+
+	return doPushRequest(nb.httpClient, request)
+}
+
+// pushoverBackend sends alerts through Pushover's message API
+type pushoverBackend struct {
+	httpClient *http.Client
+	token      string
+	user       string
+}
+
+func (pb *pushoverBackend) name() string {
+	return pushServicePushover
+}
+
+func (pb *pushoverBackend) push(alert pushAlert) error {
+	form := url.Values{}
+	form.Set("token", pb.token)
+	form.Set("user", pb.user)
+	form.Set("title", alert.Title)
+	form.Set("message", alert.Message)
+
+	request, err := http.NewRequest(http.MethodPost, pushoverEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("create pushover request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return doPushRequest(pb.httpClient, request)
+}
+
+// webhookBackend posts alerts as JSON to an arbitrary URL, for anything the other backends don't cover
+type webhookBackend struct {
+	httpClient *http.Client
+	url        string
+}
+
+func (wb *webhookBackend) name() string {
+	return pushServiceWebhook
+}
+
+func (wb *webhookBackend) push(alert pushAlert) error {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("marshal alert: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, wb.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	return doPushRequest(wb.httpClient, request)
+}
+
+func doPushRequest(httpClient *http.Client, request *http.Request) error {
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("send request: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", response.Status)
+	}
+
+	return nil
+}
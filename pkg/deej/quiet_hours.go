@@ -0,0 +1,147 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQuietHoursFrom   = "22:00"
+	defaultQuietHoursTo     = "07:00"
+	defaultQuietHoursMaster = 40
+	defaultQuietHoursApps   = 100
+)
+
+// quietHoursConfig holds the user's quiet hours settings
+type quietHoursConfig struct {
+	Enabled bool
+
+	// when quiet hours start and end, in minutes since midnight. they can run past midnight
+	From int
+	To   int
+
+	// weekdays quiet hours start on, empty meaning every day
+	Days map[time.Weekday]bool
+
+	// the highest master and app volumes (0-1) sliders can set meanwhile
+	Master float32
+	Apps   float32
+
+	// the LED theme to use meanwhile, if any
+	LEDTheme *ledColorTheme
+}
+
+// activeAt returns whether the given time is within quiet hours
+func (config quietHoursConfig) activeAt(now time.Time) bool {
+	minute := now.Hour()*60 + now.Minute()
+	startsOn := func(day time.Time) bool {
+		return len(config.Days) == 0 || config.Days[day.Weekday()]
+	}
+
+	if config.From <= config.To {
+		return minute >= config.From && minute < config.To && startsOn(now)
+	}
+
+	// past midnight, they count as the previous day's
+	if minute >= config.From {
+		return startsOn(now)
+	}
+
+	return minute < config.To && startsOn(now.AddDate(0, 0, -1))
+}
+
+// quietHours caps master and app volumes between the configured hours, turning down anything louder when they
+// start. the automation engine's schedule checks drive it (see automation.go)
+type quietHours struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock   sync.Mutex
+	active bool
+}
+
+func newQuietHours(deej *Deej, logger *zap.SugaredLogger) *quietHours {
+	logger = logger.Named("quiet-hours")
+
+	qh := &quietHours{
+		deej:   deej,
+		logger: logger,
+	}
+
+	logger.Debug("Created quiet hours instance")
+
+	return qh
+}
+
+// update starts or ends quiet hours, as of the given time
+func (qh *quietHours) update(now time.Time) {
+	config := qh.deej.config.QuietHours
+	active := config.Enabled && config.activeAt(now)
+
+	qh.lock.Lock()
+	changed := active != qh.active
+	qh.active = active
+	qh.lock.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if !active {
+		qh.logger.Info("Quiet hours ended")
+		return
+	}
+
+	qh.logger.Infow("Quiet hours started", "master", config.Master, "apps", config.Apps)
+	qh.turnDown(config)
+}
+
+// turnDown fades anything louder than quiet hours allow down to its cap
+func (qh *quietHours) turnDown(config quietHoursConfig) {
+	for sessionKey, volume := range qh.deej.sessions.unmutedVolumes() {
+		highest, ok := qh.volumeCap(sessionKey)
+		if !ok || volume <= highest {
+			continue
+		}
+
+		qh.deej.fader.fadeTargetDefault(sessionKey, highest)
+	}
+}
+
+// volumeCap holds master and apps to the configured volumes during quiet hours (see volume_limits.go)
+func (qh *quietHours) volumeCap(sessionKey string) (float32, bool) {
+	qh.lock.Lock()
+	active := qh.active
+	qh.lock.Unlock()
+
+	if !active || qh.deej.config.automationExempt(sessionKey) {
+		return 0, false
+	}
+
+	config := qh.deej.config.QuietHours
+
+	switch {
+	case sessionKey == masterSessionName:
+		return config.Master, config.Master < 1
+	case isAppSessionKey(sessionKey):
+		return config.Apps, config.Apps < 1
+	}
+
+	return 0, false
+}
+
+// ledTheme returns the LED theme quiet hours use instead of the configured one, while they're on
+func (qh *quietHours) ledTheme() (ledColorTheme, bool) {
+	qh.lock.Lock()
+	active := qh.active
+	qh.lock.Unlock()
+
+	theme := qh.deej.config.QuietHours.LEDTheme
+	if !active || theme == nil {
+		return ledColorTheme{}, false
+	}
+
+	return *theme, true
+}
@@ -0,0 +1,115 @@
+package deej
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// where unstable startups used to be counted, before they moved into the state file
+	legacyUnstableStartupsFilename = "unstable-startups"
+
+	// starting this many times in a row without making it to stable starts deej in safe mode
+	safeModeStartupThreshold = 3
+
+	// deej that's been running this long is considered to have started fine
+	stableStartupDuration = time.Minute
+)
+
+// trackStartup counts this startup as unstable until it proves otherwise, and returns whether the previous
+// ones crashed often enough in a row to start in safe mode
+func (d *Deej) trackStartup() bool {
+	unstableStartups := 0
+
+	err := d.state.updateNow(func(state *persistedState) {
+		state.UnstableStartups += takeLegacyUnstableStartups()
+		unstableStartups = state.UnstableStartups
+		state.UnstableStartups++
+	})
+
+	if err != nil {
+		d.logger.Warnw("Failed to record startup, safe mode won't kick in after crashes", "error", err)
+	}
+
+	return unstableStartups >= safeModeStartupThreshold
+}
+
+// startupSucceeded forgets any unstable startups, once deej has been running for a while or stops cleanly
+func (d *Deej) startupSucceeded() {
+	err := d.state.updateNow(func(state *persistedState) {
+		state.UnstableStartups = 0
+	})
+
+	if err != nil {
+		d.logger.Warnw("Failed to clear unstable startups", "error", err)
+	}
+}
+
+// takeLegacyUnstableStartups reads (and removes) the count left behind by versions of deej before the state file
+func takeLegacyUnstableStartups() int {
+	path := filepath.Join(logDirectory, legacyUnstableStartupsFilename)
+
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+
+	os.Remove(path)
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(contents)))
+	if err != nil || count < 0 {
+		return 0
+	}
+
+	return count
+}
+
+// SetSafeMode makes deej start in safe mode even if it hasn't been crashing, if called before Initialize
+func (d *Deej) SetSafeMode(enabled bool) {
+	d.config.safeMode = enabled
+}
+
+// enterSafeMode tells the user why deej is running with less than their whole config, and where to look
+func (d *Deej) enterSafeMode(forced bool) {
+	d.config.safeMode = true
+
+	reason := fmt.Sprintf("deej crashed during its last %d startups", safeModeStartupThreshold)
+	if forced {
+		reason = "safe mode was asked for"
+	}
+
+	d.logger.Warnw("Starting in safe mode: integrations, audio metering and the API are off",
+		"reason", reason,
+		"logDirectory", logDirectory)
+
+	d.notifier.Notify("deej started in safe mode",
+		fmt.Sprintf("%s, so integrations, audio metering and the API are off. Check the logs in %s.",
+			strings.ToUpper(reason[:1])+reason[1:], logDirectory))
+}
+
+// applySafeMode leaves out everything that isn't needed for sliders to control volumes (and buttons to do
+// their thing): integrations, audio metering and the API. this is re-applied whenever the config is reloaded
+func (cc *CanonicalConfig) applySafeMode() {
+	cc.DisplayPages.Weather.Enabled = false
+	cc.DisplayPages.Calendar.Enabled = false
+	cc.DisplayScreens.Screens = []displayScreen{}
+	cc.DoNotDisturb.Sync = false
+	cc.NowPlaying.Enabled = false
+	cc.Sleep = sleepConfig{}
+	cc.PushAlerts.Enabled = false
+	cc.Webhooks = nil
+	cc.API.Enabled = false
+	cc.DSP = map[string]dspParameter{}
+
+	cc.LEDMode = LEDModeProcess
+	cc.LEDColors.Mode = ledColorModeOff
+	cc.LEDAnimation.Effect = ledAnimationOff
+	cc.VUMeter.Enabled = false
+	cc.Ducking.Enabled = false
+	cc.HearingProtection.Enabled = false
+}
@@ -0,0 +1,74 @@
+package deej
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	buttonActionSceneApply = "scene.apply" // apply the scene given by the "scene" key
+)
+
+// sceneConfig is a named set of absolute volumes, applied all at once (e.g. a "stream" scene
+// setting the game to 40%, discord to 100% and spotify to 15%)
+type sceneConfig struct {
+	Volumes map[string]float32
+	Fade    time.Duration
+	Easing  string
+
+	// output devices to send apps to along with it, by app (see app_routing.go)
+	Routes map[string]string
+}
+
+// sceneNames returns the names of all configured scenes, in alphabetical order
+func sceneNames(scenes map[string]sceneConfig) []string {
+	names := make([]string, 0, len(scenes))
+	for name := range scenes {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// ApplyScene fades every target in the named scene to its configured volume
+func (d *Deej) ApplyScene(name string) error {
+	name = strings.ToLower(name)
+	logger := d.logger.Named("scenes")
+
+	scene, ok := d.config.Scenes[name]
+	if !ok {
+		logger.Warnw("Can't apply unknown scene", "scene", name)
+		return fmt.Errorf("unknown scene: %s", name)
+	}
+
+	missingTargets := []string{}
+
+	for target, volume := range scene.Volumes {
+		if !d.fader.fadeTarget(target, volume, scene.Fade, scene.Easing) {
+			missingTargets = append(missingTargets, target)
+		}
+	}
+
+	// routing an app lists the output devices and refreshes sessions, so it's done in the background
+	if len(scene.Routes) > 0 {
+		go func() {
+			for app, deviceName := range scene.Routes {
+				if err := d.RouteAppTo(app, deviceName); err != nil {
+					logger.Infow("Couldn't route scene app", "scene", name, "app", app, "device", deviceName, "error", err)
+				}
+			}
+		}()
+	}
+
+	logger.Infow("Applied scene", "scene", name, "fade", scene.Fade, "easing", scene.Easing)
+
+	if len(missingTargets) > 0 {
+		logger.Debugw("Some scene targets aren't currently running", "scene", name, "targets", missingTargets)
+	}
+
+	return nil
+}
@@ -4,3 +4,4 @@ echo 'Building deej (all)...'
 
 ./build-dev.sh
 ./build-release.sh
+./build-emulator.sh
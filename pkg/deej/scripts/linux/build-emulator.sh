@@ -0,0 +1,11 @@
+#!/bin/sh
+
+echo 'Building deej-emulator...'
+
+go build -o deej-emulator ./pkg/deej/emulator/cmd
+if [ $? -eq 0 ]; then
+    echo 'Done.'
+else
+    echo 'Error: "go build" exited with a non-zero code. Are you running this script from the root deej directory?'
+    exit 1
+fi
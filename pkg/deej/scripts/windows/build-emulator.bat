@@ -0,0 +1,17 @@
+@ECHO OFF
+
+ECHO Building deej-emulator...
+
+REM set repo root in relation to script path to avoid cwd dependency
+SET "DEEJ_ROOT=%~dp0..\..\..\.."
+
+go build -o "%DEEJ_ROOT%\deej-emulator.exe" "%DEEJ_ROOT%\pkg\deej\emulator\cmd"
+IF %ERRORLEVEL% NEQ 0 GOTO BUILDERROR
+ECHO Done.
+GOTO DONE
+
+:BUILDERROR
+ECHO Failed to build deej-emulator! See above output for details.
+EXIT /B 1
+
+:DONE
@@ -0,0 +1,378 @@
+package deej
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	// how long the self-test waits for every slider to be moved, and every button pressed
+	DefaultSelfTestStepTimeout = 30 * time.Second
+
+	// how long a device gets to introduce itself before it's tested as an older one, going by its slider values
+	selfTestHelloTimeout = 3 * time.Second
+
+	// how long each step of the LED sequence shows for
+	selfTestLEDStep = 400 * time.Millisecond
+
+	// a slider has to travel this much of its range to pass - less than all of it, as worn pots fall short
+	// (see calibration.go)
+	selfTestSliderTravel = maxRawSliderValue * 3 / 4
+
+	selfTestPass = "PASS"
+	selfTestFail = "FAIL"
+	selfTestSkip = "SKIP"
+)
+
+// the colors every LED goes through on RGB devices
+var selfTestColors = []protocol.Color{{R: 255}, {G: 255}, {B: 255}, {R: 255, G: 255, B: 255}}
+
+// selfTestResult is how one of the self-test's checks went
+type selfTestResult struct {
+	check   string
+	outcome string
+	detail  string
+}
+
+// SelfTest checks freshly assembled hardware: it connects to the device, cycles its LEDs and puts a test page on
+// its display for the user to confirm, has them move every slider and press every button, then prints a report.
+// it returns an error if anything failed
+func (d *Deej) SelfTest(stepTimeout time.Duration) error {
+	if err := d.config.Load(); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	// values are only listened to while waiting on them, rather than piling up while the user looks at the LEDs
+	rawValues := d.serial.SubscribeToRawSliderValues()
+
+	if err := d.serial.Start(); err != nil {
+		rawValues.Close()
+		return fmt.Errorf("connect to device: %w", err)
+	}
+
+	defer d.serial.Stop()
+
+	hello, sliders, err := d.awaitSelfTestDevice(rawValues)
+	rawValues.Close()
+
+	if err != nil {
+		return err
+	}
+
+	buttonCount := 0
+	if hello != nil {
+		buttonCount = hello.Buttons
+
+		features := []string{}
+		for _, feature := range []struct {
+			name    string
+			present bool
+		}{{"LEDs", hello.LEDs}, {"RGB", hello.RGB}, {"a display", hello.Display}} {
+			if feature.present {
+				features = append(features, feature.name)
+			}
+		}
+
+		if len(features) == 0 {
+			features = append(features, "nothing else")
+		}
+
+		fmt.Printf("Testing %s: firmware %s, %d sliders, %d buttons, with %s\n",
+			d.serial.comPort, hello.Firmware, sliders, hello.Buttons, strings.Join(features, ", "))
+	} else {
+		fmt.Printf("Testing %s: %d sliders (the firmware doesn't send #HELLO, so deej can't tell what else it has)\n",
+			d.serial.comPort, sliders)
+	}
+
+	input := bufio.NewReader(os.Stdin)
+	results := []selfTestResult{
+		d.selfTestLEDs(input, hello, sliders),
+		d.selfTestDisplay(input, hello),
+	}
+
+	results = append(results, d.selfTestSliders(sliders, stepTimeout)...)
+	results = append(results, d.selfTestButtons(buttonCount, stepTimeout)...)
+
+	failed := 0
+
+	fmt.Println()
+	fmt.Println("Self-test report:")
+
+	for _, result := range results {
+		if result.outcome == selfTestFail {
+			failed++
+		}
+
+		fmt.Println(strings.TrimRight(fmt.Sprintf("  %-10s %s %s", result.check, result.outcome, result.detail), " "))
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+
+	fmt.Println("Everything works.")
+
+	return nil
+}
+
+// awaitSelfTestDevice waits for the device's #HELLO (nil for older firmware) and first slider values, returning
+// how many sliders it has
+func (d *Deej) awaitSelfTestDevice(rawValues *RawSliderValueSubscription) (*deviceHello, int, error) {
+	var values []int
+	deadline := time.After(selfTestHelloTimeout)
+
+	for {
+		select {
+		case values = <-rawValues.Values:
+		case <-deadline:
+			if values == nil {
+				return nil, 0, fmt.Errorf("no slider values received from the device in %s", selfTestHelloTimeout)
+			}
+
+			return nil, len(values), nil
+
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		d.serial.helloLock.Lock()
+		hello := d.serial.hello
+		d.serial.helloLock.Unlock()
+
+		if hello != nil && values != nil {
+			sliders := hello.Sliders
+			if sliders == 0 {
+				sliders = len(values)
+			}
+
+			return hello, sliders, nil
+		}
+	}
+}
+
+// selfTestLEDs lights each slider's LED in turn, then all of them (in every test color, for RGB devices)
+func (d *Deej) selfTestLEDs(input *bufio.Reader, hello *deviceHello, sliders int) selfTestResult {
+	result := selfTestResult{check: "LEDs"}
+
+	if hello != nil && !hello.LEDs {
+		result.outcome, result.detail = selfTestSkip, "(the device has none)"
+		return result
+	}
+
+	fmt.Println()
+	fmt.Println("Lighting each slider's LED in turn, then all of them...")
+
+	frames := []string{}
+	for sliderIdx := 0; sliderIdx < sliders; sliderIdx++ {
+		frames = append(frames, protocol.AllLEDStates(map[int]bool{sliderIdx: true}, sliders))
+	}
+
+	allOn := map[int]bool{}
+	for sliderIdx := 0; sliderIdx < sliders; sliderIdx++ {
+		allOn[sliderIdx] = true
+	}
+
+	frames = append(frames, protocol.AllLEDStates(allOn, sliders))
+
+	rgb := hello == nil || hello.RGB
+	if rgb {
+		for _, color := range selfTestColors {
+			colors := map[int]protocol.Color{}
+			for sliderIdx := 0; sliderIdx < sliders; sliderIdx++ {
+				colors[sliderIdx] = color
+			}
+
+			frames = append(frames, protocol.LEDColors(colors, sliders))
+		}
+	}
+
+	for _, frame := range frames {
+		if err := d.serial.writeCommand(frame); err != nil {
+			result.outcome, result.detail = selfTestFail, fmt.Sprintf("(couldn't send %s: %v)", frame, err)
+			return result
+		}
+
+		time.Sleep(selfTestLEDStep)
+	}
+
+	question := "Did every LED light up, one after the other, then all together?"
+	if rgb {
+		question = "Did every LED light up, one after the other, then all together in red, green, blue and white?"
+	}
+
+	answer := askSelfTestQuestion(input, question)
+
+	if err := d.serial.writeCommand(protocol.AllLEDStates(map[int]bool{}, sliders)); err != nil {
+		d.logger.Debugw("Failed to turn LEDs back off", "error", err)
+	}
+
+	result.outcome = answer
+	return result
+}
+
+// selfTestDisplay puts a test page on the device's display
+func (d *Deej) selfTestDisplay(input *bufio.Reader, hello *deviceHello) selfTestResult {
+	result := selfTestResult{check: "display"}
+
+	if hello != nil && !hello.Display {
+		result.outcome, result.detail = selfTestSkip, "(the device has none)"
+		return result
+	}
+
+	fmt.Println()
+
+	if err := d.serial.SendDisplayPage(displayPage{Title: "deej self-test", Text: "Can you read this?"}); err != nil {
+		result.outcome, result.detail = selfTestFail, fmt.Sprintf("(couldn't send a page: %v)", err)
+		return result
+	}
+
+	result.outcome = askSelfTestQuestion(input, `Does the display say "deej self-test" and "Can you read this?"`)
+	return result
+}
+
+// askSelfTestQuestion asks a yes or no question about what the user sees, passing the check for yes
+func askSelfTestQuestion(input *bufio.Reader, question string) string {
+	fmt.Printf("%s [y/n] ", question)
+
+	answer, _ := input.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	if answer == "y" || answer == "yes" {
+		return selfTestPass
+	}
+
+	return selfTestFail
+}
+
+// selfTestSliders waits for every slider to be moved most of the way along its travel
+func (d *Deej) selfTestSliders(sliders int, timeout time.Duration) []selfTestResult {
+	rawValues := d.serial.SubscribeToRawSliderValues()
+	defer rawValues.Close()
+
+	fmt.Println()
+	fmt.Printf("Move every slider all the way down and all the way up (%s)...\n", timeout)
+
+	minimums := map[int]int{}
+	maximums := map[int]int{}
+	passed := map[int]bool{}
+	deadline := time.After(timeout)
+
+waiting:
+	for len(passed) < sliders {
+		select {
+		case <-deadline:
+			break waiting
+
+		case values := <-rawValues.Values:
+			for sliderIdx, raw := range values {
+				if sliderIdx >= sliders {
+					break
+				}
+
+				if current, ok := minimums[sliderIdx]; !ok || raw < current {
+					minimums[sliderIdx] = raw
+				}
+
+				if current, ok := maximums[sliderIdx]; !ok || raw > current {
+					maximums[sliderIdx] = raw
+				}
+
+				if !passed[sliderIdx] && maximums[sliderIdx]-minimums[sliderIdx] >= selfTestSliderTravel {
+					passed[sliderIdx] = true
+					fmt.Printf("Slider %d: OK\n", sliderIdx)
+				}
+			}
+		}
+	}
+
+	results := []selfTestResult{}
+	for sliderIdx := 0; sliderIdx < sliders; sliderIdx++ {
+		result := selfTestResult{
+			check:   fmt.Sprintf("slider %d", sliderIdx),
+			outcome: selfTestPass,
+			detail:  fmt.Sprintf("(%d - %d)", minimums[sliderIdx], maximums[sliderIdx]),
+		}
+
+		if !passed[sliderIdx] {
+			result.outcome = selfTestFail
+			result.detail = fmt.Sprintf("(only went %d - %d, check its wiring)", minimums[sliderIdx], maximums[sliderIdx])
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// selfTestButtons waits for every button to be pressed. devices that don't say how many they have get however
+// long the timeout is to press whichever they have
+func (d *Deej) selfTestButtons(buttons int, timeout time.Duration) []selfTestResult {
+	events := d.serial.SubscribeToButtonEvents()
+	defer events.Close()
+
+	fmt.Println()
+
+	if buttons > 0 {
+		fmt.Printf("Press every button (%s)...\n", timeout)
+	} else {
+		fmt.Printf("Press every button, if the device has any (%s)...\n", timeout)
+	}
+
+	pressed := map[int]bool{}
+	deadline := time.After(timeout)
+
+waiting:
+	for buttons == 0 || len(pressed) < buttons {
+		select {
+		case <-deadline:
+			break waiting
+
+		case event := <-events.Events:
+			if !event.Pressed || pressed[event.ButtonID] {
+				continue
+			}
+
+			pressed[event.ButtonID] = true
+			fmt.Printf("Button %d: OK\n", event.ButtonID)
+		}
+	}
+
+	// buttons the device didn't mention are reported too, as firmware that numbers them wrong is worth knowing about
+	ids := []int{}
+	for buttonID := 0; buttonID < buttons; buttonID++ {
+		ids = append(ids, buttonID)
+	}
+
+	for buttonID := range pressed {
+		if buttonID < 0 || buttonID >= buttons {
+			ids = append(ids, buttonID)
+		}
+	}
+
+	sort.Ints(ids)
+
+	if len(ids) == 0 {
+		return []selfTestResult{{check: "buttons", outcome: selfTestSkip, detail: "(none pressed, and the device didn't say it has any)"}}
+	}
+
+	results := []selfTestResult{}
+	for _, buttonID := range ids {
+		result := selfTestResult{check: fmt.Sprintf("button %d", buttonID), outcome: selfTestPass}
+
+		switch {
+		case !pressed[buttonID]:
+			result.outcome, result.detail = selfTestFail, "(never pressed)"
+		case buttonID >= buttons && buttons > 0:
+			result.outcome, result.detail = selfTestFail, fmt.Sprintf("(the device says it only has %d)", buttons)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -2,8 +2,10 @@ package deej
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"net"
 	"regexp"
 	"strconv"
 	"strings"
@@ -13,6 +15,7 @@ import (
 	"go.bug.st/serial"
 	"go.uber.org/zap"
 
+	"github.com/omriharel/deej/pkg/deej/protocol"
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
@@ -21,26 +24,105 @@ type SerialIO struct {
 	comPort  string
 	baudRate uint
 
+	// the named device we're connected to (see device_binding.go), or empty if connected through com_port
+	deviceName string
+
+	// the ID the device was looked up by, if any, and the one it reported (see device_identity.go)
+	wantedIdentity string
+	deviceIdentity string
+
 	deej   *Deej
 	logger *zap.SugaredLogger
 
-	stopChannel  chan bool
+	// cancelled by Shutdown, for good
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// what the current connection (and the reconnect loop that follows it if it drops) runs under until Stop,
+	// and its goroutines, which Stop and Shutdown wait for
+	loopCtx    context.Context
+	loopCancel context.CancelFunc
+	loopLock   sync.Mutex
+	loops      sync.WaitGroup
+
+	// the config reload watcher, which only Shutdown stops
+	background sync.WaitGroup
+
+	// the connection and what's going on with it, which are looked at from everywhere (see isConnected and port)
 	connected    bool
 	reconnecting bool
-	connOptions  *serial.Mode
 	conn         serial.Port
-	writeMu      sync.Mutex
+	connLock     sync.Mutex
+
+	connOptions *serial.Mode
+	writeMu     sync.Mutex
+
+	// what kind of link conn is (see pairing.go)
+	link connectionLink
+
+	// whether deej was asked to keep away from the device (see ota.go)
+	held bool
+
+	// pokes the reconnect loop when a device is plugged in (see hotplug.go)
+	arrivalChannel chan bool
+
+	// stands in for the device with --simulate or transport: mock (see mock_device.go)
+	mock *mockDevice
+
+	// the connection chain the connection was made with, and listeners for network devices (see network_listener.go)
+	chain     string
+	listeners map[string]*net.TCPListener
 
 	lastKnownNumSliders        int
 	currentSliderPercentValues []float32
+	sliderFilters              map[int]*sliderFilter
+
+	// the physical sliders' last values by slider ID, and the virtual sliders' worked out from them
+	sliderValues        map[int]float32
+	virtualSliderValues map[int]float32
+
+	// what the connected device's display can show, if it declared it
+	displayCapabilities     *displayCapabilities
+	displayCapabilitiesLock sync.Mutex
+
+	// what the connected device said about itself in the handshake, if it knows it (see handshake.go)
+	hello     *deviceHello
+	helloLock sync.Mutex
+	helloSent bool
+
+	// whether the device was told where its sliders' targets are since connecting (see slider_state.go)
+	slidersSynced bool
 
-	sliderMoveConsumers []chan SliderMoveEvent
+	// the framing in use (see serial_framing.go), and whether binary framing was asked for
+	framing          string
+	framingRequested bool
+	framingLock      sync.Mutex
+
+	// evens out timestamped lines from network devices (see jitter_buffer.go)
+	jitter *jitterBuffer
+
+	// the encrypted session with a paired device, and a pairing waiting for the user to confirm (see pairing.go)
+	session     *deviceSession
+	pairing     *pendingPairing
+	sessionLock sync.Mutex
 }
 
 // SliderMoveEvent represents a single slider move captured by deej
 type SliderMoveEvent struct {
 	SliderID     int
 	PercentValue float32
+
+	// where the fader itself is, before the slider's curve. the same as PercentValue for sliders without one
+	Position float32
+}
+
+// ConnectionEvent is the device connecting or disconnecting
+type ConnectionEvent struct {
+	Connected bool
+	Port      string
+
+	// the named device it is (see device_binding.go), or empty if it was connected to through com_port
+	Device string
 }
 
 var expectedLinePattern = regexp.MustCompile(`^\d{1,4}(\|\d{1,4})*\r\n$`)
@@ -51,14 +133,18 @@ func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
 	logger = logger.Named("serial")
 
 	sio := &SerialIO{
-		deej:                deej,
-		logger:              logger,
-		stopChannel:         make(chan bool),
-		connected:           false,
-		conn:                nil,
-		sliderMoveConsumers: []chan SliderMoveEvent{},
+		deej:           deej,
+		logger:         logger,
+		arrivalChannel: make(chan bool, 1),
+		mock:           newMockDevice(deej, logger),
+		connected:      false,
+		conn:           nil,
+		framing:        protocol.FramingText,
+		jitter:         newJitterBuffer(deej),
 	}
 
+	sio.ctx, sio.cancel = context.WithCancel(context.Background())
+
 	logger.Debug("Created serial i/o instance")
 
 	// respond to config changes
@@ -69,25 +155,182 @@ func NewSerialIO(deej *Deej, logger *zap.SugaredLogger) (*SerialIO, error) {
 
 // Start attempts to connect to our arduino chip
 func (sio *SerialIO) Start() error {
+	return sio.start(sio.loopContext())
+}
+
+// loopContext returns the context the current connection and reconnect loop run under, or a new one if they
+// were stopped
+func (sio *SerialIO) loopContext() context.Context {
+	sio.loopLock.Lock()
+	defer sio.loopLock.Unlock()
+
+	if sio.loopCtx == nil {
+		sio.loopCtx, sio.loopCancel = context.WithCancel(sio.ctx)
+	}
+
+	return sio.loopCtx
+}
+
+// start connects to the device, and reads from it until the given context is cancelled or the device goes away
+func (sio *SerialIO) start(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("serial: stopped: %w", err)
+	}
 
 	// don't allow multiple concurrent connections
-	if sio.connected {
+	if sio.isConnected() {
 		sio.logger.Warn("Already connected, can't start another without closing first")
 		return errors.New("serial: connection already active")
 	}
 
+	// try each device the active profile runs on, in order (or just the one set up by com_port),
+	// unless deej is embedded in a program that brought its own way to reach the device
+	var err error
+	if sio.deej.transport != nil {
+		err = sio.openTransport(sio.deej.transport)
+	} else if sio.deej.simulatingDevice() {
+		err = sio.openTransport(sio.mock)
+	} else {
+		candidates := sio.deej.config.connectionCandidates()
+		sio.chain = fmt.Sprint(sio.deej.config.ConnectionInfo.Chain)
+		sio.closeUnusedListeners(candidates)
+
+		for _, candidate := range candidates {
+			if err = sio.open(candidate); err == nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// finding the device can take a while, during which deej might've been told to stop
+	if err := ctx.Err(); err != nil {
+		if closeErr := sio.port().Close(); closeErr != nil {
+			sio.logger.Debugw("Failed to close connection opened while stopping", "error", closeErr)
+		}
+
+		sio.setPort(nil)
+
+		return fmt.Errorf("serial: stopped: %w", err)
+	}
+
+	namedLogger := sio.logger.Named(strings.ToLower(sio.comPort))
+
+	conn := sio.port()
+
+	namedLogger.Infow("Connected", "conn", conn, "device", sio.deviceName, "id", sio.deviceIdentity)
+
+	// Set DTR to enable bidirectional communication (required for CH340 chips)
+	if err := conn.SetDTR(true); err != nil {
+		namedLogger.Warnw("Failed to set DTR", "error", err)
+	}
+
+	sio.connLock.Lock()
+	sio.connected = true
+	sio.connLock.Unlock()
+	sio.deej.events.recordConnection(sio.comPort, true)
+	sio.deej.webhooks.emit(eventKindConnection, sio.comPort, "connected", map[string]interface{}{"connected": true})
+	sio.deej.bus.connection.publish(ConnectionEvent{Connected: true, Port: sio.comPort, Device: sio.deviceName})
+
+	// read lines or await a stop
+	sio.loops.Add(1)
+	go func() {
+		defer sio.loops.Done()
+
+		connReader := bufio.NewReader(conn)
+		lineChannel := sio.readLine(ctx, namedLogger, connReader)
+
+		// a line deej trips over shouldn't cost it the connection, let alone everything else
+		sio.deej.supervise(ctx, "serial connection", func() {
+			sio.readLoop(ctx, namedLogger, lineChannel)
+		})
+	}()
+
+	return nil
+}
+
+// readLoop handles lines from the device until the connection's stopped or goes away
+func (sio *SerialIO) readLoop(ctx context.Context, logger *zap.SugaredLogger, lineChannel chan string) {
+	for {
+		select {
+		case <-ctx.Done():
+			sio.close(logger)
+			return
+		case line, ok := <-lineChannel:
+			if !ok && ctx.Err() != nil {
+				// closed by the stop, rather than the device going away
+				sio.close(logger)
+				return
+			}
+
+			if !ok {
+				// channel closed — device disconnected
+				sio.logger.Warn("Serial device disconnected")
+				sio.close(logger)
+				sio.deej.notifier.Notify("Device disconnected", "Searching for deej device...")
+				sio.deej.alerts.Alert(alertDeviceDisconnected, "deej disconnected",
+					fmt.Sprintf("The deej device on %s was disconnected.", sio.comPort))
+				sio.deej.processMonitor.Stop()
+				sio.reconnectLoop(ctx)
+				return
+			}
+			sio.deej.recorder.recordInbound(line)
+			sio.deej.console.recordInbound(line)
+			sio.deej.link.recordLine()
+			sio.handleLine(logger, line)
+		}
+	}
+}
+
+// open connects to the given device, auto-detecting its port if needed
+func (sio *SerialIO) open(device deviceConnection) error {
+	if device.Listen != "" {
+		return sio.openListener(device)
+	}
+
+	if device.HID != "" {
+		return sio.openHID(device)
+	}
+
 	sio.connOptions = &serial.Mode{
-		BaudRate: sio.deej.config.ConnectionInfo.BaudRate,
+		BaudRate: device.BaudRate,
 		DataBits: 8,
 		StopBits: serial.OneStopBit,
 		Parity:   serial.NoParity,
 	}
 
-	sio.baudRate = uint(sio.deej.config.ConnectionInfo.BaudRate)
-	sio.comPort = sio.deej.config.ConnectionInfo.COMPort
+	sio.baudRate = uint(device.BaudRate)
+	sio.comPort = device.COMPort
+	sio.deviceName = device.Name
+	sio.wantedIdentity = device.ID
+	sio.deviceIdentity = ""
+
+	// devices with USB IDs or a serial number are found by them, whichever port number the OS handed out this time.
+	// devices with an ID are found by it wherever they are, whichever port they were on before
+	if device.USB != "" || device.SerialNumber != "" {
+		sio.logger.Infow("Looking for device by USB IDs",
+			"device", device.Name,
+			"usb", device.USB,
+			"serialNumber", device.SerialNumber)
+
+		sio.comPort = findPortByUSB(sio.logger, device.USB, device.SerialNumber)
+		if sio.comPort == "" {
+			return fmt.Errorf("open serial connection: no USB device matching %s found",
+				strings.TrimSpace(device.USB+" "+device.SerialNumber))
+		}
+	} else if device.ID != "" {
+		sio.logger.Infow("Looking for device by ID", "device", device.Name, "id", device.ID)
+		sio.comPort = findPortByIdentity(sio.logger, device.ID, int(sio.baudRate))
+		if sio.comPort == "" {
+			return fmt.Errorf("open serial connection: no deej device with ID %s found", device.ID)
+		}
 
-	if sio.comPort == "auto" {
-		sio.logger.Info("Auto-detecting serial port")
+		sio.deviceIdentity = device.ID
+	} else if sio.comPort == "auto" {
+		sio.logger.Infow("Auto-detecting serial port", "device", device.Name)
 		sio.comPort = findDeejPort(sio.logger, int(sio.baudRate))
 		if sio.comPort == "" {
 			return fmt.Errorf("open serial connection: no deej device found")
@@ -95,14 +338,16 @@ func (sio *SerialIO) Start() error {
 	}
 
 	sio.logger.Debugw("Attempting serial connection",
+		"device", device.Name,
 		"comPort", sio.comPort,
 		"baudRate", sio.connOptions.BaudRate)
 
-	var err error
-	sio.conn, err = serial.Open(sio.comPort, sio.connOptions)
+	sio.link = linkSerial
+	conn, err := serial.Open(sio.comPort, sio.connOptions)
 	if err != nil {
-		// If an explicit port failed, try auto-scan as fallback
-		if sio.deej.config.ConnectionInfo.COMPort != "auto" {
+		// If an explicit port failed, try auto-scan as fallback. named devices don't, as that could
+		// find one of the other devices instead
+		if device.COMPort != "auto" && device.Name == "" && device.ID == "" && device.USB == "" && device.SerialNumber == "" {
 			sio.logger.Warnw("Configured port unavailable, falling back to auto-scan",
 				"port", sio.comPort, "error", err)
 
@@ -110,94 +355,93 @@ func (sio *SerialIO) Start() error {
 			if sio.comPort == "" {
 				return fmt.Errorf("open serial connection: no deej device found")
 			}
-			sio.conn, err = serial.Open(sio.comPort, sio.connOptions)
+			conn, err = serial.Open(sio.comPort, sio.connOptions)
 		}
 
 		if err != nil {
-			sio.logger.Warnw("Failed to open serial connection", "error", err)
+			sio.logger.Warnw("Failed to open serial connection", "device", device.Name, "error", err)
 			return fmt.Errorf("open serial connection: %w", err)
 		}
 	}
 
-	namedLogger := sio.logger.Named(strings.ToLower(sio.comPort))
+	sio.setPort(conn)
 
-	namedLogger.Infow("Connected", "conn", sio.conn)
+	return nil
+}
 
-	// Set DTR to enable bidirectional communication (required for CH340 chips)
-	if err := sio.conn.SetDTR(true); err != nil {
-		namedLogger.Warnw("Failed to set DTR", "error", err)
+// Stop shuts down our serial connection (or stops looking for the device), and waits for it to close
+func (sio *SerialIO) Stop() {
+	sio.loopLock.Lock()
+	cancel := sio.loopCancel
+	sio.loopCtx, sio.loopCancel = nil, nil
+	sio.loopLock.Unlock()
+
+	if cancel == nil {
+		sio.logger.Debug("Not currently connected, nothing to stop")
+		return
 	}
 
-	sio.connected = true
+	if sio.isConnected() {
+		sio.logger.Debug("Shutting down serial connection")
+	} else if sio.isReconnecting() {
+		sio.logger.Debug("Stopping reconnect loop")
+	}
 
-	// read lines or await a stop
-	go func() {
-		connReader := bufio.NewReader(sio.conn)
-		lineChannel := sio.readLine(namedLogger, connReader)
+	cancel()
+	waitForGoroutines(sio.logger, &sio.loops)
+}
 
-		for {
-			select {
-			case <-sio.stopChannel:
-				sio.close(namedLogger)
-				return
-			case line, ok := <-lineChannel:
-				if !ok {
-					// channel closed — device disconnected
-					sio.logger.Warn("Serial device disconnected")
-					sio.close(namedLogger)
-					sio.deej.notifier.Notify("Device disconnected", "Searching for deej device...")
-					sio.deej.processMonitor.Stop()
-					sio.startReconnectLoop()
-					return
-				}
-				sio.handleLine(namedLogger, line)
-			}
-		}
-	}()
+// Shutdown closes the connection for good, along with everything watching it, and waits for them to finish.
+// connecting again takes a new SerialIO
+func (sio *SerialIO) Shutdown() {
+	sio.cancel()
+	sio.Stop()
 
-	return nil
+	waitForGoroutines(sio.logger, &sio.background)
+	sio.logger.Debug("Serial i/o shut down")
 }
 
-// Stop signals us to shut down our serial connection, if one is active
-func (sio *SerialIO) Stop() {
-	if sio.connected {
-		sio.logger.Debug("Shutting down serial connection")
-		sio.stopChannel <- true
-	} else if sio.reconnecting {
-		sio.logger.Debug("Stopping reconnect loop")
-		sio.stopChannel <- true
-	} else {
-		sio.logger.Debug("Not currently connected, nothing to stop")
-	}
+// SubscribeToSliderMoveEvents returns a subscription that receives a SliderMoveEvent
+// every time a slider moves. close it once it's no longer read from
+func (sio *SerialIO) SubscribeToSliderMoveEvents() *SliderMoveSubscription {
+	return sio.deej.bus.subscribeToSliderMoves()
 }
 
-// SubscribeToSliderMoveEvents returns an unbuffered channel that receives
-// a sliderMoveEvent struct every time a slider moves
-func (sio *SerialIO) SubscribeToSliderMoveEvents() chan SliderMoveEvent {
-	ch := make(chan SliderMoveEvent)
-	sio.sliderMoveConsumers = append(sio.sliderMoveConsumers, ch)
+// SubscribeToRawSliderValues returns a subscription that receives every line's raw
+// (uncalibrated, 0-1023) slider values, used by the guided calibration
+func (sio *SerialIO) SubscribeToRawSliderValues() *RawSliderValueSubscription {
+	return sio.deej.bus.subscribeToRawSliderValues()
+}
 
-	return ch
+// SubscribeToButtonEvents returns a subscription that receives a ButtonEvent
+// every time a button is pressed or released. close it once it's no longer read from
+func (sio *SerialIO) SubscribeToButtonEvents() *ButtonSubscription {
+	return sio.deej.bus.subscribeToButtons()
 }
 
 // SendLEDState sends a command to the Arduino to turn an LED on or off
 func (sio *SerialIO) SendLEDState(sliderID int, on bool) error {
-	if !sio.connected || sio.conn == nil {
+	if !sio.isConnected() {
 		return errors.New("serial: not connected")
 	}
 
-	state := "0"
-	if on {
-		state = "1"
+	// nothing to do for a device that said it doesn't have LEDs
+	if sio.deviceLacks(deviceFeatureLEDs) {
+		return nil
 	}
 
-	command := fmt.Sprintf("#L%d:%s\n", sliderID, state)
+	// the active profile's slider IDs might not match the device's LEDs one to one
+	ledIdx := sliderID
+	if indices, _ := sio.deviceSliderIndices(0); indices != nil {
+		idx, ok := indices[sliderID]
+		if !ok {
+			return nil
+		}
 
-	sio.writeMu.Lock()
-	defer sio.writeMu.Unlock()
+		ledIdx = idx
+	}
 
-	_, err := sio.conn.Write([]byte(command))
-	if err != nil {
+	if err := sio.writeCommand(protocol.LEDState(ledIdx, on)); err != nil {
 		sio.logger.Warnw("Failed to send LED state", "sliderID", sliderID, "on", on, "error", err)
 		return fmt.Errorf("write LED state: %w", err)
 	}
@@ -210,29 +454,27 @@ func (sio *SerialIO) SendLEDState(sliderID int, on bool) error {
 }
 
 // SendAllLEDStates sends all LED states in a single batched command
-// Format: #LS:1,0,1,0\n (comma-separated states in slider order)
 func (sio *SerialIO) SendAllLEDStates(states map[int]bool, numSliders int) error {
-	if !sio.connected || sio.conn == nil {
+	if !sio.isConnected() {
 		return errors.New("serial: not connected")
 	}
 
-	// Build comma-separated state string
-	stateStrs := make([]string, numSliders)
-	for i := 0; i < numSliders; i++ {
-		if states[i] {
-			stateStrs[i] = "1"
-		} else {
-			stateStrs[i] = "0"
-		}
+	if sio.deviceLacks(deviceFeatureLEDs) {
+		return nil
 	}
 
-	command := fmt.Sprintf("#LS:%s\n", strings.Join(stateStrs, ","))
+	if indices, deviceSliders := sio.deviceSliderIndices(numSliders); indices != nil {
+		deviceStates := make(map[int]bool, len(indices))
+		for sliderID, on := range states {
+			if ledIdx, ok := indices[sliderID]; ok {
+				deviceStates[ledIdx] = on
+			}
+		}
 
-	sio.writeMu.Lock()
-	defer sio.writeMu.Unlock()
+		states, numSliders = deviceStates, deviceSliders
+	}
 
-	_, err := sio.conn.Write([]byte(command))
-	if err != nil {
+	if err := sio.writeCommand(protocol.AllLEDStates(states, numSliders)); err != nil {
 		sio.logger.Warnw("Failed to send all LED states", "error", err)
 		return fmt.Errorf("write all LED states: %w", err)
 	}
@@ -244,27 +486,71 @@ func (sio *SerialIO) SendAllLEDStates(states map[int]bool, numSliders int) error
 	return nil
 }
 
+// SendLEDColors sends every LED's color in a single batched command, for devices with RGB LEDs
+func (sio *SerialIO) SendLEDColors(colors map[int]protocol.Color, numSliders int) error {
+	if !sio.isConnected() {
+		return errors.New("serial: not connected")
+	}
+
+	// plain LEDs (or none at all) can't show colors
+	if sio.deviceLacks(deviceFeatureRGB) {
+		return nil
+	}
+
+	if indices, deviceSliders := sio.deviceSliderIndices(numSliders); indices != nil {
+		deviceColors := make(map[int]protocol.Color, len(indices))
+		for sliderID, color := range colors {
+			if ledIdx, ok := indices[sliderID]; ok {
+				deviceColors[ledIdx] = color
+			}
+		}
+
+		colors, numSliders = deviceColors, deviceSliders
+	}
+
+	if err := sio.writeCommand(protocol.LEDColors(colors, numSliders)); err != nil {
+		sio.logger.Warnw("Failed to send LED colors", "error", err)
+		return fmt.Errorf("write LED colors: %w", err)
+	}
+
+	if sio.deej.Verbose() {
+		sio.logger.Debugw("Sent LED colors", "colors", colors)
+	}
+
+	return nil
+}
+
 // SendAudioPeaks sends audio peak levels with app names for all sliders
-// Format: #AP:50:chrm,75:frfx,30:dscd,0:\n (peak:name pairs)
 func (sio *SerialIO) SendAudioPeaks(peaks map[int]int, names map[int]string, numSliders int) error {
-	if !sio.connected || sio.conn == nil {
+	if !sio.isConnected() {
 		return errors.New("serial: not connected")
 	}
 
-	// Build comma-separated peak:name pairs
-	parts := make([]string, numSliders)
-	for i := 0; i < numSliders; i++ {
-		name := shortenAppName(names[i])
-		parts[i] = fmt.Sprintf("%d:%s", peaks[i], name)
+	// peaks are only ever shown on the display
+	if sio.deviceLacks(deviceFeatureDisplay) {
+		return nil
 	}
 
-	command := fmt.Sprintf("#AP:%s\n", strings.Join(parts, ","))
+	if indices, deviceSliders := sio.deviceSliderIndices(numSliders); indices != nil {
+		devicePeaks := make(map[int]int, len(indices))
+		deviceNames := make(map[int]string, len(indices))
+		for sliderID, sliderIdx := range indices {
+			devicePeaks[sliderIdx] = peaks[sliderID]
+			deviceNames[sliderIdx] = names[sliderID]
+		}
 
-	sio.writeMu.Lock()
-	defer sio.writeMu.Unlock()
+		peaks, names, numSliders = devicePeaks, deviceNames, deviceSliders
+	}
 
-	_, err := sio.conn.Write([]byte(command))
-	if err != nil {
+	capabilities, charset := sio.currentDisplayCapabilities()
+
+	labels := make(map[int]string, len(names))
+	for sliderID, name := range names {
+		name = protocol.SanitizeAudioPeakLabel(name)
+		labels[sliderID] = sio.deej.config.DisplayEncoder.formatDisplayLabel(name, capabilities.LabelWidth, charset)
+	}
+
+	if err := sio.writeCommand(protocol.AudioPeaks(peaks, labels, numSliders)); err != nil {
 		sio.logger.Warnw("Failed to send audio peaks", "error", err)
 		return fmt.Errorf("write audio peaks: %w", err)
 	}
@@ -276,49 +562,75 @@ func (sio *SerialIO) SendAudioPeaks(peaks map[int]int, names map[int]string, num
 	return nil
 }
 
-// shortenAppName creates a 4-char abbreviation by removing vowels
-// e.g., "chrome" → "chrm", "firefox" → "frfx", "discord" → "dscd"
-func shortenAppName(name string) string {
-	if name == "" {
-		return ""
+// SendDisplayPage sends a short two-line page for devices with a display to show
+func (sio *SerialIO) SendDisplayPage(page displayPage) error {
+	if !sio.isConnected() {
+		return errors.New("serial: not connected")
 	}
 
-	vowels := "aeiouAEIOU"
-	var result []byte
+	if sio.deviceLacks(deviceFeatureDisplay) {
+		return nil
+	}
 
-	// First pass: collect consonants
-	for i := 0; i < len(name) && len(result) < 4; i++ {
-		if !strings.ContainsRune(vowels, rune(name[i])) {
-			result = append(result, name[i])
-		}
+	capabilities, charset := sio.currentDisplayCapabilities()
+	encoder := sio.deej.config.DisplayEncoder
+
+	title := encoder.formatDisplayText(protocol.SanitizeDisplayText(page.Title), capabilities.TitleWidth, charset)
+	text := encoder.formatDisplayText(protocol.SanitizeDisplayText(page.Text), capabilities.TextWidth, charset)
+
+	if err := sio.writeCommand(protocol.DisplayPage(title, text)); err != nil {
+		sio.logger.Warnw("Failed to send display page", "error", err)
+		return fmt.Errorf("write display page: %w", err)
 	}
 
-	// If not enough consonants, add vowels from the beginning
-	if len(result) < 4 {
-		for i := 0; i < len(name) && len(result) < 4; i++ {
-			if strings.ContainsRune(vowels, rune(name[i])) {
-				result = append(result, name[i])
-			}
-		}
+	if sio.deej.Verbose() {
+		sio.logger.Debugw("Sent display page", "title", title, "text", text)
+	}
+
+	return nil
+}
+
+// writeCommand sends a single command to the device, keeping concurrent writers from interleaving
+func (sio *SerialIO) writeCommand(command string) error {
+	sio.writeMu.Lock()
+	defer sio.writeMu.Unlock()
+
+	// the simulated harnesses (--soak, --replay and friends) run without a device at all
+	conn := sio.port()
+	if conn == nil {
+		return errors.New("serial: not connected")
+	}
+
+	frame, err := sio.frameCommand(command)
+	if err != nil {
+		return err
 	}
 
-	// If still not enough, just take first chars
-	if len(result) < 4 && len(name) >= 4 {
-		return name[:4]
+	if _, err := conn.Write(frame); err != nil {
+		return err
 	}
 
-	return string(result)
+	sio.deej.recorder.recordOutbound(command)
+	sio.deej.console.recordOutbound(command)
+
+	return nil
 }
 
 func (sio *SerialIO) setupOnConfigReload() {
-	configReloadedChannel := sio.deej.config.SubscribeToChanges()
+	configReloads := sio.deej.config.SubscribeToChanges()
 
 	const stopDelay = 50 * time.Millisecond
 
+	sio.background.Add(1)
 	go func() {
+		defer sio.background.Done()
+		defer configReloads.Close()
+
 		for {
 			select {
-			case <-configReloadedChannel:
+			case <-sio.ctx.Done():
+				return
+			case <-configReloads.Reloads:
 
 				// make any config reload unset our slider number to ensure process volumes are being re-set
 				// (the next read line will emit SliderMoveEvent instances for all sliders)\
@@ -330,11 +642,32 @@ func (sio *SerialIO) setupOnConfigReload() {
 					sio.lastKnownNumSliders = 0
 				}()
 
+				// connections made through a transport don't depend on any of the config's connection params
+				if sio.deej.transport != nil || sio.deej.simulate {
+					continue
+				}
+
+				// neither does the mock device, though switching to or from it reconnects
+				usingMock := sio.comPort == mockDeviceName
+				mockChanged := usingMock != sio.deej.simulatingDevice()
+				if usingMock && !mockChanged {
+					continue
+				}
+
 				// if connection params have changed, attempt to stop and start the connection
-				// skip port comparison when auto-detecting (port is resolved at connect time)
-				portChanged := sio.deej.config.ConnectionInfo.COMPort != "auto" &&
+				// skip port comparison when auto-detecting (port is resolved at connect time).
+				// profiles bound to named devices reconnect when switching to one that doesn't run on this device
+				// connection chains reconnect whenever any of their steps change
+				_, bound := sio.deej.config.DeviceBindings[sio.deej.config.ActiveProfile]
+				chain := sio.deej.config.ConnectionInfo.Chain
+				chainChanged := !bound && fmt.Sprint(chain) != sio.chain
+				unchained := !bound && len(chain) == 0
+				portChanged := unchained && sio.deej.config.ConnectionInfo.COMPort != "auto" &&
 					sio.deej.config.ConnectionInfo.COMPort != sio.comPort
-				if portChanged || sio.deej.config.ConnectionInfo.BaudRate != int(sio.baudRate) {
+				baudRateChanged := unchained && sio.deej.config.ConnectionInfo.BaudRate != int(sio.baudRate)
+				identityChanged := (bound || unchained) && sio.wantedIdentityChanged(bound)
+				if mockChanged || chainChanged || portChanged || baudRateChanged || identityChanged ||
+					(sio.isConnected() && sio.boundDeviceChanged()) {
 
 					sio.logger.Info("Detected change in connection parameters, attempting to renew connection")
 					sio.Stop()
@@ -353,15 +686,97 @@ func (sio *SerialIO) setupOnConfigReload() {
 	}()
 }
 
+// isConnected returns whether the device is connected (and its connection's been set up)
+func (sio *SerialIO) isConnected() bool {
+	sio.connLock.Lock()
+	defer sio.connLock.Unlock()
+
+	return sio.connected
+}
+
+// port returns the connection to the device, which is nil without one. it's there a little before the device
+// counts as connected, while the connection's being set up
+func (sio *SerialIO) port() serial.Port {
+	sio.connLock.Lock()
+	defer sio.connLock.Unlock()
+
+	return sio.conn
+}
+
+// setPort keeps a newly opened connection, or forgets it with nil
+func (sio *SerialIO) setPort(conn serial.Port) {
+	sio.connLock.Lock()
+	defer sio.connLock.Unlock()
+
+	sio.conn = conn
+}
+
 func (sio *SerialIO) close(logger *zap.SugaredLogger) {
-	if err := sio.conn.Close(); err != nil {
+	sio.connLock.Lock()
+	conn := sio.conn
+	sio.conn = nil
+	sio.connected = false
+	sio.connLock.Unlock()
+
+	if err := conn.Close(); err != nil {
 		logger.Warnw("Failed to close serial connection", "error", err)
 	} else {
 		logger.Debug("Serial connection closed")
 	}
 
-	sio.conn = nil
-	sio.connected = false
+	sio.deej.recorder.recordDisconnect()
+	sio.deej.events.recordConnection(sio.comPort, false)
+	sio.deej.webhooks.emit(eventKindConnection, sio.comPort, "disconnected", map[string]interface{}{"connected": false})
+	sio.deej.bus.connection.publish(ConnectionEvent{Connected: false, Port: sio.comPort, Device: sio.deviceName})
+
+	// whatever connects next will declare its own capabilities
+	sio.forgetDisplayCapabilities()
+	sio.forgetHello()
+	sio.forgetSession()
+	sio.resetFraming()
+	sio.slidersSynced = false
+	sio.deej.link.reset()
+	sio.jitter.reset()
+}
+
+func (sio *SerialIO) forgetDisplayCapabilities() {
+	sio.displayCapabilitiesLock.Lock()
+	defer sio.displayCapabilitiesLock.Unlock()
+
+	sio.displayCapabilities = nil
+}
+
+// currentDisplayCapabilities returns the connected device's display capabilities (or the defaults)
+// along with the charset to encode text in
+func (sio *SerialIO) currentDisplayCapabilities() (displayCapabilities, string) {
+	sio.displayCapabilitiesLock.Lock()
+	defer sio.displayCapabilitiesLock.Unlock()
+
+	capabilities := defaultDisplayCapabilities
+	if sio.displayCapabilities != nil {
+		capabilities = *sio.displayCapabilities
+	}
+
+	charset := capabilities.Charset
+	if charset == "" {
+		charset = sio.deej.config.DisplayEncoder.charset
+	}
+
+	return capabilities, charset
+}
+
+func (sio *SerialIO) handleDisplayCapabilities(logger *zap.SugaredLogger, line string) {
+	capabilities, err := parseDisplayCapabilities(line)
+	if err != nil {
+		logger.Warnw("Got malformed display capabilities, ignoring", "line", line, "error", err)
+		return
+	}
+
+	sio.displayCapabilitiesLock.Lock()
+	sio.displayCapabilities = &capabilities
+	sio.displayCapabilitiesLock.Unlock()
+
+	logger.Infow("Device declared display capabilities", "capabilities", capabilities)
 }
 
 const (
@@ -370,59 +785,96 @@ const (
 )
 
 func (sio *SerialIO) startReconnectLoop() {
+	sio.reconnectLoop(sio.loopContext())
+}
+
+// isReconnecting returns whether the reconnect loop is looking for the device
+func (sio *SerialIO) isReconnecting() bool {
+	sio.connLock.Lock()
+	defer sio.connLock.Unlock()
+
+	return sio.reconnecting
+}
+
+func (sio *SerialIO) setReconnecting(reconnecting bool) {
+	sio.connLock.Lock()
+	defer sio.connLock.Unlock()
+
+	sio.reconnecting = reconnecting
+}
+
+// reconnectLoop keeps looking for the device until it's found, or the given context is cancelled
+func (sio *SerialIO) reconnectLoop(ctx context.Context) {
+	sio.connLock.Lock()
 	if sio.reconnecting {
+		sio.connLock.Unlock()
 		return
 	}
 
 	sio.reconnecting = true
+	sio.connLock.Unlock()
 	interval := reconnectBaseInterval
 
+	// devices plugged in while connected don't count
+	select {
+	case <-sio.arrivalChannel:
+	default:
+	}
+
+	sio.loops.Add(1)
 	go func() {
+		defer sio.loops.Done()
+
 		sio.logger.Info("Starting reconnect loop")
 
 		for {
 			select {
-			case <-sio.stopChannel:
-				sio.reconnecting = false
+			case <-ctx.Done():
+				sio.setReconnecting(false)
 				return
+			case <-sio.arrivalChannel:
+				sio.logger.Debug("A device was plugged in, looking for it right away")
+				interval = reconnectBaseInterval
 			case <-time.After(interval):
-				sio.reconnecting = false
+				interval *= 2
+				if interval > reconnectMaxInterval {
+					interval = reconnectMaxInterval
+				}
+			}
 
-				if err := sio.Start(); err != nil {
-					sio.logger.Debugw("Reconnect scan found no device", "error", err)
-					sio.reconnecting = true
+			sio.setReconnecting(false)
 
-					interval *= 2
-					if interval > reconnectMaxInterval {
-						interval = reconnectMaxInterval
-					}
-					continue
-				}
+			if err := sio.start(ctx); err != nil {
+				sio.logger.Debugw("Reconnect scan found no device", "error", err)
+				sio.setReconnecting(true)
+				continue
+			}
 
-				sio.logger.Infow("Reconnected", "port", sio.comPort)
-				sio.deej.notifier.Notify("Device reconnected",
-					fmt.Sprintf("Connected on %s", sio.comPort))
+			sio.logger.Infow("Reconnected", "port", sio.comPort)
+			sio.deej.notifier.Notify("Device reconnected",
+				fmt.Sprintf("Connected on %s", sio.comPort))
 
-				// restart process monitor after a brief init delay
-				go func() {
-					<-time.After(1 * time.Second)
-					sio.deej.processMonitor.Start()
-				}()
+			// restart process monitor after a brief init delay
+			go func() {
+				<-time.After(1 * time.Second)
+				sio.deej.processMonitor.Start()
+			}()
 
-				return
-			}
+			return
 		}
 	}()
 }
 
-func (sio *SerialIO) readLine(logger *zap.SugaredLogger, reader *bufio.Reader) chan string {
-	ch := make(chan string)
+func (sio *SerialIO) readLine(ctx context.Context, logger *zap.SugaredLogger, reader *bufio.Reader) chan string {
+	ch := make(chan stampedLine, jitterQueueSize)
 
+	sio.loops.Add(1)
 	go func() {
+		defer sio.loops.Done()
 		defer close(ch)
 
 		for {
-			line, err := reader.ReadString('\n')
+			line, err := sio.readFramed(logger, reader)
 			if err != nil {
 
 				if sio.deej.Verbose() {
@@ -437,25 +889,88 @@ func (sio *SerialIO) readLine(logger *zap.SugaredLogger, reader *bufio.Reader) c
 				logger.Debugw("Read new line", "line", line)
 			}
 
-			// deliver the line to the channel
-			ch <- line
+			// with --chaos, the line may be held up, dropped, doubled or garbled first (see chaos.go)
+			lines, disconnect := sio.deej.chaos.apply(line)
+
+			// deliver the line to the channel, along with when it arrived for the jitter buffer to go by
+			// (unless the read loop's gone, having been stopped)
+			for _, line := range lines {
+				select {
+				case ch <- stampedLine{line: line, arrived: time.Now()}:
+				case <-ctx.Done():
+					return
+				}
+			}
+
+			// the read that follows fails, which the read loop takes as a disconnect
+			if disconnect {
+				sio.dropConnection()
+			}
 		}
 	}()
 
-	return ch
+	return sio.jitter.pace(ctx, &sio.loops, logger, ch)
 }
 
 func (sio *SerialIO) handleLine(logger *zap.SugaredLogger, line string) {
-	// Check for button commands first (format: #B<id>\r\n)
+
+	// the device is listening now, so introduce ourselves
+	if !sio.helloSent {
+		sio.sendHello(logger)
+	}
+
+	// a paired device's lines (and a network device's, paired or not) only count once its session is up
+	if !sio.trustedLine(line) {
+		if sio.deej.Verbose() {
+			logger.Debugw("Ignoring line from outside of a paired device's session", "line", line)
+		}
+
+		return
+	}
+
+	// now that it's listening (and paired devices' sessions are up), show it where its sliders' targets are
+	sio.syncSliderStates(logger)
+
+	// devices that know the handshake answer it (format: #HELLO:proto=1,fw=1.3.0,sliders=4,...\r\n)
+	if strings.HasPrefix(line, deviceHelloPrefix) {
+		sio.handleDeviceHello(logger, line)
+		return
+	}
+
+	// answers to heartbeats (format: #K:<seq>\r\n)
+	if strings.HasPrefix(line, heartbeatPrefix) {
+		sio.deej.link.recordHeartbeat(line)
+		return
+	}
+
+	// Check for button commands first (format: #B<id>:<state>\r\n)
 	if strings.HasPrefix(line, "#B") {
 		sio.handleButtonCommand(logger, line)
 		return
 	}
 
+	// devices may report their ID (format: #ID:desk-mixer\r\n)
+	if strings.HasPrefix(line, deviceIdentityPrefix) {
+		sio.handleDeviceIdentity(logger, line)
+		return
+	}
+
+	// devices with a display may declare what it can show (format: #CAPS:charset=ascii,label=4,...\r\n)
+	if strings.HasPrefix(line, displayCapabilitiesPrefix) {
+		sio.handleDisplayCapabilities(logger, line)
+		return
+	}
+
 	// this function receives an unsanitized line which is guaranteed to end with LF,
 	// but most lines will end with CRLF. it may also have garbage instead of
 	// deej-formatted values, so we must check for that! just ignore bad ones
 	if !expectedLinePattern.MatchString(line) {
+
+		// commands deej doesn't know are fine, anything else got garbled on the way
+		if !strings.HasPrefix(line, "#") {
+			sio.deej.link.recordLineError()
+		}
+
 		return
 	}
 
@@ -476,30 +991,56 @@ func (sio *SerialIO) handleLine(logger *zap.SugaredLogger, line string) {
 		for idx := range sio.currentSliderPercentValues {
 			sio.currentSliderPercentValues[idx] = -1.0
 		}
+
+		// start smoothing from scratch too, picking up any changed filter settings
+		sio.sliderFilters = make(map[int]*sliderFilter)
+		sio.sliderValues = make(map[int]float32)
+		sio.virtualSliderValues = make(map[int]float32)
 	}
 
-	// for each slider:
-	moveEvents := []SliderMoveEvent{}
+	// convert string values to integers ("1023" -> 1023)
+	rawValues := make([]int, numSliders)
 	for sliderIdx, stringValue := range splitLine {
+		rawValues[sliderIdx], _ = strconv.Atoi(stringValue)
+	}
+
+	// turns out the first line could come out dirty sometimes (i.e. "4558|925|41|643|220")
+	// so let's check the first number for correctness just in case
+	if rawValues[0] > maxRawSliderValue {
+		sio.logger.Debugw("Got malformed line from serial, ignoring", "line", line)
+		return
+	}
 
-		// convert string values to integers ("1023" -> 1023)
-		number, _ := strconv.Atoi(stringValue)
+	sio.deej.bus.rawSliderValues.publish(rawValues)
 
-		// turns out the first line could come out dirty sometimes (i.e. "4558|925|41|643|220")
-		// so let's check the first number for correctness just in case
-		if sliderIdx == 0 && number > 1023 {
-			sio.logger.Debugw("Got malformed line from serial, ignoring", "line", line)
-			return
+	// for each slider:
+	moveEvents := []SliderMoveEvent{}
+	for sliderIdx, number := range rawValues {
+
+		// map the value from raw to a "dirty" float between 0 and 1 (e.g. 0.15451...), through the slider's calibration
+		calibration, ok := sio.deej.config.SliderCalibrations[sliderIdx]
+		if !ok {
+			calibration = defaultSliderCalibration
 		}
 
-		// map the value from raw to a "dirty" float between 0 and 1 (e.g. 0.15451...)
-		dirtyFloat := float32(number) / 1023.0
+		dirtyFloat := calibration.apply(number)
+
+		// smooth out ADC noise, for sliders that have a filter set up
+		if smoothing, ok := sio.deej.config.SliderSmoothing[sliderIdx]; ok {
+			filter, ok := sio.sliderFilters[sliderIdx]
+			if !ok {
+				filter = newSliderFilter(smoothing)
+				sio.sliderFilters[sliderIdx] = filter
+			}
+
+			dirtyFloat = filter.apply(dirtyFloat)
+		}
 
 		// normalize it to an actual volume scalar between 0.0 and 1.0 with 2 points of precision
 		normalizedScalar := util.NormalizeScalar(dirtyFloat)
 
-		// if sliders are inverted, take the complement of 1.0
-		if sio.deej.config.InvertSliders {
+		// if this slider is inverted, take the complement of 1.0
+		if sio.deej.config.InvertSliders.contains(sliderIdx) {
 			normalizedScalar = 1 - normalizedScalar
 		}
 
@@ -509,9 +1050,23 @@ func (sio *SerialIO) handleLine(logger *zap.SugaredLogger, line string) {
 			// if it does, update the saved value and create a move event
 			sio.currentSliderPercentValues[sliderIdx] = normalizedScalar
 
+			// shape the value according to the slider's curve, if it has one. this happens after noise reduction
+			// so that steep parts of a curve don't amplify the slider's jitter
+			percentValue := normalizedScalar
+			if curve, ok := sio.deej.config.SliderCurves[sliderIdx]; ok {
+				percentValue = util.NormalizeScalar(curve.apply(normalizedScalar))
+			}
+
+			// the active profile might know this slider by another ID, or not use it at all on this device
+			sliderID, ok := sio.profileSliderID(sliderIdx)
+			if !ok {
+				continue
+			}
+
 			moveEvents = append(moveEvents, SliderMoveEvent{
-				SliderID:     sliderIdx,
-				PercentValue: normalizedScalar,
+				SliderID:     sliderID,
+				PercentValue: percentValue,
+				Position:     normalizedScalar,
 			})
 
 			if sio.deej.Verbose() {
@@ -520,18 +1075,28 @@ func (sio *SerialIO) handleLine(logger *zap.SugaredLogger, line string) {
 		}
 	}
 
-	// deliver move events if there are any, towards all potential consumers
+	// virtual sliders follow whichever physical ones they use
 	if len(moveEvents) > 0 {
-		for _, consumer := range sio.sliderMoveConsumers {
-			for _, moveEvent := range moveEvents {
-				consumer <- moveEvent
-			}
+		virtualMoves := sio.virtualSliderMoves(moveEvents)
+		if sio.deej.Verbose() && len(virtualMoves) > 0 {
+			logger.Debugw("Virtual sliders moved", "events", virtualMoves)
 		}
+
+		moveEvents = append(moveEvents, virtualMoves...)
+	}
+
+	sio.deliverSliderMoves(moveEvents)
+}
+
+// deliverSliderMoves hands move events to all potential subscribers, if there are any
+func (sio *SerialIO) deliverSliderMoves(moveEvents []SliderMoveEvent) {
+	for _, moveEvent := range moveEvents {
+		sio.deej.bus.sliderMoves.publish(moveEvent)
 	}
 }
 
 func (sio *SerialIO) handleButtonCommand(logger *zap.SugaredLogger, line string) {
-	// Format: #B<id>\r\n
+	// Format: #B<id>:<state>\r\n (1 = pressed, 0 = released), or #B<id>\r\n from older firmware
 	line = strings.TrimSuffix(line, "\r\n")
 	line = strings.TrimSuffix(line, "\n")
 
@@ -539,20 +1104,38 @@ func (sio *SerialIO) handleButtonCommand(logger *zap.SugaredLogger, line string)
 		return
 	}
 
-	buttonID := line[2:] // Get everything after "#B"
+	parts := strings.SplitN(line[2:], ":", 2) // Get everything after "#B"
+
+	buttonID, err := strconv.Atoi(parts[0])
+	if err != nil {
+		logger.Warnw("Got malformed button command, ignoring", "line", line)
+		return
+	}
+
+	var buttonEvents []ButtonEvent
+
+	if len(parts) == 1 {
+
+		// older firmware only reports presses, so treat each one as a full click
+		buttonEvents = []ButtonEvent{
+			{ButtonID: buttonID, Pressed: true},
+			{ButtonID: buttonID, Pressed: false},
+		}
+	} else {
+		buttonEvents = []ButtonEvent{
+			{ButtonID: buttonID, Pressed: parts[1] != "0"},
+		}
+	}
 
 	if sio.deej.Verbose() {
-		logger.Debugw("Button pressed", "buttonID", buttonID)
+		logger.Debugw("Button state changed", "buttonID", buttonID, "events", buttonEvents)
 	}
 
-	switch buttonID {
-	case "0":
-		sio.deej.mediaController.PlayPause()
-	case "1":
-		sio.deej.mediaController.PrevTrack()
-	case "2":
-		sio.deej.mediaController.NextTrack()
-	default:
-		logger.Warnw("Unknown button ID", "buttonID", buttonID)
+	sio.deliverButtonEvents(buttonEvents)
+}
+
+func (sio *SerialIO) deliverButtonEvents(buttonEvents []ButtonEvent) {
+	for _, buttonEvent := range buttonEvents {
+		sio.deej.bus.buttons.publish(buttonEvent)
 	}
 }
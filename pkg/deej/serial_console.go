@@ -0,0 +1,219 @@
+package deej
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	consoleDirectionInbound  = "in"  // a line read from the device
+	consoleDirectionOutbound = "out" // a command written to the device
+
+	// a few seconds of slider traffic, which is plenty to catch what's going on
+	serialConsoleSize = 1000
+
+	apiPathSerial  = "/serial"
+	apiPathConsole = "/console"
+)
+
+// consoleFrame is a single line that went over the device connection
+type consoleFrame struct {
+	Seq       uint64    `json:"seq"`
+	At        time.Time `json:"at"`
+	Direction string    `json:"direction"`
+	Line      string    `json:"line"`
+}
+
+// consoleStatus is what the console page shows above the frames
+type consoleStatus struct {
+	Connected bool   `json:"connected"`
+	Port      string `json:"port"`
+	Device    string `json:"device,omitempty"`
+	BaudRate  uint   `json:"baudRate"`
+
+	// how many lines went each way since deej started
+	Inbound  uint64 `json:"inbound"`
+	Outbound uint64 `json:"outbound"`
+
+	Link linkHealth `json:"link"`
+
+	Frames []consoleFrame `json:"frames"`
+}
+
+// serialConsole keeps the last lines read from and written to the device, so they can be watched from the
+// API's console page while deej holds on to the port - no need to close deej to open a serial monitor
+type serialConsole struct {
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// a ring buffer like the event log's: once full, start points at the oldest frame
+	frames  []consoleFrame
+	start   int
+	lastSeq uint64
+
+	inbound  uint64
+	outbound uint64
+}
+
+func newSerialConsole(logger *zap.SugaredLogger) *serialConsole {
+	logger = logger.Named("console")
+
+	sc := &serialConsole{
+		logger: logger,
+	}
+
+	logger.Debug("Created serial console instance")
+
+	return sc
+}
+
+func (sc *serialConsole) recordInbound(line string) {
+	sc.record(consoleDirectionInbound, line)
+}
+
+func (sc *serialConsole) recordOutbound(command string) {
+	sc.record(consoleDirectionOutbound, command)
+}
+
+func (sc *serialConsole) record(direction string, line string) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	if direction == consoleDirectionInbound {
+		sc.inbound++
+	} else {
+		sc.outbound++
+	}
+
+	sc.lastSeq++
+
+	frame := consoleFrame{
+		Seq:       sc.lastSeq,
+		At:        time.Now(),
+		Direction: direction,
+		Line:      strings.TrimRight(line, "\r\n"),
+	}
+
+	if len(sc.frames) < serialConsoleSize {
+		sc.frames = append(sc.frames, frame)
+		return
+	}
+
+	sc.frames[sc.start] = frame
+	sc.start = (sc.start + 1) % len(sc.frames)
+}
+
+// since returns the frames recorded after the given sequence number going the given direction (or both, if empty)
+// and containing the given text (case-insensitively), oldest first. a limit above 0 only returns that many of the newest
+func (sc *serialConsole) since(seq uint64, direction string, contains string, limit int) []consoleFrame {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	contains = strings.ToLower(contains)
+	result := []consoleFrame{}
+
+	for offset := 0; offset < len(sc.frames); offset++ {
+		frame := sc.frames[(sc.start+offset)%len(sc.frames)]
+
+		if frame.Seq <= seq || (direction != "" && frame.Direction != direction) {
+			continue
+		}
+
+		if contains != "" && !strings.Contains(strings.ToLower(frame.Line), contains) {
+			continue
+		}
+
+		result = append(result, frame)
+	}
+
+	if limit > 0 && len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+
+	return result
+}
+
+func (sc *serialConsole) counts() (uint64, uint64) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+
+	return sc.inbound, sc.outbound
+}
+
+// handleSerial returns the connection's status and the frames after ?since=<seq> as JSON. ?direction=in|out and
+// ?contains=<text> filter the frames, and ?limit=<n> only returns the newest few
+func (as *apiServer) handleSerial(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+
+	var since uint64
+	if value := query.Get("since"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			http.Error(writer, "since must be a frame sequence number", http.StatusBadRequest)
+			return
+		}
+
+		since = parsed
+	}
+
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(writer, "limit must be a number of frames", http.StatusBadRequest)
+			return
+		}
+
+		limit = parsed
+	}
+
+	direction := query.Get("direction")
+	if direction != "" && direction != consoleDirectionInbound && direction != consoleDirectionOutbound {
+		http.Error(writer, "direction must be in or out", http.StatusBadRequest)
+		return
+	}
+
+	serial := as.deej.serial
+	status := consoleStatus{
+		Connected: serial.isConnected(),
+		Port:      serial.comPort,
+		Device:    serial.deviceName,
+		BaudRate:  serial.baudRate,
+		Link:      as.deej.link.current(),
+		Frames:    as.deej.console.since(since, direction, query.Get("contains"), limit),
+	}
+
+	status.Inbound, status.Outbound = as.deej.console.counts()
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(status); err != nil {
+		as.logger.Debugw("Failed to write serial response", "error", err)
+	}
+}
+
+// handleConsole serves the console page, which polls handleSerial
+func (as *apiServer) handleConsole(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writer.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	if _, err := writer.Write([]byte(serialConsolePage)); err != nil {
+		as.logger.Debugw("Failed to write console page", "error", err)
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"go.bug.st/serial"
 	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
 )
 
 const (
@@ -31,7 +33,7 @@ func findDeejPort(logger *zap.SugaredLogger, baudRate int) string {
 	logger.Debugw("Scanning serial ports", "ports", ports)
 
 	for _, portName := range ports {
-		if probePort(logger, portName, baudRate) {
+		if found, _ := probePort(logger, portName, baudRate, false); found {
 			logger.Infow("Found deej device", "port", portName)
 			return portName
 		}
@@ -41,10 +43,11 @@ func findDeejPort(logger *zap.SugaredLogger, baudRate int) string {
 	return ""
 }
 
-// probePort opens a serial port and checks if it produces deej-protocol data.
+// probePort opens a serial port and checks if it produces deej-protocol data. if askIdentity is set,
+// it also asks the device for its ID and returns whatever it reports (or an empty string if it doesn't).
 // Reads directly from the serial port (no bufio) to avoid hanging on dead ports
 // where Read returns (0, nil) on timeout — bufio would retry ~100 times internally.
-func probePort(logger *zap.SugaredLogger, portName string, baudRate int) bool {
+func probePort(logger *zap.SugaredLogger, portName string, baudRate int, askIdentity bool) (bool, string) {
 	mode := &serial.Mode{
 		BaudRate: baudRate,
 		DataBits: 8,
@@ -55,7 +58,7 @@ func probePort(logger *zap.SugaredLogger, portName string, baudRate int) bool {
 	conn, err := serial.Open(portName, mode)
 	if err != nil {
 		logger.Debugw("Skipping port (can't open)", "port", portName, "error", err)
-		return false
+		return false, ""
 	}
 	defer conn.Close()
 
@@ -63,12 +66,14 @@ func probePort(logger *zap.SugaredLogger, portName string, baudRate int) bool {
 	// the outer deadline bounds total probe time.
 	if err := conn.SetReadTimeout(probeReadTimeout); err != nil {
 		logger.Debugw("Skipping port (can't set timeout)", "port", portName, "error", err)
-		return false
+		return false, ""
 	}
 
 	buf := make([]byte, 256)
 	var accumulated string
 	validLines := 0
+	greeted := false
+	identity := ""
 	deadline := time.Now().Add(probeTimeout)
 
 	for time.Now().Before(deadline) {
@@ -91,14 +96,45 @@ func probePort(logger *zap.SugaredLogger, portName string, baudRate int) bool {
 			line := accumulated[:idx+1]
 			accumulated = accumulated[idx+1:]
 
+			if askIdentity && strings.HasPrefix(line, deviceIdentityPrefix) {
+				identity, _ = parseDeviceIdentity(line)
+			}
+
+			// a device answering the handshake is a deej device for sure, no need to wait for more values
+			if strings.HasPrefix(line, deviceHelloPrefix) {
+				if hello, err := parseDeviceHello(line); err == nil {
+					greeted = true
+
+					if hello.ID != "" {
+						identity = hello.ID
+					}
+				}
+			}
+
 			if expectedLinePattern.MatchString(line) {
 				validLines++
-				if validLines >= requiredValidLines {
-					return true
+
+				// boards that reset when the port opens can't hear anything until they're sending values.
+				// older firmware ignores the handshake, so the ID is asked for separately too
+				if validLines == 1 {
+					if _, err := conn.Write([]byte(protocol.Hello(""))); err != nil {
+						logger.Debugw("Failed to send handshake", "port", portName, "error", err)
+					}
+
+					if askIdentity {
+						if _, err := conn.Write([]byte(protocol.IdentityRequest())); err != nil {
+							logger.Debugw("Failed to ask device for its ID", "port", portName, "error", err)
+						}
+					}
 				}
 			}
+
+			found := validLines >= requiredValidLines || greeted
+			if found && (!askIdentity || identity != "") {
+				return true, identity
+			}
 		}
 	}
 
-	return false
+	return validLines >= requiredValidLines || greeted, identity
 }
@@ -0,0 +1,154 @@
+package deej
+
+import (
+	"bufio"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+
+	// plain lines, which every device speaks
+	serialFramingText = "text"
+
+	// binary frames with a CRC (see protocol/binary.go), for devices that offer it in the handshake
+	serialFramingBinary = "binary"
+
+	defaultSerialFraming = serialFramingText
+)
+
+// requestBinaryFraming asks the device to switch to binary framing, if the config wants it and the device
+// offered it in the handshake. nothing changes until the device acknowledges (see readFramed)
+func (sio *SerialIO) requestBinaryFraming(logger *zap.SugaredLogger, hello deviceHello) {
+	if sio.deej.config.SerialFraming != serialFramingBinary || hello.Framing != protocol.FramingBinary {
+		return
+	}
+
+	sio.framingLock.Lock()
+	if sio.framing == protocol.FramingBinary || sio.framingRequested {
+		sio.framingLock.Unlock()
+		return
+	}
+
+	sio.framingRequested = true
+	sio.framingLock.Unlock()
+
+	logger.Debug("Asking device to switch to binary framing")
+
+	if err := sio.writeCommand(protocol.SwitchFraming(protocol.FramingBinary)); err != nil {
+		logger.Warnw("Failed to ask device to switch framing", "error", err)
+	}
+}
+
+// readFramed reads the next line from the device, in whichever framing is in use. binary frames come out as
+// the lines they stand for, and ones that fail their CRC are counted and skipped. so are frames from a paired
+// device that weren't sealed for its session
+func (sio *SerialIO) readFramed(logger *zap.SugaredLogger, reader *bufio.Reader) (string, error) {
+	for {
+		if sio.currentFraming() != protocol.FramingBinary {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return line, err
+			}
+
+			// the device's last text line before it switches, so the next one needs reading differently
+			if strings.TrimSpace(line) == strings.TrimSpace(protocol.SwitchFraming(protocol.FramingBinary)) {
+				sio.setFraming(protocol.FramingBinary)
+				logger.Info("Device switched to binary framing")
+			}
+
+			if strings.HasPrefix(line, sessionStartPrefix) {
+				sio.acknowledgeSession(logger, line)
+			}
+
+			return line, nil
+		}
+
+		kind, payload, err := protocol.ReadBinaryFrame(reader)
+		if err == protocol.ErrCorruptFrame {
+			sio.countFramingError()
+
+			if sio.deej.Verbose() {
+				logger.Debugw("Dropped corrupt binary frame", "error", err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if kind == protocol.BinaryKindSealed {
+			if kind, payload, err = sio.unsealFrame(payload); err != nil {
+				sio.countFramingError()
+				logger.Debugw("Dropped sealed frame", "error", err)
+				continue
+			}
+		} else if sio.secured() {
+			sio.countFramingError()
+			logger.Debugw("Dropped unsealed frame from paired device", "kind", kind)
+			continue
+		}
+
+		line, err := protocol.BinaryToLine(kind, payload)
+		if err != nil {
+			logger.Debugw("Dropped unexpected binary frame", "error", err)
+			continue
+		}
+
+		// a device already using binary framing acknowledges a session in a text frame
+		if strings.HasPrefix(line, sessionStartPrefix) {
+			sio.acknowledgeSession(logger, line)
+		}
+
+		return line, nil
+	}
+}
+
+// frameCommand returns a command the way it's sent in the current framing, sealed if there's a session
+func (sio *SerialIO) frameCommand(command string) ([]byte, error) {
+	if sio.secured() {
+		return sio.sealFrame(command)
+	}
+
+	if sio.currentFraming() != protocol.FramingBinary {
+		return []byte(command), nil
+	}
+
+	// the device still takes text, for anything that doesn't fit a binary frame
+	frame, err := protocol.ToBinary(command)
+	if err != nil {
+		return []byte(command), nil
+	}
+
+	return frame, nil
+}
+
+func (sio *SerialIO) currentFraming() string {
+	sio.framingLock.Lock()
+	defer sio.framingLock.Unlock()
+
+	return sio.framing
+}
+
+func (sio *SerialIO) setFraming(framing string) {
+	sio.framingLock.Lock()
+	defer sio.framingLock.Unlock()
+
+	sio.framing = framing
+	sio.framingRequested = false
+}
+
+// countFramingError counts a frame that had to be dropped, towards the link's health (see link_health.go)
+func (sio *SerialIO) countFramingError() {
+	sio.deej.link.recordLineError()
+}
+
+// resetFraming goes back to text, which whatever connects next starts out speaking
+func (sio *SerialIO) resetFraming() {
+	sio.setFraming(protocol.FramingText)
+}
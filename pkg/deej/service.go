@@ -0,0 +1,58 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+)
+
+const (
+	serviceName        = "deej"
+	serviceDescription = "Controls app volumes with a deej device, without anyone having to be logged in"
+)
+
+// ManageService installs, uninstalls, starts or stops deej as a Windows service, for "deej service <command>".
+// the service runs this executable, next to which it expects config.yaml as usual
+func ManageService(logger *zap.SugaredLogger, out io.Writer, command string) error {
+	logger = logger.Named("service")
+
+	var err error
+	switch command {
+	case "install":
+		err = installService(logger)
+	case "uninstall":
+		err = uninstallService(logger)
+	case "start":
+		err = startService(logger)
+	case "stop":
+		err = stopService(logger)
+	default:
+		return fmt.Errorf("unknown service command %q (install, uninstall, start or stop)", command)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Service %s: done\n", command)
+
+	return nil
+}
+
+// RunService runs deej under the service manager until it's told to stop, for when PrepareService says deej was
+// started as a service. there's no tray or terminal to show anything in, so deej runs like in --cli mode
+func (d *Deej) RunService() error {
+	d.SetCLIMode(true)
+
+	return runService(d)
+}
+
+// handleSessionChange picks up the audio sessions of whoever just logged on, unlocked or connected, as a service
+// outlives user sessions rather than starting with them
+func (d *Deej) handleSessionChange(change string) {
+	d.logger.Infow("User session changed", "change", change)
+
+	// apps of a user who just arrived won't be in the session map yet
+	d.sessions.refreshSessions(true)
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+// +build !windows
+
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// running at boot without anyone logged in is left to the system here (e.g. a systemd user unit with lingering),
+// so deej can't install or run itself as a service
+const serviceSupported = false
+
+// PrepareService reports whether deej was started as a Windows service, which it never is here
+func PrepareService() (bool, error) {
+	return false, nil
+}
+
+func runningAsService() bool {
+	return false
+}
+
+func runService(d *Deej) error {
+	return util.ErrNotSupported
+}
+
+func installService(logger *zap.SugaredLogger) error {
+	return util.ErrNotSupported
+}
+
+func uninstallService(logger *zap.SugaredLogger) error {
+	return util.ErrNotSupported
+}
+
+func startService(logger *zap.SugaredLogger) error {
+	return util.ErrNotSupported
+}
+
+func stopService(logger *zap.SugaredLogger) error {
+	return util.ErrNotSupported
+}
@@ -0,0 +1,270 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// see service_other.go
+const serviceSupported = true
+
+const (
+	// how long stopping the service may take before "deej service stop" gives up waiting
+	serviceStopTimeout = 20 * time.Second
+
+	// restart after crashes, but stop trying if it keeps crashing
+	serviceRestartDelay       = 5 * time.Second
+	serviceRecoveryResetAfter = 24 * 60 * 60 // seconds
+)
+
+// what the service knows about the user's session, from the service manager's session change notifications
+var serviceSession struct {
+	lock    sync.Mutex
+	running bool
+	locked  bool
+}
+
+// PrepareService reports whether deej was started by the service manager, and if so moves into deej's own
+// directory (services start in System32) so that the config and logs are found where they always are. call it
+// before anything else touches them
+func PrepareService() (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return false, fmt.Errorf("check whether running as a service: %w", err)
+	}
+
+	if !isService {
+		return false, nil
+	}
+
+	if err := util.MoveToExecutableDir(); err != nil {
+		return true, err
+	}
+
+	serviceSession.lock.Lock()
+	serviceSession.running = true
+	serviceSession.lock.Unlock()
+
+	return true, nil
+}
+
+// runningAsService reports whether PrepareService found deej running as a service
+func runningAsService() bool {
+	serviceSession.lock.Lock()
+	defer serviceSession.lock.Unlock()
+
+	return serviceSession.running
+}
+
+// serviceSessionLocked reports whether the user's session is locked, if deej is a service and so can't tell by
+// looking at the desktop (it's in a session of its own)
+func serviceSessionLocked() (bool, bool) {
+	serviceSession.lock.Lock()
+	defer serviceSession.lock.Unlock()
+
+	return serviceSession.locked, serviceSession.running
+}
+
+func runService(d *Deej) error {
+	if err := svc.Run(serviceName, &serviceHandler{deej: d}); err != nil {
+		return fmt.Errorf("run service: %w", err)
+	}
+
+	return nil
+}
+
+// serviceHandler runs deej for the service manager, and passes its requests on
+type serviceHandler struct {
+	deej *Deej
+}
+
+func (sh *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.StartPending}
+
+	if err := sh.deej.Start(); err != nil {
+		sh.deej.logger.Errorw("Failed to start service", "error", err)
+		return true, 1
+	}
+
+	status <- svc.Status{
+		State:   svc.Running,
+		Accepts: svc.AcceptStop | svc.AcceptShutdown | svc.AcceptSessionChange,
+	}
+
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+
+			if err := sh.deej.Stop(); err != nil {
+				sh.deej.logger.Warnw("Failed to stop service cleanly", "error", err)
+				return true, 1
+			}
+
+			return false, 0
+
+		case svc.SessionChange:
+			sh.sessionChanged(request.EventType)
+		}
+	}
+
+	return false, 0
+}
+
+func (sh *serviceHandler) sessionChanged(eventType uint32) {
+	switch eventType {
+	case windows.WTS_SESSION_LOCK:
+		serviceSession.lock.Lock()
+		serviceSession.locked = true
+		serviceSession.lock.Unlock()
+
+		sh.deej.logger.Debug("User session locked")
+
+	case windows.WTS_SESSION_UNLOCK:
+		serviceSession.lock.Lock()
+		serviceSession.locked = false
+		serviceSession.lock.Unlock()
+
+		sh.deej.handleSessionChange("unlock")
+
+	case windows.WTS_SESSION_LOGON:
+		serviceSession.lock.Lock()
+		serviceSession.locked = false
+		serviceSession.lock.Unlock()
+
+		sh.deej.handleSessionChange("logon")
+
+	case windows.WTS_SESSION_LOGOFF:
+		sh.deej.handleSessionChange("logoff")
+
+	case windows.WTS_CONSOLE_CONNECT, windows.WTS_REMOTE_CONNECT:
+		sh.deej.handleSessionChange("connect")
+	}
+}
+
+func installService(logger *zap.SugaredLogger) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager (is this an administrator prompt?): %w", err)
+	}
+
+	defer manager.Disconnect()
+
+	service, err := manager.CreateService(serviceName, executable, mgr.Config{
+		DisplayName: serviceName,
+		Description: serviceDescription,
+		StartType:   mgr.StartAutomatic,
+	})
+
+	if err != nil {
+		return fmt.Errorf("create service: %w", err)
+	}
+
+	defer service.Close()
+
+	err = service.SetRecoveryActions([]mgr.RecoveryAction{
+		{Type: mgr.ServiceRestart, Delay: serviceRestartDelay},
+		{Type: mgr.ServiceRestart, Delay: serviceRestartDelay},
+		{Type: mgr.NoAction},
+	}, serviceRecoveryResetAfter)
+
+	if err != nil {
+		logger.Warnw("Failed to have the service restart after crashes", "error", err)
+	}
+
+	logger.Infow("Installed service", "name", serviceName, "executable", executable)
+
+	return nil
+}
+
+func uninstallService(logger *zap.SugaredLogger) error {
+	if err := stopService(logger); err != nil && !errors.Is(err, windows.ERROR_SERVICE_NOT_ACTIVE) {
+		logger.Debugw("Failed to stop service before uninstalling it", "error", err)
+	}
+
+	return withService(func(service *mgr.Service) error {
+		if err := service.Delete(); err != nil {
+			return fmt.Errorf("delete service: %w", err)
+		}
+
+		logger.Infow("Uninstalled service", "name", serviceName)
+
+		return nil
+	})
+}
+
+func startService(logger *zap.SugaredLogger) error {
+	return withService(func(service *mgr.Service) error {
+		if err := service.Start(); err != nil {
+			return fmt.Errorf("start service: %w", err)
+		}
+
+		logger.Infow("Started service", "name", serviceName)
+
+		return nil
+	})
+}
+
+// stopService stops the service, and waits for it to finish stopping
+func stopService(logger *zap.SugaredLogger) error {
+	return withService(func(service *mgr.Service) error {
+		status, err := service.Control(svc.Stop)
+		if err != nil {
+			return fmt.Errorf("stop service: %w", err)
+		}
+
+		deadline := time.Now().Add(serviceStopTimeout)
+
+		for status.State != svc.Stopped {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("service didn't stop within %s", serviceStopTimeout)
+			}
+
+			<-time.After(300 * time.Millisecond)
+
+			if status, err = service.Query(); err != nil {
+				return fmt.Errorf("query service status: %w", err)
+			}
+		}
+
+		logger.Infow("Stopped service", "name", serviceName)
+
+		return nil
+	})
+}
+
+func withService(f func(service *mgr.Service) error) error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("connect to service manager (is this an administrator prompt?): %w", err)
+	}
+
+	defer manager.Disconnect()
+
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("open service (is it installed?): %w", err)
+	}
+
+	defer service.Close()
+
+	return f(service)
+}
@@ -11,14 +11,31 @@ type Session interface {
 	GetVolume() float32
 	SetVolume(v float32) error
 
-	// TODO: future mute support
-	// GetMute() bool
-	// SetMute(m bool) error
+	GetMute() bool
+	SetMute(m bool) error
 
 	Key() string
 	Release()
 }
 
+// identifiedSession is implemented by sessions that know more about their app than its process name,
+// for "title:" and "product:" targets to match against
+type identifiedSession interface {
+	WindowTitles() []string
+	ProductName() string
+}
+
+// processSession is implemented by sessions belonging to a single process, for routing it to another device
+type processSession interface {
+	ProcessID() uint32
+}
+
+// endpointSession is implemented by sessions controlling an audio device's own volume, for "device:" targets
+type endpointSession interface {
+	EndpointName() string
+	IsOutput() bool
+}
+
 const (
 
 	// ideally these would share a common ground in baseSession
@@ -50,5 +67,5 @@ func (s *baseSession) Key() string {
 		return strings.ToLower(s.name) // could be master or mic, or any device's friendly name
 	}
 
-	return strings.ToLower(s.name)
+	return normalizeProcessName(strings.ToLower(s.name))
 }
@@ -8,6 +8,15 @@ import (
 	"go.uber.org/zap"
 )
 
+// see session_finder_other.go
+const audioSessionsSupported = true
+
+// PipeWire is reached through its PulseAudio server, so both backends are the same thing here
+var platformBackends = map[string]bool{
+	backendPulseAudio: true,
+	backendPipeWire:   true,
+}
+
 type paSessionFinder struct {
 	logger        *zap.SugaredLogger
 	sessionLogger *zap.SugaredLogger
@@ -16,10 +25,11 @@ type paSessionFinder struct {
 	conn   net.Conn
 }
 
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
-	client, conn, err := proto.Connect("")
+// newSessionFinder connects to the given PulseAudio server, or to the usual one if it's empty
+func newSessionFinder(logger *zap.SugaredLogger, server string) (SessionFinder, error) {
+	client, conn, err := proto.Connect(server)
 	if err != nil {
-		logger.Warnw("Failed to establish PulseAudio connection", "error", err)
+		logger.Warnw("Failed to establish PulseAudio connection", "server", server, "error", err)
 		return nil, fmt.Errorf("establish PulseAudio connection: %w", err)
 	}
 
@@ -65,6 +75,11 @@ func (sf *paSessionFinder) GetAllSessions() ([]Session, error) {
 		sf.logger.Warnw("Failed to get master audio source session", "error", err)
 	}
 
+	// add a session for every sink, so that each output device can be bound with a device target
+	if err := sf.enumerateAndAddSinkSessions(&sessions); err != nil {
+		sf.logger.Warnw("Failed to enumerate audio sinks", "error", err)
+	}
+
 	// enumerate sink inputs and add sessions along the way
 	if err := sf.enumerateAndAddSessions(&sessions); err != nil {
 		sf.logger.Warnw("Failed to enumerate audio sessions", "error", err)
@@ -119,6 +134,22 @@ func (sf *paSessionFinder) getMasterSourceSession() (Session, error) {
 	return source, nil
 }
 
+func (sf *paSessionFinder) enumerateAndAddSinkSessions(sessions *[]Session) error {
+	request := proto.GetSinkInfoList{}
+	reply := proto.GetSinkInfoListReply{}
+
+	if err := sf.client.Request(&request, &reply); err != nil {
+		sf.logger.Warnw("Failed to get sink list", "error", err)
+		return fmt.Errorf("get sink list: %w", err)
+	}
+
+	for _, info := range reply {
+		*sessions = append(*sessions, newSinkSession(sf.sessionLogger, sf.client, info.SinkIndex, info.Channels, info.Device))
+	}
+
+	return nil
+}
+
 func (sf *paSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 	request := proto.GetSinkInputInfoList{}
 	reply := proto.GetSinkInputInfoListReply{}
@@ -138,8 +169,20 @@ func (sf *paSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 			continue
 		}
 
+		// these are optional, and only used by "title:" and "product:" targets
+		mediaName := ""
+		if property, ok := info.Properties["media.name"]; ok {
+			mediaName = property.String()
+		}
+
+		applicationName := ""
+		if property, ok := info.Properties["application.name"]; ok {
+			applicationName = property.String()
+		}
+
 		// create the deej session object
-		newSession := newPASession(sf.sessionLogger, sf.client, info.SinkInputIndex, info.Channels, name.String())
+		newSession := newPASession(sf.sessionLogger, sf.client, info.SinkInputIndex, info.Channels, name.String(),
+			mediaName, applicationName)
 
 		// add it to our slice
 		*sessions = append(*sessions, newSession)
@@ -0,0 +1,34 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// there's no audio backend for this platform yet. rather than refusing to start, deej runs without
+// any sessions - sliders control nothing, but everything that doesn't need them (buttons, LEDs, pages) still works
+const audioSessionsSupported = false
+
+// only the dummy backend works here
+var platformBackends = map[string]bool{}
+
+type unsupportedSessionFinder struct{}
+
+func newSessionFinder(logger *zap.SugaredLogger, server string) (SessionFinder, error) {
+	logger.Named("session_finder").Warnw("Audio sessions aren't supported on this platform, sliders won't control anything",
+		"error", util.ErrNotSupported)
+
+	return &unsupportedSessionFinder{}, nil
+}
+
+func (sf *unsupportedSessionFinder) GetAllSessions() ([]Session, error) {
+	return []Session{}, nil
+}
+
+func (sf *unsupportedSessionFinder) Release() error {
+	return nil
+}
@@ -13,6 +13,13 @@ import (
 	"go.uber.org/zap"
 )
 
+// see session_finder_other.go
+const audioSessionsSupported = true
+
+var platformBackends = map[string]bool{
+	backendWASAPI: true,
+}
+
 type wcaSessionFinder struct {
 	logger        *zap.SugaredLogger
 	sessionLogger *zap.SugaredLogger
@@ -42,7 +49,8 @@ const (
 	deviceSessionFormat = "device.%s"
 )
 
-func newSessionFinder(logger *zap.SugaredLogger) (SessionFinder, error) {
+// newSessionFinder creates a WASAPI session finder. there's no server to pick on Windows, so server is ignored
+func newSessionFinder(logger *zap.SugaredLogger, server string) (SessionFinder, error) {
 	sf := &wcaSessionFinder{
 		logger:        logger.Named("session_finder"),
 		sessionLogger: logger.Named("sessions"),
@@ -364,6 +372,9 @@ func (sf *wcaSessionFinder) enumerateAndAddSessions(sessions *[]Session) error {
 			return fmt.Errorf("get device %d master session: %w", deviceIdx, err)
 		}
 
+		newSession.endpointName = endpointFriendlyName
+		newSession.output = dataFlow == wca.ERender
+
 		// add it to our slice
 		*sessions = append(*sessions, newSession)
 	}
@@ -19,6 +19,10 @@ type paSession struct {
 
 	processName string
 
+	// from the stream's properties - the closest pulse has to a window title and a product name
+	mediaName       string
+	applicationName string
+
 	client *proto.Client
 
 	sinkInputIndex    uint32
@@ -33,6 +37,9 @@ type masterSession struct {
 	streamIndex    uint32
 	streamChannels byte
 	isOutput       bool
+
+	// the sink's description, for "device:" targets. unset for the default sink and source (master and mic)
+	endpointName string
 }
 
 func newPASession(
@@ -41,12 +48,16 @@ func newPASession(
 	sinkInputIndex uint32,
 	sinkInputChannels byte,
 	processName string,
+	mediaName string,
+	applicationName string,
 ) *paSession {
 
 	s := &paSession{
 		client:            client,
 		sinkInputIndex:    sinkInputIndex,
 		sinkInputChannels: sinkInputChannels,
+		mediaName:         mediaName,
+		applicationName:   applicationName,
 	}
 
 	s.processName = processName
@@ -93,6 +104,33 @@ func newMasterSession(
 	return s
 }
 
+// newSinkSession creates a session for a specific sink (output device), keyed like the device target binding it
+func newSinkSession(
+	logger *zap.SugaredLogger,
+	client *proto.Client,
+	sinkIndex uint32,
+	sinkChannels byte,
+	description string,
+) *masterSession {
+
+	s := &masterSession{
+		client:         client,
+		streamIndex:    sinkIndex,
+		streamChannels: sinkChannels,
+		isOutput:       true,
+		endpointName:   description,
+	}
+
+	s.logger = logger.Named(fmt.Sprintf("sink.%d", sinkIndex))
+	s.master = true
+	s.name = targetDevicePrefix + description
+	s.humanReadableDesc = description
+
+	s.logger.Debugw(sessionCreationLogMessage, "session", s)
+
+	return s
+}
+
 func (s *paSession) GetVolume() float32 {
 	request := proto.GetSinkInputInfo{
 		SinkInputIndex: s.sinkInputIndex,
@@ -125,6 +163,49 @@ func (s *paSession) SetVolume(v float32) error {
 	return nil
 }
 
+func (s *paSession) GetMute() bool {
+	request := proto.GetSinkInputInfo{
+		SinkInputIndex: s.sinkInputIndex,
+	}
+	reply := proto.GetSinkInputInfoReply{}
+
+	if err := s.client.Request(&request, &reply); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+	}
+
+	return reply.Muted
+}
+
+func (s *paSession) SetMute(m bool) error {
+	request := proto.SetSinkInputMute{
+		SinkInputIndex: s.sinkInputIndex,
+		Mute:           m,
+	}
+
+	if err := s.client.Request(&request, nil); err != nil {
+		s.logger.Warnw("Failed to set session mute state", "error", err)
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+
+	return nil
+}
+
+// WindowTitles implements identifiedSession with the stream's media name, which browsers set to the tab's title
+func (s *paSession) WindowTitles() []string {
+	if s.mediaName == "" {
+		return nil
+	}
+
+	return []string{s.mediaName}
+}
+
+// ProductName implements identifiedSession with the stream's application name
+func (s *paSession) ProductName() string {
+	return s.applicationName
+}
+
 func (s *paSession) Release() {
 	s.logger.Debug("Releasing audio session")
 }
@@ -195,6 +276,62 @@ func (s *masterSession) SetVolume(v float32) error {
 	return nil
 }
 
+func (s *masterSession) GetMute() bool {
+	if s.isOutput {
+		request := proto.GetSinkInfo{
+			SinkIndex: s.streamIndex,
+		}
+		reply := proto.GetSinkInfoReply{}
+
+		if err := s.client.Request(&request, &reply); err != nil {
+			s.logger.Warnw("Failed to get session mute state", "error", err)
+			return false
+		}
+
+		return reply.Mute
+	}
+
+	request := proto.GetSourceInfo{
+		SourceIndex: s.streamIndex,
+	}
+	reply := proto.GetSourceInfoReply{}
+
+	if err := s.client.Request(&request, &reply); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+		return false
+	}
+
+	return reply.Mute
+}
+
+func (s *masterSession) SetMute(m bool) error {
+	var request proto.RequestArgs
+
+	if s.isOutput {
+		request = &proto.SetSinkMute{
+			SinkIndex: s.streamIndex,
+			Mute:      m,
+		}
+	} else {
+		request = &proto.SetSourceMute{
+			SourceIndex: s.streamIndex,
+			Mute:        m,
+		}
+	}
+
+	if err := s.client.Request(request, nil); err != nil {
+		s.logger.Warnw("Failed to set session mute state",
+			"error", err,
+			"mute", m)
+
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+
+	return nil
+}
+
 func (s *masterSession) Release() {
 	s.logger.Debug("Releasing audio session")
 }
@@ -203,6 +340,14 @@ func (s *masterSession) String() string {
 	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
 }
 
+func (s *masterSession) EndpointName() string {
+	return s.endpointName
+}
+
+func (s *masterSession) IsOutput() bool {
+	return s.isOutput
+}
+
 func createChannelVolumes(channels byte, volume float32) []uint32 {
 	volumes := make([]uint32, channels)
 
@@ -1,13 +1,14 @@
 package deej
 
 import (
+	"context"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/omriharel/deej/pkg/deej/util"
 	"github.com/thoas/go-funk"
 	"go.uber.org/zap"
 )
@@ -21,8 +22,39 @@ type sessionMap struct {
 
 	sessionFinder SessionFinder
 
+	// the backend the session finder was created for, if it came from the config (see backend.go)
+	backend backendConfig
+
 	lastSessionRefresh time.Time
-	unmappedSessions   []Session
+
+	// app sessions no slider is mapped to, and the same for master, system, mic and device sessions
+	// (which deej.unmapped only grabs when asked to, see unmapped_group.go)
+	unmappedSessions        []Session
+	unmappedSpecialSessions []Session
+
+	// volumes for targets that weren't running when their slider moved, by target (see not_running.go)
+	queuedVolumes map[string]float32
+	queueLock     sync.Mutex
+	watchingQueue bool
+
+	// every session key found by the last refresh, to tell which sessions are new (see launch_sync.go)
+	knownSessionKeys map[string]bool
+
+	// the volume each slider last set, for sessions showing up after it moved
+	sliderValues     map[int]float32
+	sliderValuesLock sync.Mutex
+
+	// where each slider's fader was when it last moved, before its curve (see slider_readout.go)
+	sliderPositions map[int]float32
+
+	// when a slider last moved, for the idle LED effect (see led_animation.go)
+	lastSliderMove time.Time
+
+	// cancelled by release, which waits for the goroutines following config reloads, slider moves and the
+	// queue to finish before letting go of the sessions they use
+	ctx        context.Context
+	cancel     context.CancelFunc
+	goroutines sync.WaitGroup
 }
 
 const (
@@ -66,14 +98,35 @@ func newSessionMap(deej *Deej, logger *zap.SugaredLogger, sessionFinder SessionF
 		m:             make(map[string][]Session),
 		lock:          &sync.Mutex{},
 		sessionFinder: sessionFinder,
+		queuedVolumes: make(map[string]float32),
+		sliderValues:  make(map[int]float32),
+
+		sliderPositions: make(map[int]float32),
 	}
 
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+
 	logger.Debug("Created session map instance")
 
 	return m, nil
 }
 
 func (m *sessionMap) initialize() error {
+	if m.sessionFinder == nil {
+		m.backend = m.deej.config.Backend
+
+		sessionFinder, err := newBackendSessionFinder(m.deej.logger, m.backend)
+		if err != nil {
+			m.logger.Warnw("Failed to create session finder", "backend", m.backend.Name, "error", err)
+			return fmt.Errorf("create session finder for %s backend: %w", m.backend.Name, err)
+		}
+
+		m.logger.Infow("Using audio backend", "backend", m.backend.Name)
+		m.sessionFinder = sessionFinder
+	}
+
+	m.restoreState()
+
 	if err := m.getAndAddSessions(); err != nil {
 		m.logger.Warnw("Failed to get all sessions during session map initialization", "error", err)
 		return fmt.Errorf("get all sessions during init: %w", err)
@@ -85,7 +138,54 @@ func (m *sessionMap) initialize() error {
 	return nil
 }
 
+// restoreState picks up where the last run left off: slider positions (for apps launching before the device
+// reports in) and volumes still waiting for their app to launch
+func (m *sessionMap) restoreState() {
+	sliderValues := map[int]float32{}
+	queuedVolumes := map[string]float32{}
+
+	// copy it all out first, as saving queued volumes takes the state's lock while holding the queue's
+	m.deej.state.view(func(state *persistedState) {
+		for sliderID, value := range state.SliderValues {
+			sliderValues[sliderID] = value
+		}
+
+		for target, volume := range state.QueuedVolumes {
+			queuedVolumes[target] = volume
+		}
+	})
+
+	m.sliderValuesLock.Lock()
+	for sliderID, value := range sliderValues {
+		m.sliderValues[sliderID] = value
+	}
+	m.sliderValuesLock.Unlock()
+
+	m.queueLock.Lock()
+	defer m.queueLock.Unlock()
+
+	for target, volume := range queuedVolumes {
+		m.queuedVolumes[target] = volume
+	}
+
+	if len(m.queuedVolumes) > 0 && !m.watchingQueue {
+		m.logger.Debugw("Restored queued volumes", "volumes", m.queuedVolumes)
+
+		m.watchingQueue = true
+		m.goroutines.Add(1)
+		go m.watchQueue()
+	}
+}
+
 func (m *sessionMap) release() error {
+	m.cancel()
+	waitForGoroutines(m.logger, &m.goroutines)
+
+	// the backend might have failed to start
+	if m.sessionFinder == nil {
+		return nil
+	}
+
 	if err := m.sessionFinder.Release(); err != nil {
 		m.logger.Warnw("Failed to release session finder during session map release", "error", err)
 		return fmt.Errorf("release session finder during release: %w", err)
@@ -101,6 +201,7 @@ func (m *sessionMap) getAndAddSessions() error {
 	// mark that we're refreshing before anything else
 	m.lastSessionRefresh = time.Now()
 	m.unmappedSessions = nil
+	m.unmappedSpecialSessions = nil
 
 	sessions, err := m.sessionFinder.GetAllSessions()
 	if err != nil {
@@ -108,44 +209,124 @@ func (m *sessionMap) getAndAddSessions() error {
 		return fmt.Errorf("get sessions from SessionFinder: %w", err)
 	}
 
+	m.deej.recorder.recordSessions(sessions)
+
+	// nothing is new on the first refresh, as every slider sends its value once the device connects anyway
+	previousKeys := m.knownSessionKeys
+	m.knownSessionKeys = make(map[string]bool, len(sessions))
+	launched := []Session{}
+
 	for _, session := range sessions {
 		m.add(session)
 
-		if !m.sessionMapped(session) {
+		m.knownSessionKeys[session.Key()] = true
+		if previousKeys != nil && !previousKeys[session.Key()] {
+			launched = append(launched, session)
+		}
+
+		if m.sessionMapped(session) {
+			continue
+		}
+
+		if isAppSessionKey(session.Key()) {
 			m.logger.Debugw("Tracking unmapped session", "session", session)
 			m.unmappedSessions = append(m.unmappedSessions, session)
+		} else {
+			m.unmappedSpecialSessions = append(m.unmappedSpecialSessions, session)
 		}
 	}
 
 	m.logger.Infow("Got all audio sessions successfully", "sessionMap", m)
 
+	// apps that launched since the last refresh start out where their slider is
+	m.applyToLaunchedSessions(launched)
+
+	// apps that were queued a volume might've just launched
+	m.applyQueuedVolumes()
+
+	if event, changed := sessionChanges(previousKeys, m.knownSessionKeys); changed {
+		m.deej.bus.sessions.publish(event)
+	}
+
 	return nil
 }
 
+// SessionEvent is the audio sessions that appeared and went away since they were last looked up, by key (the
+// lowercase process name, or a special target like "master"). the first lookup has every session as added
+type SessionEvent struct {
+	Added   []string
+	Removed []string
+}
+
+func sessionChanges(previousKeys map[string]bool, currentKeys map[string]bool) (SessionEvent, bool) {
+	event := SessionEvent{}
+
+	for key := range currentKeys {
+		if !previousKeys[key] {
+			event.Added = append(event.Added, key)
+		}
+	}
+
+	for key := range previousKeys {
+		if !currentKeys[key] {
+			event.Removed = append(event.Removed, key)
+		}
+	}
+
+	sort.Strings(event.Added)
+	sort.Strings(event.Removed)
+
+	return event, len(event.Added) > 0 || len(event.Removed) > 0
+}
+
 func (m *sessionMap) setupOnConfigReload() {
-	configReloadedChannel := m.deej.config.SubscribeToChanges()
+	configReloads := m.deej.config.SubscribeToChanges()
 
+	m.goroutines.Add(1)
 	go func() {
-		for {
-			select {
-			case <-configReloadedChannel:
-				m.logger.Info("Detected config reload, attempting to re-acquire all audio sessions")
-				m.refreshSessions(false)
+		defer m.goroutines.Done()
+		defer configReloads.Close()
+
+		m.deej.supervise(m.ctx, "session refresh", func() {
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case <-configReloads.Reloads:
+					m.logger.Info("Detected config reload, attempting to re-acquire all audio sessions")
+
+					// the session finder stays as it is until deej restarts
+					if m.backend.Name != "" && m.deej.config.Backend != m.backend {
+						m.logger.Warnw("Audio backend changed, restart deej to switch",
+							"backend", m.backend.Name,
+							"configuredBackend", m.deej.config.Backend.Name)
+					}
+
+					m.refreshSessions(false)
+				}
 			}
-		}
+		})
 	}()
 }
 
 func (m *sessionMap) setupOnSliderMove() {
-	sliderEventsChannel := m.deej.serial.SubscribeToSliderMoveEvents()
+	sliderMoves := m.deej.serial.SubscribeToSliderMoveEvents()
 
+	m.goroutines.Add(1)
 	go func() {
-		for {
-			select {
-			case event := <-sliderEventsChannel:
-				m.handleSliderMoveEvent(event)
+		defer m.goroutines.Done()
+		defer sliderMoves.Close()
+
+		m.deej.supervise(m.ctx, "slider handling", func() {
+			for {
+				select {
+				case <-m.ctx.Done():
+					return
+				case event := <-sliderMoves.Events:
+					m.handleSliderMoveEvent(event)
+				}
 			}
-		}
+		})
 	}()
 }
 
@@ -167,22 +348,17 @@ func (m *sessionMap) refreshSessions(force bool) {
 	}
 }
 
-// returns true if a session is not currently mapped to any slider, false otherwise
-// special sessions (master, system, mic) and device-specific sessions always count as mapped,
-// even when absent from the config. this makes sense for every current feature that uses "unmapped sessions"
+// returns true if a session is currently mapped to any slider, false otherwise.
+// special sessions (master, system, mic) and device-specific sessions can only be mapped by name
 func (m *sessionMap) sessionMapped(session Session) bool {
+	_, mapped := m.sliderMappedTo(session)
+	return mapped
+}
 
-	// count master/system/mic as mapped
-	if funk.ContainsString([]string{masterSessionName, systemSessionName, inputSessionName}, session.Key()) {
-		return true
-	}
-
-	// count device sessions as mapped
-	if deviceSessionKeyPattern.MatchString(session.Key()) {
-		return true
-	}
-
-	matchFound := false
+// returns the slider a session is mapped to (the first one, if several are), or false if none are
+func (m *sessionMap) sliderMappedTo(session Session) (int, bool) {
+	appSession := isAppSessionKey(session.Key())
+	mappedSlider := -1
 
 	// look through the actual mappings
 	m.deej.config.SliderMapping.iterate(func(sliderIdx int, targets []string) {
@@ -193,17 +369,24 @@ func (m *sessionMap) sessionMapped(session Session) bool {
 				continue
 			}
 
-			// safe to assume this has a single element because we made sure there's no special transform
-			target = m.resolveTarget(target)[0]
+			// patterns only ever match apps
+			if !appSession && isTargetPattern(target) {
+				continue
+			}
+
+			// this also covers pattern, identity and device targets, which can't be resolved yet as the map is still being filled
+			if targetMatchesName(target, session.Key()) || identityTargetMatches(target, session) ||
+				deviceTargetMatches(target, session) {
+				if mappedSlider == -1 || sliderIdx < mappedSlider {
+					mappedSlider = sliderIdx
+				}
 
-			if target == session.Key() {
-				matchFound = true
 				return
 			}
 		}
 	})
 
-	return matchFound
+	return mappedSlider, mappedSlider != -1
 }
 
 func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
@@ -214,6 +397,9 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 		m.refreshSessions(true)
 	}
 
+	m.rememberSliderValue(event.SliderID, event.PercentValue)
+	m.rememberSliderPosition(event.SliderID, event.Position)
+
 	// get the targets mapped to this slider from the config
 	targets, ok := m.deej.config.SliderMapping.get(event.SliderID)
 
@@ -224,39 +410,73 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 
 	targetFound := false
 	adjustmentFailed := false
+	sliderCapped := false
+
+	// sliders for "whatever's playing" only move the loudest or most recent of their apps (see slider_sessions.go)
+	onlyKey, only := m.sliderSessionFilter(event.SliderID, targets)
 
 	// for each possible target for this slider...
 	for _, target := range targets {
 
-		// resolve the target name by cleaning it up and applying any special transformations.
-		// depending on the transformation applied, this can result in more than one target name
-		resolvedTargets := m.resolveTarget(target)
+		// the user's hand wins over any fade still running on this target
+		m.deej.fader.cancel(target)
 
-		// for each resolved target...
-		for _, resolvedTarget := range resolvedTargets {
+		// DSP parameters aren't audio sessions, hand them off and move on
+		if m.deej.dsp.handlesTarget(target) {
+			if err := m.deej.dsp.setParameter(target, event.PercentValue); err != nil {
+				m.logger.Warnw("Failed to set DSP parameter", "target", target, "error", err)
+			}
+
+			targetFound = true
+			continue
+		}
 
-			// check the map for matching sessions
-			sessions, ok := m.get(resolvedTarget)
+		// find every session this target refers to. depending on the target, this can be any number of them.
+		// deej.unmapped can be refined per slider, so it's looked up with this slider's settings
+		var sessions []Session
+		if isUnmappedTarget(target) {
+			sessions = m.unmappedGroupSessions(m.deej.config.unmappedGroup(event.SliderID))
+		} else {
+			sessions = m.targetSessions(target)
+		}
 
-			// no sessions matching this target - move on
-			if !ok {
+		// no sessions matching this target - move on, unless it has a fallback to move instead
+		if len(sessions) == 0 {
+			if sessions = m.handleTargetNotRunning(target, event.PercentValue); len(sessions) == 0 {
 				continue
 			}
-
+		} else {
+			m.forgetQueuedVolume(target)
 			targetFound = true
+		}
 
-			// iterate all matching sessions and adjust the volume of each one
-			for _, session := range sessions {
-				if session.GetVolume() != event.PercentValue {
-					if err := session.SetVolume(event.PercentValue); err != nil {
-						m.logger.Warnw("Failed to set target session volume", "error", err)
-						adjustmentFailed = true
-					}
+		// iterate all matching sessions and adjust the volume of each one
+		for _, session := range sessions {
+			if only && session.Key() != onlyKey {
+				continue
+			}
+
+			// volume limits (hearing protection, quiet hours) can hold the session below where the slider is
+			volume, capped := m.limitVolume(session.Key(), event.PercentValue)
+			sliderCapped = sliderCapped || capped
+
+			if session.GetVolume() != volume {
+				if err := session.SetVolume(volume); err != nil {
+					m.logger.Warnw("Failed to set target session volume", "error", err)
+					adjustmentFailed = true
+				} else {
+					m.deej.recorder.recordVolume(session.Key(), volume)
+					m.deej.events.recordVolume(session.Key(), volume)
 				}
 			}
 		}
 	}
 
+	// pushing a slider past a cap flashes its LED, so it's clear why nothing's getting louder
+	if sliderCapped {
+		m.deej.processMonitor.FlashLED(event.SliderID)
+	}
+
 	// if we still haven't found a target or the volume adjustment failed, maybe look for the target again.
 	// processes could've opened since the last time this slider moved.
 	// if they haven't, the cooldown will take care to not spam it up
@@ -271,12 +491,128 @@ func (m *sessionMap) handleSliderMoveEvent(event SliderMoveEvent) {
 	}
 }
 
+// setTargetMute mutes or unmutes every session matching the given target, returning false if none were found
+func (m *sessionMap) setTargetMute(target string, mute bool) bool {
+	return m.applyToTarget(target, func(session Session) error {
+		if session.GetMute() == mute {
+			return nil
+		}
+
+		if err := session.SetMute(mute); err != nil {
+			return err
+		}
+
+		value := "unmuted"
+		if mute {
+			value = "muted"
+		}
+
+		m.deej.webhooks.emit(webhookEventMute, session.Key(), value, map[string]interface{}{"muted": mute})
+
+		return nil
+	})
+}
+
+// setTargetVolume sets every session matching the given target to the given volume, returning false if none were found
+func (m *sessionMap) setTargetVolume(target string, volume float32) bool {
+	return m.applyToTarget(target, func(session Session) error {
+		if session.GetVolume() == volume {
+			return nil
+		}
+
+		if err := session.SetVolume(volume); err != nil {
+			return err
+		}
+
+		m.deej.events.recordVolume(session.Key(), volume)
+
+		return nil
+	})
+}
+
+// getTargetVolume returns the volume of the first session matching the given target
+func (m *sessionMap) getTargetVolume(target string) (float32, bool) {
+	if sessions := m.targetSessions(target); len(sessions) > 0 {
+		return sessions[0].GetVolume(), true
+	}
+
+	return 0, false
+}
+
+// applyToTarget calls f for every session matching the given target, returning false if none were found
+func (m *sessionMap) applyToTarget(target string, f func(Session) error) bool {
+	targetFound := false
+	adjustmentFailed := false
+
+	for _, session := range m.targetSessions(target) {
+		targetFound = true
+
+		if err := f(session); err != nil {
+			m.logger.Warnw("Failed to adjust target session", "target", target, "error", err)
+			adjustmentFailed = true
+		}
+	}
+
+	// same reasoning as slider moves - a failed adjustment most likely means a stale session
+	if !targetFound {
+		m.refreshSessions(false)
+	} else if adjustmentFailed {
+		m.refreshSessions(true)
+	}
+
+	return targetFound
+}
+
+// getTargetMute reports whether all sessions matching the given target are currently muted
+func (m *sessionMap) getTargetMute(target string) (bool, bool) {
+	muted := true
+	targetFound := false
+
+	for _, session := range m.targetSessions(target) {
+		targetFound = true
+		muted = muted && session.GetMute()
+	}
+
+	return muted && targetFound, targetFound
+}
+
 func (m *sessionMap) targetHasSpecialTransform(target string) bool {
 	return strings.HasPrefix(target, specialTargetTransformPrefix)
 }
 
+// targetSessions returns every session the given target refers to
+func (m *sessionMap) targetSessions(target string) []Session {
+
+	// identity targets pick out individual sessions, rather than every session of a process
+	if isIdentityTarget(target) {
+		return m.sessionsMatchingIdentity(target)
+	}
+
+	// device targets pick out the sessions controlling output devices' own volume
+	if isDeviceTarget(target) {
+		return m.sessionsMatchingDevice(target)
+	}
+
+	sessions := []Session{}
+
+	// resolve the target name by cleaning it up and applying any special transformations.
+	// depending on the transformation applied, this can result in more than one target name
+	for _, resolvedTarget := range m.resolveTarget(target) {
+		if resolvedSessions, ok := m.get(resolvedTarget); ok {
+			sessions = append(sessions, resolvedSessions...)
+		}
+	}
+
+	return sessions
+}
+
 func (m *sessionMap) resolveTarget(target string) []string {
 
+	// patterns resolve to every session they match (before lowercasing, which could change their meaning)
+	if isTargetPattern(target) {
+		return m.keysMatching(target)
+	}
+
 	// start by ignoring the case
 	target = strings.ToLower(target)
 
@@ -290,37 +626,139 @@ func (m *sessionMap) resolveTarget(target string) []string {
 
 func (m *sessionMap) applyTargetTransform(specialTargetName string) []string {
 
+	// get the current active window, overall or on a specific monitor (the focus follower keeps track of it)
+	if monitor, ok := parseCurrentWindowTarget(specialTargetTransformPrefix + specialTargetName); ok {
+		return m.deej.focus.currentProcessNames(monitor)
+	}
+
 	// select the transformation based on its name
 	switch specialTargetName {
 
-	// get current active window
-	case specialTargetCurrentWindow:
-		currentWindowProcessNames, err := util.GetCurrentWindowProcessNames()
+	// get currently unmapped sessions
+	case specialTargetAllUnmapped:
+		unmappedSessions := m.unmappedGroupSessions(defaultUnmappedGroup)
 
-		// silently ignore errors here, as this is on deej's "hot path" (and it could just mean the user's running linux)
-		if err != nil {
-			return nil
+		targetKeys := make([]string, len(unmappedSessions))
+		for sessionIdx, session := range unmappedSessions {
+			targetKeys[sessionIdx] = session.Key()
 		}
 
-		// we could have gotten a non-lowercase names from that, so let's ensure we return ones that are lowercase
-		for targetIdx, target := range currentWindowProcessNames {
-			currentWindowProcessNames[targetIdx] = strings.ToLower(target)
+		return targetKeys
+	}
+
+	return nil
+}
+
+// keysMatching returns the keys of every app session matching the given pattern target, in a stable order.
+// master, system, mic and device sessions are left out, so that broad patterns (e.g. "*") only catch apps
+func (m *sessionMap) keysMatching(target string) []string {
+	pattern, ok := targetPattern(target)
+	if !ok {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := []string{}
+
+	for key := range m.m {
+		if isAppSessionKey(key) && pattern.MatchString(key) {
+			keys = append(keys, key)
 		}
+	}
 
-		// remove dupes
-		return funk.UniqString(currentWindowProcessNames)
+	sort.Strings(keys)
 
-	// get currently unmapped sessions
-	case specialTargetAllUnmapped:
-		targetKeys := make([]string, len(m.unmappedSessions))
-		for sessionIdx, session := range m.unmappedSessions {
-			targetKeys[sessionIdx] = session.Key()
+	return keys
+}
+
+// sessionsMatchingIdentity returns every app session matching the given identity target, in a stable order
+func (m *sessionMap) sessionsMatchingIdentity(target string) []Session {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := []string{}
+	for key := range m.m {
+		if isAppSessionKey(key) {
+			keys = append(keys, key)
 		}
+	}
 
-		return targetKeys
+	sort.Strings(keys)
+
+	sessions := []Session{}
+
+	for _, key := range keys {
+		for _, session := range m.m[key] {
+			if identityTargetMatches(target, session) {
+				sessions = append(sessions, session)
+			}
+		}
 	}
 
-	return nil
+	return sessions
+}
+
+// sessionsMatchingDevice returns every output device session matching the given device target, in a stable order
+func (m *sessionMap) sessionsMatchingDevice(target string) []Session {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := []string{}
+	for key := range m.m {
+		if !isAppSessionKey(key) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	sessions := []Session{}
+
+	for _, key := range keys {
+		for _, session := range m.m[key] {
+			if deviceTargetMatches(target, session) {
+				sessions = append(sessions, session)
+			}
+		}
+	}
+
+	return sessions
+}
+
+// expandIdentityTargets replaces identity targets with the keys of the sessions they currently match,
+// for features that look at process names (LEDs, audio peaks, ducking) rather than sessions
+func (m *sessionMap) expandIdentityTargets(targets []string) []string {
+	expanded := []string{}
+
+	for _, target := range targets {
+		if !isIdentityTarget(target) {
+			expanded = append(expanded, target)
+			continue
+		}
+
+		for _, session := range m.sessionsMatchingIdentity(target) {
+			expanded = append(expanded, session.Key())
+		}
+	}
+
+	return funk.UniqString(expanded)
+}
+
+// isAppSessionKey reports whether the given session key belongs to an app, rather than being
+// one of the special sessions (master, system, mic) or a device
+func isAppSessionKey(key string) bool {
+	if funk.ContainsString([]string{masterSessionName, systemSessionName, inputSessionName}, key) {
+		return false
+	}
+
+	// devices without a windows-style friendly name (i.e. pulse sinks) are keyed like their targets
+	if strings.HasPrefix(key, targetDevicePrefix) {
+		return false
+	}
+
+	return !deviceSessionKeyPattern.MatchString(key)
 }
 
 func (m *sessionMap) add(value Session) {
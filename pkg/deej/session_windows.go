@@ -4,21 +4,33 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
 	ole "github.com/go-ole/go-ole"
 	ps "github.com/mitchellh/go-ps"
 	wca "github.com/moutend/go-wca"
 	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
 )
 
 var errNoSuchProcess = errors.New("No such process")
 var errRefreshSessions = errors.New("Trigger session refresh")
 
+// window titles change (e.g. a browser's current tab), but looking them up on every slider move is too much
+const sessionWindowTitlesCooldown = 2 * time.Second
+
 type wcaSession struct {
 	baseSession
 
 	pid         uint32
 	processName string
+	productName string
+
+	windowTitlesLock   sync.Mutex
+	windowTitles       []string
+	lastWindowTitlesAt time.Time
 
 	control *wca.IAudioSessionControl2
 	volume  *wca.ISimpleAudioVolume
@@ -34,6 +46,11 @@ type masterSession struct {
 	eventCtx *ole.GUID
 
 	stale bool // when set to true, we should refresh sessions on the next call to SetVolume
+
+	// the device's friendly name and whether it's an output device, for "device:" targets.
+	// unset for the default device sessions (master and mic)
+	endpointName string
+	output       bool
 }
 
 func newWCASession(
@@ -77,6 +94,14 @@ func newWCASession(
 		s.processName = process.Executable()
 		s.name = s.processName
 		s.humanReadableDesc = fmt.Sprintf("%s (pid %d)", s.processName, s.pid)
+
+		// plenty of executables don't have one, that's fine
+		productName, err := util.GetProcessProductName(pid)
+		if err != nil {
+			logger.Debugw("Failed to get process product name", "pid", pid, "error", err)
+		}
+
+		s.productName = productName
 	}
 
 	// use a self-identifying session name e.g. deej.sessions.chrome
@@ -143,6 +168,61 @@ func (s *wcaSession) SetVolume(v float32) error {
 	return nil
 }
 
+func (s *wcaSession) GetMute() bool {
+	var mute bool
+
+	if err := s.volume.GetMute(&mute); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+	}
+
+	return mute
+}
+
+func (s *wcaSession) SetMute(m bool) error {
+	if err := s.volume.SetMute(m, s.eventCtx); err != nil {
+		s.logger.Warnw("Failed to set session mute state", "error", err)
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+
+	return nil
+}
+
+// WindowTitles implements identifiedSession, looking the titles up again once they're a little old
+func (s *wcaSession) WindowTitles() []string {
+	if s.system {
+		return nil
+	}
+
+	s.windowTitlesLock.Lock()
+	defer s.windowTitlesLock.Unlock()
+
+	if time.Since(s.lastWindowTitlesAt) < sessionWindowTitlesCooldown {
+		return s.windowTitles
+	}
+
+	s.lastWindowTitlesAt = time.Now()
+
+	windowTitles, err := util.GetProcessWindowTitles(s.pid)
+	if err != nil {
+		s.logger.Debugw("Failed to get window titles", "error", err)
+	}
+
+	s.windowTitles = windowTitles
+
+	return s.windowTitles
+}
+
+// ProductName implements identifiedSession
+func (s *wcaSession) ProductName() string {
+	return s.productName
+}
+
+func (s *wcaSession) ProcessID() uint32 {
+	return s.pid
+}
+
 func (s *wcaSession) Release() {
 	s.logger.Debug("Releasing audio session")
 
@@ -183,6 +263,35 @@ func (s *masterSession) SetVolume(v float32) error {
 	return nil
 }
 
+func (s *masterSession) GetMute() bool {
+	var mute bool
+
+	if err := s.volume.GetMute(&mute); err != nil {
+		s.logger.Warnw("Failed to get session mute state", "error", err)
+	}
+
+	return mute
+}
+
+func (s *masterSession) SetMute(m bool) error {
+	if s.stale {
+		s.logger.Warnw("Session expired because default device has changed, triggering session refresh")
+		return errRefreshSessions
+	}
+
+	if err := s.volume.SetMute(m, s.eventCtx); err != nil {
+		s.logger.Warnw("Failed to set session mute state",
+			"error", err,
+			"mute", m)
+
+		return fmt.Errorf("adjust session mute state: %w", err)
+	}
+
+	s.logger.Debugw("Adjusting session mute state", "to", m)
+
+	return nil
+}
+
 func (s *masterSession) Release() {
 	s.logger.Debug("Releasing audio session")
 
@@ -193,6 +302,14 @@ func (s *masterSession) String() string {
 	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
 }
 
+func (s *masterSession) EndpointName() string {
+	return s.endpointName
+}
+
+func (s *masterSession) IsOutput() bool {
+	return s.output
+}
+
 func (s *masterSession) markAsStale() {
 	s.stale = true
 }
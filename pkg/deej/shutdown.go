@@ -0,0 +1,31 @@
+package deej
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// how long stopping waits for a component's goroutines to finish before carrying on without them. some serial
+// drivers take their time noticing that the port they're reading from was closed
+const shutdownTimeout = 3 * time.Second
+
+// waitForGoroutines waits for the given goroutines to finish, or gives up (and says so) after shutdownTimeout so
+// that one stuck goroutine can't keep deej from exiting. it returns false if it gave up
+func waitForGoroutines(logger *zap.SugaredLogger, goroutines *sync.WaitGroup) bool {
+	done := make(chan struct{})
+
+	go func() {
+		goroutines.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(shutdownTimeout):
+		logger.Warnw("Gave up waiting for goroutines to finish", "timeout", shutdownTimeout)
+		return false
+	}
+}
@@ -0,0 +1,218 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+// newSimulatedDeej creates just enough of a deej instance to exercise the serial -> session map path,
+// with the given finder standing in for the OS's audio sessions. used by the soak test and traffic replay,
+// which drive it with simulated device lines instead of a real connection
+func newSimulatedDeej(logger *zap.SugaredLogger, sessionFinder SessionFinder) (*Deej, error) {
+	notifier := &loggingNotifier{logger: logger}
+
+	config, err := NewConfig(logger, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("create new Config: %w", err)
+	}
+
+	// the config's never loaded, and harnesses that don't map sliders themselves start out with none mapped
+	config.SliderMapping = newSliderMap()
+
+	d := &Deej{
+		logger:      logger,
+		notifier:    notifier,
+		config:      config,
+		stopChannel: make(chan bool),
+	}
+
+	d.bus = newEventBus(logger)
+
+	// simulations keep their state in memory, so they don't touch the real one
+	d.state = newStateStore(logger, "")
+
+	d.alerts = newPushAlerter(d, logger)
+	d.webhooks = newWebhookSender(d, logger)
+	d.events = newEventLog(d, logger)
+	d.console = newSerialConsole(logger)
+	d.link = newLinkMonitor(d, logger)
+
+	serial, err := NewSerialIO(d, logger)
+	if err != nil {
+		return nil, fmt.Errorf("create new SerialIO: %w", err)
+	}
+
+	d.serial = serial
+
+	// there's no device to say hello to - the first line handled would only warn about it
+	serial.helloSent = true
+
+	sessions, err := newSessionMap(d, logger, sessionFinder)
+	if err != nil {
+		return nil, fmt.Errorf("create new sessionMap: %w", err)
+	}
+
+	d.sessions = sessions
+	d.fader = newVolumeFader(d, logger)
+	d.dsp = newDSPController(d, logger)
+	d.hearing = newHearingProtector(d, logger)
+	d.quietHours = newQuietHours(d, logger)
+	d.focus = newFocusFollower(d, logger)
+	d.sessionActivity = newSessionActivityTracker(d, logger)
+	d.timer = newFocusTimer(d, logger)
+	d.processMonitor = NewProcessMonitor(d, serial, logger)
+
+	return d, nil
+}
+
+// loggingNotifier logs notifications instead of showing them
+type loggingNotifier struct {
+	logger *zap.SugaredLogger
+}
+
+func (ln *loggingNotifier) Notify(title string, message string) {
+	ln.logger.Infow("Notification", "title", title, "message", message)
+}
+
+// simulatedSessionFinder hands out in-memory audio sessions. their state lives here rather than in
+// the sessions themselves, so that it survives session re-acquisition like a real session's would
+type simulatedSessionFinder struct {
+	logger *zap.SugaredLogger
+
+	lock    sync.Mutex
+	names   []string
+	volumes map[string]float32
+	muted   map[string]bool
+
+	// how many sessions were handed out and not released yet
+	live int
+
+	// called whenever a session's volume is set, if set
+	onSetVolume func(name string, volume float32)
+}
+
+func newSimulatedSessionFinder(logger *zap.SugaredLogger) *simulatedSessionFinder {
+	return &simulatedSessionFinder{
+		logger:  logger,
+		volumes: make(map[string]float32),
+		muted:   make(map[string]bool),
+	}
+}
+
+// setSession adds a session with the given name, or updates its state if it already exists
+func (sf *simulatedSessionFinder) setSession(name string, volume float32, muted bool) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	if _, ok := sf.volumes[name]; !ok {
+		sf.names = append(sf.names, name)
+	}
+
+	sf.volumes[name] = volume
+	sf.muted[name] = muted
+}
+
+// clearSessions removes every session, so that they're no longer found from the next GetAllSessions on
+func (sf *simulatedSessionFinder) clearSessions() {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	sf.names = nil
+	sf.volumes = make(map[string]float32)
+	sf.muted = make(map[string]bool)
+}
+
+func (sf *simulatedSessionFinder) GetAllSessions() ([]Session, error) {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	sessions := []Session{}
+
+	for _, name := range sf.names {
+		sessions = append(sessions, &simulatedSession{
+			baseSession: baseSession{
+				logger:            sf.logger,
+				name:              name,
+				humanReadableDesc: name,
+			},
+			finder: sf,
+		})
+
+		sf.live++
+	}
+
+	return sessions, nil
+}
+
+func (sf *simulatedSessionFinder) Release() error {
+	return nil
+}
+
+func (sf *simulatedSessionFinder) liveSessions() int {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	return sf.live
+}
+
+func (sf *simulatedSessionFinder) volume(name string) float32 {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+
+	return sf.volumes[name]
+}
+
+type simulatedSession struct {
+	baseSession
+
+	finder   *simulatedSessionFinder
+	released bool
+}
+
+func (s *simulatedSession) GetVolume() float32 {
+	return s.finder.volume(s.name)
+}
+
+func (s *simulatedSession) SetVolume(v float32) error {
+	s.finder.lock.Lock()
+	s.finder.volumes[s.name] = v
+	s.finder.lock.Unlock()
+
+	if s.finder.onSetVolume != nil {
+		s.finder.onSetVolume(s.name, v)
+	}
+
+	return nil
+}
+
+func (s *simulatedSession) GetMute() bool {
+	s.finder.lock.Lock()
+	defer s.finder.lock.Unlock()
+
+	return s.finder.muted[s.name]
+}
+
+func (s *simulatedSession) SetMute(m bool) error {
+	s.finder.lock.Lock()
+	defer s.finder.lock.Unlock()
+
+	s.finder.muted[s.name] = m
+
+	return nil
+}
+
+func (s *simulatedSession) Release() {
+	s.finder.lock.Lock()
+	defer s.finder.lock.Unlock()
+
+	if !s.released {
+		s.released = true
+		s.finder.live--
+	}
+}
+
+func (s *simulatedSession) String() string {
+	return fmt.Sprintf(sessionStringFormat, s.humanReadableDesc, s.GetVolume())
+}
@@ -0,0 +1,85 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	sliderCurveLinear      = "linear"
+	sliderCurveLog         = "log"         // rises quickly, leaving more of the slider's travel for the loud end
+	sliderCurveExponential = "exponential" // rises slowly, leaving more of the slider's travel for the quiet end
+	sliderCurveCustom      = "custom"
+)
+
+// sliderCurve maps a slider's linear position onto the volume it should set, to make up for
+// the unnatural loudness response of linear potentiometers
+type sliderCurve struct {
+	kind string
+
+	// for custom curves, the output (0-1) at evenly spaced slider positions, from bottom to top
+	points []float32
+}
+
+// sliderCurveFromConfig accepts either a curve name or a list of output percentages at evenly spaced slider positions
+func sliderCurveFromConfig(value interface{}) (sliderCurve, error) {
+	switch typedValue := value.(type) {
+	case string:
+		kind := strings.ToLower(strings.TrimSpace(typedValue))
+
+		switch kind {
+		case sliderCurveLinear, sliderCurveLog, sliderCurveExponential:
+			return sliderCurve{kind: kind}, nil
+		}
+
+		return sliderCurve{}, fmt.Errorf("unknown curve %q", typedValue)
+
+	case []interface{}:
+		if len(typedValue) < 2 {
+			return sliderCurve{}, fmt.Errorf("custom curves need at least 2 points, got %d", len(typedValue))
+		}
+
+		points := make([]float32, len(typedValue))
+		for idx, rawPoint := range typedValue {
+			percent, err := strconv.ParseFloat(fmt.Sprint(rawPoint), 32)
+			if err != nil {
+				return sliderCurve{}, fmt.Errorf("invalid custom curve point %v: %w", rawPoint, err)
+			}
+
+			points[idx] = float32(math.Max(0, math.Min(100, percent)) / 100)
+		}
+
+		return sliderCurve{kind: sliderCurveCustom, points: points}, nil
+	}
+
+	return sliderCurve{}, fmt.Errorf("expected a curve name or a list of points, got %v", value)
+}
+
+// apply maps a linear slider value (0-1) through the curve
+func (sc sliderCurve) apply(value float32) float32 {
+	x := float64(value)
+
+	switch sc.kind {
+	case sliderCurveLog:
+		return float32(math.Log10(1 + 9*x))
+
+	case sliderCurveExponential:
+		return float32((math.Pow(10, x) - 1) / 9)
+
+	case sliderCurveCustom:
+		segments := len(sc.points) - 1
+		position := x * float64(segments)
+
+		segment := int(position)
+		if segment >= segments {
+			return sc.points[segments]
+		}
+
+		fraction := float32(position - float64(segment))
+		return sc.points[segment] + (sc.points[segment+1]-sc.points[segment])*fraction
+	}
+
+	return value
+}
@@ -0,0 +1,126 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sliderFilterEMA    = "ema"    // exponential moving average, smooth but slightly laggy
+	sliderFilterMedian = "median" // median of the last few values, good at rejecting single-sample spikes
+
+	defaultSliderFilterAlpha  = 0.3
+	defaultSliderFilterWindow = 5
+
+	// a change bigger than this (in percent) is treated as a deliberate move, and passes straight through
+	defaultSliderFilterBypassPercent = 10
+
+	maxSliderFilterWindow = 31
+
+	// an ema closer than this to a steady value snaps onto it, rather than settling a rounding error short of it
+	// (which could then be normalized down to the percent below)
+	sliderFilterSettleThreshold = 0.0001
+)
+
+// sliderSmoothing holds a single slider's smoothing filter settings
+type sliderSmoothing struct {
+	Filter string
+	Alpha  float32
+	Window int
+	Bypass float32
+}
+
+// sliderSmoothingFromConfig reads a slider's smoothing object ("filter", plus "alpha" for ema or "window" for median,
+// and optionally "bypass" in percent)
+func sliderSmoothingFromConfig(fields map[string]interface{}) (sliderSmoothing, error) {
+	smoothing := sliderSmoothing{
+		Filter: strings.ToLower(fmt.Sprint(fields["filter"])),
+		Alpha:  defaultSliderFilterAlpha,
+		Window: defaultSliderFilterWindow,
+		Bypass: defaultSliderFilterBypassPercent / 100.0,
+	}
+
+	if smoothing.Filter != sliderFilterEMA && smoothing.Filter != sliderFilterMedian {
+		return smoothing, fmt.Errorf("unknown filter %q", smoothing.Filter)
+	}
+
+	if value, ok := fields["alpha"]; ok {
+		alpha, err := strconv.ParseFloat(fmt.Sprint(value), 32)
+		if err != nil || alpha <= 0 || alpha > 1 {
+			return smoothing, fmt.Errorf("alpha must be above 0 and at most 1, got %v", value)
+		}
+
+		smoothing.Alpha = float32(alpha)
+	}
+
+	if value, ok := fields["window"]; ok {
+		window, err := strconv.Atoi(fmt.Sprint(value))
+		if err != nil || window < 1 || window > maxSliderFilterWindow {
+			return smoothing, fmt.Errorf("window must be between 1 and %d, got %v", maxSliderFilterWindow, value)
+		}
+
+		smoothing.Window = window
+	}
+
+	if value, ok := fields["bypass"]; ok {
+		bypass, err := strconv.ParseFloat(fmt.Sprint(value), 32)
+		if err != nil || bypass <= 0 || bypass > 100 {
+			return smoothing, fmt.Errorf("bypass must be above 0 and at most 100, got %v", value)
+		}
+
+		smoothing.Bypass = float32(bypass / 100)
+	}
+
+	return smoothing, nil
+}
+
+// sliderFilter holds the running state of a single slider's smoothing filter
+type sliderFilter struct {
+	smoothing sliderSmoothing
+
+	initialized bool
+	value       float32
+	history     []float32
+}
+
+func newSliderFilter(smoothing sliderSmoothing) *sliderFilter {
+	return &sliderFilter{smoothing: smoothing}
+}
+
+// apply feeds a new value (0-1) through the filter and returns the smoothed value.
+// a jump bigger than the bypass threshold resets the filter, so deliberate moves aren't slowed down
+func (sf *sliderFilter) apply(value float32) float32 {
+	if !sf.initialized || math.Abs(float64(value-sf.value)) > float64(sf.smoothing.Bypass) {
+		sf.initialized = true
+		sf.value = value
+		sf.history = []float32{value}
+
+		return value
+	}
+
+	switch sf.smoothing.Filter {
+	case sliderFilterEMA:
+		sf.value = sf.smoothing.Alpha*value + (1-sf.smoothing.Alpha)*sf.value
+
+		if math.Abs(float64(value-sf.value)) < sliderFilterSettleThreshold {
+			sf.value = value
+		}
+
+	case sliderFilterMedian:
+		sf.history = append(sf.history, value)
+		if len(sf.history) > sf.smoothing.Window {
+			sf.history = sf.history[len(sf.history)-sf.smoothing.Window:]
+		}
+
+		sorted := make([]float32, len(sf.history))
+		copy(sorted, sf.history)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+		sf.value = sorted[len(sorted)/2]
+	}
+
+	return sf.value
+}
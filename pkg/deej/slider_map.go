@@ -2,6 +2,7 @@ package deej
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"sync"
 
@@ -90,3 +91,32 @@ func (m *sliderMap) String() string {
 
 	return fmt.Sprintf("<%d sliders mapped to %d targets>", sliderCount, targetCount)
 }
+
+// sliderSet is a set of slider indices, which can also stand for every slider
+type sliderSet struct {
+	all     bool
+	indices map[int]bool
+}
+
+func newSliderSet() sliderSet {
+	return sliderSet{indices: make(map[int]bool)}
+}
+
+func (ss sliderSet) contains(sliderIdx int) bool {
+	return ss.all || ss.indices[sliderIdx]
+}
+
+func (ss sliderSet) String() string {
+	if ss.all {
+		return "<all sliders>"
+	}
+
+	indices := make([]int, 0, len(ss.indices))
+	for sliderIdx := range ss.indices {
+		indices = append(indices, sliderIdx)
+	}
+
+	sort.Ints(indices)
+
+	return fmt.Sprint(indices)
+}
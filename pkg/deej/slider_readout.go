@@ -0,0 +1,88 @@
+package deej
+
+import "fmt"
+
+// sliderReadout is what a slider shows wherever deej displays it: where its fader is, and where that actually put
+// its apps. the two differ once a curve, volume limit, ducking or a fade gets involved, and showing only one of
+// them leaves users wondering why the number on screen isn't what the fader says
+type sliderReadout struct {
+	position int // 0-100, the fader itself, before the slider's curve
+	value    int // 0-100, the volume the slider asks for, after its curve
+
+	// 0-100, where the slider's first running target really is (as in slider_state.go), or -1 if none are running
+	effective int
+}
+
+// sliderReadouts returns the readout of every slider wanted says to that has moved since deej started
+func (m *sessionMap) sliderReadouts(wanted func(sliderID int) bool) map[int]sliderReadout {
+
+	// looked up before taking the lock, as finding sessions can take a while
+	states := m.filteredSliderStates(wanted)
+
+	m.sliderValuesLock.Lock()
+	defer m.sliderValuesLock.Unlock()
+
+	readouts := map[int]sliderReadout{}
+
+	for sliderID, value := range m.sliderValues {
+		if !wanted(sliderID) {
+			continue
+		}
+
+		readout := sliderReadout{value: eventPercent(value), effective: -1}
+
+		// values restored from the last run don't say where the fader was, so it's taken to be where it points
+		readout.position = readout.value
+		if position, ok := m.sliderPositions[sliderID]; ok {
+			readout.position = eventPercent(position)
+		}
+
+		if state, ok := states[sliderID]; ok {
+			readout.effective = state.Volume
+		}
+
+		readouts[sliderID] = readout
+	}
+
+	return readouts
+}
+
+// sliderReadout returns the given slider's readout, or false if it hasn't moved since deej started
+func (m *sessionMap) sliderReadout(sliderID int) (sliderReadout, bool) {
+	readout, ok := m.sliderReadouts(func(id int) bool { return id == sliderID })[sliderID]
+	return readout, ok
+}
+
+func (m *sessionMap) rememberSliderPosition(sliderID int, position float32) {
+	m.sliderValuesLock.Lock()
+	defer m.sliderValuesLock.Unlock()
+
+	m.sliderPositions[sliderID] = position
+}
+
+// applied is the volume the slider ended up at: its targets' if any are running, otherwise what it asks for
+func (r sliderReadout) applied() int {
+	if r.effective >= 0 {
+		return r.effective
+	}
+
+	return r.value
+}
+
+// String shows the fader's position, followed by the applied volume if that's somewhere else (e.g. "90% → 64%")
+func (r sliderReadout) String() string {
+	if r.applied() == r.position {
+		return fmt.Sprintf("%d%%", r.position)
+	}
+
+	return fmt.Sprintf("%d%% → %d%%", r.position, r.applied())
+}
+
+// compact is String for narrow device displays that might not have an arrow to draw (e.g. "90>64%")
+func (r sliderReadout) compact() string {
+	if r.applied() == r.position {
+		return fmt.Sprintf("%d%%", r.position)
+	}
+
+	return fmt.Sprintf("%d>%d%%", r.position, r.applied())
+}
@@ -0,0 +1,249 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// which of a slider's sessions its moves go to, for sliders mapped to many apps that are meant for "whatever's
+// playing" rather than all of them at once
+const (
+	sliderSessionsAll     = "all"     // every session of every target (the default)
+	sliderSessionsLoudest = "loudest" // only the app making the most noise right now, else the one that last made any
+	sliderSessionsRecent  = "recent"  // only the app that most recently made any noise
+
+	// how often to check which apps are making noise, while a slider needs to know
+	sessionActivityCheckInterval = 250 * time.Millisecond
+
+	// peak level (0-1) above which an app counts as making noise
+	sessionActivityThreshold = 0.01
+)
+
+// sessionActivityTracker keeps track of which apps are making noise and when each last did, for sliders that
+// only move the loudest or most recent one of their sessions
+type sessionActivityTracker struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	meter *AudioMeterService
+
+	lock    sync.Mutex
+	running bool
+
+	// the latest peak level by session key, and when each app was last heard
+	levels    map[string]float32
+	lastHeard map[string]time.Time
+
+	stopChannel chan bool
+}
+
+func newSessionActivityTracker(deej *Deej, logger *zap.SugaredLogger) *sessionActivityTracker {
+	logger = logger.Named("session-activity")
+
+	sat := &sessionActivityTracker{
+		deej:        deej,
+		logger:      logger,
+		lastHeard:   make(map[string]time.Time),
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created session activity tracker instance")
+
+	return sat
+}
+
+func (cc *CanonicalConfig) populateSliderSessions() {
+	cc.SliderSessions = make(map[int]string)
+
+	for sliderIdxString, value := range cc.userConfig.GetStringMap(configKeySliderSessions) {
+		sliderIdx, err := strconv.Atoi(sliderIdxString)
+		if err != nil {
+			continue
+		}
+
+		mode := strings.ToLower(strings.TrimSpace(fmt.Sprint(value)))
+
+		switch mode {
+		case sliderSessionsAll:
+		case sliderSessionsLoudest, sliderSessionsRecent:
+			cc.SliderSessions[sliderIdx] = mode
+		default:
+			cc.logger.Warnw("Invalid slider sessions mode, using default",
+				"key", configKeySliderSessions+"."+sliderIdxString,
+				"invalidValue", value,
+				"defaultValue", sliderSessionsAll)
+		}
+	}
+}
+
+// Start begins listening for apps making noise, whenever a slider needs to know
+func (sat *sessionActivityTracker) Start() {
+	sat.lock.Lock()
+	defer sat.lock.Unlock()
+
+	if sat.running {
+		return
+	}
+
+	// without a meter there's no telling which app is loudest (see audio_meter_other.go)
+	if !audioMeterSupported {
+		if len(sat.deej.config.SliderSessions) > 0 {
+			sat.logger.Warnw("Moving only the loudest or most recent app isn't supported on this platform, sliders move all of theirs",
+				"error", util.ErrNotSupported)
+		}
+
+		return
+	}
+
+	sat.running = true
+
+	go sat.trackingLoop()
+}
+
+// Stop stops listening
+func (sat *sessionActivityTracker) Stop() {
+	sat.lock.Lock()
+
+	if !sat.running {
+		sat.lock.Unlock()
+		return
+	}
+
+	sat.running = false
+	sat.lock.Unlock()
+
+	sat.stopChannel <- true
+}
+
+func (sat *sessionActivityTracker) trackingLoop() {
+	ticker := time.NewTicker(sessionActivityCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sat.stopChannel:
+			return
+		case <-ticker.C:
+			sat.check()
+		}
+	}
+}
+
+func (sat *sessionActivityTracker) check() {
+
+	// polling the meter isn't free, so it's only done while a slider needs it
+	if len(sat.deej.config.SliderSessions) == 0 {
+		sat.lock.Lock()
+		sat.levels = nil
+		sat.lock.Unlock()
+
+		return
+	}
+
+	if sat.meter == nil {
+		sat.meter = NewAudioMeterService(sat.logger)
+	}
+
+	peakLevels, err := sat.meter.GetAudioPeakLevels()
+	if err != nil {
+		if sat.deej.Verbose() {
+			sat.logger.Debugw("Failed to get audio peak levels", "error", err)
+		}
+
+		return
+	}
+
+	now := time.Now()
+
+	sat.lock.Lock()
+	defer sat.lock.Unlock()
+
+	sat.levels = peakLevels
+
+	for name, level := range peakLevels {
+		if level > sessionActivityThreshold {
+			sat.lastHeard[name] = now
+		}
+	}
+}
+
+// pick returns which of the given session keys a slider in the given mode moves, or false if nothing's been
+// heard from any of them yet (and so the slider moves them all)
+func (sat *sessionActivityTracker) pick(mode string, keys []string) (string, bool) {
+	sat.lock.Lock()
+	defer sat.lock.Unlock()
+
+	if mode == sliderSessionsLoudest {
+		loudest := ""
+		var loudestLevel float32
+
+		for _, key := range keys {
+			level := sat.levels[key]
+
+			// ties go to the alphabetically first app, so the choice doesn't flicker between equally loud ones
+			if level > sessionActivityThreshold && (level > loudestLevel || (level == loudestLevel && key < loudest)) {
+				loudest, loudestLevel = key, level
+			}
+		}
+
+		if loudest != "" {
+			return loudest, true
+		}
+
+		// everything's quiet (say, a video is paused), so stick with whatever was playing last
+	}
+
+	recent := ""
+	var recentHeard time.Time
+
+	for _, key := range keys {
+		heard, ok := sat.lastHeard[key]
+		if ok && heard.After(recentHeard) {
+			recent, recentHeard = key, heard
+		}
+	}
+
+	return recent, recent != ""
+}
+
+// sliderSessionFilter returns the one session key the given slider's moves are limited to, or false if they
+// go to all of its sessions
+func (m *sessionMap) sliderSessionFilter(sliderID int, targets []string) (string, bool) {
+	mode, ok := m.deej.config.SliderSessions[sliderID]
+	if !ok || !audioMeterSupported {
+		return "", false
+	}
+
+	keys := []string{}
+
+	for _, target := range targets {
+		if m.deej.dsp.handlesTarget(target) {
+			continue
+		}
+
+		var sessions []Session
+		if isUnmappedTarget(target) {
+			sessions = m.unmappedGroupSessions(m.deej.config.unmappedGroup(sliderID))
+		} else {
+			sessions = m.targetSessions(target)
+		}
+
+		for _, session := range sessions {
+			keys = append(keys, session.Key())
+		}
+	}
+
+	key, ok := m.deej.sessionActivity.pick(mode, keys)
+	if ok && m.deej.Verbose() {
+		m.logger.Debugw("Slider moving only one of its apps", "sliderID", sliderID, "mode", mode, "session", key)
+	}
+
+	return key, ok
+}
@@ -0,0 +1,159 @@
+package deej
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const apiPathSliders = "/sliders"
+
+// sliderStates reads where every mapped slider's targets are: the first target found's volume, and whether all
+// of its sessions are muted. sliders whose targets aren't running are left out
+func (m *sessionMap) sliderStates() map[int]protocol.SliderState {
+	return m.filteredSliderStates(func(int) bool { return true })
+}
+
+// filteredSliderStates is sliderStates for only the sliders wanted says to, skipping the others' session lookups
+func (m *sessionMap) filteredSliderStates(wanted func(sliderID int) bool) map[int]protocol.SliderState {
+
+	// copied out first, as finding sessions can take a while and the mapping's lock shouldn't be held meanwhile
+	mapping := map[int][]string{}
+	m.deej.config.SliderMapping.iterate(func(sliderID int, targets []string) {
+		if wanted(sliderID) {
+			mapping[sliderID] = targets
+		}
+	})
+
+	states := map[int]protocol.SliderState{}
+
+	for sliderID, targets := range mapping {
+		for _, target := range targets {
+			if m.deej.dsp.handlesTarget(target) {
+				continue
+			}
+
+			var sessions []Session
+			if isUnmappedTarget(target) {
+				sessions = m.unmappedGroupSessions(m.deej.config.unmappedGroup(sliderID))
+			} else {
+				sessions = m.targetSessions(target)
+			}
+
+			if len(sessions) == 0 {
+				continue
+			}
+
+			muted := true
+			for _, session := range sessions {
+				muted = muted && session.GetMute()
+			}
+
+			states[sliderID] = protocol.SliderState{
+				Volume: int(math.Round(float64(sessions[0].GetVolume()) * 100)),
+				Muted:  muted,
+			}
+
+			break
+		}
+	}
+
+	return states
+}
+
+// syncSliderStates tells a newly connected device where every slider's targets are (see protocol.SliderStates),
+// once per connection. paired devices only get it once their session is up
+func (sio *SerialIO) syncSliderStates(logger *zap.SugaredLogger) {
+	if sio.slidersSynced {
+		return
+	}
+
+	if _, paired := sio.pairedKey(); paired && !sio.secured() {
+		return
+	}
+
+	sio.slidersSynced = true
+
+	states := sio.deej.sessions.sliderStates()
+
+	// devices that haven't sent slider values yet get as many as they said they have, or as are mapped
+	numSliders := sio.lastKnownNumSliders
+
+	sio.helloLock.Lock()
+	if numSliders == 0 && sio.hello != nil {
+		numSliders = sio.hello.Sliders
+	}
+	sio.helloLock.Unlock()
+
+	if numSliders == 0 {
+		sio.deej.config.SliderMapping.iterate(func(sliderID int, _ []string) {
+			if sliderID >= numSliders {
+				numSliders = sliderID + 1
+			}
+		})
+	}
+
+	if numSliders == 0 {
+		return
+	}
+
+	if err := sio.writeCommand(protocol.SliderStates(states, numSliders)); err != nil {
+		logger.Warnw("Failed to send slider states", "error", err)
+		return
+	}
+
+	logger.Debugw("Sent slider states", "sliders", numSliders, "found", len(states))
+}
+
+// handleSliders returns where every mapped slider's targets are as JSON, by slider ID (GET, filtered as in
+// api_filter.go), or moves a slider (POST, see setSlider). sliders that moved since deej started also say where
+// their fader is and the volume it asks for after its curve, which volume limits, ducking and fades can keep
+// their targets from
+func (as *apiServer) handleSliders(writer http.ResponseWriter, request *http.Request) {
+	if request.Method == http.MethodPost {
+		as.setSlider(writer, request)
+		return
+	}
+
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filter, err := parseAPIFilter(request.URL.Query())
+	if err != nil {
+		http.Error(writer, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type sliderState struct {
+		Volume   int  `json:"volume"`
+		Muted    bool `json:"muted"`
+		Position *int `json:"position,omitempty"`
+		Value    *int `json:"value,omitempty"`
+	}
+
+	readouts := as.deej.sessions.sliderReadouts(filter.wantsSlider)
+
+	response := map[string]interface{}{}
+	for sliderID, state := range as.deej.sessions.filteredSliderStates(filter.wantsSlider) {
+		entry := sliderState{Volume: state.Volume, Muted: state.Muted}
+
+		if readout, ok := readouts[sliderID]; ok {
+			entry.Position, entry.Value = &readout.position, &readout.value
+		}
+
+		response[strconv.Itoa(sliderID)] = filter.pick(entry)
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write sliders response", "error", err)
+	}
+}
@@ -0,0 +1,469 @@
+package deej
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	soakNumSliders = 5
+
+	// roughly how often real firmware sends a line
+	soakLineInterval = 10 * time.Millisecond
+
+	soakReloadInterval    = 30 * time.Second
+	soakReconnectInterval = 45 * time.Second
+	soakProgressInterval  = time.Minute
+
+	// how long the simulated device stays gone during a reconnect cycle
+	soakReconnectGap = 500 * time.Millisecond
+
+	// how long to wait for everything to quiet down before taking the final measurements
+	soakSettleTime = 2 * time.Second
+
+	// a few goroutines may come and go on their own (timers, the runtime), anything beyond this counts as a leak
+	soakGoroutineLeakSlack = 3
+
+	// a slider needs to move at least this much per line to count as a move with the default noise reduction
+	soakMinRawStep = 40
+	soakMaxRawStep = 200
+
+	// chance of a line being garbage instead of slider values, like a dirty first line after connecting
+	soakGarbageLineChance = 0.01
+)
+
+// RunSoakTest drives deej's slider handling with simulated hardware and audio sessions for the given duration:
+// rapid slider movement, periodic reconnect cycles and config reloads. it then reports goroutine and session leaks,
+// missed slider events and move-to-volume latency percentiles, returning an error if anything was missed or leaked
+func RunSoakTest(logger *zap.SugaredLogger, duration time.Duration) error {
+	logger = logger.Named("soak")
+
+	tracker := newSoakTracker()
+
+	// sessions start out at full volume, while the simulated sliders start at the bottom,
+	// so that the very first line changes every session's volume
+	finder := newSimulatedSessionFinder(logger)
+	sliderIndices := map[string]int{}
+
+	for sliderIdx := 0; sliderIdx < soakNumSliders; sliderIdx++ {
+		finder.setSession(soakSessionName(sliderIdx), 1.0, false)
+		sliderIndices[soakSessionName(sliderIdx)] = sliderIdx
+	}
+
+	finder.onSetVolume = func(name string, volume float32) {
+		tracker.volumeSet(sliderIndices[name], volume)
+	}
+
+	d, err := newSimulatedDeej(logger, finder)
+	if err != nil {
+		return fmt.Errorf("create simulated deej: %w", err)
+	}
+
+	// map every simulated slider to its own simulated app, leaving everything else at the defaults
+	sliderMapping := map[string][]string{}
+	for sliderIdx := 0; sliderIdx < soakNumSliders; sliderIdx++ {
+		sliderMapping[strconv.Itoa(sliderIdx)] = []string{soakSessionName(sliderIdx)}
+	}
+
+	d.config.userConfig.Set(configKeySliderMapping, sliderMapping)
+
+	if err := d.config.populateFromVipers(); err != nil {
+		return fmt.Errorf("populate config fields: %w", err)
+	}
+
+	// pretend we're connected with the configured parameters, so that config reloads don't try to reconnect
+	d.serial.comPort = d.config.ConnectionInfo.COMPort
+	d.serial.baudRate = uint(d.config.ConnectionInfo.BaudRate)
+
+	if err := d.sessions.initialize(); err != nil {
+		return fmt.Errorf("init session map: %w", err)
+	}
+
+	moveEventsChannel := d.serial.SubscribeToSliderMoveEvents().Events
+	go func() {
+		for event := range moveEventsChannel {
+			tracker.expect(event)
+		}
+	}()
+
+	// drain the raw values too, like calibration would
+	rawValuesChannel := d.serial.SubscribeToRawSliderValues().Values
+	go func() {
+		for range rawValuesChannel {
+		}
+	}()
+
+	runner := &soakRunner{
+		deej:      d,
+		logger:    logger,
+		tracker:   tracker,
+		rawValues: make([]int, soakNumSliders),
+	}
+
+	// let a first line through so that everything is set up before taking the baseline
+	runner.feedValues()
+	<-time.After(soakSettleTime)
+
+	baselineGoroutines, baselineHeap := soakMeasure()
+
+	fmt.Printf("Soak testing for %s with %d simulated sliders...\n", duration, soakNumSliders)
+
+	runner.run(duration)
+
+	fmt.Println("Letting things settle...")
+	<-time.After(soakSettleTime)
+
+	goroutines, heap := soakMeasure()
+
+	report := tracker.report()
+	report.lines = runner.lines
+	report.reloads = runner.reloads
+	report.reconnects = runner.reconnects
+	report.goroutineGrowth = goroutines - baselineGoroutines
+	report.heapGrowth = int64(heap) - int64(baselineHeap)
+	report.liveSessions = finder.liveSessions()
+	report.outOfSync = tracker.outOfSync(finder)
+
+	report.print()
+
+	return report.err()
+}
+
+func soakSessionName(sliderIdx int) string {
+	return fmt.Sprintf("soak-%d.exe", sliderIdx)
+}
+
+func soakMeasure() (int, uint64) {
+	runtime.GC()
+
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+
+	return runtime.NumGoroutine(), memStats.HeapAlloc
+}
+
+// soakRunner plays the part of the device and the user
+type soakRunner struct {
+	deej    *Deej
+	logger  *zap.SugaredLogger
+	tracker *soakTracker
+
+	rawValues []int
+
+	lines      int
+	reloads    int
+	reconnects int
+}
+
+func (sr *soakRunner) run(duration time.Duration) {
+	lineTicker := time.NewTicker(soakLineInterval)
+	defer lineTicker.Stop()
+
+	reloadTicker := time.NewTicker(soakReloadInterval)
+	defer reloadTicker.Stop()
+
+	reconnectTicker := time.NewTicker(soakReconnectInterval)
+	defer reconnectTicker.Stop()
+
+	progressTicker := time.NewTicker(soakProgressInterval)
+	defer progressTicker.Stop()
+
+	start := time.Now()
+	deadline := time.After(duration)
+
+	for {
+		select {
+		case <-deadline:
+			return
+
+		case <-lineTicker.C:
+			if rand.Float64() < soakGarbageLineChance {
+				sr.feedGarbage()
+			} else {
+				sr.moveRandomSlider()
+				sr.feedValues()
+			}
+
+		case <-reloadTicker.C:
+			sr.reloadConfig()
+
+		case <-reconnectTicker.C:
+			sr.reconnect()
+
+		case now := <-progressTicker.C:
+			fmt.Printf("%s elapsed: %d lines, %d reloads, %d reconnects\n",
+				now.Sub(start).Round(time.Second), sr.lines, sr.reloads, sr.reconnects)
+		}
+	}
+}
+
+func (sr *soakRunner) moveRandomSlider() {
+	sliderIdx := rand.Intn(soakNumSliders)
+	step := soakMinRawStep + rand.Intn(soakMaxRawStep-soakMinRawStep)
+
+	// bounce off either end of the slider's travel
+	value := sr.rawValues[sliderIdx] + step
+	if rand.Intn(2) == 0 {
+		value = sr.rawValues[sliderIdx] - step
+	}
+
+	if value < 0 || value > maxRawSliderValue {
+		value = sr.rawValues[sliderIdx] - (value - sr.rawValues[sliderIdx])
+	}
+
+	sr.rawValues[sliderIdx] = value
+}
+
+func (sr *soakRunner) feedValues() {
+	values := make([]string, len(sr.rawValues))
+	for idx, value := range sr.rawValues {
+		values[idx] = strconv.Itoa(value)
+	}
+
+	sr.feed(strings.Join(values, "|") + "\r\n")
+}
+
+func (sr *soakRunner) feedGarbage() {
+	garbage := []string{
+		"4558|925|41|643|220\r\n",
+		"1023|10\r",
+		"?\x00|12\r\n",
+		"\r\n",
+	}
+
+	sr.feed(garbage[rand.Intn(len(garbage))])
+}
+
+func (sr *soakRunner) feed(line string) {
+	sr.lines++
+	sr.tracker.lineFed()
+	sr.deej.serial.handleLine(sr.logger, line)
+}
+
+// reloadConfig does what the config file watcher does when the file changes
+func (sr *soakRunner) reloadConfig() {
+	sr.reloads++
+
+	if err := sr.deej.config.populateFromVipers(); err != nil {
+		sr.logger.Warnw("Failed to repopulate config", "error", err)
+	}
+
+	sr.deej.config.onConfigReloaded()
+}
+
+// reconnect simulates the device going away for a moment and coming back, which starts it over from
+// an unknown slider count (and has it declare its capabilities again)
+func (sr *soakRunner) reconnect() {
+	sr.reconnects++
+
+	sr.deej.serial.forgetDisplayCapabilities()
+	<-time.After(soakReconnectGap)
+
+	sr.deej.serial.lastKnownNumSliders = 0
+	sr.feed(displayCapabilitiesPrefix + "charset=ascii,label=4,title=10,text=21\r\n")
+}
+
+// soakTracker matches slider move events to the volume changes they cause
+type soakTracker struct {
+	lock sync.Mutex
+
+	// when the line currently being handled was fed, i.e. when any move event it causes started out
+	lastLineFedAt time.Time
+
+	pending      map[int][]soakExpectation
+	lastExpected map[int]float32
+
+	// volume changes that got here before we saw the event causing them. the session map and the tracker
+	// both consume move events, and nothing decides which of them gets to run first
+	early map[int][]soakVolumeChange
+
+	latencies []time.Duration
+	missed    int
+}
+
+type soakExpectation struct {
+	value float32
+	fedAt time.Time
+}
+
+type soakVolumeChange struct {
+	value float32
+	setAt time.Time
+}
+
+func newSoakTracker() *soakTracker {
+	return &soakTracker{
+		pending:      make(map[int][]soakExpectation),
+		lastExpected: make(map[int]float32),
+		early:        make(map[int][]soakVolumeChange),
+	}
+}
+
+func (st *soakTracker) lineFed() {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	st.lastLineFedAt = time.Now()
+}
+
+// expect records a move event's value as one that should reach its slider's session
+func (st *soakTracker) expect(event SliderMoveEvent) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	// events re-sent with an unchanged value (e.g. after a reload) don't cause volume changes
+	if last, ok := st.lastExpected[event.SliderID]; ok && last == event.PercentValue {
+		return
+	}
+
+	st.lastExpected[event.SliderID] = event.PercentValue
+
+	early := st.early[event.SliderID]
+	for idx, change := range early {
+		if change.value == event.PercentValue {
+			st.latencies = append(st.latencies, change.setAt.Sub(st.lastLineFedAt))
+			st.early[event.SliderID] = append(early[:idx], early[idx+1:]...)
+
+			return
+		}
+	}
+
+	st.pending[event.SliderID] = append(st.pending[event.SliderID], soakExpectation{
+		value: event.PercentValue,
+		fedAt: st.lastLineFedAt,
+	})
+}
+
+// volumeSet matches a session's volume change to the oldest event expecting it.
+// any events still waiting ahead of it were skipped over, and count as missed
+func (st *soakTracker) volumeSet(sliderIdx int, value float32) {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	pending := st.pending[sliderIdx]
+
+	for idx, expectation := range pending {
+		if expectation.value == value {
+			st.latencies = append(st.latencies, time.Since(expectation.fedAt))
+			st.missed += idx
+			st.pending[sliderIdx] = pending[idx+1:]
+
+			return
+		}
+	}
+
+	st.early[sliderIdx] = append(st.early[sliderIdx], soakVolumeChange{value: value, setAt: time.Now()})
+}
+
+// outOfSync counts sessions whose volume doesn't match their slider's last position
+func (st *soakTracker) outOfSync(finder *simulatedSessionFinder) int {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	count := 0
+
+	for sliderIdx, expected := range st.lastExpected {
+		if finder.volume(soakSessionName(sliderIdx)) != expected {
+			count++
+		}
+	}
+
+	return count
+}
+
+func (st *soakTracker) report() *soakReport {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+
+	report := &soakReport{
+		delivered: len(st.latencies),
+		missed:    st.missed,
+	}
+
+	for _, pending := range st.pending {
+		report.missed += len(pending)
+	}
+
+	// anything never claimed by an event wasn't caused by the sliders at all
+	for _, early := range st.early {
+		report.unexpected += len(early)
+	}
+
+	latencies := make([]time.Duration, len(st.latencies))
+	copy(latencies, st.latencies)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	report.latencies = latencies
+
+	return report
+}
+
+type soakReport struct {
+	lines      int
+	reloads    int
+	reconnects int
+
+	delivered  int
+	missed     int
+	unexpected int
+	outOfSync  int
+	latencies  []time.Duration
+
+	goroutineGrowth int
+	heapGrowth      int64
+	liveSessions    int
+}
+
+func (sr *soakReport) print() {
+	fmt.Println("Soak test results:")
+	fmt.Printf("  lines fed:          %d (%d config reloads, %d reconnects)\n", sr.lines, sr.reloads, sr.reconnects)
+	fmt.Printf("  volume changes:     %d delivered, %d missed, %d unexpected\n", sr.delivered, sr.missed, sr.unexpected)
+	fmt.Printf("  out of sync at end: %d sessions\n", sr.outOfSync)
+
+	if len(sr.latencies) > 0 {
+		fmt.Printf("  latency:            p50 %s, p90 %s, p99 %s, max %s\n",
+			sr.percentile(0.5), sr.percentile(0.9), sr.percentile(0.99), sr.latencies[len(sr.latencies)-1])
+	}
+
+	fmt.Printf("  goroutine growth:   %d\n", sr.goroutineGrowth)
+	fmt.Printf("  heap growth:        %d KB\n", sr.heapGrowth/1024)
+	fmt.Printf("  live sessions:      %d (expected %d)\n", sr.liveSessions, soakNumSliders)
+}
+
+func (sr *soakReport) percentile(p float64) time.Duration {
+	return sr.latencies[int(p*float64(len(sr.latencies)-1))]
+}
+
+func (sr *soakReport) err() error {
+	problems := []string{}
+
+	if sr.missed > 0 {
+		problems = append(problems, fmt.Sprintf("%d missed events", sr.missed))
+	}
+
+	if sr.outOfSync > 0 {
+		problems = append(problems, fmt.Sprintf("%d sessions out of sync", sr.outOfSync))
+	}
+
+	if sr.goroutineGrowth > soakGoroutineLeakSlack {
+		problems = append(problems, fmt.Sprintf("%d leaked goroutines", sr.goroutineGrowth))
+	}
+
+	if sr.liveSessions != soakNumSliders {
+		problems = append(problems, fmt.Sprintf("%d unreleased sessions", sr.liveSessions-soakNumSliders))
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("soak test failed: %s", strings.Join(problems, ", "))
+	}
+
+	return nil
+}
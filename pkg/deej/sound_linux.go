@@ -0,0 +1,25 @@
+package deej
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// see sound_other.go
+const soundFilesSupported = true
+
+// playSoundFile starts playing a sound file through pulseaudio in the background, returning a function that stops it
+func playSoundFile(path string) (func(), error) {
+	command := exec.Command("paplay", path)
+
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("play sound %s: %w", path, err)
+	}
+
+	// reap the process once it's done, however it ends
+	go command.Wait()
+
+	return func() {
+		command.Process.Kill()
+	}, nil
+}
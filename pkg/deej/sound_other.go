@@ -0,0 +1,15 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// sound files can't be played here yet, so alarms go off silently
+const soundFilesSupported = false
+
+func playSoundFile(path string) (func(), error) {
+	return nil, util.ErrNotSupported
+}
@@ -0,0 +1,38 @@
+package deej
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// see sound_other.go
+const soundFilesSupported = true
+
+var (
+	winmm         = syscall.NewLazyDLL("winmm.dll")
+	procPlaySound = winmm.NewProc("PlaySoundW")
+)
+
+const (
+	sndAsync     = 0x0001
+	sndNoDefault = 0x0002
+	sndFilename  = 0x00020000
+)
+
+// playSoundFile starts playing a .wav file in the background, returning a function that stops it
+func playSoundFile(path string) (func(), error) {
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, fmt.Errorf("convert sound path: %w", err)
+	}
+
+	ok, _, callErr := procPlaySound.Call(uintptr(unsafe.Pointer(pathPtr)), 0, sndFilename|sndAsync|sndNoDefault)
+	if ok == 0 {
+		return nil, fmt.Errorf("play sound %s: %w", path, callErr)
+	}
+
+	return func() {
+		procPlaySound.Call(0, 0, 0)
+	}, nil
+}
@@ -0,0 +1,211 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+const (
+	stateFilename = "state.json"
+
+	// changes made in quick succession (like a slider being dragged) are saved together, this long after the first
+	stateSaveDelay = 2 * time.Second
+)
+
+// persistedState is what deej remembers between runs that isn't config: nothing in here is meant to be edited
+// by hand. things that do act like config (calibrations, mappings set from the tray) stay in preferences.yaml,
+// which is merged into it
+type persistedState struct {
+
+	// how many startups in a row didn't make it to stable (see safe_mode.go)
+	UnstableStartups int `json:"unstable_startups"`
+
+	// where each slider was last, so volumes can be applied before the device reports in
+	SliderValues map[int]float32 `json:"slider_values"`
+
+	// volumes waiting for their app to launch (see not_running.go), by target
+	QueuedVolumes map[string]float32 `json:"queued_volumes"`
+
+	// pairing keys (hex) by device ID, lowercased (see pairing.go)
+	PairedDevices map[string]string `json:"paired_devices"`
+
+	// guest tokens for the API by ID (see api_tokens.go)
+	APITokens map[string]apiToken `json:"api_tokens"`
+
+	// this week's volume usage by app (see usage_stats.go)
+	Usage usageWeek `json:"usage"`
+}
+
+// stateStore keeps deej's persisted state in memory, and writes it to logs/state.json as it changes.
+// the file is replaced in one go, so a crash mid-write leaves the previous state rather than half of the new one
+type stateStore struct {
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	// where to save the state, or an empty string to keep it in memory only (as simulations do)
+	path string
+
+	state       persistedState
+	savePending bool
+}
+
+func newStateStore(logger *zap.SugaredLogger, path string) *stateStore {
+	logger = logger.Named("state")
+
+	ss := &stateStore{
+		logger: logger,
+		path:   path,
+		state:  newPersistedState(),
+	}
+
+	logger.Debug("Created state store instance")
+
+	return ss
+}
+
+func newPersistedState() persistedState {
+	return persistedState{
+		SliderValues:  map[int]float32{},
+		QueuedVolumes: map[string]float32{},
+		PairedDevices: map[string]string{},
+		APITokens:     map[string]apiToken{},
+		Usage:         usageWeek{Apps: map[string]appUsage{}},
+	}
+}
+
+// load reads the state saved by the last run. a missing or unreadable state file just means starting fresh
+func (ss *stateStore) load() {
+	if ss.path == "" {
+		return
+	}
+
+	contents, err := ioutil.ReadFile(ss.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ss.logger.Warnw("Failed to read state file, starting fresh", "path", ss.path, "error", err)
+		}
+
+		return
+	}
+
+	state := newPersistedState()
+	if err := json.Unmarshal(contents, &state); err != nil {
+		ss.logger.Warnw("Failed to parse state file, starting fresh", "path", ss.path, "error", err)
+		return
+	}
+
+	// an older (or hand-edited) file might not have every map
+	if state.SliderValues == nil {
+		state.SliderValues = map[int]float32{}
+	}
+
+	if state.QueuedVolumes == nil {
+		state.QueuedVolumes = map[string]float32{}
+	}
+
+	if state.PairedDevices == nil {
+		state.PairedDevices = map[string]string{}
+	}
+
+	if state.APITokens == nil {
+		state.APITokens = map[string]apiToken{}
+	}
+
+	if state.Usage.Apps == nil {
+		state.Usage.Apps = map[string]appUsage{}
+	}
+
+	ss.lock.Lock()
+	ss.state = state
+	ss.lock.Unlock()
+
+	ss.logger.Debugw("Loaded state", "path", ss.path)
+}
+
+// view calls f with the current state, which it mustn't hold on to or change
+func (ss *stateStore) view(f func(state *persistedState)) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	f(&ss.state)
+}
+
+// update calls f to change the state, and saves it shortly after
+func (ss *stateStore) update(f func(state *persistedState)) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	f(&ss.state)
+
+	if ss.path == "" || ss.savePending {
+		return
+	}
+
+	ss.savePending = true
+	time.AfterFunc(stateSaveDelay, ss.flush)
+}
+
+// updateNow calls f to change the state, and saves it right away. for changes that need to be on disk
+// before anything else happens (like counting a startup, in case it crashes)
+func (ss *stateStore) updateNow(f func(state *persistedState)) error {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	f(&ss.state)
+
+	return ss.saveLocked()
+}
+
+// flush saves any changes that are still waiting to be
+func (ss *stateStore) flush() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if !ss.savePending {
+		return
+	}
+
+	if err := ss.saveLocked(); err != nil {
+		ss.logger.Warnw("Failed to save state", "error", err)
+	}
+}
+
+// saveLocked writes the state to a temporary file and moves it over the state file. assumes the lock is held
+func (ss *stateStore) saveLocked() error {
+	ss.savePending = false
+
+	if ss.path == "" {
+		return nil
+	}
+
+	contents, err := json.MarshalIndent(ss.state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal state: %w", err)
+	}
+
+	if err := util.EnsureDirExists(filepath.Dir(ss.path)); err != nil {
+		return fmt.Errorf("ensure state directory exists: %w", err)
+	}
+
+	// only readable by the user, as it holds pairing keys
+	tempPath := ss.path + ".tmp"
+	if err := ioutil.WriteFile(tempPath, contents, 0600); err != nil {
+		return fmt.Errorf("write temporary state file: %w", err)
+	}
+
+	if err := os.Rename(tempPath, ss.path); err != nil {
+		return fmt.Errorf("replace state file: %w", err)
+	}
+
+	return nil
+}
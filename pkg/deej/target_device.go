@@ -0,0 +1,51 @@
+package deej
+
+import (
+	"strings"
+)
+
+// targets starting with this bind an output device's own (master) volume, e.g. "device:Headphones (Realtek Audio)",
+// so that every output in a multi-output setup can get its own slider. the name is the one shown by the OS
+// (the full name on windows, the sink's description on linux), or a pattern matching it
+const targetDevicePrefix = "device:"
+
+// splitDeviceTarget returns the device name (or pattern) a device target looks for, or false if it isn't one
+func splitDeviceTarget(target string) (string, bool) {
+	if !strings.HasPrefix(strings.ToLower(target), targetDevicePrefix) {
+		return "", false
+	}
+
+	return target[len(targetDevicePrefix):], true
+}
+
+// isDeviceTarget reports whether the given target binds an output device's volume
+func isDeviceTarget(target string) bool {
+	_, ok := splitDeviceTarget(target)
+	return ok
+}
+
+// deviceTargetMatches reports whether the given device target refers to the given session.
+// only sessions controlling an output device's volume can match
+func deviceTargetMatches(target string, session Session) bool {
+	name, ok := splitDeviceTarget(target)
+	if !ok || name == "" {
+		return false
+	}
+
+	endpoint, ok := session.(endpointSession)
+	if !ok || !endpoint.IsOutput() || endpoint.EndpointName() == "" {
+		return false
+	}
+
+	return deviceNameMatches(name, endpoint.EndpointName())
+}
+
+// deviceNameMatches reports whether the given name (or pattern) refers to the device with the given name
+func deviceNameMatches(name string, deviceName string) bool {
+	if isTargetPattern(name) {
+		pattern, ok := targetPattern(name)
+		return ok && pattern.MatchString(deviceName)
+	}
+
+	return strings.EqualFold(name, deviceName)
+}
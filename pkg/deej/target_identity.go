@@ -0,0 +1,73 @@
+package deej
+
+import (
+	"strings"
+)
+
+const (
+	// targets starting with these match sessions by what their app shows rather than its process name, e.g.
+	// "title:YouTube Music" - useful for apps sharing an executable (browser web apps, electron apps)
+	targetTitlePrefix   = "title:"
+	targetProductPrefix = "product:"
+)
+
+// splitIdentityTarget returns an identity target's prefix and the text it looks for, or false if it isn't one
+func splitIdentityTarget(target string) (string, string, bool) {
+	lowerTarget := strings.ToLower(target)
+
+	for _, prefix := range []string{targetTitlePrefix, targetProductPrefix} {
+		if strings.HasPrefix(lowerTarget, prefix) {
+			return prefix, target[len(prefix):], true
+		}
+	}
+
+	return "", "", false
+}
+
+// isIdentityTarget reports whether the given target matches sessions by window title or product name
+func isIdentityTarget(target string) bool {
+	_, _, ok := splitIdentityTarget(target)
+	return ok
+}
+
+// identityTargetMatches reports whether the given identity target refers to the given session.
+// sessions that can't tell their window titles or product name never match
+func identityTargetMatches(target string, session Session) bool {
+	prefix, value, ok := splitIdentityTarget(target)
+	if !ok || value == "" {
+		return false
+	}
+
+	identified, ok := session.(identifiedSession)
+	if !ok {
+		return false
+	}
+
+	if prefix == targetProductPrefix {
+		return identityValueMatches(value, identified.ProductName())
+	}
+
+	for _, title := range identified.WindowTitles() {
+		if identityValueMatches(value, title) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// identityValueMatches compares what an identity target looks for against a title or product name.
+// plain text matches anywhere in it (titles tend to carry extra bits, like the current song), while
+// patterns are matched the same way they are against process names
+func identityValueMatches(value string, text string) bool {
+	if text == "" {
+		return false
+	}
+
+	if isTargetPattern(value) {
+		pattern, ok := targetPattern(value)
+		return ok && pattern.MatchString(text)
+	}
+
+	return strings.Contains(strings.ToLower(text), strings.ToLower(value))
+}
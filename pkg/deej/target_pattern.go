@@ -0,0 +1,119 @@
+package deej
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	// targets starting with this are regular expressions, e.g. "re:^steam_app_\d+$"
+	targetRegexPrefix = "re:"
+
+	// targets containing any of these are wildcard patterns, e.g. "chrome*" ("*" is any run of characters, "?" any one)
+	targetWildcardChars = "*?"
+)
+
+// compiled patterns by their target, so that slider moves don't recompile them. invalid ones are kept as nil
+var (
+	targetPatterns     = map[string]*regexp.Regexp{}
+	targetPatternsLock sync.Mutex
+)
+
+// isTargetPattern reports whether the given target matches process names by pattern rather than by name.
+// identity and device targets aren't, even when what they look for is a pattern (see target_identity.go, target_device.go)
+func isTargetPattern(target string) bool {
+	if isIdentityTarget(target) || isDeviceTarget(target) {
+		return false
+	}
+
+	return strings.HasPrefix(strings.ToLower(target), targetRegexPrefix) || strings.ContainsAny(target, targetWildcardChars)
+}
+
+// targetPattern returns the compiled pattern for a pattern target, or false if it isn't one or doesn't compile.
+// patterns are case-insensitive, like every other target
+func targetPattern(target string) (*regexp.Regexp, bool) {
+	if !isTargetPattern(target) {
+		return nil, false
+	}
+
+	targetPatternsLock.Lock()
+	defer targetPatternsLock.Unlock()
+
+	if pattern, ok := targetPatterns[target]; ok {
+		return pattern, pattern != nil
+	}
+
+	pattern, err := compileTargetPattern(target)
+	if err != nil {
+		pattern = nil
+	}
+
+	targetPatterns[target] = pattern
+
+	return pattern, pattern != nil
+}
+
+func compileTargetPattern(target string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(strings.ToLower(target), targetRegexPrefix) {
+		return regexp.Compile("(?i)" + target[len(targetRegexPrefix):])
+	}
+
+	// wildcards always match the whole name
+	expression := regexp.QuoteMeta(target)
+	expression = strings.ReplaceAll(expression, `\*`, ".*")
+	expression = strings.ReplaceAll(expression, `\?`, ".")
+
+	return regexp.Compile("(?i)^" + expression + "$")
+}
+
+// targetMatchesName reports whether the given target refers to the given (lowercase) process or session name
+func targetMatchesName(target string, name string) bool {
+	if isTargetPattern(target) {
+		pattern, ok := targetPattern(target)
+		return ok && pattern.MatchString(name)
+	}
+
+	return strings.ToLower(target) == name
+}
+
+// matchingPeakLevels returns the peak levels of every process the given target refers to
+func matchingPeakLevels(target string, peakLevels map[string]float32) map[string]float32 {
+	matching := map[string]float32{}
+
+	if !isTargetPattern(target) {
+		name := strings.ToLower(target)
+		if level, ok := peakLevels[name]; ok {
+			matching[name] = level
+		}
+
+		return matching
+	}
+
+	for name, level := range peakLevels {
+		if targetMatchesName(target, name) {
+			matching[name] = level
+		}
+	}
+
+	return matching
+}
+
+// normalizeTarget lowercases a target for comparisons. patterns (and identity and device targets, which can hold them)
+// are left alone, as lowercasing would change the meaning of escapes like "\D" (they're matched case-insensitively anyway)
+func normalizeTarget(target string) string {
+	if isTargetPattern(target) || isIdentityTarget(target) || isDeviceTarget(target) {
+		return target
+	}
+
+	return strings.ToLower(target)
+}
+
+func normalizeTargets(targets []string) []string {
+	result := make([]string, len(targets))
+	for idx, target := range targets {
+		result[idx] = normalizeTarget(target)
+	}
+
+	return result
+}
@@ -0,0 +1,192 @@
+package deej
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	automationActionTargetMute   = "target.mute"   // mute the "target" key's sessions, and keep them muted
+	automationActionTargetUnmute = "target.unmute" // unmute the "target" key's sessions, ending a scheduled mute
+	automationActionTargetVolume = "target.volume" // set the "target" key's volume to the "volume" key's percent
+
+	defaultAutomationOverrideMinutes = 60
+)
+
+// scheduledTarget is what the schedule last asked of a target
+type scheduledTarget struct {
+
+	// whether a scheduled mute is in effect, and how many sessions it was last applied to
+	mute          bool
+	mutedSessions int
+
+	// a scheduled volume that couldn't be set yet, as the target wasn't running
+	pendingVolume *float32
+
+	// a manual change the schedule is leaving alone until then
+	overriddenUntil time.Time
+}
+
+// targetSchedule runs the scheduled target actions. a scheduled mute stays in effect until a scheduled unmute: targets
+// that start later get muted too, and ones unmuted by hand get muted again - unless it looks like the user did it, in
+// which case they're left alone for a while (automation.override_minutes). scheduled volumes are set just once, as
+// soon as their target's running
+type targetSchedule struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock    sync.Mutex
+	targets map[string]*scheduledTarget
+}
+
+func newTargetSchedule(deej *Deej, logger *zap.SugaredLogger) *targetSchedule {
+	return &targetSchedule{
+		deej:    deej,
+		logger:  logger,
+		targets: map[string]*scheduledTarget{},
+	}
+}
+
+// Mute starts a scheduled mute of the "target" param
+func (ts *targetSchedule) Mute(params map[string]string, now time.Time) {
+	target, ok := ts.targetParam(params)
+	if !ok {
+		return
+	}
+
+	ts.lock.Lock()
+	state := ts.stateFor(target)
+	state.mute = true
+	state.mutedSessions = 0
+	state.overriddenUntil = time.Time{}
+	ts.lock.Unlock()
+
+	ts.enforce(now)
+}
+
+// Unmute ends a scheduled mute of the "target" param, and unmutes it
+func (ts *targetSchedule) Unmute(params map[string]string) {
+	target, ok := ts.targetParam(params)
+	if !ok {
+		return
+	}
+
+	ts.lock.Lock()
+	if state, ok := ts.targets[target]; ok {
+		state.mute = false
+		ts.forgetIfDone(target, state)
+	}
+	ts.lock.Unlock()
+
+	if !ts.deej.sessions.setTargetMute(target, false) {
+		ts.logger.Infow("Scheduled unmute target isn't running", "target", target)
+	}
+}
+
+// SetVolume sets the "target" param's volume to the "volume" param's percent, or once it's running if it isn't yet
+func (ts *targetSchedule) SetVolume(params map[string]string, now time.Time) {
+	target, ok := ts.targetParam(params)
+	if !ok {
+		return
+	}
+
+	volume := float32(math.Min(100, alarmParamFloat(params, "volume", -1)))
+	if volume < 0 {
+		ts.logger.Warnw("Scheduled volume has no valid volume set, ignoring", "target", target)
+		return
+	}
+
+	volume /= 100
+
+	ts.lock.Lock()
+	ts.stateFor(target).pendingVolume = &volume
+	ts.lock.Unlock()
+
+	ts.enforce(now)
+}
+
+// enforce brings targets in line with the schedule, other than ones the user's overridden. the automation engine
+// calls it every minute, which is also how targets that start later get picked up
+func (ts *targetSchedule) enforce(now time.Time) {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	overrideDuration := ts.deej.config.Automation.OverrideDuration
+
+	for target, state := range ts.targets {
+		if state.pendingVolume != nil {
+			if ts.deej.sessions.setTargetVolume(target, *state.pendingVolume) {
+				ts.logger.Infow("Set scheduled volume", "target", target, "volume", *state.pendingVolume)
+				state.pendingVolume = nil
+			}
+		}
+
+		if state.mute && now.After(state.overriddenUntil) {
+			ts.enforceMute(target, state, now, overrideDuration)
+		}
+
+		ts.forgetIfDone(target, state)
+	}
+}
+
+func (ts *targetSchedule) enforceMute(target string, state *scheduledTarget, now time.Time, overrideDuration time.Duration) {
+	if ts.deej.config.automationExempt(target) {
+		return
+	}
+
+	muted, running := ts.deej.sessions.getTargetMute(target)
+	if !running || muted {
+		return
+	}
+
+	sessions := len(ts.deej.sessions.targetSessions(target))
+
+	// unmuted since we muted it, without any new sessions showing up to explain it - the user wants to hear it
+	if state.mutedSessions > 0 && sessions <= state.mutedSessions && overrideDuration > 0 {
+		state.mutedSessions = 0
+		state.overriddenUntil = now.Add(overrideDuration)
+
+		ts.logger.Infow("Scheduled mute overridden, leaving target alone for a while",
+			"target", target,
+			"until", state.overriddenUntil.Format("15:04"))
+
+		return
+	}
+
+	if !ts.deej.sessions.setTargetMute(target, true) {
+		return
+	}
+
+	state.mutedSessions = sessions
+	ts.logger.Infow("Muted scheduled target", "target", target)
+}
+
+func (ts *targetSchedule) targetParam(params map[string]string) (string, bool) {
+	target := strings.ToLower(strings.TrimSpace(params["target"]))
+	if target == "" {
+		ts.logger.Warn("Scheduled target action has no target set, ignoring")
+		return "", false
+	}
+
+	return target, true
+}
+
+func (ts *targetSchedule) stateFor(target string) *scheduledTarget {
+	state, ok := ts.targets[target]
+	if !ok {
+		state = &scheduledTarget{}
+		ts.targets[target] = state
+	}
+
+	return state
+}
+
+func (ts *targetSchedule) forgetIfDone(target string, state *scheduledTarget) {
+	if !state.mute && state.pendingVolume == nil {
+		delete(ts.targets, target)
+	}
+}
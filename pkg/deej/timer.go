@@ -0,0 +1,315 @@
+package deej
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/thoas/go-funk"
+	"go.uber.org/zap"
+)
+
+const (
+	timerPhaseFocus     = "focus"
+	timerPhaseBreak     = "break"
+	timerPhaseLongBreak = "long break"
+
+	buttonActionTimerToggle = "timer.toggle" // start the timer, or stop it if it's running
+	buttonActionTimerSkip   = "timer.skip"   // end the current phase early and move on to the next one
+
+	defaultTimerFocusMinutes     = 25
+	defaultTimerBreakMinutes     = 5
+	defaultTimerLongBreakMinutes = 15
+	defaultTimerCyclesBeforeLong = 4
+
+	focusTimerTickInterval = time.Second
+
+	// how often to remind the display how much time is left
+	focusTimerDisplayInterval = time.Minute
+)
+
+// focusTimerConfig holds the user's pomodoro timer settings
+type focusTimerConfig struct {
+	FocusDuration         time.Duration
+	BreakDuration         time.Duration
+	LongBreakDuration     time.Duration
+	CyclesBeforeLongBreak int
+
+	// targets to mute while a focus phase is running
+	MuteDuringFocus []string
+}
+
+// focusTimer is a pomodoro-style timer alternating between focus and break phases.
+// while running, it shows its countdown on the LEDs and the device's display
+type focusTimer struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running         bool
+	phase           string
+	phaseStart      time.Time
+	phaseEnd        time.Time
+	completedCycles int
+	lastDisplayed   time.Time
+
+	// targets we muted when the current focus phase started, to be unmuted when it ends
+	mutedTargets []string
+
+	stopChannel chan bool
+}
+
+func newFocusTimer(deej *Deej, logger *zap.SugaredLogger) *focusTimer {
+	logger = logger.Named("timer")
+
+	ft := &focusTimer{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created focus timer instance")
+
+	return ft
+}
+
+// Toggle starts the timer at the beginning of a focus phase, or stops it if it's already running
+func (ft *focusTimer) Toggle() {
+	ft.lock.Lock()
+	running := ft.running
+	ft.lock.Unlock()
+
+	if running {
+		ft.Stop()
+	} else {
+		ft.Start()
+	}
+}
+
+// Start begins a new focus phase, unless the timer is already running
+func (ft *focusTimer) Start() {
+	ft.lock.Lock()
+
+	if ft.running {
+		ft.lock.Unlock()
+		return
+	}
+
+	ft.running = true
+	ft.completedCycles = 0
+	ft.enterPhase(timerPhaseFocus)
+	ft.lock.Unlock()
+
+	ft.deej.processMonitor.SetLEDOverride(ft)
+
+	go ft.timerLoop()
+}
+
+// Stop ends the timer, restoring anything muted by the current focus phase
+func (ft *focusTimer) Stop() {
+	ft.lock.Lock()
+
+	if !ft.running {
+		ft.lock.Unlock()
+		return
+	}
+
+	ft.running = false
+	ft.restoreMutedTargets()
+	ft.lock.Unlock()
+
+	ft.deej.processMonitor.ClearLEDOverride(ft)
+	ft.stopChannel <- true
+
+	ft.logger.Info("Timer stopped")
+	ft.sendDisplayPage("TIMER", "Stopped")
+}
+
+// Skip ends the current phase early
+func (ft *focusTimer) Skip() {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	if !ft.running {
+		return
+	}
+
+	ft.advancePhase()
+}
+
+func (ft *focusTimer) timerLoop() {
+	ticker := time.NewTicker(focusTimerTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ft.stopChannel:
+			return
+		case now := <-ticker.C:
+			ft.lock.Lock()
+
+			if now.After(ft.phaseEnd) {
+				ft.advancePhase()
+			} else if ft.lastDisplayed.Add(focusTimerDisplayInterval).Before(now) {
+				ft.displayRemaining(now)
+			}
+
+			ft.lock.Unlock()
+		}
+	}
+}
+
+// advancePhase moves on to whichever phase follows the current one. assumes the lock is held
+func (ft *focusTimer) advancePhase() {
+	if ft.phase != timerPhaseFocus {
+		ft.enterPhase(timerPhaseFocus)
+		return
+	}
+
+	ft.completedCycles++
+
+	if ft.completedCycles%ft.deej.config.Timer.CyclesBeforeLongBreak == 0 {
+		ft.enterPhase(timerPhaseLongBreak)
+	} else {
+		ft.enterPhase(timerPhaseBreak)
+	}
+}
+
+// enterPhase starts the given phase, muting or restoring targets as needed. assumes the lock is held
+func (ft *focusTimer) enterPhase(phase string) {
+	config := ft.deej.config.Timer
+
+	duration := config.FocusDuration
+	switch phase {
+	case timerPhaseBreak:
+		duration = config.BreakDuration
+	case timerPhaseLongBreak:
+		duration = config.LongBreakDuration
+	}
+
+	ft.phase = phase
+	ft.phaseStart = time.Now()
+	ft.phaseEnd = ft.phaseStart.Add(duration)
+
+	if phase == timerPhaseFocus {
+		ft.muteFocusTargets()
+	} else {
+		ft.restoreMutedTargets()
+	}
+
+	ft.logger.Infow("Timer phase started", "phase", phase, "duration", duration)
+	ft.deej.notifier.Notify(fmt.Sprintf("Timer: %s", phase),
+		fmt.Sprintf("%d minutes, until %s", int(duration.Minutes()), ft.phaseEnd.Format("15:04")))
+
+	ft.displayRemaining(ft.phaseStart)
+}
+
+func (ft *focusTimer) muteFocusTargets() {
+	for _, target := range ft.deej.config.Timer.MuteDuringFocus {
+		if ft.deej.config.automationExempt(target) {
+			continue
+		}
+
+		// leave alone anything the user muted themselves, so we don't unmute it later
+		if muted, ok := ft.deej.sessions.getTargetMute(target); !ok || muted {
+			continue
+		}
+
+		if ft.deej.sessions.setTargetMute(target, true) {
+			ft.mutedTargets = append(ft.mutedTargets, target)
+		}
+	}
+
+	if len(ft.mutedTargets) > 0 {
+		ft.logger.Debugw("Muted targets for focus phase", "targets", ft.mutedTargets)
+	}
+}
+
+// muteLaunchedApp mutes an app that launched during a focus phase, if it's one the phase keeps muted.
+// it's called while sessions are being refreshed, so it does its thing once that's done
+func (ft *focusTimer) muteLaunchedApp(key string) {
+	go func() {
+		ft.lock.Lock()
+		defer ft.lock.Unlock()
+
+		if !ft.running || ft.phase != timerPhaseFocus {
+			return
+		}
+
+		for _, target := range ft.deej.config.Timer.MuteDuringFocus {
+			if !targetMatchesName(target, key) || ft.deej.config.automationExempt(key) {
+				continue
+			}
+
+			if !ft.deej.sessions.setTargetMute(target, true) {
+				continue
+			}
+
+			if !funk.ContainsString(ft.mutedTargets, target) {
+				ft.mutedTargets = append(ft.mutedTargets, target)
+			}
+
+			ft.logger.Debugw("Muted app launched during focus phase", "target", target)
+		}
+	}()
+}
+
+func (ft *focusTimer) restoreMutedTargets() {
+	for _, target := range ft.mutedTargets {
+		ft.deej.fader.unmuteTarget(target)
+	}
+
+	if len(ft.mutedTargets) > 0 {
+		ft.logger.Debugw("Restored targets muted by focus phase", "targets", ft.mutedTargets)
+	}
+
+	ft.mutedTargets = nil
+}
+
+// displayRemaining shows the current phase and its remaining time. assumes the lock is held
+func (ft *focusTimer) displayRemaining(now time.Time) {
+	ft.lastDisplayed = now
+
+	remaining := ft.phaseEnd.Sub(now)
+	minutes := int(remaining.Minutes())
+	seconds := int(remaining.Seconds()) % 60
+
+	ft.sendDisplayPage(ft.phase, fmt.Sprintf("%02d:%02d left", minutes, seconds))
+}
+
+func (ft *focusTimer) sendDisplayPage(title string, text string) {
+	page := displayPage{
+		Title: title,
+		Text:  text,
+	}
+
+	if err := ft.deej.serial.SendDisplayPage(page); err != nil && ft.deej.Verbose() {
+		ft.logger.Warnw("Failed to send timer display page", "error", err)
+	}
+}
+
+// ledStates implements ledOverride by lighting up a bar that drains as the current phase runs out
+func (ft *focusTimer) ledStates(numSliders int) (map[int]bool, bool) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	if !ft.running {
+		return nil, false
+	}
+
+	total := ft.phaseEnd.Sub(ft.phaseStart)
+	remaining := time.Until(ft.phaseEnd)
+
+	lit := numSliders
+	if total > 0 {
+		lit = int(float64(numSliders)*remaining.Seconds()/total.Seconds() + 0.999)
+	}
+
+	states := make(map[int]bool, numSliders)
+	for ledIdx := 0; ledIdx < numSliders; ledIdx++ {
+		states[ledIdx] = ledIdx < lit
+	}
+
+	return states, true
+}
@@ -0,0 +1,267 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	trafficKindConfig     = "config"     // the user and internal config, whenever they're (re)loaded
+	trafficKindInbound    = "in"         // a line read from the device
+	trafficKindOutbound   = "out"        // a command written to the device
+	trafficKindDisconnect = "disconnect" // the device connection was closed
+	trafficKindActivity   = "activity"   // what the process monitor saw (running processes or audio peaks)
+	trafficKindLEDRefresh = "refresh"    // the process monitor re-sent every LED's state
+	trafficKindLEDsOff    = "leds_off"   // the process monitor turned every LED off, as deej stopped
+	trafficKindSessions   = "sessions"   // the audio sessions acquired by the session map
+	trafficKindVolume     = "volume"     // a session's volume was set by a slider
+)
+
+// trafficEntry is a single line of a traffic recording. only the fields relevant to its kind are set
+type trafficEntry struct {
+	At   int64  `json:"at"` // milliseconds since the recording started
+	Kind string `json:"kind"`
+
+	Line string `json:"line,omitempty"`
+
+	Config   map[string]interface{} `json:"config,omitempty"`
+	Internal map[string]interface{} `json:"internal,omitempty"`
+	Profile  string                 `json:"profile,omitempty"`
+
+	// the LED mode the process monitor ends up in, which isn't led_mode on platforms without an audio meter
+	LEDMode string `json:"led_mode,omitempty"`
+
+	Active []string           `json:"active,omitempty"`
+	Peaks  map[string]float32 `json:"peaks,omitempty"`
+
+	Sessions []trafficSession `json:"sessions,omitempty"`
+
+	Target string  `json:"target,omitempty"`
+	Volume float32 `json:"volume,omitempty"`
+}
+
+type trafficSession struct {
+	Key    string  `json:"key"`
+	Volume float32 `json:"volume"`
+	Muted  bool    `json:"muted,omitempty"`
+}
+
+// trafficRecorder writes everything going in and out of deej's core (device lines, process and session
+// snapshots, LED and volume commands) to a file, one JSON object per line, so that it can be replayed later.
+// a nil recorder records nothing, which is what deej runs with unless recording was asked for
+type trafficRecorder struct {
+	logger *zap.SugaredLogger
+
+	lock    sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+	start   time.Time
+}
+
+func newTrafficRecorder(logger *zap.SugaredLogger, path string) (*trafficRecorder, error) {
+	logger = logger.Named("recorder")
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("create recording file: %w", err)
+	}
+
+	tr := &trafficRecorder{
+		logger:  logger,
+		file:    file,
+		encoder: json.NewEncoder(file),
+		start:   time.Now(),
+	}
+
+	logger.Infow("Recording traffic", "path", path)
+
+	return tr, nil
+}
+
+// SetTrafficRecording makes deej record its traffic to the given file, if called before Initialize
+func (d *Deej) SetTrafficRecording(path string) error {
+	recorder, err := newTrafficRecorder(d.logger, path)
+	if err != nil {
+		return err
+	}
+
+	d.recorder = recorder
+
+	// record every reload, before the session map reacts to it (it subscribes later)
+	d.onConfigReload(func() {
+		recorder.recordConfig(d.config)
+	})
+
+	return nil
+}
+
+func (tr *trafficRecorder) record(entry trafficEntry) {
+	if tr == nil {
+		return
+	}
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	if tr.encoder == nil {
+		return
+	}
+
+	entry.At = time.Since(tr.start).Milliseconds()
+
+	if err := tr.encoder.Encode(entry); err != nil {
+		tr.logger.Warnw("Failed to record traffic, stopping", "error", err)
+		tr.encoder = nil
+	}
+}
+
+func (tr *trafficRecorder) recordConfig(cc *CanonicalConfig) {
+	if tr == nil {
+		return
+	}
+
+	tr.record(trafficEntry{
+		Kind:     trafficKindConfig,
+		Config:   jsonCompatibleMap(cc.userConfig.AllSettings()),
+		Internal: jsonCompatibleMap(cc.internalConfig.AllSettings()),
+		Profile:  cc.ActiveProfile,
+		LEDMode:  effectiveLEDMode(cc.LEDMode),
+	})
+}
+
+func (tr *trafficRecorder) recordInbound(line string) {
+	tr.record(trafficEntry{Kind: trafficKindInbound, Line: line})
+}
+
+func (tr *trafficRecorder) recordOutbound(command string) {
+	tr.record(trafficEntry{Kind: trafficKindOutbound, Line: command})
+}
+
+func (tr *trafficRecorder) recordDisconnect() {
+	tr.record(trafficEntry{Kind: trafficKindDisconnect})
+}
+
+func (tr *trafficRecorder) recordLEDRefresh() {
+	tr.record(trafficEntry{Kind: trafficKindLEDRefresh})
+}
+
+func (tr *trafficRecorder) recordLEDsOff() {
+	tr.record(trafficEntry{Kind: trafficKindLEDsOff})
+}
+
+// recordActivity only keeps the processes that are mapped to a slider - nothing else can affect the LEDs,
+// and a full process list every few seconds would make for a huge recording
+func (tr *trafficRecorder) recordActivity(activeProcesses map[string]bool, peakLevels map[string]float32, mapping *sliderMap) {
+	if tr == nil {
+		return
+	}
+
+	targets := []string{}
+	mapping.iterate(func(sliderID int, sliderTargets []string) {
+		targets = append(targets, sliderTargets...)
+	})
+
+	mapped := func(name string) bool {
+		for _, target := range targets {
+			if targetMatchesName(target, name) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	entry := trafficEntry{Kind: trafficKindActivity}
+
+	for name := range activeProcesses {
+		if mapped(name) {
+			entry.Active = append(entry.Active, name)
+		}
+	}
+
+	sort.Strings(entry.Active)
+
+	if peakLevels != nil {
+		entry.Peaks = map[string]float32{}
+
+		for name, level := range peakLevels {
+			if mapped(name) {
+				entry.Peaks[name] = level
+			}
+		}
+	}
+
+	tr.record(entry)
+}
+
+func (tr *trafficRecorder) recordSessions(sessions []Session) {
+	if tr == nil {
+		return
+	}
+
+	entry := trafficEntry{Kind: trafficKindSessions, Sessions: []trafficSession{}}
+
+	for _, session := range sessions {
+		entry.Sessions = append(entry.Sessions, trafficSession{
+			Key:    session.Key(),
+			Volume: session.GetVolume(),
+			Muted:  session.GetMute(),
+		})
+	}
+
+	tr.record(entry)
+}
+
+func (tr *trafficRecorder) recordVolume(target string, volume float32) {
+	tr.record(trafficEntry{Kind: trafficKindVolume, Target: target, Volume: volume})
+}
+
+func (tr *trafficRecorder) close() {
+	if tr == nil {
+		return
+	}
+
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+
+	tr.encoder = nil
+
+	if err := tr.file.Close(); err != nil {
+		tr.logger.Warnw("Failed to close recording file", "error", err)
+	}
+}
+
+// jsonCompatibleMap converts the map[interface{}]interface{} values that YAML decoding leaves around
+// into map[string]interface{}, which is all encoding/json accepts
+func jsonCompatibleMap(value map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(value))
+
+	for key, fieldValue := range value {
+		result[key] = jsonCompatible(fieldValue)
+	}
+
+	return result
+}
+
+func jsonCompatible(value interface{}) interface{} {
+	if fields, ok := toStringMap(value); ok {
+		return jsonCompatibleMap(fields)
+	}
+
+	if items, ok := value.([]interface{}); ok {
+		result := make([]interface{}, len(items))
+		for idx, item := range items {
+			result[idx] = jsonCompatible(item)
+		}
+
+		return result
+	}
+
+	return value
+}
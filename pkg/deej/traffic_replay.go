@@ -0,0 +1,334 @@
+package deej
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+)
+
+const (
+	// the serial connection re-sends every slider this long after a config reload (see SerialIO.setupOnConfigReload)
+	replaySliderResetDelay = 50 * time.Millisecond
+
+	// recordings can hold long lines (config snapshots), don't choke on them
+	maxTrafficEntrySize = 1024 * 1024
+)
+
+// commands produced by the logic being replayed - anything else (e.g. display pages) comes from parts of deej
+// that replaying doesn't drive, and isn't compared
+var replayedCommandPrefixes = []string{"#L", "#AP:"}
+
+// ReplayTraffic plays a traffic recording (made with --record) back through deej's slider handling, session map
+// and LED logic, against simulated sessions and a simulated device. it then checks that the exact same LED and
+// volume commands came out as when the recording was made, returning an error describing the first difference.
+// everything is replayed in order as fast as possible, so results don't depend on how long the recording is
+func ReplayTraffic(logger *zap.SugaredLogger, path string) error {
+	logger = logger.Named("replay")
+
+	entries, err := readTrafficRecording(path)
+	if err != nil {
+		return fmt.Errorf("read recording: %w", err)
+	}
+
+	finder := newSimulatedSessionFinder(logger)
+
+	actualVolumes := []string{}
+	finder.onSetVolume = func(name string, volume float32) {
+		actualVolumes = append(actualVolumes, formatReplayedVolume(name, volume))
+	}
+
+	d, err := newSimulatedDeej(logger, finder)
+	if err != nil {
+		return fmt.Errorf("create simulated deej: %w", err)
+	}
+
+	port := &replayPort{}
+	d.serial.conn = port
+	d.serial.connected = true
+
+	// take move events straight off the serial connection, so that each line is fully handled before the next one
+	moveEvents := d.serial.SubscribeToSliderMoveEvents()
+	defer moveEvents.Close()
+
+	expectedCommands := []string{}
+	expectedVolumes := []string{}
+
+	resetSlidersAt := int64(-1)
+
+	for _, entry := range entries {
+		switch entry.Kind {
+		case trafficKindConfig:
+			config, err := replayConfig(logger, d.notifier, entry)
+			if err != nil {
+				return fmt.Errorf("replay config at %dms: %w", entry.At, err)
+			}
+
+			d.config = config
+
+			// recordings made before the effective mode was recorded get this platform's
+			ledMode := entry.LEDMode
+			if ledMode == "" {
+				ledMode = effectiveLEDMode(config.LEDMode)
+			}
+
+			d.processMonitor.audioMode = ledMode == LEDModeAudio
+			resetSlidersAt = entry.At + replaySliderResetDelay.Milliseconds()
+
+		case trafficKindInbound:
+			if resetSlidersAt >= 0 && entry.At >= resetSlidersAt {
+				d.serial.lastKnownNumSliders = 0
+				resetSlidersAt = -1
+			}
+
+			port.setConnected(true)
+			d.serial.handleLine(logger, entry.Line)
+
+			for drained := false; !drained; {
+				select {
+				case event := <-moveEvents.Events:
+					d.sessions.handleSliderMoveEvent(event)
+				default:
+					drained = true
+				}
+			}
+
+		case trafficKindDisconnect:
+			port.setConnected(false)
+			d.serial.forgetDisplayCapabilities()
+
+		case trafficKindActivity:
+			activeProcesses := make(map[string]bool, len(entry.Active))
+			for _, name := range entry.Active {
+				activeProcesses[name] = true
+			}
+
+			var peakLevels map[string]float32
+			if d.processMonitor.audioMode {
+				peakLevels = entry.Peaks
+				if peakLevels == nil {
+					peakLevels = map[string]float32{}
+				}
+			}
+
+			d.processMonitor.applyActivity(activeProcesses, peakLevels)
+
+		case trafficKindLEDRefresh:
+			d.processMonitor.refreshAllLEDs()
+
+		case trafficKindLEDsOff:
+			d.processMonitor.turnLEDsOff()
+
+		case trafficKindSessions:
+			finder.clearSessions()
+			for _, session := range entry.Sessions {
+				finder.setSession(session.Key, session.Volume, session.Muted)
+			}
+
+			d.sessions.refreshSessions(true)
+
+		case trafficKindOutbound:
+			if isReplayedCommand(entry.Line) {
+				expectedCommands = append(expectedCommands, entry.Line)
+			}
+
+		case trafficKindVolume:
+			expectedVolumes = append(expectedVolumes, formatReplayedVolume(entry.Target, entry.Volume))
+		}
+	}
+
+	actualCommands := []string{}
+	for _, command := range port.commands() {
+		if isReplayedCommand(command) {
+			actualCommands = append(actualCommands, command)
+		}
+	}
+
+	fmt.Printf("Replayed %d recorded entries: %d LED commands, %d volume changes\n",
+		len(entries), len(actualCommands), len(actualVolumes))
+
+	if err := compareReplayedSequence("LED commands", expectedCommands, actualCommands); err != nil {
+		return err
+	}
+
+	if err := compareReplayedSequence("volume changes", expectedVolumes, actualVolumes); err != nil {
+		return err
+	}
+
+	fmt.Println("Everything matched the recording.")
+
+	return nil
+}
+
+func readTrafficRecording(path string) ([]trafficEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open recording file: %w", err)
+	}
+	defer file.Close()
+
+	entries := []trafficEntry{}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxTrafficEntrySize)
+
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var entry trafficEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("parse line %d: %w", lineNumber, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read recording file: %w", err)
+	}
+
+	return entries, nil
+}
+
+// replayConfig rebuilds the config as it was when recorded
+func replayConfig(logger *zap.SugaredLogger, notifier Notifier, entry trafficEntry) (*CanonicalConfig, error) {
+	config, err := NewConfig(logger, notifier)
+	if err != nil {
+		return nil, fmt.Errorf("create new Config: %w", err)
+	}
+
+	if err := config.userConfig.MergeConfigMap(entry.Config); err != nil {
+		return nil, fmt.Errorf("merge user config: %w", err)
+	}
+
+	if err := config.internalConfig.MergeConfigMap(entry.Internal); err != nil {
+		return nil, fmt.Errorf("merge internal config: %w", err)
+	}
+
+	config.SetInitialProfile(entry.Profile)
+
+	if err := config.populateFromVipers(); err != nil {
+		return nil, fmt.Errorf("populate config fields: %w", err)
+	}
+
+	return config, nil
+}
+
+func isReplayedCommand(command string) bool {
+	for _, prefix := range replayedCommandPrefixes {
+		if strings.HasPrefix(command, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatReplayedVolume(target string, volume float32) string {
+	return fmt.Sprintf("%s=%.2f", target, volume)
+}
+
+// compareReplayedSequence describes the first place where the replayed sequence strays from the recorded one
+func compareReplayedSequence(name string, expected []string, actual []string) error {
+	for idx := 0; idx < len(expected) && idx < len(actual); idx++ {
+		if expected[idx] != actual[idx] {
+			return fmt.Errorf("%s differ at #%d: recorded %q, replayed %q", name, idx+1, expected[idx], actual[idx])
+		}
+	}
+
+	if len(expected) != len(actual) {
+		return fmt.Errorf("%s differ in length: recorded %d, replayed %d", name, len(expected), len(actual))
+	}
+
+	return nil
+}
+
+// replayPort stands in for the device's serial port, keeping every command written to it
+type replayPort struct {
+	lock      sync.Mutex
+	written   []string
+	connected bool
+}
+
+func (rp *replayPort) setConnected(connected bool) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	rp.connected = connected
+}
+
+func (rp *replayPort) commands() []string {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	return rp.written
+}
+
+func (rp *replayPort) Write(p []byte) (int, error) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+
+	// writes failed while the device was gone, so they never made it into the recording either
+	if !rp.connected {
+		return 0, errors.New("replay: device disconnected")
+	}
+
+	rp.written = append(rp.written, string(p))
+
+	return len(p), nil
+}
+
+func (rp *replayPort) Read(p []byte) (int, error) {
+	return 0, errors.New("replay: nothing to read")
+}
+
+// the rest of serial.Port has nothing to do for a port that isn't there
+
+func (rp *replayPort) SetMode(mode *serial.Mode) error {
+	return nil
+}
+
+func (rp *replayPort) Drain() error {
+	return nil
+}
+
+func (rp *replayPort) ResetInputBuffer() error {
+	return nil
+}
+
+func (rp *replayPort) ResetOutputBuffer() error {
+	return nil
+}
+
+func (rp *replayPort) SetDTR(dtr bool) error {
+	return nil
+}
+
+func (rp *replayPort) SetRTS(rts bool) error {
+	return nil
+}
+
+func (rp *replayPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+
+func (rp *replayPort) SetReadTimeout(t time.Duration) error {
+	return nil
+}
+
+func (rp *replayPort) Break(t time.Duration) error {
+	return nil
+}
+
+func (rp *replayPort) Close() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package deej
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// every recording in testdata/replay (made with --record) has to come out the same when replayed. to add one,
+// record a run that does whatever needs covering and drop the file in there:
+//
+//   - process_mode: LEDs tracking running processes, with the slider mapping changed halfway through
+//   - audio_mode_fallback: led_mode audio, recorded where there's no audio meter (LEDs track processes instead)
+func TestReplayRecordings(t *testing.T) {
+	recordings, err := filepath.Glob(filepath.Join("testdata", "replay", "*.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(recordings) == 0 {
+		t.Fatal("no recordings to replay")
+	}
+
+	for _, recording := range recordings {
+		recording := recording
+
+		t.Run(filepath.Base(recording), func(t *testing.T) {
+			if err := ReplayTraffic(zap.NewNop().Sugar(), recording); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package deej
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	displayCharsetUTF8   = "utf8"   // send text as-is, for displays that render UTF-8
+	displayCharsetASCII  = "ascii"  // romanize everything outside of ASCII
+	displayCharsetLatin1 = "latin1" // ISO-8859-1, romanizing anything it can't represent
+	displayCharsetCP1251 = "cp1251" // Windows-1251 (Cyrillic), romanizing anything it can't represent
+
+	// sent in place of characters we don't know how to romanize (e.g. CJK without a custom transliteration)
+	untransliteratableReplacement = "?"
+)
+
+// romanizations for the non-ASCII characters most likely to show up in app and device names.
+// pairs of strings, each holding the source characters followed by their respective (single-rune) romanizations,
+// plus a separate map for characters that romanize to more than one letter
+var (
+	singleRuneRomanizations = [][2]string{
+		{"ÀÁÂÃÄÅĀĂĄàáâãäåāăą", "AAAAAAAAAaaaaaaaaa"},
+		{"ÇĆĈĊČçćĉċč", "CCCCCccccc"},
+		{"ĎĐďđ", "DDdd"},
+		{"ÈÉÊËĒĔĖĘĚèéêëēĕėęě", "EEEEEEEEEeeeeeeeee"},
+		{"ĜĞĠĢĝğġģ", "GGGGgggg"},
+		{"ĤĦĥħ", "HHhh"},
+		{"ÌÍÎÏĨĪĬĮİìíîïĩīĭįı", "IIIIIIIIIiiiiiiiii"},
+		{"ĴĵĶķ", "JjKk"},
+		{"ĹĻĽĿŁĺļľŀł", "LLLLLlllll"},
+		{"ÑŃŅŇñńņň", "NNNNnnnn"},
+		{"ÒÓÔÕÖØŌŎŐòóôõöøōŏő", "OOOOOOOOOooooooooo"},
+		{"ŔŖŘŕŗř", "RRRrrr"},
+		{"ŚŜŞŠśŝşš", "SSSSssss"},
+		{"ŢŤŦţťŧ", "TTTttt"},
+		{"ÙÚÛÜŨŪŬŮŰŲùúûüũūŭůűų", "UUUUUUUUUUuuuuuuuuuu"},
+		{"ŴŵÝŶŸýÿŷ", "WwYYYyyy"},
+		{"ŹŻŽźżž", "ZZZzzz"},
+		{"АБВГДЕЗИЙКЛМНОПРСТУФЫЭІЇЄҐ", "ABVGDEZIYKLMNOPRSTUFYEIIEG"},
+		{"абвгдезийклмнопрстуфыэіїєґ", "abvgdeziyklmnoprstufyeiieg"},
+		{"ΑΒΓΔΕΖΗΙΚΛΜΝΞΟΠΡΣΤΥΦΧΩ", "ABGDEZIIKLMNXOPRSTYFXO"},
+		{"αβγδεζηικλμνξοπρσςτυφχω", "abgdeziiklmnxoprsstyfxo"},
+		{"‐‑‒–—―‘’‚“”„…", "------'''\"\"\"."},
+	}
+
+	multiRuneRomanizations = map[rune]string{
+		'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss", 'Þ': "Th", 'þ': "th",
+		'Ё': "Yo", 'Ж': "Zh", 'Х': "Kh", 'Ц': "Ts", 'Ч': "Ch", 'Ш': "Sh", 'Щ': "Shch", 'Ю': "Yu", 'Я': "Ya",
+		'ё': "yo", 'ж': "zh", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch", 'ю': "yu", 'я': "ya",
+		'Ъ': "", 'ъ': "", 'Ь': "", 'ь': "",
+		'Θ': "Th", 'θ': "th", 'Ψ': "Ps", 'ψ': "ps",
+	}
+
+	romanizations = buildRomanizations()
+)
+
+func buildRomanizations() map[rune]string {
+	result := make(map[rune]string)
+
+	for _, pair := range singleRuneRomanizations {
+		targets := []rune(pair[1])
+		for idx, source := range []rune(pair[0]) {
+			result[source] = string(targets[idx])
+		}
+	}
+
+	for source, target := range multiRuneRomanizations {
+		result[source] = target
+	}
+
+	return result
+}
+
+// displayTextEncoder turns text into the bytes a device's display can actually render
+type displayTextEncoder struct {
+
+	// the charset to use unless the device declares its own
+	charset string
+
+	// user-provided replacements, applied before anything else (e.g. romanized names for CJK apps)
+	custom *strings.Replacer
+}
+
+func newDisplayTextEncoder(charset string, custom map[string]string) *displayTextEncoder {
+	// longer sources go first, so that a whole-word replacement wins over one for a single character in it
+	sources := make([]string, 0, len(custom))
+	for source := range custom {
+		sources = append(sources, source)
+	}
+
+	sort.Slice(sources, func(i, j int) bool {
+		return utf8.RuneCountInString(sources[i]) > utf8.RuneCountInString(sources[j])
+	})
+
+	pairs := make([]string, 0, len(custom)*2)
+	for _, source := range sources {
+		pairs = append(pairs, source, custom[source])
+	}
+
+	return &displayTextEncoder{
+		charset: charset,
+		custom:  strings.NewReplacer(pairs...),
+	}
+}
+
+// romanize applies the user's replacements, then romanizes every character the given charset can't represent.
+// the result is still a (UTF-8) Go string, so it can be measured and truncated before being encoded
+func (dte *displayTextEncoder) romanize(text string, charset string) string {
+	text = dte.custom.Replace(text)
+
+	if charset == displayCharsetUTF8 {
+		return text
+	}
+
+	result := strings.Builder{}
+
+	for _, r := range text {
+		if charsetCanRepresent(charset, r) {
+			result.WriteRune(r)
+			continue
+		}
+
+		romanized, ok := romanizations[r]
+		if !ok {
+			romanized = untransliteratableReplacement
+		}
+
+		result.WriteString(romanized)
+	}
+
+	return result.String()
+}
+
+// encodeDisplayCharset converts romanized text to the given charset. for anything but UTF-8, the result is one byte per character
+func encodeDisplayCharset(text string, charset string) string {
+	if charset == displayCharsetUTF8 {
+		return text
+	}
+
+	result := make([]byte, 0, len(text))
+
+	for _, r := range text {
+		switch {
+		case r < utf8.RuneSelf:
+			result = append(result, byte(r))
+		case charset == displayCharsetLatin1 && r <= 0xFF:
+			result = append(result, byte(r))
+		case charset == displayCharsetCP1251 && cp1251Byte(r) != 0:
+			result = append(result, cp1251Byte(r))
+		default:
+			result = append(result, untransliteratableReplacement...)
+		}
+	}
+
+	return string(result)
+}
+
+func charsetCanRepresent(charset string, r rune) bool {
+	switch {
+	case r < utf8.RuneSelf:
+		return true
+	case charset == displayCharsetLatin1:
+		return r <= 0xFF
+	case charset == displayCharsetCP1251:
+		return cp1251Byte(r) != 0
+	}
+
+	return false
+}
+
+// cp1251Byte returns the Windows-1251 byte for a Cyrillic character, or 0 if it has none we map
+func cp1251Byte(r rune) byte {
+	switch {
+	case r >= 'А' && r <= 'я':
+		return byte(0xC0 + (r - 'А'))
+	case r == 'Ё':
+		return 0xA8
+	case r == 'ё':
+		return 0xB8
+	case r == 'І':
+		return 0xB2
+	case r == 'і':
+		return 0xB3
+	case r == 'Ї':
+		return 0xAF
+	case r == 'ї':
+		return 0xBF
+	case r == 'Є':
+		return 0xAA
+	case r == 'є':
+		return 0xBA
+	}
+
+	return 0
+}
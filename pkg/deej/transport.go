@@ -0,0 +1,86 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"go.bug.st/serial"
+)
+
+// Transport connects deej to a device some other way than a serial port (a network socket, a companion app's own
+// link to its firmware, and so on), for programs embedding deej (see WithTransport). the device speaks the same
+// protocol over it: deej reads slider values and commands from it line by line, and writes its own commands to it
+type Transport interface {
+
+	// Name describes where the device is for logs and notifications, like a COM port's name would
+	Name() string
+
+	// Open connects to the device. it's called again to reconnect whenever the connection it returned
+	// hits an error (including io.EOF), so it should return an error while the device can't be reached
+	Open() (io.ReadWriteCloser, error)
+}
+
+// openTransport connects through the given transport instead of a serial port
+func (sio *SerialIO) openTransport(transport Transport) error {
+	sio.comPort = transport.Name()
+	sio.deviceName = ""
+	sio.wantedIdentity = ""
+	sio.deviceIdentity = ""
+
+	sio.logger.Debugw("Attempting transport connection", "transport", sio.comPort)
+
+	conn, err := transport.Open()
+	if err != nil {
+		sio.logger.Warnw("Failed to open transport connection", "transport", sio.comPort, "error", err)
+		return fmt.Errorf("open transport connection: %w", err)
+	}
+
+	sio.link = linkTransport
+	sio.setPort(&transportPort{conn})
+
+	return nil
+}
+
+// transportPort stands in for a serial port, for connections made through a transport
+type transportPort struct {
+	io.ReadWriteCloser
+}
+
+// the rest of serial.Port has nothing to do for a connection that isn't a serial port
+
+func (tp *transportPort) SetMode(mode *serial.Mode) error {
+	return nil
+}
+
+func (tp *transportPort) Drain() error {
+	return nil
+}
+
+func (tp *transportPort) ResetInputBuffer() error {
+	return nil
+}
+
+func (tp *transportPort) ResetOutputBuffer() error {
+	return nil
+}
+
+func (tp *transportPort) SetDTR(dtr bool) error {
+	return nil
+}
+
+func (tp *transportPort) SetRTS(rts bool) error {
+	return nil
+}
+
+func (tp *transportPort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+
+func (tp *transportPort) SetReadTimeout(t time.Duration) error {
+	return nil
+}
+
+func (tp *transportPort) Break(t time.Duration) error {
+	return nil
+}
@@ -1,12 +1,24 @@
 package deej
 
 import (
+	"fmt"
+
 	"github.com/getlantern/systray"
+	"go.uber.org/zap"
 
 	"github.com/omriharel/deej/pkg/deej/icon"
 	"github.com/omriharel/deej/pkg/deej/util"
 )
 
+// the most scenes and profiles shown in the tray menu - any beyond this are still available from buttons
+const (
+	maxTrayScenes   = 8
+	maxTrayProfiles = 8
+)
+
+// windows cuts tray tooltips off at 127 characters
+const maxTrayTooltipLength = 127
+
 func (d *Deej) initializeTray(onDone func()) {
 	logger := d.logger.Named("tray")
 
@@ -23,6 +35,58 @@ func (d *Deej) initializeTray(onDone func()) {
 		refreshSessions := systray.AddMenuItem("Re-scan audio sessions", "Manually refresh audio sessions if something's stuck")
 		refreshSessions.SetIcon(icon.RefreshSessions)
 
+		switchOutput := systray.AddMenuItem("Switch output device", "Make the next output device the default one")
+		if !outputSwitchSupported {
+			switchOutput.Disable()
+		}
+
+		releaseDevice := systray.AddMenuItem(releaseMenuItemTitle(false), "Let go of the device's port to upload new firmware")
+		if d.transport != nil {
+			releaseDevice.Disable()
+		}
+
+		if autostartSupported {
+			d.addTrayAutostart(logger)
+		}
+
+		// every slider, with what it controls and where it is
+		systray.AddSeparator()
+		sliders := d.addTraySliders(logger)
+
+		// the tray library can't remove items, so keep a fixed number around and show as many as there are profiles
+		systray.AddSeparator()
+		profileItems := make([]*systray.MenuItem, maxTrayProfiles)
+		for idx := range profileItems {
+			profileItems[idx] = systray.AddMenuItem("", "Switch to this slider mapping profile")
+			d.watchProfileMenuItem(logger, profileItems[idx], idx)
+		}
+
+		updateProfileMenuItems(profileItems, d.config.ProfileNames(), d.config.ActiveProfile)
+
+		ledMode := systray.AddMenuItem(ledModeMenuItemTitle(d.config.LEDMode), "Switch the LEDs between following running apps and audio, until the config changes")
+		if !audioMeterSupported {
+			ledMode.Disable()
+		}
+
+		// same goes for scenes
+		systray.AddSeparator()
+		sceneItems := make([]*systray.MenuItem, maxTrayScenes)
+		for idx := range sceneItems {
+			sceneItems[idx] = systray.AddMenuItem("", "Apply this scene's volumes")
+			d.watchSceneMenuItem(logger, sceneItems[idx], idx)
+		}
+
+		updateSceneMenuItems(sceneItems, sceneNames(d.config.Scenes))
+
+		// the logs folder, which safe mode points the user at to find out what's been crashing
+		systray.AddSeparator()
+		openLogsTitle, openLogsTooltip := "Open logs folder", "See this run's log and the last few runs'"
+		if d.config.safeMode {
+			openLogsTitle, openLogsTooltip = "Safe mode - open logs", "Integrations, audio metering and the API are off. See what's been going wrong"
+		}
+
+		openLogs := systray.AddMenuItem(openLogsTitle, openLogsTooltip)
+
 		if d.version != "" {
 			systray.AddSeparator()
 			versionInfo := systray.AddMenuItem(d.version, "")
@@ -32,11 +96,23 @@ func (d *Deej) initializeTray(onDone func()) {
 		systray.AddSeparator()
 		quit := systray.AddMenuItem("Quit", "Stop deej and quit")
 
-		// wait on things to happen
+		configReloads := d.config.SubscribeToChanges()
+		nowPlaying := d.bus.subscribeToNowPlaying()
+		link := d.bus.subscribeToLink()
+
+		// wait on things to happen, until deej stops
 		go func() {
+			defer configReloads.Close()
+			defer nowPlaying.Close()
+			defer link.Close()
+
 			for {
 				select {
 
+				// stopping
+				case <-d.stopChannel:
+					return
+
 				// quit
 				case <-quit.ClickedCh:
 					logger.Info("Quit menu item clicked, stopping")
@@ -50,12 +126,29 @@ func (d *Deej) initializeTray(onDone func()) {
 					editor := "notepad.exe"
 					if util.Linux() {
 						editor = "gedit"
+					} else if util.Darwin() {
+						editor = "open -t"
 					}
 
 					if err := util.OpenExternal(logger, editor, userConfigFilepath); err != nil {
 						logger.Warnw("Failed to open config file for editing", "error", err)
 					}
 
+				// open the logs folder
+				case <-openLogs.ClickedCh:
+					logger.Info("Open logs menu item clicked, opening logs folder")
+
+					opener := "explorer.exe"
+					if util.Linux() {
+						opener = "xdg-open"
+					} else if util.Darwin() {
+						opener = "open"
+					}
+
+					if err := util.OpenExternal(logger, opener, logDirectory); err != nil {
+						logger.Warnw("Failed to open logs", "error", err)
+					}
+
 				// refresh sessions
 				case <-refreshSessions.ClickedCh:
 					logger.Info("Refresh sessions menu item clicked, triggering session map refresh")
@@ -63,6 +156,63 @@ func (d *Deej) initializeTray(onDone func()) {
 					// performance: the reason that forcing a refresh here is okay is that users can't spam the
 					// right-click -> select-this-option sequence at a rate that's meaningful to performance
 					d.sessions.refreshSessions(true)
+
+				// flip the LED mode
+				case <-ledMode.ClickedCh:
+					mode := LEDModeAudio
+					if d.config.LEDMode == LEDModeAudio {
+						mode = LEDModeProcess
+					}
+
+					logger.Infow("LED mode menu item clicked, switching LED mode", "ledMode", mode)
+
+					// switching notifies config consumers (including this loop), so it can't block it
+					go d.config.SetLEDMode(mode)
+
+				// cycle output devices
+				case <-switchOutput.ClickedCh:
+					logger.Info("Switch output device menu item clicked, switching to next output device")
+
+					go d.NextOutputDevice()
+
+				// let go of the device for a firmware upload, or reconnect after one
+				case <-releaseDevice.ClickedCh:
+					if d.serial.held {
+						logger.Info("Reconnect device menu item clicked, reconnecting")
+						d.serial.resume()
+						releaseDevice.SetTitle(releaseMenuItemTitle(false))
+
+						continue
+					}
+
+					logger.Info("Release device menu item clicked, letting go of the device")
+
+					port, err := d.serial.releaseForUpload(d.config.UploadReset)
+					if err != nil {
+						logger.Warnw("Failed to release device", "error", err)
+						d.notifier.Notify("Couldn't release device", err.Error())
+					}
+
+					if d.serial.held {
+						releaseDevice.SetTitle(releaseMenuItemTitle(true))
+						d.notifier.Notify("Device released",
+							fmt.Sprintf("%s is free for flashing. Reconnect from the tray when you're done.", port))
+					}
+
+				// keep the profile items and the rest up to date, however the profile was switched
+				case <-configReloads.Reloads:
+					updateProfileMenuItems(profileItems, d.config.ProfileNames(), d.config.ActiveProfile)
+					updateSceneMenuItems(sceneItems, sceneNames(d.config.Scenes))
+					ledMode.SetTitle(ledModeMenuItemTitle(d.config.LEDMode))
+					go sliders.refresh()
+
+				// show what's playing when hovering over the icon
+				case info := <-nowPlaying.Changes:
+					systray.SetTooltip(trayTooltip(info, d.link.current()))
+
+				// and how the connection to the device is doing
+				case health := <-link.Changes:
+					systray.SetTooltip(trayTooltip(d.nowPlaying.current(), health))
 				}
 			}
 		}()
@@ -80,7 +230,108 @@ func (d *Deej) initializeTray(onDone func()) {
 	systray.Run(onReady, onExit)
 }
 
+// watchSceneMenuItem applies whichever scene is currently shown in the item at the given index when it's clicked
+func (d *Deej) watchSceneMenuItem(logger *zap.SugaredLogger, item *systray.MenuItem, idx int) {
+	go func() {
+		for range item.ClickedCh {
+			names := sceneNames(d.config.Scenes)
+			if idx >= len(names) {
+				continue
+			}
+
+			logger.Infow("Scene menu item clicked, applying scene", "scene", names[idx])
+			d.ApplyScene(names[idx])
+		}
+	}()
+}
+
+// watchProfileMenuItem switches to whichever profile is currently shown in the item at the given index when it's clicked
+func (d *Deej) watchProfileMenuItem(logger *zap.SugaredLogger, item *systray.MenuItem, idx int) {
+	go func() {
+		for range item.ClickedCh {
+			names := d.config.ProfileNames()
+			if idx >= len(names) {
+				continue
+			}
+
+			logger.Infow("Profile menu item clicked, switching profile", "profile", names[idx])
+
+			if err := d.config.SwitchProfile(names[idx]); err != nil {
+				logger.Warnw("Failed to switch profile", "error", err)
+			}
+		}
+	}()
+}
+
+// updateProfileMenuItems shows an item per profile, with the active one checked
+func updateProfileMenuItems(items []*systray.MenuItem, names []string, active string) {
+	for idx, item := range items {
+		if idx >= len(names) {
+			item.Hide()
+			continue
+		}
+
+		item.SetTitle(profileMenuItemTitle(names[idx]))
+
+		if names[idx] == active {
+			item.Check()
+		} else {
+			item.Uncheck()
+		}
+
+		item.Show()
+	}
+}
+
+func updateSceneMenuItems(items []*systray.MenuItem, names []string) {
+	for idx, item := range items {
+		if idx >= len(names) {
+			item.Hide()
+			continue
+		}
+
+		item.SetTitle(fmt.Sprintf("Scene: %s", names[idx]))
+		item.Show()
+	}
+}
+
+// trayTooltip adds what's playing and the link's health to the tray icon's tooltip, keeping it short enough
+// for windows to show whole
+func trayTooltip(info nowPlayingInfo, health linkHealth) string {
+	tooltip := "deej"
+	if !info.empty() {
+		tooltip = fmt.Sprintf("deej - %s", info.String())
+		if info.Status == nowPlayingStatusPaused {
+			tooltip += " (paused)"
+		}
+	}
+
+	tooltip += "\n" + health.String()
+
+	if runes := []rune(tooltip); len(runes) > maxTrayTooltipLength {
+		tooltip = string(runes[:maxTrayTooltipLength-3]) + "..."
+	}
+
+	return tooltip
+}
+
+func profileMenuItemTitle(profile string) string {
+	return fmt.Sprintf("Profile: %s", profile)
+}
+
+func ledModeMenuItemTitle(mode string) string {
+	return fmt.Sprintf("LEDs: %s", mode)
+}
+
 func (d *Deej) stopTray() {
 	d.logger.Debug("Quitting tray")
 	systray.Quit()
 }
+
+func releaseMenuItemTitle(held bool) string {
+	if held {
+		return "Reconnect device"
+	}
+
+	return "Release device for flashing"
+}
@@ -0,0 +1,262 @@
+package deej
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+	"go.uber.org/zap"
+)
+
+const (
+	// like scenes, the tray keeps this many items around for sliders and sessions, showing as many as there are
+	maxTraySliders  = 10
+	maxTraySessions = 15
+
+	// how often slider items catch up with the sliders
+	traySliderRefreshInterval = 500 * time.Millisecond
+
+	// slider items list their targets up to this long
+	maxTrayTargetsLength = 40
+)
+
+// traySliders shows every mapped slider in the tray menu with its targets and where it is, and remaps a slider to
+// a running audio session when it's clicked. remaps last until the config is next loaded, like profile switches
+type traySliders struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	sliderItems []*systray.MenuItem
+	sliderIDs   []int
+
+	// what each slider item shows, empty while hidden, so items are only updated when that changes
+	sliderTitles []string
+
+	// while a slider is being remapped: which one, and the sessions it can be mapped to
+	remapping    int
+	remapHeader  *systray.MenuItem
+	sessionItems []*systray.MenuItem
+	sessionKeys  []string
+	cancelRemap  *systray.MenuItem
+}
+
+// addTraySliders adds the slider items (and the hidden remapping ones) at the current position of the menu
+func (d *Deej) addTraySliders(logger *zap.SugaredLogger) *traySliders {
+	ts := &traySliders{
+		deej:      d,
+		logger:    logger,
+		remapping: -1,
+	}
+
+	ts.sliderItems = make([]*systray.MenuItem, maxTraySliders)
+	ts.sliderTitles = make([]string, maxTraySliders)
+
+	for idx := range ts.sliderItems {
+		ts.sliderItems[idx] = systray.AddMenuItem("", "Map this slider to another running app")
+		ts.sliderItems[idx].Hide()
+		ts.watchSliderItem(ts.sliderItems[idx], idx)
+	}
+
+	ts.remapHeader = systray.AddMenuItem("", "")
+	ts.remapHeader.Disable()
+
+	ts.sessionItems = make([]*systray.MenuItem, maxTraySessions)
+	for idx := range ts.sessionItems {
+		ts.sessionItems[idx] = systray.AddMenuItem("", "Map the slider to this, until the config changes")
+		ts.watchSessionItem(ts.sessionItems[idx], idx)
+	}
+
+	ts.cancelRemap = systray.AddMenuItem("Cancel", "Leave the slider as it is")
+	go func() {
+		for range ts.cancelRemap.ClickedCh {
+			ts.lock.Lock()
+			ts.stopRemapping()
+			ts.lock.Unlock()
+		}
+	}()
+
+	ts.lock.Lock()
+	ts.stopRemapping()
+	ts.lock.Unlock()
+
+	ts.refresh()
+
+	go func() {
+		for range time.Tick(traySliderRefreshInterval) {
+			ts.refresh()
+		}
+	}()
+
+	return ts
+}
+
+// refresh brings the slider items up to date with the mapping and where the sliders are
+func (ts *traySliders) refresh() {
+	mapping := map[int][]string{}
+	ts.deej.config.SliderMapping.iterate(func(sliderID int, targets []string) {
+		mapping[sliderID] = targets
+	})
+
+	sliderIDs := make([]int, 0, len(mapping))
+	for sliderID := range mapping {
+		sliderIDs = append(sliderIDs, sliderID)
+	}
+
+	sort.Ints(sliderIDs)
+
+	readouts := ts.deej.sessions.sliderReadouts(func(sliderID int) bool {
+		_, ok := mapping[sliderID]
+		return ok
+	})
+
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+
+	ts.sliderIDs = sliderIDs
+
+	for idx, item := range ts.sliderItems {
+		title := ""
+
+		if idx < len(sliderIDs) {
+			sliderID := sliderIDs[idx]
+
+			percent := "-"
+			if readout, ok := readouts[sliderID]; ok {
+				percent = readout.String()
+			}
+
+			title = fmt.Sprintf("Slider %d: %s - %s", sliderID, traySliderTargets(mapping[sliderID]), percent)
+		}
+
+		if title == ts.sliderTitles[idx] {
+			continue
+		}
+
+		ts.sliderTitles[idx] = title
+
+		if title == "" {
+			item.Hide()
+			continue
+		}
+
+		item.SetTitle(title)
+		item.Show()
+	}
+}
+
+func (ts *traySliders) watchSliderItem(item *systray.MenuItem, idx int) {
+	go func() {
+		for range item.ClickedCh {
+			ts.lock.Lock()
+
+			if idx < len(ts.sliderIDs) {
+				ts.logger.Infow("Slider menu item clicked, listing sessions to map it to", "sliderID", ts.sliderIDs[idx])
+				ts.startRemapping(ts.sliderIDs[idx])
+			}
+
+			ts.lock.Unlock()
+		}
+	}()
+}
+
+func (ts *traySliders) watchSessionItem(item *systray.MenuItem, idx int) {
+	go func() {
+		for range item.ClickedCh {
+			ts.lock.Lock()
+
+			if ts.remapping < 0 || idx >= len(ts.sessionKeys) {
+				ts.lock.Unlock()
+				continue
+			}
+
+			sliderID, key := ts.remapping, ts.sessionKeys[idx]
+			ts.stopRemapping()
+			ts.lock.Unlock()
+
+			ts.logger.Infow("Session menu item clicked, remapping slider", "sliderID", sliderID, "target", key)
+
+			// remapping notifies config consumers (including the tray's own loop), so it can't hold the lock
+			ts.deej.config.RemapSlider(sliderID, []string{key})
+			ts.deej.notifier.Notify("Slider remapped",
+				fmt.Sprintf("Slider %d now controls %s, until the config changes.", sliderID, key))
+		}
+	}()
+}
+
+// startRemapping lists the running audio sessions under the menu's sliders, to pick what the slider
+// should control. assumes the lock is held
+func (ts *traySliders) startRemapping(sliderID int) {
+	ts.remapping = sliderID
+	ts.sessionKeys = ts.deej.sessions.sessionKeys()
+
+	targets, _ := ts.deej.config.SliderMapping.get(sliderID)
+
+	ts.remapHeader.SetTitle(fmt.Sprintf("Map slider %d to:", sliderID))
+	ts.remapHeader.Show()
+
+	for idx, item := range ts.sessionItems {
+		if idx >= len(ts.sessionKeys) {
+			item.Hide()
+			continue
+		}
+
+		item.SetTitle(ts.sessionKeys[idx])
+
+		item.Uncheck()
+		for _, target := range targets {
+			if strings.EqualFold(target, ts.sessionKeys[idx]) {
+				item.Check()
+			}
+		}
+
+		item.Show()
+	}
+
+	ts.cancelRemap.Show()
+}
+
+// stopRemapping hides the session items again. assumes the lock is held
+func (ts *traySliders) stopRemapping() {
+	ts.remapping = -1
+
+	ts.remapHeader.Hide()
+	ts.cancelRemap.Hide()
+
+	for _, item := range ts.sessionItems {
+		item.Hide()
+	}
+}
+
+// sessionKeys returns the keys of every audio session currently known, sorted
+func (m *sessionMap) sessionKeys() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	keys := make([]string, 0, len(m.m))
+	for key := range m.m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// traySliderTargets lists a slider's targets, cut short if they'd make the menu too wide
+func traySliderTargets(targets []string) string {
+	if len(targets) == 0 {
+		return "nothing"
+	}
+
+	listed := strings.Join(targets, ", ")
+	if runes := []rune(listed); len(runes) > maxTrayTargetsLength {
+		listed = string(runes[:maxTrayTargetsLength-3]) + "..."
+	}
+
+	return listed
+}
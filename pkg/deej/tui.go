@@ -0,0 +1,473 @@
+package deej
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.uber.org/zap"
+)
+
+const (
+	tuiRefreshInterval = 250 * time.Millisecond
+
+	// how many log lines the terminal UI keeps around, of which it shows as many as fit
+	maxTUILogLines = 200
+
+	// the terminal's size when it can't be asked (see tui_linux.go), or $COLUMNS and $LINES don't say
+	defaultTUIWidth  = 80
+	defaultTUIHeight = 24
+
+	tuiSliderBarWidth = 20
+	tuiMeterBarWidth  = 8
+
+	// wide enough for a slider whose apps aren't where its fader is, e.g. "100% → 64%"
+	tuiReadoutWidth = 10
+
+	// zap logs into the terminal UI through a sink registered under this scheme
+	tuiLogSinkScheme = "deej-tui"
+	tuiLogSinkURL    = tuiLogSinkScheme + ":"
+
+	// switch to the terminal's alternate screen and hide the cursor, and back again
+	tuiEnterScreen = "\x1b[?1049h\x1b[?25l"
+	tuiLeaveScreen = "\x1b[?25h\x1b[?1049l"
+)
+
+// tuiLogBuffer holds the latest log lines for the terminal UI. until the UI is showing (and once it's gone again), lines
+// are passed through to stderr as usual, so that failing to start isn't silent
+type tuiLogBuffer struct {
+	lock      sync.Mutex
+	lines     []string
+	capturing bool
+	partial   string
+}
+
+var (
+	tuiLogs        = &tuiLogBuffer{}
+	tuiLogSinkOnce sync.Once
+	tuiLogSinkErr  error
+)
+
+func registerTUILogSink() error {
+	tuiLogSinkOnce.Do(func() {
+		tuiLogSinkErr = zap.RegisterSink(tuiLogSinkScheme, func(*url.URL) (zap.Sink, error) {
+			return tuiLogs, nil
+		})
+	})
+
+	return tuiLogSinkErr
+}
+
+func (b *tuiLogBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if !b.capturing {
+		return os.Stderr.Write(p)
+	}
+
+	text := b.partial + string(p)
+	lines := strings.Split(text, "\n")
+
+	// whatever's after the last newline is finished off by the next write
+	b.partial = lines[len(lines)-1]
+
+	for _, line := range lines[:len(lines)-1] {
+		b.lines = append(b.lines, strings.Replace(line, "\t", "  ", -1))
+	}
+
+	if len(b.lines) > maxTUILogLines {
+		b.lines = b.lines[len(b.lines)-maxTUILogLines:]
+	}
+
+	return len(p), nil
+}
+
+func (b *tuiLogBuffer) Sync() error {
+	return nil
+}
+
+func (b *tuiLogBuffer) Close() error {
+	return nil
+}
+
+func (b *tuiLogBuffer) setCapturing(capturing bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.capturing = capturing
+}
+
+// last returns up to the given number of the latest log lines
+func (b *tuiLogBuffer) last(count int) []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if count <= 0 {
+		return nil
+	}
+
+	if count > len(b.lines) {
+		count = len(b.lines)
+	}
+
+	return append([]string{}, b.lines[len(b.lines)-count:]...)
+}
+
+// terminalUI draws the sliders, their audio levels, the connection and the latest logs in the terminal deej was
+// started from with --tui, and takes keys for what you'd otherwise reach for the tray menu for. it's meant for
+// headless setups run over SSH, so it needs nothing but a terminal that understands the usual ANSI escapes
+type terminalUI struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	in  *os.File
+	out io.Writer
+
+	lock        sync.Mutex
+	running     bool
+	stopChannel chan bool
+
+	// puts the terminal back how it was, if keys could be read without waiting for Enter
+	restoreTerminal func()
+
+	meter *AudioMeterService
+}
+
+func newTerminalUI(deej *Deej, logger *zap.SugaredLogger) *terminalUI {
+	return &terminalUI{
+		deej:   deej,
+		logger: logger.Named("tui"),
+		in:     os.Stdin,
+		out:    os.Stdout,
+	}
+}
+
+// Start takes over the terminal, until Stop
+func (tui *terminalUI) Start() {
+	tui.lock.Lock()
+	defer tui.lock.Unlock()
+
+	if tui.running {
+		return
+	}
+
+	restore, err := enterKeyMode(tui.in)
+	if err != nil {
+		tui.logger.Infow("Can't read keys as they're pressed, press Enter after each one", "error", err)
+	}
+
+	tui.restoreTerminal = restore
+
+	if tui.meter == nil && audioMeterSupported {
+		tui.meter = NewAudioMeterService(tui.logger)
+	}
+
+	tui.running = true
+	tui.stopChannel = make(chan bool)
+
+	tuiLogs.setCapturing(true)
+	fmt.Fprint(tui.out, tuiEnterScreen)
+
+	go tui.drawLoop(tui.stopChannel)
+	go tui.readKeys()
+
+	tui.logger.Debug("Terminal UI started")
+}
+
+// Stop gives the terminal back, with logs going to it as usual again
+func (tui *terminalUI) Stop() {
+	tui.lock.Lock()
+	defer tui.lock.Unlock()
+
+	if !tui.running {
+		return
+	}
+
+	tui.running = false
+	close(tui.stopChannel)
+
+	fmt.Fprint(tui.out, tuiLeaveScreen)
+
+	if tui.restoreTerminal != nil {
+		tui.restoreTerminal()
+		tui.restoreTerminal = nil
+	}
+
+	tuiLogs.setCapturing(false)
+
+	tui.logger.Debug("Terminal UI stopped")
+}
+
+func (tui *terminalUI) drawLoop(stopChannel chan bool) {
+	ticker := time.NewTicker(tuiRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		tui.draw()
+
+		select {
+		case <-stopChannel:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (tui *terminalUI) draw() {
+	width, height := tuiSize(tui.in)
+
+	lines := tui.statusLines()
+	footer := tui.footer()
+
+	// the logs get whatever room's left, after a blank line and a heading
+	logRoom := height - len(lines) - 3
+	if logRoom > 0 {
+		lines = append(lines, "", "Logs:")
+		lines = append(lines, tuiLogs.last(logRoom-1)...)
+	}
+
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+
+	lines = append(lines, footer)
+
+	var screen strings.Builder
+	screen.WriteString("\x1b[H")
+
+	for idx, line := range lines {
+		screen.WriteString(tuiFit(line, width))
+		screen.WriteString("\x1b[K")
+
+		if idx < len(lines)-1 {
+			screen.WriteString("\r\n")
+		}
+	}
+
+	tui.lock.Lock()
+	if tui.running {
+		io.WriteString(tui.out, screen.String())
+	}
+	tui.lock.Unlock()
+}
+
+// statusLines sums up the connection and profile, and lists every mapped slider with its audio level
+func (tui *terminalUI) statusLines() []string {
+	config := tui.deej.config
+
+	lines := []string{
+		fmt.Sprintf("deej - %s | profile: %s", tui.deej.link.current(), config.ActiveProfile),
+		"",
+	}
+
+	mapping := map[int][]string{}
+	config.SliderMapping.iterate(func(sliderID int, targets []string) {
+		mapping[sliderID] = targets
+	})
+
+	sliderIDs := make([]int, 0, len(mapping))
+	for sliderID := range mapping {
+		sliderIDs = append(sliderIDs, sliderID)
+	}
+
+	sort.Ints(sliderIDs)
+
+	// without a meter there's no level column at all
+	peakLevels, err := tui.meter.GetAudioPeakLevels()
+	if err != nil {
+		peakLevels = nil
+	}
+
+	readouts := tui.deej.sessions.sliderReadouts(func(sliderID int) bool {
+		_, ok := mapping[sliderID]
+		return ok
+	})
+
+	for _, sliderID := range sliderIDs {
+		bar, percent := strings.Repeat(" ", tuiSliderBarWidth), "-"
+
+		// the bar follows the fader, and the percentage says where that put its apps if it's somewhere else
+		if readout, ok := readouts[sliderID]; ok {
+			bar = tuiBar(float32(readout.position)/100, tuiSliderBarWidth, '#', '-')
+			percent = readout.String()
+		}
+
+		// padded by hand, as fmt's widths count the arrow's bytes rather than the columns it takes up
+		if padding := tuiReadoutWidth - utf8.RuneCountInString(percent); padding > 0 {
+			percent = strings.Repeat(" ", padding) + percent
+		}
+
+		line := fmt.Sprintf("Slider %-2d [%s] %s", sliderID, bar, percent)
+
+		if peakLevels != nil {
+			peak := float32(0)
+			for _, target := range tui.deej.sessions.expandIdentityTargets(mapping[sliderID]) {
+				for _, level := range matchingPeakLevels(target, peakLevels) {
+					if level > peak {
+						peak = level
+					}
+				}
+			}
+
+			line += fmt.Sprintf("  %s", tuiBar(peak, tuiMeterBarWidth, '|', ' '))
+		}
+
+		lines = append(lines, fmt.Sprintf("%s  %s", line, strings.Join(mapping[sliderID], ", ")))
+	}
+
+	if len(sliderIDs) == 0 {
+		lines = append(lines, "No sliders mapped")
+	}
+
+	return lines
+}
+
+func (tui *terminalUI) footer() string {
+	footer := "r reconnect  p next profile  1-9 pick profile  q quit"
+
+	tui.lock.Lock()
+	defer tui.lock.Unlock()
+
+	if tui.restoreTerminal == nil {
+		footer += "  (then Enter)"
+	}
+
+	return footer
+}
+
+// readKeys handles keys until stdin closes. in key mode they come one at a time, otherwise a line at a time
+func (tui *terminalUI) readKeys() {
+	buffer := make([]byte, 1)
+
+	for {
+		if _, err := tui.in.Read(buffer); err != nil {
+			tui.logger.Debugw("Stopped reading keys", "error", err)
+			return
+		}
+
+		tui.lock.Lock()
+		running := tui.running
+		tui.lock.Unlock()
+
+		if !running {
+			return
+		}
+
+		tui.handleKey(buffer[0])
+	}
+}
+
+func (tui *terminalUI) handleKey(key byte) {
+	switch {
+	case key == 'q' || key == 'Q':
+		tui.logger.Info("Quit from the terminal UI")
+		tui.deej.signalStop()
+
+	case key == 'r' || key == 'R':
+		tui.reconnect()
+
+	case key == 'p' || key == 'P':
+		tui.switchProfile(-1)
+
+	case key >= '1' && key <= '9':
+		tui.switchProfile(int(key - '1'))
+	}
+}
+
+// reconnect drops the connection for the reconnect loop to make again, or has the loop look right away if there's
+// no connection to drop
+func (tui *terminalUI) reconnect() {
+	sio := tui.deej.serial
+
+	if sio.isConnected() {
+		tui.logger.Info("Reconnecting to the device, as asked from the terminal UI")
+		sio.dropConnection()
+
+		return
+	}
+
+	tui.logger.Info("Looking for the device, as asked from the terminal UI")
+	sio.deviceArrived()
+}
+
+// switchProfile switches to the profile at the given index (by name), or the one after the active one if it's -1
+func (tui *terminalUI) switchProfile(index int) {
+	config := tui.deej.config
+	names := config.ProfileNames()
+
+	if len(names) == 0 {
+		tui.logger.Info("No profiles to switch between")
+		return
+	}
+
+	if index < 0 {
+		index = 0
+		for idx, name := range names {
+			if name == config.ActiveProfile {
+				index = (idx + 1) % len(names)
+			}
+		}
+	}
+
+	if index >= len(names) {
+		tui.logger.Infow("No profile with that number", "number", index+1, "profiles", len(names))
+		return
+	}
+
+	if err := config.SwitchProfile(names[index]); err != nil {
+		tui.logger.Warnw("Failed to switch profile", "profile", names[index], "error", err)
+	}
+}
+
+// tuiSize returns the terminal's size, going by $COLUMNS and $LINES where it can't be asked
+func tuiSize(terminal *os.File) (int, int) {
+	if width, height, ok := terminalSize(terminal); ok && width > 0 && height > 0 {
+		return width, height
+	}
+
+	width, err := strconv.Atoi(os.Getenv("COLUMNS"))
+	if err != nil || width <= 0 {
+		width = defaultTUIWidth
+	}
+
+	height, err := strconv.Atoi(os.Getenv("LINES"))
+	if err != nil || height <= 0 {
+		height = defaultTUIHeight
+	}
+
+	return width, height
+}
+
+// tuiBar draws a value (0-1) as a bar of the given width
+func tuiBar(value float32, width int, full rune, empty rune) string {
+	if value < 0 {
+		value = 0
+	} else if value > 1 {
+		value = 1
+	}
+
+	filled := int(value*float32(width) + 0.5)
+
+	return strings.Repeat(string(full), filled) + strings.Repeat(string(empty), width-filled)
+}
+
+// tuiFit cuts a line down to the terminal's width, so that it doesn't wrap and push the rest down
+func tuiFit(line string, width int) string {
+	if runes := []rune(line); len(runes) > width {
+		return string(runes[:width])
+	}
+
+	return line
+}
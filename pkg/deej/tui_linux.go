@@ -0,0 +1,55 @@
+package deej
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// see tui_other.go
+const tuiKeyModeSupported = true
+
+// keys reach the terminal UI as they're pressed, by turning off the terminal's line editing and echo. signals
+// stay on, so Ctrl+C still stops deej (and gives the terminal back)
+func enterKeyMode(terminal *os.File) (func(), error) {
+	var original syscall.Termios
+	if err := termiosIoctl(terminal, syscall.TCGETS, &original); err != nil {
+		return nil, fmt.Errorf("get terminal attributes: %w", err)
+	}
+
+	keys := original
+	keys.Lflag &^= syscall.ICANON | syscall.ECHO
+	keys.Cc[syscall.VMIN] = 1
+	keys.Cc[syscall.VTIME] = 0
+
+	if err := termiosIoctl(terminal, syscall.TCSETS, &keys); err != nil {
+		return nil, fmt.Errorf("set terminal attributes: %w", err)
+	}
+
+	return func() {
+		termiosIoctl(terminal, syscall.TCSETS, &original)
+	}, nil
+}
+
+func terminalSize(terminal *os.File) (int, int, bool) {
+	var size struct {
+		rows, columns, xPixels, yPixels uint16
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, terminal.Fd(), syscall.TIOCGWINSZ, uintptr(unsafe.Pointer(&size)))
+	if errno != 0 {
+		return 0, 0, false
+	}
+
+	return int(size.columns), int(size.rows), true
+}
+
+func termiosIoctl(terminal *os.File, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, terminal.Fd(), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
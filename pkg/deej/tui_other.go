@@ -0,0 +1,22 @@
+//go:build !linux
+// +build !linux
+
+package deej
+
+import (
+	"os"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// only linux (where headless setups run over SSH tend to be) gets keys as they're pressed and the terminal's real
+// size. elsewhere the terminal UI takes a key at a time followed by Enter, and goes by $COLUMNS and $LINES
+const tuiKeyModeSupported = false
+
+func enterKeyMode(terminal *os.File) (func(), error) {
+	return nil, util.ErrNotSupported
+}
+
+func terminalSize(terminal *os.File) (int, int, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,8 @@
+//go:build windows && go1.15
+// +build windows,go1.15
+
+package deej
+
+// windows has no timezone database of its own, and only machines with Go installed have one lying around - this
+// builds Go's into deej, so that automation's IANA timezones ("Europe/London") load everywhere
+import _ "time/tzdata"
@@ -0,0 +1,89 @@
+package deej
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// unmappedGroup refines what deej.unmapped grabs on a particular slider
+type unmappedGroup struct {
+
+	// apps (names, patterns or identity targets) to leave alone even though no slider is mapped to them
+	Exclude []string
+
+	// whether master, system, mic and device sessions stay out of the group. when false, any of them
+	// that no slider is mapped to by name joins it (e.g. system sounds, which are rarely mapped on their own)
+	ExcludeSpecial bool
+}
+
+// what deej.unmapped grabs on sliders without slider_unmapped settings (and outside of sliders, e.g. in scenes)
+var defaultUnmappedGroup = unmappedGroup{ExcludeSpecial: true}
+
+func unmappedGroupFromConfig(fields map[string]interface{}) (unmappedGroup, error) {
+	group := defaultUnmappedGroup
+
+	if value, ok := fields["exclude"]; ok {
+		items, ok := value.([]interface{})
+		if !ok {
+			return group, fmt.Errorf("exclude must be a list of apps, got %v", value)
+		}
+
+		for _, item := range items {
+			group.Exclude = append(group.Exclude, normalizeTarget(fmt.Sprint(item)))
+		}
+	}
+
+	if value, ok := fields["exclude_special"]; ok {
+		excludeSpecial, err := strconv.ParseBool(fmt.Sprint(value))
+		if err != nil {
+			return group, fmt.Errorf("exclude_special must be true or false, got %v", value)
+		}
+
+		group.ExcludeSpecial = excludeSpecial
+	}
+
+	return group, nil
+}
+
+// excludes reports whether the given session is kept out of the group by one of its exclusions
+func (g unmappedGroup) excludes(session Session) bool {
+	for _, target := range g.Exclude {
+		if targetMatchesName(target, session.Key()) || identityTargetMatches(target, session) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isUnmappedTarget(target string) bool {
+	return strings.ToLower(target) == specialTargetTransformPrefix+specialTargetAllUnmapped
+}
+
+// unmappedGroup returns the given slider's deej.unmapped settings
+func (cc *CanonicalConfig) unmappedGroup(sliderIdx int) unmappedGroup {
+	if group, ok := cc.SliderUnmapped[sliderIdx]; ok {
+		return group
+	}
+
+	return defaultUnmappedGroup
+}
+
+// unmappedGroupSessions returns every session deej.unmapped refers to, as refined by the given group
+func (m *sessionMap) unmappedGroupSessions(group unmappedGroup) []Session {
+	candidates := m.unmappedSessions
+	if !group.ExcludeSpecial {
+		candidates = append(append([]Session{}, m.unmappedSessions...), m.unmappedSpecialSessions...)
+	}
+
+	sessions := []Session{}
+
+	for _, session := range candidates {
+		if !group.excludes(session) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	return sessions
+}
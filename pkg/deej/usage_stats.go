@@ -0,0 +1,314 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	apiPathUsage = "/usage"
+
+	// how often app volumes are sampled. gaps longer than a couple of these (like the machine sleeping)
+	// only count as one sample
+	usageSampleInterval = time.Minute
+	usageMaxSampleGap   = 2 * usageSampleInterval
+
+	// volumes this close to an app's peak count as time spent at it
+	usagePeakTolerance = 0.005
+
+	// how many apps the weekly summary mentions, loudest on average first
+	usageSummaryApps = 3
+)
+
+// usageStatsConfig holds the user's usage statistics settings
+type usageStatsConfig struct {
+	Enabled bool
+
+	// sum up the past week in a notification when a new one starts
+	WeeklySummary bool
+}
+
+// appUsage is how loud an app was over a week, weighted by how long it was at each volume. only time the app
+// had an audio session and wasn't muted counts
+type appUsage struct {
+	Seconds       float64 `json:"seconds"`
+	VolumeSeconds float64 `json:"volume_seconds"`
+
+	Peak          float32 `json:"peak"`
+	SecondsAtPeak float64 `json:"seconds_at_peak"`
+}
+
+func (au appUsage) average() float64 {
+	if au.Seconds == 0 {
+		return 0
+	}
+
+	return au.VolumeSeconds / au.Seconds
+}
+
+// usageWeek is every app's usage since the week started (Monday, midnight)
+type usageWeek struct {
+	Start time.Time           `json:"start"`
+	Apps  map[string]appUsage `json:"apps"`
+}
+
+// summary sums up the week's loudest apps, like "spotify.exe averaged 64%, peaked at 100% for 2h"
+func (uw usageWeek) summary() string {
+	names := make([]string, 0, len(uw.Apps))
+	for name := range uw.Apps {
+		names = append(names, name)
+	}
+
+	sort.Slice(names, func(i, j int) bool {
+		return uw.Apps[names[i]].average() > uw.Apps[names[j]].average()
+	})
+
+	if len(names) > usageSummaryApps {
+		names = names[:usageSummaryApps]
+	}
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		usage := uw.Apps[name]
+		lines = append(lines, fmt.Sprintf("%s averaged %.0f%%, peaked at %.0f%% for %s",
+			name, usage.average()*100, usage.Peak*100, formatUsageDuration(usage.SecondsAtPeak)))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func formatUsageDuration(seconds float64) string {
+	duration := time.Duration(seconds) * time.Second
+	if duration < time.Hour {
+		return fmt.Sprintf("%dm", int(duration.Minutes()))
+	}
+
+	return fmt.Sprintf("%.0fh", duration.Hours())
+}
+
+// startOfWeek returns the Monday midnight (local time) the given time's week started at
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	year, month, day := t.AddDate(0, 0, -daysSinceMonday).Date()
+
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// usageTracker samples every app's volume to keep long-term usage statistics, for keeping an eye on hearing
+// health. the current week is kept in the state file, and summed up when the next one starts
+type usageTracker struct {
+	deej   *Deej
+	logger *zap.SugaredLogger
+
+	lock sync.Mutex
+
+	running    bool
+	lastSample time.Time
+
+	stopChannel chan bool
+}
+
+func newUsageTracker(deej *Deej, logger *zap.SugaredLogger) *usageTracker {
+	logger = logger.Named("usage")
+
+	ut := &usageTracker{
+		deej:        deej,
+		logger:      logger,
+		stopChannel: make(chan bool),
+	}
+
+	logger.Debug("Created usage tracker instance")
+
+	return ut
+}
+
+// Start begins sampling app volumes. it keeps running while disabled, to pick up a config change
+func (ut *usageTracker) Start() {
+	ut.lock.Lock()
+	defer ut.lock.Unlock()
+
+	if ut.running {
+		return
+	}
+
+	ut.running = true
+	ut.lastSample = time.Now()
+
+	go ut.pollLoop()
+}
+
+// Stop ends sampling app volumes
+func (ut *usageTracker) Stop() {
+	ut.lock.Lock()
+
+	if !ut.running {
+		ut.lock.Unlock()
+		return
+	}
+
+	ut.running = false
+	ut.lock.Unlock()
+
+	ut.stopChannel <- true
+}
+
+func (ut *usageTracker) pollLoop() {
+	for {
+		select {
+		case <-ut.stopChannel:
+			return
+		case <-time.After(usageSampleInterval):
+			ut.sample(time.Now())
+		}
+	}
+}
+
+func (ut *usageTracker) sample(now time.Time) {
+	elapsed := now.Sub(ut.lastSample)
+	ut.lastSample = now
+
+	if !ut.deej.config.UsageStats.Enabled {
+		return
+	}
+
+	if elapsed > usageMaxSampleGap {
+		elapsed = usageSampleInterval
+	}
+
+	volumes := ut.deej.sessions.unmutedVolumes()
+	seconds := elapsed.Seconds()
+
+	var finished *usageWeek
+
+	ut.deej.state.update(func(state *persistedState) {
+		week := &state.Usage
+
+		if weekStart := startOfWeek(now); !week.Start.Equal(weekStart) {
+			if len(week.Apps) > 0 {
+				previous := *week
+				finished = &previous
+			}
+
+			*week = usageWeek{Start: weekStart, Apps: map[string]appUsage{}}
+		}
+
+		for name, volume := range volumes {
+			usage := week.Apps[name]
+
+			usage.Seconds += seconds
+			usage.VolumeSeconds += float64(volume) * seconds
+
+			if volume > usage.Peak+usagePeakTolerance {
+				usage.Peak = volume
+				usage.SecondsAtPeak = 0
+			}
+
+			if math.Abs(float64(volume-usage.Peak)) <= usagePeakTolerance {
+				usage.SecondsAtPeak += seconds
+			}
+
+			week.Apps[name] = usage
+		}
+	})
+
+	if finished == nil {
+		return
+	}
+
+	ut.logger.Infow("Usage week ended", "start", finished.Start, "apps", len(finished.Apps))
+
+	if ut.deej.config.UsageStats.WeeklySummary {
+		ut.deej.notifier.Notify("Your week in volume", finished.summary())
+	}
+}
+
+// current returns this week's usage so far
+func (ut *usageTracker) current() usageWeek {
+	week := usageWeek{Apps: map[string]appUsage{}}
+
+	ut.deej.state.view(func(state *persistedState) {
+		week.Start = state.Usage.Start
+		for name, usage := range state.Usage.Apps {
+			week.Apps[name] = usage
+		}
+	})
+
+	return week
+}
+
+// unmutedVolumes returns the volume of every app (and master) that has an audio session and isn't muted.
+// apps with several sessions go by the loudest
+func (m *sessionMap) unmutedVolumes() map[string]float32 {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	volumes := map[string]float32{}
+
+	for key, sessions := range m.m {
+		if !isAppSessionKey(key) && key != masterSessionName {
+			continue
+		}
+
+		for _, session := range sessions {
+			if session.GetMute() {
+				continue
+			}
+
+			if volume := session.GetVolume(); volume >= volumes[key] {
+				volumes[key] = volume
+			}
+		}
+	}
+
+	return volumes
+}
+
+// handleUsage returns this week's usage statistics as JSON, by app
+func (as *apiServer) handleUsage(writer http.ResponseWriter, request *http.Request) {
+	if request.Method != http.MethodGet {
+		http.Error(writer, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	type appSummary struct {
+		Hours         float64 `json:"hours"`
+		AverageVolume float64 `json:"averageVolume"`
+		PeakVolume    float32 `json:"peakVolume"`
+		HoursAtPeak   float64 `json:"hoursAtPeak"`
+	}
+
+	week := as.deej.usage.current()
+
+	response := struct {
+		Enabled bool                  `json:"enabled"`
+		Start   time.Time             `json:"start"`
+		Apps    map[string]appSummary `json:"apps"`
+	}{
+		Enabled: as.deej.config.UsageStats.Enabled,
+		Start:   week.Start,
+		Apps:    map[string]appSummary{},
+	}
+
+	for name, usage := range week.Apps {
+		response.Apps[name] = appSummary{
+			Hours:         usage.Seconds / 3600,
+			AverageVolume: usage.average(),
+			PeakVolume:    usage.Peak,
+			HoursAtPeak:   usage.SecondsAtPeak / 3600,
+		}
+	}
+
+	writer.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		as.logger.Debugw("Failed to write usage response", "error", err)
+	}
+}
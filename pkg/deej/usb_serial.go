@@ -0,0 +1,79 @@
+//go:build windows || linux
+// +build windows linux
+
+package deej
+
+import (
+	"fmt"
+	"strings"
+
+	"go.bug.st/serial/enumerator"
+	"go.uber.org/zap"
+)
+
+// findPortByUSBSerialNumber returns the port of the USB serial device with the given serial number, if there is one.
+// boards with a native USB chip (like the Pro Micro) or an FTDI one have a unique serial number, most CH340 clones don't
+func findPortByUSBSerialNumber(logger *zap.SugaredLogger, serialNumber string) string {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		logger.Debugw("Failed to get USB port details", "error", err)
+		return ""
+	}
+
+	for _, port := range ports {
+		if port.IsUSB && port.SerialNumber != "" && strings.EqualFold(port.SerialNumber, serialNumber) {
+			return port.Name
+		}
+	}
+
+	return ""
+}
+
+// findPortByUSB returns the port of the first USB serial device with the given vendor and product IDs ("vid:pid")
+// and serial number, leaving out whichever is empty
+func findPortByUSB(logger *zap.SugaredLogger, usbIDs string, serialNumber string) string {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		logger.Debugw("Failed to get USB port details", "error", err)
+		return ""
+	}
+
+	for _, port := range ports {
+		if !port.IsUSB {
+			continue
+		}
+
+		if usbIDs != "" && !strings.EqualFold(port.VID+":"+port.PID, usbIDs) {
+			continue
+		}
+
+		if serialNumber != "" && !strings.EqualFold(port.SerialNumber, serialNumber) {
+			continue
+		}
+
+		return port.Name
+	}
+
+	return ""
+}
+
+// describeSerialPorts lists every serial port with whatever's known about the USB device behind it, for --diagnose
+func describeSerialPorts() ([]string, error) {
+	ports, err := enumerator.GetDetailedPortsList()
+	if err != nil {
+		return nil, fmt.Errorf("get port details: %w", err)
+	}
+
+	descriptions := []string{}
+	for _, port := range ports {
+		if !port.IsUSB {
+			descriptions = append(descriptions, port.Name)
+			continue
+		}
+
+		descriptions = append(descriptions, fmt.Sprintf("%s usb=%s:%s serial=%q product=%q",
+			port.Name, port.VID, port.PID, port.SerialNumber, port.Product))
+	}
+
+	return descriptions, nil
+}
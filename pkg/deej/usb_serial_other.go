@@ -0,0 +1,31 @@
+//go:build !windows && !linux
+// +build !windows,!linux
+
+package deej
+
+import (
+	"fmt"
+
+	"go.bug.st/serial"
+	"go.uber.org/zap"
+)
+
+// USB serial numbers aren't looked up here, so devices can only be found by the ID their firmware reports
+func findPortByUSBSerialNumber(logger *zap.SugaredLogger, serialNumber string) string {
+	return ""
+}
+
+// the same goes for USB IDs
+func findPortByUSB(logger *zap.SugaredLogger, usbIDs string, serialNumber string) string {
+	return ""
+}
+
+// and ports are listed by name alone
+func describeSerialPorts() ([]string, error) {
+	ports, err := serial.GetPortsList()
+	if err != nil {
+		return nil, fmt.Errorf("get ports: %w", err)
+	}
+
+	return ports, nil
+}
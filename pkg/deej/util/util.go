@@ -1,17 +1,22 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"math"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"syscall"
 
 	"go.uber.org/zap"
 )
 
+// ErrNotSupported is returned by anything that isn't implemented on the OS deej was built for
+var ErrNotSupported = errors.New("not supported on " + runtime.GOOS)
+
 // EnsureDirExists creates the given directory path if it doesn't already exist
 func EnsureDirExists(path string) error {
 	if err := os.MkdirAll(path, os.ModePerm); err != nil {
@@ -31,11 +36,31 @@ func FileExists(filename string) bool {
 	return !info.IsDir()
 }
 
+// MoveToExecutableDir makes the directory deej's executable is in the working directory, for when something
+// else (a service manager, a login) started it elsewhere and the config and logs are expected next to it
+func MoveToExecutableDir() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("get executable path: %w", err)
+	}
+
+	if err := os.Chdir(filepath.Dir(executable)); err != nil {
+		return fmt.Errorf("move to executable's directory: %w", err)
+	}
+
+	return nil
+}
+
 // Linux returns true if we're running on Linux
 func Linux() bool {
 	return runtime.GOOS == "linux"
 }
 
+// Darwin returns true if we're running on macOS
+func Darwin() bool {
+	return runtime.GOOS == "darwin"
+}
+
 // SetupCloseHandler creates a 'listener' on a new goroutine which will notify the
 // program if it receives an interrupt from the OS
 func SetupCloseHandler() chan os.Signal {
@@ -52,12 +77,48 @@ func GetCurrentWindowProcessNames() ([]string, error) {
 	return getCurrentWindowProcessNames()
 }
 
+// ForegroundWindow describes the window currently in focus
+type ForegroundWindow struct {
+
+	// the window's process name, along with those of its child windows (see GetCurrentWindowProcessNames)
+	ProcessNames []string
+
+	// 1-based, counting monitors left to right. 0 if unknown
+	Monitor int
+}
+
+// GetForegroundWindow returns the window currently in focus and the monitor it's on. Unlike
+// GetCurrentWindowProcessNames, this is never cached. This is currently only implemented for Windows
+func GetForegroundWindow() (ForegroundWindow, error) {
+	return getForegroundWindow()
+}
+
+// WatchForegroundWindow calls onChange (from another goroutine) whenever a different window comes into focus,
+// until the returned stop function is called. Only one watcher can be active at a time.
+// This is currently only implemented for Windows
+func WatchForegroundWindow(onChange func()) (func(), error) {
+	return watchForegroundWindow(onChange)
+}
+
+// GetProcessWindowTitles returns the titles of the given process's visible top-level windows. Processes
+// without any (like a browser's audio process) are looked up through their parents of the same executable.
+// This is currently only implemented for Windows
+func GetProcessWindowTitles(pid uint32) ([]string, error) {
+	return getProcessWindowTitles(pid)
+}
+
+// GetProcessProductName returns the product name from the given process's executable metadata.
+// This is currently only implemented for Windows
+func GetProcessProductName(pid uint32) (string, error) {
+	return getProcessProductName(pid)
+}
+
 // OpenExternal spawns a detached window with the provided command and argument
 func OpenExternal(logger *zap.SugaredLogger, cmd string, arg string) error {
 
-	// use cmd for windows, bash for linux
+	// use cmd for windows, bash for linux and macOS
 	execCommandArgs := []string{"cmd.exe", "/C", "start", "/b", cmd, arg}
-	if Linux() {
+	if Linux() || Darwin() {
 		execCommandArgs = []string{"/bin/bash", "-c", fmt.Sprintf("%s %s", cmd, arg)}
 	}
 
@@ -78,7 +139,12 @@ func OpenExternal(logger *zap.SugaredLogger, cmd string, arg string) error {
 // NormalizeScalar "trims" the given float32 to 2 points of precision (e.g. 0.15442 -> 0.15)
 // This is used both for windows core audio volume levels and for cleaning up slider level values from serial
 func NormalizeScalar(v float32) float32 {
-	return float32(math.Floor(float64(v)*100) / 100.0)
+
+	// float32 can't hold most round percentages exactly (0.9 is really 0.89999998), so give them a nudge
+	// before flooring - otherwise they'd come out a percent short, and lose another one every time
+	const floatRoundingSlack = 0.00001
+
+	return float32(math.Floor(float64(v)*100+floatRoundingSlack) / 100.0)
 }
 
 // SignificantlyDifferent returns true if there's a significant enough volume difference between two given values
@@ -1,9 +0,0 @@
-package util
-
-import (
-	"errors"
-)
-
-func getCurrentWindowProcessNames() ([]string, error) {
-	return nil, errors.New("Not implemented")
-}
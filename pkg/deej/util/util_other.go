@@ -0,0 +1,30 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+// nothing window-related is implemented outside of windows yet
+const (
+	ForegroundWindowSupported = false
+	WindowIdentitySupported   = false
+)
+
+func getCurrentWindowProcessNames() ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func getProcessWindowTitles(pid uint32) ([]string, error) {
+	return nil, ErrNotSupported
+}
+
+func getProcessProductName(pid uint32) (string, error) {
+	return "", ErrNotSupported
+}
+
+func getForegroundWindow() (ForegroundWindow, error) {
+	return ForegroundWindow{}, ErrNotSupported
+}
+
+func watchForegroundWindow(onChange func()) (func(), error) {
+	return nil, ErrNotSupported
+}
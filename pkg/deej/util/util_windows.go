@@ -1,7 +1,11 @@
 package util
 
 import (
+	"errors"
 	"fmt"
+	"runtime"
+	"sort"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -10,15 +14,81 @@ import (
 	"github.com/mitchellh/go-ps"
 )
 
+const (
+	// see util_other.go
+	ForegroundWindowSupported = true
+	WindowIdentitySupported   = true
+)
+
 const (
 	getCurrentWindowInternalCooldown = time.Millisecond * 350
+
+	// how many parent processes to look through for a process's windows
+	maxWindowTitleParentDepth = 3
+
+	processQueryLimitedInformation = 0x1000
+
+	// used when an executable's version info doesn't say which language its strings are in (US English, unicode)
+	defaultVersionInfoTranslation = "040904b0"
+
+	eventSystemForeground = 0x0003
+	winEventOutOfContext  = 0x0000
+	objectIDWindow        = 0
+	monitorDefaultToNull  = 0x00000000
+	wmQuit                = 0x0012
 )
 
 var (
 	lastGetCurrentWindowResult []string
 	lastGetCurrentWindowCall   = time.Now()
+
+	user32                   = syscall.NewLazyDLL("user32.dll")
+	procEnumWindows          = user32.NewProc("EnumWindows")
+	procGetWindowTextW       = user32.NewProc("GetWindowTextW")
+	procGetWindowTextLengthW = user32.NewProc("GetWindowTextLengthW")
+
+	kernel32                       = syscall.NewLazyDLL("kernel32.dll")
+	procQueryFullProcessImageNameW = kernel32.NewProc("QueryFullProcessImageNameW")
+	procGetCurrentThreadId         = kernel32.NewProc("GetCurrentThreadId")
+
+	procSetWinEventHook     = user32.NewProc("SetWinEventHook")
+	procUnhookWinEvent      = user32.NewProc("UnhookWinEvent")
+	procPostThreadMessageW  = user32.NewProc("PostThreadMessageW")
+	procMonitorFromWindow   = user32.NewProc("MonitorFromWindow")
+	procEnumDisplayMonitors = user32.NewProc("EnumDisplayMonitors")
+
+	version                     = syscall.NewLazyDLL("version.dll")
+	procGetFileVersionInfoSizeW = version.NewProc("GetFileVersionInfoSizeW")
+	procGetFileVersionInfoW     = version.NewProc("GetFileVersionInfoW")
+	procVerQueryValueW          = version.NewProc("VerQueryValueW")
+
+	// callbacks are never freed by windows, so there's just the one for every window title lookup
+	enumWindowTitlesCallback = syscall.NewCallback(collectWindowTitle)
+	enumMonitorsCallback     = syscall.NewCallback(collectMonitor)
+	foregroundEventCallback  = syscall.NewCallback(handleForegroundEvent)
+
+	// whoever's watching foreground window changes (only one watcher at a time, see WatchForegroundWindow)
+	foregroundChangeHandler     func()
+	foregroundChangeHandlerLock sync.Mutex
 )
 
+// monitorSearch is handed to collectMonitor through EnumDisplayMonitors
+type monitorSearch struct {
+	monitors []displayMonitor
+}
+
+type displayMonitor struct {
+	handle uintptr
+	left   int32
+	top    int32
+}
+
+// windowTitleSearch is handed to collectWindowTitle through EnumWindows
+type windowTitleSearch struct {
+	pid    uint32
+	titles []string
+}
+
 func getCurrentWindowProcessNames() ([]string, error) {
 
 	// apply an internal cooldown on this function to avoid calling windows API functions too frequently.
@@ -30,6 +100,30 @@ func getCurrentWindowProcessNames() ([]string, error) {
 
 	lastGetCurrentWindowCall = now
 
+	result, err := windowProcessNames(win.GetForegroundWindow())
+	if err != nil {
+		return nil, err
+	}
+
+	// cache & return whichever executable names we ended up with
+	lastGetCurrentWindowResult = result
+	return result, nil
+}
+
+func getForegroundWindow() (ForegroundWindow, error) {
+	hwnd := win.GetForegroundWindow()
+
+	processNames, err := windowProcessNames(hwnd)
+	if err != nil {
+		return ForegroundWindow{}, err
+	}
+
+	return ForegroundWindow{ProcessNames: processNames, Monitor: windowMonitor(hwnd)}, nil
+}
+
+// windowProcessNames returns the given window's process name, along with those of its child windows
+func windowProcessNames(hwnd win.HWND) ([]string, error) {
+
 	// the logic of this implementation is a bit convoluted because of the way UWP apps
 	// (also known as "modern win 10 apps" or "microsoft store apps") work.
 	// these are rendered in a parent container by the name of ApplicationFrameHost.exe.
@@ -66,8 +160,6 @@ func getCurrentWindowProcessNames() ([]string, error) {
 		return 1
 	}
 
-	// get the current foreground window
-	hwnd := win.GetForegroundWindow()
 	var ownerPID uint32
 
 	// get its PID and put it in our window info struct
@@ -90,7 +182,266 @@ func getCurrentWindowProcessNames() ([]string, error) {
 	// iterate its child windows, adding their names too
 	win.EnumChildWindows(hwnd, syscall.NewCallback(enumChildWindowsCallback), (uintptr)(unsafe.Pointer(&ownerPID)))
 
-	// cache & return whichever executable names we ended up with
-	lastGetCurrentWindowResult = result
 	return result, nil
 }
+
+func getProcessWindowTitles(pid uint32) ([]string, error) {
+	process, err := ps.FindProcess(int(pid))
+	if err != nil {
+		return nil, fmt.Errorf("find process for pid %d: %w", pid, err)
+	}
+
+	// walk up through parents running the same executable - browsers and electron apps play audio from a
+	// child process, while their windows belong to the main one. anything else (e.g. explorer) isn't the same app
+	for depth := 0; depth <= maxWindowTitleParentDepth && process != nil; depth++ {
+		search := windowTitleSearch{pid: uint32(process.Pid())}
+		procEnumWindows.Call(enumWindowTitlesCallback, uintptr(unsafe.Pointer(&search)))
+
+		if len(search.titles) > 0 {
+			return search.titles, nil
+		}
+
+		parent, err := ps.FindProcess(process.PPid())
+		if err != nil || parent == nil || parent.Executable() != process.Executable() {
+			break
+		}
+
+		process = parent
+	}
+
+	return nil, nil
+}
+
+// collectWindowTitle is called by EnumWindows for every top-level window, keeping the titles of visible
+// ones belonging to the searched process
+func collectWindowTitle(hwnd *uintptr, lParam *uintptr) uintptr {
+	search := (*windowTitleSearch)(unsafe.Pointer(lParam))
+	windowHWND := (win.HWND)(unsafe.Pointer(hwnd))
+
+	var windowPID uint32
+	win.GetWindowThreadProcessId(windowHWND, &windowPID)
+
+	if windowPID != search.pid || !win.IsWindowVisible(windowHWND) {
+		return 1
+	}
+
+	length, _, _ := procGetWindowTextLengthW.Call(uintptr(windowHWND))
+	if length == 0 {
+		return 1
+	}
+
+	buffer := make([]uint16, length+1)
+	procGetWindowTextW.Call(uintptr(windowHWND), uintptr(unsafe.Pointer(&buffer[0])), length+1)
+
+	if title := syscall.UTF16ToString(buffer); title != "" {
+		search.titles = append(search.titles, title)
+	}
+
+	// indicates to the system to keep iterating
+	return 1
+}
+
+func getProcessProductName(pid uint32) (string, error) {
+	path, err := getProcessImagePath(pid)
+	if err != nil {
+		return "", err
+	}
+
+	pathPtr, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return "", fmt.Errorf("convert executable path: %w", err)
+	}
+
+	infoSize, _, err := procGetFileVersionInfoSizeW.Call(uintptr(unsafe.Pointer(pathPtr)), 0)
+	if infoSize == 0 {
+		return "", fmt.Errorf("get version info size for %s: %w", path, err)
+	}
+
+	info := make([]byte, infoSize)
+	if ok, _, err := procGetFileVersionInfoW.Call(
+		uintptr(unsafe.Pointer(pathPtr)),
+		0,
+		infoSize,
+		uintptr(unsafe.Pointer(&info[0])),
+	); ok == 0 {
+		return "", fmt.Errorf("get version info for %s: %w", path, err)
+	}
+
+	// version strings are kept per language, find out which one this executable has
+	translation := defaultVersionInfoTranslation
+
+	var translationPtr *[2]uint16
+	var translationLength uint32
+
+	if queryVersionInfo(info, `\VarFileInfo\Translation`, unsafe.Pointer(&translationPtr), &translationLength) &&
+		translationLength >= 4 {
+
+		translation = fmt.Sprintf("%04x%04x", translationPtr[0], translationPtr[1])
+	}
+
+	var valuePtr *[1 << 16]uint16
+	var valueLength uint32
+
+	if !queryVersionInfo(info, fmt.Sprintf(`\StringFileInfo\%s\ProductName`, translation),
+		unsafe.Pointer(&valuePtr), &valueLength) || valueLength == 0 {
+
+		return "", nil
+	}
+
+	return syscall.UTF16ToString(valuePtr[:valueLength:valueLength]), nil
+}
+
+// queryVersionInfo points value at the given sub-block of version info, returning false if it has none
+func queryVersionInfo(info []byte, subBlock string, value unsafe.Pointer, length *uint32) bool {
+	subBlockPtr, err := syscall.UTF16PtrFromString(subBlock)
+	if err != nil {
+		return false
+	}
+
+	ok, _, _ := procVerQueryValueW.Call(
+		uintptr(unsafe.Pointer(&info[0])),
+		uintptr(unsafe.Pointer(subBlockPtr)),
+		uintptr(value),
+		uintptr(unsafe.Pointer(length)),
+	)
+
+	return ok != 0
+}
+
+func getProcessImagePath(pid uint32) (string, error) {
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, pid)
+	if err != nil {
+		return "", fmt.Errorf("open process %d: %w", pid, err)
+	}
+	defer syscall.CloseHandle(handle)
+
+	buffer := make([]uint16, syscall.MAX_LONG_PATH)
+	size := uint32(len(buffer))
+
+	if ok, _, err := procQueryFullProcessImageNameW.Call(
+		uintptr(handle),
+		0,
+		uintptr(unsafe.Pointer(&buffer[0])),
+		uintptr(unsafe.Pointer(&size)),
+	); ok == 0 {
+		return "", fmt.Errorf("get executable path for pid %d: %w", pid, err)
+	}
+
+	return syscall.UTF16ToString(buffer[:size]), nil
+}
+
+// windowMonitor returns the 1-based number of the monitor the given window is on, counting monitors
+// left to right (and top to bottom, for stacked ones), or 0 if it isn't on any
+func windowMonitor(hwnd win.HWND) int {
+	monitor, _, _ := procMonitorFromWindow.Call(uintptr(hwnd), monitorDefaultToNull)
+	if monitor == 0 {
+		return 0
+	}
+
+	search := monitorSearch{}
+	procEnumDisplayMonitors.Call(0, 0, enumMonitorsCallback, uintptr(unsafe.Pointer(&search)))
+
+	sort.Slice(search.monitors, func(i, j int) bool {
+		if search.monitors[i].left != search.monitors[j].left {
+			return search.monitors[i].left < search.monitors[j].left
+		}
+
+		return search.monitors[i].top < search.monitors[j].top
+	})
+
+	for monitorIdx, displayMonitor := range search.monitors {
+		if displayMonitor.handle == monitor {
+			return monitorIdx + 1
+		}
+	}
+
+	return 0
+}
+
+// collectMonitor is called by EnumDisplayMonitors for every monitor
+func collectMonitor(monitor uintptr, hdc uintptr, rect *win.RECT, lParam *uintptr) uintptr {
+	search := (*monitorSearch)(unsafe.Pointer(lParam))
+	search.monitors = append(search.monitors, displayMonitor{handle: monitor, left: rect.Left, top: rect.Top})
+
+	// indicates to the system to keep iterating
+	return 1
+}
+
+func watchForegroundWindow(onChange func()) (func(), error) {
+	foregroundChangeHandlerLock.Lock()
+	defer foregroundChangeHandlerLock.Unlock()
+
+	if foregroundChangeHandler != nil {
+		return nil, errors.New("already watching foreground window")
+	}
+
+	started := make(chan error)
+	var threadID uintptr
+
+	// win event hooks are delivered through the message loop of the thread that set them,
+	// so this gets a thread of its own for as long as we're watching
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+
+		hook, _, err := procSetWinEventHook.Call(
+			eventSystemForeground,
+			eventSystemForeground,
+			0,
+			foregroundEventCallback,
+			0,
+			0,
+			winEventOutOfContext,
+		)
+
+		if hook == 0 {
+			started <- fmt.Errorf("set foreground win event hook: %w", err)
+			return
+		}
+		defer procUnhookWinEvent.Call(hook)
+
+		threadID, _, _ = procGetCurrentThreadId.Call()
+		started <- nil
+
+		var msg win.MSG
+		for win.GetMessage(&msg, 0, 0, 0) > 0 {
+			win.TranslateMessage(&msg)
+			win.DispatchMessage(&msg)
+		}
+	}()
+
+	if err := <-started; err != nil {
+		return nil, err
+	}
+
+	foregroundChangeHandler = onChange
+
+	stop := func() {
+		foregroundChangeHandlerLock.Lock()
+		defer foregroundChangeHandlerLock.Unlock()
+
+		foregroundChangeHandler = nil
+		procPostThreadMessageW.Call(threadID, wmQuit, 0, 0)
+	}
+
+	return stop, nil
+}
+
+// handleForegroundEvent is the win event hook for foreground window changes
+func handleForegroundEvent(hook uintptr, event uintptr, hwnd uintptr, objectID uintptr, childID uintptr,
+	eventThread uintptr, eventTime uintptr) uintptr {
+
+	if int32(objectID) != objectIDWindow {
+		return 0
+	}
+
+	foregroundChangeHandlerLock.Lock()
+	handler := foregroundChangeHandler
+	foregroundChangeHandlerLock.Unlock()
+
+	if handler != nil {
+		handler()
+	}
+
+	return 0
+}
@@ -0,0 +1,352 @@
+package deej
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/omriharel/deej/pkg/deej/util"
+)
+
+// virtual sliders aren't on the device: their value is worked out from the ones that are, like
+// "min(slider0, slider1)" or "slider2 * slider3", and they're mapped like any other slider. the sliders
+// an expression uses are their slider IDs in the active profile, at their final (0-1) values
+const virtualSliderPrefix = "slider"
+
+// how deep parentheses, functions and negations can go in an expression, well past anything written by hand
+const maxVirtualExpressionDepth = 64
+
+// virtualSlider is a slider driven by an expression over physical ones
+type virtualSlider struct {
+	expression string
+	evaluate   virtualExpression
+
+	// the physical sliders it uses, by slider ID
+	inputs []int
+}
+
+// virtualExpression works out a value from the physical sliders' values, or false if one it uses has none yet
+type virtualExpression func(values map[int]float32) (float64, bool)
+
+// virtualSliderFromConfig parses a virtual slider's expression. it's made of slider<id>, numbers, + - * /,
+// parentheses and min(...), max(...) and avg(...)
+func virtualSliderFromConfig(value interface{}) (virtualSlider, error) {
+	expression := strings.TrimSpace(fmt.Sprint(value))
+
+	parser := &virtualExpressionParser{tokens: tokenizeVirtualExpression(expression)}
+
+	evaluate, err := parser.parseSum()
+	if err != nil {
+		return virtualSlider{}, err
+	}
+
+	if parser.position < len(parser.tokens) {
+		return virtualSlider{}, fmt.Errorf("unexpected %q", parser.tokens[parser.position])
+	}
+
+	return virtualSlider{expression: expression, evaluate: evaluate, inputs: parser.inputs}, nil
+}
+
+// tokenizeVirtualExpression splits an expression into names, numbers and single-character operators
+func tokenizeVirtualExpression(expression string) []string {
+	tokens := []string{}
+	current := strings.Builder{}
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	for _, r := range strings.ToLower(expression) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_':
+			current.WriteRune(r)
+		case unicode.IsSpace(r):
+			flush()
+		default:
+			flush()
+			tokens = append(tokens, string(r))
+		}
+	}
+
+	flush()
+
+	return tokens
+}
+
+// virtualExpressionParser is a small recursive descent parser, with the usual precedence
+type virtualExpressionParser struct {
+	tokens   []string
+	position int
+	inputs   []int
+	depth    int
+}
+
+func (p *virtualExpressionParser) peek() string {
+	if p.position >= len(p.tokens) {
+		return ""
+	}
+
+	return p.tokens[p.position]
+}
+
+func (p *virtualExpressionParser) next() string {
+	token := p.peek()
+	p.position++
+
+	return token
+}
+
+func (p *virtualExpressionParser) expect(token string) error {
+	if got := p.next(); got != token {
+		if got == "" {
+			return fmt.Errorf("expected %q, got the end of the expression", token)
+		}
+
+		return fmt.Errorf("expected %q, got %q", token, got)
+	}
+
+	return nil
+}
+
+// parseSum parses terms joined by + and -
+func (p *virtualExpressionParser) parseSum() (virtualExpression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "+" || p.peek() == "-" {
+		operator := p.next()
+
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+
+		left = combineVirtualExpressions(left, right, func(a float64, b float64) float64 {
+			if operator == "+" {
+				return a + b
+			}
+
+			return a - b
+		})
+	}
+
+	return left, nil
+}
+
+// parseProduct parses factors joined by * and /. dividing by zero comes out as zero
+func (p *virtualExpressionParser) parseProduct() (virtualExpression, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "*" || p.peek() == "/" {
+		operator := p.next()
+
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		left = combineVirtualExpressions(left, right, func(a float64, b float64) float64 {
+			if operator == "*" {
+				return a * b
+			}
+
+			if b == 0 {
+				return 0
+			}
+
+			return a / b
+		})
+	}
+
+	return left, nil
+}
+
+// parseFactor parses a negation, a number, a slider, a function call or a parenthesized expression
+func (p *virtualExpressionParser) parseFactor() (virtualExpression, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	if p.depth > maxVirtualExpressionDepth {
+		return nil, fmt.Errorf("expression nested more than %d deep", maxVirtualExpressionDepth)
+	}
+
+	token := p.next()
+
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("unexpected end of the expression")
+
+	case token == "-":
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(values map[int]float32) (float64, bool) {
+			value, ok := operand(values)
+			return -value, ok
+		}, nil
+
+	case token == "(":
+		inner, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		return inner, p.expect(")")
+
+	case strings.HasPrefix(token, virtualSliderPrefix):
+		sliderID, err := strconv.Atoi(strings.TrimPrefix(token, virtualSliderPrefix))
+		if err != nil || sliderID < 0 {
+			return nil, fmt.Errorf("invalid slider %q", token)
+		}
+
+		p.inputs = append(p.inputs, sliderID)
+
+		return func(values map[int]float32) (float64, bool) {
+			value, ok := values[sliderID]
+			return float64(value), ok
+		}, nil
+
+	case token == "min" || token == "max" || token == "avg":
+		return p.parseFunction(token)
+	}
+
+	// ParseFloat takes "inf" and "nan" too, which aren't any use as a volume
+	number, err := strconv.ParseFloat(token, 64)
+	if err != nil || math.IsInf(number, 0) || math.IsNaN(number) {
+		return nil, fmt.Errorf("unknown %q", token)
+	}
+
+	return func(map[int]float32) (float64, bool) {
+		return number, true
+	}, nil
+}
+
+// parseFunction parses the arguments of min, max or avg
+func (p *virtualExpressionParser) parseFunction(name string) (virtualExpression, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	arguments := []virtualExpression{}
+
+	for {
+		argument, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+
+		arguments = append(arguments, argument)
+
+		if p.peek() != "," {
+			break
+		}
+
+		p.next()
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+
+	return func(values map[int]float32) (float64, bool) {
+		result, ok := arguments[0](values)
+		if !ok {
+			return 0, false
+		}
+
+		for _, argument := range arguments[1:] {
+			value, ok := argument(values)
+			if !ok {
+				return 0, false
+			}
+
+			switch name {
+			case "min":
+				result = math.Min(result, value)
+			case "max":
+				result = math.Max(result, value)
+			default:
+				result += value
+			}
+		}
+
+		if name == "avg" {
+			result /= float64(len(arguments))
+		}
+
+		return result, true
+	}, nil
+}
+
+func combineVirtualExpressions(left virtualExpression, right virtualExpression,
+	operator func(float64, float64) float64) virtualExpression {
+
+	return func(values map[int]float32) (float64, bool) {
+		a, ok := left(values)
+		if !ok {
+			return 0, false
+		}
+
+		b, ok := right(values)
+		if !ok {
+			return 0, false
+		}
+
+		return operator(a, b), true
+	}
+}
+
+// virtualSliderMoves works out the virtual sliders from the physical sliders' latest moves, returning a move
+// for each one whose value changed
+func (sio *SerialIO) virtualSliderMoves(moveEvents []SliderMoveEvent) []SliderMoveEvent {
+	virtualSliders := sio.deej.config.VirtualSliders
+	if len(virtualSliders) == 0 {
+		return nil
+	}
+
+	for _, moveEvent := range moveEvents {
+		sio.sliderValues[moveEvent.SliderID] = moveEvent.PercentValue
+	}
+
+	// in slider order, so the same moves always come out the same way
+	sliderIDs := make([]int, 0, len(virtualSliders))
+	for sliderID := range virtualSliders {
+		sliderIDs = append(sliderIDs, sliderID)
+	}
+
+	sort.Ints(sliderIDs)
+
+	virtualMoves := []SliderMoveEvent{}
+
+	for _, sliderID := range sliderIDs {
+		// big enough numbers can still overflow into something that isn't one
+		value, ok := virtualSliders[sliderID].evaluate(sio.sliderValues)
+		if !ok || math.IsNaN(value) {
+			continue
+		}
+
+		percentValue := util.NormalizeScalar(float32(math.Max(0, math.Min(1, value))))
+
+		if last, ok := sio.virtualSliderValues[sliderID]; ok && last == percentValue {
+			continue
+		}
+
+		sio.virtualSliderValues[sliderID] = percentValue
+		virtualMoves = append(virtualMoves, SliderMoveEvent{SliderID: sliderID, PercentValue: percentValue, Position: percentValue})
+	}
+
+	return virtualMoves
+}
@@ -0,0 +1,146 @@
+package deej
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestVirtualSliderExpressions(t *testing.T) {
+	values := map[int]float32{0: 0.5, 1: 0.25, 2: 1}
+
+	cases := []struct {
+		expression string
+		expected   float64
+	}{
+		{"slider0", 0.5},
+		{"0.75", 0.75},
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"8 / 4 / 2", 1},
+		{"1 - 2 - 3", -4},
+		{"-slider0 + 1", 0.5},
+		{"- (slider0 + slider1)", -0.75},
+		{"slider0 * slider2 - slider1", 0.25},
+		{"min(slider0, slider1)", 0.25},
+		{"max(slider0, slider1, 0.1)", 0.5},
+		{"avg(slider0, slider1, slider2)", 0.5833333333333334},
+		{"min(slider2)", 1},
+		{"max(slider0, min(slider1, 0.1)) * 2", 1},
+		{"SLIDER0 * Slider2", 0.5},
+
+		// dividing by zero is zero, rather than sending a volume to infinity
+		{"slider0 / 0", 0},
+		{"1 / (slider0 - 0.5)", 0},
+	}
+
+	for _, c := range cases {
+		virtual, err := virtualSliderFromConfig(c.expression)
+		if err != nil {
+			t.Errorf("%q: %v", c.expression, err)
+			continue
+		}
+
+		value, ok := virtual.evaluate(values)
+		if !ok {
+			t.Errorf("%q: expected a value", c.expression)
+			continue
+		}
+
+		if math.Abs(value-c.expected) > 1e-9 {
+			t.Errorf("%q: expected %v, got %v", c.expression, c.expected, value)
+		}
+	}
+}
+
+func TestVirtualSliderInputs(t *testing.T) {
+	virtual, err := virtualSliderFromConfig("min(slider3, slider12) + slider0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(virtual.inputs) != 3 || virtual.inputs[0] != 3 || virtual.inputs[1] != 12 || virtual.inputs[2] != 0 {
+		t.Errorf("expected inputs [3 12 0], got %v", virtual.inputs)
+	}
+
+	// a slider that hasn't moved yet (or isn't on the device at all) leaves the expression without a value
+	if value, ok := virtual.evaluate(map[int]float32{3: 1, 0: 1}); ok {
+		t.Errorf("expected no value without slider 12, got %v", value)
+	}
+}
+
+func TestVirtualSliderBadExpressions(t *testing.T) {
+	cases := []struct {
+		expression string
+		err        string
+	}{
+		{"", "unexpected end"},
+		{"slider", "invalid slider"},
+		{"sliderx", "invalid slider"},
+		{"slider1.5", "invalid slider"},
+		{"slider99999999999999999999", "invalid slider"},
+		{"volume0", "unknown \"volume0\""},
+		{"sum(slider0)", "unknown \"sum\""},
+		{"nan", "unknown \"nan\""},
+		{"inf * slider0", "unknown \"inf\""},
+		{"1e999", "unknown \"1e999\""},
+		{"slider0 +", "unexpected end"},
+		{"* slider0", "unknown \"*\""},
+		{"slider0 slider1", "unexpected \"slider1\""},
+		{"(slider0", "expected \")\", got the end"},
+		{"slider0)", "unexpected \")\""},
+		{"min", "expected \"(\", got the end"},
+		{"min()", "unknown \")\""},
+		{"min(slider0,)", "unknown \")\""},
+		{"max(slider0 slider1)", "expected \")\", got \"slider1\""},
+		{"slider0 % 2", "unexpected \"%\""},
+		{"<nil>", "unknown \"<\""},
+		{strings.Repeat("(", 1000) + "1" + strings.Repeat(")", 1000), "nested more than"},
+		{strings.Repeat("-", 1000) + "1", "nested more than"},
+	}
+
+	for _, c := range cases {
+		_, err := virtualSliderFromConfig(c.expression)
+		if err == nil {
+			t.Errorf("%q: expected an error", c.expression)
+			continue
+		}
+
+		if !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: expected an error about %s, got %v", c.expression, c.err, err)
+		}
+	}
+}
+
+// whatever an expression comes out as, the slider it drives stays a volume
+func TestVirtualSliderMovesStayInRange(t *testing.T) {
+	sio := &SerialIO{
+		deej:                &Deej{config: &CanonicalConfig{VirtualSliders: map[int]virtualSlider{}}},
+		sliderValues:        map[int]float32{},
+		virtualSliderValues: map[int]float32{},
+	}
+
+	for sliderID, expression := range map[int]string{
+		10: "slider0 * 4",
+		11: "slider0 - 4",
+		12: "1e308 * 10 - 1e308 * 10",
+	} {
+		virtual, err := virtualSliderFromConfig(expression)
+		if err != nil {
+			t.Fatalf("%q: %v", expression, err)
+		}
+
+		sio.deej.config.VirtualSliders[sliderID] = virtual
+	}
+
+	moves := sio.virtualSliderMoves([]SliderMoveEvent{{SliderID: 0, PercentValue: 0.5}})
+
+	final := map[int]float32{}
+	for _, move := range moves {
+		final[move.SliderID] = move.PercentValue
+	}
+
+	if len(final) != 2 || final[10] != 1 || final[11] != 0 {
+		t.Errorf("expected slider 10 at 1 and 11 at 0 (and no move for 12), got %v", final)
+	}
+}
@@ -0,0 +1,27 @@
+package deej
+
+// volumeLimit caps the volumes sliders can set, while it's in effect (see hearing_protection.go and quiet_hours.go)
+type volumeLimit interface {
+
+	// volumeCap returns the highest volume the given session can be set to, or false if it isn't capped
+	volumeCap(sessionKey string) (float32, bool)
+}
+
+func (d *Deej) volumeLimits() []volumeLimit {
+	return []volumeLimit{d.hearing, d.quietHours}
+}
+
+// limitVolume brings a volume a slider is setting on the given session down to the lowest cap in effect,
+// returning whether it had to
+func (m *sessionMap) limitVolume(sessionKey string, volume float32) (float32, bool) {
+	capped := false
+
+	for _, limit := range m.deej.volumeLimits() {
+		if highest, ok := limit.volumeCap(sessionKey); ok && volume > highest {
+			volume = highest
+			capped = true
+		}
+	}
+
+	return volume, capped
+}
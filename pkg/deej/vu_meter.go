@@ -0,0 +1,99 @@
+package deej
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/omriharel/deej/pkg/deej/protocol"
+)
+
+const (
+	defaultVUMeterSegments = 8
+	maxVUMeterSegments     = 64
+)
+
+// vuMeterConfig holds the user's settings for VU meters on devices with LED bars or rings
+type vuMeterConfig struct {
+	Enabled  bool
+	Segments int
+}
+
+// vuMeterLevel turns an audio peak (0-100) into a number of lit segments. any sound at all lights
+// the first segment, so quiet apps don't look like they're not playing
+func vuMeterLevel(peak int, segments int) int {
+	if peak <= 0 {
+		return 0
+	}
+
+	level := (peak*segments + 99) / 100
+	if level > segments {
+		level = segments
+	}
+
+	return level
+}
+
+// applyVUMeter sends every slider's VU meter level, if any of them changed since they were last sent
+func (pm *ProcessMonitor) applyVUMeter(peaks map[int]int) {
+	config := pm.deej.config.VUMeter
+	if !config.Enabled || pm.numSliders == 0 {
+		return
+	}
+
+	levels := make(map[int]int, len(peaks))
+	changed := len(pm.lastKnownVULevels) != len(peaks)
+
+	for sliderID, peak := range peaks {
+		levels[sliderID] = vuMeterLevel(peak, config.Segments)
+
+		if lastLevel, ok := pm.lastKnownVULevels[sliderID]; !ok || lastLevel != levels[sliderID] {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return
+	}
+
+	if err := pm.serial.SendVUMeter(levels, config.Segments, pm.numSliders); err != nil {
+		if pm.deej.Verbose() {
+			pm.logger.Warnw("Failed to send VU meter levels", "error", err)
+		}
+
+		return
+	}
+
+	pm.lastKnownVULevels = levels
+}
+
+// SendVUMeter sends every slider's VU meter level (out of the given number of segments) in a single command
+func (sio *SerialIO) SendVUMeter(levels map[int]int, segments int, numSliders int) error {
+	if !sio.isConnected() {
+		return errors.New("serial: not connected")
+	}
+
+	// VU meters are drawn with the LEDs
+	if sio.deviceLacks(deviceFeatureLEDs) {
+		return nil
+	}
+
+	if indices, deviceSliders := sio.deviceSliderIndices(numSliders); indices != nil {
+		deviceLevels := make(map[int]int, len(indices))
+		for sliderID, sliderIdx := range indices {
+			deviceLevels[sliderIdx] = levels[sliderID]
+		}
+
+		levels, numSliders = deviceLevels, deviceSliders
+	}
+
+	if err := sio.writeCommand(protocol.VUMeter(levels, segments, numSliders)); err != nil {
+		sio.logger.Warnw("Failed to send VU meter levels", "error", err)
+		return fmt.Errorf("write VU meter levels: %w", err)
+	}
+
+	if sio.deej.Verbose() {
+		sio.logger.Debugw("Sent VU meter levels", "levels", levels, "segments", segments)
+	}
+
+	return nil
+}
@@ -0,0 +1,351 @@
+//go:build !deej_noweb
+// +build !deej_noweb
+
+package deej
+
+// the pages the API serves to browsers. builds for headless setups can leave them out with the deej_noweb tag
+// (see web_ui_off.go), and the API keeps working without them
+const webUISupported = true
+
+// the dashboard page: every slider with its live volume (and peak, with an audio meter, and fader position when
+// that's not where its volume ended up) and targets, then every button's action. targets are picked from the
+// running sessions or typed in, and saving writes config.yaml, which deej then reloads like any other edit.
+// a token in the page's URL (?token=) goes along with its requests
+const dashboardPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>deej - dashboard</title>
+<style>
+	body { font-family: sans-serif; margin: 0; background: #1e1e1e; color: #ddd; }
+	header { padding: 8px 12px; background: #2d2d2d; display: flex; gap: 12px; align-items: center; }
+	header h1 { font-size: 18px; margin: 0; flex: 1; }
+	main { padding: 12px; max-width: 900px; }
+	h2 { font-size: 15px; color: #aaa; margin: 20px 0 8px; }
+	.row { display: flex; gap: 10px; align-items: center; padding: 8px; margin-bottom: 6px; background: #2a2a2a; border-radius: 4px; flex-wrap: wrap; }
+	.id { width: 70px; font-weight: bold; }
+	.level { width: 160px; height: 10px; background: #444; position: relative; border-radius: 2px; }
+	.level .volume { position: absolute; left: 0; top: 0; bottom: 0; background: #5a8; }
+	.level .peak { position: absolute; top: -2px; bottom: -2px; width: 2px; background: #fc8; }
+	.percent { min-width: 40px; text-align: right; white-space: nowrap; color: #aaa; }
+	.muted { color: #d66; }
+	.targets { display: flex; gap: 6px; flex-wrap: wrap; flex: 1; }
+	.target { background: #3a3a3a; padding: 2px 6px; border-radius: 3px; }
+	.target button { background: none; border: none; color: #d66; cursor: pointer; padding: 0 0 0 4px; }
+	input, select, button { background: #333; color: #ddd; border: 1px solid #555; border-radius: 3px; padding: 3px 6px; }
+	button { cursor: pointer; }
+	#errors { color: #d66; white-space: pre-line; }
+	#saved { color: #6c6; }
+</style>
+</head>
+<body>
+<header>
+	<h1>deej</h1>
+	<span id="errors"></span><span id="saved"></span>
+	<button id="save">Save to config.yaml</button>
+</header>
+<main>
+	<h2>Sliders</h2>
+	<div id="sliders"></div>
+	<button id="add-slider">Add slider</button>
+	<h2>Buttons</h2>
+	<div id="buttons"></div>
+	<button id="add-button">Add button</button>
+</main>
+<datalist id="sessions"></datalist>
+<script>
+	const token = new URLSearchParams(location.search).get("token");
+	const withToken = (url) => token ? url + (url.includes("?") ? "&" : "?") + "token=" + encodeURIComponent(token) : url;
+
+	let mappings = { sliders: {}, buttons: {} };
+	let actions = {};
+	let dirty = false;
+
+	function element(tag, properties, children) {
+		const node = Object.assign(document.createElement(tag), properties || {});
+		(children || []).forEach((child) => node.append(child));
+		return node;
+	}
+
+	function changed() {
+		dirty = true;
+		document.getElementById("saved").textContent = "";
+		render();
+	}
+
+	function nextID(mapping) {
+		const ids = Object.keys(mapping).map(Number);
+		return ids.length ? Math.max(...ids) + 1 : 0;
+	}
+
+	function renderSliders() {
+		const container = document.getElementById("sliders");
+		container.replaceChildren();
+
+		Object.keys(mappings.sliders).sort((a, b) => a - b).forEach((id) => {
+			const targets = mappings.sliders[id];
+			const add = element("input", { placeholder: "add target", size: 16 });
+			add.setAttribute("list", "sessions");
+			add.addEventListener("change", () => {
+				if (add.value.trim()) {
+					targets.push(add.value.trim());
+					changed();
+				}
+			});
+
+			container.append(element("div", { className: "row" }, [
+				element("span", { className: "id", textContent: "Slider " + id }),
+				element("div", { className: "level", id: "level-" + id }, [
+					element("div", { className: "volume" }), element("div", { className: "peak" })]),
+				element("span", { className: "percent", id: "percent-" + id }),
+				element("div", { className: "targets" }, targets.map((target, idx) =>
+					element("span", { className: "target", textContent: target }, [
+						element("button", { textContent: "x", onclick: () => { targets.splice(idx, 1); changed(); } })]))),
+				add,
+				element("button", { textContent: "Remove", onclick: () => { delete mappings.sliders[id]; changed(); } }),
+			]));
+		});
+	}
+
+	function renderButtons() {
+		const container = document.getElementById("buttons");
+		container.replaceChildren();
+
+		Object.keys(mappings.buttons).sort((a, b) => a - b).forEach((id) => {
+			const button = mappings.buttons[id];
+			button.params = button.params || {};
+
+			const action = element("select", {}, Object.keys(actions).sort().map((name) =>
+				element("option", { value: name, textContent: name, selected: name === button.action })));
+			action.addEventListener("change", () => { button.action = action.value; changed(); });
+
+			const mode = element("select", {}, ["momentary", "toggle"].map((name) =>
+				element("option", { value: name, textContent: name, selected: name === (button.mode || "momentary") })));
+			mode.addEventListener("change", () => { button.mode = mode.value; changed(); });
+
+			const params = (actions[button.action] || []).map((key) => {
+				const input = element("input", { placeholder: key, value: button.params[key] || "", size: 14 });
+				input.addEventListener("change", () => { button.params[key] = input.value; dirty = true; });
+				return input;
+			});
+
+			container.append(element("div", { className: "row" }, [
+				element("span", { className: "id", textContent: "Button " + id }),
+				action, mode, ...params,
+				element("button", { textContent: "Press", onclick: () => fetch(withToken("/buttons?id=" + id), { method: "POST" }) }),
+				element("button", { textContent: "Remove", onclick: () => { delete mappings.buttons[id]; changed(); } }),
+			]));
+		});
+	}
+
+	function render() {
+		renderSliders();
+		renderButtons();
+	}
+
+	async function load() {
+		const response = await fetch(withToken("/config/mappings"));
+		const loaded = await response.json();
+		mappings = { sliders: loaded.sliders || {}, buttons: loaded.buttons || {} };
+		actions = loaded.actions;
+		dirty = false;
+		render();
+	}
+
+	async function refreshSessions() {
+		const response = await fetch(withToken("/sessions?fields=key"));
+		if (!response.ok) return;
+		const keys = [...new Set((await response.json()).map((session) => session.key))].sort();
+		document.getElementById("sessions").replaceChildren(...keys.map((key) => element("option", { value: key })));
+	}
+
+	async function refreshLevels() {
+		const sliders = await (await fetch(withToken("/sliders"))).json();
+		const meter = await fetch(withToken("/meter?fields=peak"));
+		const peaks = meter.ok ? await meter.json() : {};
+
+		Object.keys(mappings.sliders).forEach((id) => {
+			const level = document.getElementById("level-" + id);
+			const percent = document.getElementById("percent-" + id);
+			if (!level) return;
+
+			const state = sliders[id];
+			level.querySelector(".volume").style.width = (state ? state.volume : 0) + "%";
+			level.querySelector(".peak").style.left = (peaks[id] ? peaks[id].peak : 0) + "%";
+			percent.textContent = !state ? "-"
+				: state.position === undefined || state.position === state.volume ? state.volume + "%"
+				: state.position + "% \u2192 " + state.volume + "%";
+			percent.className = "percent" + (state && state.muted ? " muted" : "");
+		});
+	}
+
+	document.getElementById("add-slider").onclick = () => { mappings.sliders[nextID(mappings.sliders)] = []; changed(); };
+	document.getElementById("add-button").onclick = () => {
+		mappings.buttons[nextID(mappings.buttons)] = { action: Object.keys(actions).sort()[0], params: {} };
+		changed();
+	};
+
+	document.getElementById("save").onclick = async () => {
+		const response = await fetch(withToken("/config/mappings"), {
+			method: "POST",
+			headers: { "Content-Type": "application/json" },
+			body: JSON.stringify(mappings),
+		});
+		const errors = document.getElementById("errors");
+
+		if (response.ok) {
+			errors.textContent = "";
+			document.getElementById("saved").textContent = "Saved";
+			dirty = false;
+			return;
+		}
+
+		const body = await response.text();
+		try {
+			errors.textContent = JSON.parse(body).errors.join("\n");
+		} catch (e) {
+			errors.textContent = body;
+		}
+	};
+
+	window.addEventListener("beforeunload", (event) => { if (dirty) event.preventDefault(); });
+
+	load().then(() => {
+		refreshSessions();
+		setInterval(refreshSessions, 5000);
+		setInterval(() => refreshLevels().catch(() => {}), 250);
+	});
+</script>
+</body>
+</html>
+`
+
+// the console page: connection status up top, frames below. pausing keeps fetching (so nothing is missed while
+// paused, up to what the console keeps) but stops the list from scrolling; export saves what's shown as text
+const serialConsolePage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>deej - serial console</title>
+<style>
+	body { font-family: sans-serif; margin: 0; background: #1e1e1e; color: #ddd; }
+	header { padding: 8px 12px; background: #2d2d2d; display: flex; gap: 12px; align-items: center; flex-wrap: wrap; }
+	#status { font-weight: bold; }
+	#status.connected { color: #6c6; }
+	#status.disconnected { color: #d66; }
+	#frames { font-family: monospace; font-size: 13px; padding: 8px 12px; height: calc(100vh - 60px); overflow-y: auto; }
+	.frame { white-space: pre; }
+	.at { color: #888; }
+	.in { color: #8cf; }
+	.out { color: #fc8; }
+</style>
+</head>
+<body>
+<header>
+	<span id="status">connecting...</span>
+	<span id="counts"></span>
+	<select id="direction">
+		<option value="">both directions</option>
+		<option value="in">from device</option>
+		<option value="out">to device</option>
+	</select>
+	<input id="contains" placeholder="filter">
+	<button id="pause">pause</button>
+	<button id="clear">clear</button>
+	<button id="export">export</button>
+</header>
+<div id="frames"></div>
+<script>
+	const maxShown = 1000;
+	const framesElement = document.getElementById("frames");
+	let lastSeq = 0;
+	let paused = false;
+	let held = [];
+
+	function restart() {
+		lastSeq = 0;
+		held = [];
+		framesElement.textContent = "";
+	}
+
+	function show(frames) {
+		for (const frame of frames) {
+			const row = document.createElement("div");
+			row.className = "frame " + frame.direction;
+			row.dataset.text = frame.at + " " + (frame.direction === "in" ? "<- " : "-> ") + frame.line;
+
+			const at = document.createElement("span");
+			at.className = "at";
+			at.textContent = new Date(frame.at).toLocaleTimeString() + " ";
+
+			row.appendChild(at);
+			row.appendChild(document.createTextNode((frame.direction === "in" ? "<- " : "-> ") + frame.line));
+			framesElement.appendChild(row);
+		}
+
+		while (framesElement.childElementCount > maxShown) {
+			framesElement.removeChild(framesElement.firstChild);
+		}
+
+		framesElement.scrollTop = framesElement.scrollHeight;
+	}
+
+	async function poll() {
+		const query = new URLSearchParams({
+			since: lastSeq,
+			direction: document.getElementById("direction").value,
+			contains: document.getElementById("contains").value,
+			limit: maxShown,
+		});
+
+		try {
+			const response = await fetch("/serial?" + query);
+			const status = await response.json();
+
+			const statusElement = document.getElementById("status");
+			statusElement.className = status.connected ? "connected" : "disconnected";
+			statusElement.textContent = (status.connected ? "connected to " : "not connected - last tried ") +
+				(status.device ? status.device + " (" + status.port + ")" : status.port || "no port") +
+				(status.baudRate ? " at " + status.baudRate + " baud" : "");
+
+			document.getElementById("counts").textContent = status.inbound + " in, " + status.outbound + " out";
+
+			if (status.frames.length > 0) {
+				lastSeq = status.frames[status.frames.length - 1].seq;
+				held = held.concat(status.frames).slice(-maxShown);
+			}
+
+			if (!paused) {
+				show(held);
+				held = [];
+			}
+		} catch (error) {
+			document.getElementById("status").textContent = "deej isn't responding";
+		}
+
+		setTimeout(poll, 250);
+	}
+
+	document.getElementById("direction").addEventListener("change", restart);
+	document.getElementById("contains").addEventListener("input", restart);
+	document.getElementById("clear").addEventListener("click", () => { framesElement.textContent = ""; });
+
+	document.getElementById("pause").addEventListener("click", (event) => {
+		paused = !paused;
+		event.target.textContent = paused ? "resume" : "pause";
+	});
+
+	document.getElementById("export").addEventListener("click", () => {
+		const lines = Array.from(framesElement.children).map((row) => row.dataset.text);
+		const link = document.createElement("a");
+
+		link.href = URL.createObjectURL(new Blob([lines.join("\n") + "\n"], { type: "text/plain" }));
+		link.download = "deej-serial-" + new Date().toISOString().replace(/[:.]/g, "-") + ".txt";
+		link.click();
+	});
+
+	poll();
+</script>
+</body>
+</html>
+`
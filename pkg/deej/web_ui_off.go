@@ -0,0 +1,25 @@
+//go:build deej_noweb
+// +build deej_noweb
+
+package deej
+
+// built with deej_noweb, for headless setups that only want the API: the pages it'd serve to browsers are left out,
+// and their routes say so instead
+const webUISupported = false
+
+const webUIMissingPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>deej</title>
+</head>
+<body>
+<p>This build of deej was made without its web pages (the deej_noweb build tag). The API itself still works.</p>
+</body>
+</html>
+`
+
+const (
+	dashboardPage     = webUIMissingPage
+	serialConsolePage = webUIMissingPage
+)
@@ -0,0 +1,241 @@
+//go:build !deej_nointegrations
+// +build !deej_nointegrations
+
+package deej
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// webhooks are sent one at a time, and anything past this many waiting is dropped rather than piling up
+	// behind a slow server
+	webhookQueueSize = 64
+
+	webhookRequestTimeout = 10 * time.Second
+)
+
+// webhookDelivery is an event on its way to a webhook
+type webhookDelivery struct {
+	hook  webhookConfig
+	event deejEvent
+}
+
+// webhookSender fires the user's webhooks on connection changes, profile switches, mutes and slider thresholds,
+// so deej can drive whatever it doesn't talk to itself (home automation, chat bots and so on)
+type webhookSender struct {
+	deej       *Deej
+	logger     *zap.SugaredLogger
+	httpClient *http.Client
+
+	lock    sync.Mutex
+	running bool
+
+	// what profile switches and threshold crossings are compared against
+	lastProfile  string
+	sliderValues map[int]float32
+
+	queue       chan webhookDelivery
+	stopChannel chan bool
+}
+
+func newWebhookSender(deej *Deej, logger *zap.SugaredLogger) *webhookSender {
+	logger = logger.Named("webhooks")
+
+	ws := &webhookSender{
+		deej:         deej,
+		logger:       logger,
+		httpClient:   &http.Client{Timeout: webhookRequestTimeout},
+		sliderValues: map[int]float32{},
+		queue:        make(chan webhookDelivery, webhookQueueSize),
+		stopChannel:  make(chan bool),
+	}
+
+	logger.Debug("Created webhook sender instance")
+
+	return ws
+}
+
+func (ws *webhookSender) initialize() {
+	ws.lastProfile = ws.deej.config.ActiveProfile
+
+	ws.setupOnConfigReload()
+	ws.setupOnSliderMove()
+}
+
+// Start begins sending webhooks. events from before that (or after Stop) aren't sent
+func (ws *webhookSender) Start() {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if ws.running {
+		return
+	}
+
+	ws.running = true
+
+	go ws.sendLoop()
+}
+
+// Stop stops sending webhooks, dropping any still waiting
+func (ws *webhookSender) Stop() {
+	ws.lock.Lock()
+
+	if !ws.running {
+		ws.lock.Unlock()
+		return
+	}
+
+	ws.running = false
+	ws.lock.Unlock()
+
+	ws.stopChannel <- true
+}
+
+// emit sends an event to every webhook that wants it
+func (ws *webhookSender) emit(kind string, subject string, value string, data map[string]interface{}) {
+	event := newDeejEvent(kind, subject, value, data)
+
+	for _, hook := range ws.deej.config.Webhooks {
+		if hook.wants(event) {
+			ws.enqueue(hook, event)
+		}
+	}
+}
+
+func (ws *webhookSender) enqueue(hook webhookConfig, event deejEvent) {
+	ws.lock.Lock()
+	defer ws.lock.Unlock()
+
+	if !ws.running {
+		return
+	}
+
+	select {
+	case ws.queue <- webhookDelivery{hook: hook, event: event}:
+	default:
+		ws.logger.Warnw("Too many webhooks waiting, dropping one", "url", hook.URL, "kind", event.Type)
+	}
+}
+
+func (ws *webhookSender) sendLoop() {
+	for {
+		select {
+		case <-ws.stopChannel:
+			return
+
+		case delivery := <-ws.queue:
+			if err := ws.send(delivery.hook, delivery.event); err != nil {
+				ws.logger.Warnw("Failed to send webhook", "url", delivery.hook.URL, "kind", delivery.event.Type, "error", err)
+				continue
+			}
+
+			if ws.deej.Verbose() {
+				ws.logger.Debugw("Sent webhook", "url", delivery.hook.URL, "event", delivery.event)
+			}
+		}
+	}
+}
+
+func (ws *webhookSender) send(hook webhookConfig, event deejEvent) error {
+	body := &bytes.Buffer{}
+
+	var payload interface{} = event
+	if hook.Format == webhookFormatIFTTT {
+		payload = map[string]string{"value1": event.Type, "value2": event.Subject, "value3": event.Value}
+	}
+
+	if hook.Template != nil {
+		if err := hook.Template.Execute(body, event); err != nil {
+			return fmt.Errorf("render template: %w", err)
+		}
+	} else if err := json.NewEncoder(body).Encode(payload); err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	request, err := http.NewRequest(hook.Method, hook.URL, body)
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", hook.ContentType)
+	for name, value := range hook.Headers {
+		request.Header.Set(name, value)
+	}
+
+	return doPushRequest(ws.httpClient, request)
+}
+
+func (ws *webhookSender) setupOnConfigReload() {
+	ws.deej.onConfigReload(func() {
+		profile := ws.deej.config.ActiveProfile
+
+		ws.lock.Lock()
+		switched := profile != ws.lastProfile
+		ws.lastProfile = profile
+		ws.lock.Unlock()
+
+		if switched {
+			ws.emit(webhookEventProfile, webhookEventProfile, profile, map[string]interface{}{"profile": profile})
+		}
+	})
+}
+
+func (ws *webhookSender) setupOnSliderMove() {
+	sliderEventsChannel := ws.deej.serial.SubscribeToSliderMoveEvents().Events
+
+	go func() {
+		for event := range sliderEventsChannel {
+			ws.checkThresholds(event.SliderID, event.PercentValue)
+		}
+	}()
+}
+
+// checkThresholds fires threshold events for every threshold the slider just crossed. a slider's first
+// reading doesn't cross anything, it only says where it starts
+func (ws *webhookSender) checkThresholds(sliderID int, value float32) {
+	ws.lock.Lock()
+	previous, known := ws.sliderValues[sliderID]
+	ws.sliderValues[sliderID] = value
+	ws.lock.Unlock()
+
+	if !known {
+		return
+	}
+
+	subject := fmt.Sprintf("slider %d", sliderID)
+
+	for _, hook := range ws.deej.config.Webhooks {
+		percent, ok := hook.Thresholds[sliderID]
+		if !ok {
+			continue
+		}
+
+		threshold := float32(percent) / 100
+		if (previous < threshold) == (value < threshold) {
+			continue
+		}
+
+		direction := "above"
+		if value < threshold {
+			direction = "below"
+		}
+
+		event := newDeejEvent(webhookEventThreshold, subject, direction, map[string]interface{}{
+			"slider":    sliderID,
+			"threshold": percent,
+			"percent":   eventPercent(value),
+		})
+
+		if hook.wants(event) {
+			ws.enqueue(hook, event)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package deej
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"go.uber.org/zap"
+)
+
+const (
+	webhookEventProfile   = "profile"   // the active profile changed
+	webhookEventMute      = "mute"      // deej muted or unmuted a session (from a button, the API, a schedule...)
+	webhookEventThreshold = "threshold" // a slider crossed one of the webhook's thresholds
+
+	// IFTTT's webhooks only take value1-3, so that's what the ifttt format sends: type, subject and value
+	webhookFormatEvent = "event"
+	webhookFormatIFTTT = "ifttt"
+)
+
+// every event a webhook can ask for
+var webhookEventKinds = map[string]bool{
+	eventKindConnection:   true,
+	webhookEventProfile:   true,
+	webhookEventMute:      true,
+	webhookEventThreshold: true,
+}
+
+// webhookConfig is a single configured webhook
+type webhookConfig struct {
+	URL         string
+	Method      string
+	ContentType string
+	Headers     map[string]string
+
+	// the events it's sent for (every one if empty), and optionally only those about a matching subject
+	// (a name or pattern, like targets)
+	Events  map[string]bool
+	Subject string
+
+	// slider percentages that fire a threshold event when crossed, by slider ID
+	Thresholds map[int]int
+
+	// what to send: the event (see event_schema.go) or IFTTT's value1-3, unless there's a template to render instead
+	Format   string
+	Template *template.Template
+}
+
+// wants reports whether the webhook is sent for the given event
+func (hook webhookConfig) wants(event deejEvent) bool {
+	if len(hook.Events) > 0 && !hook.Events[event.Type] {
+		return false
+	}
+
+	return hook.Subject == "" || targetMatchesName(hook.Subject, strings.ToLower(event.Subject))
+}
+
+// webhooksFromConfig reads the configured webhooks, skipping (and warning about) any that can't work
+func webhooksFromConfig(logger *zap.SugaredLogger, raw interface{}) []webhookConfig {
+	entries, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	hooks := []webhookConfig{}
+
+	for idx, rawEntry := range entries {
+		fields, ok := toStringMap(rawEntry)
+		if !ok {
+			logger.Warnw("Ignoring invalid webhook", "index", idx)
+			continue
+		}
+
+		hook, err := webhookFromFields(fields)
+		if err != nil {
+			logger.Warnw("Ignoring invalid webhook", "index", idx, "error", err)
+			continue
+		}
+
+		hooks = append(hooks, hook)
+	}
+
+	return hooks
+}
+
+func webhookFromFields(fields map[string]interface{}) (webhookConfig, error) {
+	hook := webhookConfig{
+		URL:         strings.TrimSpace(fmt.Sprint(fields["url"])),
+		Method:      http.MethodPost,
+		Format:      webhookFormatEvent,
+		ContentType: "application/json",
+		Headers:     map[string]string{},
+		Events:      map[string]bool{},
+		Thresholds:  map[int]int{},
+	}
+
+	if fields["url"] == nil || !(strings.HasPrefix(hook.URL, "http://") || strings.HasPrefix(hook.URL, "https://")) {
+		return webhookConfig{}, fmt.Errorf("url must be an http or https URL")
+	}
+
+	if method, ok := fields["method"]; ok {
+		hook.Method = strings.ToUpper(fmt.Sprint(method))
+	}
+
+	if format, ok := fields["format"]; ok {
+		hook.Format = strings.ToLower(fmt.Sprint(format))
+
+		if hook.Format != webhookFormatEvent && hook.Format != webhookFormatIFTTT {
+			return webhookConfig{}, fmt.Errorf("format must be %s or %s", webhookFormatEvent, webhookFormatIFTTT)
+		}
+	}
+
+	if contentType, ok := fields["content_type"]; ok {
+		hook.ContentType = fmt.Sprint(contentType)
+	}
+
+	if subject, ok := fields["subject"]; ok {
+		hook.Subject = fmt.Sprint(subject)
+
+		if isTargetPattern(hook.Subject) {
+			if _, err := compileTargetPattern(hook.Subject); err != nil {
+				return webhookConfig{}, fmt.Errorf("invalid subject pattern: %w", err)
+			}
+		}
+	}
+
+	if headers, ok := toStringMap(fields["headers"]); ok {
+		for name, value := range headers {
+			hook.Headers[name] = fmt.Sprint(value)
+		}
+	}
+
+	events, _ := fields["events"].([]interface{})
+	for _, event := range events {
+		kind := strings.ToLower(fmt.Sprint(event))
+		if !webhookEventKinds[kind] {
+			return webhookConfig{}, fmt.Errorf("unknown event %q (one of %s)", kind, knownWebhookEvents())
+		}
+
+		hook.Events[kind] = true
+	}
+
+	if thresholds, ok := toStringMap(fields["thresholds"]); ok {
+		for rawSliderID, rawPercent := range thresholds {
+			sliderID, err := strconv.Atoi(rawSliderID)
+			if err != nil || sliderID < 0 {
+				return webhookConfig{}, fmt.Errorf("invalid threshold slider %q", rawSliderID)
+			}
+
+			percent, err := strconv.Atoi(fmt.Sprint(rawPercent))
+			if err != nil || percent <= 0 || percent > 100 {
+				return webhookConfig{}, fmt.Errorf("threshold for slider %d must be a percentage", sliderID)
+			}
+
+			hook.Thresholds[sliderID] = percent
+		}
+	}
+
+	if rawTemplate, ok := fields["template"]; ok {
+		parsed, err := template.New("webhook").Funcs(template.FuncMap{"json": webhookJSON}).Parse(fmt.Sprint(rawTemplate))
+		if err != nil {
+			return webhookConfig{}, fmt.Errorf("invalid template: %w", err)
+		}
+
+		hook.Template = parsed
+	}
+
+	return hook, nil
+}
+
+// webhookJSON is the template's json function, for putting values into JSON bodies safely
+func webhookJSON(value interface{}) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+func knownWebhookEvents() string {
+	kinds := make([]string, 0, len(webhookEventKinds))
+	for kind := range webhookEventKinds {
+		kinds = append(kinds, kind)
+	}
+
+	sort.Strings(kinds)
+
+	return strings.Join(kinds, ", ")
+}